@@ -0,0 +1,183 @@
+// Package cache provides client side cache of responses (RFC 7252 section 5.6). Responses to GET are cached
+// by the method and options of the request which are part of the cache key. A fresh response, within its Max-Age,
+// answers repeated requests without the exchange; a stale one is revalidated by its ETag and the server answers
+// by 2.03 (Valid) instead of the representation.
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+)
+
+// DefaultMaxAge is freshness of a response without Max-Age option.
+const DefaultMaxAge = 60 * time.Second
+
+// Entry is a cached response.
+type Entry struct {
+	Code    codes.Code
+	Options message.Options
+	Payload []byte
+	// Expires is the end of freshness set by Max-Age.
+	Expires time.Time
+}
+
+// ETag returns ETag of the response.
+func (e *Entry) ETag() ([]byte, bool) {
+	v, err := e.Options.GetBytes(message.ETag)
+	return v, err == nil
+}
+
+// Fresh reports whether the response may answer requests without revalidation.
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// CopyTo sets the code, options and body of m to the cached response.
+func (e *Entry) CopyTo(m *pool.Message) {
+	m.SetCode(e.Code)
+	m.ResetOptionsTo(e.Options)
+	if e.Payload != nil {
+		m.SetBody(bytes.NewReader(e.Payload))
+	}
+}
+
+// Store holds cached responses by keys. Multiple goroutines may invoke methods on a Store simultaneously.
+type Store interface {
+	Load(key string) (*Entry, bool)
+	Store(key string, e *Entry)
+	Delete(key string)
+}
+
+// Cache caches responses in the store.
+type Cache struct {
+	store Store
+	now   func() time.Time
+}
+
+// New creates cache of responses in the store.
+func New(store Store) *Cache {
+	return &Cache{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Cacheable reports whether the response to the request may be cached: GET without Observe,
+// notifications are not cached.
+func Cacheable(req *pool.Message) bool {
+	return req.Code() == codes.GET && !req.HasOption(message.Observe)
+}
+
+// Key returns cache key of the request: the endpoint, which distinguishes servers sharing a store, e.g. address
+// of the server, the method and the options which are part of the cache key. ETag is not part of the key, because
+// it is set to revalidate the cached response.
+func Key(endpoint string, req *pool.Message) string {
+	buf := make([]byte, 0, len(endpoint)+64)
+	buf = binary.AppendUvarint(buf, uint64(len(endpoint)))
+	buf = append(buf, endpoint...)
+	buf = append(buf, byte(req.Code()))
+	for _, o := range req.Options() {
+		if o.ID.NoCacheKey() || o.ID == message.ETag {
+			continue
+		}
+		buf = binary.AppendUvarint(buf, uint64(o.ID))
+		buf = binary.AppendUvarint(buf, uint64(len(o.Value)))
+		buf = append(buf, o.Value...)
+	}
+	return string(buf)
+}
+
+// Lookup returns the response cached by the key and whether it is fresh.
+func (c *Cache) Lookup(key string) (*Entry, bool) {
+	e, ok := c.store.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return e, e.Fresh(c.now())
+}
+
+// maxAge returns freshness of the response.
+func maxAge(options message.Options) time.Duration {
+	v, err := options.GetUint32(message.MaxAge)
+	if err != nil {
+		return DefaultMaxAge
+	}
+	return time.Duration(v) * time.Second
+}
+
+func copyOptions(options message.Options) message.Options {
+	c := make(message.Options, 0, len(options))
+	for _, o := range options {
+		c = append(c, message.Option{ID: o.ID, Value: append([]byte(nil), o.Value...)})
+	}
+	return c
+}
+
+// Update caches the response to the request cached by the key and returns the entry which represents it.
+// 2.05 (Content) replaces the cached response, 2.03 (Valid) refreshes it by Max-Age and the other options
+// of the response (RFC 7252 section 5.9.1.3). Other responses remove the cached one and nil is returned.
+func (c *Cache) Update(key string, resp *pool.Message) (*Entry, error) {
+	switch resp.Code() {
+	case codes.Content:
+		payload, err := resp.ReadBody()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Body() != nil {
+			// the response is read by the caller as well
+			if _, err := resp.Body().Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		e := &Entry{
+			Code:    resp.Code(),
+			Options: copyOptions(resp.Options()),
+			Payload: append([]byte(nil), payload...),
+			Expires: c.now().Add(maxAge(resp.Options())),
+		}
+		c.store.Store(key, e)
+		return e, nil
+	case codes.Valid:
+		old, ok := c.store.Load(key)
+		if !ok {
+			return nil, nil
+		}
+		if etag, err := resp.GetOptionBytes(message.ETag); err == nil {
+			if v, ok := old.ETag(); !ok || !bytes.Equal(v, etag) {
+				// validated other representation than the cached one
+				c.store.Delete(key)
+				return nil, nil
+			}
+		}
+		e := &Entry{
+			Code:    old.Code,
+			Options: updateOptions(old.Options, resp.Options()),
+			Payload: old.Payload,
+			Expires: c.now().Add(maxAge(resp.Options())),
+		}
+		c.store.Store(key, e)
+		return e, nil
+	}
+	c.store.Delete(key)
+	return nil, nil
+}
+
+// updateOptions replaces the cached options by the options of the 2.03 (Valid) response.
+func updateOptions(cached, valid message.Options) message.Options {
+	updated := make(message.Options, 0, len(cached)+len(valid))
+	for _, o := range cached {
+		if !valid.HasOption(o.ID) {
+			updated = append(updated, o)
+		}
+	}
+	for _, o := range copyOptions(valid) {
+		updated = updated.Add(o)
+	}
+	return updated
+}
@@ -0,0 +1,121 @@
+package cache_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(path string, opts ...message.Option) *pool.Message {
+	req := pool.NewMessage()
+	req.SetCode(codes.GET)
+	req.SetPath(path)
+	for _, o := range opts {
+		req.AddOptionBytes(o.ID, o.Value)
+	}
+	return req
+}
+
+func newResponse(code codes.Code, payload []byte, opts ...message.Option) *pool.Message {
+	resp := pool.NewMessage()
+	resp.SetCode(code)
+	for _, o := range opts {
+		resp.AddOptionBytes(o.ID, o.Value)
+	}
+	if payload != nil {
+		resp.SetBody(bytes.NewReader(payload))
+	}
+	return resp
+}
+
+func TestKey(t *testing.T) {
+	a := cache.Key("s", newRequest("/a"))
+	require.Equal(t, a, cache.Key("s", newRequest("/a")))
+	require.NotEqual(t, a, cache.Key("s", newRequest("/b")))
+	require.NotEqual(t, a, cache.Key("other", newRequest("/a")))
+	// ETag and NoCacheKey options, e.g. Size2, are not part of the key
+	require.Equal(t, a, cache.Key("s", newRequest("/a", message.Option{ID: message.ETag, Value: []byte("e")}, message.Option{ID: message.Size2, Value: []byte{1}})))
+	require.NotEqual(t, a, cache.Key("s", newRequest("/a", message.Option{ID: message.Accept, Value: []byte{50}})))
+
+	require.True(t, cache.Cacheable(newRequest("/a")))
+	require.False(t, cache.Cacheable(newRequest("/a", message.Option{ID: message.Observe, Value: []byte{}})))
+}
+
+func TestCache_Update(t *testing.T) {
+	c := cache.New(cache.NewMemoryStore(0))
+	key := cache.Key("s", newRequest("/a"))
+	_, fresh := c.Lookup(key)
+	require.False(t, fresh)
+
+	resp := newResponse(codes.Content, []byte("v1"), message.Option{ID: message.ETag, Value: []byte("e1")}, message.Option{ID: message.MaxAge, Value: []byte{}})
+	e, err := c.Update(key, resp)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), e.Payload)
+	// the body is still readable by the caller
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), body)
+
+	// Max-Age 0 is stale at once
+	e, fresh = c.Lookup(key)
+	require.False(t, fresh)
+	etag, ok := e.ETag()
+	require.True(t, ok)
+	require.Equal(t, []byte("e1"), etag)
+
+	// 2.03 Valid refreshes the cached representation
+	e, err = c.Update(key, newResponse(codes.Valid, nil, message.Option{ID: message.ETag, Value: []byte("e1")}, message.Option{ID: message.MaxAge, Value: []byte{60}}))
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, e.Code)
+	require.Equal(t, []byte("v1"), e.Payload)
+	maxAge, err := e.Options.GetUint32(message.MaxAge)
+	require.NoError(t, err)
+	require.Equal(t, uint32(60), maxAge)
+	_, fresh = c.Lookup(key)
+	require.True(t, fresh)
+
+	m := pool.NewMessage()
+	e.CopyTo(m)
+	require.Equal(t, codes.Content, m.Code())
+	body, err = m.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), body)
+
+	// 2.03 Valid of other representation drops the cached one
+	e, err = c.Update(key, newResponse(codes.Valid, nil, message.Option{ID: message.ETag, Value: []byte("e2")}))
+	require.NoError(t, err)
+	require.Nil(t, e)
+	e, _ = c.Lookup(key)
+	require.Nil(t, e)
+
+	// errors are not cached
+	_, err = c.Update(key, newResponse(codes.Content, []byte("v2")))
+	require.NoError(t, err)
+	e, err = c.Update(key, newResponse(codes.NotFound, nil))
+	require.NoError(t, err)
+	require.Nil(t, e)
+	e, _ = c.Lookup(key)
+	require.Nil(t, e)
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := cache.NewMemoryStore(2)
+	s.Store("a", &cache.Entry{Code: codes.Content})
+	s.Store("b", &cache.Entry{Code: codes.Content})
+	_, ok := s.Load("a")
+	require.True(t, ok)
+	// b is the least recently used
+	s.Store("c", &cache.Entry{Code: codes.Content})
+	require.Equal(t, 2, s.Len())
+	_, ok = s.Load("b")
+	require.False(t, ok)
+	_, ok = s.Load("a")
+	require.True(t, ok)
+	s.Delete("a")
+	require.Equal(t, 1, s.Len())
+}
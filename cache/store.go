@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// MemoryStore is Store in memory, which evicts the least recently used responses over the capacity.
+type MemoryStore struct {
+	maxEntries int
+
+	mutex   sync.Mutex
+	items   map[string]*list.Element
+	recency *list.List
+}
+
+// NewMemoryStore creates store of at most maxEntries responses, zero means no limit.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		recency:    list.New(),
+	}
+}
+
+// Load returns the response stored by the key.
+func (s *MemoryStore) Load(key string) (*Entry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.recency.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true
+}
+
+// Store stores the response by the key.
+func (s *MemoryStore) Store(key string, e *Entry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.items[key]; ok {
+		el.Value.(*memoryItem).entry = e
+		s.recency.MoveToFront(el)
+		return
+	}
+	s.items[key] = s.recency.PushFront(&memoryItem{key: key, entry: e})
+	if s.maxEntries > 0 && s.recency.Len() > s.maxEntries {
+		el := s.recency.Back()
+		s.recency.Remove(el)
+		delete(s.items, el.Value.(*memoryItem).key)
+	}
+}
+
+// Delete removes the response stored by the key.
+func (s *MemoryStore) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.recency.Remove(el)
+		delete(s.items, key)
+	}
+}
+
+// Len returns number of stored responses.
+func (s *MemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.recency.Len()
+}
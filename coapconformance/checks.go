@@ -0,0 +1,381 @@
+package coapconformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+const (
+	// unknownCriticalOption and unknownElectiveOption are from the experimental range of RFC 7252, which
+	// the endpoint doesn't know, odd option numbers are critical.
+	unknownCriticalOption message.OptionID = 65001
+	unknownElectiveOption message.OptionID = 65000
+	// maxBlocks bounds blocks of the body transferred by the blockwise check.
+	maxBlocks = 4096
+)
+
+// DefaultChecks returns the checks which are run by default.
+func DefaultChecks() []Check {
+	return []Check{
+		{
+			Name:        "ping",
+			Description: "empty confirmable message is answered by reset or empty acknowledgement (RFC 7252 section 4.3)",
+			Run:         checkPing,
+		},
+		{
+			Name:        "confirmable-request",
+			Description: "confirmable request is acknowledged and answered with its token (RFC 7252 section 5.2)",
+			Run:         checkConfirmableRequest,
+		},
+		{
+			Name:        "non-confirmable-request",
+			Description: "non-confirmable request is answered with its token (RFC 7252 section 5.2.3)",
+			Run:         checkNonConfirmableRequest,
+		},
+		{
+			Name:        "deduplication",
+			Description: "duplicate of a confirmable request is acknowledged again with the same response (RFC 7252 section 4.5)",
+			Run:         checkDeduplication,
+		},
+		{
+			Name:        "retransmission",
+			Description: "unacknowledged confirmable response is retransmitted with the same message ID (RFC 7252 section 4.2)",
+			Run:         checkRetransmission,
+		},
+		{
+			Name:        "unknown-critical-option",
+			Description: "request with an unrecognized critical option is rejected by 4.02 Bad Option (RFC 7252 section 5.4.1)",
+			Run:         checkUnknownCriticalOption,
+		},
+		{
+			Name:        "unknown-elective-option",
+			Description: "unrecognized elective option of a request is ignored (RFC 7252 section 5.4.1)",
+			Run:         checkUnknownElectiveOption,
+		},
+		{
+			Name:        "blockwise-early-negotiation",
+			Description: "Block2 of the first request with the smallest block size is respected (RFC 7959 section 2.4)",
+			Run:         checkBlockwiseEarlyNegotiation,
+		},
+		{
+			Name:        "blockwise-last-block",
+			Description: "blocks of the body are numbered in sequence and the last one ends the transfer with Size2 matching the body (RFC 7959 section 2.2)",
+			Run:         checkBlockwiseLastBlock,
+		},
+	}
+}
+
+func newGet(t *Target, typ udpMessage.Type) (udpMessage.Message, error) {
+	return t.NewRequest(typ, codes.GET)
+}
+
+func checkPing(ctx context.Context, t *Target) error {
+	mid := t.NextMID()
+	err := t.Send(udpMessage.Message{Code: codes.Empty, MessageID: mid, Type: udpMessage.Confirmable})
+	if err != nil {
+		return err
+	}
+	for {
+		m, err := t.Receive(ctx)
+		if err != nil {
+			return fmt.Errorf("no reset: %w", err)
+		}
+		if m.MessageID != mid {
+			t.acknowledgeStray(m)
+			continue
+		}
+		if m.Type == udpMessage.Reset || (m.Type == udpMessage.Acknowledgement && m.Code == codes.Empty) {
+			return nil
+		}
+		return fmt.Errorf("ping is answered by %v %v instead of reset", m.Type, m.Code)
+	}
+}
+
+// receiveAcknowledgement waits for acknowledgement of the request, which may carry the response.
+func receiveAcknowledgement(ctx context.Context, t *Target, req udpMessage.Message) (udpMessage.Message, error) {
+	for {
+		m, err := t.Receive(ctx)
+		if err != nil {
+			return udpMessage.Message{}, fmt.Errorf("no acknowledgement: %w", err)
+		}
+		if m.MessageID != req.MessageID || m.Type == udpMessage.Confirmable || m.Type == udpMessage.NonConfirmable {
+			if bytes.Equal(m.Token, req.Token) && m.Code != codes.Empty {
+				return udpMessage.Message{}, fmt.Errorf("response of type %v is sent before the request is acknowledged", m.Type)
+			}
+			t.acknowledgeStray(m)
+			continue
+		}
+		switch {
+		case m.Type == udpMessage.Reset:
+			return udpMessage.Message{}, ErrReset
+		case m.Code != codes.Empty && !bytes.Equal(m.Token, req.Token):
+			return udpMessage.Message{}, fmt.Errorf("piggybacked response has token %v instead of %v", m.Token, req.Token)
+		}
+		return m, nil
+	}
+}
+
+// receiveResponse waits for separate response of the request and acknowledges it.
+func receiveResponse(ctx context.Context, t *Target, req udpMessage.Message) (udpMessage.Message, error) {
+	for {
+		m, err := t.Receive(ctx)
+		if err != nil {
+			return udpMessage.Message{}, fmt.Errorf("no response: %w", err)
+		}
+		if m.Code == codes.Empty || !bytes.Equal(m.Token, req.Token) {
+			t.acknowledgeStray(m)
+			continue
+		}
+		if m.Type == udpMessage.Confirmable {
+			if err := t.Acknowledge(m); err != nil {
+				return udpMessage.Message{}, err
+			}
+		}
+		return m, nil
+	}
+}
+
+func checkConfirmableRequest(ctx context.Context, t *Target) error {
+	req, err := newGet(t, udpMessage.Confirmable)
+	if err != nil {
+		return err
+	}
+	if err := t.Send(req); err != nil {
+		return err
+	}
+	ack, err := receiveAcknowledgement(ctx, t, req)
+	if err != nil {
+		return err
+	}
+	if ack.Code != codes.Empty {
+		return nil
+	}
+	_, err = receiveResponse(ctx, t, req)
+	return err
+}
+
+func checkNonConfirmableRequest(ctx context.Context, t *Target) error {
+	req, err := newGet(t, udpMessage.NonConfirmable)
+	if err != nil {
+		return err
+	}
+	resp, err := t.Exchange(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Type == udpMessage.Acknowledgement {
+		return errors.New("non-confirmable request is answered by acknowledgement")
+	}
+	return nil
+}
+
+func checkDeduplication(ctx context.Context, t *Target) error {
+	req, err := newGet(t, udpMessage.Confirmable)
+	if err != nil {
+		return err
+	}
+	if err := t.Send(req); err != nil {
+		return err
+	}
+	resp, err := receiveAcknowledgement(ctx, t, req)
+	if err != nil {
+		return err
+	}
+	separate := resp.Code == codes.Empty
+	if separate {
+		if resp, err = receiveResponse(ctx, t, req); err != nil {
+			return err
+		}
+	}
+	// retransmission of the request as if the acknowledgement was lost
+	if err := t.Send(req); err != nil {
+		return err
+	}
+	ack, err := receiveAcknowledgement(ctx, t, req)
+	if err != nil {
+		return fmt.Errorf("duplicate: %w", err)
+	}
+	// the separate response may be sent again piggybacked on the acknowledgement of the duplicate
+	if separate && ack.Code == codes.Empty {
+		return nil
+	}
+	if ack.Code != resp.Code || !bytes.Equal(ack.Payload, resp.Payload) {
+		return fmt.Errorf("duplicate is acknowledged by %v instead of %v", ack.Code, resp.Code)
+	}
+	return nil
+}
+
+func checkRetransmission(ctx context.Context, t *Target) error {
+	req, err := newGet(t, udpMessage.Confirmable)
+	if err != nil {
+		return err
+	}
+	if err := t.Send(req); err != nil {
+		return err
+	}
+	ack, err := receiveAcknowledgement(ctx, t, req)
+	if err != nil {
+		return err
+	}
+	if ack.Code != codes.Empty {
+		return Skip("endpoint piggybacks responses on acknowledgements")
+	}
+	var first udpMessage.Message
+	var start time.Time
+	for {
+		m, err := t.Receive(ctx)
+		if err != nil {
+			if start.IsZero() {
+				return fmt.Errorf("no response: %w", err)
+			}
+			return fmt.Errorf("response isn't retransmitted: %w", err)
+		}
+		if m.Code == codes.Empty || !bytes.Equal(m.Token, req.Token) {
+			t.acknowledgeStray(m)
+			continue
+		}
+		if start.IsZero() {
+			if m.Type != udpMessage.Confirmable {
+				return Skip("separate response is %v", m.Type)
+			}
+			first, start = m, time.Now()
+			continue
+		}
+		if err := t.Acknowledge(m); err != nil {
+			return err
+		}
+		if m.MessageID != first.MessageID {
+			return fmt.Errorf("retransmission has message ID %v instead of %v", m.MessageID, first.MessageID)
+		}
+		return nil
+	}
+}
+
+func checkUnknownCriticalOption(ctx context.Context, t *Target) error {
+	req, err := newGet(t, udpMessage.Confirmable)
+	if err != nil {
+		return err
+	}
+	req.Options = req.Options.Add(message.Option{ID: unknownCriticalOption, Value: []byte{1}})
+	resp, err := t.Exchange(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Code != codes.BadOption {
+		return fmt.Errorf("request is answered by %v instead of %v", resp.Code, codes.BadOption)
+	}
+	return nil
+}
+
+func checkUnknownElectiveOption(ctx context.Context, t *Target) error {
+	req, err := newGet(t, udpMessage.Confirmable)
+	if err != nil {
+		return err
+	}
+	req.Options = req.Options.Add(message.Option{ID: unknownElectiveOption, Value: []byte{1}})
+	resp, err := t.Exchange(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Code == codes.BadOption {
+		return errors.New("request is rejected by BadOption")
+	}
+	return nil
+}
+
+// getBlock requests the block of the body at Path.
+func getBlock(ctx context.Context, t *Target, szx blockwise.SZX, num int64) (udpMessage.Message, error) {
+	req, err := newGet(t, udpMessage.Confirmable)
+	if err != nil {
+		return udpMessage.Message{}, err
+	}
+	block, err := blockwise.EncodeBlockOption(szx, num, false)
+	if err != nil {
+		return udpMessage.Message{}, err
+	}
+	req.Options, _, err = req.Options.SetUint32(make([]byte, 4), message.Block2, block)
+	if err != nil {
+		return udpMessage.Message{}, err
+	}
+	resp, err := t.Exchange(ctx, req)
+	if err != nil {
+		return udpMessage.Message{}, err
+	}
+	if !codes.IsSuccess(resp.Code) {
+		return udpMessage.Message{}, fmt.Errorf("block %v is answered by %v", num, resp.Code)
+	}
+	return resp, nil
+}
+
+func checkBlockwiseEarlyNegotiation(ctx context.Context, t *Target) error {
+	resp, err := getBlock(ctx, t, blockwise.SZX16, 0)
+	if err != nil {
+		return err
+	}
+	block, err := resp.Options.GetUint32(message.Block2)
+	if err != nil {
+		if int64(len(resp.Payload)) > blockwise.SZX16.Size() {
+			return fmt.Errorf("body of %v bytes is sent without Block2", len(resp.Payload))
+		}
+		return Skip("body of %v fits to a block", len(resp.Payload))
+	}
+	szx, num, more, err := blockwise.DecodeBlockOption(block)
+	if err != nil {
+		return err
+	}
+	switch {
+	case szx != blockwise.SZX16:
+		return fmt.Errorf("block size %v is used instead of %v", szx.Size(), blockwise.SZX16.Size())
+	case num != 0:
+		return fmt.Errorf("block %v is sent instead of 0", num)
+	case more && int64(len(resp.Payload)) != szx.Size():
+		return fmt.Errorf("block of %v bytes isn't the last one", len(resp.Payload))
+	case int64(len(resp.Payload)) > szx.Size():
+		return fmt.Errorf("block of %v bytes is larger than the block size", len(resp.Payload))
+	}
+	return nil
+}
+
+func checkBlockwiseLastBlock(ctx context.Context, t *Target) error {
+	var size int
+	size2 := -1
+	for num := int64(0); num < maxBlocks; num++ {
+		resp, err := getBlock(ctx, t, blockwise.SZX16, num)
+		if err != nil {
+			return err
+		}
+		block, err := resp.Options.GetUint32(message.Block2)
+		if err != nil {
+			if num == 0 {
+				return Skip("body is sent without Block2")
+			}
+			return fmt.Errorf("block %v is sent without Block2", num)
+		}
+		_, gotNum, more, err := blockwise.DecodeBlockOption(block)
+		if err != nil {
+			return err
+		}
+		if gotNum != num {
+			return fmt.Errorf("block %v is sent instead of %v", gotNum, num)
+		}
+		if v, err := resp.Options.GetUint32(message.Size2); err == nil {
+			size2 = int(v)
+		}
+		size += len(resp.Payload)
+		if !more {
+			if size2 >= 0 && size2 != size {
+				return fmt.Errorf("Size2 is %v but body has %v bytes", size2, size)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("body has more than %v blocks", maxBlocks)
+}
@@ -0,0 +1,218 @@
+// Package coapconformance checks protocol behavior of a live CoAP endpoint over UDP, e.g. retransmissions,
+// deduplication, handling of unknown options and blockwise transfers, and reports the outcome in JSON,
+// so releases of firmware and of services are gated by the report.
+//
+// The checks exchange raw messages with the endpoint, so behavior which clients of this library hide,
+// e.g. acknowledgements and retransmissions, is visible to them.
+package coapconformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultTimeout bounds duration of each check. It covers a retransmission of the endpoint with default
+// transmission parameters of RFC 7252.
+const DefaultTimeout = time.Second * 10
+
+// DefaultPath is path of the resource which is requested by the checks.
+const DefaultPath = "/"
+
+// Status is outcome of a check.
+type Status string
+
+const (
+	// StatusPass means the endpoint behaves as the check requires.
+	StatusPass Status = "pass"
+	// StatusFail means the endpoint violates the check.
+	StatusFail Status = "fail"
+	// StatusSkip means the check doesn't apply to the endpoint, e.g. it piggybacks all responses.
+	StatusSkip Status = "skip"
+)
+
+// Result is outcome of one check.
+type Result struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Status      Status        `json:"status"`
+	Detail      string        `json:"detail,omitempty"`
+	Duration    time.Duration `json:"durationNs"`
+}
+
+// Report is outcome of the checks of an endpoint.
+type Report struct {
+	Target   string        `json:"target"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"durationNs"`
+	Passed   int           `json:"passed"`
+	Failed   int           `json:"failed"`
+	Skipped  int           `json:"skipped"`
+	Results  []Result      `json:"results"`
+}
+
+// OK reports whether no check failed.
+func (r *Report) OK() bool {
+	return r.Failed == 0
+}
+
+// WriteJSON writes the report in indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Report) add(res Result) {
+	switch res.Status {
+	case StatusPass:
+		r.Passed++
+	case StatusFail:
+		r.Failed++
+	case StatusSkip:
+		r.Skipped++
+	}
+	r.Results = append(r.Results, res)
+}
+
+// Check is a check of protocol behavior. Run returns nil when the endpoint passes, an error created by Skip
+// when the check doesn't apply to the endpoint and any other error when it fails.
+type Check struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, t *Target) error
+}
+
+type skipError struct {
+	reason string
+}
+
+func (e skipError) Error() string {
+	return e.reason
+}
+
+// Skip creates error which skips the check with the reason.
+func Skip(format string, args ...interface{}) error {
+	return skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+type options struct {
+	path    string
+	timeout time.Duration
+	checks  []Check
+}
+
+// A Option sets options such as path of the resource, timeout of checks, etc.
+type Option interface {
+	apply(*options)
+}
+
+// PathOpt path option.
+type PathOpt struct {
+	path string
+}
+
+func (o PathOpt) apply(opts *options) {
+	opts.path = o.path
+}
+
+// WithPath sets path of the resource which is requested by the checks, DefaultPath is used by default.
+// The resource should answer GET by a body larger than 16 bytes, so blockwise transfers are checked.
+func WithPath(path string) PathOpt {
+	return PathOpt{path: path}
+}
+
+// TimeoutOpt timeout option.
+type TimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o TimeoutOpt) apply(opts *options) {
+	opts.timeout = o.timeout
+}
+
+// WithTimeout bounds duration of each check, DefaultTimeout is used by default.
+func WithTimeout(timeout time.Duration) TimeoutOpt {
+	return TimeoutOpt{timeout: timeout}
+}
+
+// ChecksOpt checks option.
+type ChecksOpt struct {
+	checks []Check
+}
+
+func (o ChecksOpt) apply(opts *options) {
+	opts.checks = o.checks
+}
+
+// WithChecks sets checks which are run in order, DefaultChecks are run by default.
+func WithChecks(checks ...Check) ChecksOpt {
+	return ChecksOpt{checks: checks}
+}
+
+// Run runs the checks against the endpoint at the UDP address and returns the report. An error is returned
+// only when the endpoint cannot be reached at all, failed checks are in the report.
+func Run(ctx context.Context, addr string, opts ...Option) (*Report, error) {
+	cfg := options{
+		path:    DefaultPath,
+		timeout: DefaultTimeout,
+		checks:  DefaultChecks(),
+	}
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve address: %w", err)
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial: %w", err)
+	}
+	defer conn.Close()
+	t := newTarget(conn, cfg.path)
+
+	report := Report{
+		Target:  addr,
+		Started: time.Now(),
+		Results: make([]Result, 0, len(cfg.checks)),
+	}
+	for _, c := range cfg.checks {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.add(runCheck(ctx, t, c, cfg.timeout))
+	}
+	report.Duration = time.Since(report.Started)
+	return &report, nil
+}
+
+func runCheck(ctx context.Context, t *Target, c Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.Run(ctx, t)
+	res := Result{
+		Name:        c.Name,
+		Description: c.Description,
+		Status:      StatusPass,
+		Duration:    time.Since(start),
+	}
+	var skip skipError
+	switch {
+	case err == nil:
+	case errors.As(err, &skip):
+		res.Status = StatusSkip
+		res.Detail = skip.reason
+	default:
+		res.Status = StatusFail
+		res.Detail = err.Error()
+	}
+	// acknowledge leftovers of the check, so they don't disturb the next one
+	t.drain()
+	return res
+}
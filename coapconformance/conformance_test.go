@@ -0,0 +1,81 @@
+package coapconformance_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapconformance"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	body := bytes.Repeat([]byte("0123456789"), 10)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	custom := coapconformance.Check{
+		Name: "custom",
+		Run: func(ctx context.Context, target *coapconformance.Target) error {
+			return coapconformance.Skip("not applicable")
+		},
+	}
+	failing := coapconformance.Check{
+		Name: "failing",
+		Run: func(ctx context.Context, target *coapconformance.Target) error {
+			return errors.New("broken")
+		},
+	}
+	checks := append(coapconformance.DefaultChecks(), custom, failing)
+	report, err := coapconformance.Run(context.Background(), l.LocalAddr().String(),
+		coapconformance.WithPath("/a"), coapconformance.WithTimeout(time.Second*5), coapconformance.WithChecks(checks...))
+	require.NoError(t, err)
+	require.Len(t, report.Results, len(checks))
+
+	statuses := make(map[string]coapconformance.Status)
+	for _, r := range report.Results {
+		statuses[r.Name] = r.Status
+		t.Logf("%v: %v %v", r.Name, r.Status, r.Detail)
+	}
+	// servers of the library pass unknown critical options to handlers, so they reject them by themselves
+	require.Equal(t, coapconformance.StatusFail, statuses["unknown-critical-option"])
+	for _, name := range []string{"ping", "confirmable-request", "non-confirmable-request", "deduplication", "retransmission",
+		"unknown-elective-option", "blockwise-early-negotiation", "blockwise-last-block"} {
+		require.Equal(t, coapconformance.StatusPass, statuses[name], name)
+	}
+	require.Equal(t, coapconformance.StatusSkip, statuses["custom"])
+	require.Equal(t, coapconformance.StatusFail, statuses["failing"])
+	require.False(t, report.OK())
+	require.Equal(t, len(checks), report.Passed+report.Failed+report.Skipped)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+	var decoded coapconformance.Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, report.Results, decoded.Results)
+}
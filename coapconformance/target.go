@@ -0,0 +1,165 @@
+package coapconformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+// maxOptions bounds options of a received message.
+const maxOptions = 64
+
+// drainTimeout is how long leftovers of a check are awaited.
+const drainTimeout = time.Millisecond * 50
+
+// ErrReset is returned by Exchange when the endpoint resets the request.
+var ErrReset = errors.New("request was reset by the endpoint")
+
+// Target exchanges raw messages with the endpoint, it is passed to checks.
+type Target struct {
+	conn *net.UDPConn
+	path string
+	mid  uint32
+	buf  []byte
+}
+
+func newTarget(conn *net.UDPConn, path string) *Target {
+	return &Target{
+		conn: conn,
+		path: path,
+		mid:  uint32(udpMessage.RandMID()),
+		buf:  make([]byte, 64*1024),
+	}
+}
+
+// Path returns path of the resource which is requested by the checks.
+func (t *Target) Path() string {
+	return t.path
+}
+
+// NextMID returns message ID of the next message.
+func (t *Target) NextMID() uint16 {
+	return uint16(atomic.AddUint32(&t.mid, 1))
+}
+
+// NewRequest creates request of the resource at Path with a new message ID and a random token.
+func (t *Target) NewRequest(typ udpMessage.Type, code codes.Code) (udpMessage.Message, error) {
+	token, err := message.GetToken()
+	if err != nil {
+		return udpMessage.Message{}, err
+	}
+	buf := make([]byte, 256)
+	opts, _, err := message.Options{}.SetPath(buf, t.path)
+	if err != nil {
+		return udpMessage.Message{}, fmt.Errorf("cannot set path: %w", err)
+	}
+	return udpMessage.Message{
+		Code:      code,
+		Token:     token,
+		MessageID: t.NextMID(),
+		Type:      typ,
+		Options:   opts,
+	}, nil
+}
+
+// Send sends the message to the endpoint.
+func (t *Target) Send(m udpMessage.Message) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return fmt.Errorf("cannot marshal message: %w", err)
+	}
+	_, err = t.conn.Write(data)
+	return err
+}
+
+// Receive waits for the next message of the endpoint until ctx is done.
+func (t *Target) Receive(ctx context.Context) (udpMessage.Message, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultTimeout)
+	}
+	for {
+		if err := t.conn.SetReadDeadline(deadline); err != nil {
+			return udpMessage.Message{}, err
+		}
+		n, err := t.conn.Read(t.buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return udpMessage.Message{}, ctx.Err()
+			}
+			return udpMessage.Message{}, err
+		}
+		data := append([]byte(nil), t.buf[:n]...)
+		m := udpMessage.Message{Options: make(message.Options, 0, maxOptions)}
+		if _, err := m.Unmarshal(data); err != nil {
+			// ignore datagrams which aren't CoAP messages
+			continue
+		}
+		return m, nil
+	}
+}
+
+// Acknowledge sends empty acknowledgement of the confirmable message.
+func (t *Target) Acknowledge(m udpMessage.Message) error {
+	return t.Send(udpMessage.Message{
+		Code:      codes.Empty,
+		MessageID: m.MessageID,
+		Type:      udpMessage.Acknowledgement,
+	})
+}
+
+// Exchange sends the request and waits for its response, which is piggybacked on the acknowledgement
+// or sent separately. Confirmable responses are acknowledged.
+func (t *Target) Exchange(ctx context.Context, req udpMessage.Message) (udpMessage.Message, error) {
+	if err := t.Send(req); err != nil {
+		return udpMessage.Message{}, err
+	}
+	for {
+		m, err := t.Receive(ctx)
+		if err != nil {
+			return udpMessage.Message{}, fmt.Errorf("cannot receive response: %w", err)
+		}
+		if m.Type == udpMessage.Reset && m.MessageID == req.MessageID {
+			return udpMessage.Message{}, ErrReset
+		}
+		if m.Code == codes.Empty || !bytes.Equal(m.Token, req.Token) {
+			t.acknowledgeStray(m)
+			continue
+		}
+		if m.Type == udpMessage.Confirmable {
+			if err := t.Acknowledge(m); err != nil {
+				return udpMessage.Message{}, err
+			}
+		}
+		return m, nil
+	}
+}
+
+// acknowledgeStray acknowledges confirmable messages which don't belong to the exchange, so the endpoint
+// doesn't retransmit them.
+func (t *Target) acknowledgeStray(m udpMessage.Message) {
+	if m.Type == udpMessage.Confirmable {
+		_ = t.Acknowledge(m)
+	}
+}
+
+// drain acknowledges messages which arrive until the endpoint stays quiet for drainTimeout.
+func (t *Target) drain() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		m, err := t.Receive(ctx)
+		cancel()
+		if err != nil {
+			return
+		}
+		t.acknowledgeStray(m)
+	}
+}
@@ -0,0 +1,187 @@
+// Package coapfuzz exposes parsers of messages and options as fuzz targets, so applications include them in
+// their own fuzzing, e.g. go test -fuzz, go-fuzz or OSS-Fuzz, and crashers are shared in the corpus format
+// of go test. A target parses the input and checks the parsed message survives marshaling and parsing again
+// unchanged; malformed input which is rejected by the parser isn't an error.
+package coapfuzz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	tcpMessage "github.com/plgd-dev/go-coap/v2/tcp/message"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+// ErrInvariant is returned by a target when the parsed input violates an invariant of the library.
+var ErrInvariant = errors.New("invariant violated")
+
+// Target is a fuzz target. It returns whether the parser accepted the data and ErrInvariant when the library
+// misbehaves. Targets don't panic for any input, unless the library does.
+type Target func(data []byte) (bool, error)
+
+// Targets are all targets by their names.
+var Targets = map[string]Target{
+	"udp-message": UDPMessage,
+	"tcp-message": TCPMessage,
+	"options":     Options,
+}
+
+// Names returns sorted names of Targets.
+func Names() []string {
+	names := make([]string, 0, len(Targets))
+	for n := range Targets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UDPMessage parses the data as a datagram of CoAP over UDP (RFC 7252).
+func UDPMessage(data []byte) (bool, error) {
+	m := udpMessage.Message{Options: newOptions(data)}
+	if _, err := m.Unmarshal(data); err != nil {
+		return false, nil
+	}
+	first, err := m.Marshal()
+	if err != nil {
+		return true, fmt.Errorf("%w: cannot marshal parsed message: %v", ErrInvariant, err)
+	}
+	m2 := udpMessage.Message{Options: newOptions(first)}
+	if _, err = m2.Unmarshal(first); err != nil {
+		return true, fmt.Errorf("%w: cannot parse marshaled message: %v", ErrInvariant, err)
+	}
+	if m.Code != m2.Code || m.Type != m2.Type || m.MessageID != m2.MessageID || !bytes.Equal(m.Token, m2.Token) ||
+		!bytes.Equal(m.Payload, m2.Payload) || !equalOptions(m.Options, m2.Options) {
+		return true, fmt.Errorf("%w: message changed by marshaling: %v != %v", ErrInvariant, m, m2)
+	}
+	second, err := m2.Marshal()
+	if err != nil {
+		return true, fmt.Errorf("%w: cannot marshal parsed message: %v", ErrInvariant, err)
+	}
+	if !bytes.Equal(first, second) {
+		return true, fmt.Errorf("%w: marshaling isn't stable: %x != %x", ErrInvariant, first, second)
+	}
+	return true, nil
+}
+
+// TCPMessage parses the data as a message of CoAP over TCP (RFC 8323) with its length header.
+func TCPMessage(data []byte) (bool, error) {
+	m, ok := parseTCP(data)
+	if !ok {
+		return false, nil
+	}
+	first, err := m.Marshal()
+	if err != nil {
+		return true, fmt.Errorf("%w: cannot marshal parsed message: %v", ErrInvariant, err)
+	}
+	m2, ok := parseTCP(first)
+	if !ok {
+		return true, fmt.Errorf("%w: cannot parse marshaled message %x", ErrInvariant, first)
+	}
+	if m.Code != m2.Code || !bytes.Equal(m.Token, m2.Token) || !bytes.Equal(m.Payload, m2.Payload) ||
+		!equalOptions(m.Options, m2.Options) {
+		return true, fmt.Errorf("%w: message changed by marshaling: %v != %v", ErrInvariant, m, m2)
+	}
+	second, err := m2.Marshal()
+	if err != nil {
+		return true, fmt.Errorf("%w: cannot marshal parsed message: %v", ErrInvariant, err)
+	}
+	if !bytes.Equal(first, second) {
+		return true, fmt.Errorf("%w: marshaling isn't stable: %x != %x", ErrInvariant, first, second)
+	}
+	return true, nil
+}
+
+func parseTCP(data []byte) (tcpMessage.Message, bool) {
+	var header tcpMessage.MessageHeader
+	if err := header.Unmarshal(data); err != nil || header.TotalLen > len(data) {
+		return tcpMessage.Message{}, false
+	}
+	m := tcpMessage.Message{Options: newOptions(data)}
+	if _, err := m.UnmarshalWithHeader(header, data[header.HeaderLen:header.TotalLen]); err != nil {
+		return tcpMessage.Message{}, false
+	}
+	return m, true
+}
+
+// Options parses the data as options of a message followed by the payload marker and the payload.
+func Options(data []byte) (bool, error) {
+	opts := newOptions(data)
+	if _, err := opts.Unmarshal(data, message.CoapOptionDefs); err != nil {
+		return false, nil
+	}
+	first, err := marshalOptions(opts)
+	if err != nil {
+		return true, fmt.Errorf("%w: cannot marshal parsed options: %v", ErrInvariant, err)
+	}
+	opts2 := newOptions(first)
+	if _, err = opts2.Unmarshal(first, message.CoapOptionDefs); err != nil {
+		return true, fmt.Errorf("%w: cannot parse marshaled options: %v", ErrInvariant, err)
+	}
+	if !equalOptions(opts, opts2) {
+		return true, fmt.Errorf("%w: options changed by marshaling: %v != %v", ErrInvariant, opts, opts2)
+	}
+	return true, nil
+}
+
+// newOptions returns options with capacity for all options of the data, every option has at least one byte.
+func newOptions(data []byte) message.Options {
+	return make(message.Options, 0, len(data))
+}
+
+func marshalOptions(opts message.Options) ([]byte, error) {
+	n, err := opts.Marshal(nil)
+	if err != nil && !errors.Is(err, message.ErrTooSmall) {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	n, err = opts.Marshal(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func equalOptions(a, b message.Options) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || !bytes.Equal(a[i].Value, b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// GoFuzz adapts the target to the entry point of go-fuzz: it panics when the target returns an error and
+// returns 1 for data accepted by the parser, so go-fuzz prefers it in the corpus.
+func GoFuzz(target Target) func(data []byte) int {
+	return func(data []byte) int {
+		ok, err := target(data)
+		if err != nil {
+			panic(err)
+		}
+		if ok {
+			return 1
+		}
+		return 0
+	}
+}
+
+// Fuzz runs the target by native fuzzing of go test with the seeds, e.g. Seeds, and entries of the corpus
+// in testdata/fuzz of the test.
+func Fuzz(f *testing.F, target Target, seeds ...[]byte) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := target(data); err != nil {
+			t.Fatalf("%v: input %x", err, data)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package coapfuzz
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargets(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			seeds := Seeds(name)
+			require.NotEmpty(t, seeds)
+			for _, s := range seeds {
+				ok, err := Targets[name](s)
+				require.NoError(t, err)
+				require.True(t, ok, "%x", s)
+				require.Equal(t, 1, GoFuzz(Targets[name])(s))
+			}
+			// truncated input is rejected or parsed without violating the invariants
+			for _, s := range seeds {
+				for i := range s {
+					_, err := Targets[name](s[:i])
+					require.NoError(t, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCorpusEntry(t *testing.T) {
+	data := []byte{0x40, 0x01, 0x12, 0x34, 0xff, '"', '\n'}
+	var buf bytes.Buffer
+	err := WriteCorpusEntry(&buf, data)
+	require.NoError(t, err)
+	require.Equal(t, "go test fuzz v1\n[]byte(\"@\\x01\\x124\\xff\\\"\\n\")\n", buf.String())
+	v, err := ReadCorpusEntry(&buf)
+	require.NoError(t, err)
+	require.Equal(t, data, v)
+
+	_, err = ReadCorpusEntry(bytes.NewReader([]byte("go test fuzz v1\nstring(\"a\")\n")))
+	require.ErrorIs(t, err, ErrInvalidCorpusEntry)
+}
+
+func FuzzUDPMessage(f *testing.F) {
+	Fuzz(f, UDPMessage, Seeds("udp-message")...)
+}
+
+func FuzzTCPMessage(f *testing.F) {
+	Fuzz(f, TCPMessage, Seeds("tcp-message")...)
+}
+
+func FuzzOptions(f *testing.F) {
+	Fuzz(f, Options, Seeds("options")...)
+}
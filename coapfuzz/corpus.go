@@ -0,0 +1,133 @@
+package coapfuzz
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	tcpMessage "github.com/plgd-dev/go-coap/v2/tcp/message"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+// corpusHeader is the first line of corpus entries of go test.
+const corpusHeader = "go test fuzz v1"
+
+// ErrInvalidCorpusEntry is returned for a corpus entry which isn't a single []byte value in the format of go test.
+var ErrInvalidCorpusEntry = errors.New("invalid corpus entry")
+
+// WriteCorpusEntry writes the input in the corpus format of go test, e.g. to testdata/fuzz/FuzzName/name.
+func WriteCorpusEntry(w io.Writer, data []byte) error {
+	_, err := fmt.Fprintf(w, "%s\n[]byte(%q)\n", corpusHeader, data)
+	return err
+}
+
+// ReadCorpusEntry reads the input in the corpus format of go test.
+func ReadCorpusEntry(r io.Reader) ([]byte, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), 16*1024*1024)
+	var lines []string
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) != 2 || lines[0] != corpusHeader {
+		return nil, fmt.Errorf("%w: expected header and one value", ErrInvalidCorpusEntry)
+	}
+	v := strings.TrimSuffix(strings.TrimPrefix(lines[1], "[]byte("), ")")
+	if len(v) == len(lines[1]) {
+		return nil, fmt.Errorf("%w: value isn't []byte", ErrInvalidCorpusEntry)
+	}
+	data, err := strconv.Unquote(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCorpusEntry, err)
+	}
+	return []byte(data), nil
+}
+
+// ReadCorpus reads all entries of the corpus directory, e.g. testdata/fuzz/FuzzName.
+func ReadCorpus(dir string) ([][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	corpus := make([][]byte, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		v, err := ReadCorpusEntry(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", e.Name(), err)
+		}
+		corpus = append(corpus, v)
+	}
+	return corpus, nil
+}
+
+// Seeds returns valid inputs of the target, e.g. requests with paths, queries, blocks and payloads.
+func Seeds(name string) [][]byte {
+	opts := seedOptions()
+	switch name {
+	case "udp-message":
+		return marshalSeeds(func(code codes.Code, opts message.Options, payload []byte) ([]byte, error) {
+			return udpMessage.Message{Code: code, Token: []byte{1, 2, 3, 4}, MessageID: 0x1234, Type: udpMessage.Confirmable, Options: opts, Payload: payload}.Marshal()
+		}, opts)
+	case "tcp-message":
+		return marshalSeeds(func(code codes.Code, opts message.Options, payload []byte) ([]byte, error) {
+			return tcpMessage.Message{Code: code, Token: []byte{1, 2, 3, 4}, Options: opts, Payload: payload}.Marshal()
+		}, opts)
+	case "options":
+		seeds := make([][]byte, 0, len(opts))
+		for _, o := range opts {
+			if data, err := marshalOptions(o); err == nil {
+				seeds = append(seeds, append(data, 0xff, 'x'))
+			}
+		}
+		return seeds
+	}
+	return nil
+}
+
+func seedOptions() []message.Options {
+	buf := make([]byte, 256)
+	var get message.Options
+	get, _, _ = get.SetPath(buf, "/a/b/c")
+	get = get.Add(message.Option{ID: message.URIQuery, Value: []byte("q=1")})
+	var block message.Options
+	block = block.Add(message.Option{ID: message.Block2, Value: []byte{0x16}})
+	block = block.Add(message.Option{ID: message.ContentFormat, Value: []byte{byte(message.AppCBOR)}})
+	var observe message.Options
+	observe = observe.Add(message.Option{ID: message.Observe, Value: []byte{0}})
+	observe = observe.Add(message.Option{ID: message.URIPath, Value: bytes.Repeat([]byte{'x'}, 300)})
+	return []message.Options{nil, get, block, observe}
+}
+
+func marshalSeeds(marshal func(code codes.Code, opts message.Options, payload []byte) ([]byte, error), opts []message.Options) [][]byte {
+	seeds := make([][]byte, 0, len(opts))
+	for i, o := range opts {
+		code, payload := codes.GET, []byte(nil)
+		if i%2 == 1 {
+			code, payload = codes.Content, []byte("hello")
+		}
+		if data, err := marshal(code, o, payload); err == nil {
+			seeds = append(seeds, data)
+		}
+	}
+	return seeds
+}
@@ -0,0 +1,74 @@
+// Package coaptest provides assertions of CoAP responses for tests of applications, so the tests don't repeat
+// checks of the code, content format and body of each response.
+package coaptest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// Response is a response of any transport, e.g. *pool.Message of udp, dtls or tcp.
+type Response interface {
+	Code() codes.Code
+	ContentFormat() (message.MediaType, error)
+	ReadBody() ([]byte, error)
+}
+
+// AnyFormat skips comparison of the content format by AssertResponse.
+const AnyFormat message.MediaType = 0xffff
+
+// AssertResponse reports an error of t when the response differs from the wanted code, content format and body.
+// wantFormat AnyFormat skips the content format, nil wantBody skips the body. It returns true when the response
+// is as wanted.
+func AssertResponse(t testing.TB, resp Response, wantCode codes.Code, wantFormat message.MediaType, wantBody []byte) bool {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("response is nil, want %v", wantCode)
+		return false
+	}
+	ok := true
+	if code := resp.Code(); code != wantCode {
+		t.Errorf("response code is %v (%v), want %v (%v)", code, code.Dotted(), wantCode, wantCode.Dotted())
+		ok = false
+	}
+	if wantFormat != AnyFormat {
+		format, err := resp.ContentFormat()
+		switch {
+		case err != nil:
+			t.Errorf("response has no content format, want %v", wantFormat)
+			ok = false
+		case format != wantFormat:
+			t.Errorf("response content format is %v, want %v", format, wantFormat)
+			ok = false
+		}
+	}
+	if wantBody != nil {
+		body, err := resp.ReadBody()
+		switch {
+		case err != nil:
+			t.Errorf("cannot read response body: %v", err)
+			ok = false
+		case !bytes.Equal(body, wantBody):
+			t.Errorf("response body is %q, want %q", body, wantBody)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertSuccess reports an error of t when the response isn't a success, class 2. It returns true on success.
+func AssertSuccess(t testing.TB, resp Response) bool {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("response is nil, want success")
+		return false
+	}
+	if code := resp.Code(); !codes.IsSuccess(code) {
+		t.Errorf("response code is %v (%v), want success", code, code.Dotted())
+		return false
+	}
+	return true
+}
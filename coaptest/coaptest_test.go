@@ -0,0 +1,49 @@
+package coaptest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder records errors instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertResponse(t *testing.T) {
+	resp := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.Content)
+	resp.SetContentFormat(message.AppJSON)
+	resp.SetBody(bytes.NewReader([]byte(`{"a":1}`)))
+
+	r := &recorder{TB: t}
+	require.True(t, AssertResponse(r, resp, codes.Content, message.AppJSON, []byte(`{"a":1}`)))
+	require.True(t, AssertResponse(r, resp, codes.Content, AnyFormat, nil))
+	require.True(t, AssertSuccess(r, resp))
+	require.Empty(t, r.errors)
+
+	require.False(t, AssertResponse(r, resp, codes.NotFound, message.TextPlain, []byte("b")))
+	require.Len(t, r.errors, 3)
+	require.Equal(t, "response code is Content (2.05), want NotFound (4.04)", r.errors[0])
+
+	r.errors = nil
+	resp.SetCode(codes.BadRequest)
+	require.False(t, AssertSuccess(r, resp))
+	require.False(t, AssertResponse(r, nil, codes.Content, AnyFormat, nil))
+	require.Len(t, r.errors, 2)
+}
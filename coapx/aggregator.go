@@ -0,0 +1,167 @@
+package coapx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// SenMLRecord is a record of a SenML pack (RFC 8428). Time of records passed to Aggregator.Set is absolute
+// in seconds since the Unix epoch.
+type SenMLRecord struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"`
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	Time        float64  `json:"t,omitempty"`
+}
+
+// Aggregator is mux.Handler of a collection resource whose representation is a SenML pack with the last record of
+// each member resource. Changes of the members are batched, so observers of the collection get at most one
+// notification per interval with all changes instead of one notification per change.
+//
+// Multiple goroutines may invoke methods on an Aggregator simultaneously.
+type Aggregator struct {
+	observable *Observable
+	baseName   string
+	interval   time.Duration
+	// flushMutex keeps order of notified packs.
+	flushMutex sync.Mutex
+
+	mutex   sync.Mutex
+	records map[string]SenMLRecord
+	changed bool
+	timer   *time.Timer
+	closed  bool
+}
+
+// NewAggregator creates collection resource with base name of its records, e.g. "urn:dev:ow:10e2073a01080063:",
+// which notifies changes batched within interval. Attributes gt, lt and st and WithValueFunc have no effect.
+func NewAggregator(baseName string, interval time.Duration, opt ...ObservableOption) *Aggregator {
+	a := &Aggregator{
+		baseName: baseName,
+		interval: interval,
+		records:  make(map[string]SenMLRecord),
+	}
+	opt = append(opt, WithValueFunc(nil))
+	a.observable = NewObservable(message.AppSenmlJSON, []byte("[]"), opt...)
+	return a
+}
+
+// Set changes the record of the member resource with the same name. The change is notified with other changes
+// when the interval elapses. Time of the record is set to now when it is zero.
+func (a *Aggregator) Set(record SenMLRecord) error {
+	if record.Name == "" {
+		return fmt.Errorf("name of the record is not set")
+	}
+	if record.Value != nil && (math.IsNaN(*record.Value) || math.IsInf(*record.Value, 0)) {
+		return fmt.Errorf("invalid value of record %v", record.Name)
+	}
+	if record.Time == 0 {
+		record.Time = unixSeconds(time.Now())
+	}
+	record.BaseName, record.BaseTime = "", 0
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		return fmt.Errorf("aggregator is closed")
+	}
+	a.records[record.Name] = record
+	a.changed = true
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.interval, a.Flush)
+	}
+	return nil
+}
+
+// SetValue changes numeric value of the member resource with the name.
+func (a *Aggregator) SetValue(name string, value float64, unit string) error {
+	return a.Set(SenMLRecord{Name: name, Unit: unit, Value: &value})
+}
+
+// Flush notifies pending changes without waiting for the interval.
+func (a *Aggregator) Flush() {
+	a.flushMutex.Lock()
+	defer a.flushMutex.Unlock()
+	a.mutex.Lock()
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	if !a.changed || a.closed {
+		a.mutex.Unlock()
+		return
+	}
+	a.changed = false
+	pack, err := a.packLocked()
+	a.mutex.Unlock()
+	if err != nil {
+		a.observable.errors(err)
+		return
+	}
+	a.observable.Update(message.AppSenmlJSON, pack)
+}
+
+// packLocked encodes the records ordered by name. Base time is time of the latest record and time of each record
+// is relative to it.
+func (a *Aggregator) packLocked() ([]byte, error) {
+	names := make([]string, 0, len(a.records))
+	var baseTime float64
+	for name, r := range a.records {
+		names = append(names, name)
+		if r.Time > baseTime {
+			baseTime = r.Time
+		}
+	}
+	sort.Strings(names)
+	pack := make([]SenMLRecord, 0, len(names))
+	for _, name := range names {
+		r := a.records[name]
+		r.Time -= baseTime
+		pack = append(pack, r)
+	}
+	if len(pack) > 0 {
+		pack[0].BaseName = a.baseName
+		pack[0].BaseTime = baseTime
+	}
+	data, err := json.Marshal(pack)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode SenML pack: %w", err)
+	}
+	return data, nil
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// ServeCOAP answers GET by the pack of the collection and registers and deregisters observers.
+func (a *Aggregator) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	a.observable.ServeCOAP(w, r)
+}
+
+// Observers returns number of registered observers.
+func (a *Aggregator) Observers() int {
+	return a.observable.Observers()
+}
+
+// Close drops pending changes and deregisters all observers without notifying them.
+func (a *Aggregator) Close() {
+	a.mutex.Lock()
+	a.closed = true
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.mutex.Unlock()
+	a.observable.Close()
+}
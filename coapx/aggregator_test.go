@@ -0,0 +1,97 @@
+package coapx_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sensors := coapx.NewAggregator("urn:dev:ow:10e2073a01080063:", time.Millisecond*200)
+	defer sensors.Close()
+	m := mux.NewRouter()
+	err = m.Handle("/sensors", sensors)
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	packs := make(chan []coapx.SenMLRecord, 16)
+	obs, err := cc.Observe(ctx, "/sensors", func(r *pool.Message) {
+		cf, err := r.ContentFormat()
+		require.NoError(t, err)
+		require.Equal(t, message.AppSenmlJSON, cf)
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		var pack []coapx.SenMLRecord
+		err = json.Unmarshal(body, &pack)
+		require.NoError(t, err)
+		packs <- pack
+	})
+	require.NoError(t, err)
+	defer obs.Cancel(ctx)
+	require.Empty(t, <-packs)
+
+	// many changes within the interval are notified at once
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sensors.SetValue("temp", float64(20+i), "Cel"))
+		require.NoError(t, sensors.SetValue("humidity", float64(50+i), "%RH"))
+	}
+	require.Error(t, sensors.SetValue("", 1, ""))
+	var pack []coapx.SenMLRecord
+	select {
+	case pack = <-packs:
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.Len(t, pack, 2)
+	require.Equal(t, "urn:dev:ow:10e2073a01080063:", pack[0].BaseName)
+	require.NotZero(t, pack[0].BaseTime)
+	require.Equal(t, "humidity", pack[0].Name)
+	require.Equal(t, "%RH", pack[0].Unit)
+	require.Equal(t, 59.0, *pack[0].Value)
+	require.Equal(t, "temp", pack[1].Name)
+	require.Equal(t, 29.0, *pack[1].Value)
+	require.LessOrEqual(t, pack[1].Time, 0.0)
+	select {
+	case pack = <-packs:
+		require.FailNow(t, "unexpected notification", "%v", pack)
+	case <-time.After(time.Millisecond * 400):
+	}
+
+	// flush notifies without waiting for the interval
+	vs := "open"
+	require.NoError(t, sensors.Set(coapx.SenMLRecord{Name: "door", StringValue: &vs}))
+	sensors.Flush()
+	pack = <-packs
+	require.Len(t, pack, 3)
+	require.Equal(t, "door", pack[0].Name)
+	require.Equal(t, "open", *pack[0].StringValue)
+	require.Equal(t, "urn:dev:ow:10e2073a01080063:", pack[0].BaseName)
+}
@@ -0,0 +1,97 @@
+package coapx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// CancelReason is the reason why an observer disappeared.
+type CancelReason int
+
+const (
+	// CancelDeregistered means the observer deregistered by GET with Observe 1.
+	CancelDeregistered CancelReason = iota
+	// CancelReset means the observer rejected a notification by RST.
+	CancelReset
+	// CancelConnectionClosed means the connection of the observer was closed.
+	CancelConnectionClosed
+	// CancelNotificationFailed means a notification wasn't delivered, e.g. its retransmissions timed out.
+	CancelNotificationFailed
+	// CancelQueueOverflow means the observer was disconnected by the Disconnect policy of its send queue.
+	CancelQueueOverflow
+	// CancelClosed means the resource was closed.
+	CancelClosed
+)
+
+func (r CancelReason) String() string {
+	switch r {
+	case CancelDeregistered:
+		return "Deregistered"
+	case CancelReset:
+		return "Reset"
+	case CancelConnectionClosed:
+		return "ConnectionClosed"
+	case CancelNotificationFailed:
+		return "NotificationFailed"
+	case CancelQueueOverflow:
+		return "QueueOverflow"
+	case CancelClosed:
+		return "Closed"
+	}
+	return fmt.Sprintf("CancelReason(%d)", int(r))
+}
+
+// ObserverCancel describes an observer which disappeared.
+type ObserverCancel struct {
+	RemoteAddr net.Addr
+	Token      message.Token
+	Reason     CancelReason
+	// Err is the error of the failed notification.
+	Err error
+}
+
+// ObserverCancelFunc is called when an observer disappears, e.g. to release upstream subscriptions opened
+// on behalf of the observer.
+type ObserverCancelFunc = func(ObserverCancel)
+
+// ObserverCancelOpt observer cancel option.
+type ObserverCancelOpt struct {
+	onCancel ObserverCancelFunc
+}
+
+func (o ObserverCancelOpt) applyObservable(opts *observableOptions) {
+	opts.onObserverCancel = o.onCancel
+}
+
+// WithObserverCancel sets function which is called when an observer of the resource disappears. It isn't called
+// when the observer re-registers with the same token.
+func WithObserverCancel(onCancel ObserverCancelFunc) ObserverCancelOpt {
+	return ObserverCancelOpt{onCancel: onCancel}
+}
+
+// notifyFailedReason returns the reason of cancel of the observer whose notification failed by err.
+func notifyFailedReason(cc mux.Client, err error) CancelReason {
+	switch {
+	case errors.Is(err, message.ErrMessageReset):
+		return CancelReset
+	case cc.Context().Err() != nil:
+		return CancelConnectionClosed
+	}
+	return CancelNotificationFailed
+}
+
+func cancelObserver(opts observableOptions, cc mux.Client, token message.Token, reason CancelReason, err error) {
+	if opts.onObserverCancel == nil {
+		return
+	}
+	opts.onObserverCancel(ObserverCancel{
+		RemoteAddr: cc.RemoteAddr(),
+		Token:      token,
+		Reason:     reason,
+		Err:        err,
+	})
+}
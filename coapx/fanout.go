@@ -0,0 +1,130 @@
+// Package coapx provides helpers built on top of the transport agnostic mux.Client.
+package coapx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// BuildRequestFunc creates request for the endpoint. The request must use ctx as its context,
+// so the per-endpoint timeout is applied.
+type BuildRequestFunc = func(ctx context.Context, endpoint mux.Client) (*message.Message, error)
+
+// Result holds outcome of the request for one endpoint.
+type Result struct {
+	// Index of the endpoint in the slice passed to FanOut.
+	Index    int
+	Endpoint mux.Client
+	Response *message.Message
+	Err      error
+}
+
+var defaultFanOutOptions = fanOutOptions{
+	concurrency: 16,
+	timeout:     time.Second * 10,
+}
+
+type fanOutOptions struct {
+	concurrency int
+	timeout     time.Duration
+}
+
+// A FanOutOption sets options such as concurrency, timeout, etc.
+type FanOutOption interface {
+	applyFanOut(*fanOutOptions)
+}
+
+// ConcurrencyOpt concurrency option.
+type ConcurrencyOpt struct {
+	concurrency int
+}
+
+func (o ConcurrencyOpt) applyFanOut(opts *fanOutOptions) {
+	opts.concurrency = o.concurrency
+}
+
+// WithConcurrency limits number of requests which are in flight at the same time.
+func WithConcurrency(concurrency int) ConcurrencyOpt {
+	return ConcurrencyOpt{concurrency: concurrency}
+}
+
+// TimeoutOpt timeout option.
+type TimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o TimeoutOpt) applyFanOut(opts *fanOutOptions) {
+	opts.timeout = o.timeout
+}
+
+// WithTimeout set's timeout for request to one endpoint. Zero means no timeout.
+func WithTimeout(timeout time.Duration) TimeoutOpt {
+	return TimeoutOpt{timeout: timeout}
+}
+
+func doRequest(ctx context.Context, timeout time.Duration, idx int, endpoint mux.Client, buildReq BuildRequestFunc) Result {
+	res := Result{
+		Index:    idx,
+		Endpoint: endpoint,
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := buildReq(ctx, endpoint)
+	if err != nil {
+		res.Err = fmt.Errorf("cannot build request: %w", err)
+		return res
+	}
+	if req.Context == nil {
+		req.Context = ctx
+	}
+	res.Response, res.Err = endpoint.Do(req)
+	return res
+}
+
+// FanOut sends the request created by buildReq to all endpoints with bounded concurrency and
+// streams results in order of their arrival. The returned channel is closed when all endpoints
+// were processed. When ctx is done, not yet started endpoints are reported with ctx error.
+func FanOut(ctx context.Context, endpoints []mux.Client, buildReq BuildRequestFunc, opts ...FanOutOption) <-chan Result {
+	cfg := defaultFanOutOptions
+	for _, o := range opts {
+		o.applyFanOut(&cfg)
+	}
+	if cfg.concurrency <= 0 {
+		cfg.concurrency = len(endpoints)
+	}
+
+	results := make(chan Result, len(endpoints))
+	go func() {
+		defer close(results)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		sem := make(chan struct{}, cfg.concurrency)
+		for idx, endpoint := range endpoints {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results <- Result{
+					Index:    idx,
+					Endpoint: endpoint,
+					Err:      ctx.Err(),
+				}
+				continue
+			}
+			wg.Add(1)
+			go func(idx int, endpoint mux.Client) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results <- doRequest(ctx, cfg.timeout, idx, endpoint, buildReq)
+			}(idx, endpoint)
+		}
+	}()
+	return results
+}
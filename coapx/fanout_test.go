@@ -0,0 +1,75 @@
+package coapx_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanOut(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	endpoints := make([]mux.Client, 0, 4)
+	for i := 0; i < 4; i++ {
+		cc, err := udp.Dial(l.LocalAddr().String())
+		require.NoError(t, err)
+		defer cc.Close()
+		endpoints = append(endpoints, cc.Client())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	results := coapx.FanOut(ctx, endpoints, func(ctx context.Context, endpoint mux.Client) (*message.Message, error) {
+		token, err := message.GetToken()
+		if err != nil {
+			return nil, err
+		}
+		opts, _, err := message.Options{}.SetPath(make([]byte, 32), "/a")
+		if err != nil {
+			return nil, err
+		}
+		return &message.Message{
+			Context: ctx,
+			Code:    codes.GET,
+			Token:   token,
+			Options: opts,
+		}, nil
+	}, coapx.WithConcurrency(2), coapx.WithTimeout(time.Second))
+
+	seen := make(map[int]bool)
+	for res := range results {
+		require.NoError(t, res.Err)
+		require.Equal(t, codes.Content, res.Response.Code)
+		require.Equal(t, endpoints[res.Index], res.Endpoint)
+		seen[res.Index] = true
+	}
+	require.Len(t, seen, len(endpoints))
+}
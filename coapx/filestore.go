@@ -0,0 +1,100 @@
+//go:build !tinygo
+
+package coapx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// FileObservationStore is ObservationStore which keeps records in a JSON file. The file is rewritten on every
+// change, so it suits servers with few observers or rare notifications; a database fits others better.
+type FileObservationStore struct {
+	path    string
+	mutex   sync.Mutex
+	records map[string]ObserverRecord
+}
+
+// NewFileObservationStore creates store backed by file at path and loads records it contains.
+func NewFileObservationStore(path string) (*FileObservationStore, error) {
+	s := &FileObservationStore{
+		path:    path,
+		records: make(map[string]ObserverRecord),
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("cannot read observation store: %w", err)
+	}
+	var records []ObserverRecord
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode observation store: %w", err)
+	}
+	for _, r := range records {
+		s.records[r.key()] = r
+	}
+	return s, nil
+}
+
+// Save inserts or updates the record with the same remote address and token.
+func (s *FileObservationStore) Save(record ObserverRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[record.key()] = record
+	return s.flush()
+}
+
+// Delete removes the record with the remote address and token.
+func (s *FileObservationStore) Delete(remoteAddr string, token message.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := ObserverRecord{RemoteAddr: remoteAddr, Token: token}.key()
+	if _, ok := s.records[key]; !ok {
+		return nil
+	}
+	delete(s.records, key)
+	return s.flush()
+}
+
+// Load returns all records ordered by resource.
+func (s *FileObservationStore) Load() ([]ObserverRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedRecords(s.records), nil
+}
+
+func (s *FileObservationStore) flush() error {
+	data, err := json.Marshal(sortedRecords(s.records))
+	if err != nil {
+		return fmt.Errorf("cannot encode observation store: %w", err)
+	}
+	// write to temporary file first, so a crash doesn't leave file half written
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot write observation store: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write observation store: %w", err)
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write observation store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package coapx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+type groupObserver struct {
+	key   string
+	cc    mux.Client
+	token message.Token
+	// paths are members of the snapshot, nil means all members.
+	paths []string
+	done  chan struct{}
+	// queue is set by WithObserveQueue.
+	queue *sendQueue
+}
+
+// observes reports whether one of the changed members is in the snapshot of the observer.
+func (ob *groupObserver) observes(changed map[string]json.RawMessage) bool {
+	if ob.paths == nil {
+		return true
+	}
+	for _, p := range ob.paths {
+		if _, ok := changed[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+type groupNotification struct {
+	ob       *groupObserver
+	sequence uint32
+	payload  []byte
+}
+
+// ObservationGroup is mux.Handler of a composite resource which consists of member resources with JSON
+// representations. A FETCH request lists paths of the members as JSON array, e.g. ["/temp","/humidity"], and it is
+// answered by JSON object which maps the paths to the representations. GET is answered by all members.
+// With Observe the requester is notified when one of its members is changed by Set, and every notification
+// carries a snapshot of all its members taken at once, so the observer never sees values of different updates
+// mixed.
+//
+// Multiple goroutines may invoke methods on an ObservationGroup simultaneously.
+type ObservationGroup struct {
+	errors ErrorFunc
+	opts   observableOptions
+
+	mutex     sync.Mutex
+	members   map[string]json.RawMessage
+	observers map[string]*groupObserver
+	sequence  uint32
+}
+
+// NewObservationGroup creates composite resource without members. WithValueFunc has no effect.
+func NewObservationGroup(opt ...ObservableOption) *ObservationGroup {
+	opts := defaultObservableOptions
+	for _, o := range opt {
+		o.applyObservable(&opts)
+	}
+	if opts.errors == nil {
+		opts.errors = func(error) {}
+	}
+	return &ObservationGroup{
+		errors:    opts.errors,
+		opts:      opts,
+		members:   make(map[string]json.RawMessage),
+		observers: make(map[string]*groupObserver),
+		sequence:  2,
+	}
+}
+
+func memberPath(path string) string {
+	return "/" + strings.TrimPrefix(path, "/")
+}
+
+// Set changes values of the members by their paths at once, absent members are added. Observers of the changed
+// members are notified by one notification with the new snapshot. Values are encoded by encoding/json.
+func (g *ObservationGroup) Set(values map[string]interface{}) error {
+	changed := make(map[string]json.RawMessage, len(values))
+	for p, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("cannot encode member %v: %w", p, err)
+		}
+		changed[memberPath(p)] = data
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	g.mutex.Lock()
+	for p, v := range changed {
+		g.members[p] = v
+	}
+	notifications := make([]groupNotification, 0, len(g.observers))
+	for _, ob := range g.observers {
+		if !ob.observes(changed) {
+			continue
+		}
+		payload, err := g.snapshotLocked(ob.paths)
+		if err != nil {
+			g.errors(fmt.Errorf("cannot create snapshot for observer %v: %w", ob.cc.RemoteAddr(), err))
+			continue
+		}
+		notifications = append(notifications, groupNotification{
+			ob:       ob,
+			sequence: g.nextSequenceLocked(),
+			payload:  payload,
+		})
+	}
+	g.mutex.Unlock()
+	g.send(notifications)
+	return nil
+}
+
+// Snapshot returns JSON object with representations of the members on paths, or of all members when no path is set.
+func (g *ObservationGroup) Snapshot(paths ...string) ([]byte, error) {
+	var members []string
+	for _, p := range paths {
+		members = append(members, memberPath(p))
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.snapshotLocked(members)
+}
+
+func (g *ObservationGroup) snapshotLocked(paths []string) ([]byte, error) {
+	if paths == nil {
+		return json.Marshal(g.members)
+	}
+	snapshot := make(map[string]json.RawMessage, len(paths))
+	for _, p := range paths {
+		v, ok := g.members[p]
+		if !ok {
+			return nil, fmt.Errorf("member %v not found", p)
+		}
+		snapshot[p] = v
+	}
+	return json.Marshal(snapshot)
+}
+
+func (g *ObservationGroup) nextSequenceLocked() uint32 {
+	// observe option has 3 bytes
+	g.sequence = (g.sequence + 1) & 0xffffff
+	return g.sequence
+}
+
+// Observers returns number of registered observers.
+func (g *ObservationGroup) Observers() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return len(g.observers)
+}
+
+// Close deregisters all observers without notifying them.
+func (g *ObservationGroup) Close() {
+	g.mutex.Lock()
+	observers := g.observers
+	for _, ob := range observers {
+		close(ob.done)
+	}
+	g.observers = make(map[string]*groupObserver)
+	g.mutex.Unlock()
+	for _, ob := range observers {
+		cancelObserver(g.opts, ob.cc, ob.token, CancelClosed, nil)
+	}
+}
+
+// parseGroupPaths decodes paths of members from the body of FETCH request.
+func parseGroupPaths(r *mux.Message) ([]string, codes.Code, error) {
+	if cf, err := r.Options.ContentFormat(); err == nil && cf != message.AppJSON {
+		return nil, codes.UnsupportedMediaType, fmt.Errorf("unsupported content format %v", cf)
+	}
+	if r.Body == nil {
+		return nil, codes.BadRequest, errors.New("paths of members are not set")
+	}
+	if _, err := r.Body.Seek(0, io.SeekStart); err != nil {
+		return nil, codes.InternalServerError, err
+	}
+	var paths []string
+	if err := json.NewDecoder(r.Body).Decode(&paths); err != nil {
+		return nil, codes.BadRequest, fmt.Errorf("invalid paths of members: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, codes.BadRequest, errors.New("paths of members are not set")
+	}
+	for i := range paths {
+		paths[i] = memberPath(paths[i])
+	}
+	sort.Strings(paths)
+	return paths, codes.Content, nil
+}
+
+// ServeCOAP answers GET and FETCH by the snapshot of the members and registers and deregisters observers.
+func (g *ObservationGroup) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	var paths []string
+	switch r.Code {
+	case codes.GET:
+	case codes.FETCH:
+		var code codes.Code
+		var err error
+		paths, code, err = parseGroupPaths(r)
+		if err != nil {
+			g.setResponse(w, code, message.TextPlain, []byte(err.Error()))
+			return
+		}
+	default:
+		g.setResponse(w, codes.MethodNotAllowed, message.TextPlain, nil)
+		return
+	}
+	obs, err := r.Options.Observe()
+	if err != nil || obs != 0 {
+		if err == nil {
+			g.removeObserver(observerKey(w.Client(), r.Token), nil, CancelDeregistered, nil)
+		}
+		g.mutex.Lock()
+		payload, err := g.snapshotLocked(paths)
+		g.mutex.Unlock()
+		if err != nil {
+			g.setResponse(w, codes.NotFound, message.TextPlain, []byte(err.Error()))
+			return
+		}
+		g.setResponse(w, codes.Content, message.AppJSON, payload)
+		return
+	}
+	ob := &groupObserver{
+		key:   observerKey(w.Client(), r.Token),
+		cc:    w.Client(),
+		token: append(message.Token(nil), r.Token...),
+		paths: paths,
+		done:  make(chan struct{}),
+	}
+	g.mutex.Lock()
+	payload, err := g.snapshotLocked(paths)
+	if err != nil {
+		g.mutex.Unlock()
+		g.setResponse(w, codes.NotFound, message.TextPlain, []byte(err.Error()))
+		return
+	}
+	if g.opts.queueSize > 0 {
+		ob.queue = newSendQueue(g.opts, ob.cc, ob.token, ob.done, func(reason CancelReason, err error) {
+			g.removeObserver(ob.key, ob, reason, err)
+		})
+	}
+	if old, ok := g.observers[ob.key]; ok {
+		close(old.done)
+	}
+	g.observers[ob.key] = ob
+	sequence := g.nextSequenceLocked()
+	g.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-ob.cc.Done():
+			g.removeObserver(ob.key, ob, CancelConnectionClosed, nil)
+		case <-ob.done:
+		}
+	}()
+	g.setResponse(w, codes.Content, message.AppJSON, payload, uint32Option(message.Observe, sequence))
+}
+
+func (g *ObservationGroup) setResponse(w mux.ResponseWriter, code codes.Code, contentFormat message.MediaType, payload []byte, opts ...message.Option) {
+	var body io.ReadSeeker
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	err := w.SetResponse(code, contentFormat, body, opts...)
+	if err != nil {
+		g.errors(fmt.Errorf("cannot set response: %w", err))
+	}
+}
+
+func (g *ObservationGroup) send(notifications []groupNotification) {
+	for _, n := range notifications {
+		qn := queuedNotification{
+			sequence:      n.sequence,
+			contentFormat: message.AppJSON,
+			payload:       n.payload,
+		}
+		if n.ob.queue != nil {
+			n.ob.queue.push(qn)
+			continue
+		}
+		err := writeNotification(n.ob.cc, n.ob.token, qn)
+		if err != nil {
+			g.removeObserver(n.ob.key, n.ob, notifyFailedReason(n.ob.cc, err), err)
+			g.errors(fmt.Errorf("cannot notify observer %v: %w", n.ob.cc.RemoteAddr(), err))
+		}
+	}
+}
+
+// removeObserver removes observer registered under key for the reason. When ob is set, it is removed only
+// when it is still registered.
+func (g *ObservationGroup) removeObserver(key string, ob *groupObserver, reason CancelReason, err error) {
+	g.mutex.Lock()
+	cur, ok := g.observers[key]
+	if !ok || (ob != nil && cur != ob) {
+		g.mutex.Unlock()
+		return
+	}
+	close(cur.done)
+	delete(g.observers, key)
+	g.mutex.Unlock()
+	cancelObserver(g.opts, cur.cc, cur.token, reason, err)
+}
@@ -0,0 +1,116 @@
+package coapx_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type groupClient struct {
+	mux.Client
+	done          chan struct{}
+	notifications []string
+}
+
+func (c *groupClient) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683}
+}
+
+func (c *groupClient) Context() context.Context {
+	return context.Background()
+}
+
+func (c *groupClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *groupClient) WriteMessage(req *message.Message) error {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	c.notifications = append(c.notifications, string(body))
+	return nil
+}
+
+type groupResponseWriter struct {
+	cc   *groupClient
+	code codes.Code
+	body string
+}
+
+func (w *groupResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	w.body = ""
+	if d != nil {
+		body, err := io.ReadAll(d)
+		if err != nil {
+			return err
+		}
+		w.body = string(body)
+	}
+	return nil
+}
+
+func (w *groupResponseWriter) Client() mux.Client {
+	return w.cc
+}
+
+func TestObservationGroup(t *testing.T) {
+	g := coapx.NewObservationGroup()
+	defer g.Close()
+	require.NoError(t, g.Set(map[string]interface{}{"/temp": 20, "/humidity": 40, "door": "closed"}))
+
+	cc := &groupClient{done: make(chan struct{})}
+	defer close(cc.done)
+	serve := func(code codes.Code, token string, observe int, paths string) *groupResponseWriter {
+		m := &message.Message{Code: code, Token: message.Token(token)}
+		if observe >= 0 {
+			m.Options = append(m.Options, message.Option{ID: message.Observe, Value: []byte{byte(observe)}})
+		}
+		if paths != "" {
+			m.Options = append(m.Options, message.Option{ID: message.ContentFormat, Value: []byte{byte(message.AppJSON)}})
+			m.Body = bytes.NewReader([]byte(paths))
+		}
+		w := &groupResponseWriter{cc: cc}
+		g.ServeCOAP(w, &mux.Message{Message: m})
+		return w
+	}
+
+	w := serve(codes.GET, "a", -1, "")
+	require.Equal(t, codes.Content, w.code)
+	require.Equal(t, `{"/door":"closed","/humidity":40,"/temp":20}`, w.body)
+	w = serve(codes.FETCH, "b", 0, `["/temp","humidity"]`)
+	require.Equal(t, codes.Content, w.code)
+	require.Equal(t, `{"/humidity":40,"/temp":20}`, w.body)
+	require.Equal(t, 1, g.Observers())
+	require.Equal(t, codes.NotFound, serve(codes.FETCH, "c", 0, `["/light"]`).code)
+	require.Equal(t, codes.BadRequest, serve(codes.FETCH, "c", 0, `"/temp"`).code)
+	require.Equal(t, codes.MethodNotAllowed, serve(codes.PUT, "c", -1, "").code)
+	require.Equal(t, 1, g.Observers())
+
+	// both members of the snapshot are changed by one notification
+	require.NoError(t, g.Set(map[string]interface{}{"/temp": 21, "/humidity": 45}))
+	require.NoError(t, g.Set(map[string]interface{}{"/door": "open"}))
+	require.Equal(t, []string{`{"/humidity":45,"/temp":21}`}, cc.notifications)
+
+	snapshot, err := g.Snapshot("temp", "door")
+	require.NoError(t, err)
+	require.Equal(t, `{"/door":"open","/temp":21}`, string(snapshot))
+	_, err = g.Snapshot("/light")
+	require.Error(t, err)
+
+	w = serve(codes.FETCH, "b", 1, `["/temp","/humidity"]`)
+	require.Equal(t, codes.Content, w.code)
+	require.Equal(t, 0, g.Observers())
+	require.NoError(t, g.Set(map[string]interface{}{"/temp": 22}))
+	require.Len(t, cc.notifications, 1)
+}
@@ -0,0 +1,516 @@
+package coapx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// ValueFunc extracts numeric value of the representation which is compared with gt, lt and st attributes.
+type ValueFunc = func(contentFormat message.MediaType, payload []byte) (float64, error)
+
+// ErrorFunc is called with errors which cannot be returned to the caller.
+type ErrorFunc = func(error)
+
+// ParseTextValue is default ValueFunc which parses the payload as a number in text.
+func ParseTextValue(contentFormat message.MediaType, payload []byte) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+}
+
+var defaultObservableOptions = observableOptions{
+	value: ParseTextValue,
+	errors: func(err error) {
+		fmt.Println(err)
+	},
+}
+
+type observableOptions struct {
+	value            ValueFunc
+	errors           ErrorFunc
+	queueSize        int
+	queuePolicy      QueuePolicy
+	onQueueOverflow  QueueOverflowFunc
+	onObserverCancel ObserverCancelFunc
+	store            ObservationStore
+}
+
+// A ObservableOption sets options such as value function, etc.
+type ObservableOption interface {
+	applyObservable(*observableOptions)
+}
+
+// ValueFuncOpt value function option.
+type ValueFuncOpt struct {
+	value ValueFunc
+}
+
+func (o ValueFuncOpt) applyObservable(opts *observableOptions) {
+	opts.value = o.value
+}
+
+// WithValueFunc sets function which extracts numeric value from the representation. ParseTextValue is used by default.
+func WithValueFunc(value ValueFunc) ValueFuncOpt {
+	return ValueFuncOpt{value: value}
+}
+
+// ErrorsOpt errors option.
+type ErrorsOpt struct {
+	errors ErrorFunc
+}
+
+func (o ErrorsOpt) applyObservable(opts *observableOptions) {
+	opts.errors = o.errors
+}
+
+// WithErrors set function for logging error.
+func WithErrors(errors ErrorFunc) ErrorsOpt {
+	return ErrorsOpt{errors: errors}
+}
+
+// attributes are conditional attributes of an observation passed as Uri-Query
+// (draft-ietf-core-conditional-attributes).
+type attributes struct {
+	// gt notifies when value crosses above the threshold.
+	gt *float64
+	// lt notifies when value crosses below the threshold.
+	lt *float64
+	// st notifies when value differs at least by the step from the last notified value.
+	st *float64
+	// pmin is minimal period between notifications.
+	pmin time.Duration
+	// pmax is maximal period between notifications.
+	pmax time.Duration
+}
+
+func parseAttributes(queries []string) (attributes, error) {
+	var a attributes
+	for _, q := range queries {
+		kv := strings.SplitN(q, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "gt", "lt", "st", "pmin", "pmax":
+		default:
+			continue
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return attributes{}, fmt.Errorf("invalid value of attribute %v", kv[0])
+		}
+		switch kv[0] {
+		case "gt":
+			a.gt = &v
+		case "lt":
+			a.lt = &v
+		case "st":
+			if v <= 0 {
+				return attributes{}, fmt.Errorf("invalid value of attribute st")
+			}
+			a.st = &v
+		case "pmin":
+			a.pmin = time.Duration(v * float64(time.Second))
+		case "pmax":
+			a.pmax = time.Duration(v * float64(time.Second))
+		}
+	}
+	if a.pmin < 0 || a.pmax < 0 || (a.pmax > 0 && a.pmax < a.pmin) {
+		return attributes{}, fmt.Errorf("invalid value of attributes pmin and pmax")
+	}
+	return a, nil
+}
+
+func (a attributes) hasValueConditions() bool {
+	return a.gt != nil || a.lt != nil || a.st != nil
+}
+
+type observer struct {
+	key   string
+	cc    mux.Client
+	token message.Token
+	attrs attributes
+	done  chan struct{}
+	// resource and queries are persisted by WithObservationStore.
+	resource string
+	queries  []string
+	// queue is set by WithObserveQueue.
+	queue *sendQueue
+
+	lastNotified time.Time
+	lastValue    float64
+	prevValue    float64
+	hasValue     bool
+	pending      bool
+	timer        *time.Timer
+	generation   uint64
+}
+
+// conditionMet evaluates conditional attributes for the new value.
+func (ob *observer) conditionMet(value float64, hasValue bool) bool {
+	if !ob.attrs.hasValueConditions() || !hasValue || !ob.hasValue {
+		// every change is notified when value cannot be evaluated
+		return true
+	}
+	if ob.attrs.gt != nil && ob.prevValue <= *ob.attrs.gt && value > *ob.attrs.gt {
+		return true
+	}
+	if ob.attrs.lt != nil && ob.prevValue >= *ob.attrs.lt && value < *ob.attrs.lt {
+		return true
+	}
+	if ob.attrs.st != nil && math.Abs(value-ob.lastValue) >= *ob.attrs.st {
+		return true
+	}
+	return false
+}
+
+type notification struct {
+	ob            *observer
+	sequence      uint32
+	contentFormat message.MediaType
+	payload       []byte
+}
+
+// Observable is mux.Handler of an observable resource. It registers observers with GET requests
+// and notifies them on Update while evaluating conditional attributes gt, lt, st, pmin and pmax
+// passed as Uri-Query, so observers are notified only when the conditions are met.
+//
+// Multiple goroutines may invoke methods on an Observable simultaneously.
+type Observable struct {
+	value  ValueFunc
+	errors ErrorFunc
+	opts   observableOptions
+
+	mutex         sync.Mutex
+	observers     map[string]*observer
+	sequence      uint32
+	contentFormat message.MediaType
+	payload       []byte
+	current       float64
+	hasCurrent    bool
+}
+
+// NewObservable creates observable resource with the initial representation.
+func NewObservable(contentFormat message.MediaType, payload []byte, opt ...ObservableOption) *Observable {
+	opts := defaultObservableOptions
+	for _, o := range opt {
+		o.applyObservable(&opts)
+	}
+	if opts.errors == nil {
+		opts.errors = func(error) {}
+	}
+	o := &Observable{
+		value:     opts.value,
+		errors:    opts.errors,
+		opts:      opts,
+		observers: make(map[string]*observer),
+		sequence:  2,
+	}
+	o.setLocked(contentFormat, payload)
+	return o
+}
+
+func (o *Observable) setLocked(contentFormat message.MediaType, payload []byte) {
+	o.contentFormat = contentFormat
+	o.payload = append([]byte(nil), payload...)
+	o.current, o.hasCurrent = 0, false
+	if o.value != nil {
+		v, err := o.value(contentFormat, payload)
+		if err == nil {
+			o.current, o.hasCurrent = v, true
+		}
+	}
+}
+
+func (o *Observable) representation() (message.MediaType, []byte) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.contentFormat, o.payload
+}
+
+func (o *Observable) nextSequenceLocked() uint32 {
+	// observe option has 3 bytes
+	o.sequence = (o.sequence + 1) & 0xffffff
+	return o.sequence
+}
+
+func observerKey(cc mux.Client, token message.Token) string {
+	return cc.RemoteAddr().String() + "#" + token.String()
+}
+
+func uint32Option(id message.OptionID, value uint32) message.Option {
+	buf := make([]byte, 4)
+	n, _ := message.EncodeUint32(buf, value)
+	return message.Option{ID: id, Value: buf[:n]}
+}
+
+// ServeCOAP registers and deregisters observers and responds with the current representation.
+func (o *Observable) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	if r.Code != codes.GET {
+		o.setResponse(w, codes.MethodNotAllowed, message.TextPlain, nil)
+		return
+	}
+	obs, err := r.Options.Observe()
+	if err != nil {
+		o.mutex.Lock()
+		contentFormat, payload := o.contentFormat, o.payload
+		o.mutex.Unlock()
+		o.setResponse(w, codes.Content, contentFormat, payload)
+		return
+	}
+	key := observerKey(w.Client(), r.Token)
+	if obs != 0 {
+		o.removeObserver(key, nil, CancelDeregistered, nil)
+		o.mutex.Lock()
+		contentFormat, payload := o.contentFormat, o.payload
+		o.mutex.Unlock()
+		o.setResponse(w, codes.Content, contentFormat, payload)
+		return
+	}
+	queries, err := r.Options.Queries()
+	if err != nil && !errors.Is(err, message.ErrOptionNotFound) {
+		o.setResponse(w, codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	attrs, err := parseAttributes(queries)
+	if err != nil {
+		o.setResponse(w, codes.BadRequest, message.TextPlain, []byte(err.Error()))
+		return
+	}
+	path, _ := r.Options.Path()
+	sequence, contentFormat, payload := o.register(w.Client(), r.Token, attrs, "/"+path, queries)
+	o.setResponse(w, codes.Content, contentFormat, payload, uint32Option(message.Observe, sequence))
+}
+
+// register registers the observer and returns sequence number and representation of its first notification.
+func (o *Observable) register(cc mux.Client, token message.Token, attrs attributes, resource string, queries []string) (uint32, message.MediaType, []byte) {
+	key := observerKey(cc, token)
+	ob := &observer{
+		key:      key,
+		cc:       cc,
+		token:    append(message.Token(nil), token...),
+		attrs:    attrs,
+		done:     make(chan struct{}),
+		resource: resource,
+		queries:  queries,
+	}
+	if o.opts.queueSize > 0 {
+		ob.queue = newSendQueue(o.opts, ob.cc, ob.token, ob.done, func(reason CancelReason, err error) {
+			o.removeObserver(key, ob, reason, err)
+		})
+	}
+	o.mutex.Lock()
+	if old, ok := o.observers[key]; ok {
+		o.stopObserverLocked(old)
+	}
+	o.observers[key] = ob
+	ob.lastNotified = time.Now()
+	ob.lastValue, ob.prevValue, ob.hasValue = o.current, o.current, o.hasCurrent
+	o.scheduleLocked(ob)
+	sequence := o.nextSequenceLocked()
+	contentFormat, payload := o.contentFormat, o.payload
+	o.mutex.Unlock()
+	o.saveRecord(ob, sequence)
+
+	go func() {
+		select {
+		case <-ob.cc.Done():
+			o.removeObserver(key, ob, CancelConnectionClosed, nil)
+		case <-ob.done:
+		}
+	}()
+	return sequence, contentFormat, payload
+}
+
+func (o *Observable) setResponse(w mux.ResponseWriter, code codes.Code, contentFormat message.MediaType, payload []byte, opts ...message.Option) {
+	var body io.ReadSeeker
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	err := w.SetResponse(code, contentFormat, body, opts...)
+	if err != nil {
+		o.errors(fmt.Errorf("cannot set response: %w", err))
+	}
+}
+
+// Update sets new representation of the resource and notifies observers whose conditions are met.
+// Notifications of observers with pmin are postponed until pmin elapses.
+func (o *Observable) Update(contentFormat message.MediaType, payload []byte) {
+	now := time.Now()
+	o.mutex.Lock()
+	o.setLocked(contentFormat, payload)
+	notifications := make([]notification, 0, len(o.observers))
+	for _, ob := range o.observers {
+		met := ob.conditionMet(o.current, o.hasCurrent)
+		if o.hasCurrent {
+			ob.prevValue, ob.hasValue = o.current, true
+		}
+		if !met {
+			continue
+		}
+		if ob.attrs.pmin > 0 && now.Sub(ob.lastNotified) < ob.attrs.pmin {
+			ob.pending = true
+			o.scheduleLocked(ob)
+			continue
+		}
+		notifications = append(notifications, o.notificationLocked(ob, now))
+	}
+	o.mutex.Unlock()
+	o.send(notifications)
+}
+
+// Observers returns number of registered observers.
+func (o *Observable) Observers() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return len(o.observers)
+}
+
+// Close deregisters all observers without notifying them.
+func (o *Observable) Close() {
+	o.mutex.Lock()
+	observers := o.observers
+	for _, ob := range observers {
+		o.stopObserverLocked(ob)
+	}
+	o.observers = make(map[string]*observer)
+	o.mutex.Unlock()
+	for _, ob := range observers {
+		cancelObserver(o.opts, ob.cc, ob.token, CancelClosed, nil)
+	}
+}
+
+func (o *Observable) notificationLocked(ob *observer, now time.Time) notification {
+	ob.pending = false
+	ob.lastNotified = now
+	if o.hasCurrent {
+		ob.lastValue = o.current
+	}
+	o.scheduleLocked(ob)
+	return notification{
+		ob:            ob,
+		sequence:      o.nextSequenceLocked(),
+		contentFormat: o.contentFormat,
+		payload:       o.payload,
+	}
+}
+
+// scheduleLocked plans postponed notification at pmin or periodic notification at pmax.
+func (o *Observable) scheduleLocked(ob *observer) {
+	if ob.timer != nil {
+		ob.timer.Stop()
+		ob.timer = nil
+	}
+	var deadline time.Time
+	switch {
+	case ob.pending:
+		deadline = ob.lastNotified.Add(ob.attrs.pmin)
+	case ob.attrs.pmax > 0:
+		deadline = ob.lastNotified.Add(ob.attrs.pmax)
+	default:
+		return
+	}
+	ob.generation++
+	generation := ob.generation
+	ob.timer = time.AfterFunc(time.Until(deadline), func() {
+		o.onTimer(ob, generation)
+	})
+}
+
+func (o *Observable) onTimer(ob *observer, generation uint64) {
+	o.mutex.Lock()
+	if o.observers[ob.key] != ob || ob.generation != generation {
+		o.mutex.Unlock()
+		return
+	}
+	n := o.notificationLocked(ob, time.Now())
+	o.mutex.Unlock()
+	o.send([]notification{n})
+}
+
+func (o *Observable) send(notifications []notification) {
+	for _, n := range notifications {
+		o.saveRecord(n.ob, n.sequence)
+		qn := queuedNotification{
+			sequence:      n.sequence,
+			contentFormat: n.contentFormat,
+			payload:       n.payload,
+		}
+		if n.ob.queue != nil {
+			n.ob.queue.push(qn)
+			continue
+		}
+		err := writeNotification(n.ob.cc, n.ob.token, qn)
+		if err != nil {
+			o.removeObserver(n.ob.key, n.ob, notifyFailedReason(n.ob.cc, err), err)
+			o.errors(fmt.Errorf("cannot notify observer %v: %w", n.ob.cc.RemoteAddr(), err))
+		}
+	}
+}
+
+// removeObserver removes observer registered under key for the reason. When ob is set, it is removed only
+// when it is still registered.
+func (o *Observable) removeObserver(key string, ob *observer, reason CancelReason, err error) {
+	o.mutex.Lock()
+	cur, ok := o.observers[key]
+	if !ok || (ob != nil && cur != ob) {
+		o.mutex.Unlock()
+		return
+	}
+	o.stopObserverLocked(cur)
+	delete(o.observers, key)
+	o.mutex.Unlock()
+	if reason != CancelConnectionClosed {
+		// observers of closed connections are resumed after restart
+		o.deleteRecord(cur.cc.RemoteAddr().String(), cur.token)
+	}
+	cancelObserver(o.opts, cur.cc, cur.token, reason, err)
+}
+
+func (o *Observable) saveRecord(ob *observer, sequence uint32) {
+	if o.opts.store == nil {
+		return
+	}
+	err := o.opts.store.Save(ObserverRecord{
+		RemoteAddr: ob.cc.RemoteAddr().String(),
+		Token:      ob.token,
+		Resource:   ob.resource,
+		Queries:    ob.queries,
+		Sequence:   sequence,
+	})
+	if err != nil {
+		o.errors(fmt.Errorf("cannot save observer %v: %w", ob.cc.RemoteAddr(), err))
+	}
+}
+
+func (o *Observable) deleteRecord(remoteAddr string, token message.Token) {
+	if o.opts.store == nil {
+		return
+	}
+	err := o.opts.store.Delete(remoteAddr, token)
+	if err != nil {
+		o.errors(fmt.Errorf("cannot delete observer %v: %w", remoteAddr, err))
+	}
+}
+
+func (o *Observable) stopObserverLocked(ob *observer) {
+	if ob.timer != nil {
+		ob.timer.Stop()
+		ob.timer = nil
+	}
+	ob.generation++
+	select {
+	case <-ob.done:
+	default:
+		close(ob.done)
+	}
+}
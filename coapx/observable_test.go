@@ -0,0 +1,164 @@
+package coapx_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObservable(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	temp := coapx.NewObservable(message.TextPlain, []byte("20"))
+	defer temp.Close()
+	m := mux.NewRouter()
+	err = m.Handle("/temp", temp)
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	observe := func(query, want string) (<-chan string, func()) {
+		values := make(chan string, 16)
+		obs, err := cc.Observe(ctx, "/temp", func(r *pool.Message) {
+			body, err := r.ReadBody()
+			require.NoError(t, err)
+			values <- string(body)
+		}, message.Option{
+			ID:    message.URIQuery,
+			Value: []byte(query),
+		})
+		require.NoError(t, err)
+		require.Equal(t, want, <-values)
+		return values, func() {
+			err := obs.Cancel(ctx)
+			require.NoError(t, err)
+		}
+	}
+
+	gt, cancelGt := observe("gt=25", "20")
+	defer cancelGt()
+	step, cancelStep := observe("st=5", "20")
+	defer cancelStep()
+	require.Equal(t, 2, temp.Observers())
+
+	// notifications are processed concurrently by the client, so wait for each of them
+	temp.Update(message.TextPlain, []byte("24"))
+	temp.Update(message.TextPlain, []byte("30"))
+	require.Equal(t, "30", <-gt)
+	require.Equal(t, "30", <-step)
+	temp.Update(message.TextPlain, []byte("31"))
+	temp.Update(message.TextPlain, []byte("20"))
+	require.Equal(t, "20", <-step)
+	temp.Update(message.TextPlain, []byte("26"))
+	require.Equal(t, "26", <-gt)
+	require.Equal(t, "26", <-step)
+	time.Sleep(time.Millisecond * 100)
+	require.Empty(t, gt)
+	require.Empty(t, step)
+
+	pmax, cancelPmax := observe("pmax=0.2", "26")
+	defer cancelPmax()
+	select {
+	case v := <-pmax:
+		require.Equal(t, "26", v)
+	case <-ctx.Done():
+		require.FailNow(t, "notification after pmax was not received")
+	}
+}
+
+func TestObservable_ObserverCancel(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	cancels := make(chan coapx.ObserverCancel, 4)
+	temp := coapx.NewObservable(message.TextPlain, []byte("20"), coapx.WithErrors(func(error) {}), coapx.WithObserverCancel(func(c coapx.ObserverCancel) {
+		cancels <- c
+	}))
+	m := mux.NewRouter()
+	err = m.Handle("/temp", temp)
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	nextCancel := func() coapx.ObserverCancel {
+		select {
+		case c := <-cancels:
+			return c
+		case <-ctx.Done():
+			require.FailNow(t, "observer was not cancelled")
+		}
+		return coapx.ObserverCancel{}
+	}
+
+	// explicit deregistration
+	obs, err := cc.Observe(ctx, "/temp", func(*pool.Message) {})
+	require.NoError(t, err)
+	err = obs.Cancel(ctx)
+	require.NoError(t, err)
+	c := nextCancel()
+	require.Equal(t, coapx.CancelDeregistered, c.Reason)
+	require.NotEmpty(t, c.Token)
+
+	// the client doesn't know the token of the notification, so it rejects it by RST
+	req, err := client.NewGetRequest(ctx, "/temp")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	req.SetObserve(0)
+	err = cc.WriteMessage(req)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return temp.Observers() == 1 }, time.Second, time.Millisecond*10)
+	// reset of a non-confirmable notification fails the next one
+	temp.Update(message.TextPlain, []byte("21"))
+	time.Sleep(time.Millisecond * 100)
+	temp.Update(message.TextPlain, []byte("22"))
+	c = nextCancel()
+	require.Equal(t, coapx.CancelReset, c.Reason)
+	require.ErrorIs(t, c.Err, message.ErrMessageReset)
+	require.Equal(t, 0, temp.Observers())
+
+	_, err = cc.Observe(ctx, "/temp", func(*pool.Message) {})
+	require.NoError(t, err)
+	temp.Close()
+	require.Equal(t, coapx.CancelClosed, nextCancel().Reason)
+}
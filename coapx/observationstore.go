@@ -0,0 +1,185 @@
+package coapx
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// ObserverRecord describes observer registered at a server.
+type ObserverRecord struct {
+	RemoteAddr string        `json:"remoteAddr"`
+	Token      message.Token `json:"token"`
+	Resource   string        `json:"resource"`
+	// Queries are Uri-Query options of the registration with conditional attributes.
+	Queries  []string `json:"queries,omitempty"`
+	Sequence uint32   `json:"sequence"`
+}
+
+func (r ObserverRecord) key() string {
+	return r.RemoteAddr + "#" + r.Token.String()
+}
+
+// ObservationStore persists observers of a server, so they are resumed or cancelled after restart.
+//
+// Multiple goroutines may invoke methods on an ObservationStore simultaneously.
+type ObservationStore interface {
+	// Save inserts or updates the record with the same remote address and token.
+	Save(record ObserverRecord) error
+	// Delete removes the record with the remote address and token. Unknown record is not an error.
+	Delete(remoteAddr string, token message.Token) error
+	// Load returns all records.
+	Load() ([]ObserverRecord, error)
+}
+
+// MemoryObservationStore is ObservationStore which keeps records in memory, e.g. when only the server is restarted
+// within the process.
+type MemoryObservationStore struct {
+	mutex   sync.Mutex
+	records map[string]ObserverRecord
+}
+
+// NewMemoryObservationStore creates empty store.
+func NewMemoryObservationStore() *MemoryObservationStore {
+	return &MemoryObservationStore{
+		records: make(map[string]ObserverRecord),
+	}
+}
+
+// Save inserts or updates the record with the same remote address and token.
+func (s *MemoryObservationStore) Save(record ObserverRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[record.key()] = record
+	return nil
+}
+
+// Delete removes the record with the remote address and token.
+func (s *MemoryObservationStore) Delete(remoteAddr string, token message.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, ObserverRecord{RemoteAddr: remoteAddr, Token: token}.key())
+	return nil
+}
+
+// Load returns all records ordered by resource.
+func (s *MemoryObservationStore) Load() ([]ObserverRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedRecords(s.records), nil
+}
+
+func sortedRecords(m map[string]ObserverRecord) []ObserverRecord {
+	records := make([]ObserverRecord, 0, len(m))
+	for _, r := range m {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Resource == records[j].Resource {
+			return records[i].key() < records[j].key()
+		}
+		return records[i].Resource < records[j].Resource
+	})
+	return records
+}
+
+// ObservationStoreOpt observation store option.
+type ObservationStoreOpt struct {
+	store ObservationStore
+}
+
+func (o ObservationStoreOpt) applyObservable(opts *observableOptions) {
+	opts.store = o.store
+}
+
+// WithObservationStore persists observers of the resource with the sequence number of their last notification.
+// Records of observers whose connection was closed or whose resource was closed are kept, so they are resumed by
+// Observable.Resume or cancelled by CancelObservers after restart of the server.
+func WithObservationStore(store ObservationStore) ObservationStoreOpt {
+	return ObservationStoreOpt{store: store}
+}
+
+// ConnFunc returns connection to the observer of the record, e.g. by udp.Server.ClientConnTo.
+type ConnFunc = func(record ObserverRecord) (mux.Client, error)
+
+// Resume registers observers of the records again, e.g. loaded from the store after restart of the server, so they
+// are notified on Update with sequence numbers following the persisted ones. The caller selects records of the
+// resource. Records whose connection cannot be created are deleted from the store of the resource.
+func (o *Observable) Resume(records []ObserverRecord, conn ConnFunc) error {
+	var errs []error
+	for _, record := range records {
+		err := o.resume(record, conn)
+		if err != nil {
+			o.deleteRecord(record.RemoteAddr, record.Token)
+			errs = append(errs, fmt.Errorf("%v: %w", record.RemoteAddr, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot resume observers: %v", errs)
+	}
+	return nil
+}
+
+func (o *Observable) resume(record ObserverRecord, conn ConnFunc) error {
+	attrs, err := parseAttributes(record.Queries)
+	if err != nil {
+		return err
+	}
+	cc, err := conn(record)
+	if err != nil {
+		return err
+	}
+	o.mutex.Lock()
+	if newerSequence(o.sequence, record.Sequence) {
+		o.sequence = record.Sequence
+	}
+	o.mutex.Unlock()
+	o.register(cc, record.Token, attrs, record.Resource, record.Queries)
+	return nil
+}
+
+// newerSequence reports whether the sequence number is newer than the old one within the 24-bit space
+// of the Observe option.
+func newerSequence(old, new uint32) bool {
+	return (old < new && new-old < 1<<23) || (old > new && old-new > 1<<23)
+}
+
+// CancelObservers sends 5.03 Service Unavailable with Max-Age to observers of the records, e.g. loaded from the
+// store after restart of a server which doesn't resume them, so they know when to register again, and deletes
+// the records from the store.
+func CancelObservers(store ObservationStore, records []ObserverRecord, conn ConnFunc, maxAge time.Duration) error {
+	var errs []error
+	for _, record := range records {
+		err := cancelRecord(record, conn, maxAge)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", record.RemoteAddr, err))
+		}
+		if err := store.Delete(record.RemoteAddr, record.Token); err != nil {
+			errs = append(errs, fmt.Errorf("%v: cannot delete record: %w", record.RemoteAddr, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot cancel observers: %v", errs)
+	}
+	return nil
+}
+
+func cancelRecord(record ObserverRecord, conn ConnFunc, maxAge time.Duration) error {
+	cc, err := conn(record)
+	if err != nil {
+		return err
+	}
+	return cc.WriteMessage(&message.Message{
+		Code:    codes.ServiceUnavailable,
+		Token:   record.Token,
+		Context: cc.Context(),
+		Options: message.Options{
+			uint32Option(message.MaxAge, uint32(maxAge/time.Second)),
+		},
+	})
+}
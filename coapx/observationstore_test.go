@@ -0,0 +1,154 @@
+package coapx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func serveObservable(t *testing.T, l *coapNet.UDPConn, o *coapx.Observable, wg *sync.WaitGroup) *udp.Server {
+	m := mux.NewRouter()
+	err := m.Handle("/temp", o)
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(m))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+	return s
+}
+
+func connTo(t *testing.T, s *udp.Server) coapx.ConnFunc {
+	return func(record coapx.ObserverRecord) (mux.Client, error) {
+		// the server attaches the listener asynchronously
+		require.Eventually(t, func() bool {
+			_, err := s.ClientConnTo(record.RemoteAddr)
+			return err == nil
+		}, time.Second*5, time.Millisecond*10)
+		cc, err := s.ClientConnTo(record.RemoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	}
+}
+
+func TestObservable_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coapx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "observers.json")
+
+	la, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	addr := la.LocalAddr().String()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	store, err := coapx.NewFileObservationStore(path)
+	require.NoError(t, err)
+	temp := coapx.NewObservable(message.TextPlain, []byte("20"), coapx.WithObservationStore(store))
+	sa := serveObservable(t, la, temp, &wg)
+
+	cc, err := udp.Dial(addr)
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	values := make(chan string, 16)
+	obs, err := cc.Observe(ctx, "/temp", func(r *pool.Message) {
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		values <- string(body)
+	}, message.Option{
+		ID:    message.URIQuery,
+		Value: []byte("st=1"),
+	})
+	require.NoError(t, err)
+	defer obs.Cancel(ctx)
+	require.Equal(t, "20", <-values)
+	temp.Update(message.TextPlain, []byte("21"))
+	require.Equal(t, "21", <-values)
+
+	// the observer is kept when the server stops
+	sa.Stop()
+	wg.Wait()
+	temp.Close()
+	require.NoError(t, la.Close())
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "/temp", records[0].Resource)
+	require.Equal(t, []string{"st=1"}, records[0].Queries)
+	require.NotEmpty(t, records[0].RemoteAddr)
+
+	// the restarted server loads the observers and notifies them
+	lb, err := coapNet.NewListenUDP("udp", addr)
+	require.NoError(t, err)
+	defer lb.Close()
+	store, err = coapx.NewFileObservationStore(path)
+	require.NoError(t, err)
+	temp = coapx.NewObservable(message.TextPlain, []byte("21"), coapx.WithObservationStore(store))
+	defer temp.Close()
+	sb := serveObservable(t, lb, temp, &wg)
+	defer sb.Stop()
+	records, err = store.Load()
+	require.NoError(t, err)
+	err = temp.Resume(records, connTo(t, sb))
+	require.NoError(t, err)
+	require.Equal(t, 1, temp.Observers())
+	temp.Update(message.TextPlain, []byte("23"))
+	require.Equal(t, "23", <-values)
+}
+
+func TestCancelObservers(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	store := coapx.NewMemoryObservationStore()
+	temp := coapx.NewObservable(message.TextPlain, []byte("20"), coapx.WithObservationStore(store))
+	defer temp.Close()
+	s := serveObservable(t, l, temp, &wg)
+	defer s.Stop()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	responses := make(chan codes.Code, 16)
+	obs, err := cc.Observe(ctx, "/temp", func(r *pool.Message) {
+		responses <- r.Code()
+	})
+	require.NoError(t, err)
+	defer obs.Cancel(ctx)
+	require.Equal(t, codes.Content, <-responses)
+
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	err = coapx.CancelObservers(store, records, connTo(t, s), time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, codes.ServiceUnavailable, <-responses)
+	records, err = store.Load()
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
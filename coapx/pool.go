@@ -0,0 +1,313 @@
+package coapx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// ErrPoolClosed is returned by Pool after Close.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// ErrDialBackoff is returned by Pool when the last dial of the address failed and the backoff didn't elapse yet.
+var ErrDialBackoff = errors.New("dial is backed off")
+
+// DialFunc creates a connection to the address, e.g. by udp.Dial and Client of the connection.
+type DialFunc = func(ctx context.Context, addr string) (mux.Client, error)
+
+var defaultPoolOptions = poolOptions{
+	minBackoff:          time.Second,
+	maxBackoff:          time.Minute,
+	healthCheckInterval: time.Second * 30,
+	healthCheckTimeout:  time.Second * 5,
+}
+
+type poolOptions struct {
+	minBackoff          time.Duration
+	maxBackoff          time.Duration
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+}
+
+// A PoolOption sets options such as backoff, health check, etc.
+type PoolOption interface {
+	applyPool(*poolOptions)
+}
+
+// BackoffOpt backoff option.
+type BackoffOpt struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (o BackoffOpt) applyPool(opts *poolOptions) {
+	opts.minBackoff = o.min
+	opts.maxBackoff = o.max
+}
+
+// WithBackoff sets delay before the next dial of the address after a failed one. The delay starts at min
+// and doubles with each consecutive failure up to max.
+func WithBackoff(min, max time.Duration) BackoffOpt {
+	return BackoffOpt{min: min, max: max}
+}
+
+// HealthCheckOpt health check option.
+type HealthCheckOpt struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func (o HealthCheckOpt) applyPool(opts *poolOptions) {
+	opts.healthCheckInterval = o.interval
+	opts.healthCheckTimeout = o.timeout
+}
+
+// WithHealthCheck pings the connection which wasn't verified for interval before it is handed out, a connection
+// which doesn't answer within timeout is closed and dialed again. Zero interval disables the health check.
+func WithHealthCheck(interval, timeout time.Duration) HealthCheckOpt {
+	return HealthCheckOpt{interval: interval, timeout: timeout}
+}
+
+// poolEntry is a connection to an address.
+type poolEntry struct {
+	// mutex serializes dials of the address
+	mutex    sync.Mutex
+	cc       mux.Client
+	verified time.Time
+	// check is closed when the running health check of cc finishes, it is nil when no check runs
+	check    chan struct{}
+	failures int
+	nextDial time.Time
+	err      error
+	// removed is set when the entry was removed from the pool
+	removed bool
+}
+
+// Pool holds connections keyed by addresses of the endpoints, e.g. of a cloud service talking to many devices.
+// The connection is dialed on first use and again when it was closed or failed the health check. Each
+// connection is shared by all requests to its address.
+type Pool struct {
+	dial DialFunc
+	cfg  poolOptions
+
+	mutex   sync.Mutex
+	entries map[string]*poolEntry
+	closed  bool
+}
+
+// NewPool creates a pool which creates connections by dial.
+func NewPool(dial DialFunc, opts ...PoolOption) *Pool {
+	cfg := defaultPoolOptions
+	for _, o := range opts {
+		o.applyPool(&cfg)
+	}
+	return &Pool{
+		dial:    dial,
+		cfg:     cfg,
+		entries: make(map[string]*poolEntry),
+	}
+}
+
+func (p *Pool) entry(addr string) (*poolEntry, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	e, ok := p.entries[addr]
+	if !ok {
+		e = &poolEntry{}
+		p.entries[addr] = e
+	}
+	return e, nil
+}
+
+// Get returns the live connection to the address, it dials the address when there is none.
+func (p *Pool) Get(ctx context.Context, addr string) (mux.Client, error) {
+	for {
+		e, err := p.entry(addr)
+		if err != nil {
+			return nil, err
+		}
+		cc, ok, err := p.get(ctx, addr, e)
+		if ok {
+			return cc, err
+		}
+		// the address was removed meanwhile
+	}
+}
+
+// get returns the connection of the entry, it returns false when the entry was removed from the pool.
+func (p *Pool) get(ctx context.Context, addr string, e *poolEntry) (mux.Client, bool, error) {
+	for {
+		e.mutex.Lock()
+		if e.removed {
+			e.mutex.Unlock()
+			return nil, false, nil
+		}
+		cc, check := p.aliveLocked(e)
+		if cc != nil {
+			e.mutex.Unlock()
+			return cc, true, nil
+		}
+		if check == nil {
+			cc, err := p.dialLocked(ctx, addr, e)
+			e.mutex.Unlock()
+			return cc, true, err
+		}
+		e.mutex.Unlock()
+		select {
+		case <-check:
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+}
+
+// dialLocked dials the address of the entry unless the backoff of the last failure didn't elapse yet.
+func (p *Pool) dialLocked(ctx context.Context, addr string, e *poolEntry) (mux.Client, error) {
+	now := time.Now()
+	if now.Before(e.nextDial) {
+		return nil, fmt.Errorf("%v: %w: %v", addr, ErrDialBackoff, e.err)
+	}
+	cc, err := p.dial(ctx, addr)
+	if err != nil {
+		e.failures++
+		e.nextDial = now.Add(p.backoff(e.failures))
+		e.err = err
+		return nil, fmt.Errorf("cannot dial %v: %w", addr, err)
+	}
+	e.cc = cc
+	e.verified = now
+	e.failures = 0
+	e.nextDial = time.Time{}
+	e.err = nil
+	return cc, nil
+}
+
+// aliveLocked returns the connection of the entry when it can be handed out. Otherwise it returns channel
+// which is closed when the health check of the connection finishes, or nil when there is no live connection.
+func (p *Pool) aliveLocked(e *poolEntry) (mux.Client, <-chan struct{}) {
+	if e.cc == nil {
+		return nil, nil
+	}
+	select {
+	case <-e.cc.Done():
+		e.cc = nil
+		return nil, nil
+	default:
+	}
+	if p.cfg.healthCheckInterval <= 0 || time.Since(e.verified) < p.cfg.healthCheckInterval {
+		return e.cc, nil
+	}
+	if e.check == nil {
+		e.check = make(chan struct{})
+		go p.healthCheck(e, e.cc, e.check)
+	}
+	return nil, e.check
+}
+
+// healthCheck pings the connection of the entry without holding its mutex, so an unresponsive peer doesn't
+// block Remove and Close. Concurrent Get calls of the address wait for the single ping, the dead connection
+// is closed.
+func (p *Pool) healthCheck(e *poolEntry, cc mux.Client, done chan struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.healthCheckTimeout)
+	defer cancel()
+	err := cc.Ping(ctx)
+	e.mutex.Lock()
+	e.check = nil
+	if e.cc != cc {
+		// the entry was removed meanwhile
+		e.mutex.Unlock()
+		return
+	}
+	if err == nil {
+		e.verified = time.Now()
+		e.mutex.Unlock()
+		return
+	}
+	e.cc = nil
+	e.mutex.Unlock()
+	cc.Close()
+}
+
+func (p *Pool) backoff(failures int) time.Duration {
+	d := p.cfg.minBackoff
+	for i := 1; i < failures && d < p.cfg.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.cfg.maxBackoff {
+		d = p.cfg.maxBackoff
+	}
+	return d
+}
+
+// Do sends the request over the connection to the address and returns the response. The connection
+// is obtained by Get with the context of the request.
+func (p *Pool) Do(addr string, req *message.Message) (*message.Message, error) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cc, err := p.Get(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return cc.Do(req)
+}
+
+// Remove closes the connection to the address and forgets state of its dials.
+func (p *Pool) Remove(addr string) error {
+	p.mutex.Lock()
+	e, ok := p.entries[addr]
+	delete(p.entries, addr)
+	p.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	return e.close()
+}
+
+func (e *poolEntry) close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.removed = true
+	if e.cc == nil {
+		return nil
+	}
+	err := e.cc.Close()
+	e.cc = nil
+	return err
+}
+
+// Len returns number of addresses known to the pool.
+func (p *Pool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.entries)
+}
+
+// Close closes all connections of the pool, Get fails afterwards.
+func (p *Pool) Close() error {
+	p.mutex.Lock()
+	entries := p.entries
+	p.entries = make(map[string]*poolEntry)
+	p.closed = true
+	p.mutex.Unlock()
+	var errs []error
+	for _, e := range entries {
+		if err := e.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot close connections: %v", errs)
+	}
+	return nil
+}
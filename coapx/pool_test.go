@@ -0,0 +1,231 @@
+package coapx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var dials int32
+	p := coapx.NewPool(func(ctx context.Context, addr string) (mux.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		cc, err := udp.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	})
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	addr := l.LocalAddr().String()
+	cc1, err := p.Get(ctx, addr)
+	require.NoError(t, err)
+	cc2, err := p.Get(ctx, addr)
+	require.NoError(t, err)
+	require.Equal(t, cc1, cc2)
+
+	opts, _, err := message.Options{}.SetPath(make([]byte, 32), "/a")
+	require.NoError(t, err)
+	resp, err := p.Do(addr, &message.Message{
+		Context: ctx,
+		Code:    codes.GET,
+		Token:   []byte{1},
+		Options: opts,
+	})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code)
+	require.Equal(t, int32(1), atomic.LoadInt32(&dials))
+
+	// the closed connection is dialed again
+	err = cc1.Close()
+	require.NoError(t, err)
+	<-cc1.Done()
+	cc3, err := p.Get(ctx, addr)
+	require.NoError(t, err)
+	require.NotEqual(t, cc1, cc3)
+	require.Equal(t, int32(2), atomic.LoadInt32(&dials))
+	require.Equal(t, 1, p.Len())
+
+	err = p.Remove(addr)
+	require.NoError(t, err)
+	require.Equal(t, 0, p.Len())
+	<-cc3.Done()
+
+	err = p.Close()
+	require.NoError(t, err)
+	_, err = p.Get(ctx, addr)
+	require.ErrorIs(t, err, coapx.ErrPoolClosed)
+}
+
+func TestPool_Backoff(t *testing.T) {
+	errDial := errors.New("unreachable")
+	var dials int32
+	p := coapx.NewPool(func(ctx context.Context, addr string) (mux.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		return nil, errDial
+	}, coapx.WithBackoff(time.Millisecond*100, time.Second))
+	defer p.Close()
+
+	ctx := context.Background()
+	_, err := p.Get(ctx, "a")
+	require.ErrorIs(t, err, errDial)
+	_, err = p.Get(ctx, "a")
+	require.ErrorIs(t, err, coapx.ErrDialBackoff)
+	require.Equal(t, int32(1), atomic.LoadInt32(&dials))
+
+	time.Sleep(time.Millisecond * 150)
+	_, err = p.Get(ctx, "a")
+	require.ErrorIs(t, err, errDial)
+	require.Equal(t, int32(2), atomic.LoadInt32(&dials))
+	// the second failure doubles the backoff
+	time.Sleep(time.Millisecond * 150)
+	_, err = p.Get(ctx, "a")
+	require.ErrorIs(t, err, coapx.ErrDialBackoff)
+}
+
+func TestPool_HealthCheck(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	s := udp.NewServer()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var dials int32
+	p := coapx.NewPool(func(ctx context.Context, addr string) (mux.Client, error) {
+		atomic.AddInt32(&dials, 1)
+		cc, err := udp.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	}, coapx.WithHealthCheck(time.Millisecond, time.Millisecond*500))
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	addr := l.LocalAddr().String()
+	cc1, err := p.Get(ctx, addr)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 10)
+	// the server answers the ping
+	cc2, err := p.Get(ctx, addr)
+	require.NoError(t, err)
+	require.Equal(t, cc1, cc2)
+
+	s.Stop()
+	wg.Wait()
+	l.Close()
+	time.Sleep(time.Millisecond * 10)
+	// the ping isn't answered, so the connection is replaced
+	cc3, err := p.Get(ctx, addr)
+	require.NoError(t, err)
+	require.NotEqual(t, cc1, cc3)
+	require.Equal(t, int32(2), atomic.LoadInt32(&dials))
+	<-cc1.Done()
+}
+
+// stuckClient doesn't answer pings until unblock is closed.
+type stuckClient struct {
+	mux.Client
+	pings   int32
+	unblock chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (c *stuckClient) Ping(ctx context.Context) error {
+	atomic.AddInt32(&c.pings, 1)
+	select {
+	case <-c.unblock:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *stuckClient) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *stuckClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func TestPool_HealthCheckOutsideLock(t *testing.T) {
+	cc := &stuckClient{unblock: make(chan struct{}), done: make(chan struct{})}
+	p := coapx.NewPool(func(ctx context.Context, addr string) (mux.Client, error) {
+		return cc, nil
+	}, coapx.WithHealthCheck(time.Millisecond, time.Second*5))
+	defer p.Close()
+
+	got, err := p.Get(context.Background(), "a")
+	require.NoError(t, err)
+	require.Equal(t, cc, got)
+	time.Sleep(time.Millisecond * 10)
+
+	// concurrent Get calls share the single ping
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := p.Get(context.Background(), "a")
+			require.NoError(t, err)
+			require.Equal(t, cc, got)
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&cc.pings) == 1 }, time.Second, time.Millisecond)
+
+	// Get with a short context gives up waiting for the ping instead of waiting for the lock of the address
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	start := time.Now()
+	_, err = p.Get(ctx, "a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+	close(cc.unblock)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&cc.pings))
+}
@@ -0,0 +1,216 @@
+package coapx
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// QueuePolicy decides what happens with notifications of an observer whose send queue is full.
+type QueuePolicy int
+
+const (
+	// DropOldest drops the oldest queued notification.
+	DropOldest QueuePolicy = iota
+	// CoalesceLatest replaces queued notifications by the new one, so the observer gets the latest state first.
+	CoalesceLatest
+	// Disconnect deregisters the observer and closes its connection.
+	Disconnect
+)
+
+func (p QueuePolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "DropOldest"
+	case CoalesceLatest:
+		return "CoalesceLatest"
+	case Disconnect:
+		return "Disconnect"
+	}
+	return fmt.Sprintf("QueuePolicy(%d)", int(p))
+}
+
+// QueueOverflow describes notifications which didn't fit to the send queue of an observer.
+type QueueOverflow struct {
+	RemoteAddr net.Addr
+	Token      message.Token
+	Policy     QueuePolicy
+	// Dropped is number of notifications which are not sent.
+	Dropped int
+}
+
+// QueueOverflowFunc is called when the send queue of an observer overflows, e.g. to notify less frequently.
+type QueueOverflowFunc = func(QueueOverflow)
+
+// ObserveQueueOpt observe queue option.
+type ObserveQueueOpt struct {
+	size   int
+	policy QueuePolicy
+}
+
+func (o ObserveQueueOpt) applyObservable(opts *observableOptions) {
+	opts.queueSize = o.size
+	opts.queuePolicy = o.policy
+}
+
+// WithObserveQueue sends notifications of every observer from its own queue of the size, so a slow observer
+// doesn't delay the others. When the queue is full, the policy is applied. Without the option
+// notifications are sent by the caller of Update one by one.
+func WithObserveQueue(size int, policy QueuePolicy) ObserveQueueOpt {
+	return ObserveQueueOpt{size: size, policy: policy}
+}
+
+// QueueOverflowOpt queue overflow option.
+type QueueOverflowOpt struct {
+	onOverflow QueueOverflowFunc
+}
+
+func (o QueueOverflowOpt) applyObservable(opts *observableOptions) {
+	opts.onQueueOverflow = o.onOverflow
+}
+
+// WithQueueOverflow sets function which is called when a send queue set by WithObserveQueue overflows.
+func WithQueueOverflow(onOverflow QueueOverflowFunc) QueueOverflowOpt {
+	return QueueOverflowOpt{onOverflow: onOverflow}
+}
+
+type queuedNotification struct {
+	sequence      uint32
+	contentFormat message.MediaType
+	payload       []byte
+}
+
+func writeNotification(cc mux.Client, token message.Token, n queuedNotification) error {
+	m := message.Message{
+		Code:    codes.Content,
+		Token:   token,
+		Context: cc.Context(),
+		Options: message.Options{
+			uint32Option(message.Observe, n.sequence),
+			uint32Option(message.ContentFormat, uint32(n.contentFormat)),
+		},
+		Body: bytes.NewReader(n.payload),
+	}
+	return cc.WriteMessage(&m)
+}
+
+// sendQueue sends notifications of an observer in its goroutine.
+type sendQueue struct {
+	cc         mux.Client
+	token      message.Token
+	size       int
+	policy     QueuePolicy
+	onOverflow QueueOverflowFunc
+	errors     ErrorFunc
+	// remove deregisters the observer for the reason.
+	remove func(reason CancelReason, err error)
+	done   <-chan struct{}
+
+	mutex   sync.Mutex
+	pending []queuedNotification
+	wake    chan struct{}
+}
+
+func newSendQueue(opts observableOptions, cc mux.Client, token message.Token, done <-chan struct{}, remove func(reason CancelReason, err error)) *sendQueue {
+	q := &sendQueue{
+		cc:         cc,
+		token:      token,
+		size:       opts.queueSize,
+		policy:     opts.queuePolicy,
+		onOverflow: opts.onQueueOverflow,
+		errors:     opts.errors,
+		remove:     remove,
+		done:       done,
+		wake:       make(chan struct{}, 1),
+	}
+	go q.run()
+	return q
+}
+
+func (q *sendQueue) push(n queuedNotification) {
+	q.mutex.Lock()
+	var dropped int
+	if len(q.pending) >= q.size {
+		switch q.policy {
+		case CoalesceLatest:
+			dropped = len(q.pending)
+			q.pending = q.pending[:0]
+		case Disconnect:
+			dropped = len(q.pending) + 1
+			q.pending = nil
+			q.mutex.Unlock()
+			q.overflow(dropped)
+			q.remove(CancelQueueOverflow, nil)
+			if err := q.cc.Close(); err != nil {
+				q.errors(fmt.Errorf("cannot close connection of observer %v: %w", q.cc.RemoteAddr(), err))
+			}
+			return
+		default:
+			dropped = 1
+			q.pending = append(q.pending[:0], q.pending[1:]...)
+		}
+	}
+	q.pending = append(q.pending, n)
+	q.mutex.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	if dropped > 0 {
+		q.overflow(dropped)
+	}
+}
+
+func (q *sendQueue) overflow(dropped int) {
+	if q.onOverflow == nil {
+		return
+	}
+	q.onOverflow(QueueOverflow{
+		RemoteAddr: q.cc.RemoteAddr(),
+		Token:      q.token,
+		Policy:     q.policy,
+		Dropped:    dropped,
+	})
+}
+
+func (q *sendQueue) pop() (queuedNotification, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.pending) == 0 {
+		return queuedNotification{}, false
+	}
+	n := q.pending[0]
+	q.pending = q.pending[1:]
+	return n, true
+}
+
+func (q *sendQueue) run() {
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		}
+		for {
+			n, ok := q.pop()
+			if !ok {
+				break
+			}
+			select {
+			case <-q.done:
+				return
+			default:
+			}
+			if err := writeNotification(q.cc, q.token, n); err != nil {
+				q.remove(notifyFailedReason(q.cc, err), err)
+				q.errors(fmt.Errorf("cannot notify observer %v: %w", q.cc.RemoteAddr(), err))
+				return
+			}
+		}
+	}
+}
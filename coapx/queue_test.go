@@ -0,0 +1,138 @@
+package coapx_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+// slowClient blocks writes of notifications until release is closed.
+type slowClient struct {
+	mux.Client
+	done    chan struct{}
+	writing chan struct{}
+	release chan struct{}
+
+	mutex         sync.Mutex
+	notifications []string
+	closed        bool
+}
+
+func (c *slowClient) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683}
+}
+
+func (c *slowClient) Context() context.Context {
+	return context.Background()
+}
+
+func (c *slowClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *slowClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *slowClient) WriteMessage(req *message.Message) error {
+	select {
+	case c.writing <- struct{}{}:
+	default:
+	}
+	<-c.release
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.notifications = append(c.notifications, string(body))
+	return nil
+}
+
+func (c *slowClient) received() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.notifications...)
+}
+
+type slowResponseWriter struct {
+	cc *slowClient
+}
+
+func (w *slowResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	return nil
+}
+
+func (w *slowResponseWriter) Client() mux.Client {
+	return w.cc
+}
+
+func TestObservable_ObserveQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   coapx.QueuePolicy
+		want     []string
+		dropped  int
+		observed int
+	}{
+		{name: "dropOldest", policy: coapx.DropOldest, want: []string{"1", "3", "4"}, dropped: 1, observed: 1},
+		{name: "coalesceLatest", policy: coapx.CoalesceLatest, want: []string{"1", "4"}, dropped: 2, observed: 1},
+		{name: "disconnect", policy: coapx.Disconnect, want: []string{"1"}, dropped: 3, observed: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overflows := make(chan coapx.QueueOverflow, 1)
+			o := coapx.NewObservable(message.TextPlain, []byte("0"), coapx.WithObserveQueue(2, tt.policy), coapx.WithQueueOverflow(func(ev coapx.QueueOverflow) {
+				overflows <- ev
+			}))
+			defer o.Close()
+			cc := &slowClient{
+				done:    make(chan struct{}),
+				writing: make(chan struct{}, 1),
+				release: make(chan struct{}),
+			}
+			defer close(cc.done)
+			o.ServeCOAP(&slowResponseWriter{cc: cc}, &mux.Message{Message: &message.Message{
+				Code:    codes.GET,
+				Token:   message.Token("a"),
+				Options: message.Options{{ID: message.Observe, Value: []byte{}}},
+			}})
+			require.Equal(t, 1, o.Observers())
+
+			o.Update(message.TextPlain, []byte("1"))
+			<-cc.writing
+			// the slow observer doesn't block the caller of Update
+			o.Update(message.TextPlain, []byte("2"))
+			o.Update(message.TextPlain, []byte("3"))
+			o.Update(message.TextPlain, []byte("4"))
+			ev := <-overflows
+			require.Equal(t, tt.policy, ev.Policy)
+			require.Equal(t, tt.dropped, ev.Dropped)
+			require.Equal(t, message.Token("a"), ev.Token)
+			require.Equal(t, tt.observed, o.Observers())
+
+			close(cc.release)
+			require.Eventually(t, func() bool {
+				return len(cc.received()) == len(tt.want)
+			}, time.Second, time.Millisecond*10)
+			time.Sleep(time.Millisecond * 50)
+			require.Equal(t, tt.want, cc.received())
+			cc.mutex.Lock()
+			require.Equal(t, tt.policy == coapx.Disconnect, cc.closed)
+			cc.mutex.Unlock()
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package coapx
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// Retained is mux.Handler of an observable route which retains the last value of the resource, like retained
+// messages of MQTT. A new observer gets the retained value by its first notification at once, without invoking
+// the handler of the route, i.e. the data source, so it doesn't wait for the next change to see the value.
+// Until a value is retained, the registration is answered by the handler and its 2.05 (Content) response
+// is retained. Other requests, e.g. GET without Observe or PUT, are served by the handler.
+//
+// Multiple goroutines may invoke methods on a Retained simultaneously.
+type Retained struct {
+	handler    mux.Handler
+	observable *Observable
+
+	// mutex keeps order of retained values.
+	mutex    sync.Mutex
+	retained bool
+}
+
+// NewRetained creates observable route of the handler without a retained value.
+func NewRetained(handler mux.Handler, opt ...ObservableOption) *Retained {
+	return &Retained{
+		handler:    handler,
+		observable: NewObservable(message.TextPlain, nil, opt...),
+	}
+}
+
+// Publish retains the value and notifies observers whose conditions are met.
+func (r *Retained) Publish(contentFormat message.MediaType, payload []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.retained = true
+	r.observable.Update(contentFormat, payload)
+}
+
+// Value returns the retained value, ok is false when no value is retained yet.
+func (r *Retained) Value() (contentFormat message.MediaType, payload []byte, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.retained {
+		return 0, nil, false
+	}
+	contentFormat, payload = r.observable.representation()
+	return contentFormat, payload, true
+}
+
+func (r *Retained) hasValue() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.retained
+}
+
+// retainIfEmpty retains the value answered by the handler unless a value was published meanwhile.
+func (r *Retained) retainIfEmpty(contentFormat message.MediaType, payload []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.retained {
+		return
+	}
+	r.retained = true
+	r.observable.Update(contentFormat, payload)
+}
+
+// ServeCOAP registers observers with the retained value and passes other requests to the handler.
+func (r *Retained) ServeCOAP(w mux.ResponseWriter, req *mux.Message) {
+	obs, err := req.Options.Observe()
+	if req.Code != codes.GET || err != nil {
+		r.handler.ServeCOAP(w, req)
+		return
+	}
+	if !r.hasValue() {
+		if obs != 0 {
+			// observers are registered only with a retained value, so there is nothing to deregister
+			r.handler.ServeCOAP(w, req)
+			return
+		}
+		rw := &recordingResponseWriter{ResponseWriter: w}
+		r.handler.ServeCOAP(rw, req)
+		if !rw.set {
+			return
+		}
+		if rw.code != codes.Content {
+			rw.replay(w)
+			return
+		}
+		r.retainIfEmpty(rw.contentFormat, rw.body)
+	}
+	r.observable.ServeCOAP(w, req)
+}
+
+// Observers returns number of registered observers.
+func (r *Retained) Observers() int {
+	return r.observable.Observers()
+}
+
+// Close deregisters all observers without notifying them.
+func (r *Retained) Close() {
+	r.observable.Close()
+}
+
+// recordingResponseWriter records the response of the handler instead of sending it.
+type recordingResponseWriter struct {
+	mux.ResponseWriter
+	set           bool
+	code          codes.Code
+	contentFormat message.MediaType
+	body          []byte
+	hasBody       bool
+	opts          message.Options
+}
+
+func (w *recordingResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.set = true
+	w.code = code
+	w.contentFormat = contentFormat
+	w.opts = append(w.opts[:0], opts...)
+	w.body = nil
+	w.hasBody = d != nil
+	if d == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(d)
+	if err != nil {
+		return err
+	}
+	w.body = body
+	return nil
+}
+
+func (w *recordingResponseWriter) replay(to mux.ResponseWriter) {
+	var d io.ReadSeeker
+	if w.hasBody {
+		d = bytes.NewReader(w.body)
+	}
+	to.SetResponse(w.code, w.contentFormat, d, w.opts...)
+}
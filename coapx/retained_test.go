@@ -0,0 +1,99 @@
+package coapx_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetained(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var reads int32
+	temp := coapx.NewRetained(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		atomic.AddInt32(&reads, 1)
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("20")))
+	}))
+	defer temp.Close()
+	_, _, ok := temp.Value()
+	require.False(t, ok)
+	m := mux.NewRouter()
+	err = m.Handle("/temp", temp)
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	observe := func(want string) (<-chan string, func()) {
+		values := make(chan string, 16)
+		obs, err := cc.Observe(ctx, "/temp", func(r *pool.Message) {
+			body, err := r.ReadBody()
+			require.NoError(t, err)
+			values <- string(body)
+		})
+		require.NoError(t, err)
+		require.Equal(t, want, <-values)
+		return values, func() {
+			err := obs.Cancel(ctx)
+			require.NoError(t, err)
+		}
+	}
+
+	// the first observer is answered by the handler, whose response is retained
+	first, cancelFirst := observe("20")
+	defer cancelFirst()
+	require.Equal(t, int32(1), atomic.LoadInt32(&reads))
+	contentFormat, payload, ok := temp.Value()
+	require.True(t, ok)
+	require.Equal(t, message.TextPlain, contentFormat)
+	require.Equal(t, "20", string(payload))
+
+	second, cancelSecond := observe("20")
+	defer cancelSecond()
+	require.Equal(t, int32(1), atomic.LoadInt32(&reads))
+	require.Equal(t, 2, temp.Observers())
+
+	temp.Publish(message.TextPlain, []byte("21"))
+	require.Equal(t, "21", <-first)
+	require.Equal(t, "21", <-second)
+
+	// a new observer gets the published value without reading the data source
+	_, cancelThird := observe("21")
+	defer cancelThird()
+	require.Equal(t, int32(1), atomic.LoadInt32(&reads))
+
+	// GET without Observe is served by the handler
+	resp, err := cc.Get(ctx, "/temp")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "20", string(body))
+	require.Equal(t, int32(2), atomic.LoadInt32(&reads))
+}
@@ -0,0 +1,233 @@
+// Package config loads declarative configuration of servers, e.g. from a JSON or YAML file managed by operators,
+// and creates ready to run servers of its listeners.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is time.Duration which is encoded as a string, e.g. "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		return d.parse(v)
+	case float64:
+		// nanoseconds as time.Duration
+		*d = Duration(v)
+		return nil
+	}
+	return fmt.Errorf("invalid duration %s", b)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.parse(value.Value)
+}
+
+func (d *Duration) parse(v string) error {
+	t, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", v, err)
+	}
+	*d = Duration(t)
+	return nil
+}
+
+// Config is configuration of servers sharing limits, transmission parameters and keepalive.
+type Config struct {
+	Listeners    []Listener   `json:"listeners" yaml:"listeners"`
+	Limits       Limits       `json:"limits" yaml:"limits"`
+	Transmission Transmission `json:"transmission" yaml:"transmission"`
+	KeepAlive    KeepAlive    `json:"keepAlive" yaml:"keepAlive"`
+	Blockwise    Blockwise    `json:"blockwise" yaml:"blockwise"`
+	// ShutdownMaxAge is Max-Age of responses which cancel observations at shutdown.
+	ShutdownMaxAge Duration `json:"shutdownMaxAge" yaml:"shutdownMaxAge"`
+	LogLevel       LogLevel `json:"logLevel" yaml:"logLevel"`
+}
+
+// Listener is an address the server listens on.
+type Listener struct {
+	// Network is "udp", "udp4", "udp6", "tcp", "tcp4" or "tcp6".
+	Network string `json:"network" yaml:"network"`
+	Address string `json:"address" yaml:"address"`
+	// Security enables DTLS over UDP and TLS over TCP.
+	Security *Security `json:"security,omitempty" yaml:"security,omitempty"`
+}
+
+// Security holds credentials of a listener, certificates or a pre-shared key of DTLS.
+type Security struct {
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+	// CAFile contains certificates which verify certificates of clients.
+	CAFile string `json:"caFile" yaml:"caFile"`
+	// ClientAuth requires certificates of clients verified by CAFile.
+	ClientAuth bool `json:"clientAuth" yaml:"clientAuth"`
+	// PSK is pre-shared key of DTLS in hex.
+	PSK             string `json:"psk" yaml:"psk"`
+	PSKIdentityHint string `json:"pskIdentityHint" yaml:"pskIdentityHint"`
+}
+
+// Limits caps resources used by peers. Zero values keep defaults of the servers.
+type Limits struct {
+	MaxMessageSize int `json:"maxMessageSize" yaml:"maxMessageSize"`
+	// BlockwiseReceiveTimeout drops a partially received body when no block arrives in time.
+	BlockwiseReceiveTimeout Duration `json:"blockwiseReceiveTimeout" yaml:"blockwiseReceiveTimeout"`
+	// BlockwiseSendTimeout drops a partially delivered body when no block is requested in time.
+	BlockwiseSendTimeout     Duration `json:"blockwiseSendTimeout" yaml:"blockwiseSendTimeout"`
+	BlockwiseMaxReceiveBytes int64    `json:"blockwiseMaxReceiveBytes" yaml:"blockwiseMaxReceiveBytes"`
+	BlockwiseMaxSendBytes    int64    `json:"blockwiseMaxSendBytes" yaml:"blockwiseMaxSendBytes"`
+	// PacingRate is average number of bytes per second sent to a peer over UDP.
+	PacingRate  int `json:"pacingRate" yaml:"pacingRate"`
+	PacingBurst int `json:"pacingBurst" yaml:"pacingBurst"`
+	// RequestRate, RequestBurst and MaxObservers are applied by Runtime, see RuntimeSettings.
+	RequestRate  float64 `json:"requestRate" yaml:"requestRate"`
+	RequestBurst int     `json:"requestBurst" yaml:"requestBurst"`
+	MaxObservers int     `json:"maxObservers" yaml:"maxObservers"`
+}
+
+// Transmission holds (re)transmission parameters of confirmable messages over UDP. Zero values keep defaults
+// of RFC 7252.
+type Transmission struct {
+	NStart             Duration `json:"nStart" yaml:"nStart"`
+	AcknowledgeTimeout Duration `json:"acknowledgeTimeout" yaml:"acknowledgeTimeout"`
+	MaxRetransmit      int      `json:"maxRetransmit" yaml:"maxRetransmit"`
+}
+
+// KeepAlive pings connections idle for Interval and closes them when the peer doesn't answer within Timeout.
+// Zero Interval disables it.
+type KeepAlive struct {
+	Interval Duration `json:"interval" yaml:"interval"`
+	Timeout  Duration `json:"timeout" yaml:"timeout"`
+}
+
+// Blockwise configures blockwise transfers.
+type Blockwise struct {
+	// Disable disables blockwise transfers, which are enabled by default.
+	Disable bool `json:"disable" yaml:"disable"`
+	// BlockSize is size of blocks, power of two from 16 to 1024. Zero keeps the default 1024.
+	BlockSize       int      `json:"blockSize" yaml:"blockSize"`
+	TransferTimeout Duration `json:"transferTimeout" yaml:"transferTimeout"`
+	// BERT enables BERT blocks over TCP.
+	BERT bool `json:"bert" yaml:"bert"`
+}
+
+// Validate checks the configuration without creating listeners.
+func (c Config) Validate() error {
+	if len(c.Listeners) == 0 {
+		return fmt.Errorf("no listener")
+	}
+	for i, l := range c.Listeners {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("listeners[%v]: %w", i, err)
+		}
+	}
+	if _, err := c.Blockwise.szx(); err != nil {
+		return fmt.Errorf("blockwise: %w", err)
+	}
+	if c.KeepAlive.Interval < 0 || c.KeepAlive.Timeout < 0 {
+		return fmt.Errorf("keepAlive: negative duration")
+	}
+	if err := c.RuntimeSettings().validate(); err != nil {
+		return err
+	}
+	if c.Transmission.MaxRetransmit < 0 {
+		return fmt.Errorf("transmission: negative maxRetransmit")
+	}
+	return nil
+}
+
+func (l Listener) validate() error {
+	if !isUDP(l.Network) && !isTCP(l.Network) {
+		return fmt.Errorf("invalid network %q", l.Network)
+	}
+	if l.Security == nil {
+		return nil
+	}
+	s := l.Security
+	if s.PSK != "" {
+		if !isUDP(l.Network) {
+			return fmt.Errorf("psk is supported only by DTLS")
+		}
+		return nil
+	}
+	if s.CertFile == "" || s.KeyFile == "" {
+		return fmt.Errorf("certFile and keyFile or psk are required")
+	}
+	if s.ClientAuth && s.CAFile == "" {
+		return fmt.Errorf("caFile is required by clientAuth")
+	}
+	return nil
+}
+
+func isUDP(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6":
+		return true
+	}
+	return false
+}
+
+func isTCP(network string) bool {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return true
+	}
+	return false
+}
+
+// Load decodes the configuration in JSON and validates it.
+func Load(r io.Reader) (Config, error) {
+	var c Config
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("cannot decode config: %w", err)
+	}
+	return c, c.Validate()
+}
+
+// LoadYAML decodes the configuration in YAML and validates it.
+func LoadYAML(r io.Reader) (Config, error) {
+	var c Config
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	if err := d.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("cannot decode config: %w", err)
+	}
+	return c, c.Validate()
+}
+
+// LoadFile loads the configuration from the file, which is in YAML for extensions .yaml and .yml, in JSON otherwise.
+func LoadFile(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return LoadYAML(f)
+	}
+	return Load(f)
+}
@@ -0,0 +1,120 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/config"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+const testJSON = `{
+	"listeners": [
+		{"network": "udp4", "address": "127.0.0.1:0"},
+		{"network": "tcp4", "address": "127.0.0.1:0"}
+	],
+	"limits": {"maxMessageSize": 4096, "blockwiseMaxReceiveBytes": 1048576},
+	"transmission": {"acknowledgeTimeout": "1s", "maxRetransmit": 2},
+	"keepAlive": {"interval": "30s", "timeout": "10s"},
+	"blockwise": {"blockSize": 512},
+	"shutdownMaxAge": "1m"
+}`
+
+const testYAML = `
+listeners:
+  - network: udp4
+    address: 127.0.0.1:0
+  - network: tcp4
+    address: 127.0.0.1:0
+limits:
+  maxMessageSize: 4096
+  blockwiseMaxReceiveBytes: 1048576
+transmission:
+  acknowledgeTimeout: 1s
+  maxRetransmit: 2
+keepAlive:
+  interval: 30s
+  timeout: 10s
+blockwise:
+  blockSize: 512
+shutdownMaxAge: 1m
+`
+
+func TestLoad(t *testing.T) {
+	c, err := config.Load(strings.NewReader(testJSON))
+	require.NoError(t, err)
+	require.Len(t, c.Listeners, 2)
+	require.Equal(t, "tcp4", c.Listeners[1].Network)
+	require.Equal(t, 4096, c.Limits.MaxMessageSize)
+	require.Equal(t, config.Duration(time.Second), c.Transmission.AcknowledgeTimeout)
+	require.Equal(t, config.Duration(time.Second*30), c.KeepAlive.Interval)
+	require.Equal(t, 512, c.Blockwise.BlockSize)
+	require.Equal(t, config.Duration(time.Minute), c.ShutdownMaxAge)
+
+	y, err := config.LoadYAML(strings.NewReader(testYAML))
+	require.NoError(t, err)
+	require.Equal(t, c, y)
+
+	for _, v := range []string{
+		`{}`,
+		`{"listeners": [{"network": "sctp", "address": ":0"}]}`,
+		`{"listeners": [{"network": "tcp", "address": ":0", "security": {"psk": "abcd"}}]}`,
+		`{"listeners": [{"network": "udp", "address": ":0"}], "blockwise": {"blockSize": 100}}`,
+		`{"listeners": [{"network": "udp", "address": ":0"}], "keepAlive": {"interval": "1s"}}`,
+		`{"listeners": [{"network": "udp", "address": ":0"}], "keepAlive": {"interval": "1 second"}}`,
+		`{"listeners": [{"network": "udp", "address": ":0"}], "unknown": 1}`,
+	} {
+		_, err := config.Load(strings.NewReader(v))
+		require.Error(t, err, v)
+	}
+}
+
+func TestConfig_NewServers(t *testing.T) {
+	c, err := config.Load(strings.NewReader(testJSON))
+	require.NoError(t, err)
+	m := mux.NewRouter()
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	servers, err := c.NewServers(m)
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, s := range servers {
+		defer s.Stop()
+		wg.Add(1)
+		go func(s *config.Server) {
+			defer wg.Done()
+			err := s.Serve()
+			require.NoError(t, err)
+		}(s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	udpConn, err := udp.Dial(servers[0].Addr().String())
+	require.NoError(t, err)
+	defer udpConn.Close()
+	resp, err := udpConn.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	tcpConn, err := tcp.Dial(servers[1].Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+	resp2, err := tcpConn.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp2.Code())
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+)
+
+// LogLevel filters errors reported by the servers.
+type LogLevel string
+
+const (
+	// LogLevelError reports errors except of the expected ones, e.g. connections closed by peers. It is default.
+	LogLevelError LogLevel = "error"
+	// LogLevelDebug reports all errors.
+	LogLevelDebug LogLevel = "debug"
+	// LogLevelOff reports no errors.
+	LogLevelOff LogLevel = "off"
+)
+
+func (l LogLevel) validate() error {
+	switch l {
+	case "", LogLevelError, LogLevelDebug, LogLevelOff:
+		return nil
+	}
+	return fmt.Errorf("invalid logLevel %q", l)
+}
+
+// RuntimeSettings are settings of running servers which can be changed by Runtime.Set.
+type RuntimeSettings struct {
+	// RequestRate is average number of requests per second accepted from a connection, zero means no limit.
+	// Over the rate the request is rejected by 4.29 (Too Many Requests) with Max-Age (RFC 8516).
+	RequestRate float64
+	// RequestBurst is number of requests accepted at once from an idle connection, by default RequestRate rounded up.
+	RequestBurst int
+	// MaxObservers caps observations registered by all peers. Over the cap the request is served without
+	// registration (RFC 7641 section 4.1). Zero means no limit.
+	MaxObservers int
+	LogLevel     LogLevel
+	KeepAlive    KeepAlive
+}
+
+func (s RuntimeSettings) validate() error {
+	if s.RequestRate < 0 || s.RequestBurst < 0 || s.MaxObservers < 0 {
+		return fmt.Errorf("negative limit")
+	}
+	if s.KeepAlive.Interval > 0 && s.KeepAlive.Timeout <= 0 {
+		return fmt.Errorf("keepAlive: timeout is not set")
+	}
+	return s.LogLevel.validate()
+}
+
+// RuntimeSettings returns settings of the configuration which can be changed while servers run.
+func (c Config) RuntimeSettings() RuntimeSettings {
+	return RuntimeSettings{
+		RequestRate:  c.Limits.RequestRate,
+		RequestBurst: c.Limits.RequestBurst,
+		MaxObservers: c.Limits.MaxObservers,
+		LogLevel:     c.LogLevel,
+		KeepAlive:    c.KeepAlive,
+	}
+}
+
+type observerKey struct {
+	conn  interface{}
+	token string
+}
+
+// Runtime applies settings which operators can change without restarting listeners, e.g. to react to an incident
+// on a long-lived gateway. It is shared by servers created by Config.NewServersWithRuntime and it is safe for
+// concurrent use.
+type Runtime struct {
+	settings  atomic.Value
+	keepAlive *inactivity.KeepAliveParams
+	// setMutex serializes Set
+	setMutex sync.Mutex
+
+	mutex     sync.Mutex
+	buckets   map[interface{}]*limits.Bucket
+	observers map[observerKey]struct{}
+	conns     map[interface{}]struct{}
+}
+
+// NewRuntime creates runtime with the settings.
+func NewRuntime(s RuntimeSettings) (*Runtime, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	r := &Runtime{
+		keepAlive: inactivity.NewKeepAliveParams(time.Duration(s.KeepAlive.Interval), time.Duration(s.KeepAlive.Timeout)),
+		buckets:   make(map[interface{}]*limits.Bucket),
+		observers: make(map[observerKey]struct{}),
+		conns:     make(map[interface{}]struct{}),
+	}
+	r.settings.Store(s)
+	return r, nil
+}
+
+// Settings returns the current settings.
+func (r *Runtime) Settings() RuntimeSettings {
+	return r.settings.Load().(RuntimeSettings)
+}
+
+// Set changes the settings, they are applied to next requests, errors and keepalive checks. Observations over
+// a lowered MaxObservers are kept until they are deregistered.
+func (r *Runtime) Set(s RuntimeSettings) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	r.setMutex.Lock()
+	defer r.setMutex.Unlock()
+	r.settings.Store(s)
+	r.keepAlive.Set(time.Duration(s.KeepAlive.Interval), time.Duration(s.KeepAlive.Timeout))
+	return nil
+}
+
+// Update changes the settings to the ones of the reloaded configuration.
+func (r *Runtime) Update(c Config) error {
+	return r.Set(c.RuntimeSettings())
+}
+
+// KeepAliveParams returns keepalive parameters of the servers, e.g. for WithKeepAliveParams of udp.
+func (r *Runtime) KeepAliveParams() *inactivity.KeepAliveParams {
+	return r.keepAlive
+}
+
+// Errors returns function which reports errors by next according to LogLevel.
+func (r *Runtime) Errors(next func(error)) func(error) {
+	return func(err error) {
+		switch r.Settings().LogLevel {
+		case LogLevelOff:
+			return
+		case LogLevelDebug:
+		default:
+			if isExpected(err) {
+				return
+			}
+		}
+		next(err)
+	}
+}
+
+// isExpected reports whether the error is caused by the peer or by closing of the server.
+func isExpected(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// Middleware returns middleware which enforces RequestRate and MaxObservers.
+func (r *Runtime) Middleware() mux.MiddlewareFunc {
+	return func(next mux.Handler) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, m *mux.Message) {
+			s := r.Settings()
+			cc := w.Client()
+			if wait, ok := r.take(cc, s); !ok {
+				w.SetResponse(codes.TooManyRequests, message.TextPlain, nil, limits.MaxAge(wait))
+				return
+			}
+			if obs, err := m.Options.Observe(); err == nil && m.Code == codes.GET {
+				switch obs {
+				case 0:
+					if !r.register(cc, m.Token, s.MaxObservers) {
+						// serve the request without registration
+						m.Options = m.Options.Remove(message.Observe)
+					}
+				case 1:
+					r.deregister(cc, m.Token)
+				}
+			}
+			next.ServeCOAP(w, m)
+		})
+	}
+}
+
+// take consumes a token of the connection, otherwise it returns time until the next token.
+func (r *Runtime) take(cc mux.Client, s RuntimeSettings) (time.Duration, bool) {
+	if s.RequestRate <= 0 {
+		return 0, true
+	}
+	now := time.Now()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	b, ok := r.buckets[cc.ClientConn()]
+	if !ok {
+		b = limits.NewBucket(now, s.RequestRate, s.RequestBurst)
+		r.buckets[cc.ClientConn()] = b
+		r.watchLocked(cc)
+	}
+	return b.Take(now, s.RequestRate, s.RequestBurst)
+}
+
+// register counts the observation, it returns false when maxObservers is reached.
+func (r *Runtime) register(cc mux.Client, token message.Token, maxObservers int) bool {
+	key := observerKey{conn: cc.ClientConn(), token: token.String()}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.observers[key]; ok {
+		return true
+	}
+	if maxObservers > 0 && len(r.observers) >= maxObservers {
+		return false
+	}
+	r.observers[key] = struct{}{}
+	r.watchLocked(cc)
+	return true
+}
+
+func (r *Runtime) deregister(cc mux.Client, token message.Token) {
+	key := observerKey{conn: cc.ClientConn(), token: token.String()}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.observers, key)
+}
+
+// watchLocked releases state of the connection when it is closed.
+func (r *Runtime) watchLocked(cc mux.Client) {
+	conn := cc.ClientConn()
+	if _, ok := r.conns[conn]; ok {
+		return
+	}
+	r.conns[conn] = struct{}{}
+	go func() {
+		<-cc.Done()
+		r.removeConn(conn)
+	}()
+}
+
+func (r *Runtime) removeConn(conn interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key := range r.observers {
+		if key.conn == conn {
+			delete(r.observers, key)
+		}
+	}
+	delete(r.buckets, conn)
+	delete(r.conns, conn)
+}
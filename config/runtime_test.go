@@ -0,0 +1,169 @@
+package config_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/config"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntime_Set(t *testing.T) {
+	c := config.Config{
+		Listeners: []config.Listener{{Network: "udp4", Address: "127.0.0.1:0"}},
+		Limits:    config.Limits{RequestRate: 0.1, RequestBurst: 1},
+	}
+	rt, err := config.NewRuntime(c.RuntimeSettings())
+	require.NoError(t, err)
+	m := mux.NewRouter()
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	servers, err := c.NewServersWithRuntime(m, rt)
+	require.NoError(t, err)
+	require.Len(t, servers, 1)
+	s := servers[0]
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve()
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	cc, err := udp.Dial(s.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	resp, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.TooManyRequests, resp.Code())
+	maxAge, err := resp.Options().GetUint32(message.MaxAge)
+	require.NoError(t, err)
+	require.Equal(t, uint32(10), maxAge)
+
+	settings := rt.Settings()
+	settings.RequestRate = 0
+	settings.KeepAlive = config.KeepAlive{Interval: config.Duration(time.Second), Timeout: config.Duration(time.Second * 2)}
+	err = rt.Set(settings)
+	require.NoError(t, err)
+	resp, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	interval, timeout := rt.KeepAliveParams().Get()
+	require.Equal(t, time.Second, interval)
+	require.Equal(t, time.Second*2, timeout)
+
+	settings.RequestRate = -1
+	require.Error(t, rt.Set(settings))
+}
+
+func TestRuntime_MaxObservers(t *testing.T) {
+	c := config.Config{
+		Listeners: []config.Listener{{Network: "udp4", Address: "127.0.0.1:0"}},
+		Limits:    config.Limits{MaxObservers: 1},
+	}
+	rt, err := config.NewRuntime(c.RuntimeSettings())
+	require.NoError(t, err)
+	m := mux.NewRouter()
+	m.Handle("/obs", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		opts := message.Options{}
+		if _, err := r.Options.Observe(); err == nil {
+			buf := make([]byte, 4)
+			opts, _, _ = opts.SetObserve(buf, 2)
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")), opts...)
+		require.NoError(t, err)
+	}))
+	servers, err := c.NewServersWithRuntime(m, rt)
+	require.NoError(t, err)
+	s := servers[0]
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve()
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(s.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	// observe returns whether the first notification has Observe, i.e. the observation was registered
+	observe := func() (*client.Observation, bool) {
+		done := make(chan bool, 1)
+		obs, err := cc.Observe(context.Background(), "/obs", func(req *pool.Message) {
+			_, err := req.Options().Observe()
+			select {
+			case done <- err == nil:
+			default:
+			}
+		})
+		require.NoError(t, err)
+		select {
+		case registered := <-done:
+			return obs, registered
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "notification timeout")
+		}
+		return nil, false
+	}
+	obs, registered := observe()
+	require.True(t, registered)
+	defer obs.Cancel(context.Background())
+	obs2, registered := observe()
+	require.False(t, registered)
+	obs2.Cancel(context.Background())
+
+	settings := rt.Settings()
+	settings.MaxObservers = 2
+	require.NoError(t, rt.Set(settings))
+	obs3, registered := observe()
+	require.True(t, registered)
+	obs3.Cancel(context.Background())
+}
+
+func TestRuntime_Errors(t *testing.T) {
+	rt, err := config.NewRuntime(config.RuntimeSettings{})
+	require.NoError(t, err)
+	var reported []error
+	errs := rt.Errors(func(err error) {
+		reported = append(reported, err)
+	})
+	failure := errors.New("failure")
+	errs(io.EOF)
+	errs(failure)
+	require.Equal(t, []error{failure}, reported)
+
+	require.NoError(t, rt.Set(config.RuntimeSettings{LogLevel: config.LogLevelDebug}))
+	errs(io.EOF)
+	require.Equal(t, []error{failure, io.EOF}, reported)
+
+	require.NoError(t, rt.Set(config.RuntimeSettings{LogLevel: config.LogLevelOff}))
+	errs(failure)
+	require.Len(t, reported, 2)
+
+	require.Error(t, rt.Set(config.RuntimeSettings{LogLevel: "verbose"}))
+}
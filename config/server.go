@@ -0,0 +1,354 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	piondtls "github.com/pion/dtls/v3"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/udp"
+)
+
+// Server is a server of a listener of the configuration.
+type Server struct {
+	Listener Listener
+
+	addr     net.Addr
+	serve    func() error
+	stop     func()
+	shutdown func(ctx context.Context) error
+	close    func() error
+}
+
+// Addr returns address the server listens on, e.g. with the port chosen for port 0 of the configuration.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Serve serves the listener until the server is stopped, the listener is closed afterwards.
+func (s *Server) Serve() error {
+	defer s.close()
+	return s.serve()
+}
+
+// Stop stops the server without wait of ends Serve function.
+func (s *Server) Stop() {
+	s.stop()
+}
+
+// Shutdown stops the server gracefully, see udp.Server.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.shutdown(ctx)
+}
+
+// NewServers creates listeners of the configuration and their servers which serve requests by handler.
+// When a listener cannot be created, the already created ones are closed.
+func (c Config) NewServers(handler mux.Handler) ([]*Server, error) {
+	rt, err := NewRuntime(c.RuntimeSettings())
+	if err != nil {
+		return nil, err
+	}
+	return c.NewServersWithRuntime(handler, rt)
+}
+
+// NewServersWithRuntime is NewServers with the runtime, which changes its settings in all servers. The settings
+// of the configuration aren't applied, the runtime is created from them, e.g. by NewRuntime(c.RuntimeSettings()).
+func (c Config) NewServersWithRuntime(handler mux.Handler, rt *Runtime) ([]*Server, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	handler = rt.Middleware()(handler)
+	servers := make([]*Server, 0, len(c.Listeners))
+	for i, l := range c.Listeners {
+		s, err := c.newServer(l, handler, rt)
+		if err != nil {
+			for _, s := range servers {
+				s.close()
+			}
+			return nil, fmt.Errorf("listeners[%v]: %w", i, err)
+		}
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+func (c Config) newServer(l Listener, handler mux.Handler, rt *Runtime) (*Server, error) {
+	switch {
+	case isUDP(l.Network) && l.Security != nil:
+		return c.newDTLSServer(l, handler, rt)
+	case isUDP(l.Network):
+		return c.newUDPServer(l, handler, rt)
+	default:
+		return c.newTCPServer(l, handler, rt)
+	}
+}
+
+func printError(err error) {
+	fmt.Println(err)
+}
+
+func (c Config) newUDPServer(l Listener, handler mux.Handler, rt *Runtime) (*Server, error) {
+	ln, err := coapNet.NewListenUDP(l.Network, l.Address)
+	if err != nil {
+		return nil, err
+	}
+	szx, _ := c.Blockwise.szx()
+	opts := []udp.ServerOption{
+		udp.WithMux(handler),
+		udp.WithErrors(rt.Errors(printError)),
+		udp.WithKeepAliveParams(rt.KeepAliveParams(), inactivity.CloseClientConn),
+	}
+	if c.Limits.MaxMessageSize > 0 {
+		opts = append(opts, udp.WithMaxMessageSize(c.Limits.MaxMessageSize))
+	}
+	if c.Blockwise.isSet() {
+		opts = append(opts, udp.WithBlockwise(!c.Blockwise.Disable, szx, c.Blockwise.transferTimeout(time.Second*3)))
+	}
+	if limits, ok := c.Limits.blockwise(); ok {
+		opts = append(opts, udp.WithBlockwiseLimits(limits))
+	}
+	if c.Limits.PacingRate > 0 {
+		opts = append(opts, udp.WithPacing(c.Limits.PacingRate, c.Limits.PacingBurst))
+	}
+	if c.Transmission.isSet() {
+		nStart, ackTimeout, maxRetransmit := c.Transmission.values()
+		opts = append(opts, udp.WithTransmission(nStart, ackTimeout, maxRetransmit))
+	}
+	if c.ShutdownMaxAge > 0 {
+		opts = append(opts, udp.WithShutdownMaxAge(time.Duration(c.ShutdownMaxAge)))
+	}
+	s := udp.NewServer(opts...)
+	return &Server{
+		Listener: l,
+		addr:     ln.LocalAddr(),
+		serve:    func() error { return s.Serve(ln) },
+		stop:     s.Stop,
+		shutdown: s.Shutdown,
+		close:    ln.Close,
+	}, nil
+}
+
+func (c Config) newDTLSServer(l Listener, handler mux.Handler, rt *Runtime) (*Server, error) {
+	dtlsCfg, err := l.Security.dtlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	ln, err := coapNet.NewDTLSListener(l.Network, l.Address, dtlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	szx, _ := c.Blockwise.szx()
+	opts := []dtls.ServerOption{
+		dtls.WithMux(handler),
+		dtls.WithErrors(rt.Errors(printError)),
+		dtls.WithKeepAliveParams(rt.KeepAliveParams(), inactivity.CloseClientConn),
+	}
+	if c.Limits.MaxMessageSize > 0 {
+		opts = append(opts, dtls.WithMaxMessageSize(c.Limits.MaxMessageSize))
+	}
+	if c.Blockwise.isSet() {
+		opts = append(opts, dtls.WithBlockwise(!c.Blockwise.Disable, szx, c.Blockwise.transferTimeout(time.Second*5)))
+	}
+	if limits, ok := c.Limits.blockwise(); ok {
+		opts = append(opts, dtls.WithBlockwiseLimits(limits))
+	}
+	if c.Limits.PacingRate > 0 {
+		opts = append(opts, dtls.WithPacing(c.Limits.PacingRate, c.Limits.PacingBurst))
+	}
+	if c.Transmission.isSet() {
+		nStart, ackTimeout, maxRetransmit := c.Transmission.values()
+		opts = append(opts, dtls.WithTransmission(nStart, ackTimeout, maxRetransmit))
+	}
+	if c.ShutdownMaxAge > 0 {
+		opts = append(opts, dtls.WithShutdownMaxAge(time.Duration(c.ShutdownMaxAge)))
+	}
+	s := dtls.NewServer(opts...)
+	return &Server{
+		Listener: l,
+		addr:     ln.Addr(),
+		serve:    func() error { return s.Serve(ln) },
+		stop:     s.Stop,
+		shutdown: s.Shutdown,
+		close:    ln.Close,
+	}, nil
+}
+
+func (c Config) newTCPServer(l Listener, handler mux.Handler, rt *Runtime) (*Server, error) {
+	var ln tcp.Listener
+	var addr net.Addr
+	if l.Security != nil {
+		tlsCfg, err := l.Security.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		tl, err := coapNet.NewTLSListener(l.Network, l.Address, tlsCfg)
+		if err != nil {
+			return nil, err
+		}
+		ln, addr = tl, tl.Addr()
+	} else {
+		tl, err := coapNet.NewTCPListener(l.Network, l.Address)
+		if err != nil {
+			return nil, err
+		}
+		ln, addr = tl, tl.Addr()
+	}
+	szx, _ := c.Blockwise.szx()
+	opts := []tcp.ServerOption{
+		tcp.WithMux(handler),
+		tcp.WithErrors(rt.Errors(printError)),
+		tcp.WithKeepAliveParams(rt.KeepAliveParams(), inactivity.CloseClientConn),
+	}
+	if c.Limits.MaxMessageSize > 0 {
+		opts = append(opts, tcp.WithMaxMessageSize(c.Limits.MaxMessageSize))
+	}
+	if c.Blockwise.isSet() {
+		opts = append(opts, tcp.WithBlockwise(!c.Blockwise.Disable, szx, c.Blockwise.transferTimeout(time.Second*3)))
+	}
+	if c.Blockwise.BERT {
+		opts = append(opts, tcp.WithBERT())
+	}
+	if limits, ok := c.Limits.blockwise(); ok {
+		opts = append(opts, tcp.WithBlockwiseLimits(limits))
+	}
+	if c.ShutdownMaxAge > 0 {
+		opts = append(opts, tcp.WithShutdownMaxAge(time.Duration(c.ShutdownMaxAge)))
+	}
+	s := tcp.NewServer(opts...)
+	return &Server{
+		Listener: l,
+		addr:     addr,
+		serve:    func() error { return s.Serve(ln) },
+		stop:     s.Stop,
+		shutdown: s.Shutdown,
+		close:    ln.Close,
+	}, nil
+}
+
+func (b Blockwise) isSet() bool {
+	return b.Disable || b.BlockSize != 0 || b.TransferTimeout != 0
+}
+
+func (b Blockwise) szx() (blockwise.SZX, error) {
+	if b.BlockSize == 0 {
+		return blockwise.SZX1024, nil
+	}
+	for szx := blockwise.SZX16; szx <= blockwise.SZX1024; szx++ {
+		if szx.Size() == int64(b.BlockSize) {
+			return szx, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid blockSize %v", b.BlockSize)
+}
+
+func (b Blockwise) transferTimeout(def time.Duration) time.Duration {
+	if b.TransferTimeout > 0 {
+		return time.Duration(b.TransferTimeout)
+	}
+	return def
+}
+
+func (l Limits) blockwise() (blockwise.Limits, bool) {
+	limits := blockwise.Limits{
+		ReceiveTimeout:  time.Duration(l.BlockwiseReceiveTimeout),
+		SendTimeout:     time.Duration(l.BlockwiseSendTimeout),
+		MaxReceiveBytes: l.BlockwiseMaxReceiveBytes,
+		MaxSendBytes:    l.BlockwiseMaxSendBytes,
+	}
+	return limits, l.BlockwiseReceiveTimeout > 0 || l.BlockwiseSendTimeout > 0 || l.BlockwiseMaxReceiveBytes > 0 || l.BlockwiseMaxSendBytes > 0
+}
+
+func (t Transmission) isSet() bool {
+	return t != Transmission{}
+}
+
+// values returns the parameters, the unset ones are defaults of RFC 7252.
+func (t Transmission) values() (time.Duration, time.Duration, int) {
+	nStart := time.Second
+	if t.NStart > 0 {
+		nStart = time.Duration(t.NStart)
+	}
+	ackTimeout := time.Second * 2
+	if t.AcknowledgeTimeout > 0 {
+		ackTimeout = time.Duration(t.AcknowledgeTimeout)
+	}
+	maxRetransmit := 4
+	if t.MaxRetransmit > 0 {
+		maxRetransmit = t.MaxRetransmit
+	}
+	return nStart, ackTimeout, maxRetransmit
+}
+
+func (s Security) certificates() ([]tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load certificate: %w", err)
+	}
+	if s.CAFile == "" {
+		return []tls.Certificate{cert}, nil, nil
+	}
+	pem, err := ioutil.ReadFile(s.CAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read caFile: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, nil, fmt.Errorf("no certificate in caFile")
+	}
+	return []tls.Certificate{cert}, pool, nil
+}
+
+func (s Security) tlsConfig() (*tls.Config, error) {
+	certs, pool, err := s.certificates()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: certs,
+		ClientCAs:    pool,
+	}
+	if s.ClientAuth {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func (s Security) dtlsConfig() (*piondtls.Config, error) {
+	if s.PSK != "" {
+		psk, err := hex.DecodeString(s.PSK)
+		if err != nil {
+			return nil, fmt.Errorf("invalid psk: %w", err)
+		}
+		return &piondtls.Config{
+			PSK: func(hint []byte) ([]byte, error) {
+				return psk, nil
+			},
+			PSKIdentityHint: []byte(s.PSKIdentityHint),
+			CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+		}, nil
+	}
+	certs, pool, err := s.certificates()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &piondtls.Config{
+		Certificates:         certs,
+		ExtendedMasterSecret: piondtls.RequireExtendedMasterSecret,
+		ClientCAs:            pool,
+	}
+	if s.ClientAuth {
+		cfg.ClientAuth = piondtls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
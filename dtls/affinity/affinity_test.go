@@ -0,0 +1,276 @@
+package affinity
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	piondtls "github.com/pion/dtls/v3"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(0)
+	_, ok := r.Get([]byte("a"))
+	require.False(t, ok)
+
+	r.Add("s1", "s2", "s3")
+	require.Equal(t, []string{"s1", "s2", "s3"}, r.Members())
+
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := strconv.Itoa(i)
+		member, ok := r.Get([]byte(key))
+		require.True(t, ok)
+		owners[key] = member
+		counts[member]++
+	}
+	for _, member := range r.Members() {
+		require.Greater(t, counts[member], 500, member)
+	}
+
+	// only keys of the removed instance are moved
+	r.Remove("s2")
+	require.Equal(t, []string{"s1", "s3"}, r.Members())
+	for key, owner := range owners {
+		member, ok := r.Get([]byte(key))
+		require.True(t, ok)
+		if owner != "s2" {
+			require.Equal(t, owner, member)
+		} else {
+			require.NotEqual(t, "s2", member)
+		}
+	}
+}
+
+func TestRing_Collision(t *testing.T) {
+	r := NewRing(2)
+	// all points collide
+	r.hash = func(key []byte) uint32 { return 1 }
+	r.Add("s2", "s1")
+	member, ok := r.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, "s1", member)
+
+	// points of the remaining instance are kept
+	r.Remove("s1")
+	member, ok = r.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, "s2", member)
+
+	r.Add("s1")
+	r.Remove("s2")
+	member, ok = r.Get([]byte("a"))
+	require.True(t, ok)
+	require.Equal(t, "s1", member)
+}
+
+func cidRecord(cid []byte) []byte {
+	datagram := []byte{contentTypeCID, 0xfe, 0xfd, 0, 1, 0, 0, 0, 0, 0, 1}
+	datagram = append(datagram, cid...)
+	return append(datagram, 0, 0)
+}
+
+func TestDispatcher_Drain(t *testing.T) {
+	r := NewRing(0)
+	r.Add("s1", "s2")
+	d := NewDispatcher(r, WithIdleTimeout(time.Millisecond*200))
+
+	addrs := make([]net.Addr, 0, 100)
+	members := make(map[string]string)
+	for i := 0; i < cap(addrs); i++ {
+		addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5684}
+		addrs = append(addrs, addr)
+		member, err := d.Dispatch([]byte{22}, addr)
+		require.NoError(t, err)
+		members[addr.String()] = member
+	}
+	require.Greater(t, d.Flows("s1"), 0)
+
+	d.Drain("s1")
+	require.False(t, d.Drained("s1"))
+	for _, addr := range addrs {
+		member, err := d.Dispatch([]byte{23}, addr)
+		require.NoError(t, err)
+		require.Equal(t, members[addr.String()], member)
+	}
+	member, err := d.Dispatch([]byte{22}, &net.UDPAddr{IP: net.IPv4(10, 0, 1, 1), Port: 5684})
+	require.NoError(t, err)
+	require.Equal(t, "s2", member)
+
+	require.Eventually(t, func() bool { return d.Drained("s1") }, time.Second, time.Millisecond*50)
+	d.Remove("s1")
+
+	d.Remove("s2")
+	_, err = d.Dispatch([]byte{22}, addrs[0])
+	require.ErrorIs(t, err, ErrNoInstance)
+}
+
+func TestDispatcher_ConnectionID(t *testing.T) {
+	r := NewRing(0)
+	r.Add("s1", "s2")
+	d := NewDispatcher(r, WithConnectionID(4, func(cid []byte) (string, bool) {
+		return "s" + string(cid[:1]), true
+	}))
+
+	addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5684}
+	member, err := d.Dispatch(cidRecord([]byte("2abc")), addr)
+	require.NoError(t, err)
+	require.Equal(t, "s2", member)
+
+	// NAT rebinding
+	addr.Port++
+	member, err = d.Dispatch(cidRecord([]byte("2abc")), addr)
+	require.NoError(t, err)
+	require.Equal(t, "s2", member)
+	require.Equal(t, "cid_2abc", d.FlowKey(cidRecord([]byte("2abc")), addr))
+	require.Equal(t, "addr_"+addr.String(), d.FlowKey([]byte{22}, addr))
+
+	d.Bind("cid_xxxx", "s1")
+	member, err = d.Dispatch(cidRecord([]byte("xxxx")), addr)
+	require.NoError(t, err)
+	require.Equal(t, "s1", member)
+}
+
+// nat forwards datagrams between the client and the server, the balancer in front of the server dispatches each
+// datagram of the client received from the public address of the nat. rebind changes the public address.
+type nat struct {
+	t          *testing.T
+	front      *net.UDPConn
+	server     *net.UDPAddr
+	mutex      sync.Mutex
+	back       *net.UDPConn
+	client     *net.UDPAddr
+	dispatcher *Dispatcher
+	members    []string
+}
+
+func newNAT(t *testing.T, server string, d *Dispatcher) *nat {
+	serverAddr, err := net.ResolveUDPAddr("udp", server)
+	require.NoError(t, err)
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	n := &nat{t: t, front: front, server: serverAddr}
+	n.rebind(d)
+	go func() {
+		b := make([]byte, 2048)
+		for {
+			l, addr, err := front.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			n.mutex.Lock()
+			n.client = addr
+			member, err := n.dispatcher.Dispatch(b[:l], n.back.LocalAddr())
+			if err == nil {
+				n.members = append(n.members, member)
+			}
+			back := n.back
+			n.mutex.Unlock()
+			_, _ = back.WriteToUDP(b[:l], n.server)
+		}
+	}()
+	return n
+}
+
+// rebind changes the public address and the datagrams from it are dispatched by d.
+func (n *nat) rebind(d *Dispatcher) {
+	back, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(n.t, err)
+	n.mutex.Lock()
+	old := n.back
+	n.back = back
+	n.dispatcher = d
+	n.members = nil
+	n.mutex.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	go func() {
+		b := make([]byte, 2048)
+		for {
+			l, err := back.Read(b)
+			if err != nil {
+				return
+			}
+			n.mutex.Lock()
+			client := n.client
+			n.mutex.Unlock()
+			_, _ = n.front.WriteToUDP(b[:l], client)
+		}
+	}()
+}
+
+func (n *nat) Members() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return append([]string(nil), n.members...)
+}
+
+func (n *nat) Close() {
+	_ = n.front.Close()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	_ = n.back.Close()
+}
+
+func TestDispatcher_ServerConnectionID(t *testing.T) {
+	dtlsCfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	// the server is the instance s1
+	l, err := coapNet.NewDTLSListener("udp4", "127.0.0.1:", dtlsCfg, coapNet.WithConnectionID(NewCIDGenerator([]byte{1}, 8)))
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := dtls.NewServer()
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	owner := PrefixCIDOwner(map[string]string{"\x01": "s1", "\x02": "s2"})
+	r := NewRing(0)
+	r.Add("s1")
+	n := newNAT(t, l.Addr().String(), NewDispatcher(r, WithConnectionID(8, owner)))
+	defer n.Close()
+
+	cc, err := dtls.Dial(n.front.LocalAddr().String(), dtlsCfg, dtls.WithConnectionID(piondtls.OnlySendCIDGenerator()))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+
+	// the client got a new address at a restarted balancer, where new flows go to s2
+	r = NewRing(0)
+	r.Add("s2")
+	n.rebind(NewDispatcher(r, WithConnectionID(8, owner)))
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+	members := n.Members()
+	require.NotEmpty(t, members)
+	for _, member := range members {
+		require.Equal(t, "s1", member)
+	}
+}
@@ -0,0 +1,204 @@
+package affinity
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// ErrNoInstance is returned by Dispatch when the ring is empty.
+var ErrNoInstance = errors.New("no instance")
+
+const (
+	recordHeaderSize = 13
+	// tls12_cid content type of the record with connection ID (RFC 9146 section 4).
+	contentTypeCID = 25
+	// offset of the connection ID, it follows type, version, epoch and sequence number.
+	cidOffset = 11
+)
+
+// CIDOwnerFunc returns the instance which issued the connection ID, e.g. by a prefix of the connection ID.
+type CIDOwnerFunc = func(cid []byte) (string, bool)
+
+// NewCIDGenerator creates a generator of connection IDs of size bytes which start with the prefix of the instance
+// and continue by random bytes. Set it to the DTLS listener of the instance by net.WithConnectionID.
+func NewCIDGenerator(prefix []byte, size int) func() []byte {
+	if size < len(prefix) {
+		size = len(prefix)
+	}
+	prefix = append([]byte(nil), prefix...)
+	return func() []byte {
+		cid := make([]byte, size)
+		copy(cid, prefix)
+		if _, err := rand.Read(cid[len(prefix):]); err != nil {
+			panic(err)
+		}
+		return cid
+	}
+}
+
+// PrefixCIDOwner resolves the instance by the prefix of the connection ID generated by NewCIDGenerator. The prefixes
+// maps the prefix to the instance.
+func PrefixCIDOwner(prefixes map[string]string) CIDOwnerFunc {
+	return func(cid []byte) (string, bool) {
+		for prefix, member := range prefixes {
+			if bytes.HasPrefix(cid, []byte(prefix)) {
+				return member, true
+			}
+		}
+		return "", false
+	}
+}
+
+var defaultDispatcherOptions = dispatcherOptions{
+	idleTimeout: time.Minute * 5,
+}
+
+type dispatcherOptions struct {
+	idleTimeout time.Duration
+	cidLength   int
+	cidOwner    CIDOwnerFunc
+}
+
+// A DispatcherOption sets options such as idle timeout or connection ID.
+type DispatcherOption interface {
+	applyDispatcher(*dispatcherOptions)
+}
+
+// IdleTimeoutOpt idle timeout option.
+type IdleTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o IdleTimeoutOpt) applyDispatcher(opts *dispatcherOptions) {
+	opts.idleTimeout = o.timeout
+}
+
+// WithIdleTimeout sets the time after which the flow without datagrams is forgotten. It should not be shorter than
+// the inactivity timeout of the servers.
+func WithIdleTimeout(timeout time.Duration) IdleTimeoutOpt {
+	return IdleTimeoutOpt{timeout: timeout}
+}
+
+// ConnectionIDOpt connection ID option.
+type ConnectionIDOpt struct {
+	length int
+	owner  CIDOwnerFunc
+}
+
+func (o ConnectionIDOpt) applyDispatcher(opts *dispatcherOptions) {
+	opts.cidLength = o.length
+	opts.cidOwner = o.owner
+}
+
+// WithConnectionID identifies flows by the connection ID of length bytes, which the servers issue, instead of the
+// address of the client, so the flow survives NAT rebinding. The owner resolves the instance of a connection ID
+// seen for the first time, e.g. after the balancer restarted; it may be nil.
+func WithConnectionID(length int, owner CIDOwnerFunc) ConnectionIDOpt {
+	return ConnectionIDOpt{length: length, owner: owner}
+}
+
+// Dispatcher selects the instance for datagrams received by a UDP load balancer. Dispatcher is safe for concurrent
+// access from multiple goroutines.
+type Dispatcher struct {
+	ring      *Ring
+	flows     *cache.Cache
+	cidLength int
+	cidOwner  CIDOwnerFunc
+}
+
+// NewDispatcher creates a dispatcher of flows to instances of the ring.
+func NewDispatcher(ring *Ring, opts ...DispatcherOption) *Dispatcher {
+	cfg := defaultDispatcherOptions
+	for _, o := range opts {
+		o.applyDispatcher(&cfg)
+	}
+	return &Dispatcher{
+		ring:      ring,
+		flows:     cache.New(cfg.idleTimeout, cfg.idleTimeout/2),
+		cidLength: cfg.cidLength,
+		cidOwner:  cfg.cidOwner,
+	}
+}
+
+// connectionID returns connection ID of the first record of the datagram.
+func (d *Dispatcher) connectionID(datagram []byte) ([]byte, bool) {
+	if d.cidLength <= 0 || len(datagram) < recordHeaderSize+d.cidLength || datagram[0] != contentTypeCID {
+		return nil, false
+	}
+	return datagram[cidOffset : cidOffset+d.cidLength], true
+}
+
+// FlowKey returns the key of the flow of the datagram received from addr.
+func (d *Dispatcher) FlowKey(datagram []byte, addr net.Addr) string {
+	if cid, ok := d.connectionID(datagram); ok {
+		return "cid_" + string(cid)
+	}
+	return "addr_" + addr.String()
+}
+
+// Dispatch returns the instance for the datagram received from addr. A datagram of a known flow goes to the instance
+// of the flow, a new flow goes to the owner at the ring.
+func (d *Dispatcher) Dispatch(datagram []byte, addr net.Addr) (string, error) {
+	key := d.FlowKey(datagram, addr)
+	if v, ok := d.flows.Get(key); ok {
+		member := v.(string)
+		// prolong the flow
+		d.flows.SetDefault(key, member)
+		return member, nil
+	}
+	if cid, ok := d.connectionID(datagram); ok && d.cidOwner != nil {
+		if member, ok := d.cidOwner(cid); ok {
+			d.flows.SetDefault(key, member)
+			return member, nil
+		}
+	}
+	member, ok := d.ring.Get([]byte(key))
+	if !ok {
+		return "", ErrNoInstance
+	}
+	d.flows.SetDefault(key, member)
+	return member, nil
+}
+
+// Bind assigns the flow to the instance, e.g. when the server reported the connection ID issued by the handshake
+// of the flow of the client address.
+func (d *Dispatcher) Bind(key string, member string) {
+	d.flows.SetDefault(key, member)
+}
+
+// Drain removes the instance from the ring, so new flows go to other instances. Established flows stay at the
+// instance until they are idle.
+func (d *Dispatcher) Drain(member string) {
+	d.ring.Remove(member)
+}
+
+// Flows returns number of flows of the instance.
+func (d *Dispatcher) Flows(member string) int {
+	var n int
+	for _, item := range d.flows.Items() {
+		if item.Object.(string) == member {
+			n++
+		}
+	}
+	return n
+}
+
+// Drained reports whether the instance has no flow, so it can be stopped without breaking sessions.
+func (d *Dispatcher) Drained(member string) bool {
+	return d.Flows(member) == 0
+}
+
+// Remove removes the instance and forgets its flows, so they go to other instances.
+func (d *Dispatcher) Remove(member string) {
+	d.ring.Remove(member)
+	for key, item := range d.flows.Items() {
+		if item.Object.(string) == member {
+			d.flows.Delete(key)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package affinity keeps DTLS sessions on one of multiple server instances fronted by a UDP load balancer.
+//
+// A DTLS session lives in the memory of the instance which did the handshake, so every record of a session must be
+// forwarded to that instance. The Dispatcher of the balancer maps a flow, identified by the connection ID (RFC 9146)
+// of the record or by the address of the client, to an instance by consistent hashing. Adding or removing an instance
+// moves only the flows of the ring segment owned by it. An instance whose listener issues connection IDs by
+// net.WithConnectionID(NewCIDGenerator(prefix, size)) is resolved by PrefixCIDOwner, so a client whose address
+// changed stays at it. Flows of instances without connection IDs are identified by address and a client whose
+// address changed handshakes again.
+//
+// Draining an instance is a handoff in three steps:
+//  1. Drain the instance at the Dispatcher: established flows stay at it, new flows go to the other instances.
+//  2. Wait until Drained reports true, i.e. idle timeout of all its flows expired, or until a deadline.
+//  3. Remove the instance and stop the server. Clients of flows which stayed open handshake with another instance;
+//     it is an abbreviated handshake when the instances share the dtls.Config.SessionStore.
+package affinity
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is number of points of an instance at the Ring.
+const DefaultReplicas = 64
+
+type point struct {
+	hash   uint32
+	member string
+}
+
+// Ring is a consistent hash ring of instances. Ring is safe for concurrent access from multiple goroutines.
+type Ring struct {
+	replicas int
+	hash     func(key []byte) uint32
+	m        sync.RWMutex
+	// points are sorted by hash and member, so colliding points of instances are kept and ordered deterministically.
+	points  []point
+	members map[string]struct{}
+}
+
+// NewRing creates a ring, where each instance owns replicas points. For replicas <= 0 it uses DefaultReplicas.
+func NewRing(replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{
+		replicas: replicas,
+		hash:     crc32.ChecksumIEEE,
+		members:  make(map[string]struct{}),
+	}
+}
+
+// Add adds instances, e.g. addresses of the servers.
+func (r *Ring) Add(members ...string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, member := range members {
+		if _, ok := r.members[member]; ok {
+			continue
+		}
+		r.members[member] = struct{}{}
+		for i := 0; i < r.replicas; i++ {
+			r.points = append(r.points, point{
+				hash:   r.hash([]byte(strconv.Itoa(i) + "_" + member)),
+				member: member,
+			})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash != r.points[j].hash {
+			return r.points[i].hash < r.points[j].hash
+		}
+		return r.points[i].member < r.points[j].member
+	})
+}
+
+// Remove removes instances.
+func (r *Ring) Remove(members ...string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, member := range members {
+		delete(r.members, member)
+	}
+	points := r.points[:0]
+	for _, p := range r.points {
+		if _, ok := r.members[p.member]; ok {
+			points = append(points, p)
+		}
+	}
+	r.points = points
+}
+
+// Members returns instances of the ring.
+func (r *Ring) Members() []string {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	members := make([]string, 0, len(r.members))
+	for member := range r.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Get returns the instance which owns the key. It returns false for an empty ring.
+func (r *Ring) Get(key []byte) (string, bool) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if len(r.points) == 0 {
+		return "", false
+	}
+	h := r.hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.points[i].member, true
+}
@@ -7,10 +7,15 @@ import (
 	"net"
 	"time"
 
-	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v3"
+	dtlsnet "github.com/pion/dtls/v3/pkg/net"
+	"github.com/plgd-dev/go-coap/v2/cache"
 	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/metrics"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
@@ -20,6 +25,9 @@ import (
 	kitSync "github.com/plgd-dev/kit/sync"
 )
 
+// handshakeTimeout is maximal duration of the handshake of Dial.
+const handshakeTimeout = 30 * time.Second
+
 var defaultDialOptions = dialOptions{
 	ctx:            context.Background(),
 	maxMessageSize: 64 * 1024,
@@ -48,6 +56,8 @@ var defaultDialOptions = dialOptions{
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	newMIDGenerator:                client.NewSequentialMIDGenerator,
+	controlLaneSize:                client.DefaultControlLaneSize,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
 	},
@@ -59,18 +69,54 @@ type dialOptions struct {
 	heartBeat                      time.Duration
 	handler                        HandlerFunc
 	errors                         ErrorFunc
+	logger                         coapNet.Logger
 	goPool                         GoPoolFunc
 	dialer                         *net.Dialer
 	net                            string
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseLimits                blockwise.Limits
+	blockwiseProgress              blockwise.ProgressFunc
+	blockwiseOptions               []blockwise.Option
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
 	getMID                         GetMIDFunc
+	newMIDGenerator                client.NewMIDGeneratorFunc
 	closeSocket                    bool
 	createInactivityMonitor        func() inactivity.Monitor
+	rawHandler                     RawHandlerFunc
+	reliableTransport              bool
+	observationStore               observation.Store
+	onExchange                     ExchangeFunc
+	onDuplicate                    DuplicateFunc
+	backpressure                   Backpressure
+	nStart                         int
+	parserLimits                   message.ParserLimits
+	nonConfirmableRetry            client.NonConfirmableRetry
+	retryAfter                     client.RetryAfterPolicy
+	writeTimeout                   time.Duration
+	exchangeTimeout                time.Duration
+	messagePool                    *pool.Pool
+	nonResponsePolicy              NonResponsePolicy
+	pacing                         Pacing
+	oscoreContext                  *oscore.Context
+	newTransmissionParams          client.NewTransmissionParamsFunc
+	observeRecovery                client.ObserveRecovery
+	controlLaneSize                int
+	onRetransmit                   client.RetransmitFunc
+	traceHandler                   client.TraceHandler
+	stats                          metrics.Stats
+	newDedup                       client.NewDedupFunc
+	pooledResponses                bool
+	responseCache                  cache.Store
+	uriAuthority                   *client.Authority
+	stampURIAuthority              bool
+	proxyAddr                      string
+	proxyScheme                    string
+	tokenManager                   message.TokenManager
+	connectionIDGenerator          func() []byte
 }
 
 // A DialOption sets options such as credentials, keepalive parameters, etc.
@@ -85,32 +131,58 @@ func Dial(target string, dtlsCfg *dtls.Config, opts ...DialOption) (*client.Clie
 		o.applyDial(&cfg)
 	}
 
-	c, err := cfg.dialer.DialContext(cfg.ctx, cfg.net, target)
+	addr := target
+	if cfg.proxyAddr != "" {
+		addr = cfg.proxyAddr
+	}
+	c, err := cfg.dialer.DialContext(cfg.ctx, cfg.net, addr)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := dtls.Client(c, dtlsCfg)
+	if cfg.connectionIDGenerator != nil {
+		c := *dtlsCfg
+		c.ConnectionIDGenerator = cfg.connectionIDGenerator
+		dtlsCfg = &c
+	}
+	conn, err := dtls.Client(dtlsnet.PacketConnFromConn(c), c.RemoteAddr(), dtlsCfg)
 	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(cfg.ctx, handshakeTimeout)
+	defer cancel()
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 	opts = append(opts, WithCloseSocket())
+	switch {
+	case cfg.proxyAddr != "":
+		// the peer is the proxy, the target is the origin server
+		opts = append(opts, URIAuthorityOpt{authority: target, proxyScheme: cfg.proxyScheme})
+	case cfg.stampURIAuthority && cfg.uriAuthority == nil:
+		opts = append(opts, WithURIAuthority(target))
+	}
 	return Client(conn, opts...), nil
 }
 
-func bwAcquireMessage(ctx context.Context) blockwise.Message {
-	return pool.AcquireMessage(ctx)
+func bwAcquireMessage(messagePool *pool.Pool) func(ctx context.Context) blockwise.Message {
+	return func(ctx context.Context) blockwise.Message {
+		return messagePool.AcquireMessage(ctx)
+	}
 }
 
 func bwReleaseMessage(m blockwise.Message) {
 	pool.ReleaseMessage(m.(*pool.Message))
 }
 
-func bwCreateHandlerFunc(observatioRequests *kitSync.Map) func(token message.Token) (blockwise.Message, bool) {
+func bwCreateHandlerFunc(messagePool *pool.Pool, observatioRequests *kitSync.Map) func(token message.Token) (blockwise.Message, bool) {
 	return func(token message.Token) (blockwise.Message, bool) {
 		msg, ok := observatioRequests.LoadWithFunc(token.String(), func(v interface{}) interface{} {
 			r := v.(*pool.Message)
-			d := pool.AcquireMessage(r.Context())
+			d := messagePool.AcquireMessage(r.Context())
 			d.ResetOptionsTo(r.Options())
 			d.SetCode(r.Code())
 			d.SetToken(r.Token())
@@ -127,10 +199,51 @@ func bwCreateHandlerFunc(observatioRequests *kitSync.Map) func(token message.Tok
 
 // Client creates client over dtls connection.
 func Client(conn *dtls.Conn, opts ...DialOption) *client.ClientConn {
+	cfg := newDialConfig(conn.RemoteAddr(), opts...)
+	monitor := cfg.createInactivityMonitor()
+	var cc *client.ClientConn
+	l := coapNet.NewConn(conn, coapNet.WithHeartBeat(cfg.heartBeat), coapNet.WithOnReadTimeout(func() error {
+		monitor.CheckInactivity(cc)
+		return nil
+	}))
+	cc = newClientConn(coapNet.NewConnTransport(l), cfg, monitor)
+	setIdentity(cc, conn)
+	setRequestInfo(cc, conn)
+	go func() {
+		err := cc.Run()
+		if err != nil {
+			cfg.errors(err)
+		}
+	}()
+	return cc
+}
+
+// ClientTransport creates client over the transport, e.g. a serial line, which carries messages
+// in the same format as DTLS. The transport is closed with the client, its inactivity is not monitored.
+func ClientTransport(transport coapNet.Transport, opts ...DialOption) *client.ClientConn {
+	cfg := newDialConfig(transport.RemoteAddr(), opts...)
+	cfg.closeSocket = true
+	cc := newClientConn(transport, cfg, inactivity.NewNilMonitor())
+	go func() {
+		err := cc.Run()
+		if err != nil {
+			cfg.errors(err)
+		}
+	}()
+	return cc
+}
+
+func newDialConfig(remoteAddr net.Addr, opts ...DialOption) dialOptions {
 	cfg := defaultDialOptions
 	for _, o := range opts {
 		o.applyDial(&cfg)
 	}
+	if cfg.logger != nil {
+		cfg.traceHandler = coapNet.LogTraceHandler(cfg.logger, cfg.traceHandler)
+	}
+	if cfg.stats != nil {
+		cfg.traceHandler = metrics.TraceHandler(cfg.stats, cfg.traceHandler)
+	}
 	if cfg.errors == nil {
 		cfg.errors = func(error) {}
 	}
@@ -145,52 +258,74 @@ func Client(conn *dtls.Conn, opts ...DialOption) *client.ClientConn {
 			// this error was produced by cancellation context - don't report it.
 			return
 		}
-		errorsFunc(fmt.Errorf("dtls: %v: %w", conn.RemoteAddr(), err))
+		errorsFunc(fmt.Errorf("dtls: %v: %w", remoteAddr, err))
 	}
+	return cfg
+}
 
+func newClientConn(transport coapNet.Transport, cfg dialOptions, monitor inactivity.Monitor) *client.ClientConn {
 	observatioRequests := kitSync.NewMap()
 	var blockWise *blockwise.BlockWise
 	if cfg.blockwiseEnable {
 		blockWise = blockwise.NewBlockWise(
-			bwAcquireMessage,
+			bwAcquireMessage(cfg.messagePool),
 			bwReleaseMessage,
 			cfg.blockwiseTransferTimeout,
 			cfg.errors,
 			false,
-			bwCreateHandlerFunc(observatioRequests),
+			bwCreateHandlerFunc(cfg.messagePool, observatioRequests),
+			append([]blockwise.Option{blockwise.WithLimits(cfg.blockwiseLimits), blockwise.WithProgress(cfg.blockwiseProgress)}, cfg.blockwiseOptions...)...,
 		)
 	}
 
 	observationTokenHandler := client.NewHandlerContainer()
-	monitor := cfg.createInactivityMonitor()
-	var cc *client.ClientConn
-	l := coapNet.NewConn(conn, coapNet.WithHeartBeat(cfg.heartBeat), coapNet.WithOnReadTimeout(func() error {
-		monitor.CheckInactivity(cc)
-		return nil
-	}))
-	session := NewSession(cfg.ctx,
-		l,
+	session := client.NewTransportSession(cfg.ctx,
+		transport,
 		cfg.maxMessageSize,
 		cfg.closeSocket,
 	)
-	cc = client.NewClientConn(session,
-		observationTokenHandler, observatioRequests, cfg.transmissionNStart, cfg.transmissionAcknowledgeTimeout, cfg.transmissionMaxRetransmit,
-		client.NewObservationHandler(observationTokenHandler, cfg.handler),
-		cfg.blockwiseSZX,
-		blockWise,
-		cfg.goPool,
-		cfg.errors,
-		cfg.getMID,
-		// The client does not support activity monitoring yet
-		monitor,
+	return client.NewClientConn(
+		session,
+		observationTokenHandler,
+		observatioRequests,
+		client.Config{
+			TransmissionNStart:             cfg.transmissionNStart,
+			TransmissionAcknowledgeTimeout: cfg.transmissionAcknowledgeTimeout,
+			TransmissionMaxRetransmit:      cfg.transmissionMaxRetransmit,
+			Handler:                        client.NewObservationHandler(observationTokenHandler, cfg.handler),
+			BlockwiseSZX:                   cfg.blockwiseSZX,
+			BlockWise:                      blockWise,
+			GoPool:                         cfg.goPool,
+			Errors:                         cfg.errors,
+			MIDGenerator:                   cfg.newMIDGenerator(session.RemoteAddr()),
+			// The client does not support activity monitoring yet
+			ActivityMonitor:       monitor,
+			RawHandler:            cfg.rawHandler,
+			ReliableTransport:     cfg.reliableTransport,
+			ObservationStore:      cfg.observationStore,
+			OnExchange:            cfg.onExchange,
+			NonResponsePolicy:     cfg.nonResponsePolicy,
+			Pacing:                cfg.pacing,
+			OSCOREContext:         cfg.oscoreContext,
+			NewTransmissionParams: cfg.newTransmissionParams,
+			ObserveRecovery:       cfg.observeRecovery,
+			ControlLaneSize:       cfg.controlLaneSize,
+			OnRetransmit:          cfg.onRetransmit,
+			TraceHandler:          cfg.traceHandler,
+			NewDedup:              cfg.newDedup,
+			PooledResponses:       cfg.pooledResponses,
+			ResponseCache:         cfg.responseCache,
+			Authority:             cfg.uriAuthority,
+			TokenManager:          cfg.tokenManager,
+			OnDuplicate:           cfg.onDuplicate,
+			Backpressure:          cfg.backpressure,
+			NStart:                cfg.nStart,
+			ParserLimits:          cfg.parserLimits,
+			NonConfirmableRetry:   cfg.nonConfirmableRetry,
+			RetryAfter:            cfg.retryAfter,
+			WriteTimeout:          cfg.writeTimeout,
+			ExchangeTimeout:       cfg.exchangeTimeout,
+			MessagePool:           cfg.messagePool,
+		},
 	)
-
-	go func() {
-		err := cc.Run()
-		if err != nil {
-			cfg.errors(err)
-		}
-	}()
-
-	return cc
 }
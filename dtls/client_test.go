@@ -7,12 +7,14 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	piondtls "github.com/pion/dtls/v2"
+	piondtls "github.com/pion/dtls/v3"
 	"github.com/plgd-dev/go-coap/v2/dtls"
 	"github.com/plgd-dev/go-coap/v2/mux"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
@@ -617,9 +619,6 @@ func TestClientConn_HandeShakeFailure(t *testing.T) {
 		},
 		PSKIdentityHint: []byte("Pion DTLS Server"),
 		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
-		ConnectContextMaker: func() (context.Context, func()) {
-			return context.WithTimeout(context.Background(), 1*time.Second)
-		},
 	}
 	l, err := coapNet.NewDTLSListener("udp", "", dtlsCfg)
 	require.NoError(t, err)
@@ -644,9 +643,6 @@ func TestClientConn_HandeShakeFailure(t *testing.T) {
 		},
 		PSKIdentityHint: []byte("Pion DTLS Client"),
 		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
-		ConnectContextMaker: func() (context.Context, func()) {
-			return context.WithTimeout(context.Background(), 1*time.Second)
-		},
 	}
 	_, err = dtls.Dial(l.Addr().String(), dtlsCfgClient)
 	require.Error(t, err)
@@ -762,7 +758,7 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 	cc, err := dtls.Dial(
 		ld.Addr().String(),
 		clientCgf,
-		dtls.WithKeepAlive(3, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+		dtls.WithKeepAlive(50*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
 			require.False(t, inactivityDetected)
 			inactivityDetected = true
 			cc.Close()
@@ -782,3 +778,198 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+type resumeCounter struct {
+	*dtls.SessionCache
+	resumed uint32
+	m       sync.Mutex
+}
+
+func (c *resumeCounter) Get(key []byte) (piondtls.Session, error) {
+	s, err := c.SessionCache.Get(key)
+	if s.ID != nil {
+		c.m.Lock()
+		c.resumed++
+		c.m.Unlock()
+	}
+	return s, err
+}
+
+func (c *resumeCounter) Resumed() uint32 {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.resumed
+}
+
+func TestClientConn_SessionResumption(t *testing.T) {
+	serverSessions := &resumeCounter{SessionCache: dtls.NewSessionCache(time.Minute)}
+	dtlsCfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+		SessionStore:    serverSessions,
+	}
+	l, err := coapNet.NewDTLSListener("udp", "", dtlsCfg)
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := dtls.NewServer()
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	clientSessions := dtls.NewSessionCache(time.Minute)
+	dtlsCfgClient := &piondtls.Config{
+		PSK:             dtlsCfg.PSK,
+		PSKIdentityHint: dtlsCfg.PSKIdentityHint,
+		CipherSuites:    dtlsCfg.CipherSuites,
+		SessionStore:    clientSessions,
+	}
+	ping := func() {
+		cc, err := dtls.Dial(l.Addr().String(), dtlsCfgClient)
+		require.NoError(t, err)
+		defer func() {
+			cc.Close()
+			<-cc.Done()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = cc.Ping(ctx)
+		require.NoError(t, err)
+	}
+
+	ping()
+	require.Equal(t, 1, clientSessions.Len())
+	require.Equal(t, uint32(0), serverSessions.Resumed())
+
+	// new connection, e.g. after NAT rebinding, resumes the session
+	ping()
+	require.Equal(t, uint32(1), serverSessions.Resumed())
+}
+
+// rebindingProxy forwards datagrams between the client and the server, rebind changes the address from which
+// the server receives them, as NAT rebinding does.
+type rebindingProxy struct {
+	front  *net.UDPConn
+	server *net.UDPAddr
+	mutex  sync.Mutex
+	back   *net.UDPConn
+	client *net.UDPAddr
+}
+
+func newRebindingProxy(t *testing.T, server string) *rebindingProxy {
+	serverAddr, err := net.ResolveUDPAddr("udp", server)
+	require.NoError(t, err)
+	front, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	p := &rebindingProxy{front: front, server: serverAddr}
+	p.rebind(t)
+	go func() {
+		b := make([]byte, 2048)
+		for {
+			n, addr, err := front.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			p.mutex.Lock()
+			p.client = addr
+			back := p.back
+			p.mutex.Unlock()
+			_, _ = back.WriteToUDP(b[:n], p.server)
+		}
+	}()
+	return p
+}
+
+func (p *rebindingProxy) rebind(t *testing.T) {
+	back, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	p.mutex.Lock()
+	old := p.back
+	p.back = back
+	p.mutex.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	go func() {
+		b := make([]byte, 2048)
+		for {
+			n, err := back.Read(b)
+			if err != nil {
+				return
+			}
+			p.mutex.Lock()
+			client := p.client
+			p.mutex.Unlock()
+			_, _ = p.front.WriteToUDP(b[:n], client)
+		}
+	}()
+}
+
+func (p *rebindingProxy) Addr() string {
+	return p.front.LocalAddr().String()
+}
+
+func (p *rebindingProxy) Close() {
+	_ = p.front.Close()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_ = p.back.Close()
+}
+
+func TestClientConn_ConnectionID(t *testing.T) {
+	dtlsCfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	l, err := coapNet.NewDTLSListener("udp4", "127.0.0.1:", dtlsCfg, coapNet.WithConnectionID(piondtls.RandomCIDGenerator(8)))
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var conns uint32
+	s := dtls.NewServer(dtls.WithOnNewClientConn(func(cc *client.ClientConn, dtlsConn *piondtls.Conn) {
+		atomic.AddUint32(&conns, 1)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	p := newRebindingProxy(t, l.Addr().String())
+	defer p.Close()
+
+	cc, err := dtls.Dial(p.Addr(), dtlsCfg, dtls.WithConnectionID(piondtls.OnlySendCIDGenerator()))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+
+	// the server receives records of the connection from other address
+	p.rebind(t)
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&conns))
+}
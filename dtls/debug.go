@@ -0,0 +1,52 @@
+package dtls
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	messagePool "github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// DebugSnapshot is state of the server, e.g. to attach to a bug report.
+type DebugSnapshot struct {
+	Time      time.Time `json:"time"`
+	LocalAddr string    `json:"localAddr,omitempty"`
+	// Sessions contains state of connections, including those served by ServeTransport, sorted by remote address.
+	Sessions []client.ConnSnapshot `json:"sessions"`
+	// MessagePool contains usage statistics of the Message pool.
+	MessagePool messagePool.Stats `json:"messagePool"`
+}
+
+// DebugSnapshot returns state of the server and its connections.
+func (s *Server) DebugSnapshot() DebugSnapshot {
+	snapshot := DebugSnapshot{
+		Time:        time.Now(),
+		MessagePool: pool.Stats(),
+	}
+	s.listenMutex.Lock()
+	if l, ok := s.listen.(interface{ Addr() net.Addr }); ok {
+		snapshot.LocalAddr = l.Addr().String()
+	}
+	s.listenMutex.Unlock()
+	conns := s.getClientConns()
+	snapshot.Sessions = make([]client.ConnSnapshot, 0, len(conns))
+	for _, cc := range conns {
+		snapshot.Sessions = append(snapshot.Sessions, cc.Snapshot())
+	}
+	sort.Slice(snapshot.Sessions, func(i, j int) bool {
+		return snapshot.Sessions[i].RemoteAddr < snapshot.Sessions[j].RemoteAddr
+	})
+	return snapshot
+}
+
+// DebugDump writes DebugSnapshot as indented JSON to w.
+func (s *Server) DebugDump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.DebugSnapshot())
+}
@@ -0,0 +1,169 @@
+package dtls
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+)
+
+// ErrRawPublicKeyNotAccepted is returned by the verification of a raw public key which the verify function rejected.
+var ErrRawPublicKeyNotAccepted = errors.New("raw public key is not accepted")
+
+// Identity is the credential which authenticated the peer of the connection in the DTLS handshake.
+type Identity struct {
+	// PSKIdentity is the PSK identity sent by the client, on the client side it is the identity hint
+	// of the server. It is nil when certificates were used.
+	PSKIdentity []byte
+	// Certificates is the certificate chain of the peer, the leaf comes first.
+	Certificates []*x509.Certificate
+	// PublicKey is the public key of the leaf certificate, it identifies the peer authenticated by a raw public key.
+	PublicKey crypto.PublicKey
+}
+
+type identityKey struct{}
+
+// newIdentity reads the identity from state of the established connection. Certificates which cannot be parsed
+// are omitted, pion has already verified them.
+func newIdentity(conn *dtls.Conn) Identity {
+	state, ok := conn.ConnectionState()
+	if !ok {
+		return Identity{}
+	}
+	var id Identity
+	if len(state.IdentityHint) > 0 {
+		id.PSKIdentity = append([]byte(nil), state.IdentityHint...)
+	}
+	for _, raw := range state.PeerCertificates {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			continue
+		}
+		id.Certificates = append(id.Certificates, cert)
+	}
+	if len(id.Certificates) > 0 {
+		id.PublicKey = id.Certificates[0].PublicKey
+	}
+	return id
+}
+
+// setIdentity stores identity of the peer to context of connection, so handlers reach it by ClientIdentity.
+func setIdentity(cc *client.ClientConn, conn *dtls.Conn) {
+	cc.SetContextValue(identityKey{}, newIdentity(conn))
+}
+
+// setRequestInfo sets transport of messages received by the connection with the negotiated cipher suite.
+func setRequestInfo(cc *client.ClientConn, conn *dtls.Conn) {
+	info := coapNet.RequestInfo{
+		Network:    "dtls",
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+	}
+	if state, ok := conn.ConnectionState(); ok {
+		info.CipherSuite = dtls.CipherSuiteName(state.CipherSuiteID)
+	}
+	cc.SetRequestInfo(info)
+}
+
+// ClientIdentity returns identity of the peer authenticated by the DTLS handshake. In handlers of the server
+// ctx is the context of the request and the identity is the one of the client, so handlers can authorize
+// the device. It returns false for connections which are not over DTLS, e.g. ServeTransport.
+func ClientIdentity(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// RawPublicKeyVerifyFunc decides whether the peer with the public key is accepted.
+type RawPublicKeyVerifyFunc = func(pub crypto.PublicKey) error
+
+// NewRawPublicKeyConfig creates config which authenticates both endpoints by raw public keys instead of
+// certificates signed by a CA, e.g. for devices provisioned with a key pair whose public key is pinned at the server.
+//
+// pion/dtls doesn't negotiate certificate types of RFC 7250, so the key is carried in a minimal self-signed
+// certificate and only its public key is verified by verify, the rest of the certificate is ignored. The config
+// interoperates with peers which follow the same convention. It can be used by Dial as well as by
+// NewDTLSListener, and the fields of the returned config can be adjusted.
+func NewRawPublicKeyConfig(key crypto.Signer, verify RawPublicKeyVerifyFunc) (*dtls.Config, error) {
+	cert, err := RawPublicKeyCertificate(key)
+	if err != nil {
+		return nil, err
+	}
+	return &dtls.Config{
+		Certificates:          []tls.Certificate{cert},
+		ExtendedMasterSecret:  dtls.RequireExtendedMasterSecret,
+		ClientAuth:            dtls.RequireAnyClientCert,
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: VerifyRawPublicKey(verify),
+	}, nil
+}
+
+// RawPublicKeyCertificate wraps the key to a minimal self-signed certificate which carries the public key.
+func RawPublicKeyCertificate(key crypto.Signer) (tls.Certificate, error) {
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("cannot create certificate of raw public key: %w", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// VerifyRawPublicKey creates VerifyPeerCertificate of dtls.Config which passes public key of the leaf certificate
+// to verify. Validity and issuer of the certificate are not checked.
+func VerifyRawPublicKey(verify RawPublicKeyVerifyFunc) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("%w: peer didn't send any", ErrRawPublicKeyNotAccepted)
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return fmt.Errorf("cannot parse certificate of raw public key: %w", err)
+		}
+		if err := verify(cert.PublicKey); err != nil {
+			return fmt.Errorf("%w: %v", ErrRawPublicKeyNotAccepted, err)
+		}
+		return nil
+	}
+}
+
+// PinnedPublicKeys creates RawPublicKeyVerifyFunc which accepts only the keys, compared in PKIX form.
+func PinnedPublicKeys(keys ...crypto.PublicKey) (RawPublicKeyVerifyFunc, error) {
+	pinned := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal pinned public key: %w", err)
+		}
+		pinned = append(pinned, der)
+	}
+	return func(pub crypto.PublicKey) error {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return err
+		}
+		for _, p := range pinned {
+			if bytes.Equal(p, der) {
+				return nil
+			}
+		}
+		return errors.New("public key is not pinned")
+	}, nil
+}
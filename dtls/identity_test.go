@@ -0,0 +1,177 @@
+package dtls_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	piondtls "github.com/pion/dtls/v3"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+// serveIdentity answers requests by the PSK identity of the client or 4.03 when the client isn't authenticated.
+func serveIdentity(t *testing.T, cfg *piondtls.Config, authorize func(id dtls.Identity) bool) string {
+	ld, err := coapNet.NewDTLSListener("udp4", "", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ld.Close() })
+
+	sd := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		id, ok := dtls.ClientIdentity(r.Context())
+		if !ok || !authorize(id) {
+			_ = w.SetResponse(codes.Forbidden, message.TextPlain, nil)
+			return
+		}
+		_ = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(id.PSKIdentity))
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = sd.Serve(ld)
+	}()
+	t.Cleanup(func() {
+		sd.Stop()
+		<-done
+	})
+	return ld.Addr().String()
+}
+
+func TestClientIdentity_PSK(t *testing.T) {
+	keys := map[string][]byte{
+		"device-1": {0x01, 0x02, 0x03},
+		"device-2": {0x04, 0x05, 0x06},
+	}
+	serverCfg := &piondtls.Config{
+		PSK: func(identity []byte) ([]byte, error) {
+			return keys[string(identity)], nil
+		},
+		PSKIdentityHint: []byte("server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	addr := serveIdentity(t, serverCfg, func(id dtls.Identity) bool {
+		return string(id.PSKIdentity) == "device-1"
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for identity, code := range map[string]codes.Code{"device-1": codes.Content, "device-2": codes.Forbidden} {
+		identity := identity
+		cc, err := dtls.Dial(addr, &piondtls.Config{
+			PSK: func([]byte) ([]byte, error) {
+				return keys[identity], nil
+			},
+			PSKIdentityHint: []byte(identity),
+			CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+		})
+		require.NoError(t, err)
+		serverID, ok := dtls.ClientIdentity(cc.Context())
+		require.True(t, ok)
+		require.Equal(t, []byte("server"), serverID.PSKIdentity)
+
+		resp, err := cc.Get(ctx, "/")
+		require.NoError(t, err)
+		require.Equal(t, code, resp.Code())
+		if code == codes.Content {
+			body, err := resp.ReadBody()
+			require.NoError(t, err)
+			require.Equal(t, []byte(identity), body)
+		}
+		cc.Close()
+		<-cc.Done()
+	}
+}
+
+func TestClientIdentity_RawPublicKey(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	deviceKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	unknownKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	pinnedDevices, err := dtls.PinnedPublicKeys(deviceKey.Public())
+	require.NoError(t, err)
+	serverCfg, err := dtls.NewRawPublicKeyConfig(serverKey, pinnedDevices)
+	require.NoError(t, err)
+	addr := serveIdentity(t, serverCfg, func(id dtls.Identity) bool {
+		return deviceKey.PublicKey.Equal(id.PublicKey)
+	})
+
+	pinnedServer, err := dtls.PinnedPublicKeys(serverKey.Public())
+	require.NoError(t, err)
+	clientCfg, err := dtls.NewRawPublicKeyConfig(deviceKey, pinnedServer)
+	require.NoError(t, err)
+	cc, err := dtls.Dial(addr, clientCfg)
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	serverID, ok := dtls.ClientIdentity(cc.Context())
+	require.True(t, ok)
+	require.True(t, serverKey.PublicKey.Equal(serverID.PublicKey))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	// the server rejects the handshake of a key which isn't pinned
+	unknownCfg, err := dtls.NewRawPublicKeyConfig(unknownKey, pinnedServer)
+	require.NoError(t, err)
+	_, err = dtls.Dial(addr, unknownCfg, dtls.WithContext(ctx))
+	require.Error(t, err)
+}
+
+func TestServer_RequestInfo(t *testing.T) {
+	cfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	ld, err := coapNet.NewDTLSListener("udp4", "", cfg)
+	require.NoError(t, err)
+	defer ld.Close()
+	infos := make(chan coapNet.RequestInfo, 1)
+	sd := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		info, ok := coapNet.RequestInfoFromContext(r.Context())
+		require.True(t, ok)
+		infos <- info
+		_ = w.SetResponse(codes.Content, message.TextPlain, nil)
+	}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = sd.Serve(ld)
+	}()
+	defer func() {
+		sd.Stop()
+		<-done
+	}()
+
+	cc, err := dtls.Dial(ld.Addr().String(), cfg)
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = cc.Get(ctx, "/")
+	require.NoError(t, err)
+	info := <-infos
+	require.Equal(t, "dtls", info.Network)
+	require.Equal(t, piondtls.CipherSuiteName(piondtls.TLS_PSK_WITH_AES_128_CCM_8), info.CipherSuite)
+	require.True(t, info.Confirmable)
+	require.NotNil(t, info.LocalAddr)
+	require.NotNil(t, info.RemoteAddr)
+}
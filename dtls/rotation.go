@@ -0,0 +1,201 @@
+package dtls
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// RedialFunc establishes connection which replaces cc, e.g. by Dial with rotated certificates or PSK.
+type RedialFunc = func(ctx context.Context, cc *client.ClientConn) (*client.ClientConn, error)
+
+// RestoreFunc creates observe function of the observation restored at the new connection.
+type RestoreFunc = func(cc *client.ClientConn, record observation.Record) func(req *pool.Message)
+
+// Rotation holds outcome of the rotation of one connection.
+type Rotation struct {
+	// Index of the connection in the slice passed to Rotate.
+	Index int
+	// Old is the replaced connection.
+	Old *client.ClientConn
+	// New is the replacing connection. It is nil when redial failed, in which case Old is kept open.
+	New *client.ClientConn
+	// Observations are observations restored at New.
+	Observations []*client.Observation
+	Err          error
+}
+
+var defaultRotateOptions = rotateOptions{
+	concurrency:  1,
+	closeTimeout: time.Second * 5,
+}
+
+type rotateOptions struct {
+	concurrency  int
+	jitter       time.Duration
+	closeTimeout time.Duration
+	restore      RestoreFunc
+	onRotated    func(r Rotation)
+}
+
+// A RotateOption sets options such as concurrency, jitter, etc.
+type RotateOption interface {
+	applyRotate(*rotateOptions)
+}
+
+// RotationConcurrencyOpt rotation concurrency option.
+type RotationConcurrencyOpt struct {
+	concurrency int
+}
+
+func (o RotationConcurrencyOpt) applyRotate(opts *rotateOptions) {
+	opts.concurrency = o.concurrency
+}
+
+// WithRotationConcurrency limits number of connections which are rotated at the same time.
+func WithRotationConcurrency(concurrency int) RotationConcurrencyOpt {
+	return RotationConcurrencyOpt{concurrency: concurrency}
+}
+
+// RotationJitterOpt rotation jitter option.
+type RotationJitterOpt struct {
+	jitter time.Duration
+}
+
+func (o RotationJitterOpt) applyRotate(opts *rotateOptions) {
+	opts.jitter = o.jitter
+}
+
+// WithRotationJitter delays rotation of each connection by random duration up to jitter,
+// so remote endpoints don't see handshakes at the same time.
+func WithRotationJitter(jitter time.Duration) RotationJitterOpt {
+	return RotationJitterOpt{jitter: jitter}
+}
+
+// RotationCloseTimeoutOpt rotation close timeout option.
+type RotationCloseTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o RotationCloseTimeoutOpt) applyRotate(opts *rotateOptions) {
+	opts.closeTimeout = o.timeout
+}
+
+// WithRotationCloseTimeout set's how long the old connection is drained before it is closed.
+func WithRotationCloseTimeout(timeout time.Duration) RotationCloseTimeoutOpt {
+	return RotationCloseTimeoutOpt{timeout: timeout}
+}
+
+// RotationRestoreOpt rotation restore option.
+type RotationRestoreOpt struct {
+	restore RestoreFunc
+}
+
+func (o RotationRestoreOpt) applyRotate(opts *rotateOptions) {
+	opts.restore = o.restore
+}
+
+// WithRotationRestore restores observations of the old connection at the new one via
+// ClientConn.RestoreObservations. Both connections must share the observation store.
+func WithRotationRestore(restore RestoreFunc) RotationRestoreOpt {
+	return RotationRestoreOpt{restore: restore}
+}
+
+// OnRotatedOpt on rotated option.
+type OnRotatedOpt struct {
+	onRotated func(r Rotation)
+}
+
+func (o OnRotatedOpt) applyRotate(opts *rotateOptions) {
+	opts.onRotated = o.onRotated
+}
+
+// WithOnRotated set function which is called as soon as a connection is rotated or its rotation fails,
+// e.g. to swap the connection in the application.
+func WithOnRotated(onRotated func(r Rotation)) OnRotatedOpt {
+	return OnRotatedOpt{onRotated: onRotated}
+}
+
+// Rotate replaces connections in stages, e.g. after certificates or PSK were rotated. Every connection
+// is replaced by the connection created by redial first, so the old one stays usable when the handshake
+// fails. Then the old connection is gracefully closed and observations are restored at the new one.
+// Results are ordered as conns.
+func Rotate(ctx context.Context, conns []*client.ClientConn, redial RedialFunc, opts ...RotateOption) []Rotation {
+	cfg := defaultRotateOptions
+	for _, o := range opts {
+		o.applyRotate(&cfg)
+	}
+	if cfg.concurrency <= 0 {
+		cfg.concurrency = 1
+	}
+	results := make([]Rotation, len(conns))
+	sem := make(chan struct{}, cfg.concurrency)
+	var wg sync.WaitGroup
+	for i, cc := range conns {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			for j := i; j < len(conns); j++ {
+				results[j] = Rotation{Index: j, Old: conns[j], Err: ctx.Err()}
+			}
+			wg.Wait()
+			return results
+		}
+		wg.Add(1)
+		go func(i int, cc *client.ClientConn) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = rotate(ctx, i, cc, redial, cfg)
+			if cfg.onRotated != nil {
+				cfg.onRotated(results[i])
+			}
+		}(i, cc)
+	}
+	wg.Wait()
+	return results
+}
+
+func rotate(ctx context.Context, idx int, cc *client.ClientConn, redial RedialFunc, cfg rotateOptions) Rotation {
+	r := Rotation{
+		Index: idx,
+		Old:   cc,
+	}
+	if cfg.jitter > 0 {
+		t := time.NewTimer(time.Duration(rand.Int63n(int64(cfg.jitter))))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			r.Err = ctx.Err()
+			return r
+		}
+	}
+	newCC, err := redial(ctx, cc)
+	if err != nil {
+		r.Err = fmt.Errorf("cannot redial: %w", err)
+		return r
+	}
+	r.New = newCC
+
+	closeCtx, cancel := context.WithTimeout(ctx, cfg.closeTimeout)
+	defer cancel()
+	// observation records are kept, so they can be restored at the new connection
+	_ = cc.CloseGracefully(closeCtx)
+
+	if cfg.restore == nil {
+		return r
+	}
+	r.Observations, err = newCC.RestoreObservations(ctx, func(record observation.Record) func(req *pool.Message) {
+		return cfg.restore(newCC, record)
+	})
+	if err != nil {
+		r.Err = fmt.Errorf("cannot restore observations: %w", err)
+	}
+	return r
+}
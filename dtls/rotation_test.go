@@ -0,0 +1,97 @@
+package dtls_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	piondtls "github.com/pion/dtls/v3"
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotate(t *testing.T) {
+	dtlsCfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	l, err := coapNet.NewDTLSListener("udp", "", dtlsCfg)
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	conns := make([]*client.ClientConn, 0, 4)
+	for i := 0; i < 4; i++ {
+		cc, err := dtls.Dial(l.Addr().String(), dtlsCfg)
+		require.NoError(t, err)
+		defer cc.Close()
+		conns = append(conns, cc)
+	}
+
+	var rotatedMutex sync.Mutex
+	var rotated int
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	results := dtls.Rotate(ctx, conns, func(ctx context.Context, cc *client.ClientConn) (*client.ClientConn, error) {
+		if cc == conns[3] {
+			return nil, errors.New("handshake failed")
+		}
+		return dtls.Dial(l.Addr().String(), dtlsCfg)
+	}, dtls.WithRotationConcurrency(2), dtls.WithRotationJitter(time.Millisecond*50), dtls.WithOnRotated(func(r dtls.Rotation) {
+		rotatedMutex.Lock()
+		defer rotatedMutex.Unlock()
+		rotated++
+	}))
+	require.Len(t, results, len(conns))
+	require.Equal(t, len(conns), rotated)
+
+	for i, r := range results[:3] {
+		require.NoError(t, r.Err)
+		require.Equal(t, i, r.Index)
+		require.Equal(t, conns[i], r.Old)
+		require.NotNil(t, r.New)
+		defer r.New.Close()
+		select {
+		case <-r.Old.Done():
+		case <-ctx.Done():
+			require.NoError(t, ctx.Err())
+		}
+		resp, err := r.New.Get(ctx, "/a")
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		pool.ReleaseMessage(resp)
+	}
+
+	// failed rotation keeps the old connection
+	require.Error(t, results[3].Err)
+	require.Nil(t, results[3].New)
+	resp, err := conns[3].Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	pool.ReleaseMessage(resp)
+}
@@ -4,16 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/pion/dtls/v2"
+	"github.com/pion/dtls/v3"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/echo"
+	"github.com/plgd-dev/go-coap/v2/metrics"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
@@ -43,6 +49,22 @@ type OnNewClientConnFunc = func(cc *client.ClientConn, dtlsConn *dtls.Conn)
 
 type GetMIDFunc = func() uint16
 
+type RawHandlerFunc = client.RawHandlerFunc
+
+type ExchangeFunc = client.ExchangeFunc
+
+type DuplicateFunc = client.DuplicateFunc
+
+type SlowObserverFunc = client.SlowObserverFunc
+
+type Backpressure = client.Backpressure
+
+type NonResponsePolicy = client.NonResponsePolicy
+
+type Pacing = client.Pacing
+
+type TransmissionConfig = client.TransmissionConfig
+
 var defaultServerOptions = serverOptions{
 	ctx:            context.Background(),
 	maxMessageSize: 64 * 1024,
@@ -70,6 +92,9 @@ var defaultServerOptions = serverOptions{
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	newMIDGenerator:                client.NewSequentialMIDGenerator,
+	controlLaneSize:                client.DefaultControlLaneSize,
+	shutdownMaxAge:                 client.DefaultShutdownMaxAge,
 }
 
 type serverOptions struct {
@@ -77,17 +102,46 @@ type serverOptions struct {
 	maxMessageSize                 int
 	handler                        HandlerFunc
 	errors                         ErrorFunc
+	logger                         coapNet.Logger
 	goPool                         GoPoolFunc
 	createInactivityMonitor        func() inactivity.Monitor
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseLimits                blockwise.Limits
+	blockwiseProgress              blockwise.ProgressFunc
+	blockwiseOptions               []blockwise.Option
 	onNewClientConn                OnNewClientConnFunc
 	heartBeat                      time.Duration
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
 	getMID                         GetMIDFunc
+	newMIDGenerator                client.NewMIDGeneratorFunc
+	rawHandler                     RawHandlerFunc
+	reliableTransport              bool
+	onExchange                     ExchangeFunc
+	onDuplicate                    DuplicateFunc
+	backpressure                   Backpressure
+	nStart                         int
+	parserLimits                   message.ParserLimits
+	writeTimeout                   time.Duration
+	exchangeTimeout                time.Duration
+	messagePool                    *pool.Pool
+	nonResponsePolicy              NonResponsePolicy
+	pacing                         Pacing
+	oscoreContext                  *oscore.Context
+	newTransmissionParams          client.NewTransmissionParamsFunc
+	observeRecovery                client.ObserveRecovery
+	controlLaneSize                int
+	onRetransmit                   client.RetransmitFunc
+	traceHandler                   client.TraceHandler
+	stats                          metrics.Stats
+	newDedup                       client.NewDedupFunc
+	pooledResponses                bool
+	echoWindow                     time.Duration
+	shutdownMaxAge                 time.Duration
+	limits                         *limits.Limits
 }
 
 // Listener defined used by coap
@@ -105,18 +159,48 @@ type Server struct {
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseLimits                blockwise.Limits
+	blockwiseProgress              blockwise.ProgressFunc
+	blockwiseOptions               []blockwise.Option
 	onNewClientConn                OnNewClientConnFunc
 	heartBeat                      time.Duration
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
 	getMID                         GetMIDFunc
+	newMIDGenerator                client.NewMIDGeneratorFunc
+	rawHandler                     RawHandlerFunc
+	reliableTransport              bool
+	onExchange                     ExchangeFunc
+	onDuplicate                    DuplicateFunc
+	backpressure                   Backpressure
+	nStart                         int
+	parserLimits                   message.ParserLimits
+	writeTimeout                   time.Duration
+	exchangeTimeout                time.Duration
+	messagePool                    *pool.Pool
+	nonResponsePolicy              NonResponsePolicy
+	pacing                         Pacing
+	oscoreContext                  *oscore.Context
+	newTransmissionParams          client.NewTransmissionParamsFunc
+	observeRecovery                client.ObserveRecovery
+	controlLaneSize                int
+	onRetransmit                   client.RetransmitFunc
+	traceHandler                   client.TraceHandler
+	newDedup                       client.NewDedupFunc
+	pooledResponses                bool
+	shutdownMaxAge                 time.Duration
+	limiter                        *limits.Limiter
+	shuttingDown                   uint32
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	listen      Listener
 	listenMutex sync.Mutex
+
+	conns      map[*client.ClientConn]struct{}
+	connsMutex sync.Mutex
 }
 
 func NewServer(opt ...ServerOption) *Server {
@@ -133,6 +217,9 @@ func NewServer(opt ...ServerOption) *Server {
 	if opts.getMID == nil {
 		opts.getMID = udpMessage.GetMID
 	}
+	if opts.newMIDGenerator == nil {
+		opts.newMIDGenerator = client.NewSequentialMIDGenerator
+	}
 
 	if opts.createInactivityMonitor == nil {
 		opts.createInactivityMonitor = func() inactivity.Monitor {
@@ -140,9 +227,31 @@ func NewServer(opt ...ServerOption) *Server {
 		}
 	}
 
+	if opts.echoWindow > 0 {
+		verifier, err := echo.NewVerifier(opts.echoWindow)
+		if err != nil {
+			opts.errors(fmt.Errorf("dtls: cannot create echo verifier: %w", err))
+		}
+		opts.handler = client.NewEchoVerificationHandler(verifier, opts.handler)
+	}
+
+	var limiter *limits.Limiter
+	if opts.limits != nil {
+		limiter = limits.NewLimiter(*opts.limits)
+		opts.handler = client.NewRateLimitHandler(limiter, client.NewLimitsHandler(limiter, opts.handler))
+	}
+
+	if opts.logger != nil {
+		opts.traceHandler = coapNet.LogTraceHandler(opts.logger, opts.traceHandler)
+	}
+	if opts.stats != nil {
+		opts.traceHandler = metrics.TraceHandler(opts.stats, opts.traceHandler)
+	}
+
 	return &Server{
 		ctx:            ctx,
 		cancel:         cancel,
+		conns:          make(map[*client.ClientConn]struct{}),
 		handler:        opts.handler,
 		maxMessageSize: opts.maxMessageSize,
 		errors: func(err error) {
@@ -157,12 +266,38 @@ func NewServer(opt ...ServerOption) *Server {
 		blockwiseSZX:                   opts.blockwiseSZX,
 		blockwiseEnable:                opts.blockwiseEnable,
 		blockwiseTransferTimeout:       opts.blockwiseTransferTimeout,
+		blockwiseLimits:                opts.blockwiseLimits,
+		blockwiseProgress:              opts.blockwiseProgress,
+		blockwiseOptions:               opts.blockwiseOptions,
 		onNewClientConn:                opts.onNewClientConn,
 		heartBeat:                      opts.heartBeat,
 		transmissionNStart:             opts.transmissionNStart,
 		transmissionAcknowledgeTimeout: opts.transmissionAcknowledgeTimeout,
 		transmissionMaxRetransmit:      opts.transmissionMaxRetransmit,
 		getMID:                         opts.getMID,
+		newMIDGenerator:                opts.newMIDGenerator,
+		rawHandler:                     opts.rawHandler,
+		reliableTransport:              opts.reliableTransport,
+		onExchange:                     opts.onExchange,
+		onDuplicate:                    opts.onDuplicate,
+		backpressure:                   opts.backpressure,
+		nStart:                         opts.nStart,
+		parserLimits:                   opts.parserLimits,
+		writeTimeout:                   opts.writeTimeout,
+		exchangeTimeout:                opts.exchangeTimeout,
+		messagePool:                    opts.messagePool,
+		nonResponsePolicy:              opts.nonResponsePolicy,
+		pacing:                         opts.pacing,
+		oscoreContext:                  opts.oscoreContext,
+		newTransmissionParams:          opts.newTransmissionParams,
+		observeRecovery:                opts.observeRecovery,
+		controlLaneSize:                opts.controlLaneSize,
+		onRetransmit:                   opts.onRetransmit,
+		traceHandler:                   opts.traceHandler,
+		newDedup:                       opts.newDedup,
+		pooledResponses:                opts.pooledResponses,
+		shutdownMaxAge:                 opts.shutdownMaxAge,
+		limiter:                        limiter,
 	}
 }
 
@@ -222,6 +357,14 @@ func (s *Server) Serve(l Listener) error {
 		if !ok {
 			return nil
 		}
+		if rw != nil && atomic.LoadUint32(&s.shuttingDown) == 1 {
+			rw.Close()
+			continue
+		}
+		if rw != nil && s.limiter != nil && !s.limiter.AcquireSession() {
+			rw.Close()
+			continue
+		}
 		if rw != nil {
 			wg.Add(1)
 			var cc *client.ClientConn
@@ -233,13 +376,23 @@ func (s *Server) Serve(l Listener) error {
 					return nil
 				}),
 			}
-			cc = s.createClientConn(coapNet.NewConn(rw, opts...), monitor)
+			cc = s.createClientConn(coapNet.NewConnTransport(coapNet.NewConn(rw, opts...)), monitor)
+			if dtlsConn, ok := rw.(*dtls.Conn); ok {
+				setIdentity(cc, dtlsConn)
+				setRequestInfo(cc, dtlsConn)
+			}
 			if s.onNewClientConn != nil {
 				dtlsConn := rw.(*dtls.Conn)
 				s.onNewClientConn(cc, dtlsConn)
 			}
+			s.addClientConn(cc)
 			go func() {
 				defer wg.Done()
+				defer s.removeClientConn(cc)
+				if s.limiter != nil {
+					defer s.limiter.ReleaseSession()
+					defer s.limiter.RemovePeer(cc)
+				}
 				err := cc.Run()
 				if err != nil {
 					s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
@@ -249,16 +402,87 @@ func (s *Server) Serve(l Listener) error {
 	}
 }
 
+// ServeTransport serves the connection over the transport, e.g. a serial line, until the transport or the server
+// is closed. The transport carries messages in the same format as DTLS, it is closed by the server.
+// OnNewClientConn is not called and inactivity of the transport is not monitored.
+func (s *Server) ServeTransport(transport coapNet.Transport) error {
+	if s.blockwiseSZX > blockwise.SZX1024 {
+		return fmt.Errorf("invalid blockwiseSZX")
+	}
+	if atomic.LoadUint32(&s.shuttingDown) == 1 {
+		return transport.Close()
+	}
+	cc := s.createClientConn(transport, inactivity.NewNilMonitor())
+	s.addClientConn(cc)
+	defer s.removeClientConn(cc)
+	err := cc.Run()
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%v: %w", cc.RemoteAddr(), err)
+	}
+	return nil
+}
+
+func (s *Server) addClientConn(cc *client.ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	s.conns[cc] = struct{}{}
+}
+
+func (s *Server) removeClientConn(cc *client.ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	delete(s.conns, cc)
+}
+
+func (s *Server) getClientConns() []*client.ClientConn {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	conns := make([]*client.ClientConn, 0, len(s.conns))
+	for cc := range s.conns {
+		conns = append(conns, cc)
+	}
+	return conns
+}
+
 // Stop stops server without wait of ends Serve function.
 func (s *Server) Stop() {
 	s.cancel()
 }
 
-func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.Monitor) *client.ClientConn {
+// Shutdown stops accepting new connections, waits until requests in progress, separate responses and blockwise
+// transfers of the connections are finished, cancels observations of the clients by 5.03 Service Unavailable
+// with Max-Age set by WithShutdownMaxAge and stops the server. When ctx is done before that, the server
+// is stopped immediately and ctx error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreUint32(&s.shuttingDown, 1)
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var err error
+	for _, cc := range s.getClientConns() {
+		wg.Add(1)
+		go func(cc *client.ClientConn) {
+			defer wg.Done()
+			errShutdown := cc.Shutdown(ctx, s.shutdownMaxAge)
+			errMutex.Lock()
+			defer errMutex.Unlock()
+			if err == nil && errShutdown != nil {
+				err = fmt.Errorf("%v: %w", cc.RemoteAddr(), errShutdown)
+			}
+		}(cc)
+	}
+	wg.Wait()
+	s.Stop()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) createClientConn(connection coapNet.Transport, monitor inactivity.Monitor) *client.ClientConn {
 	var blockWise *blockwise.BlockWise
 	if s.blockwiseEnable {
 		blockWise = blockwise.NewBlockWise(
-			bwAcquireMessage,
+			bwAcquireMessage(s.messagePool),
 			bwReleaseMessage,
 			s.blockwiseTransferTimeout,
 			s.errors,
@@ -266,10 +490,11 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 			func(token message.Token) (blockwise.Message, bool) {
 				return nil, false
 			},
+			append([]blockwise.Option{blockwise.WithLimits(s.blockwiseLimits), blockwise.WithProgress(s.blockwiseProgress)}, s.blockwiseOptions...)...,
 		)
 	}
 	obsHandler := client.NewHandlerContainer()
-	session := NewSession(
+	session := client.NewTransportSession(
 		s.ctx,
 		connection,
 		s.maxMessageSize,
@@ -279,16 +504,38 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 		session,
 		obsHandler,
 		kitSync.NewMap(),
-		s.transmissionNStart,
-		s.transmissionAcknowledgeTimeout,
-		s.transmissionMaxRetransmit,
-		client.NewObservationHandler(obsHandler, s.handler),
-		s.blockwiseSZX,
-		blockWise,
-		s.goPool,
-		s.errors,
-		s.getMID,
-		monitor,
+		client.Config{
+			TransmissionNStart:             s.transmissionNStart,
+			TransmissionAcknowledgeTimeout: s.transmissionAcknowledgeTimeout,
+			TransmissionMaxRetransmit:      s.transmissionMaxRetransmit,
+			Handler:                        client.NewObservationHandler(obsHandler, s.handler),
+			BlockwiseSZX:                   s.blockwiseSZX,
+			BlockWise:                      blockWise,
+			GoPool:                         s.goPool,
+			Errors:                         s.errors,
+			MIDGenerator:                   s.newMIDGenerator(session.RemoteAddr()),
+			ActivityMonitor:                monitor,
+			RawHandler:                     s.rawHandler,
+			ReliableTransport:              s.reliableTransport,
+			OnExchange:                     s.onExchange,
+			NonResponsePolicy:              s.nonResponsePolicy,
+			Pacing:                         s.pacing,
+			OSCOREContext:                  s.oscoreContext,
+			NewTransmissionParams:          s.newTransmissionParams,
+			ObserveRecovery:                s.observeRecovery,
+			ControlLaneSize:                s.controlLaneSize,
+			OnRetransmit:                   s.onRetransmit,
+			TraceHandler:                   s.traceHandler,
+			NewDedup:                       s.newDedup,
+			PooledResponses:                s.pooledResponses,
+			OnDuplicate:                    s.onDuplicate,
+			Backpressure:                   s.backpressure,
+			NStart:                         s.nStart,
+			ParserLimits:                   s.parserLimits,
+			WriteTimeout:                   s.writeTimeout,
+			ExchangeTimeout:                s.exchangeTimeout,
+			MessagePool:                    s.messagePool,
+		},
 	)
 
 	return cc
@@ -5,17 +5,19 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"sync"
 	"testing"
 	"time"
 
-	piondtls "github.com/pion/dtls/v2"
+	piondtls "github.com/pion/dtls/v3"
 	"github.com/plgd-dev/go-coap/v2/dtls"
 	"github.com/plgd-dev/go-coap/v2/examples/dtls/pki"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
@@ -94,9 +96,6 @@ func createDTLSConfig(ctx context.Context) (serverConfig *piondtls.Config, clien
 		ExtendedMasterSecret: piondtls.RequireExtendedMasterSecret,
 		ClientCAs:            certPool,
 		ClientAuth:           piondtls.RequireAndVerifyClientCert,
-		ConnectContextMaker: func() (context.Context, func()) {
-			return context.WithTimeout(ctx, 30*time.Second)
-		},
 	}
 
 	// client cert
@@ -136,7 +135,8 @@ func TestServer_SetContextValueWithPKI(t *testing.T) {
 
 	onNewConn := func(cc *client.ClientConn, dtlsConn *piondtls.Conn) {
 		// set connection context certificate
-		clientCert, err := x509.ParseCertificate(dtlsConn.ConnectionState().PeerCertificates[0])
+		state, _ := dtlsConn.ConnectionState()
+		clientCert, err := x509.ParseCertificate(state.PeerCertificates[0])
 		require.NoError(t, err)
 		cc.SetContextValue("client-cert", clientCert)
 	}
@@ -250,7 +250,7 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 				checkCloseWg.Done()
 			})
 		}),
-		dtls.WithKeepAlive(3, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+		dtls.WithKeepAlive(50*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
 			require.False(t, inactivityDetected)
 			inactivityDetected = true
 			cc.Close()
@@ -290,3 +290,142 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestServer_ServeTransport(t *testing.T) {
+	serverTransport, clientTransport := coapNet.NewPipe("server", "client")
+	m := mux.NewRouter()
+	err := m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	require.NoError(t, err)
+
+	s := dtls.NewServer(dtls.WithMux(m))
+	defer s.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.ServeTransport(serverTransport)
+		require.NoError(t, err)
+	}()
+
+	cc := dtls.ClientTransport(clientTransport)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, "server", cc.RemoteAddr().String())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+
+	// closed transport ends the server connection
+	err = cc.Close()
+	require.NoError(t, err)
+	<-cc.Done()
+	select {
+	case <-serverTransport.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "server transport was not closed")
+	}
+}
+
+func TestServer_ServeTransportTee(t *testing.T) {
+	serverTransport, clientTransport := coapNet.NewPipe("server", "client")
+	var m sync.Mutex
+	var mirrored [][]byte
+	audit := coapNet.MessageWriterFunc(func(ctx context.Context, data []byte) error {
+		m.Lock()
+		defer m.Unlock()
+		mirrored = append(mirrored, append([]byte(nil), data...))
+		return nil
+	})
+
+	s := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.ServeTransport(coapNet.NewTeeTransport(serverTransport, client.TeeResponses(audit)))
+		require.NoError(t, err)
+	}()
+
+	cc := dtls.ClientTransport(clientTransport)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := cc.Ping(ctx)
+	require.NoError(t, err)
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	m.Lock()
+	defer m.Unlock()
+	require.Len(t, mirrored, 1)
+	mirror := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(mirror)
+	_, err = mirror.Unmarshal(mirrored[0])
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, mirror.Code())
+	require.Equal(t, resp.Token(), mirror.Token())
+}
+
+func TestServer_DebugDump(t *testing.T) {
+	dtlsCfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	ld, err := coapNet.NewDTLSListener("udp4", "", dtlsCfg)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sd := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+	}))
+	defer sd.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := dtls.Dial(ld.Addr().String(), dtlsCfg)
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	var buf bytes.Buffer
+	err = sd.DebugDump(&buf)
+	require.NoError(t, err)
+	var snapshot dtls.DebugSnapshot
+	err = json.Unmarshal(buf.Bytes(), &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, ld.Addr().String(), snapshot.LocalAddr)
+	require.Len(t, snapshot.Sessions, 1)
+	require.NotEmpty(t, snapshot.Sessions[0].RemoteAddr)
+	require.Greater(t, snapshot.MessagePool.Acquired, uint64(0))
+}
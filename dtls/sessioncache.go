@@ -0,0 +1,55 @@
+package dtls
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/pion/dtls/v3"
+)
+
+// SessionCache is an in-memory dtls.SessionStore. A peer which lost its connection, e.g. by NAT rebinding, resumes
+// the cached session by an abbreviated handshake instead of the full one. Set it to SessionStore of dtls.Config
+// of the client and of the listener; the client caches sessions by the address and the server name of the server,
+// the server caches them by session ID.
+//
+// A connection which negotiated Connection ID (RFC 9146), see WithConnectionID, survives the change of the address
+// without resumption.
+type SessionCache struct {
+	sessions *cache.Cache
+}
+
+// NewSessionCache creates a session cache whose sessions expire after ttl.
+func NewSessionCache(ttl time.Duration) *SessionCache {
+	return &SessionCache{
+		sessions: cache.New(ttl, ttl),
+	}
+}
+
+// Set stores the session.
+func (c *SessionCache) Set(key []byte, s dtls.Session) error {
+	c.sessions.SetDefault(string(key), dtls.Session{
+		ID:     append([]byte(nil), s.ID...),
+		Secret: append([]byte(nil), s.Secret...),
+	})
+	return nil
+}
+
+// Get returns the session, or an empty session when the key is not in the cache.
+func (c *SessionCache) Get(key []byte) (dtls.Session, error) {
+	v, ok := c.sessions.Get(string(key))
+	if !ok {
+		return dtls.Session{}, nil
+	}
+	return v.(dtls.Session), nil
+}
+
+// Del removes the session, e.g. when resumption failed.
+func (c *SessionCache) Del(key []byte) error {
+	c.sessions.Delete(string(key))
+	return nil
+}
+
+// Len returns number of cached sessions.
+func (c *SessionCache) Len() int {
+	return c.sessions.ItemCount()
+}
@@ -8,9 +8,8 @@ import (
 	"fmt"
 	"log"
 	"math/big"
-	"time"
 
-	piondtls "github.com/pion/dtls/v2"
+	piondtls "github.com/pion/dtls/v3"
 	"github.com/plgd-dev/go-coap/v2/dtls"
 	"github.com/plgd-dev/go-coap/v2/examples/dtls/pki"
 	"github.com/plgd-dev/go-coap/v2/message"
@@ -21,7 +20,8 @@ import (
 )
 
 func onNewClientConn(cc *client.ClientConn, dtlsConn *piondtls.Conn) {
-	clientCert, err := x509.ParseCertificate(dtlsConn.ConnectionState().PeerCertificates[0])
+	state, _ := dtlsConn.ConnectionState()
+	clientCert, err := x509.ParseCertificate(state.PeerCertificates[0])
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -97,8 +97,5 @@ func createServerConfig(ctx context.Context) (*piondtls.Config, error) {
 		ExtendedMasterSecret: piondtls.RequireExtendedMasterSecret,
 		ClientCAs:            certPool,
 		ClientAuth:           piondtls.RequireAndVerifyClientCert,
-		ConnectContextMaker: func() (context.Context, func()) {
-			return context.WithTimeout(ctx, 30*time.Second)
-		},
 	}, nil
 }
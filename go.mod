@@ -3,12 +3,23 @@ module github.com/plgd-dev/go-coap/v2
 require (
 	github.com/dsnet/golib/memfile v0.0.0-20200723050859-c110804dfa93
 	github.com/patrickmn/go-cache v2.1.0+incompatible
-	github.com/pion/dtls/v2 v2.0.10-0.20210502094952-3dc563b9aede
+	github.com/pion/dtls/v3 v3.0.2
 	github.com/plgd-dev/kit v0.0.0-20200819113605-d5fcf3e94f63
-	github.com/stretchr/testify v1.7.0
+	github.com/stretchr/testify v1.9.0
 	go.uber.org/atomic v1.6.0
-	golang.org/x/net v0.0.0-20210502030024-e5908800b52b
-	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/crypto v0.25.0
+	golang.org/x/net v0.27.0
+	golang.org/x/sync v0.1.0
+	golang.org/x/sys v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-go 1.13
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/transport/v3 v3.0.7 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/tools v0.6.0 // indirect
+)
+
+go 1.20
@@ -0,0 +1,320 @@
+// Package linkformat implements CoRE Link Format (RFC 6690), which is used for resource discovery
+// by /.well-known/core.
+package linkformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// WellKnownCore is the path of the resource discovery (RFC 6690 section 4).
+const WellKnownCore = "/.well-known/core"
+
+// Attribute is a target attribute of a link, e.g. anchor, rel or sz.
+type Attribute struct {
+	Name string
+	// Value is empty for an attribute without value.
+	Value string
+}
+
+// Resource is a link to a resource.
+type Resource struct {
+	// Href is the target URI of the link.
+	Href string
+	// ResourceTypes are values of rt attribute.
+	ResourceTypes []string
+	// Interfaces are values of if attribute.
+	Interfaces []string
+	// ContentFormats are values of ct attribute (RFC 7252 section 7.2.1).
+	ContentFormats []message.MediaType
+	// Title is value of title attribute.
+	Title string
+	// Observable signals obs attribute (RFC 7641 section 6).
+	Observable bool
+	// Attributes are other attributes of the link.
+	Attributes []Attribute
+}
+
+// Parse parses resources in CoRE Link Format.
+func Parse(data []byte) ([]Resource, error) {
+	p := parser{data: string(data)}
+	var resources []Resource
+	p.skipSpace()
+	if p.eof() {
+		return nil, nil
+	}
+	for {
+		r, err := p.link()
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+		p.skipSpace()
+		if p.eof() {
+			return resources, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("expected ','")
+		}
+		p.skipSpace()
+	}
+}
+
+type parser struct {
+	data string
+	pos  int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid link format at %v: %v", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.eof() || p.data[p.pos] != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.data[p.pos]) {
+		p.pos++
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func (p *parser) link() (Resource, error) {
+	var r Resource
+	if !p.consume('<') {
+		return r, p.errorf("expected '<'")
+	}
+	end := strings.IndexByte(p.data[p.pos:], '>')
+	if end < 0 {
+		return r, p.errorf("expected '>'")
+	}
+	r.Href = p.data[p.pos : p.pos+end]
+	p.pos += end + 1
+	for {
+		p.skipSpace()
+		if !p.consume(';') {
+			return r, nil
+		}
+		p.skipSpace()
+		name := p.token()
+		if name == "" {
+			return r, p.errorf("expected attribute name")
+		}
+		var value string
+		p.skipSpace()
+		if p.consume('=') {
+			p.skipSpace()
+			var err error
+			value, err = p.value()
+			if err != nil {
+				return r, err
+			}
+		}
+		err := r.setAttribute(strings.ToLower(name), value)
+		if err != nil {
+			return r, p.errorf("%v", err)
+		}
+	}
+}
+
+func (p *parser) token() string {
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,;=\"<>", rune(p.data[p.pos])) {
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+func (p *parser) value() (string, error) {
+	if !p.consume('"') {
+		return p.token(), nil
+	}
+	var b strings.Builder
+	for !p.eof() {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated quoted string")
+			}
+			c = p.data[p.pos]
+			p.pos++
+		}
+		b.WriteByte(c)
+	}
+	return "", p.errorf("unterminated quoted string")
+}
+
+func (r *Resource) setAttribute(name, value string) error {
+	switch name {
+	case "rt":
+		r.ResourceTypes = append(r.ResourceTypes, strings.Fields(value)...)
+	case "if":
+		r.Interfaces = append(r.Interfaces, strings.Fields(value)...)
+	case "ct":
+		for _, v := range strings.Fields(value) {
+			ct, err := strconv.ParseUint(v, 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid ct %v", v)
+			}
+			r.ContentFormats = append(r.ContentFormats, message.MediaType(ct))
+		}
+	case "title":
+		r.Title = value
+	case "obs":
+		r.Observable = true
+	default:
+		r.Attributes = append(r.Attributes, Attribute{Name: name, Value: value})
+	}
+	return nil
+}
+
+func quote(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// String encodes the resource in CoRE Link Format.
+func (r Resource) String() string {
+	var b strings.Builder
+	b.WriteString("<" + r.Href + ">")
+	if len(r.ResourceTypes) > 0 {
+		b.WriteString(";rt=" + quote(strings.Join(r.ResourceTypes, " ")))
+	}
+	if len(r.Interfaces) > 0 {
+		b.WriteString(";if=" + quote(strings.Join(r.Interfaces, " ")))
+	}
+	switch len(r.ContentFormats) {
+	case 0:
+	case 1:
+		b.WriteString(";ct=" + strconv.FormatUint(uint64(r.ContentFormats[0]), 10))
+	default:
+		cts := make([]string, 0, len(r.ContentFormats))
+		for _, ct := range r.ContentFormats {
+			cts = append(cts, strconv.FormatUint(uint64(ct), 10))
+		}
+		b.WriteString(";ct=" + quote(strings.Join(cts, " ")))
+	}
+	if r.Title != "" {
+		b.WriteString(";title=" + quote(r.Title))
+	}
+	if r.Observable {
+		b.WriteString(";obs")
+	}
+	for _, a := range r.Attributes {
+		b.WriteString(";" + a.Name)
+		if a.Value != "" {
+			b.WriteString("=" + quote(a.Value))
+		}
+	}
+	return b.String()
+}
+
+// Encode encodes resources in CoRE Link Format.
+func Encode(resources []Resource) []byte {
+	links := make([]string, 0, len(resources))
+	for _, r := range resources {
+		links = append(links, r.String())
+	}
+	return []byte(strings.Join(links, ","))
+}
+
+// ErrInvalidQuery is returned for query without name.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Filter returns resources which match all queries, e.g. "rt=temperature", "href=/sensors/*" or "obs" (RFC 6690 section 4.1).
+// A value with trailing '*' matches values with the prefix, a query without value matches resources with the attribute.
+func Filter(resources []Resource, queries ...string) ([]Resource, error) {
+	type filter struct {
+		name, value string
+	}
+	filters := make([]filter, 0, len(queries))
+	for _, q := range queries {
+		i := strings.IndexByte(q, '=')
+		switch {
+		case q == "" || i == 0:
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, q)
+		case i < 0:
+			// attribute without value, e.g. obs
+			filters = append(filters, filter{name: strings.ToLower(q), value: "*"})
+		default:
+			filters = append(filters, filter{name: strings.ToLower(q[:i]), value: q[i+1:]})
+		}
+	}
+	matched := make([]Resource, 0, len(resources))
+	for _, r := range resources {
+		ok := true
+		for _, f := range filters {
+			if !r.match(f.name, f.value) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, r)
+		}
+	}
+	return matched, nil
+}
+
+func matchValue(pattern, value string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, pattern[:len(pattern)-1])
+	}
+	return pattern == value
+}
+
+func matchValues(pattern string, values []string) bool {
+	for _, v := range values {
+		if matchValue(pattern, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Resource) match(name, value string) bool {
+	switch name {
+	case "href":
+		return matchValue(value, r.Href)
+	case "rt":
+		return matchValues(value, r.ResourceTypes)
+	case "if":
+		return matchValues(value, r.Interfaces)
+	case "ct":
+		for _, ct := range r.ContentFormats {
+			if matchValue(value, strconv.FormatUint(uint64(ct), 10)) {
+				return true
+			}
+		}
+		return false
+	case "title":
+		return matchValue(value, r.Title)
+	case "obs":
+		return r.Observable
+	}
+	for _, a := range r.Attributes {
+		if a.Name == name && matchValue(value, a.Value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package linkformat
+
+import (
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	resources, err := Parse([]byte(`</sensors/temp>;rt="temperature-c oic.r.temperature";if=sensor;ct="0 50";obs, ` +
+		`</sensors/light>;title="Light \"Lux\"";sz=1024;anchor="/sensors";ct=50`))
+	require.NoError(t, err)
+	require.Equal(t, []Resource{
+		{
+			Href:           "/sensors/temp",
+			ResourceTypes:  []string{"temperature-c", "oic.r.temperature"},
+			Interfaces:     []string{"sensor"},
+			ContentFormats: []message.MediaType{message.TextPlain, message.AppJSON},
+			Observable:     true,
+		},
+		{
+			Href:           "/sensors/light",
+			Title:          `Light "Lux"`,
+			ContentFormats: []message.MediaType{message.AppJSON},
+			Attributes:     []Attribute{{Name: "sz", Value: "1024"}, {Name: "anchor", Value: "/sensors"}},
+		},
+	}, resources)
+
+	resources, err = Parse(nil)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+
+	for _, data := range []string{`/a`, `</a`, `</a>;`, `</a>;title="a`, `</a>;ct=text`, `</a></b>`} {
+		_, err = Parse([]byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	resources := []Resource{
+		{
+			Href:           "/sensors/temp",
+			ResourceTypes:  []string{"temperature-c"},
+			ContentFormats: []message.MediaType{message.TextPlain, message.AppJSON},
+			Observable:     true,
+		},
+		{
+			Href:           "/a",
+			Title:          `"a"`,
+			ContentFormats: []message.MediaType{message.AppJSON},
+			Attributes:     []Attribute{{Name: "sz", Value: "10"}, {Name: "x"}},
+		},
+	}
+	data := Encode(resources)
+	require.Equal(t, `</sensors/temp>;rt="temperature-c";ct="0 50";obs,</a>;ct=50;title="\"a\"";sz="10";x`, string(data))
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	require.Equal(t, resources, parsed)
+}
+
+func TestFilter(t *testing.T) {
+	resources := []Resource{
+		{Href: "/sensors/temp", ResourceTypes: []string{"temperature-c"}, Observable: true},
+		{Href: "/sensors/light", ResourceTypes: []string{"light-lux"}, ContentFormats: []message.MediaType{message.AppJSON}},
+		{Href: "/config", Attributes: []Attribute{{Name: "sz", Value: "64"}}},
+	}
+	tests := []struct {
+		queries []string
+		want    []string
+	}{
+		{want: []string{"/sensors/temp", "/sensors/light", "/config"}},
+		{queries: []string{"rt=temperature-c"}, want: []string{"/sensors/temp"}},
+		{queries: []string{"href=/sensors/*"}, want: []string{"/sensors/temp", "/sensors/light"}},
+		{queries: []string{"href=/sensors/*", "ct=50"}, want: []string{"/sensors/light"}},
+		{queries: []string{"obs"}, want: []string{"/sensors/temp"}},
+		{queries: []string{"sz=6*"}, want: []string{"/config"}},
+		{queries: []string{"rt=unknown"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		got, err := Filter(resources, tt.queries...)
+		require.NoError(t, err)
+		hrefs := make([]string, 0, len(got))
+		for _, r := range got {
+			hrefs = append(hrefs, r.Href)
+		}
+		require.Equal(t, tt.want, hrefs, tt.queries)
+	}
+	_, err := Filter(resources, "=a")
+	require.ErrorIs(t, err, ErrInvalidQuery)
+}
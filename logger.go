@@ -0,0 +1,9 @@
+package coap
+
+import (
+	"github.com/plgd-dev/go-coap/v2/net"
+)
+
+// Logger is leveled logger with structured fields, set it to servers and clients by WithLogger of udp, dtls,
+// tcp and ws.
+type Logger = net.Logger
@@ -0,0 +1,356 @@
+// Package cbor encodes and decodes CBOR (RFC 8949) data items without reflection, e.g. payload fragments
+// and option values on hot paths or in TinyGo builds. Encoders append to the buffer and decoders return
+// the rest of the data, so no intermediate values are allocated. Indefinite lengths aren't supported.
+package cbor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Major is type of the data item.
+type Major byte
+
+// Major types.
+const (
+	MajorUint   Major = 0
+	MajorNegInt Major = 1
+	MajorBytes  Major = 2
+	MajorText   Major = 3
+	MajorArray  Major = 4
+	MajorMap    Major = 5
+	MajorTag    Major = 6
+	MajorSimple Major = 7
+)
+
+const (
+	simpleFalse   = 0xf4
+	simpleTrue    = 0xf5
+	simpleNull    = 0xf6
+	simpleFloat16 = 0xf9
+	simpleFloat32 = 0xfa
+	simpleFloat64 = 0xfb
+)
+
+var (
+	// ErrTruncated is returned when the data ends inside of a data item.
+	ErrTruncated = errors.New("truncated CBOR data item")
+	// ErrUnexpectedType is returned when the data item has other major type than requested.
+	ErrUnexpectedType = errors.New("unexpected CBOR major type")
+	// ErrUnsupported is returned for indefinite lengths and reserved additional information.
+	ErrUnsupported = errors.New("unsupported CBOR additional information")
+	// ErrOverflow is returned when the value doesn't fit to the requested type.
+	ErrOverflow = errors.New("CBOR value overflows")
+)
+
+// AppendHead appends head of the data item with major type and argument n, which is the value of integers
+// or the length of strings, arrays and maps.
+func AppendHead(buf []byte, major Major, n uint64) []byte {
+	m := byte(major) << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= 0xff:
+		return append(buf, m|24, byte(n))
+	case n <= 0xffff:
+		return append(buf, m|25, byte(n>>8), byte(n))
+	case n <= 0xffffffff:
+		return append(buf, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, m|27, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// AppendUint appends unsigned integer.
+func AppendUint(buf []byte, v uint64) []byte {
+	return AppendHead(buf, MajorUint, v)
+}
+
+// AppendInt appends signed integer.
+func AppendInt(buf []byte, v int64) []byte {
+	if v < 0 {
+		return AppendHead(buf, MajorNegInt, uint64(-(v + 1)))
+	}
+	return AppendHead(buf, MajorUint, uint64(v))
+}
+
+// AppendBytes appends byte string.
+func AppendBytes(buf []byte, v []byte) []byte {
+	buf = AppendHead(buf, MajorBytes, uint64(len(v)))
+	return append(buf, v...)
+}
+
+// AppendBytesOrNull appends byte string, nil is appended as null.
+func AppendBytesOrNull(buf []byte, v []byte) []byte {
+	if v == nil {
+		return AppendNull(buf)
+	}
+	return AppendBytes(buf, v)
+}
+
+// AppendText appends text string.
+func AppendText(buf []byte, v string) []byte {
+	buf = AppendHead(buf, MajorText, uint64(len(v)))
+	return append(buf, v...)
+}
+
+// AppendArray appends head of array of n data items, which follow.
+func AppendArray(buf []byte, n int) []byte {
+	return AppendHead(buf, MajorArray, uint64(n))
+}
+
+// AppendMap appends head of map of n pairs of data items, which follow.
+func AppendMap(buf []byte, n int) []byte {
+	return AppendHead(buf, MajorMap, uint64(n))
+}
+
+// AppendBool appends true or false.
+func AppendBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, simpleTrue)
+	}
+	return append(buf, simpleFalse)
+}
+
+// AppendNull appends null.
+func AppendNull(buf []byte) []byte {
+	return append(buf, simpleNull)
+}
+
+// AppendFloat appends floating-point number, as single precision when it is exact, otherwise as double precision.
+func AppendFloat(buf []byte, v float64) []byte {
+	if f := float32(v); float64(f) == v || math.IsNaN(v) {
+		n := math.Float32bits(f)
+		return append(buf, simpleFloat32, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	n := math.Float64bits(v)
+	return append(buf, simpleFloat64, byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32), byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// ReadHead reads head of the data item. It returns major type, argument and the rest of the data.
+func ReadHead(data []byte) (Major, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, ErrTruncated
+	}
+	major, info := Major(data[0]>>5), uint64(data[0]&0x1f)
+	var n int
+	switch {
+	case info < 24:
+		return major, info, data[1:], nil
+	case info == 24:
+		n = 1
+	case info == 25:
+		n = 2
+	case info == 26:
+		n = 4
+	case info == 27:
+		n = 8
+	default:
+		return 0, 0, nil, fmt.Errorf("%w(%v)", ErrUnsupported, info)
+	}
+	if len(data) < 1+n {
+		return 0, 0, nil, ErrTruncated
+	}
+	var v uint64
+	for _, c := range data[1 : 1+n] {
+		v = v<<8 | uint64(c)
+	}
+	return major, v, data[1+n:], nil
+}
+
+func readHeadOf(data []byte, want Major) (uint64, []byte, error) {
+	major, n, rest, err := ReadHead(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if major != want {
+		return 0, nil, fmt.Errorf("%w(%v)", ErrUnexpectedType, major)
+	}
+	return n, rest, nil
+}
+
+// PeekMajor returns major type of the next data item.
+func PeekMajor(data []byte) (Major, error) {
+	if len(data) == 0 {
+		return 0, ErrTruncated
+	}
+	return Major(data[0] >> 5), nil
+}
+
+// ReadUint reads unsigned integer.
+func ReadUint(data []byte) (uint64, []byte, error) {
+	return readHeadOf(data, MajorUint)
+}
+
+// ReadInt reads unsigned or negative integer.
+func ReadInt(data []byte) (int64, []byte, error) {
+	major, n, rest, err := ReadHead(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n > math.MaxInt64 {
+		return 0, nil, ErrOverflow
+	}
+	switch major {
+	case MajorUint:
+		return int64(n), rest, nil
+	case MajorNegInt:
+		return -1 - int64(n), rest, nil
+	}
+	return 0, nil, fmt.Errorf("%w(%v)", ErrUnexpectedType, major)
+}
+
+func readString(data []byte, want Major) ([]byte, []byte, error) {
+	n, rest, err := readHeadOf(data, want)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > uint64(len(rest)) {
+		return nil, nil, ErrTruncated
+	}
+	return rest[:n], rest[n:], nil
+}
+
+// ReadBytes reads byte string. The returned value refers to the data.
+func ReadBytes(data []byte) ([]byte, []byte, error) {
+	return readString(data, MajorBytes)
+}
+
+// ReadTextBytes reads text string without allocation. The returned value refers to the data.
+func ReadTextBytes(data []byte) ([]byte, []byte, error) {
+	return readString(data, MajorText)
+}
+
+// ReadText reads text string.
+func ReadText(data []byte) (string, []byte, error) {
+	v, rest, err := readString(data, MajorText)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(v), rest, nil
+}
+
+// readLength reads head of array or map and checks the count of items fits to the rest of the data,
+// every item has at least one byte.
+func readLength(data []byte, want Major, itemsPerEntry uint64) (int, []byte, error) {
+	n, rest, err := readHeadOf(data, want)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n > uint64(len(rest))/itemsPerEntry {
+		return 0, nil, ErrTruncated
+	}
+	return int(n), rest, nil
+}
+
+// ReadArray reads head of array, it returns number of data items of the array.
+func ReadArray(data []byte) (int, []byte, error) {
+	return readLength(data, MajorArray, 1)
+}
+
+// ReadMap reads head of map, it returns number of pairs of data items of the map.
+func ReadMap(data []byte) (int, []byte, error) {
+	return readLength(data, MajorMap, 2)
+}
+
+// ReadBool reads true or false.
+func ReadBool(data []byte) (bool, []byte, error) {
+	if len(data) == 0 {
+		return false, nil, ErrTruncated
+	}
+	switch data[0] {
+	case simpleTrue:
+		return true, data[1:], nil
+	case simpleFalse:
+		return false, data[1:], nil
+	}
+	return false, nil, fmt.Errorf("%w(%v)", ErrUnexpectedType, Major(data[0]>>5))
+}
+
+// ReadNull reads null, it returns false and unchanged data when the data item isn't null.
+func ReadNull(data []byte) (bool, []byte) {
+	if len(data) > 0 && data[0] == simpleNull {
+		return true, data[1:]
+	}
+	return false, data
+}
+
+// ReadFloat reads half, single or double precision floating-point number or integer.
+func ReadFloat(data []byte) (float64, []byte, error) {
+	major, n, rest, err := ReadHead(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch major {
+	case MajorUint:
+		return float64(n), rest, nil
+	case MajorNegInt:
+		return -1 - float64(n), rest, nil
+	case MajorSimple:
+		switch data[0] {
+		case simpleFloat16:
+			return float16(uint16(n)), rest, nil
+		case simpleFloat32:
+			return float64(math.Float32frombits(uint32(n))), rest, nil
+		case simpleFloat64:
+			return math.Float64frombits(n), rest, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%w(%v)", ErrUnexpectedType, major)
+}
+
+// float16 converts half precision number to float64.
+func float16(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+// Skip skips the next data item with nested data items of arrays, maps and tags.
+func Skip(data []byte) ([]byte, error) {
+	major, n, rest, err := ReadHead(data)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case MajorBytes, MajorText:
+		if n > uint64(len(rest)) {
+			return nil, ErrTruncated
+		}
+		return rest[n:], nil
+	case MajorArray, MajorMap:
+		items := n
+		if major == MajorMap {
+			items *= 2
+		}
+		if items > uint64(len(rest)) {
+			return nil, ErrTruncated
+		}
+		for i := uint64(0); i < items; i++ {
+			rest, err = Skip(rest)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return rest, nil
+	case MajorTag:
+		return Skip(rest)
+	}
+	return rest, nil
+}
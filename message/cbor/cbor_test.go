@@ -0,0 +1,144 @@
+package cbor_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppend(t *testing.T) {
+	// examples of RFC 8949 appendix A
+	tests := []struct {
+		name string
+		buf  []byte
+		want string
+	}{
+		{name: "uint0", buf: cbor.AppendUint(nil, 0), want: "00"},
+		{name: "uint23", buf: cbor.AppendUint(nil, 23), want: "17"},
+		{name: "uint24", buf: cbor.AppendUint(nil, 24), want: "1818"},
+		{name: "uint1000", buf: cbor.AppendUint(nil, 1000), want: "1903e8"},
+		{name: "uint1000000", buf: cbor.AppendUint(nil, 1000000), want: "1a000f4240"},
+		{name: "uintMax", buf: cbor.AppendUint(nil, math.MaxUint64), want: "1bffffffffffffffff"},
+		{name: "int-1", buf: cbor.AppendInt(nil, -1), want: "20"},
+		{name: "int-1000", buf: cbor.AppendInt(nil, -1000), want: "3903e7"},
+		{name: "bytes", buf: cbor.AppendBytes(nil, []byte{1, 2, 3, 4}), want: "4401020304"},
+		{name: "text", buf: cbor.AppendText(nil, "IETF"), want: "6449455446"},
+		{name: "array", buf: cbor.AppendUint(cbor.AppendUint(cbor.AppendArray(nil, 2), 1), 2), want: "820102"},
+		{name: "map", buf: cbor.AppendUint(cbor.AppendText(cbor.AppendMap(nil, 1), "a"), 1), want: "a1616101"},
+		{name: "bool", buf: cbor.AppendBool(cbor.AppendBool(nil, false), true), want: "f4f5"},
+		{name: "null", buf: cbor.AppendBytesOrNull(nil, nil), want: "f6"},
+		{name: "float32", buf: cbor.AppendFloat(nil, 100000.0), want: "fa47c35000"},
+		{name: "float64", buf: cbor.AppendFloat(nil, 1.1), want: "fb3ff199999999999a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := hex.DecodeString(tt.want)
+			require.NoError(t, err)
+			require.Equal(t, want, tt.buf)
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	data := cbor.AppendArray(nil, 6)
+	data = cbor.AppendUint(data, 1000000)
+	data = cbor.AppendInt(data, -1000)
+	data = cbor.AppendBytes(data, []byte{1, 2})
+	data = cbor.AppendText(data, "IETF")
+	data = cbor.AppendBool(data, true)
+	data = cbor.AppendNull(data)
+
+	n, data, err := cbor.ReadArray(data)
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	u, data, err := cbor.ReadUint(data)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000000), u)
+	i, data, err := cbor.ReadInt(data)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1000), i)
+	b, data, err := cbor.ReadBytes(data)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2}, b)
+	major, err := cbor.PeekMajor(data)
+	require.NoError(t, err)
+	require.Equal(t, cbor.MajorText, major)
+	s, data, err := cbor.ReadText(data)
+	require.NoError(t, err)
+	require.Equal(t, "IETF", s)
+	v, data, err := cbor.ReadBool(data)
+	require.NoError(t, err)
+	require.True(t, v)
+	null, data := cbor.ReadNull(data)
+	require.True(t, null)
+	require.Empty(t, data)
+
+	_, _, err = cbor.ReadUint([]byte{0x19, 0x03})
+	require.True(t, errors.Is(err, cbor.ErrTruncated))
+	_, _, err = cbor.ReadUint([]byte{0x20})
+	require.True(t, errors.Is(err, cbor.ErrUnexpectedType))
+	_, _, err = cbor.ReadArray([]byte{0x9f})
+	require.True(t, errors.Is(err, cbor.ErrUnsupported))
+	_, _, err = cbor.ReadText([]byte{0x64, 'I'})
+	require.True(t, errors.Is(err, cbor.ErrTruncated))
+	_, _, err = cbor.ReadInt([]byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	require.True(t, errors.Is(err, cbor.ErrOverflow))
+}
+
+func TestReadFloat(t *testing.T) {
+	// examples of RFC 8949 appendix A
+	for data, want := range map[string]float64{
+		"f93c00":             1.0,
+		"f97bff":             65504.0,
+		"f90001":             5.960464477539063e-8,
+		"f9c400":             -4.0,
+		"fa47c35000":         100000.0,
+		"fbc010666666666666": -4.1,
+		"1864":               100,
+		"3903e7":             -1000,
+	} {
+		b, err := hex.DecodeString(data)
+		require.NoError(t, err)
+		v, rest, err := cbor.ReadFloat(b)
+		require.NoError(t, err, data)
+		require.Equal(t, want, v, data)
+		require.Empty(t, rest)
+	}
+	_, _, err := cbor.ReadFloat([]byte{0x61, 'a'})
+	require.True(t, errors.Is(err, cbor.ErrUnexpectedType))
+}
+
+func TestSkip(t *testing.T) {
+	data := cbor.AppendMap(nil, 2)
+	data = cbor.AppendText(data, "a")
+	data = cbor.AppendArray(data, 2)
+	data = cbor.AppendBytes(data, []byte{1, 2})
+	data = cbor.AppendFloat(data, 1.5)
+	data = cbor.AppendHead(data, cbor.MajorTag, 1)
+	data = cbor.AppendUint(data, 1363896240)
+	data = cbor.AppendNull(data)
+	data = cbor.AppendUint(data, 7)
+
+	rest, err := cbor.Skip(data)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x07}, rest)
+	_, err = cbor.Skip(data[:len(data)-3])
+	require.True(t, errors.Is(err, cbor.ErrTruncated))
+}
+
+func TestAllocs(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		data := cbor.AppendMap(buf[:0], 1)
+		data = cbor.AppendText(data, "href")
+		data = cbor.AppendUint(data, 1000)
+		_, data, _ = cbor.ReadMap(data)
+		_, data, _ = cbor.ReadTextBytes(data)
+		_, _, _ = cbor.ReadUint(data)
+	})
+	require.Equal(t, float64(0), allocs)
+}
@@ -3,40 +3,50 @@ package codes
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 var codeToString = map[Code]string{
-	Empty:                 "Empty",
-	GET:                   "GET",
-	POST:                  "POST",
-	PUT:                   "PUT",
-	DELETE:                "DELETE",
-	Created:               "Created",
-	Deleted:               "Deleted",
-	Valid:                 "Valid",
-	Changed:               "Changed",
-	Content:               "Content",
-	BadRequest:            "BadRequest",
-	Unauthorized:          "Unauthorized",
-	BadOption:             "BadOption",
-	Forbidden:             "Forbidden",
-	NotFound:              "NotFound",
-	MethodNotAllowed:      "MethodNotAllowed",
-	NotAcceptable:         "NotAcceptable",
-	PreconditionFailed:    "PreconditionFailed",
-	RequestEntityTooLarge: "RequestEntityTooLarge",
-	UnsupportedMediaType:  "UnsupportedMediaType",
-	InternalServerError:   "InternalServerError",
-	NotImplemented:        "NotImplemented",
-	BadGateway:            "BadGateway",
-	ServiceUnavailable:    "ServiceUnavailable",
-	GatewayTimeout:        "GatewayTimeout",
-	ProxyingNotSupported:  "ProxyingNotSupported",
-	CSM:                   "Capabilities and Settings Messages",
-	Ping:                  "Ping",
-	Pong:                  "Pong",
-	Release:               "Release",
-	Abort:                 "Abort",
+	Empty:                   "Empty",
+	GET:                     "GET",
+	POST:                    "POST",
+	PUT:                     "PUT",
+	DELETE:                  "DELETE",
+	FETCH:                   "FETCH",
+	PATCH:                   "PATCH",
+	IPATCH:                  "iPATCH",
+	Created:                 "Created",
+	Deleted:                 "Deleted",
+	Valid:                   "Valid",
+	Changed:                 "Changed",
+	Content:                 "Content",
+	Continue:                "Continue",
+	BadRequest:              "BadRequest",
+	Unauthorized:            "Unauthorized",
+	BadOption:               "BadOption",
+	Forbidden:               "Forbidden",
+	NotFound:                "NotFound",
+	MethodNotAllowed:        "MethodNotAllowed",
+	NotAcceptable:           "NotAcceptable",
+	RequestEntityIncomplete: "RequestEntityIncomplete",
+	Conflict:                "Conflict",
+	PreconditionFailed:      "PreconditionFailed",
+	RequestEntityTooLarge:   "RequestEntityTooLarge",
+	UnsupportedMediaType:    "UnsupportedMediaType",
+	UnprocessableEntity:     "UnprocessableEntity",
+	TooManyRequests:         "TooManyRequests",
+	InternalServerError:     "InternalServerError",
+	NotImplemented:          "NotImplemented",
+	BadGateway:              "BadGateway",
+	ServiceUnavailable:      "ServiceUnavailable",
+	GatewayTimeout:          "GatewayTimeout",
+	ProxyingNotSupported:    "ProxyingNotSupported",
+	HopLimitReached:         "HopLimitReached",
+	CSM:                     "Capabilities and Settings Messages",
+	Ping:                    "Ping",
+	Pong:                    "Pong",
+	Release:                 "Release",
+	Abort:                   "Abort",
 }
 
 func (c Code) String() string {
@@ -47,11 +57,76 @@ func (c Code) String() string {
 	return "Code(" + strconv.FormatInt(int64(c), 10) + ")"
 }
 
+// Class returns class of the code, e.g. 4 for 4.04 NotFound.
+func (c Code) Class() uint8 {
+	return uint8(c >> 5)
+}
+
+// Detail returns detail of the code, e.g. 4 for 4.04 NotFound.
+func (c Code) Detail() uint8 {
+	return uint8(c & 0x1f)
+}
+
+// Dotted returns the code in "c.dd" notation of RFC 7252, e.g. "4.29".
+func (c Code) Dotted() string {
+	return fmt.Sprintf("%d.%02d", c.Class(), c.Detail())
+}
+
+// IsRequest reports whether c is a request method code, class 0.
+func IsRequest(c Code) bool {
+	return c != Empty && c.Class() == 0
+}
+
+// IsSuccess reports whether c is a success response code, class 2.
+func IsSuccess(c Code) bool {
+	return c.Class() == 2
+}
+
+// IsClientError reports whether c is a client error response code, class 4.
+func IsClientError(c Code) bool {
+	return c.Class() == 4
+}
+
+// IsServerError reports whether c is a server error response code, class 5.
+func IsServerError(c Code) bool {
+	return c.Class() == 5
+}
+
+// IsError reports whether c is a client or server error response code.
+func IsError(c Code) bool {
+	return IsClientError(c) || IsServerError(c)
+}
+
+// IsSignaling reports whether c is a signaling code of CoAP over reliable transports, class 7 (RFC 8323).
+func IsSignaling(c Code) bool {
+	return c.Class() == 7
+}
+
+// ToCode returns the code of the name returned by String, e.g. "NotFound", or of the "c.dd" notation, e.g. "4.04".
 func ToCode(v string) (Code, error) {
 	for key, val := range codeToString {
 		if v == val {
 			return key, nil
 		}
 	}
+	if class, detail, ok := parseDotted(v); ok {
+		return Code(class<<5 | detail), nil
+	}
 	return 0, fmt.Errorf("not found")
 }
+
+func parseDotted(v string) (uint64, uint64, bool) {
+	i := strings.IndexByte(v, '.')
+	if i < 0 || len(v)-i-1 != 2 {
+		return 0, 0, false
+	}
+	class, err := strconv.ParseUint(v[:i], 10, 8)
+	if err != nil || class > 7 {
+		return 0, 0, false
+	}
+	detail, err := strconv.ParseUint(v[i+1:], 10, 8)
+	if err != nil || detail > 31 {
+		return 0, 0, false
+	}
+	return class, detail, true
+}
@@ -14,6 +14,9 @@ const (
 	POST   Code = 2
 	PUT    Code = 3
 	DELETE Code = 4
+	FETCH  Code = 5
+	PATCH  Code = 6
+	IPATCH Code = 7
 )
 
 // Response Codes
@@ -33,18 +36,22 @@ const (
 	MethodNotAllowed        Code = 133
 	NotAcceptable           Code = 134
 	RequestEntityIncomplete Code = 136
+	Conflict                Code = 137
 	PreconditionFailed      Code = 140
 	RequestEntityTooLarge   Code = 141
 	UnsupportedMediaType    Code = 143
+	UnprocessableEntity     Code = 150
+	TooManyRequests         Code = 157
 	InternalServerError     Code = 160
 	NotImplemented          Code = 161
 	BadGateway              Code = 162
 	ServiceUnavailable      Code = 163
 	GatewayTimeout          Code = 164
 	ProxyingNotSupported    Code = 165
+	HopLimitReached         Code = 168
 )
 
-//Signaling Codes for TCP
+// Signaling Codes for TCP
 const (
 	CSM     Code = 225
 	Ping    Code = 226
@@ -60,11 +67,15 @@ var strToCode = map[string]Code{
 	`"POST"`:                               POST,
 	`"PUT"`:                                PUT,
 	`"DELETE"`:                             DELETE,
+	`"FETCH"`:                              FETCH,
+	`"PATCH"`:                              PATCH,
+	`"iPATCH"`:                             IPATCH,
 	`"Created"`:                            Created,
 	`"Deleted"`:                            Deleted,
 	`"Valid"`:                              Valid,
 	`"Changed"`:                            Changed,
 	`"Content"`:                            Content,
+	`"Continue"`:                           Continue,
 	`"BadRequest"`:                         BadRequest,
 	`"Unauthorized"`:                       Unauthorized,
 	`"BadOption"`:                          BadOption,
@@ -72,15 +83,20 @@ var strToCode = map[string]Code{
 	`"NotFound"`:                           NotFound,
 	`"MethodNotAllowed"`:                   MethodNotAllowed,
 	`"NotAcceptable"`:                      NotAcceptable,
+	`"RequestEntityIncomplete"`:            RequestEntityIncomplete,
+	`"Conflict"`:                           Conflict,
 	`"PreconditionFailed"`:                 PreconditionFailed,
 	`"RequestEntityTooLarge"`:              RequestEntityTooLarge,
 	`"UnsupportedMediaType"`:               UnsupportedMediaType,
+	`"UnprocessableEntity"`:                UnprocessableEntity,
+	`"TooManyRequests"`:                    TooManyRequests,
 	`"InternalServerError"`:                InternalServerError,
 	`"NotImplemented"`:                     NotImplemented,
 	`"BadGateway"`:                         BadGateway,
 	`"ServiceUnavailable"`:                 ServiceUnavailable,
 	`"GatewayTimeout"`:                     GatewayTimeout,
 	`"ProxyingNotSupported"`:               ProxyingNotSupported,
+	`"HopLimitReached"`:                    HopLimitReached,
 	`"Capabilities and Settings Messages"`: CSM,
 	`"Ping"`:                               Ping,
 	`"Pong"`:                               Pong,
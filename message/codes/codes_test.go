@@ -45,3 +45,37 @@ func TestUnmarshalJSON_MarshalUnmarshal(t *testing.T) {
 		require.Equal(t, c, cUnMarshaled)
 	}
 }
+
+func TestToCode(t *testing.T) {
+	for _, c := range []Code{GET, IPATCH, Continue, Conflict, TooManyRequests, HopLimitReached, Abort} {
+		got, err := ToCode(c.String())
+		require.NoError(t, err)
+		require.Equal(t, c, got)
+		got, err = ToCode(c.Dotted())
+		require.NoError(t, err)
+		require.Equal(t, c, got)
+	}
+	require.Equal(t, "4.29", TooManyRequests.Dotted())
+	require.Equal(t, uint8(5), HopLimitReached.Class())
+	require.Equal(t, uint8(8), HopLimitReached.Detail())
+	for _, v := range []string{"", "Code(17)", "4.4", "8.00", "4.32"} {
+		_, err := ToCode(v)
+		require.Error(t, err)
+	}
+}
+
+func TestClass(t *testing.T) {
+	require.True(t, IsRequest(FETCH))
+	require.False(t, IsRequest(Empty))
+	require.True(t, IsSuccess(Content))
+	require.True(t, IsSuccess(Continue))
+	require.False(t, IsSuccess(NotFound))
+	require.True(t, IsClientError(TooManyRequests))
+	require.False(t, IsClientError(InternalServerError))
+	require.True(t, IsServerError(HopLimitReached))
+	require.True(t, IsError(BadRequest))
+	require.True(t, IsError(GatewayTimeout))
+	require.False(t, IsError(Changed))
+	require.True(t, IsSignaling(Pong))
+	require.False(t, IsSignaling(GET))
+}
@@ -0,0 +1,81 @@
+// Package echo verifies freshness of requests by Echo option (RFC 9175 section 2).
+package echo
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+const (
+	timestampLen = 8
+	macLen       = 8
+)
+
+// Verifier creates Echo values bound to the remote endpoint and verifies they were echoed within the window.
+// The values are stateless, so the verifier is safe for concurrent use and it is shared by all connections.
+type Verifier struct {
+	key    []byte
+	window time.Duration
+}
+
+// NewVerifier creates verifier with a random key, which accepts Echo values created at most window ago.
+func NewVerifier(window time.Duration) (*Verifier, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate key: %w", err)
+	}
+	return &Verifier{
+		key:    key,
+		window: window,
+	}, nil
+}
+
+func (v *Verifier) mac(timestamp []byte, remoteAddr net.Addr) []byte {
+	h := hmac.New(sha256.New, v.key)
+	h.Write(timestamp)
+	if remoteAddr != nil {
+		h.Write([]byte(remoteAddr.String()))
+	}
+	return h.Sum(nil)[:macLen]
+}
+
+// NewValue returns Echo value for the challenge of the remote endpoint.
+func (v *Verifier) NewValue(remoteAddr net.Addr) []byte {
+	return v.newValue(time.Now(), remoteAddr)
+}
+
+func (v *Verifier) newValue(now time.Time, remoteAddr net.Addr) []byte {
+	value := make([]byte, timestampLen, timestampLen+macLen)
+	binary.BigEndian.PutUint64(value, uint64(now.UnixNano()))
+	return append(value, v.mac(value, remoteAddr)...)
+}
+
+// Verify reports whether the value was created by NewValue for the remote endpoint within the window.
+func (v *Verifier) Verify(value []byte, remoteAddr net.Addr) bool {
+	if len(value) != timestampLen+macLen {
+		return false
+	}
+	if !hmac.Equal(value[timestampLen:], v.mac(value[:timestampLen], remoteAddr)) {
+		return false
+	}
+	created := time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+	age := time.Since(created)
+	return age >= 0 && age <= v.window
+}
+
+// IsUnsafe reports whether the request method changes state of the server, so its freshness is verified.
+func IsUnsafe(code codes.Code) bool {
+	switch code {
+	case codes.POST, codes.PUT, codes.DELETE, codes.PATCH, codes.IPATCH:
+		return true
+	}
+	return false
+}
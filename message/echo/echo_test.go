@@ -0,0 +1,41 @@
+package echo
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier(t *testing.T) {
+	v, err := NewVerifier(time.Minute)
+	require.NoError(t, err)
+	a := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683}
+	b := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5684}
+
+	value := v.NewValue(a)
+	require.True(t, v.Verify(value, a))
+	// the value is bound to the endpoint
+	require.False(t, v.Verify(value, b))
+	// stale value
+	require.False(t, v.Verify(v.newValue(time.Now().Add(-time.Hour), a), a))
+	// forged value
+	value[0]++
+	require.False(t, v.Verify(value, a))
+	require.False(t, v.Verify([]byte{1}, a))
+
+	other, err := NewVerifier(time.Minute)
+	require.NoError(t, err)
+	require.False(t, other.Verify(v.NewValue(a), a))
+}
+
+func TestIsUnsafe(t *testing.T) {
+	require.True(t, IsUnsafe(codes.POST))
+	require.True(t, IsUnsafe(codes.DELETE))
+	require.True(t, IsUnsafe(codes.PATCH))
+	require.True(t, IsUnsafe(codes.IPATCH))
+	require.False(t, IsUnsafe(codes.GET))
+	require.False(t, IsUnsafe(codes.FETCH))
+}
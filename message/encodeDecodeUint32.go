@@ -24,9 +24,8 @@ func EncodeUint32(buf []byte, value uint32) (int, error) {
 		if len(buf) < 3 {
 			return 3, ErrTooSmall
 		}
-		rv := make([]byte, 4)
-		binary.BigEndian.PutUint32(rv[:], value)
-		copy(buf, rv[1:])
+		buf[0] = byte(value >> 16)
+		binary.BigEndian.PutUint16(buf[1:], uint16(value))
 		return 3, nil
 	default:
 		if len(buf) < 4 {
@@ -41,8 +40,24 @@ func DecodeUint32(buf []byte) (uint32, int, error) {
 	if len(buf) > 4 {
 		buf = buf[:4]
 	}
-	tmp := []byte{0, 0, 0, 0}
-	copy(tmp[4-len(buf):], buf)
-	value := binary.BigEndian.Uint32(tmp)
+	var value uint32
+	for _, b := range buf {
+		value = value<<8 | uint32(b)
+	}
 	return value, len(buf), nil
 }
+
+// AppendUint32 appends value of uint option in the minimal big-endian encoding, zero is encoded as empty value.
+func AppendUint32(buf []byte, value uint32) []byte {
+	switch {
+	case value == 0:
+		return buf
+	case value <= max1ByteNumber:
+		return append(buf, byte(value))
+	case value <= max2ByteNumber:
+		return append(buf, byte(value>>8), byte(value))
+	case value <= max3ByteNumber:
+		return append(buf, byte(value>>16), byte(value>>8), byte(value))
+	}
+	return append(buf, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
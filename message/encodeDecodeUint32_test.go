@@ -56,6 +56,19 @@ func TestEncodeUint32(t *testing.T) {
 			require.NoError(t, err)
 			require.Equal(t, len(buf), n)
 			require.Equal(t, tt.args.value, val)
+			require.Equal(t, buf, AppendUint32([]byte{}, tt.args.value))
 		})
 	}
 }
+
+func TestEncodeUint32_Allocs(t *testing.T) {
+	buf := make([]byte, 4)
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, v := range []uint32{0, 256, 5000000, 20000000} {
+			n, _ := EncodeUint32(buf, v)
+			_, _, _ = DecodeUint32(buf[:n])
+			_ = AppendUint32(buf[:0], v)
+		}
+	})
+	require.Equal(t, float64(0), allocs)
+}
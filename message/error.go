@@ -14,4 +14,6 @@ var (
 	ErrInvalidEncoding              = errors.New("invalid encoding")
 	ErrOptionNotFound               = errors.New("option not found")
 	ErrOptionDuplicate              = errors.New("duplicated option")
+	// ErrMessageReset is returned when the peer rejects the confirmable message by RST.
+	ErrMessageReset = errors.New("message was rejected by reset")
 )
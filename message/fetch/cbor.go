@@ -0,0 +1,85 @@
+package fetch
+
+import (
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+)
+
+// CBORCodec encodes Query as CBOR map with text keys, selector with one value is a text string,
+// otherwise an array of text strings. Indefinite lengths aren't supported.
+type CBORCodec struct{}
+
+// Encode encodes the query.
+func (CBORCodec) Encode(q Query) ([]byte, error) {
+	names := q.names()
+	buf := cbor.AppendMap(make([]byte, 0, 64), len(names))
+	for _, n := range names {
+		buf = cbor.AppendText(buf, n)
+		v := q[n]
+		if len(v) == 1 {
+			buf = cbor.AppendText(buf, v[0])
+			continue
+		}
+		buf = cbor.AppendArray(buf, len(v))
+		for _, s := range v {
+			buf = cbor.AppendText(buf, s)
+		}
+	}
+	return buf, nil
+}
+
+// Decode decodes the query.
+func (CBORCodec) Decode(data []byte) (Query, error) {
+	n, data, err := cbor.ReadMap(data)
+	if err != nil {
+		return nil, err
+	}
+	q := make(Query, n)
+	for i := 0; i < n; i++ {
+		var name string
+		name, data, err = cbor.ReadText(data)
+		if err != nil {
+			return nil, err
+		}
+		var values []string
+		values, data, err = readValues(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of selector %v: %w", name, err)
+		}
+		q[name] = values
+	}
+	if len(data) > 0 {
+		return nil, fmt.Errorf("unexpected data after CBOR map")
+	}
+	return q, nil
+}
+
+// readValues reads text string or array of text strings.
+func readValues(data []byte) ([]string, []byte, error) {
+	major, err := cbor.PeekMajor(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if major == cbor.MajorText {
+		v, rest, err := cbor.ReadText(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{v}, rest, nil
+	}
+	n, rest, err := cbor.ReadArray(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var v string
+		v, rest, err = cbor.ReadText(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rest, nil
+}
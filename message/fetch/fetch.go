@@ -0,0 +1,117 @@
+// Package fetch encodes and decodes bodies of FETCH requests (RFC 8132) which select parts of a resource,
+// so clients and servers agree on the encoding of selectors for the content format of the request.
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// ErrUnsupportedContentFormat is returned when no codec is registered for the content format,
+// servers answer it by 4.15 (Unsupported Content-Format).
+var ErrUnsupportedContentFormat = errors.New("unsupported content format")
+
+// Query is the body of FETCH request which maps names of selectors to their values,
+// e.g. {"href": ["/temp", "/humidity"]}.
+type Query map[string][]string
+
+// Get returns the first value of the selector or empty string.
+func (q Query) Get(name string) string {
+	if v := q[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Add appends values to the selector.
+func (q Query) Add(name string, values ...string) {
+	q[name] = append(q[name], values...)
+}
+
+// names returns sorted names of the selectors, so the encoding is deterministic.
+func (q Query) names() []string {
+	names := make([]string, 0, len(q))
+	for n := range q {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Codec encodes Query to the body of a content format.
+type Codec interface {
+	Encode(q Query) ([]byte, error)
+	Decode(data []byte) (Query, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[message.MediaType]Codec
+}{
+	m: map[message.MediaType]Codec{
+		message.AppCBOR: CBORCodec{},
+	},
+}
+
+// Register sets codec of the content format, it replaces the registered one. CBORCodec, JSONCodec and
+// GroupCodec are registered for application/cbor, application/json and application/coap-group+json.
+// TinyGo builds have no JSON codecs, they depend on reflection.
+func Register(contentFormat message.MediaType, codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if codec == nil {
+		delete(codecs.m, contentFormat)
+		return
+	}
+	codecs.m[contentFormat] = codec
+}
+
+// Lookup returns codec of the content format.
+func Lookup(contentFormat message.MediaType) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.m[contentFormat]
+	return c, ok
+}
+
+// Encode encodes the query by codec of the content format.
+func Encode(contentFormat message.MediaType, q Query) ([]byte, error) {
+	c, ok := Lookup(contentFormat)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentFormat, contentFormat)
+	}
+	return c.Encode(q)
+}
+
+// Decode decodes the query by codec of the content format.
+func Decode(contentFormat message.MediaType, data []byte) (Query, error) {
+	c, ok := Lookup(contentFormat)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentFormat, contentFormat)
+	}
+	return c.Decode(data)
+}
+
+// ParseMessage decodes the query from the body of the request by its Content-Format.
+func ParseMessage(m *message.Message) (Query, error) {
+	cf, err := m.Options.ContentFormat()
+	if err != nil {
+		return nil, fmt.Errorf("%w: content format is not set", ErrUnsupportedContentFormat)
+	}
+	if m.Body == nil {
+		return nil, errors.New("empty body")
+	}
+	if _, err := m.Body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(cf, data)
+}
@@ -0,0 +1,101 @@
+//go:build !tinygo
+
+package fetch_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/fetch"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return data
+}
+
+func TestCodecs(t *testing.T) {
+	q := fetch.Query{"href": {"/temp", "/humidity"}, "rt": {"sensor"}}
+	tests := []struct {
+		name          string
+		contentFormat message.MediaType
+		want          []byte
+	}{
+		{
+			name:          "cbor",
+			contentFormat: message.AppCBOR,
+			// {"href": ["/temp", "/humidity"], "rt": "sensor"} with keys sorted by name
+			want: mustDecodeHex(t, "a2646872656682652f74656d70692f68756d69646974796272746673656e736f72"),
+		},
+		{
+			name:          "json",
+			contentFormat: message.AppJSON,
+			want:          []byte(`{"href":["/temp","/humidity"],"rt":"sensor"}`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := fetch.Encode(tt.contentFormat, q)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, data)
+			got, err := fetch.Decode(tt.contentFormat, data)
+			require.NoError(t, err)
+			require.Equal(t, q, got)
+			_, err = fetch.Decode(tt.contentFormat, data[:len(data)-1])
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestGroupCodec(t *testing.T) {
+	q := fetch.Query{}
+	q.Add(fetch.GroupName, "sensors.floor1.example.com")
+	q.Add(fetch.GroupAddress, "[ff15::4200:f7fe:ed37:abcd]:1234")
+	data, err := fetch.Encode(message.AppCoapGroup, q)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":"[ff15::4200:f7fe:ed37:abcd]:1234","n":"sensors.floor1.example.com"}`, string(data))
+	got, err := fetch.Decode(message.AppCoapGroup, data)
+	require.NoError(t, err)
+	require.Equal(t, "sensors.floor1.example.com", got.Get(fetch.GroupName))
+
+	q.Add(fetch.GroupName, "actuators")
+	_, err = fetch.Encode(message.AppCoapGroup, q)
+	require.Error(t, err)
+	_, err = fetch.Decode(message.AppCoapGroup, []byte(`{"x":"y"}`))
+	require.Error(t, err)
+}
+
+type textCodec struct{}
+
+func (textCodec) Encode(q fetch.Query) ([]byte, error) {
+	return []byte(q.Get("q")), nil
+}
+
+func (textCodec) Decode(data []byte) (fetch.Query, error) {
+	return fetch.Query{"q": {string(data)}}, nil
+}
+
+func TestParseMessage(t *testing.T) {
+	_, err := fetch.ParseMessage(&message.Message{
+		Options: message.Options{{ID: message.ContentFormat, Value: []byte{byte(message.TextPlain)}}},
+		Body:    bytes.NewReader([]byte("temp")),
+	})
+	require.True(t, errors.Is(err, fetch.ErrUnsupportedContentFormat))
+
+	fetch.Register(message.TextPlain, textCodec{})
+	defer fetch.Register(message.TextPlain, nil)
+	q, err := fetch.ParseMessage(&message.Message{
+		Options: message.Options{{ID: message.ContentFormat, Value: []byte{byte(message.TextPlain)}}},
+		Body:    bytes.NewReader([]byte("temp")),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "temp", q.Get("q"))
+
+	_, err = fetch.ParseMessage(&message.Message{Body: bytes.NewReader([]byte("temp"))})
+	require.True(t, errors.Is(err, fetch.ErrUnsupportedContentFormat))
+}
@@ -0,0 +1,95 @@
+//go:build !tinygo
+
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+func init() {
+	Register(message.AppJSON, JSONCodec{})
+	Register(message.AppCoapGroup, GroupCodec{})
+}
+
+// JSONCodec encodes Query as JSON object, selector with one value is a string, otherwise an array of strings.
+type JSONCodec struct{}
+
+// Encode encodes the query.
+func (JSONCodec) Encode(q Query) ([]byte, error) {
+	obj := make(map[string]interface{}, len(q))
+	for n, v := range q {
+		if len(v) == 1 {
+			obj[n] = v[0]
+			continue
+		}
+		obj[n] = v
+	}
+	return json.Marshal(obj)
+}
+
+// Decode decodes the query.
+func (JSONCodec) Decode(data []byte) (Query, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	q := make(Query, len(obj))
+	for n, raw := range obj {
+		var v string
+		if err := json.Unmarshal(raw, &v); err == nil {
+			q[n] = []string{v}
+			continue
+		}
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return nil, fmt.Errorf("invalid value of selector %v: %w", n, err)
+		}
+		q[n] = values
+	}
+	return q, nil
+}
+
+// Selectors of application/coap-group+json (RFC 7390 section 2.6.2.4).
+const (
+	// GroupName is name of the group, e.g. "sensors.floor1.example.com".
+	GroupName = "n"
+	// GroupAddress is IP multicast address of the group with optional port, e.g. "[ff15::4200:f7fe:ed37:abcd]:1234".
+	GroupAddress = "a"
+)
+
+// GroupCodec encodes Query as JSON object of application/coap-group+json, every selector has exactly one value.
+type GroupCodec struct{}
+
+// Encode encodes the query.
+func (GroupCodec) Encode(q Query) ([]byte, error) {
+	obj := make(map[string]string, len(q))
+	for n, v := range q {
+		if len(v) != 1 {
+			return nil, fmt.Errorf("selector %v has %v values", n, len(v))
+		}
+		obj[n] = v[0]
+	}
+	if obj[GroupName] == "" && obj[GroupAddress] == "" {
+		return nil, fmt.Errorf("group name or address is not set")
+	}
+	return json.Marshal(obj)
+}
+
+// Decode decodes the query.
+func (GroupCodec) Decode(data []byte) (Query, error) {
+	var obj map[string]string
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid group: %w", err)
+	}
+	if obj[GroupName] == "" && obj[GroupAddress] == "" {
+		return nil, fmt.Errorf("group name or address is not set")
+	}
+	q := make(Query, len(obj))
+	for n, v := range obj {
+		q[n] = []string{v}
+	}
+	return q, nil
+}
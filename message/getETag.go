@@ -6,12 +6,14 @@ import (
 	"io"
 )
 
+var etagTable = crc64.MakeTable(crc64.ISO)
+
 // GetETag calculate ETag from payload via CRC64
 func GetETag(r io.ReadSeeker) ([]byte, error) {
 	if r == nil {
 		return make([]byte, 8), nil
 	}
-	c64 := crc64.New(crc64.MakeTable(crc64.ISO))
+	c64 := crc64.New(etagTable)
 	orig, err := r.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return nil, err
@@ -41,3 +43,10 @@ func GetETag(r io.ReadSeeker) ([]byte, error) {
 	binary.LittleEndian.PutUint64(b, c64.Sum64())
 	return b, nil
 }
+
+// AppendETag appends ETag of the payload, it is the same as GetETag returns for the payload.
+func AppendETag(buf []byte, payload []byte) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], crc64.Checksum(payload, etagTable))
+	return append(buf, b[:]...)
+}
@@ -12,3 +12,14 @@ func TestGetETag(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte{0x54, 0x4e, 0x28, 0x79, 0x1c, 0x23, 0x17, 0x24}, got)
 }
+
+func TestAppendETag(t *testing.T) {
+	payload := []byte("hello world")
+	want, err := GetETag(bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, want, AppendETag(nil, payload))
+	require.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		var buf [8]byte
+		AppendETag(buf[:0], payload)
+	}))
+}
@@ -0,0 +1,76 @@
+package message
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Interner returns shared strings for registered option values, so getting a hot value, e.g. Path
+// of a frequently requested resource, from parsed options doesn't allocate a new string each time.
+// Values which aren't registered are converted as usual. It is safe for concurrent use.
+type Interner struct {
+	mutex  sync.Mutex
+	values atomic.Value // map[string]string
+}
+
+// NewInterner creates interner with the registered values.
+func NewInterner(values ...string) *Interner {
+	i := &Interner{}
+	i.values.Store(make(map[string]string))
+	i.Register(values...)
+	return i
+}
+
+// DefaultInterner is used by Options to get string values of URIPath, URIQuery, URIHost, LocationPath and
+// LocationQuery options. Values are matched as whole, so it contains well-known paths, their segments and
+// common queries of discovery, applications can register their own hot values.
+var DefaultInterner = NewInterner(
+	".well-known",
+	"core",
+	".well-known/core",
+	"rd",
+	"rd-lookup",
+	"rt=core.rd",
+	"rt=core.rd-lookup-res",
+	"if=oic.if.baseline",
+)
+
+// Register adds values to the interner. Registering is copy-on-write, so it is intended to be done
+// once at startup, lookups are lock-free.
+func (i *Interner) Register(values ...string) {
+	if len(values) == 0 {
+		return
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	old := i.values.Load().(map[string]string)
+	m := make(map[string]string, len(old)+len(values))
+	for k, v := range old {
+		m[k] = v
+	}
+	for _, v := range values {
+		m[v] = v
+	}
+	i.values.Store(m)
+}
+
+// Len returns number of registered values.
+func (i *Interner) Len() int {
+	return len(i.values.Load().(map[string]string))
+}
+
+// String returns the registered value equal to b without allocation or a new string when it isn't registered.
+func (i *Interner) String(b []byte) string {
+	if v, ok := i.values.Load().(map[string]string)[string(b)]; ok {
+		return v
+	}
+	return string(b)
+}
+
+func internedOption(id OptionID) bool {
+	switch id {
+	case URIPath, URIQuery, URIHost, LocationPath, LocationQuery:
+		return true
+	}
+	return false
+}
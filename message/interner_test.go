@@ -0,0 +1,37 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterner(t *testing.T) {
+	i := NewInterner("a")
+	require.Equal(t, 1, i.Len())
+	require.Equal(t, "a", i.String([]byte("a")))
+	require.Equal(t, "b", i.String([]byte("b")))
+	i.Register("b", "a")
+	require.Equal(t, 2, i.Len())
+	require.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		_ = i.String([]byte("b"))
+	}))
+}
+
+func TestInternedPath(t *testing.T) {
+	DefaultInterner.Register("sensors/temp", "unit=C")
+	options := make(Options, 0, 10)
+	buf := make([]byte, 256)
+	options, n, err := options.SetPath(buf, "/sensors/temp")
+	require.NoError(t, err)
+	options, _, err = options.AddString(buf[n:], URIQuery, "unit=C")
+	require.NoError(t, err)
+	var path string
+	queries := make([]string, 1)
+	require.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		path, _ = options.Path()
+		_, _ = options.GetStrings(URIQuery, queries)
+	}))
+	require.Equal(t, "sensors/temp", path)
+	require.Equal(t, []string{"unit=C"}, queries)
+}
@@ -4,6 +4,18 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 )
 
+// Values of NoResponse option, they can be combined (RFC 7967 section 2.1).
+const (
+	// Suppress2xx suppresses 2.xx success responses.
+	Suppress2xx uint32 = 2
+	// Suppress4xx suppresses 4.xx client error responses.
+	Suppress4xx uint32 = 8
+	// Suppress5xx suppresses 5.xx server error responses.
+	Suppress5xx uint32 = 16
+	// SuppressAll suppresses all responses.
+	SuppressAll = Suppress2xx | Suppress4xx | Suppress5xx
+)
+
 var (
 	resp2XXCodes       = []codes.Code{codes.Created, codes.Deleted, codes.Valid, codes.Changed, codes.Content}
 	resp4XXCodes       = []codes.Code{codes.BadRequest, codes.Unauthorized, codes.BadOption, codes.Forbidden, codes.NotFound, codes.MethodNotAllowed, codes.NotAcceptable, codes.PreconditionFailed, codes.RequestEntityTooLarge, codes.UnsupportedMediaType}
@@ -41,12 +53,17 @@ func decodeNoResponseOption(v uint32) []codes.Code {
 // IsNoResponseCode validates response code againts NoResponse option from request.
 // https://www.rfc-editor.org/rfc/rfc7967.txt
 func IsNoResponseCode(code codes.Code, noRespValue uint32) error {
-	suppressedCodes := decodeNoResponseOption(noRespValue)
-
-	for _, suppressedCode := range suppressedCodes {
-		if suppressedCode == code {
-			return ErrMessageNotInterested
-		}
+	if IsSuppressed(code, noRespValue) {
+		return ErrMessageNotInterested
 	}
 	return nil
 }
+
+// IsSuppressed reports whether the class of the response code is suppressed by NoResponse option value.
+func IsSuppressed(code codes.Code, noRespValue uint32) bool {
+	switch class := uint32(code) >> 5; class {
+	case 2, 4, 5:
+		return isSet(noRespValue, class-1)
+	}
+	return false
+}
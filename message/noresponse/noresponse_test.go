@@ -41,3 +41,10 @@ func TestNoResponseBehaviour(t *testing.T) {
 	err := IsNoResponseCode(codes.Content, 2)
 	require.Error(t, err)
 }
+
+func TestIsSuppressed(t *testing.T) {
+	require.True(t, IsSuppressed(codes.Continue, Suppress2xx))
+	require.True(t, IsSuppressed(codes.RequestEntityIncomplete, Suppress4xx|Suppress5xx))
+	require.False(t, IsSuppressed(codes.Content, Suppress4xx|Suppress5xx))
+	require.False(t, IsSuppressed(codes.Empty, SuppressAll))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -39,14 +40,20 @@ type OptionID uint16
    |  12 |    |   |   |   | Content-Format | uint   | 0-2    | (none)  |
    |  14 |    | x | - |   | Max-Age        | uint   | 0-4    | 60      |
    |  15 | x  | x | - | x | Uri-Query      | string | 0-255  | (none)  |
+   |  16 |    | x | - |   | Hop-Limit      | uint   | 1      | 16      |
    |  17 | x  |   |   |   | Accept         | uint   | 0-2    | (none)  |
+   |  19 | x  | x | - |   | Q-Block1       | uint   | 0-3    | (none)  |
    |  20 |    |   |   | x | Location-Query | string | 0-255  | (none)  |
+   |  21 | x  |   |   |   | EDHOC          | empty  | 0      | (none)  |
    |  23 | x  | x | - | - | Block2         | uint   | 0-3    | (none)  |
    |  27 | x  | x | - | - | Block1         | uint   | 0-3    | (none)  |
    |  28 |    |   | x |   | Size2          | uint   | 0-4    | (none)  |
+   |  31 | x  | x | - | x | Q-Block2       | uint   | 0-3    | (none)  |
    |  35 | x  | x | - |   | Proxy-Uri      | string | 1-1034 | (none)  |
    |  39 | x  | x | - |   | Proxy-Scheme   | string | 1-255  | (none)  |
    |  60 |    |   | x |   | Size1          | uint   | 0-4    | (none)  |
+   | 252 |    |   | x |   | Echo           | opaque | 1-40   | (none)  |
+   | 292 |    |   | x | x | Request-Tag    | opaque | 0-8    | (none)  |
    +-----+----+---+---+---+----------------+--------+--------+---------+
    C=Critical, U=Unsafe, N=NoCacheKey, R=Repeatable
 */
@@ -60,19 +67,26 @@ const (
 	Observe       OptionID = 6
 	URIPort       OptionID = 7
 	LocationPath  OptionID = 8
+	OSCORE        OptionID = 9
 	URIPath       OptionID = 11
 	ContentFormat OptionID = 12
 	MaxAge        OptionID = 14
 	URIQuery      OptionID = 15
+	HopLimit      OptionID = 16
 	Accept        OptionID = 17
+	QBlock1       OptionID = 19
 	LocationQuery OptionID = 20
+	EDHOC         OptionID = 21
 	Block2        OptionID = 23
 	Block1        OptionID = 27
 	Size2         OptionID = 28
+	QBlock2       OptionID = 31
 	ProxyURI      OptionID = 35
 	ProxyScheme   OptionID = 39
 	Size1         OptionID = 60
+	Echo          OptionID = 252
 	NoResponse    OptionID = 258
+	RequestTag    OptionID = 292
 )
 
 var optionIDToString = map[OptionID]string{
@@ -83,19 +97,26 @@ var optionIDToString = map[OptionID]string{
 	Observe:       "Observe",
 	URIPort:       "URIPort",
 	LocationPath:  "LocationPath",
+	OSCORE:        "OSCORE",
 	URIPath:       "URIPath",
 	ContentFormat: "ContentFormat",
 	MaxAge:        "MaxAge",
 	URIQuery:      "URIQuery",
+	HopLimit:      "HopLimit",
 	Accept:        "Accept",
+	QBlock1:       "QBlock1",
 	LocationQuery: "LocationQuery",
+	EDHOC:         "EDHOC",
 	Block2:        "Block2",
 	Block1:        "Block1",
 	Size2:         "Size2",
+	QBlock2:       "QBlock2",
 	ProxyURI:      "ProxyURI",
 	ProxyScheme:   "ProxyScheme",
 	Size1:         "Size1",
+	Echo:          "Echo",
 	NoResponse:    "NoResponse",
+	RequestTag:    "RequestTag",
 }
 
 func (o OptionID) String() string {
@@ -106,12 +127,51 @@ func (o OptionID) String() string {
 	return str
 }
 
+// optionIDToName contains names of the options registered by IANA, which differ from String.
+var optionIDToName = map[OptionID]string{
+	IfMatch:       "If-Match",
+	URIHost:       "Uri-Host",
+	IfNoneMatch:   "If-None-Match",
+	URIPort:       "Uri-Port",
+	LocationPath:  "Location-Path",
+	URIPath:       "Uri-Path",
+	ContentFormat: "Content-Format",
+	MaxAge:        "Max-Age",
+	URIQuery:      "Uri-Query",
+	HopLimit:      "Hop-Limit",
+	QBlock1:       "Q-Block1",
+	LocationQuery: "Location-Query",
+	QBlock2:       "Q-Block2",
+	ProxyURI:      "Proxy-Uri",
+	ProxyScheme:   "Proxy-Scheme",
+	NoResponse:    "No-Response",
+	RequestTag:    "Request-Tag",
+}
+
+// Name returns name of the option registered by IANA, e.g. "Uri-Path".
+func (o OptionID) Name() string {
+	if name, ok := optionIDToName[o]; ok {
+		return name
+	}
+	return o.String()
+}
+
+// ToOptionID returns the option ID of the name returned by String or Name, e.g. "URIPath" or "Uri-Path",
+// or of its number.
 func ToOptionID(v string) (OptionID, error) {
 	for key, val := range optionIDToString {
 		if val == v {
 			return key, nil
 		}
 	}
+	for key, val := range optionIDToName {
+		if val == v {
+			return key, nil
+		}
+	}
+	if id, err := strconv.ParseUint(v, 10, 16); err == nil {
+		return OptionID(id), nil
+	}
 	return 0, fmt.Errorf("not found")
 }
 
@@ -130,29 +190,39 @@ type OptionDef struct {
 	ValueFormat ValueFormat
 	MinLen      int
 	MaxLen      int
+	// Repeatable is set for options which may occur more than once in a message. Supernumerary occurrences
+	// of other options are skipped (RFC7252 section 5.4.5).
+	Repeatable bool
 }
 
 var CoapOptionDefs = map[OptionID]OptionDef{
-	IfMatch:       {ValueFormat: ValueOpaque, MinLen: 0, MaxLen: 8},
+	IfMatch:       {ValueFormat: ValueOpaque, MinLen: 0, MaxLen: 8, Repeatable: true},
 	URIHost:       {ValueFormat: ValueString, MinLen: 1, MaxLen: 255},
-	ETag:          {ValueFormat: ValueOpaque, MinLen: 1, MaxLen: 8},
+	ETag:          {ValueFormat: ValueOpaque, MinLen: 1, MaxLen: 8, Repeatable: true},
 	IfNoneMatch:   {ValueFormat: ValueEmpty, MinLen: 0, MaxLen: 0},
 	Observe:       {ValueFormat: ValueUint, MinLen: 0, MaxLen: 3},
 	URIPort:       {ValueFormat: ValueUint, MinLen: 0, MaxLen: 2},
-	LocationPath:  {ValueFormat: ValueString, MinLen: 0, MaxLen: 255},
-	URIPath:       {ValueFormat: ValueString, MinLen: 0, MaxLen: 255},
+	LocationPath:  {ValueFormat: ValueString, MinLen: 0, MaxLen: 255, Repeatable: true},
+	OSCORE:        {ValueFormat: ValueOpaque, MinLen: 0, MaxLen: 255},
+	URIPath:       {ValueFormat: ValueString, MinLen: 0, MaxLen: 255, Repeatable: true},
 	ContentFormat: {ValueFormat: ValueUint, MinLen: 0, MaxLen: 2},
 	MaxAge:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 4},
-	URIQuery:      {ValueFormat: ValueString, MinLen: 0, MaxLen: 255},
+	URIQuery:      {ValueFormat: ValueString, MinLen: 0, MaxLen: 255, Repeatable: true},
+	HopLimit:      {ValueFormat: ValueUint, MinLen: 1, MaxLen: 1},
 	Accept:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 2},
-	LocationQuery: {ValueFormat: ValueString, MinLen: 0, MaxLen: 255},
+	QBlock1:       {ValueFormat: ValueUint, MinLen: 0, MaxLen: 3},
+	LocationQuery: {ValueFormat: ValueString, MinLen: 0, MaxLen: 255, Repeatable: true},
+	EDHOC:         {ValueFormat: ValueEmpty, MinLen: 0, MaxLen: 0},
 	Block2:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 3},
 	Block1:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 3},
 	Size2:         {ValueFormat: ValueUint, MinLen: 0, MaxLen: 4},
+	QBlock2:       {ValueFormat: ValueUint, MinLen: 0, MaxLen: 3, Repeatable: true},
 	ProxyURI:      {ValueFormat: ValueString, MinLen: 1, MaxLen: 1034},
 	ProxyScheme:   {ValueFormat: ValueString, MinLen: 1, MaxLen: 255},
 	Size1:         {ValueFormat: ValueUint, MinLen: 0, MaxLen: 4},
+	Echo:          {ValueFormat: ValueOpaque, MinLen: 1, MaxLen: 40},
 	NoResponse:    {ValueFormat: ValueUint, MinLen: 0, MaxLen: 1},
+	RequestTag:    {ValueFormat: ValueOpaque, MinLen: 0, MaxLen: 8, Repeatable: true},
 }
 
 // MediaType specifies the content format of a message.
@@ -164,6 +234,7 @@ var (
 	AppCoseEncrypt0   MediaType = 16    // application/cose; cose-type="cose-encrypt0" (RFC 8152)
 	AppCoseMac0       MediaType = 17    // application/cose; cose-type="cose-mac0" (RFC 8152)
 	AppCoseSign1      MediaType = 18    // application/cose; cose-type="cose-sign1" (RFC 8152)
+	AppAceCBOR        MediaType = 19    // application/ace+cbor (RFC 9200)
 	AppLinkFormat     MediaType = 40    // application/link-format
 	AppXML            MediaType = 41    // application/xml
 	AppOctets         MediaType = 42    // application/octet-stream
@@ -173,15 +244,35 @@ var (
 	AppJSONMergePatch MediaType = 52    //application/merge-patch+json (RFC7396)
 	AppCBOR           MediaType = 60    //application/cbor (RFC 7049)
 	AppCWT            MediaType = 61    //application/cwt
+	AppMultipartCore  MediaType = 62    //application/multipart-core (RFC 8710)
 	AppCoseEncrypt    MediaType = 96    //application/cose; cose-type="cose-encrypt" (RFC 8152)
 	AppCoseMac        MediaType = 97    //application/cose; cose-type="cose-mac" (RFC 8152)
 	AppCoseSign       MediaType = 98    //application/cose; cose-type="cose-sign" (RFC 8152)
 	AppCoseKey        MediaType = 101   //application/cose-key (RFC 8152)
 	AppCoseKeySet     MediaType = 102   //application/cose-key-set (RFC 8152)
+	AppSenmlJSON      MediaType = 110   //application/senml+json (RFC 8428)
+	AppSensmlJSON     MediaType = 111   //application/sensml+json (RFC 8428)
+	AppSenmlCBOR      MediaType = 112   //application/senml+cbor (RFC 8428)
+	AppSensmlCBOR     MediaType = 113   //application/sensml+cbor (RFC 8428)
+	AppSenmlExi       MediaType = 114   //application/senml-exi (RFC 8428)
+	AppSensmlExi      MediaType = 115   //application/sensml-exi (RFC 8428)
+	AppYangDataCBOR   MediaType = 140   //application/yang-data+cbor; id=sid (RFC 9254)
 	AppCoapGroup      MediaType = 256   //coap-group+json (RFC 7390)
+	AppProblemDetails MediaType = 257   //application/concise-problem-details+cbor (RFC 9290)
+	AppMissingBlocks  MediaType = 272   //application/missing-blocks+cbor-seq (RFC 9177)
+	AppPkcs7SGK       MediaType = 280   //application/pkcs7-mime; smime-type=server-generated-key (RFC 9148)
+	AppPkcs7CertsOnly MediaType = 281   //application/pkcs7-mime; smime-type=certs-only (RFC 9148)
+	AppPkcs8          MediaType = 284   //application/pkcs8 (RFC 9148)
+	AppCsrattrs       MediaType = 285   //application/csrattrs (RFC 9148)
+	AppPkcs10         MediaType = 286   //application/pkcs10 (RFC 9148)
+	AppPkixCert       MediaType = 287   //application/pkix-cert (RFC 9148)
+	AppSenmlXML       MediaType = 310   //application/senml+xml (RFC 8428)
+	AppSensmlXML      MediaType = 311   //application/sensml+xml (RFC 8428)
+	AppTdJSON         MediaType = 432   //application/td+json
 	AppOcfCbor        MediaType = 10000 //application/vnd.ocf+cbor
 	AppLwm2mTLV       MediaType = 11542 //application/vnd.oma.lwm2m+tlv
 	AppLwm2mJSON      MediaType = 11543 //application/vnd.oma.lwm2m+json
+	AppLwm2mCBOR      MediaType = 11544 //application/vnd.oma.lwm2m+cbor
 )
 
 var mediaTypeToString = map[MediaType]string{
@@ -189,6 +280,7 @@ var mediaTypeToString = map[MediaType]string{
 	AppCoseEncrypt0:   "application/cose; cose-type=\"cose-encrypt0\" (RFC 8152)",
 	AppCoseMac0:       "application/cose; cose-type=\"cose-mac0\" (RFC 8152)",
 	AppCoseSign1:      "application/cose; cose-type=\"cose-sign1\" (RFC 8152)",
+	AppAceCBOR:        "application/ace+cbor (RFC 9200)",
 	AppLinkFormat:     "application/link-format",
 	AppXML:            "application/xml",
 	AppOctets:         "application/octet-stream",
@@ -198,15 +290,35 @@ var mediaTypeToString = map[MediaType]string{
 	AppJSONMergePatch: "application/merge-patch+json (RFC7396)",
 	AppCBOR:           "application/cbor (RFC 7049)",
 	AppCWT:            "application/cwt",
+	AppMultipartCore:  "application/multipart-core (RFC 8710)",
 	AppCoseEncrypt:    "application/cose; cose-type=\"cose-encrypt\" (RFC 8152)",
 	AppCoseMac:        "application/cose; cose-type=\"cose-mac\" (RFC 8152)",
 	AppCoseSign:       "application/cose; cose-type=\"cose-sign\" (RFC 8152)",
 	AppCoseKey:        "application/cose-key (RFC 8152)",
 	AppCoseKeySet:     "application/cose-key-set (RFC 8152)",
+	AppSenmlJSON:      "application/senml+json (RFC 8428)",
+	AppSensmlJSON:     "application/sensml+json (RFC 8428)",
+	AppSenmlCBOR:      "application/senml+cbor (RFC 8428)",
+	AppSensmlCBOR:     "application/sensml+cbor (RFC 8428)",
+	AppSenmlExi:       "application/senml-exi (RFC 8428)",
+	AppSensmlExi:      "application/sensml-exi (RFC 8428)",
+	AppYangDataCBOR:   "application/yang-data+cbor; id=sid (RFC 9254)",
 	AppCoapGroup:      "coap-group+json (RFC 7390)",
+	AppProblemDetails: "application/concise-problem-details+cbor (RFC 9290)",
+	AppMissingBlocks:  "application/missing-blocks+cbor-seq (RFC 9177)",
+	AppPkcs7SGK:       "application/pkcs7-mime; smime-type=server-generated-key (RFC 9148)",
+	AppPkcs7CertsOnly: "application/pkcs7-mime; smime-type=certs-only (RFC 9148)",
+	AppPkcs8:          "application/pkcs8 (RFC 9148)",
+	AppCsrattrs:       "application/csrattrs (RFC 9148)",
+	AppPkcs10:         "application/pkcs10 (RFC 9148)",
+	AppPkixCert:       "application/pkix-cert (RFC 9148)",
+	AppSenmlXML:       "application/senml+xml (RFC 8428)",
+	AppSensmlXML:      "application/sensml+xml (RFC 8428)",
+	AppTdJSON:         "application/td+json",
 	AppOcfCbor:        "application/vnd.ocf+cbor",
 	AppLwm2mTLV:       "application/vnd.oma.lwm2m+tlv",
 	AppLwm2mJSON:      "application/vnd.oma.lwm2m+json",
+	AppLwm2mCBOR:      "application/vnd.oma.lwm2m+cbor",
 }
 
 func (c MediaType) String() string {
@@ -217,15 +329,28 @@ func (c MediaType) String() string {
 	return str
 }
 
+// ToMediaType returns the media type of the name returned by String, with or without the reference of
+// the specification, e.g. "application/cbor (RFC 7049)" or "application/cbor", or of its number.
 func ToMediaType(v string) (MediaType, error) {
 	for key, val := range mediaTypeToString {
-		if val == v {
+		if val == v || trimReference(val) == v {
 			return key, nil
 		}
 	}
+	if mt, err := strconv.ParseUint(v, 10, 16); err == nil {
+		return MediaType(mt), nil
+	}
 	return 0, fmt.Errorf("not found")
 }
 
+// trimReference removes the reference of the specification, e.g. " (RFC 7049)", from the media type name.
+func trimReference(v string) string {
+	if i := strings.LastIndex(v, " ("); i >= 0 && strings.HasSuffix(v, ")") {
+		return v[:i]
+	}
+	return v
+}
+
 func extendOpt(opt int) (int, int) {
 	ext := 0
 	if opt >= ExtendOptionByteAddend {
@@ -2,6 +2,8 @@ package message
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestMediaType_String(t *testing.T) {
@@ -17,3 +19,25 @@ func TestOptionID_String(t *testing.T) {
 		}(OptionID(i).String())
 	}
 }
+
+func TestToOptionID(t *testing.T) {
+	for _, v := range []string{"URIPath", "Uri-Path", "11"} {
+		id, err := ToOptionID(v)
+		require.NoError(t, err)
+		require.Equal(t, URIPath, id)
+	}
+	require.Equal(t, "Hop-Limit", HopLimit.Name())
+	require.Equal(t, "ETag", ETag.Name())
+	_, err := ToOptionID("Uri-Pat")
+	require.Error(t, err)
+}
+
+func TestToMediaType(t *testing.T) {
+	for _, v := range []string{"application/senml+cbor (RFC 8428)", "application/senml+cbor", "112"} {
+		mt, err := ToMediaType(v)
+		require.NoError(t, err)
+		require.Equal(t, AppSenmlCBOR, mt)
+	}
+	_, err := ToMediaType("application/unknown")
+	require.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package message
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrOptionRegistered is returned by RegisterOption when the option ID or the name is already used.
+	ErrOptionRegistered = errors.New("option is already registered")
+	// ErrInvalidOptionDef is returned by RegisterOption for invalid format or lengths of the value.
+	ErrInvalidOptionDef = errors.New("invalid option definition")
+)
+
+// RegisterOption adds option, e.g. a vendor-specific one from the private range 65000-65535, to CoapOptionDefs, so
+// messages with it are validated by the format and lengths of the value, the option isn't classified as unknown
+// critical and String and ToOptionID know its name. Its value is accessed by getters and setters of the format,
+// e.g. Options.GetUint32. Supernumerary occurrences of an option which isn't repeatable are skipped.
+//
+// RegisterOption isn't safe for concurrent use with encoding and decoding of messages, so it should be called
+// before they start, e.g. in init of the package.
+func RegisterOption(id OptionID, name string, format ValueFormat, minLen, maxLen int, repeatable bool) error {
+	if id == 0 || name == "" {
+		return fmt.Errorf("%w: option %v without name", ErrInvalidOptionDef, uint16(id))
+	}
+	if format == ValueUnknown || format > ValueString {
+		return fmt.Errorf("%w: option %v has unknown format %v", ErrInvalidOptionDef, name, format)
+	}
+	if minLen < 0 || minLen > maxLen || (format == ValueEmpty && maxLen != 0) || (format == ValueUint && maxLen > 4) {
+		return fmt.Errorf("%w: option %v has invalid length %v-%v", ErrInvalidOptionDef, name, minLen, maxLen)
+	}
+	if _, ok := CoapOptionDefs[id]; ok {
+		return fmt.Errorf("%w: %v", ErrOptionRegistered, id)
+	}
+	if _, err := ToOptionID(name); err == nil {
+		return fmt.Errorf("%w: %v", ErrOptionRegistered, name)
+	}
+	CoapOptionDefs[id] = OptionDef{
+		ValueFormat: format,
+		MinLen:      minLen,
+		MaxLen:      maxLen,
+		Repeatable:  repeatable,
+	}
+	optionIDToString[id] = name
+	return nil
+}
+
+func (f ValueFormat) String() string {
+	switch f {
+	case ValueEmpty:
+		return "empty"
+	case ValueOpaque:
+		return "opaque"
+	case ValueUint:
+		return "uint"
+	case ValueString:
+		return "string"
+	}
+	return "ValueFormat(" + strconv.FormatInt(int64(f), 10) + ")"
+}
+
+// String formats the option by the format of its value in CoapOptionDefs, e.g. URIPath: "a" or
+// ContentFormat: 50. Values of unknown options are formatted as hex.
+func (o Option) String() string {
+	def := CoapOptionDefs[o.ID]
+	switch def.ValueFormat {
+	case ValueEmpty:
+		return o.ID.String()
+	case ValueUint:
+		if len(o.Value) <= 4 {
+			v, _, err := DecodeUint32(o.Value)
+			if err == nil {
+				return o.ID.String() + ": " + strconv.FormatUint(uint64(v), 10)
+			}
+		}
+	case ValueString:
+		return o.ID.String() + ": " + strconv.Quote(string(o.Value))
+	}
+	return o.ID.String() + ": 0x" + hex.EncodeToString(o.Value)
+}
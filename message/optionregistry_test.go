@@ -0,0 +1,65 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterOption(t *testing.T) {
+	const vendorID OptionID = 65001
+	const vendorCounter OptionID = 65004
+	defer func() {
+		delete(CoapOptionDefs, vendorID)
+		delete(CoapOptionDefs, vendorCounter)
+		delete(optionIDToString, vendorID)
+		delete(optionIDToString, vendorCounter)
+	}()
+
+	err := RegisterOption(vendorID, "Vendor-Id", ValueString, 1, 8, true)
+	require.NoError(t, err)
+	err = RegisterOption(vendorCounter, "Vendor-Counter", ValueUint, 0, 2, false)
+	require.NoError(t, err)
+	require.ErrorIs(t, RegisterOption(vendorID, "Other", ValueOpaque, 0, 8, false), ErrOptionRegistered)
+	require.ErrorIs(t, RegisterOption(65008, "Uri-Path", ValueOpaque, 0, 8, false), ErrOptionRegistered)
+	require.ErrorIs(t, RegisterOption(65008, "Other", ValueUint, 0, 8, false), ErrInvalidOptionDef)
+	require.ErrorIs(t, RegisterOption(65008, "Other", ValueUnknown, 0, 8, false), ErrInvalidOptionDef)
+
+	require.Equal(t, "Vendor-Id", vendorID.String())
+	id, err := ToOptionID("Vendor-Counter")
+	require.NoError(t, err)
+	require.Equal(t, vendorCounter, id)
+
+	buf := make([]byte, 32)
+	opts := make(Options, 0, 8)
+	opts, _, err = opts.AddString(buf, vendorID, "a")
+	require.NoError(t, err)
+	opts, _, err = opts.AddString(buf[1:], vendorID, "b")
+	require.NoError(t, err)
+	opts, _, err = opts.SetUint32(buf[2:], vendorCounter, 300)
+	require.NoError(t, err)
+	opts = opts.Add(Option{ID: vendorCounter, Value: []byte{1}})
+	opts = opts.Add(Option{ID: vendorID, Value: []byte("too long value")})
+	data := make([]byte, 64)
+	n, err := opts.Marshal(data)
+	require.NoError(t, err)
+
+	got := make(Options, 0, 8)
+	_, err = got.Unmarshal(data[:n], CoapOptionDefs)
+	require.NoError(t, err)
+	// the value which is too long and the second counter are skipped
+	require.Equal(t, Options{
+		{ID: vendorID, Value: []byte("a")},
+		{ID: vendorID, Value: []byte("b")},
+		{ID: vendorCounter, Value: []byte{1, 44}},
+	}, got)
+	v, err := got.GetUint32(vendorCounter)
+	require.NoError(t, err)
+	require.Equal(t, uint32(300), v)
+	require.Equal(t, `Vendor-Id: "a"`, got[0].String())
+	require.Equal(t, "Vendor-Counter: 300", got[2].String())
+	require.Equal(t, "Option(65010): 0x0102", Option{ID: 65010, Value: []byte{1, 2}}.String())
+
+	// the registered critical option is known to proxies
+	require.Empty(t, ClassifyProxyOptions(got, CoapOptionDefs).UnknownCritical)
+}
@@ -1,6 +1,7 @@
 package message
 
 import (
+	"math"
 	"strings"
 )
 
@@ -78,8 +79,21 @@ func (options Options) Path() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	buf = buf[:m]
-	return string(buf), nil
+	return DefaultInterner.String(buf[:m]), nil
+}
+
+// LocationPath joins Location-Path options to the path of the created resource.
+func (options Options) LocationPath() (string, error) {
+	segments := make([]string, 4)
+	n, err := options.GetStrings(LocationPath, segments)
+	if err == ErrTooSmall {
+		segments = append(segments, make([]string, n-len(segments))...)
+		n, err = options.GetStrings(LocationPath, segments)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(segments[:n], "/"), nil
 }
 
 // SetString replace's/store's string option to options.
@@ -147,6 +161,9 @@ func (options Options) GetString(id OptionID) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if internedOption(id) {
+		return DefaultInterner.String(options[firstIdx].Value), nil
+	}
 	return string(options[firstIdx].Value), nil
 }
 
@@ -196,9 +213,14 @@ func (options Options) GetStrings(id OptionID, r []string) (int, error) {
 	if len(r) < lastIdx-firstIdx {
 		return lastIdx - firstIdx, ErrTooSmall
 	}
+	interned := internedOption(id)
 	var idx int
 	for i := firstIdx; i < lastIdx; i++ {
-		r[idx] = string(options[i].Value)
+		if interned {
+			r[idx] = DefaultInterner.String(options[i].Value)
+		} else {
+			r[idx] = string(options[i].Value)
+		}
 		idx++
 	}
 
@@ -471,6 +493,7 @@ func (options Options) Marshal(buf []byte) (int, error) {
 // Unmarshal unmarshal's data bytes to options and returns number of consumned byte's.
 func (options *Options) Unmarshal(data []byte, optionDefs map[OptionID]OptionDef) (int, error) {
 	prev := 0
+	var last OptionID
 	processed := 0
 	for len(data) > 0 {
 		if data[0] == 0xff {
@@ -505,6 +528,9 @@ func (options *Options) Unmarshal(data []byte, optionDefs map[OptionID]OptionDef
 			return -1, ErrOptionTruncated
 		}
 
+		if prev+delta > math.MaxUint16 {
+			return -1, ErrInvalidOptionHeaderExt
+		}
 		option := Option{}
 		oid := OptionID(prev + delta)
 		proc, err = option.Unmarshal(data[:length], optionDefs, oid)
@@ -512,11 +538,16 @@ func (options *Options) Unmarshal(data []byte, optionDefs map[OptionID]OptionDef
 			return -1, err
 		}
 
-		if cap(*options) == len(*options) {
-			return -1, ErrOptionsTooSmall
+		if option.ID != 0 && option.ID == last && !isRepeatable(optionDefs, option.ID) {
+			// Skip supernumerary occurrences (RFC7252 section 5.4.5)
+			option.ID = 0
 		}
 		if option.ID != 0 {
+			if cap(*options) == len(*options) {
+				return -1, ErrOptionsTooSmall
+			}
 			(*options) = append(*options, option)
+			last = option.ID
 		}
 
 		processed += proc
@@ -527,6 +558,12 @@ func (options *Options) Unmarshal(data []byte, optionDefs map[OptionID]OptionDef
 	return processed, nil
 }
 
+// isRepeatable reports whether the option may occur more than once, options missing in optionDefs are.
+func isRepeatable(optionDefs map[OptionID]OptionDef, id OptionID) bool {
+	def, ok := optionDefs[id]
+	return !ok || def.Repeatable
+}
+
 // ResetOptionsTo reset's options to in options.
 //
 // Return's modified options, number of used buf bytes and error if occurs.
@@ -241,6 +241,21 @@ func TestPathOption(t *testing.T) {
 	}
 }
 
+func TestLocationPathOption(t *testing.T) {
+	opts := Options{
+		{ID: LocationPath, Value: []byte("rd")},
+		{ID: LocationPath, Value: []byte("a")},
+		{ID: LocationPath, Value: []byte("b")},
+		{ID: LocationPath, Value: []byte("c")},
+		{ID: LocationPath, Value: []byte("d")},
+	}
+	path, err := opts.LocationPath()
+	require.NoError(t, err)
+	require.Equal(t, "rd/a/b/c/d", path)
+	_, err = Options{}.LocationPath()
+	require.ErrorIs(t, err, ErrOptionNotFound)
+}
+
 func TestQueryOption(t *testing.T) {
 	v := "if=oic.if.baseline"
 	buf := make([]byte, len(v))
@@ -250,6 +265,14 @@ func TestQueryOption(t *testing.T) {
 	require.True(t, opts.HasOption(URIQuery))
 }
 
+func TestUnmarshalOptionIDOverflow(t *testing.T) {
+	// the second delta moves ID of the option beyond 65535
+	data := []byte{0xe2, 0xe2, 0x30, 0x30, 0x30, 0xe2, 0x30, 0x30, 0x30, 0x30}
+	options := make(Options, 0, len(data))
+	_, err := options.Unmarshal(data, CoapOptionDefs)
+	require.ErrorIs(t, err, ErrInvalidOptionHeaderExt)
+}
+
 func BenchmarkPathOption(b *testing.B) {
 	buf := make([]byte, 256)
 	b.ResetTimer()
@@ -0,0 +1,59 @@
+package message
+
+import "fmt"
+
+// ParserLimit identifies the limit of ParserLimits which was exceeded.
+type ParserLimit string
+
+const (
+	LimitOptions   ParserLimit = "options"
+	LimitOptionLen ParserLimit = "option length"
+	LimitTokenLen  ParserLimit = "token length"
+	LimitPayload   ParserLimit = "payload"
+)
+
+// ParserLimits bound received messages independently of the max message size, e.g. for internet-facing
+// servers. Zero or negative value disables the limit.
+type ParserLimits struct {
+	// MaxOptions is the maximal number of options.
+	MaxOptions int
+	// MaxOptionLen is the maximal length of an option value.
+	MaxOptionLen int
+	// MaxTokenLen is the maximal length of the token.
+	MaxTokenLen int
+	// MaxPayload is the maximal length of the payload.
+	MaxPayload int
+}
+
+// ParserLimitError is returned by unmarshaling of a message which exceeds ParserLimits. The message is decoded
+// anyway, so a server can answer the request by 4.13 (Request Entity Too Large) or drop it.
+type ParserLimitError struct {
+	Limit ParserLimit
+	Value int
+	Max   int
+}
+
+func (e *ParserLimitError) Error() string {
+	return fmt.Sprintf("%v(%v) exceeds limit %v", e.Limit, e.Value, e.Max)
+}
+
+// Check returns ParserLimitError when the token, options or payload of a message exceed the limits.
+func (l ParserLimits) Check(token []byte, options Options, payload []byte) error {
+	if l.MaxTokenLen > 0 && len(token) > l.MaxTokenLen {
+		return &ParserLimitError{Limit: LimitTokenLen, Value: len(token), Max: l.MaxTokenLen}
+	}
+	if l.MaxOptions > 0 && len(options) > l.MaxOptions {
+		return &ParserLimitError{Limit: LimitOptions, Value: len(options), Max: l.MaxOptions}
+	}
+	if l.MaxOptionLen > 0 {
+		for _, o := range options {
+			if len(o.Value) > l.MaxOptionLen {
+				return &ParserLimitError{Limit: LimitOptionLen, Value: len(o.Value), Max: l.MaxOptionLen}
+			}
+		}
+	}
+	if l.MaxPayload > 0 && len(payload) > l.MaxPayload {
+		return &ParserLimitError{Limit: LimitPayload, Value: len(payload), Max: l.MaxPayload}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserLimitsCheck(t *testing.T) {
+	opts := Options{
+		{ID: URIPath, Value: []byte("a")},
+		{ID: URIQuery, Value: []byte("0123456789")},
+	}
+	tests := []struct {
+		name   string
+		limits ParserLimits
+		want   ParserLimit
+	}{
+		{name: "unlimited"},
+		{name: "within", limits: ParserLimits{MaxOptions: 2, MaxOptionLen: 10, MaxTokenLen: 4, MaxPayload: 5}},
+		{name: "options", limits: ParserLimits{MaxOptions: 1}, want: LimitOptions},
+		{name: "optionLen", limits: ParserLimits{MaxOptionLen: 9}, want: LimitOptionLen},
+		{name: "token", limits: ParserLimits{MaxTokenLen: 3}, want: LimitTokenLen},
+		{name: "payload", limits: ParserLimits{MaxPayload: 4}, want: LimitPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check([]byte("tokn"), opts, []byte("hello"))
+			if tt.want == "" {
+				require.NoError(t, err)
+				return
+			}
+			var limitErr *ParserLimitError
+			require.ErrorAs(t, err, &limitErr)
+			require.Equal(t, tt.want, limitErr.Limit)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package pool
+
+import (
+	"runtime"
+)
+
+// Allocation describes memory allocated by a message pool or pooled message.
+type Allocation struct {
+	// What identifies the allocated object, e.g. "message", "options" or "body".
+	What string
+	// Size is number of allocated bytes of a buffer. It is zero for messages.
+	Size int
+	// Stack is stack trace of goroutine which caused the allocation.
+	Stack string
+}
+
+// AllocationFunc is called for every allocation reported by the pool. It must not block.
+type AllocationFunc = func(a Allocation)
+
+type allocationAudit struct {
+	onAlloc AllocationFunc
+}
+
+// SetAllocationAudit calls onAlloc for every allocation made by the pool or by messages created
+// via NewMessage of the instrumentation. In the steady state a pool shouldn't allocate at all,
+// so each reported allocation points to an exchange which doesn't fit into pooled buffers.
+// Recording stacks is expensive, so it is meant for debugging. Nil onAlloc disables the audit.
+func (i *Instrumentation) SetAllocationAudit(onAlloc AllocationFunc) {
+	i.allocationAudit.Store(allocationAudit{
+		onAlloc: onAlloc,
+	})
+}
+
+// OnAllocation must be called by the pool when it allocates a buffer of size bytes for what.
+func (i *Instrumentation) OnAllocation(what string, size int) {
+	a, _ := i.allocationAudit.Load().(allocationAudit)
+	if a.onAlloc == nil {
+		return
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	a.onAlloc(Allocation{
+		What:  what,
+		Size:  size,
+		Stack: string(buf),
+	})
+}
+
+// NewMessage creates message which reports growth of its buffers to the instrumentation.
+func (i *Instrumentation) NewMessage() *Message {
+	r := NewMessage()
+	r.instrumentation = i
+	return r
+}
@@ -0,0 +1,103 @@
+package pool
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// bodyStreamWindow is number of the most recently consumed bytes kept by a body stream, so the last sent block
+// can be sent again.
+const bodyStreamWindow = 64 * 1024
+
+// ErrBodyStreamSeek is returned when a body stream is read before its already consumed part.
+var ErrBodyStreamSeek = errors.New("cannot read already consumed part of body stream")
+
+// bodyStream is a body of known size which consumes the underlying reader sequentially, as the body is sent
+// block by block. Seeking only moves the position, reading before the consumed part fails unless it is kept
+// in the window of the most recently consumed bytes.
+type bodyStream struct {
+	r    io.Reader
+	size int64
+	// pos is position of the next read
+	pos int64
+	// consumed is number of bytes read from r
+	consumed int64
+	// window holds bytes of r from windowStart up to consumed
+	window      []byte
+	windowStart int64
+}
+
+func (s *bodyStream) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if s.pos < s.consumed {
+		if s.pos < s.windowStart {
+			return 0, ErrBodyStreamSeek
+		}
+		n := copy(p, s.window[s.pos-s.windowStart:])
+		s.pos += int64(n)
+		return n, nil
+	}
+	if s.pos > s.consumed {
+		n, err := io.CopyN(ioutil.Discard, s.r, s.pos-s.consumed)
+		s.consumed += n
+		s.window = s.window[:0]
+		s.windowStart = s.consumed
+		if err != nil {
+			return 0, s.unexpectedEOF(err)
+		}
+	}
+	if rest := s.size - s.pos; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := s.r.Read(p)
+	s.consumed += int64(n)
+	s.pos += int64(n)
+	s.keep(p[:n])
+	if err != nil && (err != io.EOF || s.pos < s.size) {
+		return n, s.unexpectedEOF(err)
+	}
+	return n, nil
+}
+
+// keep appends the read data to the window and drops the oldest bytes over bodyStreamWindow.
+func (s *bodyStream) keep(data []byte) {
+	if len(data) >= bodyStreamWindow {
+		s.window = append(s.window[:0], data[len(data)-bodyStreamWindow:]...)
+		s.windowStart = s.consumed - bodyStreamWindow
+		return
+	}
+	if drop := len(s.window) + len(data) - bodyStreamWindow; drop > 0 {
+		s.window = append(s.window[:0], s.window[drop:]...)
+		s.windowStart += int64(drop)
+	}
+	s.window = append(s.window, data...)
+}
+
+func (s *bodyStream) unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (s *bodyStream) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = s.pos + offset
+	case io.SeekEnd:
+		abs = s.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.pos = abs
+	return abs, nil
+}
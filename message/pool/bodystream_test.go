@@ -0,0 +1,50 @@
+package pool
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_SetBodyStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 2*bodyStreamWindow/16)
+	m := NewMessage()
+	m.SetBodyStream(struct{ io.Reader }{bytes.NewReader(payload)}, int64(len(payload)))
+	require.True(t, m.IsBodyStream())
+	size, err := m.BodySize()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(payload)), size)
+
+	// blocks are read in order
+	buf := make([]byte, 1024)
+	for _, off := range []int64{0, 1024, 3 * 1024} {
+		_, err = m.Body().Seek(off, io.SeekStart)
+		require.NoError(t, err)
+		_, err = io.ReadFull(m.Body(), buf)
+		require.NoError(t, err)
+		require.Equal(t, payload[off:off+1024], buf)
+	}
+	// the last block is sent again
+	_, err = m.Body().Seek(3*1024, io.SeekStart)
+	require.NoError(t, err)
+	_, err = io.ReadFull(m.Body(), buf)
+	require.NoError(t, err)
+	require.Equal(t, payload[3*1024:4*1024], buf)
+
+	rest, err := ioutil.ReadAll(m.Body())
+	require.NoError(t, err)
+	require.Equal(t, payload[4*1024:], rest)
+
+	// the beginning is out of the window
+	_, err = m.Body().Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	_, err = m.Body().Read(buf)
+	require.ErrorIs(t, err, ErrBodyStreamSeek)
+
+	m.SetBodyStream(bytes.NewReader(payload[:10]), 20)
+	_, err = m.ReadBody()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
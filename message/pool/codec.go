@@ -0,0 +1,12 @@
+package pool
+
+// Codec converts message from and to wire format of its transport. Messages of udp and tcp pools implement it,
+// so code which only moves messages between buffers and connections doesn't depend on the transport.
+type Codec interface {
+	// Size returns length of the marshaled message.
+	Size() (int, error)
+	// Marshal returns the marshaled message. The data is valid until the message is modified or released.
+	Marshal() ([]byte, error)
+	// Unmarshal decodes data to the message and returns number of consumed bytes.
+	Unmarshal(data []byte) (int, error)
+}
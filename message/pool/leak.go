@@ -0,0 +1,140 @@
+package pool
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Leak describes a message which is held longer than the threshold.
+type Leak struct {
+	// AcquiredAt is time when the message was acquired.
+	AcquiredAt time.Time
+	// HeldFor is duration since the message was acquired.
+	HeldFor time.Duration
+	// Stack is stack trace of goroutine which acquired the message.
+	Stack string
+}
+
+// LeakFunc is called with messages held longer than the threshold, the oldest first.
+type LeakFunc = func(leaks []Leak)
+
+type acquiredMessage struct {
+	acquiredAt time.Time
+	stack      []byte
+}
+
+type leakDetector struct {
+	mutex    sync.Mutex
+	acquired map[interface{}]acquiredMessage
+}
+
+func (d *leakDetector) track(msg interface{}) {
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.acquired[msg] = acquiredMessage{
+		acquiredAt: time.Now(),
+		stack:      buf,
+	}
+}
+
+func (d *leakDetector) untrack(msg interface{}) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.acquired, msg)
+}
+
+func (d *leakDetector) leaks(threshold time.Duration) []Leak {
+	now := time.Now()
+	d.mutex.Lock()
+	leaks := make([]Leak, 0, 4)
+	for _, m := range d.acquired {
+		heldFor := now.Sub(m.acquiredAt)
+		if heldFor < threshold {
+			continue
+		}
+		leaks = append(leaks, Leak{
+			AcquiredAt: m.acquiredAt,
+			HeldFor:    heldFor,
+			Stack:      string(m.stack),
+		})
+	}
+	d.mutex.Unlock()
+	sort.Slice(leaks, func(i, j int) bool {
+		return leaks[i].AcquiredAt.Before(leaks[j].AcquiredAt)
+	})
+	return leaks
+}
+
+// defaultLeakCheckInterval is used when neither interval nor threshold of leak detection is positive.
+const defaultLeakCheckInterval = time.Second
+
+// EnableLeakDetection records acquisition stack of every tracked message and every interval reports
+// messages which are held longer than threshold. Recording stacks is expensive, so it is meant for debugging.
+// When interval isn't positive, messages are checked every threshold, or every second when threshold isn't
+// positive too. It returns function which stops the detection.
+func (i *Instrumentation) EnableLeakDetection(threshold, interval time.Duration, onLeak LeakFunc) func() {
+	if interval <= 0 {
+		interval = threshold
+	}
+	if interval <= 0 {
+		interval = defaultLeakCheckInterval
+	}
+	d := &leakDetector{
+		acquired: make(map[interface{}]acquiredMessage),
+	}
+	i.leakDetector.Store(d)
+	atomic.StoreUint32(&i.leakDetection, 1)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				leaks := d.leaks(threshold)
+				if len(leaks) > 0 {
+					onLeak(leaks)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if cur, _ := i.leakDetector.Load().(*leakDetector); cur == d {
+				atomic.StoreUint32(&i.leakDetection, 0)
+			}
+			close(done)
+		})
+	}
+}
+
+func (i *Instrumentation) getLeakDetector() *leakDetector {
+	if atomic.LoadUint32(&i.leakDetection) == 0 {
+		return nil
+	}
+	d, _ := i.leakDetector.Load().(*leakDetector)
+	return d
+}
+
+// Track records acquisition of msg when leak detection is enabled.
+func (i *Instrumentation) Track(msg interface{}) {
+	if d := i.getLeakDetector(); d != nil {
+		d.track(msg)
+	}
+}
+
+// Untrack removes msg from leak detection.
+func (i *Instrumentation) Untrack(msg interface{}) {
+	if d := i.getLeakDetector(); d != nil {
+		d.untrack(msg)
+	}
+}
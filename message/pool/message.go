@@ -17,11 +17,14 @@ type Message struct {
 	msg             message.Message
 	valueBuffer     []byte
 	origValueBuffer []byte
+	tokenBuffer     []byte
 
 	payload    io.ReadSeeker
 	sequence   uint64
 	hijacked   uint32
 	isModified bool
+
+	instrumentation *Instrumentation
 }
 
 func NewMessage() *Message {
@@ -32,9 +35,21 @@ func NewMessage() *Message {
 		},
 		valueBuffer:     valueBuffer,
 		origValueBuffer: valueBuffer,
+		tokenBuffer:     make([]byte, 0, 8),
 	}
 }
 
+func (r *Message) onAllocation(what string, size int) {
+	if r.instrumentation != nil {
+		r.instrumentation.OnAllocation(what, size)
+	}
+}
+
+func (r *Message) growValueBuffer(n int) {
+	r.valueBuffer = append(r.valueBuffer, make([]byte, n)...)
+	r.onAllocation("options", cap(r.valueBuffer))
+}
+
 // Reset clear message for next reuse
 func (r *Message) Reset() {
 	r.msg.Token = nil
@@ -72,13 +87,23 @@ func (r *Message) SetToken(token message.Token) {
 		r.msg.Token = nil
 		return
 	}
-	r.msg.Token = append(r.msg.Token[:0], token...)
+	if cap(r.tokenBuffer) < len(token) {
+		r.onAllocation("token", len(token))
+	}
+	r.tokenBuffer = append(r.tokenBuffer[:0], token...)
+	r.msg.Token = r.tokenBuffer
+}
+
+// TokenView returns token without copying. The returned token is valid only until the token
+// is changed or the message is released.
+func (r *Message) TokenView() message.Token {
+	return r.msg.Token
 }
 
 func (r *Message) ResetOptionsTo(in message.Options) {
 	opts, used, err := r.msg.Options.ResetOptionsTo(r.valueBuffer, in)
 	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
+		r.growValueBuffer(used)
 		opts, used, err = r.msg.Options.ResetOptionsTo(r.valueBuffer, in)
 	}
 	r.msg.Options = opts
@@ -96,7 +121,7 @@ func (r *Message) SetPath(p string) {
 	opts, used, err := r.msg.Options.SetPath(r.valueBuffer, p)
 
 	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
+		r.growValueBuffer(used)
 		opts, used, err = r.msg.Options.SetPath(r.valueBuffer, p)
 	}
 	r.msg.Options = opts
@@ -132,7 +157,7 @@ func (r *Message) GetOptionUint32(id message.OptionID) (uint32, error) {
 func (r *Message) SetOptionString(opt message.OptionID, value string) {
 	opts, used, err := r.msg.Options.SetString(r.valueBuffer, opt, value)
 	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
+		r.growValueBuffer(used)
 		opts, used, err = r.msg.Options.SetString(r.valueBuffer, opt, value)
 	}
 	r.msg.Options = opts
@@ -143,7 +168,7 @@ func (r *Message) SetOptionString(opt message.OptionID, value string) {
 func (r *Message) AddOptionString(opt message.OptionID, value string) {
 	opts, used, err := r.msg.Options.AddString(r.valueBuffer, opt, value)
 	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
+		r.growValueBuffer(used)
 		opts, used, err = r.msg.Options.AddString(r.valueBuffer, opt, value)
 	}
 	r.msg.Options = opts
@@ -153,7 +178,7 @@ func (r *Message) AddOptionString(opt message.OptionID, value string) {
 
 func (r *Message) AddOptionBytes(opt message.OptionID, value []byte) {
 	if len(r.valueBuffer) < len(value) {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, len(value)-len(r.valueBuffer))...)
+		r.growValueBuffer(len(value) - len(r.valueBuffer))
 	}
 	n := copy(r.valueBuffer, value)
 	v := r.valueBuffer[:n]
@@ -164,7 +189,7 @@ func (r *Message) AddOptionBytes(opt message.OptionID, value []byte) {
 
 func (r *Message) SetOptionBytes(opt message.OptionID, value []byte) {
 	if len(r.valueBuffer) < len(value) {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, len(value)-len(r.valueBuffer))...)
+		r.growValueBuffer(len(value) - len(r.valueBuffer))
 	}
 	n := copy(r.valueBuffer, value)
 	v := r.valueBuffer[:n]
@@ -180,7 +205,7 @@ func (r *Message) GetOptionBytes(id message.OptionID) ([]byte, error) {
 func (r *Message) SetOptionUint32(opt message.OptionID, value uint32) {
 	opts, used, err := r.msg.Options.SetUint32(r.valueBuffer, opt, value)
 	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
+		r.growValueBuffer(used)
 		opts, used, err = r.msg.Options.SetUint32(r.valueBuffer, opt, value)
 	}
 	r.msg.Options = opts
@@ -191,7 +216,7 @@ func (r *Message) SetOptionUint32(opt message.OptionID, value uint32) {
 func (r *Message) AddOptionUint32(opt message.OptionID, value uint32) {
 	opts, used, err := r.msg.Options.AddUint32(r.valueBuffer, opt, value)
 	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
+		r.growValueBuffer(used)
 		opts, used, err = r.msg.Options.AddUint32(r.valueBuffer, opt, value)
 	}
 	r.msg.Options = opts
@@ -220,6 +245,17 @@ func (r *Message) Observe() (uint32, error) {
 	return r.GetOptionUint32(message.Observe)
 }
 
+// SetNoResponse sets NoResponse option, e.g. noresponse.SuppressAll, so the server suppresses
+// responses of the classes (RFC 7967).
+func (r *Message) SetNoResponse(v uint32) {
+	r.SetOptionUint32(message.NoResponse, v)
+}
+
+// NoResponse gets NoResponse option.
+func (r *Message) NoResponse() (uint32, error) {
+	return r.GetOptionUint32(message.NoResponse)
+}
+
 // SetAccept set's accept option.
 func (r *Message) SetAccept(contentFormat message.MediaType) {
 	r.SetOptionUint32(message.Accept, uint32(contentFormat))
@@ -263,6 +299,19 @@ func (r *Message) SetBody(s io.ReadSeeker) {
 	r.isModified = true
 }
 
+// SetBodyStream sets body of the given size which is consumed from r as the message is sent, block by block
+// for the blockwise transfer and chunk by chunk over TCP, so the body doesn't need to be kept in memory. The body
+// is read once, so a block which was sent before the most recent ones cannot be sent again.
+func (r *Message) SetBodyStream(s io.Reader, size int64) {
+	r.SetBody(&bodyStream{r: s, size: size})
+}
+
+// IsBodyStream reports whether the body was set by SetBodyStream.
+func (r *Message) IsBodyStream() bool {
+	_, ok := r.payload.(*bodyStream)
+	return ok
+}
+
 func (r *Message) Body() io.ReadSeeker {
 	return r.payload
 }
@@ -314,6 +363,7 @@ func (r *Message) ReadBody() ([]byte, error) {
 	if int64(len(payload)) < size {
 		payload = make([]byte, size)
 	}
+	r.onAllocation("body", len(payload))
 	n, err := io.ReadFull(r.Body(), payload)
 	if (err == io.ErrUnexpectedEOF || err == io.EOF) && int64(n) == size {
 		err = nil
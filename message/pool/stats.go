@@ -0,0 +1,185 @@
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stats contains usage statistics of a message pool.
+type Stats struct {
+	// Acquired is number of acquired messages.
+	Acquired uint64
+	// Released is number of released messages.
+	Released uint64
+	// Allocated is number of acquisitions which were not satisfied by the pool and allocated a new message.
+	Allocated uint64
+	// InUse is number of messages which were acquired and not released yet.
+	InUse int64
+	// MissRate is ratio of allocations to acquisitions in the last finished window.
+	MissRate float64
+	// Hits is number of acquisitions satisfied by the pool, Allocated are the misses.
+	Hits uint64
+	// Pooled is number of released messages kept by the pool for reuse. Pools of sync.Pool count messages
+	// freed by the garbage collector until they are acquired again.
+	Pooled int64
+	// Discarded is number of released messages dropped because the pool was full.
+	Discarded uint64
+	// Oversized is number of buffers of released messages dropped because they exceeded the buffer limit
+	// of the pool.
+	Oversized uint64
+}
+
+// WatermarkFunc is called when usage of the pool crosses the watermark. It must not block.
+type WatermarkFunc = func(stats Stats)
+
+type occupancyWatermark struct {
+	watermark int64
+	onCross   WatermarkFunc
+}
+
+type missRateWatermark struct {
+	watermark float64
+	window    uint64
+	onCross   WatermarkFunc
+}
+
+// Instrumentation counts acquisitions and releases of a message pool and notifies
+// when watermarks are crossed.
+//
+// Multiple goroutines may invoke methods on an Instrumentation simultaneously.
+type Instrumentation struct {
+	// These fields need to be the first in the struct to ensure proper word alignment on 32-bit platforms.
+	// See: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	acquired        uint64
+	released        uint64
+	allocated       uint64
+	windowAcquired  uint64
+	windowAllocated uint64
+	missRate        atomic.Value
+
+	occupancyCrossed uint32
+	missRateCrossed  uint32
+	leakDetection    uint32
+
+	occupancy   atomic.Value
+	missRateWin atomic.Value
+	windowMutex sync.Mutex
+
+	leakDetector    atomic.Value
+	allocationAudit atomic.Value
+}
+
+// NewInstrumentation creates instrumentation without watermarks.
+func NewInstrumentation() *Instrumentation {
+	i := &Instrumentation{}
+	i.missRate.Store(float64(0))
+	i.occupancy.Store(occupancyWatermark{})
+	i.missRateWin.Store(missRateWatermark{})
+	return i
+}
+
+// SetOccupancyWatermark sets the number of messages in use which calls onCross when it is reached.
+// onCross is called again only after the number of messages in use drops below the watermark.
+// Zero watermark or nil onCross disables the watermark.
+func (i *Instrumentation) SetOccupancyWatermark(watermark int64, onCross WatermarkFunc) {
+	atomic.StoreUint32(&i.occupancyCrossed, 0)
+	i.occupancy.Store(occupancyWatermark{
+		watermark: watermark,
+		onCross:   onCross,
+	})
+}
+
+// SetMissRateWatermark sets the ratio of allocations to acquisitions which calls onCross when
+// it is reached. The ratio is evaluated after each window of acquisitions. onCross is called again
+// only after the ratio drops below the watermark. Zero window or nil onCross disables the watermark.
+func (i *Instrumentation) SetMissRateWatermark(watermark float64, window uint64, onCross WatermarkFunc) {
+	i.windowMutex.Lock()
+	defer i.windowMutex.Unlock()
+	atomic.StoreUint32(&i.missRateCrossed, 0)
+	atomic.StoreUint64(&i.windowAcquired, 0)
+	atomic.StoreUint64(&i.windowAllocated, 0)
+	i.missRateWin.Store(missRateWatermark{
+		watermark: watermark,
+		window:    window,
+		onCross:   onCross,
+	})
+}
+
+// Stats returns current statistics.
+func (i *Instrumentation) Stats() Stats {
+	// allocated is loaded first, so it doesn't exceed acquired
+	allocated := atomic.LoadUint64(&i.allocated)
+	acquired := atomic.LoadUint64(&i.acquired)
+	released := atomic.LoadUint64(&i.released)
+	return Stats{
+		Acquired:  acquired,
+		Released:  released,
+		Allocated: allocated,
+		InUse:     int64(acquired - released),
+		MissRate:  i.missRate.Load().(float64),
+		Hits:      acquired - allocated,
+	}
+}
+
+// OnAcquire must be called by the pool for every acquired message. Allocated signals
+// that the pool was empty and a new message was allocated.
+func (i *Instrumentation) OnAcquire(allocated bool) {
+	acquired := atomic.AddUint64(&i.acquired, 1)
+	if allocated {
+		atomic.AddUint64(&i.allocated, 1)
+		i.OnAllocation("message", 0)
+	}
+	o := i.occupancy.Load().(occupancyWatermark)
+	if o.onCross != nil && o.watermark > 0 {
+		inUse := int64(acquired - atomic.LoadUint64(&i.released))
+		if inUse >= o.watermark && atomic.CompareAndSwapUint32(&i.occupancyCrossed, 0, 1) {
+			o.onCross(i.Stats())
+		}
+	}
+	m := i.missRateWin.Load().(missRateWatermark)
+	if m.onCross == nil || m.window == 0 {
+		return
+	}
+	if allocated {
+		atomic.AddUint64(&i.windowAllocated, 1)
+	}
+	if atomic.AddUint64(&i.windowAcquired, 1) < m.window {
+		return
+	}
+	i.evaluateMissRate(m)
+}
+
+func (i *Instrumentation) evaluateMissRate(m missRateWatermark) {
+	i.windowMutex.Lock()
+	windowAcquired := atomic.LoadUint64(&i.windowAcquired)
+	if windowAcquired < m.window {
+		// window was evaluated by another goroutine
+		i.windowMutex.Unlock()
+		return
+	}
+	windowAllocated := atomic.SwapUint64(&i.windowAllocated, 0)
+	atomic.StoreUint64(&i.windowAcquired, 0)
+	rate := float64(windowAllocated) / float64(windowAcquired)
+	i.missRate.Store(rate)
+	i.windowMutex.Unlock()
+
+	if rate < m.watermark {
+		atomic.StoreUint32(&i.missRateCrossed, 0)
+		return
+	}
+	if atomic.CompareAndSwapUint32(&i.missRateCrossed, 0, 1) {
+		m.onCross(i.Stats())
+	}
+}
+
+// OnRelease must be called by the pool for every released message.
+func (i *Instrumentation) OnRelease() {
+	released := atomic.AddUint64(&i.released, 1)
+	o := i.occupancy.Load().(occupancyWatermark)
+	if o.onCross == nil || o.watermark <= 0 {
+		return
+	}
+	if int64(atomic.LoadUint64(&i.acquired)-released) < o.watermark {
+		atomic.StoreUint32(&i.occupancyCrossed, 0)
+	}
+}
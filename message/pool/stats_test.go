@@ -0,0 +1,112 @@
+package pool_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentation_OccupancyWatermark(t *testing.T) {
+	i := pool.NewInstrumentation()
+	var crossed []pool.Stats
+	i.SetOccupancyWatermark(2, func(stats pool.Stats) {
+		crossed = append(crossed, stats)
+	})
+	i.OnAcquire(true)
+	require.Len(t, crossed, 0)
+	i.OnAcquire(true)
+	require.Len(t, crossed, 1)
+	require.Equal(t, int64(2), crossed[0].InUse)
+	i.OnAcquire(false)
+	require.Len(t, crossed, 1)
+
+	i.OnRelease()
+	i.OnRelease()
+	i.OnAcquire(false)
+	require.Len(t, crossed, 2)
+
+	stats := i.Stats()
+	require.Equal(t, uint64(4), stats.Acquired)
+	require.Equal(t, uint64(2), stats.Released)
+	require.Equal(t, uint64(2), stats.Allocated)
+	require.Equal(t, int64(2), stats.InUse)
+}
+
+func TestInstrumentation_MissRateWatermark(t *testing.T) {
+	i := pool.NewInstrumentation()
+	var crossed []pool.Stats
+	i.SetMissRateWatermark(0.5, 4, func(stats pool.Stats) {
+		crossed = append(crossed, stats)
+	})
+	for n := 0; n < 4; n++ {
+		i.OnAcquire(n%2 == 0)
+	}
+	require.Len(t, crossed, 1)
+	require.Equal(t, 0.5, crossed[0].MissRate)
+
+	for n := 0; n < 4; n++ {
+		i.OnAcquire(true)
+	}
+	require.Len(t, crossed, 1)
+
+	for n := 0; n < 4; n++ {
+		i.OnAcquire(false)
+	}
+	require.Equal(t, float64(0), i.Stats().MissRate)
+	for n := 0; n < 4; n++ {
+		i.OnAcquire(true)
+	}
+	require.Len(t, crossed, 2)
+}
+
+func TestInstrumentation_LeakDetection(t *testing.T) {
+	i := pool.NewInstrumentation()
+	leaksChan := make(chan []pool.Leak, 1)
+	stop := i.EnableLeakDetection(time.Millisecond*50, time.Millisecond*20, func(leaks []pool.Leak) {
+		select {
+		case leaksChan <- leaks:
+		default:
+		}
+	})
+	defer stop()
+
+	released := pool.NewMessage()
+	leaked := pool.NewMessage()
+	i.Track(released)
+	i.Track(leaked)
+	i.Untrack(released)
+
+	select {
+	case leaks := <-leaksChan:
+		require.Len(t, leaks, 1)
+		require.GreaterOrEqual(t, int64(leaks[0].HeldFor), int64(time.Millisecond*50))
+		require.Contains(t, leaks[0].Stack, "TestInstrumentation_LeakDetection")
+	case <-time.After(time.Second):
+		require.FailNow(t, "leak was not reported")
+	}
+}
+
+func TestInstrumentation_LeakDetectionDefaultInterval(t *testing.T) {
+	i := pool.NewInstrumentation()
+	leaksChan := make(chan []pool.Leak, 1)
+	// interval defaults to threshold
+	stop := i.EnableLeakDetection(time.Millisecond*20, 0, func(leaks []pool.Leak) {
+		select {
+		case leaksChan <- leaks:
+		default:
+		}
+	})
+	defer stop()
+	i.Track(pool.NewMessage())
+
+	select {
+	case leaks := <-leaksChan:
+		require.Len(t, leaks, 1)
+	case <-time.After(time.Second):
+		require.FailNow(t, "leak was not reported")
+	}
+	// doesn't panic when neither is positive
+	i.EnableLeakDetection(0, -1, func(leaks []pool.Leak) {})()
+}
@@ -0,0 +1,58 @@
+package message
+
+// Critical reports whether the option must be understood by the endpoint which processes the message (RFC 7252 section 5.4.1).
+func (o OptionID) Critical() bool {
+	return o&1 != 0
+}
+
+// Unsafe reports whether a proxy must understand the option to forward the message (RFC 7252 section 5.4.2).
+func (o OptionID) Unsafe() bool {
+	return o&2 != 0
+}
+
+// NoCacheKey reports whether the safe-to-forward option is not part of the cache key (RFC 7252 section 5.4.2).
+// Unsafe options are always part of the cache key.
+func (o OptionID) NoCacheKey() bool {
+	return !o.Unsafe() && o&0x1e == 0x1c
+}
+
+// ProxyOptions are options of a message classified by the rules of a forward-proxy (RFC 7252 section 5.7).
+// Every option is either in SafeToForward or in Unsafe, the other fields are subsets of them.
+type ProxyOptions struct {
+	// SafeToForward are options which the proxy forwards even when it doesn't understand them.
+	SafeToForward Options
+	// Unsafe are options which the proxy must process, e.g. Uri-Host or Proxy-Uri, before it forwards the message.
+	Unsafe Options
+	// CacheKey are options which are part of the cache key of a request (RFC 7252 section 5.6).
+	CacheKey Options
+	// UnknownUnsafe are unsafe options missing in the registry. A request with them must be rejected by
+	// 5.02 (Bad Gateway).
+	UnknownUnsafe Options
+	// UnknownCritical are critical options missing in the registry. A request with them must be rejected by
+	// 4.02 (Bad Option).
+	UnknownCritical Options
+}
+
+// ClassifyProxyOptions classifies options for forwarding by a proxy, which understands options of the registry,
+// e.g. CoapOptionDefs. The classified options share values with options.
+func ClassifyProxyOptions(options Options, optionDefs map[OptionID]OptionDef) ProxyOptions {
+	var p ProxyOptions
+	for _, opt := range options {
+		_, known := optionDefs[opt.ID]
+		if opt.ID.Unsafe() {
+			p.Unsafe = append(p.Unsafe, opt)
+			if !known {
+				p.UnknownUnsafe = append(p.UnknownUnsafe, opt)
+			}
+		} else {
+			p.SafeToForward = append(p.SafeToForward, opt)
+		}
+		if !opt.ID.NoCacheKey() {
+			p.CacheKey = append(p.CacheKey, opt)
+		}
+		if !known && opt.ID.Critical() {
+			p.UnknownCritical = append(p.UnknownCritical, opt)
+		}
+	}
+	return p
+}
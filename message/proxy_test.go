@@ -0,0 +1,82 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionID_Proxy(t *testing.T) {
+	// C, U, N columns of RFC 7252 table 4
+	tests := []struct {
+		id         OptionID
+		critical   bool
+		unsafe     bool
+		noCacheKey bool
+	}{
+		{IfMatch, true, false, false},
+		{URIHost, true, true, false},
+		{ETag, false, false, false},
+		{IfNoneMatch, true, false, false},
+		{URIPort, true, true, false},
+		{LocationPath, false, false, false},
+		{URIPath, true, true, false},
+		{ContentFormat, false, false, false},
+		{MaxAge, false, true, false},
+		{URIQuery, true, true, false},
+		{Accept, true, false, false},
+		{LocationQuery, false, false, false},
+		{Block2, true, true, false},
+		{Block1, true, true, false},
+		{Size2, false, false, true},
+		{ProxyURI, true, true, false},
+		{ProxyScheme, true, true, false},
+		{Size1, false, false, true},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.critical, tt.id.Critical(), tt.id)
+		require.Equal(t, tt.unsafe, tt.id.Unsafe(), tt.id)
+		require.Equal(t, tt.noCacheKey, tt.id.NoCacheKey(), tt.id)
+	}
+}
+
+func TestClassifyProxyOptions(t *testing.T) {
+	options := Options{
+		{ID: URIHost, Value: []byte("a")},
+		{ID: ETag, Value: []byte{1}},
+		{ID: URIPath, Value: []byte("b")},
+		{ID: Size2, Value: []byte{}},
+		{ID: 65001, Value: []byte{2}},
+		{ID: 65002, Value: []byte{3}},
+		{ID: 65003, Value: []byte{4}},
+	}
+	require.Equal(t, ProxyOptions{
+		SafeToForward: Options{
+			{ID: ETag, Value: []byte{1}},
+			{ID: Size2, Value: []byte{}},
+			{ID: 65001, Value: []byte{2}},
+		},
+		Unsafe: Options{
+			{ID: URIHost, Value: []byte("a")},
+			{ID: URIPath, Value: []byte("b")},
+			{ID: 65002, Value: []byte{3}},
+			{ID: 65003, Value: []byte{4}},
+		},
+		CacheKey: Options{
+			{ID: URIHost, Value: []byte("a")},
+			{ID: ETag, Value: []byte{1}},
+			{ID: URIPath, Value: []byte("b")},
+			{ID: 65001, Value: []byte{2}},
+			{ID: 65002, Value: []byte{3}},
+			{ID: 65003, Value: []byte{4}},
+		},
+		UnknownUnsafe: Options{
+			{ID: 65002, Value: []byte{3}},
+			{ID: 65003, Value: []byte{4}},
+		},
+		UnknownCritical: Options{
+			{ID: 65001, Value: []byte{2}},
+			{ID: 65003, Value: []byte{4}},
+		},
+	}, ClassifyProxyOptions(options, CoapOptionDefs))
+}
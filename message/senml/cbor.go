@@ -0,0 +1,207 @@
+package senml
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+)
+
+// Labels of CBOR representation (RFC 8428 section 6).
+const (
+	labelBaseVersion = -1
+	labelBaseName    = -2
+	labelBaseTime    = -3
+	labelBaseUnit    = -4
+	labelBaseValue   = -5
+	labelBaseSum     = -6
+	labelName        = 0
+	labelUnit        = 1
+	labelValue       = 2
+	labelStringValue = 3
+	labelBoolValue   = 4
+	labelSum         = 5
+	labelTime        = 6
+	labelUpdateTime  = 7
+	labelDataValue   = 8
+)
+
+func encodeCBOR(p Pack) []byte {
+	buf := cbor.AppendArray(make([]byte, 0, 32*len(p)+1), len(p))
+	for _, r := range p {
+		buf = appendRecord(buf, r)
+	}
+	return buf
+}
+
+func appendRecord(buf []byte, r Record) []byte {
+	var n int
+	for _, set := range []bool{
+		r.BaseVersion != 0, r.BaseName != "", r.BaseTime != 0, r.BaseUnit != "", r.BaseValue != nil, r.BaseSum != nil,
+		r.Name != "", r.Unit != "", r.Value != nil, r.StringValue != nil, r.BoolValue != nil, r.Sum != nil,
+		r.Time != 0, r.UpdateTime != 0, r.DataValue != nil,
+	} {
+		if set {
+			n++
+		}
+	}
+	buf = cbor.AppendMap(buf, n)
+	if r.BaseVersion != 0 {
+		buf = cbor.AppendInt(cbor.AppendInt(buf, labelBaseVersion), int64(r.BaseVersion))
+	}
+	if r.BaseName != "" {
+		buf = cbor.AppendText(cbor.AppendInt(buf, labelBaseName), r.BaseName)
+	}
+	if r.BaseTime != 0 {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelBaseTime), r.BaseTime)
+	}
+	if r.BaseUnit != "" {
+		buf = cbor.AppendText(cbor.AppendInt(buf, labelBaseUnit), r.BaseUnit)
+	}
+	if r.BaseValue != nil {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelBaseValue), *r.BaseValue)
+	}
+	if r.BaseSum != nil {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelBaseSum), *r.BaseSum)
+	}
+	if r.Name != "" {
+		buf = cbor.AppendText(cbor.AppendInt(buf, labelName), r.Name)
+	}
+	if r.Unit != "" {
+		buf = cbor.AppendText(cbor.AppendInt(buf, labelUnit), r.Unit)
+	}
+	if r.Value != nil {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelValue), *r.Value)
+	}
+	if r.StringValue != nil {
+		buf = cbor.AppendText(cbor.AppendInt(buf, labelStringValue), *r.StringValue)
+	}
+	if r.BoolValue != nil {
+		buf = cbor.AppendBool(cbor.AppendInt(buf, labelBoolValue), *r.BoolValue)
+	}
+	if r.Sum != nil {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelSum), *r.Sum)
+	}
+	if r.Time != 0 {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelTime), r.Time)
+	}
+	if r.UpdateTime != 0 {
+		buf = cbor.AppendFloat(cbor.AppendInt(buf, labelUpdateTime), r.UpdateTime)
+	}
+	if r.DataValue != nil {
+		buf = cbor.AppendBytes(cbor.AppendInt(buf, labelDataValue), r.DataValue)
+	}
+	return buf
+}
+
+func decodeCBOR(data []byte) (Pack, error) {
+	n, data, err := cbor.ReadArray(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pack: %w", err)
+	}
+	p := make(Pack, 0, n)
+	for i := 0; i < n; i++ {
+		var r Record
+		r, data, err = readRecord(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record %v: %w", i, err)
+		}
+		p = append(p, r)
+	}
+	if len(data) > 0 {
+		return nil, fmt.Errorf("unexpected data after CBOR array")
+	}
+	return p, nil
+}
+
+func readRecord(data []byte) (Record, []byte, error) {
+	var r Record
+	n, data, err := cbor.ReadMap(data)
+	if err != nil {
+		return r, nil, err
+	}
+	for i := 0; i < n; i++ {
+		major, err := cbor.PeekMajor(data)
+		if err != nil {
+			return r, nil, err
+		}
+		if major == cbor.MajorText {
+			// labels of extensions
+			var label string
+			label, data, err = cbor.ReadText(data)
+			if err != nil {
+				return r, nil, err
+			}
+			if strings.HasSuffix(label, "_") {
+				return r, nil, fmt.Errorf("%w: %v", ErrMustUnderstand, label)
+			}
+			data, err = cbor.Skip(data)
+			if err != nil {
+				return r, nil, err
+			}
+			continue
+		}
+		var label int64
+		label, data, err = cbor.ReadInt(data)
+		if err != nil {
+			return r, nil, err
+		}
+		data, err = readField(&r, label, data)
+		if err != nil {
+			return r, nil, fmt.Errorf("invalid field %v: %w", label, err)
+		}
+	}
+	return r, data, nil
+}
+
+func readField(r *Record, label int64, data []byte) ([]byte, error) {
+	var err error
+	var v float64
+	switch label {
+	case labelBaseVersion:
+		var ver int64
+		ver, data, err = cbor.ReadInt(data)
+		r.BaseVersion = int(ver)
+	case labelBaseName:
+		r.BaseName, data, err = cbor.ReadText(data)
+	case labelBaseTime:
+		r.BaseTime, data, err = cbor.ReadFloat(data)
+	case labelBaseUnit:
+		r.BaseUnit, data, err = cbor.ReadText(data)
+	case labelBaseValue:
+		v, data, err = cbor.ReadFloat(data)
+		r.BaseValue = Float(v)
+	case labelBaseSum:
+		v, data, err = cbor.ReadFloat(data)
+		r.BaseSum = Float(v)
+	case labelName:
+		r.Name, data, err = cbor.ReadText(data)
+	case labelUnit:
+		r.Unit, data, err = cbor.ReadText(data)
+	case labelValue:
+		v, data, err = cbor.ReadFloat(data)
+		r.Value = Float(v)
+	case labelStringValue:
+		var s string
+		s, data, err = cbor.ReadText(data)
+		r.StringValue = String(s)
+	case labelBoolValue:
+		var b bool
+		b, data, err = cbor.ReadBool(data)
+		r.BoolValue = Bool(b)
+	case labelSum:
+		v, data, err = cbor.ReadFloat(data)
+		r.Sum = Float(v)
+	case labelTime:
+		r.Time, data, err = cbor.ReadFloat(data)
+	case labelUpdateTime:
+		r.UpdateTime, data, err = cbor.ReadFloat(data)
+	case labelDataValue:
+		var b []byte
+		b, data, err = cbor.ReadBytes(data)
+		r.DataValue = append([]byte{}, b...)
+	default:
+		data, err = cbor.Skip(data)
+	}
+	return data, err
+}
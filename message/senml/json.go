@@ -0,0 +1,108 @@
+//go:build !tinygo
+
+package senml
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func init() {
+	encodeJSON = encodeJSONPack
+	decodeJSON = decodeJSONPack
+}
+
+// jsonRecord is JSON representation of the record (RFC 8428 section 5), data values are base64url encoded
+// without padding.
+type jsonRecord struct {
+	BaseName    string   `json:"bn,omitempty"`
+	BaseTime    float64  `json:"bt,omitempty"`
+	BaseUnit    string   `json:"bu,omitempty"`
+	BaseValue   *float64 `json:"bv,omitempty"`
+	BaseSum     *float64 `json:"bs,omitempty"`
+	BaseVersion int      `json:"bver,omitempty"`
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	DataValue   *string  `json:"vd,omitempty"`
+	Sum         *float64 `json:"s,omitempty"`
+	Time        float64  `json:"t,omitempty"`
+	UpdateTime  float64  `json:"ut,omitempty"`
+}
+
+func encodeJSONPack(p Pack) ([]byte, error) {
+	records := make([]jsonRecord, 0, len(p))
+	for _, r := range p {
+		jr := jsonRecord{
+			BaseName:    r.BaseName,
+			BaseTime:    r.BaseTime,
+			BaseUnit:    r.BaseUnit,
+			BaseValue:   r.BaseValue,
+			BaseSum:     r.BaseSum,
+			BaseVersion: r.BaseVersion,
+			Name:        r.Name,
+			Unit:        r.Unit,
+			Value:       r.Value,
+			StringValue: r.StringValue,
+			BoolValue:   r.BoolValue,
+			Sum:         r.Sum,
+			Time:        r.Time,
+			UpdateTime:  r.UpdateTime,
+		}
+		if r.DataValue != nil {
+			jr.DataValue = String(base64.RawURLEncoding.EncodeToString(r.DataValue))
+		}
+		records = append(records, jr)
+	}
+	return json.Marshal(records)
+}
+
+func decodeJSONPack(data []byte) (Pack, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid pack: %w", err)
+	}
+	for i, fields := range raw {
+		for label := range fields {
+			if strings.HasSuffix(label, "_") {
+				return nil, fmt.Errorf("invalid record %v: %w: %v", i, ErrMustUnderstand, label)
+			}
+		}
+	}
+	var records []jsonRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid pack: %w", err)
+	}
+	p := make(Pack, 0, len(records))
+	for i, jr := range records {
+		r := Record{
+			BaseName:    jr.BaseName,
+			BaseTime:    jr.BaseTime,
+			BaseUnit:    jr.BaseUnit,
+			BaseValue:   jr.BaseValue,
+			BaseSum:     jr.BaseSum,
+			BaseVersion: jr.BaseVersion,
+			Name:        jr.Name,
+			Unit:        jr.Unit,
+			Value:       jr.Value,
+			StringValue: jr.StringValue,
+			BoolValue:   jr.BoolValue,
+			Sum:         jr.Sum,
+			Time:        jr.Time,
+			UpdateTime:  jr.UpdateTime,
+		}
+		if jr.DataValue != nil {
+			v, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(*jr.DataValue, "="))
+			if err != nil {
+				return nil, fmt.Errorf("invalid record %v: invalid data value: %w", i, err)
+			}
+			r.DataValue = v
+		}
+		p = append(p, r)
+	}
+	return p, nil
+}
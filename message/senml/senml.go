@@ -0,0 +1,260 @@
+// Package senml encodes and decodes Sensor Measurement Lists (RFC 8428) in JSON and CBOR, so sensor payloads
+// are exchanged with the Content-Format of the pack and base fields are resolved to self-contained records.
+package senml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// Version is the SenML version implemented by the package, a pack with higher base version is rejected.
+const Version = 10
+
+// relativeTimeLimit is 2**28, resolved times below it are relative to now (RFC 8428 section 4.5.3).
+const relativeTimeLimit = 1 << 28
+
+var (
+	// ErrUnsupportedContentFormat is returned when the content format isn't a JSON or CBOR SenML or SenSML one,
+	// servers answer it by 4.15 (Unsupported Content-Format).
+	ErrUnsupportedContentFormat = errors.New("unsupported content format")
+	// ErrMustUnderstand is returned for a record with a must-understand field, i.e. its label ends with "_",
+	// which the package doesn't know.
+	ErrMustUnderstand = errors.New("unknown must-understand field")
+	// ErrInvalidRecord is returned by Resolve for a record which violates RFC 8428, e.g. without a name.
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// Record is a SenML record. Base fields apply to the record and to the following records of the pack until
+// they are set again. Optional values are nil when they are missing.
+type Record struct {
+	BaseName    string
+	BaseTime    float64
+	BaseUnit    string
+	BaseValue   *float64
+	BaseSum     *float64
+	BaseVersion int
+
+	Name        string
+	Unit        string
+	Value       *float64
+	StringValue *string
+	BoolValue   *bool
+	DataValue   []byte
+	Sum         *float64
+	// Time is seconds since the Unix epoch, or relative to now when it is lower than 2**28.
+	Time       float64
+	UpdateTime float64
+}
+
+// Pack is a SenML pack, i.e. an array of records.
+type Pack []Record
+
+// encodeJSON and decodeJSON are set by JSON representation, which isn't available in TinyGo builds.
+var (
+	encodeJSON func(p Pack) ([]byte, error)
+	decodeJSON func(data []byte) (Pack, error)
+)
+
+// Float returns pointer to v, e.g. for Value of a record.
+func Float(v float64) *float64 {
+	return &v
+}
+
+// String returns pointer to v, e.g. for StringValue of a record.
+func String(v string) *string {
+	return &v
+}
+
+// Bool returns pointer to v, e.g. for BoolValue of a record.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// hasValue reports whether the record has a value of any type.
+func (r Record) hasValue() bool {
+	return r.Value != nil || r.StringValue != nil || r.BoolValue != nil || r.DataValue != nil
+}
+
+// Resolve returns records of the pack in the resolved form (RFC 8428 section 4.6): base fields are applied
+// and removed, names are checked and times are absolute, relative ones and zero are relative to now.
+func (p Pack) Resolve(now time.Time) (Pack, error) {
+	var base Record
+	nowSec := float64(now.UnixNano()) / float64(time.Second)
+	res := make(Pack, 0, len(p))
+	for i, r := range p {
+		if r.BaseVersion > Version {
+			return nil, fmt.Errorf("%w %v: unsupported version %v", ErrInvalidRecord, i, r.BaseVersion)
+		}
+		if r.BaseName != "" {
+			base.BaseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			base.BaseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			base.BaseUnit = r.BaseUnit
+		}
+		if r.BaseValue != nil {
+			base.BaseValue = r.BaseValue
+		}
+		if r.BaseSum != nil {
+			base.BaseSum = r.BaseSum
+		}
+		rr := Record{
+			Name:        base.BaseName + r.Name,
+			Unit:        r.Unit,
+			StringValue: r.StringValue,
+			BoolValue:   r.BoolValue,
+			DataValue:   r.DataValue,
+			Time:        base.BaseTime + r.Time,
+			UpdateTime:  r.UpdateTime,
+		}
+		if !validName(rr.Name) {
+			return nil, fmt.Errorf("%w %v: invalid name %q", ErrInvalidRecord, i, rr.Name)
+		}
+		if rr.Unit == "" {
+			rr.Unit = base.BaseUnit
+		}
+		rr.Value = addBase(base.BaseValue, r.Value, !r.hasValue() && r.Sum == nil)
+		rr.Sum = addBase(base.BaseSum, r.Sum, false)
+		if !rr.hasValue() && rr.Sum == nil {
+			return nil, fmt.Errorf("%w %v: no value", ErrInvalidRecord, i)
+		}
+		if rr.Time < relativeTimeLimit {
+			rr.Time += nowSec
+		}
+		res = append(res, rr)
+	}
+	return res, nil
+}
+
+// addBase adds the base to the value, the base alone is the value when the value is missing and allowed.
+func addBase(base, v *float64, baseAlone bool) *float64 {
+	switch {
+	case v == nil && base != nil && baseAlone:
+		return Float(*base)
+	case v == nil:
+		return nil
+	case base != nil:
+		return Float(*base + *v)
+	}
+	return Float(*v)
+}
+
+// validName checks the name starts by a letter or a digit and contains only letters, digits, ":", ".", "/",
+// "_" and "-" (RFC 8428 section 4.5.1).
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case i > 0 && (c == ':' || c == '.' || c == '/' || c == '_' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// TimeValue returns Time of the resolved record.
+func (r Record) TimeValue() time.Time {
+	sec, frac := math.Modf(r.Time)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// Encode encodes the pack in the content format: JSON for application/senml+json and application/sensml+json,
+// CBOR for application/senml+cbor and application/sensml+cbor. TinyGo builds have no JSON encoding, it
+// depends on reflection.
+func Encode(contentFormat message.MediaType, p Pack) ([]byte, error) {
+	switch contentFormat {
+	case message.AppSenmlCBOR, message.AppSensmlCBOR:
+		return encodeCBOR(p), nil
+	case message.AppSenmlJSON, message.AppSensmlJSON:
+		if encodeJSON != nil {
+			return encodeJSON(p)
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentFormat, contentFormat)
+}
+
+// Decode decodes the pack of the content format.
+func Decode(contentFormat message.MediaType, data []byte) (Pack, error) {
+	switch contentFormat {
+	case message.AppSenmlCBOR, message.AppSensmlCBOR:
+		return decodeCBOR(data)
+	case message.AppSenmlJSON, message.AppSensmlJSON:
+		if decodeJSON != nil {
+			return decodeJSON(data)
+		}
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentFormat, contentFormat)
+}
+
+// NewBody returns body with the pack encoded in the content format, e.g. for SetResponse of mux.ResponseWriter.
+func NewBody(contentFormat message.MediaType, p Pack) (io.ReadSeeker, error) {
+	data, err := Encode(contentFormat, p)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// ParseMessage decodes the pack from the body of the message by its Content-Format, e.g. a request of a handler.
+func ParseMessage(m *message.Message) (Pack, error) {
+	cf, err := m.Options.ContentFormat()
+	if err != nil {
+		return nil, fmt.Errorf("%w: content format is not set", ErrUnsupportedContentFormat)
+	}
+	if m.Body == nil {
+		return nil, errors.New("empty body")
+	}
+	if _, err := m.Body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(cf, data)
+}
+
+// PoolMessage is a pooled message, e.g. *pool.Message of udp or tcp.
+type PoolMessage interface {
+	ContentFormat() (message.MediaType, error)
+	SetContentFormat(contentFormat message.MediaType)
+	ReadBody() ([]byte, error)
+	SetBody(s io.ReadSeeker)
+}
+
+// Get decodes the pack from the body of the message by its Content-Format, e.g. a response of a client.
+func Get(m PoolMessage) (Pack, error) {
+	cf, err := m.ContentFormat()
+	if err != nil {
+		return nil, fmt.Errorf("%w: content format is not set", ErrUnsupportedContentFormat)
+	}
+	data, err := m.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	return Decode(cf, data)
+}
+
+// Set sets the pack encoded in the content format as the body of the message and its Content-Format,
+// e.g. for a request of a client.
+func Set(m PoolMessage, contentFormat message.MediaType, p Pack) error {
+	body, err := NewBody(contentFormat, p)
+	if err != nil {
+		return err
+	}
+	m.SetContentFormat(contentFormat)
+	m.SetBody(body)
+	return nil
+}
@@ -0,0 +1,123 @@
+package senml_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/message/senml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	p := senml.Pack{
+		{BaseName: "urn:dev:ow:10e2073a01080063:", BaseTime: 1.320067464e+09, BaseUnit: "%RH", BaseVersion: 10, Name: "humidity", Value: senml.Float(20.5)},
+		{Name: "door", BoolValue: senml.Bool(true), Time: -5},
+		{Name: "label", StringValue: senml.String("kitchen")},
+		{Name: "raw", DataValue: []byte{0xfb, 0xff, 0x01}},
+		{Name: "energy", Unit: "J", Sum: senml.Float(1.1), UpdateTime: 60},
+	}
+	for _, cf := range []message.MediaType{message.AppSenmlJSON, message.AppSenmlCBOR, message.AppSensmlJSON, message.AppSensmlCBOR} {
+		t.Run(cf.String(), func(t *testing.T) {
+			data, err := senml.Encode(cf, p)
+			require.NoError(t, err)
+			decoded, err := senml.Decode(cf, data)
+			require.NoError(t, err)
+			require.Equal(t, p, decoded)
+		})
+	}
+	_, err := senml.Encode(message.AppSenmlXML, p)
+	require.True(t, errors.Is(err, senml.ErrUnsupportedContentFormat))
+}
+
+func TestDecodeJSON(t *testing.T) {
+	// example of RFC 8428 section 5.1.2
+	data := []byte(`[
+		{"bn":"urn:dev:ow:10e2073a01080063","n":"voltage","u":"V","v":120.1},
+		{"n":"current","u":"A","v":1.2, "vd":"aGk"}
+	]`)
+	p, err := senml.Decode(message.AppSenmlJSON, data)
+	require.NoError(t, err)
+	require.Len(t, p, 2)
+	require.Equal(t, "urn:dev:ow:10e2073a01080063", p[0].BaseName)
+	require.Equal(t, 120.1, *p[0].Value)
+	require.Equal(t, []byte("hi"), p[1].DataValue)
+
+	_, err = senml.Decode(message.AppSenmlJSON, []byte(`[{"n":"a","v":1,"foo_":1}]`))
+	require.True(t, errors.Is(err, senml.ErrMustUnderstand))
+	p, err = senml.Decode(message.AppSenmlJSON, []byte(`[{"n":"a","v":1,"foo":1}]`))
+	require.NoError(t, err)
+	require.Equal(t, "a", p[0].Name)
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data := cbor.AppendArray(nil, 1)
+	data = cbor.AppendMap(data, 3)
+	data = cbor.AppendText(cbor.AppendInt(data, 0), "temp")
+	// half precision value and an extension field
+	data = append(cbor.AppendInt(data, 2), 0xf9, 0x3c, 0x00)
+	data = cbor.AppendFloat(cbor.AppendText(data, "ext"), 1)
+	p, err := senml.Decode(message.AppSenmlCBOR, data)
+	require.NoError(t, err)
+	require.Equal(t, senml.Pack{{Name: "temp", Value: senml.Float(1)}}, p)
+
+	data = cbor.AppendArray(nil, 1)
+	data = cbor.AppendMap(data, 1)
+	data = cbor.AppendBool(cbor.AppendText(data, "ext_"), true)
+	_, err = senml.Decode(message.AppSenmlCBOR, data)
+	require.True(t, errors.Is(err, senml.ErrMustUnderstand))
+}
+
+func TestResolve(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := senml.Pack{
+		{BaseName: "dev1/", BaseTime: 1.32e+09, BaseUnit: "Cel", BaseValue: senml.Float(20), Name: "temp", Value: senml.Float(1.5), Time: 10},
+		{Name: "temp", Value: senml.Float(-0.5), Time: 20},
+		{Name: "status", StringValue: senml.String("ok"), Unit: "x"},
+		{BaseName: "dev2/", BaseTime: -60, Name: "temp"},
+	}
+	r, err := p.Resolve(now)
+	require.NoError(t, err)
+	require.Equal(t, senml.Pack{
+		{Name: "dev1/temp", Unit: "Cel", Value: senml.Float(21.5), Time: 1.32e+09 + 10},
+		{Name: "dev1/temp", Unit: "Cel", Value: senml.Float(19.5), Time: 1.32e+09 + 20},
+		{Name: "dev1/status", Unit: "x", StringValue: senml.String("ok"), Time: 1.32e+09},
+		{Name: "dev2/temp", Unit: "Cel", Value: senml.Float(20), Time: 1700000000 - 60},
+	}, r)
+	require.Equal(t, time.Unix(1700000000-60, 0), r[3].TimeValue())
+
+	_, err = senml.Pack{{Name: "-temp", Value: senml.Float(1)}}.Resolve(now)
+	require.True(t, errors.Is(err, senml.ErrInvalidRecord))
+	_, err = senml.Pack{{Name: "temp"}}.Resolve(now)
+	require.True(t, errors.Is(err, senml.ErrInvalidRecord))
+	_, err = senml.Pack{{BaseVersion: 11, Name: "temp", Value: senml.Float(1)}}.Resolve(now)
+	require.True(t, errors.Is(err, senml.ErrInvalidRecord))
+}
+
+func TestMessage(t *testing.T) {
+	p := senml.Pack{{Name: "temp", Unit: "Cel", Value: senml.Float(23.1)}}
+	m := pool.NewMessage()
+	err := senml.Set(m, message.AppSenmlCBOR, p)
+	require.NoError(t, err)
+	cf, err := m.ContentFormat()
+	require.NoError(t, err)
+	require.Equal(t, message.AppSenmlCBOR, cf)
+	decoded, err := senml.Get(m)
+	require.NoError(t, err)
+	require.Equal(t, p, decoded)
+
+	body, err := senml.NewBody(message.AppSenmlJSON, p)
+	require.NoError(t, err)
+	opts, _, err := message.Options{}.SetContentFormat(make([]byte, 8), message.AppSenmlJSON)
+	require.NoError(t, err)
+	decoded, err = senml.ParseMessage(&message.Message{Options: opts, Body: body})
+	require.NoError(t, err)
+	require.Equal(t, p, decoded)
+
+	_, err = senml.ParseMessage(&message.Message{Body: bytes.NewReader(nil)})
+	require.True(t, errors.Is(err, senml.ErrUnsupportedContentFormat))
+}
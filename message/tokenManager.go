@@ -0,0 +1,78 @@
+package message
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+)
+
+const (
+	// DefaultTokenLength is length of tokens generated by the default token manager.
+	DefaultTokenLength = 8
+	// MaxTokenLength is the maximal length of a token (RFC 7252 section 3).
+	MaxTokenLength = 8
+
+	// tokenAttempts bounds generation of a token which isn't used by an outstanding exchange.
+	tokenAttempts = 16
+)
+
+// ErrTokenExhausted is returned by TokenManager.NewToken when no unused token was generated.
+var ErrTokenExhausted = errors.New("cannot generate unused token")
+
+// TokenManager generates tokens of requests and guards them against reuse while their exchanges, including
+// observations, are outstanding (RFC 9175 section 4).
+type TokenManager interface {
+	// NewToken returns a token which isn't used by an outstanding exchange.
+	NewToken() (Token, error)
+	// Release returns the token when its exchange is finished, so it can be generated again.
+	Release(token Token)
+	// Len returns length of generated tokens.
+	Len() int
+}
+
+type tokenManager struct {
+	length      int
+	mutex       sync.Mutex
+	outstanding map[string]struct{}
+}
+
+// NewTokenManager creates token manager which generates tokens of the length by crypto/rand. The length out
+// of range 1-MaxTokenLength is replaced by DefaultTokenLength.
+func NewTokenManager(length int) TokenManager {
+	if length <= 0 || length > MaxTokenLength {
+		length = DefaultTokenLength
+	}
+	return &tokenManager{
+		length:      length,
+		outstanding: make(map[string]struct{}),
+	}
+}
+
+func (m *tokenManager) NewToken() (Token, error) {
+	for i := 0; i < tokenAttempts; i++ {
+		token := make(Token, m.length)
+		if _, err := rand.Read(token); err != nil {
+			return nil, err
+		}
+		m.mutex.Lock()
+		_, used := m.outstanding[string(token)]
+		if !used {
+			m.outstanding[string(token)] = struct{}{}
+		}
+		m.mutex.Unlock()
+		if !used {
+			return token, nil
+		}
+	}
+	return nil, ErrTokenExhausted
+}
+
+func (m *tokenManager) Release(token Token) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.outstanding, string(token))
+}
+
+func (m *tokenManager) Len() int {
+	return m.length
+}
@@ -0,0 +1,36 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenManager(t *testing.T) {
+	m := NewTokenManager(0)
+	require.Equal(t, DefaultTokenLength, m.Len())
+	token, err := m.NewToken()
+	require.NoError(t, err)
+	require.Len(t, token, DefaultTokenLength)
+
+	// all 256 tokens of length 1 are outstanding
+	m = NewTokenManager(1)
+	tokens := make(map[string]bool)
+	for len(tokens) < 256 {
+		token, err := m.NewToken()
+		if err != nil {
+			require.ErrorIs(t, err, ErrTokenExhausted)
+			continue
+		}
+		require.False(t, tokens[string(token)])
+		tokens[string(token)] = true
+	}
+	_, err = m.NewToken()
+	require.ErrorIs(t, err, ErrTokenExhausted)
+	m.Release(Token{7})
+	token, err = m.NewToken()
+	for err != nil {
+		token, err = m.NewToken()
+	}
+	require.Equal(t, Token{7}, token)
+}
@@ -0,0 +1,150 @@
+// Package metrics collects statistics of servers and clients, e.g. to operate a fleet of CoAP devices.
+// Set a Stats collector to udp, dtls or tcp by WithStats, the package prometheus exposes them to Prometheus.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+)
+
+// Stats collects statistics of connections. It is called synchronously by the connections, so it must not block
+// and it must be safe for concurrent use.
+type Stats interface {
+	// MessageSent counts a message sent to the peer, typ is type of UDP or DTLS message, empty for TCP.
+	MessageSent(code codes.Code, typ string)
+	// MessageReceived counts a message received from the peer, typ is type of UDP or DTLS message, empty for TCP.
+	MessageReceived(code codes.Code, typ string)
+	// Retransmission counts a retransmission of a confirmable message.
+	Retransmission()
+	// Duplicate counts a duplicate message of the peer which wasn't passed to the handler.
+	Duplicate()
+	// BlockwiseTransfer counts a started blockwise transfer of a body, sent is set when the body is sent
+	// to the peer.
+	BlockwiseTransfer(sent bool)
+	// SessionStarted counts a new connection.
+	SessionStarted()
+	// SessionClosed counts a closed connection.
+	SessionClosed()
+	// ObservationRegistered counts an observation registered by the peer.
+	ObservationRegistered()
+	// ObservationDeregistered counts an observation deregistered by the peer or removed with its connection.
+	ObservationDeregistered()
+	// ExchangeLatency observes time between sending of a request and receiving of the response.
+	ExchangeLatency(d time.Duration)
+}
+
+// RTTStats collects round-trip times of keepalive pings by class of the connection. It must not block and it must
+// be safe for concurrent use.
+type RTTStats interface {
+	// KeepAliveRTT observes round-trip time of a ping answered by a connection of the class.
+	KeepAliveRTT(class string, rtt time.Duration)
+}
+
+// ConnClassFunc returns class of the connection, e.g. network type from the identity which authenticated it.
+// Keep the number of classes small, each class has its own histogram.
+type ConnClassFunc = func(cc inactivity.ClientConn) string
+
+// KeepAliveRTT returns function which passes round-trip times of keepalive pings to s by class of the connection,
+// nil class means one class named by empty string. Set it to keepalive parameters of the servers and clients
+// by SetOnRTT of inactivity.KeepAliveParams, so the latency of a fleet is visible without extra probes.
+func KeepAliveRTT(s RTTStats, class ConnClassFunc) inactivity.RTTFunc {
+	return func(cc inactivity.ClientConn, rtt time.Duration) {
+		var c string
+		if class != nil {
+			c = class(cc)
+		}
+		s.KeepAliveRTT(c, rtt)
+	}
+}
+
+// tracer converts trace events to statistics.
+type tracer struct {
+	stats Stats
+	next  trace.Handler
+
+	mutex sync.Mutex
+	// observations counts registered observations of sessions by the remote address, they are removed
+	// when the session is closed.
+	observations map[string]int
+}
+
+// TraceHandler returns trace handler which passes events of connections to s and then to next, which may be nil.
+// It is used by WithStats of udp, dtls and tcp.
+func TraceHandler(s Stats, next trace.Handler) trace.Handler {
+	t := &tracer{
+		stats:        s,
+		next:         next,
+		observations: make(map[string]int),
+	}
+	return t.handle
+}
+
+func (t *tracer) handle(e trace.Event) {
+	switch e.Type {
+	case trace.MessageSent:
+		t.stats.MessageSent(e.Message.Code(), e.MessageType)
+	case trace.MessageReceived:
+		t.stats.MessageReceived(e.Message.Code(), e.MessageType)
+	case trace.Retransmit:
+		t.stats.Retransmission()
+	case trace.DuplicateDropped:
+		t.stats.Duplicate()
+	case trace.BlockwiseStep:
+		// Block1 carries body of a request and Block2 of a response
+		if e.Block.Num == 0 && e.Block.More && (e.Block.Option == message.Block1) == codes.IsRequest(e.Message.Code()) {
+			t.stats.BlockwiseTransfer(e.Block.Sent)
+		}
+	case trace.ExchangeFinished:
+		t.stats.ExchangeLatency(e.Elapsed)
+	case trace.ObservationRegistered:
+		t.updateObservations(e, 1)
+		t.stats.ObservationRegistered()
+	case trace.ObservationDeregistered:
+		t.updateObservations(e, -1)
+		t.stats.ObservationDeregistered()
+	case trace.SessionStarted:
+		t.stats.SessionStarted()
+	case trace.SessionClosed:
+		for i := t.removeObservations(e); i > 0; i-- {
+			t.stats.ObservationDeregistered()
+		}
+		t.stats.SessionClosed()
+	}
+	if t.next != nil {
+		t.next(e)
+	}
+}
+
+func remoteAddr(e trace.Event) string {
+	if e.RemoteAddr == nil {
+		return ""
+	}
+	return e.RemoteAddr.String()
+}
+
+func (t *tracer) updateObservations(e trace.Event, change int) {
+	key := remoteAddr(e)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	n := t.observations[key] + change
+	if n <= 0 {
+		delete(t.observations, key)
+		return
+	}
+	t.observations[key] = n
+}
+
+// removeObservations returns number of observations of the closed session.
+func (t *tracer) removeObservations(e trace.Event) int {
+	key := remoteAddr(e)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	n := t.observations[key]
+	delete(t.observations, key)
+	return n
+}
@@ -0,0 +1,303 @@
+// Package prometheus exposes statistics of servers and clients in the Prometheus text exposition format
+// without a dependency on the Prometheus client library.
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/metrics"
+)
+
+// DefaultBuckets are upper bounds in seconds of the exchange latency histogram. They span RTT of constrained
+// networks up to MAX_TRANSMIT_WAIT of RFC 7252 (93 s).
+var DefaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 100}
+
+// DefaultNamespace prefixes names of the metrics by default.
+const DefaultNamespace = "coap"
+
+type messageKey struct {
+	code codes.Code
+	typ  string
+}
+
+// Collector is metrics.Stats which serves the collected statistics to Prometheus by ServeHTTP.
+// It is safe for concurrent use.
+type Collector struct {
+	namespace string
+	buckets   []float64
+
+	retransmissions   uint64
+	duplicates        uint64
+	blockwiseSent     uint64
+	blockwiseReceived uint64
+	sessions          int64
+	observations      int64
+
+	mutex    sync.Mutex
+	sent     map[messageKey]uint64
+	received map[messageKey]uint64
+	latency  histogram
+	// rtt contains histograms of keepalive round-trip times by class of the connection
+	rtt map[string]*histogram
+}
+
+var (
+	_ metrics.Stats    = (*Collector)(nil)
+	_ metrics.RTTStats = (*Collector)(nil)
+)
+
+// histogram counts observations by buckets, the last count is of observations over all buckets.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(buckets []float64) histogram {
+	return histogram{counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(buckets []float64, seconds float64) {
+	h.counts[sort.SearchFloat64s(buckets, seconds)]++
+	h.sum += seconds
+	h.count++
+}
+
+func (h *histogram) clone() histogram {
+	c := *h
+	c.counts = append([]uint64(nil), h.counts...)
+	return c
+}
+
+// NewCollector creates collector with metrics prefixed by the namespace and the latency histogram
+// with the buckets. Empty namespace means DefaultNamespace and nil buckets mean DefaultBuckets.
+func NewCollector(namespace string, buckets []float64) *Collector {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Collector{
+		namespace: namespace,
+		buckets:   buckets,
+		sent:      make(map[messageKey]uint64),
+		received:  make(map[messageKey]uint64),
+		latency:   newHistogram(buckets),
+		rtt:       make(map[string]*histogram),
+	}
+}
+
+func (c *Collector) MessageSent(code codes.Code, typ string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sent[messageKey{code: code, typ: typ}]++
+}
+
+func (c *Collector) MessageReceived(code codes.Code, typ string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.received[messageKey{code: code, typ: typ}]++
+}
+
+func (c *Collector) Retransmission() {
+	atomic.AddUint64(&c.retransmissions, 1)
+}
+
+func (c *Collector) Duplicate() {
+	atomic.AddUint64(&c.duplicates, 1)
+}
+
+func (c *Collector) BlockwiseTransfer(sent bool) {
+	if sent {
+		atomic.AddUint64(&c.blockwiseSent, 1)
+		return
+	}
+	atomic.AddUint64(&c.blockwiseReceived, 1)
+}
+
+func (c *Collector) SessionStarted() {
+	atomic.AddInt64(&c.sessions, 1)
+}
+
+func (c *Collector) SessionClosed() {
+	atomic.AddInt64(&c.sessions, -1)
+}
+
+func (c *Collector) ObservationRegistered() {
+	atomic.AddInt64(&c.observations, 1)
+}
+
+func (c *Collector) ObservationDeregistered() {
+	atomic.AddInt64(&c.observations, -1)
+}
+
+func (c *Collector) ExchangeLatency(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.latency.observe(c.buckets, d.Seconds())
+}
+
+// KeepAliveRTT observes the round-trip time in the histogram of the class, use it by metrics.KeepAliveRTT.
+func (c *Collector) KeepAliveRTT(class string, rtt time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	h, ok := c.rtt[class]
+	if !ok {
+		v := newHistogram(c.buckets)
+		h = &v
+		c.rtt[class] = h
+	}
+	h.observe(c.buckets, rtt.Seconds())
+}
+
+// ServeHTTP writes the metrics in the text exposition format, e.g. for the /metrics endpoint.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	c.writeMessages(cw, "messages_sent_total", "Messages sent to peers.", c.snapshotMessages(c.sent))
+	c.writeMessages(cw, "messages_received_total", "Messages received from peers.", c.snapshotMessages(c.received))
+	c.writeMetric(cw, "retransmissions_total", "counter", "Retransmissions of confirmable messages.", "", float64(atomic.LoadUint64(&c.retransmissions)))
+	c.writeMetric(cw, "duplicates_total", "counter", "Duplicate messages of peers which were not passed to handlers.", "", float64(atomic.LoadUint64(&c.duplicates)))
+	c.writeHeader(cw, "blockwise_transfers_total", "counter", "Started blockwise transfers of bodies.")
+	c.writeSample(cw, "blockwise_transfers_total", `{direction="sent"}`, float64(atomic.LoadUint64(&c.blockwiseSent)))
+	c.writeSample(cw, "blockwise_transfers_total", `{direction="received"}`, float64(atomic.LoadUint64(&c.blockwiseReceived)))
+	c.writeMetric(cw, "sessions", "gauge", "Active sessions.", "", float64(atomic.LoadInt64(&c.sessions)))
+	c.writeMetric(cw, "observations", "gauge", "Observations registered by peers.", "", float64(atomic.LoadInt64(&c.observations)))
+	c.writeLatency(cw)
+	c.writeRTT(cw)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+type messageSample struct {
+	key   messageKey
+	value uint64
+}
+
+func (c *Collector) snapshotMessages(counts map[messageKey]uint64) []messageSample {
+	c.mutex.Lock()
+	samples := make([]messageSample, 0, len(counts))
+	for k, v := range counts {
+		samples = append(samples, messageSample{key: k, value: v})
+	}
+	c.mutex.Unlock()
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].key.code != samples[j].key.code {
+			return samples[i].key.code < samples[j].key.code
+		}
+		return samples[i].key.typ < samples[j].key.typ
+	})
+	return samples
+}
+
+func (c *Collector) writeMessages(w *countingWriter, name, help string, samples []messageSample) {
+	c.writeHeader(w, name, "counter", help)
+	for _, s := range samples {
+		c.writeSample(w, name, fmt.Sprintf(`{code=%q,type=%q}`, formatCode(s.key.code), s.key.typ), float64(s.value))
+	}
+}
+
+func (c *Collector) writeLatency(w *countingWriter) {
+	const name = "exchange_duration_seconds"
+	c.mutex.Lock()
+	h := c.latency.clone()
+	c.mutex.Unlock()
+	c.writeHeader(w, name, "histogram", "Time between sending of requests and receiving of responses.")
+	c.writeHistogram(w, name, "", h)
+}
+
+func (c *Collector) writeRTT(w *countingWriter) {
+	const name = "keepalive_rtt_seconds"
+	c.mutex.Lock()
+	classes := make([]string, 0, len(c.rtt))
+	histograms := make(map[string]histogram, len(c.rtt))
+	for class, h := range c.rtt {
+		classes = append(classes, class)
+		histograms[class] = h.clone()
+	}
+	c.mutex.Unlock()
+	sort.Strings(classes)
+	c.writeHeader(w, name, "histogram", "Round-trip times of keepalive pings by class of the connection.")
+	for _, class := range classes {
+		c.writeHistogram(w, name, fmt.Sprintf(`class=%q,`, class), histograms[class])
+	}
+}
+
+// writeHistogram writes samples of the histogram, labels are prepended to the le label and end with comma.
+func (c *Collector) writeHistogram(w *countingWriter, name, labels string, h histogram) {
+	var cumulative uint64
+	for i, b := range c.buckets {
+		cumulative += h.counts[i]
+		c.writeSample(w, name+"_bucket", fmt.Sprintf(`{%sle="%s"}`, labels, formatFloat(b)), float64(cumulative))
+	}
+	c.writeSample(w, name+"_bucket", fmt.Sprintf(`{%sle="+Inf"}`, labels), float64(h.count))
+	var set string
+	if labels != "" {
+		set = "{" + strings.TrimSuffix(labels, ",") + "}"
+	}
+	c.writeSample(w, name+"_sum", set, h.sum)
+	c.writeSample(w, name+"_count", set, float64(h.count))
+}
+
+func (c *Collector) writeMetric(w *countingWriter, name, typ, help, labels string, value float64) {
+	c.writeHeader(w, name, typ, help)
+	c.writeSample(w, name, labels, value)
+}
+
+func (c *Collector) writeHeader(w *countingWriter, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", c.namespace, name, help, c.namespace, name, typ)
+}
+
+func (c *Collector) writeSample(w *countingWriter, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s_%s%s %s\n", c.namespace, name, labels, formatFloat(value))
+}
+
+// formatCode formats the code as in RFC 7252, e.g. 2.05.
+func formatCode(code codes.Code) string {
+	return fmt.Sprintf("%d.%02d", code>>5, code&0x1f)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts written bytes and keeps the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
@@ -0,0 +1,140 @@
+package prometheus_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/metrics"
+	"github.com/plgd-dev/go-coap/v2/metrics/prometheus"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	serverStats := prometheus.NewCollector("", nil)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		var opts message.Options
+		if _, err := r.Observe(); err == nil {
+			opts = append(opts, message.Option{ID: message.Observe, Value: []byte{2}})
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")), opts...)
+		require.NoError(t, err)
+	}), udp.WithStats(serverStats))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	clientStats := prometheus.NewCollector("client", []float64{1})
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithStats(clientStats))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+	resp, err = cc.Get(ctx, "/a", message.Option{ID: message.Observe, Value: []byte{}})
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+
+	var buf bytes.Buffer
+	_, err = clientStats.WriteTo(&buf)
+	require.NoError(t, err)
+	out := buf.String()
+	require.Contains(t, out, "# TYPE client_messages_sent_total counter\n")
+	require.Contains(t, out, `client_messages_sent_total{code="0.01",type="Confirmable"} 2`+"\n")
+	require.Contains(t, out, `client_messages_received_total{code="2.05",type="Confirmable"} 2`+"\n")
+	require.Contains(t, out, "client_sessions 1\n")
+	require.Contains(t, out, `client_exchange_duration_seconds_bucket{le="1"} 2`+"\n")
+	require.Contains(t, out, `client_exchange_duration_seconds_bucket{le="+Inf"} 2`+"\n")
+	require.Contains(t, out, "client_exchange_duration_seconds_count 2\n")
+
+	rec := httptest.NewRecorder()
+	serverStats.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	out = rec.Body.String()
+	require.Contains(t, out, `coap_messages_received_total{code="0.01",type="Confirmable"} 2`+"\n")
+	require.Contains(t, out, "coap_sessions 1\n")
+	require.Contains(t, out, "coap_observations 1\n")
+
+	// observations of the closed session are removed
+	require.NoError(t, cc.Close())
+	<-cc.Done()
+	require.Eventually(t, func() bool {
+		buf.Reset()
+		_, err := clientStats.WriteTo(&buf)
+		return err == nil && strings.Contains(buf.String(), "client_sessions 0\n")
+	}, time.Second, time.Millisecond*10)
+	s.Stop()
+	require.Eventually(t, func() bool {
+		buf.Reset()
+		_, err := serverStats.WriteTo(&buf)
+		return err == nil && strings.Contains(buf.String(), "coap_sessions 0\n") && strings.Contains(buf.String(), "coap_observations 0\n")
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestCollector_KeepAliveRTT(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stats := prometheus.NewCollector("", []float64{1})
+	params := inactivity.NewKeepAliveParams(time.Millisecond*100, time.Second*5)
+	params.SetOnRTT(metrics.KeepAliveRTT(stats, func(cc inactivity.ClientConn) string {
+		return "lan"
+	}))
+	s := udp.NewServer(udp.WithKeepAliveParams(params, inactivity.CloseClientConn))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// the server pings the idle client
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+
+	var buf bytes.Buffer
+	require.Eventually(t, func() bool {
+		buf.Reset()
+		_, err := stats.WriteTo(&buf)
+		return err == nil && strings.Contains(buf.String(), `coap_keepalive_rtt_seconds_bucket{class="lan",le="+Inf"}`)
+	}, time.Second*2, time.Millisecond*10)
+	out := buf.String()
+	require.Contains(t, out, "# TYPE coap_keepalive_rtt_seconds histogram\n")
+	require.Contains(t, out, `coap_keepalive_rtt_seconds_bucket{class="lan",le="1"}`)
+	require.Contains(t, out, `coap_keepalive_rtt_seconds_count{class="lan"}`)
+}
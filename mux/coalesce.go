@@ -0,0 +1,119 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// flight is a GET request in progress, whose response is shared by identical requests.
+type flight struct {
+	done          chan struct{}
+	set           bool
+	code          codes.Code
+	contentFormat message.MediaType
+	body          []byte
+	hasBody       bool
+	opts          message.Options
+}
+
+// coalescingResponseWriter records the response of the handler for the waiting requests.
+type coalescingResponseWriter struct {
+	ResponseWriter
+	f *flight
+}
+
+func (w *coalescingResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	f := w.f
+	f.set = true
+	f.code = code
+	f.contentFormat = contentFormat
+	f.opts = append(f.opts[:0], opts...)
+	f.body = nil
+	f.hasBody = d != nil
+	if d != nil {
+		body, err := ioutil.ReadAll(d)
+		if err != nil {
+			return err
+		}
+		f.body = body
+		d = bytes.NewReader(body)
+	}
+	return w.ResponseWriter.SetResponse(code, contentFormat, d, opts...)
+}
+
+func (f *flight) setResponse(w ResponseWriter) {
+	if !f.set {
+		return
+	}
+	var d io.ReadSeeker
+	if f.hasBody {
+		d = bytes.NewReader(f.body)
+	}
+	w.SetResponse(f.code, f.contentFormat, d, f.opts...)
+}
+
+// coalesceKey returns the key of the request composed of its cache-key options (RFC 7252 section 5.6).
+func coalesceKey(r *Message) string {
+	var b strings.Builder
+	buf := make([]byte, 4)
+	for _, opt := range r.Options {
+		if opt.ID.NoCacheKey() || opt.ID == message.Observe {
+			continue
+		}
+		binary.BigEndian.PutUint16(buf, uint16(opt.ID))
+		binary.BigEndian.PutUint16(buf[2:], uint16(len(opt.Value)))
+		b.Write(buf)
+		b.Write(opt.Value)
+	}
+	return b.String()
+}
+
+// Coalesce returns middleware which coalesces identical concurrent GET requests, e.g. of many clients after
+// an event, so the handler is invoked once and the waiting requests get a copy of its response. Requests are
+// identical when their cache-key options (RFC 7252 section 5.6), e.g. Uri-Path, Uri-Query and Accept, are equal.
+// Observe requests are passed to the handler, so every observer is registered. A waiting request whose context
+// is done gets no response.
+func Coalesce() MiddlewareFunc {
+	var mutex sync.Mutex
+	flights := make(map[string]*flight)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			if r.Code != codes.GET || r.Options.HasOption(message.Observe) {
+				next.ServeCOAP(w, r)
+				return
+			}
+			key := coalesceKey(r)
+			mutex.Lock()
+			if f, ok := flights[key]; ok {
+				mutex.Unlock()
+				var ctxDone <-chan struct{}
+				if r.Context != nil {
+					ctxDone = r.Context.Done()
+				}
+				select {
+				case <-f.done:
+					f.setResponse(w)
+				case <-ctxDone:
+				}
+				return
+			}
+			f := &flight{done: make(chan struct{})}
+			flights[key] = f
+			mutex.Unlock()
+			defer func() {
+				mutex.Lock()
+				delete(flights, key)
+				mutex.Unlock()
+				close(f.done)
+			}()
+			next.ServeCOAP(&coalescingResponseWriter{ResponseWriter: w, f: f}, r)
+		})
+	}
+}
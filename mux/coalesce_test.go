@@ -0,0 +1,93 @@
+package mux_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type bodyResponseWriter struct {
+	code codes.Code
+	body []byte
+}
+
+func (w *bodyResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	if d != nil {
+		body, err := ioutil.ReadAll(d)
+		if err != nil {
+			return err
+		}
+		w.body = body
+	}
+	return nil
+}
+
+func (w *bodyResponseWriter) Client() mux.Client {
+	return nil
+}
+
+func TestCoalesce(t *testing.T) {
+	var calls uint32
+	release := make(chan struct{})
+	r := mux.NewRouter()
+	r.Use(mux.Coalesce())
+	r.HandleFunc("/a", func(w mux.ResponseWriter, r *mux.Message) {
+		atomic.AddUint32(&calls, 1)
+		<-release
+		query, _ := r.Options.Queries()
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("slow"+strings.Join(query, "&"))))
+	})
+
+	request := func(opts ...message.Option) *mux.Message {
+		options := message.Options{}.Add(message.Option{ID: message.URIPath, Value: []byte("a")})
+		for _, opt := range opts {
+			options = options.Add(opt)
+		}
+		return &mux.Message{Message: &message.Message{Code: codes.GET, Options: options}}
+	}
+
+	var wg sync.WaitGroup
+	writers := make([]*bodyResponseWriter, 5)
+	for i := range writers {
+		writers[i] = &bodyResponseWriter{}
+		wg.Add(1)
+		go func(w *bodyResponseWriter) {
+			defer wg.Done()
+			r.ServeCOAP(w, request())
+		}(writers[i])
+	}
+	// other query is other resource
+	other := &bodyResponseWriter{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.ServeCOAP(other, request(message.Option{ID: message.URIQuery, Value: []byte("x")}))
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadUint32(&calls) == 2 }, time.Second, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, uint32(2), atomic.LoadUint32(&calls))
+	for _, w := range writers {
+		require.Equal(t, codes.Content, w.code)
+		require.Equal(t, []byte("slow"), w.body)
+	}
+	require.Equal(t, []byte("slowx"), other.body)
+
+	// observers are registered by the handler
+	w := &bodyResponseWriter{}
+	r.ServeCOAP(w, request(message.Option{ID: message.Observe, Value: []byte{}}))
+	require.Equal(t, uint32(3), atomic.LoadUint32(&calls))
+}
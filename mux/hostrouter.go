@@ -0,0 +1,117 @@
+package mux
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// HostRouter is an COAP request multiplexer for virtual hosting. It matches the
+// Uri-Host and Uri-Port options of each incoming request against registered hosts and
+// calls the handler of the host, so one listener can serve multiple logical origins.
+// Requests without Uri-Host or with an unregistered host are passed to the default handler.
+// HostRouter is also safe for concurrent access from multiple goroutines.
+type HostRouter struct {
+	hosts          map[string]Handler
+	m              *sync.RWMutex
+	defaultHandler Handler
+}
+
+// NewHostRouter allocates and returns a new HostRouter.
+func NewHostRouter() *HostRouter {
+	return &HostRouter{
+		hosts: make(map[string]Handler),
+		m:     new(sync.RWMutex),
+		defaultHandler: HandlerFunc(func(w ResponseWriter, r *Message) {
+			w.SetResponse(codes.NotFound, message.TextPlain, nil)
+		}),
+	}
+}
+
+// host normalizes registered host, it is case insensitive.
+func host(h string) (string, error) {
+	if h == "" {
+		return "", errors.New("empty host")
+	}
+	if name, port, err := net.SplitHostPort(h); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", errors.New("invalid port")
+		}
+		return net.JoinHostPort(strings.ToLower(name), port), nil
+	}
+	return strings.ToLower(h), nil
+}
+
+// Handle adds a handler, e.g. a Router, to the HostRouter for host. The host is a value of Uri-Host,
+// optionally with Uri-Port as "host:port", which takes precedence over the host without port.
+func (r *HostRouter) Handle(h string, handler Handler) error {
+	h, err := host(h)
+	if err != nil {
+		return err
+	}
+	if handler == nil {
+		return errors.New("nil handler")
+	}
+	r.m.Lock()
+	r.hosts[h] = handler
+	r.m.Unlock()
+	return nil
+}
+
+// HandleRemove deregistrars the handler specific for host from the HostRouter.
+func (r *HostRouter) HandleRemove(h string) error {
+	h, err := host(h)
+	if err != nil {
+		return err
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.hosts[h]; ok {
+		delete(r.hosts, h)
+		return nil
+	}
+	return errors.New("host is not registered in")
+}
+
+// DefaultHandle set default handler to the HostRouter, which serves requests without Uri-Host
+// or with an unregistered host.
+func (r *HostRouter) DefaultHandle(handler Handler) {
+	r.m.Lock()
+	r.defaultHandler = handler
+	r.m.Unlock()
+}
+
+// Find a handler for Uri-Host and Uri-Port of the request.
+func (r *HostRouter) match(options message.Options) Handler {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	uriHost, err := options.GetString(message.URIHost)
+	if err != nil || uriHost == "" {
+		return r.defaultHandler
+	}
+	uriHost = strings.ToLower(uriHost)
+	if uriPort, err := options.GetUint32(message.URIPort); err == nil {
+		// IP-literal has brackets which are added by JoinHostPort
+		if h, ok := r.hosts[net.JoinHostPort(strings.Trim(uriHost, "[]"), strconv.FormatUint(uint64(uriPort), 10))]; ok {
+			return h
+		}
+	}
+	if h, ok := r.hosts[uriHost]; ok {
+		return h
+	}
+	return r.defaultHandler
+}
+
+// ServeCOAP dispatches the request to the handler of its Uri-Host.
+func (r *HostRouter) ServeCOAP(w ResponseWriter, req *Message) {
+	h := r.match(req.Options)
+	if h == nil {
+		return
+	}
+	h.ServeCOAP(w, req)
+}
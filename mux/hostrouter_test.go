@@ -0,0 +1,59 @@
+package mux_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type responseWriter struct {
+	code codes.Code
+}
+
+func (w *responseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	return nil
+}
+
+func (w *responseWriter) Client() mux.Client {
+	return nil
+}
+
+func TestHostRouter(t *testing.T) {
+	handler := func(code codes.Code) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			w.SetResponse(code, message.TextPlain, nil)
+		})
+	}
+	r := mux.NewHostRouter()
+	a := mux.NewRouter()
+	a.Handle("/a", handler(codes.Content))
+	require.NoError(t, r.Handle("A.example", a))
+	require.NoError(t, r.Handle("a.example:5684", handler(codes.Valid)))
+	require.NoError(t, r.Handle("[::1]:5683", handler(codes.Changed)))
+	require.Error(t, r.Handle("", a))
+	require.Error(t, r.Handle("a.example:http", a))
+
+	serve := func(opts ...message.Option) codes.Code {
+		w := &responseWriter{}
+		r.ServeCOAP(w, &mux.Message{Message: &message.Message{Options: append(opts, message.Option{ID: message.URIPath, Value: []byte("a")})}})
+		return w.code
+	}
+	require.Equal(t, codes.Content, serve(message.Option{ID: message.URIHost, Value: []byte("a.example")}))
+	require.Equal(t, codes.Content, serve(message.Option{ID: message.URIHost, Value: []byte("a.EXAMPLE")}, message.Option{ID: message.URIPort, Value: []byte{0x16, 0x33}}))
+	require.Equal(t, codes.Valid, serve(message.Option{ID: message.URIHost, Value: []byte("a.example")}, message.Option{ID: message.URIPort, Value: []byte{0x16, 0x34}}))
+	require.Equal(t, codes.Changed, serve(message.Option{ID: message.URIHost, Value: []byte("[::1]")}, message.Option{ID: message.URIPort, Value: []byte{0x16, 0x33}}))
+	// absent and unregistered hosts are served by default handler
+	require.Equal(t, codes.NotFound, serve())
+	require.Equal(t, codes.NotFound, serve(message.Option{ID: message.URIHost, Value: []byte("b.example")}))
+	r.DefaultHandle(a)
+	require.Equal(t, codes.Content, serve())
+
+	require.NoError(t, r.HandleRemove("a.example"))
+	require.Error(t, r.HandleRemove("a.example"))
+	require.Equal(t, codes.Content, serve(message.Option{ID: message.URIHost, Value: []byte("c.example")}))
+}
@@ -10,7 +10,18 @@ func (mw MiddlewareFunc) Middleware(handler Handler) Handler {
 	return mw(handler)
 }
 
+// Chain wraps the handler by middlewares, the first one is executed first.
+func Chain(handler Handler, mwf ...MiddlewareFunc) Handler {
+	for i := len(mwf) - 1; i >= 0; i-- {
+		handler = mwf[i].Middleware(handler)
+	}
+	return handler
+}
+
 // Use appends a MiddlewareFunc to the chain. Middleware can be used to intercept or otherwise modify requests and/or responses, and are executed in the order that they are applied to the Router.
+// They are executed for all requests, including the ones served by the default handler, before middlewares of the route.
 func (r *Router) Use(mwf ...MiddlewareFunc) {
+	r.m.Lock()
+	defer r.m.Unlock()
 	r.middlewares = append(r.middlewares, mwf...)
 }
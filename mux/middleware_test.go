@@ -0,0 +1,53 @@
+package mux_test
+
+import (
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Middlewares(t *testing.T) {
+	var calls []string
+	middleware := func(name string) mux.MiddlewareFunc {
+		return func(next mux.Handler) mux.Handler {
+			return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+				calls = append(calls, name)
+				next.ServeCOAP(w, r)
+			})
+		}
+	}
+	deny := func(next mux.Handler) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			w.SetResponse(codes.Unauthorized, message.TextPlain, nil)
+		})
+	}
+	r := mux.NewRouter()
+	r.Use(middleware("router1"), middleware("router2"))
+	require.NoError(t, r.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		calls = append(calls, "handler")
+		w.SetResponse(codes.Content, message.TextPlain, nil)
+	}), middleware("route1"), middleware("route2")))
+	r.HandleFunc("/b", func(w mux.ResponseWriter, r *mux.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, nil)
+	}, deny)
+
+	serve := func(path string) codes.Code {
+		w := &responseWriter{}
+		r.ServeCOAP(w, &mux.Message{Message: &message.Message{Options: message.Options{{ID: message.URIPath, Value: []byte(path)}}}})
+		return w.code
+	}
+	require.Equal(t, codes.Content, serve("a"))
+	require.Equal(t, []string{"router1", "router2", "route1", "route2", "handler"}, calls)
+
+	calls = nil
+	require.Equal(t, codes.Unauthorized, serve("b"))
+	require.Equal(t, []string{"router1", "router2"}, calls)
+
+	// middlewares of the router are executed for the default handler too
+	calls = nil
+	require.Equal(t, codes.NotFound, serve("c"))
+	require.Equal(t, []string{"router1", "router2"}, calls)
+}
@@ -0,0 +1,139 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type segmentKind int
+
+// kinds are ordered by precedence, e.g. a literal segment wins over a variable at the same position.
+const (
+	literalSegment segmentKind = iota
+	variableSegment
+	wildcardSegment
+)
+
+type segment struct {
+	kind segmentKind
+	// value is the literal or the name of the variable.
+	value string
+}
+
+// WildcardVar is the key of Vars with the path matched by trailing wildcard of the pattern.
+const WildcardVar = "*"
+
+type varsKey struct{}
+
+// Vars returns variables of the pattern of the route which serves the request, e.g. "id" of "/devices/{id}",
+// and the rest of the path matched by trailing wildcard under WildcardVar.
+func Vars(r *Message) map[string]string {
+	if r == nil || r.Message == nil || r.Context == nil {
+		return nil
+	}
+	vars, _ := r.Context.Value(varsKey{}).(map[string]string)
+	return vars
+}
+
+func setVars(r *Message, vars map[string]string) {
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r.Context = context.WithValue(ctx, varsKey{}, vars)
+}
+
+// parsePattern splits the pattern to segments. Segment "{name}" is a variable which matches any segment of the
+// path and "*" as the last segment matches one or more segments, the same as the empty last segment of the
+// prefix pattern "fw/".
+func parsePattern(pattern string) ([]segment, error) {
+	if pattern == "/" {
+		// root is the empty path
+		return []segment{{kind: literalSegment}}, nil
+	}
+	parts := strings.Split(pattern, "/")
+	segments := make([]segment, 0, len(parts))
+	names := make(map[string]bool)
+	for i, p := range parts {
+		last := i == len(parts)-1
+		switch {
+		case p == "*" || (p == "" && last && i > 0):
+			if !last {
+				return nil, fmt.Errorf("invalid pattern %v: wildcard is not the last segment", pattern)
+			}
+			segments = append(segments, segment{kind: wildcardSegment, value: WildcardVar})
+		case strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}"):
+			name := p[1 : len(p)-1]
+			if name == "" || strings.ContainsAny(name, "{}*") {
+				return nil, fmt.Errorf("invalid pattern %v: invalid variable %v", pattern, p)
+			}
+			if names[name] {
+				return nil, fmt.Errorf("invalid pattern %v: duplicate variable %v", pattern, name)
+			}
+			names[name] = true
+			segments = append(segments, segment{kind: variableSegment, value: name})
+		case strings.ContainsAny(p, "{}*"):
+			return nil, fmt.Errorf("invalid pattern %v: invalid segment %v", pattern, p)
+		default:
+			segments = append(segments, segment{kind: literalSegment, value: p})
+		}
+	}
+	return segments, nil
+}
+
+// isTemplate reports whether the pattern contains variables or wildcard, so it isn't a path of a resource.
+func isTemplate(pattern string) bool {
+	return strings.ContainsAny(pattern, "{*")
+}
+
+// splitPath splits the path of the request to segments.
+func splitPath(path string) []string {
+	if path == "/" {
+		path = ""
+	}
+	return strings.Split(path, "/")
+}
+
+// matchSegments matches the path split to segments. It returns variables of the pattern.
+func matchSegments(segments []segment, path []string) (map[string]string, bool) {
+	var vars map[string]string
+	setVar := func(name, value string) {
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+		vars[name] = value
+	}
+	for i, s := range segments {
+		if s.kind == wildcardSegment {
+			if len(path) <= i {
+				return nil, false
+			}
+			setVar(s.value, strings.Join(path[i:], "/"))
+			return vars, true
+		}
+		if len(path) <= i {
+			return nil, false
+		}
+		switch s.kind {
+		case literalSegment:
+			if s.value != path[i] {
+				return nil, false
+			}
+		case variableSegment:
+			setVar(s.value, path[i])
+		}
+	}
+	return vars, len(path) == len(segments)
+}
+
+// morePrecise reports whether pattern a takes precedence over pattern b when both match a path. Segments are
+// compared from the start and the first different kind decides: literal > variable > wildcard.
+func morePrecise(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].kind != b[i].kind {
+			return a[i].kind < b[i].kind
+		}
+	}
+	return len(a) > len(b)
+}
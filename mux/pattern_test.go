@@ -0,0 +1,69 @@
+package mux_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Patterns(t *testing.T) {
+	var vars map[string]string
+	handler := func(code codes.Code) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			vars = mux.Vars(r)
+			w.SetResponse(code, message.TextPlain, nil)
+		})
+	}
+	r := mux.NewRouter()
+	require.NoError(t, r.Handle("/devices/{id}/sensors/{name}", handler(codes.Content)))
+	require.NoError(t, r.Handle("/devices/{id}/sensors/temp", handler(codes.Valid)))
+	require.NoError(t, r.Handle("/devices/1/sensors/temp", handler(codes.Changed)))
+	require.NoError(t, r.Handle("/devices/*", handler(codes.Created)))
+	require.NoError(t, r.Handle("/fw/", handler(codes.Deleted)))
+	require.NoError(t, r.Handle("/", handler(codes.Continue)))
+	require.Error(t, r.Handle("/devices/*/sensors", handler(codes.Content)))
+	require.Error(t, r.Handle("/devices/{id}/{id}", handler(codes.Content)))
+	require.Error(t, r.Handle("/devices/{}", handler(codes.Content)))
+	require.Error(t, r.Handle("/devices/a{id}", handler(codes.Content)))
+
+	serve := func(path string) codes.Code {
+		vars = nil
+		var opts message.Options
+		for _, s := range strings.Split(path, "/") {
+			if s != "" {
+				opts = append(opts, message.Option{ID: message.URIPath, Value: []byte(s)})
+			}
+		}
+		w := &responseWriter{}
+		r.ServeCOAP(w, &mux.Message{Message: &message.Message{Options: opts}})
+		return w.code
+	}
+	require.Equal(t, codes.Changed, serve("/devices/1/sensors/temp"))
+	require.Nil(t, vars)
+	require.Equal(t, codes.Valid, serve("/devices/2/sensors/temp"))
+	require.Equal(t, map[string]string{"id": "2"}, vars)
+	require.Equal(t, codes.Content, serve("/devices/2/sensors/humidity"))
+	require.Equal(t, map[string]string{"id": "2", "name": "humidity"}, vars)
+	require.Equal(t, codes.Created, serve("/devices/2/sensors"))
+	require.Equal(t, map[string]string{mux.WildcardVar: "2/sensors"}, vars)
+	require.Equal(t, codes.Created, serve("/devices/2/sensors/temp/raw"))
+	require.Equal(t, codes.NotFound, serve("/devices"))
+	require.Equal(t, codes.Deleted, serve("/fw/image/1"))
+	require.Equal(t, map[string]string{mux.WildcardVar: "image/1"}, vars)
+	// request without Uri-Path is served by the default handler
+	require.Equal(t, codes.NotFound, serve("/"))
+
+	require.NoError(t, r.HandleRemove("/devices/*"))
+	require.Equal(t, codes.NotFound, serve("/devices/2/sensors"))
+	require.Equal(t, []string{"/", "/devices/1/sensors/temp", "/fw/"}, func() []string {
+		var hrefs []string
+		for _, res := range r.Resources() {
+			hrefs = append(hrefs, res.Href)
+		}
+		return hrefs
+	}())
+}
@@ -0,0 +1,79 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// RenderFunc renders representation of the resource requested by r in the content format it is registered for.
+type RenderFunc func(r *Message) ([]byte, error)
+
+// Formats is Handler of a resource with multiple representations. The representation is picked by the Accept
+// option of the request and it is answered by 4.06 (Not Acceptable) when the resource has no representation in the
+// accepted content format. Without Accept the representation with the lowest content format number is picked.
+// GET and FETCH are rendered, other methods are answered by 4.05 (Method Not Allowed).
+type Formats map[message.MediaType]RenderFunc
+
+// ContentFormats returns content formats of the representations in ascending order.
+func (f Formats) ContentFormats() []message.MediaType {
+	cts := make([]message.MediaType, 0, len(f))
+	for ct := range f {
+		cts = append(cts, ct)
+	}
+	sort.Slice(cts, func(i, j int) bool {
+		return cts[i] < cts[j]
+	})
+	return cts
+}
+
+// Negotiate returns content format of the representation which answers the request.
+func (f Formats) Negotiate(r *Message) (message.MediaType, codes.Code) {
+	accept, err := r.Options.Accept()
+	switch {
+	case err == nil:
+		if _, ok := f[accept]; !ok {
+			return 0, codes.NotAcceptable
+		}
+		return accept, codes.Content
+	case errors.Is(err, message.ErrOptionNotFound):
+		cts := f.ContentFormats()
+		if len(cts) == 0 {
+			return 0, codes.NotAcceptable
+		}
+		return cts[0], codes.Content
+	}
+	return 0, codes.BadOption
+}
+
+func (f Formats) ServeCOAP(w ResponseWriter, r *Message) {
+	if r.Code != codes.GET && r.Code != codes.FETCH {
+		w.SetResponse(codes.MethodNotAllowed, message.TextPlain, nil)
+		return
+	}
+	ct, code := f.Negotiate(r)
+	if code != codes.Content {
+		w.SetResponse(code, message.TextPlain, nil)
+		return
+	}
+	payload, err := f[ct](r)
+	if err != nil {
+		w.SetResponse(codes.InternalServerError, message.TextPlain, bytes.NewReader([]byte(err.Error())))
+		return
+	}
+	w.SetResponse(codes.Content, ct, bytes.NewReader(payload))
+}
+
+// HandleFormats adds a resource with representations in multiple content formats to the Router for pattern.
+// The content formats are listed as ct attribute by /.well-known/core. See Formats.
+func (r *Router) HandleFormats(pattern string, formats map[message.MediaType]RenderFunc, middlewares ...MiddlewareFunc) error {
+	if len(formats) == 0 {
+		return errors.New("no formats")
+	}
+	f := Formats(formats)
+	return r.HandleResource(pattern, f, linkformat.Resource{ContentFormats: f.ContentFormats()}, middlewares...)
+}
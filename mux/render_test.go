@@ -0,0 +1,79 @@
+package mux_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type formatWriter struct {
+	code          codes.Code
+	contentFormat message.MediaType
+	body          string
+}
+
+func (w *formatWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	w.contentFormat = contentFormat
+	if d != nil {
+		b, err := io.ReadAll(d)
+		if err != nil {
+			return err
+		}
+		w.body = string(b)
+	}
+	return nil
+}
+
+func (w *formatWriter) Client() mux.Client {
+	return nil
+}
+
+func TestRouter_HandleFormats(t *testing.T) {
+	r := mux.NewRouter()
+	err := r.HandleFormats("/temp", map[message.MediaType]mux.RenderFunc{
+		message.AppJSON: func(*mux.Message) ([]byte, error) {
+			return []byte(`{"temp":20}`), nil
+		},
+		message.TextPlain: func(*mux.Message) ([]byte, error) {
+			return []byte("20"), nil
+		},
+		message.AppCBOR: func(*mux.Message) ([]byte, error) {
+			return nil, errors.New("cbor is broken")
+		},
+	})
+	require.NoError(t, err)
+	require.Error(t, r.HandleFormats("/empty", nil))
+
+	serve := func(code codes.Code, opts ...message.Option) *formatWriter {
+		w := &formatWriter{}
+		opts = append(message.Options{{ID: message.URIPath, Value: []byte("temp")}}, opts...)
+		r.ServeCOAP(w, &mux.Message{Message: &message.Message{Code: code, Options: opts}})
+		return w
+	}
+	accept := func(ct message.MediaType) message.Option {
+		buf := make([]byte, 4)
+		n, _ := message.EncodeUint32(buf, uint32(ct))
+		return message.Option{ID: message.Accept, Value: buf[:n]}
+	}
+
+	w := serve(codes.GET, accept(message.AppJSON))
+	require.Equal(t, codes.Content, w.code)
+	require.Equal(t, message.AppJSON, w.contentFormat)
+	require.Equal(t, `{"temp":20}`, w.body)
+
+	// the lowest content format is picked without Accept
+	w = serve(codes.GET)
+	require.Equal(t, codes.Content, w.code)
+	require.Equal(t, message.TextPlain, w.contentFormat)
+	require.Equal(t, "20", w.body)
+
+	require.Equal(t, codes.NotAcceptable, serve(codes.GET, accept(message.AppXML)).code)
+	require.Equal(t, codes.InternalServerError, serve(codes.FETCH, accept(message.AppCBOR)).code)
+	require.Equal(t, codes.MethodNotAllowed, serve(codes.PUT, accept(message.AppJSON)).code)
+}
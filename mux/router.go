@@ -3,8 +3,10 @@ package mux
 import (
 	"errors"
 	"io"
+	"strings"
 	"sync"
 
+	"github.com/plgd-dev/go-coap/v2/linkformat"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 )
@@ -42,8 +44,10 @@ type Router struct {
 }
 
 type muxEntry struct {
-	h       Handler
-	pattern string
+	h        Handler
+	pattern  string
+	segments []segment
+	resource linkformat.Resource
 }
 
 // NewRouter allocates and returns a new Router.
@@ -58,60 +62,60 @@ func NewRouter() *Router {
 	}
 }
 
-// Does path match pattern?
-func pathMatch(pattern, path string) bool {
+// normalizePattern removes the leading slash, the root is "/".
+func normalizePattern(pattern string) string {
 	switch pattern {
 	case "", "/":
-		switch path {
-		case "", "/":
-			return true
-		}
-		return false
-	default:
-		n := len(pattern)
-		if pattern[n-1] != '/' {
-			return pattern == path
-		}
-		return len(path) >= n && path[0:n] == pattern
+		return "/"
 	}
+	return strings.TrimPrefix(pattern, "/")
 }
 
-// Find a handler on a handler map given a path string
-// Most-specific (longest) pattern wins
-func (r *Router) match(path string) (h Handler, pattern string) {
+// Find a handler on a handler map given a path string.
+// Exact pattern wins over pattern with variables, which wins over pattern with wildcard, see morePrecise.
+func (r *Router) match(path string) (h Handler, pattern string, vars map[string]string, middlewares []MiddlewareFunc) {
+	segments := splitPath(path)
 	r.m.RLock()
 	defer r.m.RUnlock()
-	var n = 0
-	for k, v := range r.z {
-		if !pathMatch(k, path) {
+	middlewares = r.middlewares
+	var best []segment
+	for _, v := range r.z {
+		matched, ok := matchSegments(v.segments, segments)
+		if !ok {
 			continue
 		}
-		if h == nil || len(k) > n {
-			n = len(k)
-			h = v.h
-			pattern = v.pattern
+		// pattern breaks tie of patterns which differ only by names of variables
+		if h == nil || morePrecise(v.segments, best) || (!morePrecise(best, v.segments) && v.pattern < pattern) {
+			h, pattern, vars, best = v.h, v.pattern, matched, v.segments
 		}
 	}
 	return
 }
 
-// Handle adds a handler to the Router for pattern.
-func (r *Router) Handle(pattern string, handler Handler) error {
-	switch pattern {
-	case "", "/":
-		pattern = "/"
-	default:
-		if pattern[0] == '/' {
-			pattern = pattern[1:]
-		}
-	}
+// Handle adds a handler to the Router for pattern. Segment of the pattern "{name}" matches any segment of the path
+// and trailing "*" matches the rest of the path, e.g. "/devices/{id}/sensors/{name}" or "/fw/*". Handler gets the
+// matched segments by Vars. Pattern with trailing slash, e.g. "/fw/", matches the same paths as "/fw/*".
+// The middlewares wrap only the handler of the route, they are executed after the ones added by Use.
+func (r *Router) Handle(pattern string, handler Handler, middlewares ...MiddlewareFunc) error {
+	return r.HandleResource(pattern, handler, linkformat.Resource{}, middlewares...)
+}
 
+// HandleResource adds a handler to the Router for pattern with attributes of the resource, e.g. rt, if
+// or ct, which are listed by /.well-known/core. Href of the resource is set to the pattern.
+func (r *Router) HandleResource(pattern string, handler Handler, resource linkformat.Resource, middlewares ...MiddlewareFunc) error {
+	pattern = normalizePattern(pattern)
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
 	if handler == nil {
 		return errors.New("nil handler")
 	}
 
+	resource.Href = "/" + strings.TrimPrefix(pattern, "/")
+	handler = Chain(handler, middlewares...)
 	r.m.Lock()
-	r.z[pattern] = muxEntry{h: handler, pattern: pattern}
+	r.z[pattern] = muxEntry{h: handler, pattern: pattern, segments: segments, resource: resource}
 	r.m.Unlock()
 	return nil
 }
@@ -124,8 +128,8 @@ func (r *Router) DefaultHandle(handler Handler) {
 }
 
 // HandleFunc adds a handler function to the Router for pattern.
-func (r *Router) HandleFunc(pattern string, handler func(w ResponseWriter, r *Message)) {
-	r.Handle(pattern, HandlerFunc(handler))
+func (r *Router) HandleFunc(pattern string, handler func(w ResponseWriter, r *Message), middlewares ...MiddlewareFunc) {
+	r.Handle(pattern, HandlerFunc(handler), middlewares...)
 }
 
 // DefaultHandleFunc set a default handler function to the Router.
@@ -135,10 +139,7 @@ func (r *Router) DefaultHandleFunc(handler func(w ResponseWriter, r *Message)) {
 
 // HandleRemove deregistrars the handler specific for pattern from the Router.
 func (r *Router) HandleRemove(pattern string) error {
-	switch pattern {
-	case "", "/":
-		pattern = "/"
-	}
+	pattern = normalizePattern(pattern)
 	r.m.Lock()
 	defer r.m.Unlock()
 	if _, ok := r.z[pattern]; ok {
@@ -156,18 +157,23 @@ func (r *Router) HandleRemove(pattern string) error {
 func (r *Router) ServeCOAP(w ResponseWriter, req *Message) {
 	path, err := req.Options.Path()
 	if err != nil {
-		r.defaultHandler.ServeCOAP(w, req)
+		r.m.RLock()
+		h := r.defaultHandler
+		r.m.RUnlock()
+		h.ServeCOAP(w, req)
 		return
 	}
-	h, _ := r.match(path)
+	h, _, vars, middlewares := r.match(path)
+	if vars != nil {
+		setVars(req, vars)
+	}
 	if h == nil {
+		r.m.RLock()
 		h = r.defaultHandler
+		r.m.RUnlock()
 	}
 	if h == nil {
 		return
 	}
-	for i := len(r.middlewares) - 1; i >= 0; i-- {
-		h = r.middlewares[i].Middleware(h)
-	}
-	h.ServeCOAP(w, req)
+	Chain(h, middlewares...).ServeCOAP(w, req)
 }
@@ -0,0 +1,130 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+)
+
+// Resources returns resources of registered handlers sorted by href. Patterns with variables or wildcard
+// aren't resources, so they are omitted.
+func (r *Router) Resources() []linkformat.Resource {
+	r.m.RLock()
+	resources := make([]linkformat.Resource, 0, len(r.z))
+	for _, v := range r.z {
+		if v.resource.Href == linkformat.WellKnownCore || isTemplate(v.pattern) {
+			continue
+		}
+		resources = append(resources, v.resource)
+	}
+	r.m.RUnlock()
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Href < resources[j].Href
+	})
+	return resources
+}
+
+type wellKnownCoreOptions struct {
+	szx blockwise.SZX
+	// paginate is set by WithBlockSize
+	paginate bool
+}
+
+// WellKnownCoreOption configures the handler of HandleWellKnownCore.
+type WellKnownCoreOption func(*wellKnownCoreOptions)
+
+// WithBlockSize makes the handler serve listings larger than the block size by Block2 (RFC 7959) pages.
+// Use it on connections with disabled blockwise transfers, otherwise the connection splits the listing itself.
+func WithBlockSize(szx blockwise.SZX) WellKnownCoreOption {
+	return func(o *wellKnownCoreOptions) {
+		if szx > blockwise.SZX1024 {
+			szx = blockwise.SZX1024
+		}
+		o.szx = szx
+		o.paginate = true
+	}
+}
+
+// HandleWellKnownCore adds a handler for /.well-known/core, which lists resources of registered handlers
+// in CoRE Link Format (RFC 6690) filtered by the queries of the request, e.g. ct=50. Requests with Block2 option,
+// which pass the connection only when its blockwise transfers are disabled, get the requested block of the listing.
+func (r *Router) HandleWellKnownCore(opts ...WellKnownCoreOption) error {
+	cfg := wellKnownCoreOptions{
+		szx: blockwise.SZX1024,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return r.Handle(linkformat.WellKnownCore, HandlerFunc(func(w ResponseWriter, req *Message) {
+		if req.Code != codes.GET {
+			w.SetResponse(codes.MethodNotAllowed, message.TextPlain, nil)
+			return
+		}
+		queries, err := req.Options.Queries()
+		if err != nil && !errors.Is(err, message.ErrOptionNotFound) {
+			w.SetResponse(codes.BadOption, message.TextPlain, nil)
+			return
+		}
+		resources, err := linkformat.Filter(r.Resources(), queries...)
+		if err != nil {
+			w.SetResponse(codes.BadRequest, message.TextPlain, nil)
+			return
+		}
+		data := linkformat.Encode(resources)
+		block, err := req.Options.GetUint32(message.Block2)
+		if err != nil {
+			if !cfg.paginate || int64(len(data)) <= cfg.szx.Size() {
+				w.SetResponse(codes.Content, message.AppLinkFormat, bytes.NewReader(data))
+				return
+			}
+			block, _ = blockwise.EncodeBlockOption(cfg.szx, 0, false)
+		}
+		writeBlock(w, data, block, cfg.szx)
+	}))
+}
+
+// writeBlock writes the block of the listing requested by the value of Block2 option. The block size is
+// the smaller one of the request and of the handler.
+func writeBlock(w ResponseWriter, data []byte, block uint32, maxSZX blockwise.SZX) {
+	szx, num, _, err := blockwise.DecodeBlockOption(block)
+	if err != nil {
+		w.SetResponse(codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	if szx > maxSZX {
+		// the block number is kept for the same offset in smaller blocks (RFC 7959 section 2.4)
+		num = num * (szx.Size() / maxSZX.Size())
+		szx = maxSZX
+	}
+	size := szx.Size()
+	off := num * size
+	if off > 0 && off >= int64(len(data)) {
+		w.SetResponse(codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	end := off + size
+	more := end < int64(len(data))
+	if !more {
+		end = int64(len(data))
+	}
+	value, err := blockwise.EncodeBlockOption(szx, num, more)
+	if err != nil {
+		w.SetResponse(codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	// ETag of the whole listing, so the client restarts the transfer when the listing changes between blocks
+	w.SetResponse(codes.Content, message.AppLinkFormat, bytes.NewReader(data[off:end]),
+		uint32Option(message.Block2, value), uint32Option(message.Size2, uint32(len(data))),
+		message.Option{ID: message.ETag, Value: message.AppendETag(nil, data)})
+}
+
+func uint32Option(id message.OptionID, value uint32) message.Option {
+	buf := make([]byte, 4)
+	n, _ := message.EncodeUint32(buf, value)
+	return message.Option{ID: id, Value: buf[:n]}
+}
@@ -3,9 +3,11 @@ package blockwise
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/semaphore"
@@ -128,6 +130,11 @@ type hasType interface {
 	SetType(t udpMessage.Type)
 }
 
+// hasMessageID is implemented by messages of UDP and DTLS, whose request sent again is a new exchange.
+type hasMessageID interface {
+	ResetMessageID()
+}
+
 // EncodeBlockOption encodes block values to coap option.
 func EncodeBlockOption(szx SZX, blockNumber int64, moreBlocksFollowing bool) (uint32, error) {
 	if szx > SZXBERT {
@@ -175,6 +182,16 @@ type BlockWise struct {
 	errors                      func(error)
 	autoCleanUpResponseCache    bool
 	getSendedRequestFromOutside func(token message.Token) (Message, bool)
+	limits                      Limits
+	onExpired                   ExpiredFunc
+	qblock                      bool
+	quota                       QuotaFunc
+	rateLimit                   RateLimit
+	// throttle paces all transfers with the peer
+	throttle *throttle
+	// qblockPeer is support of Q-Block by the peer, learned from responses to DoQBlock
+	qblockPeer uint32
+	progress   ProgressFunc
 
 	bwSendedRequest *senderRequestMap
 }
@@ -182,6 +199,16 @@ type BlockWise struct {
 type messageGuard struct {
 	*semaphore.Weighted
 	Message
+	// size is number of bytes held by the transfer
+	size int64
+	// deleted is set when the transfer was removed before it expired
+	deleted uint32
+	// qblock holds state of Q-Block transfer, whose blocks can arrive out of order
+	qblock *qblockTransfer
+	// quota is shared quota which counts the transfer
+	quota *Quota
+	// throttle paces blocks of the transfer
+	throttle *throttle
 }
 
 func newRequestGuard(request Message) *messageGuard {
@@ -200,28 +227,53 @@ func NewBlockWise(
 	errors func(error),
 	autoCleanUpResponseCache bool,
 	getSendedRequestFromOutside func(token message.Token) (Message, bool),
+	opts ...Option,
 ) *BlockWise {
-	receivingMessagesCache := cache.New(expiration, expiration)
+	var cfg options
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
+	receiveExpiration := expiration
+	if cfg.limits.ReceiveTimeout > 0 {
+		receiveExpiration = cfg.limits.ReceiveTimeout
+	}
+	sendExpiration := expiration
+	if cfg.limits.SendTimeout > 0 {
+		sendExpiration = cfg.limits.SendTimeout
+	}
+	receivingMessagesCache := cache.New(receiveExpiration, receiveExpiration)
+	sendingMessagesCache := cache.New(sendExpiration, sendExpiration)
 	bwSendedRequest := newSenderRequestMap()
-	receivingMessagesCache.OnEvicted(func(tokenstr string, v interface{}) {
-		if v == nil {
-			return
-		}
-		bwSendedRequest.deleteByToken(tokenstr)
-	})
 	if getSendedRequestFromOutside == nil {
 		getSendedRequestFromOutside = func(token message.Token) (Message, bool) { return nil, false }
 	}
-	return &BlockWise{
+	b := &BlockWise{
 		acquireMessage:              acquireMessage,
 		releaseMessage:              releaseMessage,
 		receivingMessagesCache:      receivingMessagesCache,
-		sendingMessagesCache:        cache.New(expiration, expiration),
+		sendingMessagesCache:        sendingMessagesCache,
 		errors:                      errors,
 		autoCleanUpResponseCache:    autoCleanUpResponseCache,
 		getSendedRequestFromOutside: getSendedRequestFromOutside,
+		limits:                      cfg.limits,
+		onExpired:                   cfg.limits.OnExpired,
+		qblock:                      cfg.qblock,
+		quota:                       cfg.quota,
+		rateLimit:                   cfg.rateLimit,
+		throttle:                    newThrottle(cfg.rateLimit.PerConnection),
 		bwSendedRequest:             bwSendedRequest,
+		progress:                    cfg.progress,
 	}
+	onReceivingEvicted := b.onEvicted(true)
+	receivingMessagesCache.OnEvicted(func(tokenstr string, v interface{}) {
+		if v == nil {
+			return
+		}
+		bwSendedRequest.deleteByToken(transferToken(tokenstr))
+		onReceivingEvicted(tokenstr, v)
+	})
+	sendingMessagesCache.OnEvicted(b.onEvicted(false))
+	return b
 }
 
 func bufferSize(szx SZX, maxMessageSize int) int64 {
@@ -259,16 +311,21 @@ func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Me
 	}
 
 	switch r.Code() {
-	case codes.POST, codes.PUT:
+	case codes.POST, codes.PUT, codes.FETCH, codes.PATCH, codes.IPATCH:
 		break
 	default:
 		return nil, fmt.Errorf("unsupported command(%v)", r.Code())
 	}
 	req.SetOptionUint32(message.Size1, uint32(payloadSize))
+	// the body is sent in multiple blocks at this point
+	if err := setRequestTag(req); err != nil {
+		return nil, err
+	}
 
 	num := int64(0)
 	buf := make([]byte, 1024)
 	szx := maxSzx
+	transfer := newThrottle(b.rateLimit.PerTransfer)
 	for {
 		newBufLen := bufferSize(szx, maxMessageSize)
 		if int64(cap(buf)) < newBufLen {
@@ -277,6 +334,10 @@ func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Me
 		buf = buf[:newBufLen]
 
 		off := int64(num * szx.Size())
+		if err := r.Context().Err(); err != nil && num > 0 {
+			// the peer drops the partially received body when no block follows
+			return nil, fmt.Errorf("transfer canceled after %v of %v bytes: %w", off, payloadSize, err)
+		}
 		newOff, err := r.Body().Seek(off, io.SeekStart)
 		if err != nil {
 			return nil, fmt.Errorf("cannot seek in payload: %w", err)
@@ -302,10 +363,16 @@ func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Me
 		}
 
 		req.SetOptionUint32(message.Block1, block)
+		if err := waitThrottles(r.Context(), int64(len(buf)), transfer, b.throttle); err != nil {
+			return nil, fmt.Errorf("cannot send block: %w", err)
+		}
 		resp, err := do(req.Message)
 		if err != nil {
 			return nil, fmt.Errorf("cannot do bw request: %w", err)
 		}
+		if resp.Code() == codes.Continue || codes.IsSuccess(resp.Code()) {
+			b.reportProgress(r.Token(), newOff+int64(readed), payloadSize)
+		}
 		block, err = resp.GetOptionUint32(message.Block1)
 		if err != nil {
 			return resp, nil
@@ -380,7 +447,7 @@ func (b *BlockWise) WriteMessage(remoteAddr net.Addr, request Message, maxSZX SZ
 	}
 
 	w := NewWriteRequestResponse(remoteAddr, request, b.acquireMessage, b.releaseMessage)
-	err = b.startSendingMessage(w, maxSZX, maxMessageSize, startSendingMessageBlock)
+	err = b.startSendingMessage(w, request, maxSZX, maxMessageSize, startSendingMessageBlock)
 	if err != nil {
 		return fmt.Errorf("cannot start writing request: %w", err)
 	}
@@ -391,7 +458,7 @@ func fitSZX(r Message, blockType message.OptionID, maxSZX SZX) SZX {
 	block, err := r.GetOptionUint32(blockType)
 	if err == nil {
 		szx, _, _, err := DecodeBlockOption(block)
-		if err != nil {
+		if err == nil {
 			if maxSZX > szx {
 				return szx
 			}
@@ -404,7 +471,7 @@ func (b *BlockWise) handleSendingMessage(w ResponseWriter, sendingMessage Messag
 	blockType := message.Block2
 	sizeType := message.Size2
 	switch sendingMessage.Code() {
-	case codes.POST, codes.PUT:
+	case codes.POST, codes.PUT, codes.FETCH, codes.PATCH, codes.IPATCH:
 		blockType = message.Block1
 		sizeType = message.Size1
 	}
@@ -417,20 +484,30 @@ func (b *BlockWise) handleSendingMessage(w ResponseWriter, sendingMessage Messag
 	if szx > maxSZX {
 		szx = maxSZX
 	}
+	sendMessage, more, err := b.newBlockMessage(sendingMessage, off, szx, maxMessageSize, token, blockType, sizeType)
+	if err != nil {
+		return false, err
+	}
+	w.SetMessage(sendMessage)
+	return more, nil
+}
+
+// newBlockMessage creates message with the block of sendingMessage body which starts at off.
+func (b *BlockWise) newBlockMessage(sendingMessage Message, off int64, szx SZX, maxMessageSize int, token []byte, blockType message.OptionID, sizeType message.OptionID) (Message, bool, error) {
 	sendMessage := b.acquireMessage(sendingMessage.Context())
 	sendMessage.SetCode(sendingMessage.Code())
 	sendMessage.ResetOptionsTo(sendingMessage.Options())
 	sendMessage.SetToken(token)
 	payloadSize, err := sendingMessage.BodySize()
 	if err != nil {
-		return false, fmt.Errorf("cannot get size of payload: %w", err)
+		return nil, false, fmt.Errorf("cannot get size of payload: %w", err)
 	}
 	offSeek, err := sendingMessage.Body().Seek(off, io.SeekStart)
 	if err != nil {
-		return false, fmt.Errorf("cannot seek in response: %w", err)
+		return nil, false, fmt.Errorf("cannot seek in response: %w", err)
 	}
 	if off != offSeek {
-		return false, fmt.Errorf("cannot seek to requested offset(%v != %v)", off, offSeek)
+		return nil, false, fmt.Errorf("cannot seek to requested offset(%v != %v)", off, offSeek)
 	}
 	buf := make([]byte, 1024)
 	newBufLen := bufferSize(szx, maxMessageSize)
@@ -453,14 +530,14 @@ func (b *BlockWise) handleSendingMessage(w ResponseWriter, sendingMessage Messag
 		more = false
 	}
 	sendMessage.SetOptionUint32(sizeType, uint32(payloadSize))
-	num = (offSeek+int64(readed))/szx.Size() - (int64(readed) / szx.Size())
-	block, err = EncodeBlockOption(szx, num, more)
+	num := (offSeek+int64(readed))/szx.Size() - (int64(readed) / szx.Size())
+	block, err := EncodeBlockOption(szx, num, more)
 	if err != nil {
-		return false, fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, num, more, err)
+		return nil, false, fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, num, more, err)
 	}
 	sendMessage.SetOptionUint32(blockType, block)
-	w.SetMessage(sendMessage)
-	return more, nil
+	b.reportProgress(token, offSeek+int64(readed), payloadSize)
+	return sendMessage, more, nil
 }
 
 // RemoveFromResponseCache removes response from cache. It need's tu be used for udp coap.
@@ -468,12 +545,25 @@ func (b *BlockWise) RemoveFromResponseCache(token message.Token) {
 	if len(token) == 0 {
 		return
 	}
-	b.sendingMessagesCache.Delete(token.String())
+	deleteTransfer(b.sendingMessagesCache, token.String())
 }
 
-func (b *BlockWise) sendEntityIncomplete(w ResponseWriter, token message.Token) {
+// HasPendingTransfers reports whether a blockwise transfer to or from the peer is in progress.
+func (b *BlockWise) HasPendingTransfers() bool {
+	return b.receivingMessagesCache.ItemCount() > 0 || b.sendingMessagesCache.ItemCount() > 0
+}
+
+func (b *BlockWise) sendEntityIncomplete(w ResponseWriter, token message.Token, err error) {
 	sendMessage := b.acquireMessage(w.Message().Context())
-	sendMessage.SetCode(codes.RequestEntityIncomplete)
+	switch {
+	case errors.Is(err, ErrReceiveLimitExceeded):
+		sendMessage.SetCode(codes.RequestEntityTooLarge)
+		sendMessage.SetOptionUint32(message.Size1, uint32(b.limits.MaxReceiveBytes))
+	case errors.Is(err, ErrSendLimitExceeded), errors.Is(err, ErrQuotaExceeded):
+		sendMessage.SetCode(codes.ServiceUnavailable)
+	default:
+		sendMessage.SetCode(codes.RequestEntityIncomplete)
+	}
 	sendMessage.SetToken(token)
 	w.SetMessage(sendMessage)
 }
@@ -483,12 +573,15 @@ func (b *BlockWise) Handle(w ResponseWriter, r Message, maxSZX SZX, maxMessageSi
 	if maxSZX > SZXBERT {
 		panic("invalid maxSZX")
 	}
+	if b.qblock && b.handleQBlock(w, r, maxSZX, maxMessageSize, next) {
+		return
+	}
 	token := r.Token()
 
 	if len(token) == 0 {
 		err := b.handleReceivedMessage(w, r, maxSZX, maxMessageSize, next)
 		if err != nil {
-			b.sendEntityIncomplete(w, token)
+			b.sendEntityIncomplete(w, token, err)
 			b.errors(fmt.Errorf("handleReceivedMessage(%v): %w", r, err))
 		}
 		return
@@ -499,19 +592,26 @@ func (b *BlockWise) Handle(w ResponseWriter, r Message, maxSZX SZX, maxMessageSi
 	if !ok {
 		err := b.handleReceivedMessage(w, r, maxSZX, maxMessageSize, next)
 		if err != nil {
-			b.sendEntityIncomplete(w, token)
+			b.sendEntityIncomplete(w, token, err)
 			b.errors(fmt.Errorf("handleReceivedMessage(%v): %w", r, err))
 		}
 		return
 	}
-	more, err := b.continueSendingMessage(w, r, maxSZX, maxMessageSize, v.(*messageGuard))
+	msgGuard := v.(*messageGuard)
+	more, err := b.continueSendingMessage(w, r, maxSZX, maxMessageSize, msgGuard)
 	if err != nil {
-		b.sendingMessagesCache.Delete(tokenStr)
+		deleteTransfer(b.sendingMessagesCache, tokenStr)
 		b.errors(fmt.Errorf("continueSendingMessage(%v): %w", r, err))
 		return
 	}
 	if b.autoCleanUpResponseCache && !more {
 		b.RemoveFromResponseCache(token)
+		return
+	}
+	if b.limits.SendTimeout > 0 {
+		// the peer made progress, so the transfer is not stalled
+		deadline, ok := msgGuard.Context().Deadline()
+		b.sendingMessagesCache.Replace(tokenStr, msgGuard, expire(b.limits.SendTimeout, deadline, ok))
 	}
 }
 
@@ -537,12 +637,26 @@ func (b *BlockWise) handleReceivedMessage(w ResponseWriter, r Message, maxSZX SZ
 		if w.Message().Code() == codes.Content && err == nil {
 			startSendingMessageBlock = block
 		}
-	case codes.POST, codes.PUT:
+	case codes.POST, codes.PUT, codes.PATCH, codes.IPATCH:
 		maxSZX = fitSZX(r, message.Block1, maxSZX)
 		err := b.processReceivedMessage(w, r, maxSZX, next, message.Block1, message.Size1)
 		if err != nil {
 			return err
 		}
+	case codes.FETCH:
+		// the body of the request is received by Block1 and the response is sent by Block2 as for GET
+		maxSZX = fitSZX(r, message.Block1, maxSZX)
+		block, errBlock := r.GetOptionUint32(message.Block2)
+		if errBlock == nil {
+			r.Remove(message.Block2)
+		}
+		err := b.processReceivedMessage(w, r, maxSZX, next, message.Block1, message.Size1)
+		if err != nil {
+			return err
+		}
+		if w.Message().Code() == codes.Content && errBlock == nil {
+			startSendingMessageBlock = block
+		}
 	default:
 		maxSZX = fitSZX(r, message.Block2, maxSZX)
 		err = b.processReceivedMessage(w, r, maxSZX, next, message.Block2, message.Size2)
@@ -551,7 +665,7 @@ func (b *BlockWise) handleReceivedMessage(w ResponseWriter, r Message, maxSZX SZ
 		}
 
 	}
-	return b.startSendingMessage(w, maxSZX, maxMessageSize, startSendingMessageBlock)
+	return b.startSendingMessage(w, r, maxSZX, maxMessageSize, startSendingMessageBlock)
 }
 
 func (b *BlockWise) continueSendingMessage(w ResponseWriter, r Message, maxSZX SZX, maxMessageSize int, messageGuard *messageGuard) (bool, error) {
@@ -563,7 +677,7 @@ func (b *BlockWise) continueSendingMessage(w ResponseWriter, r Message, maxSZX S
 	resp := messageGuard.Message
 	blockType := message.Block2
 	switch resp.Code() {
-	case codes.POST, codes.PUT:
+	case codes.POST, codes.PUT, codes.FETCH, codes.PATCH, codes.IPATCH:
 		blockType = message.Block1
 	}
 
@@ -592,6 +706,9 @@ func (b *BlockWise) continueSendingMessage(w ResponseWriter, r Message, maxSZX S
 	if err != nil {
 		return false, fmt.Errorf("handleSendingMessage: %w", err)
 	}
+	if err := b.throttleBlock(r.Context(), w.Message(), messageGuard.throttle); err != nil {
+		return false, err
+	}
 	return more, err
 }
 
@@ -606,7 +723,7 @@ func isObserveResponse(msg Message) bool {
 	return false
 }
 
-func (b *BlockWise) startSendingMessage(w ResponseWriter, maxSZX SZX, maxMessageSize int, block uint32) error {
+func (b *BlockWise) startSendingMessage(w ResponseWriter, r Message, maxSZX SZX, maxMessageSize int, block uint32) error {
 	payloadSize, err := w.Message().BodySize()
 	if err != nil {
 		return fmt.Errorf("cannot get size of payload: %w", err)
@@ -625,17 +742,29 @@ func (b *BlockWise) startSendingMessage(w ResponseWriter, maxSZX SZX, maxMessage
 	if err != nil {
 		return fmt.Errorf("handleSendingMessage: %w", err)
 	}
+	transfer := newThrottle(b.rateLimit.PerTransfer)
+	if err := b.throttleBlock(r.Context(), w.Message(), transfer); err != nil {
+		return err
+	}
 	if isObserveResponse(w.Message()) {
 		// https://tools.ietf.org/html/rfc7959#section-2.6 - we don't need store it because client will be get values via GET.
 		return nil
 	}
-	expire := cache.DefaultExpiration
-	deadline, ok := sendingMessage.Context().Deadline()
-	if ok {
-		expire = time.Until(deadline)
+	// report stalled transfers before the new one is counted
+	b.sendingMessagesCache.DeleteExpired()
+	if b.limits.MaxSendBytes > 0 && size(b.sendingMessagesCache)+payloadSize > b.limits.MaxSendBytes {
+		return fmt.Errorf("cannot add to response cache: %w", ErrSendLimitExceeded)
 	}
-
-	err = b.sendingMessagesCache.Add(sendingMessage.Token().String(), newRequestGuard(sendingMessage), expire)
+	q := b.quotaOf(r)
+	if q.sendExceeded(payloadSize) {
+		return fmt.Errorf("cannot add to response cache: %w", ErrQuotaExceeded)
+	}
+	deadline, ok := sendingMessage.Context().Deadline()
+	msgGuard := newRequestGuard(sendingMessage)
+	msgGuard.size = payloadSize
+	msgGuard.throttle = transfer
+	b.addToQuota(msgGuard, q)
+	err = b.sendingMessagesCache.Add(sendingMessage.Token().String(), msgGuard, expire(b.limits.SendTimeout, deadline, ok))
 	if err != nil {
 		return fmt.Errorf("cannot add to response cache: %w", err)
 	}
@@ -680,16 +809,16 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 		return fmt.Errorf("cannot decode block option: %w", err)
 	}
 	sendedRequest := b.getSendedRequest(token)
-	expire := cache.DefaultExpiration
+	var deadline time.Time
+	var hasDeadline bool
 	if sendedRequest != nil {
 		defer b.releaseMessage(sendedRequest)
-		deadline, ok := sendedRequest.Context().Deadline()
-		if ok {
-			expire = time.Until(deadline)
-		}
+		deadline, hasDeadline = sendedRequest.Context().Deadline()
 	}
 	if blockType == message.Block2 && sendedRequest == nil {
-		return fmt.Errorf("cannot request body without paired request")
+		// the request was canceled or it is already done, so the rest of the body isn't requested
+		b.rejectBlock(w, r)
+		return nil
 	}
 	if isObserveResponse(r) {
 		// https://tools.ietf.org/html/rfc7959#section-2.6 - performs GET with new token.
@@ -700,7 +829,7 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 		if err != nil {
 			return fmt.Errorf("cannot get token for create GET request: %w", err)
 		}
-		expire = cache.DefaultExpiration // context of observation can be expired.
+		hasDeadline = false // context of observation can be expired.
 		bwSendedRequest := b.newSendRequestMessage(sendedRequest, true)
 		bwSendedRequest.SetToken(token)
 		err := b.bwSendedRequest.store(bwSendedRequest)
@@ -710,7 +839,8 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 	}
 
 	tokenStr := token.String()
-	cachedReceivedMessageGuard, ok := b.receivingMessagesCache.Get(tokenStr)
+	transferKey := receivingTransferKey(tokenStr, r, blockType)
+	cachedReceivedMessageGuard, ok := b.receivingMessagesCache.Get(transferKey)
 	var msgGuard *messageGuard
 	if !ok || cachedReceivedMessageGuard == nil {
 		if szx > maxSzx {
@@ -721,21 +851,35 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 			next(w, r)
 			return nil
 		}
+		// report stalled transfers before the new one is counted
+		b.receivingMessagesCache.DeleteExpired()
+		if b.limits.MaxReceiveBytes > 0 {
+			size1, errSize1 := r.GetOptionUint32(sizeType)
+			if errSize1 == nil && int64(size1) > b.limits.MaxReceiveBytes {
+				return fmt.Errorf("cannot receive body of size %v: %w", size1, ErrReceiveLimitExceeded)
+			}
+		}
+		q := b.quotaOf(r)
+		if size1, errSize1 := r.GetOptionUint32(sizeType); errSize1 == nil && q.receiveExceeded(int64(size1)) {
+			return fmt.Errorf("cannot receive body of size %v: %w", size1, ErrQuotaExceeded)
+		}
 		cachedReceivedMessage := b.acquireMessage(r.Context())
 		cachedReceivedMessage.ResetOptionsTo(r.Options())
 		cachedReceivedMessage.SetToken(r.Token())
 		cachedReceivedMessage.SetSequence(r.Sequence())
 		cachedReceivedMessage.SetBody(memfile.New(make([]byte, 0, 1024)))
 		msgGuard = newRequestGuard(cachedReceivedMessage)
+		msgGuard.throttle = newThrottle(b.rateLimit.PerTransfer)
+		b.addToQuota(msgGuard, q)
 		err := msgGuard.Acquire(cachedReceivedMessage.Context(), 1)
 		if err != nil {
 			return fmt.Errorf("processReceivedMessage: cannot lock message: %v", err)
 		}
 		defer msgGuard.Release(1)
-		err = b.receivingMessagesCache.Add(tokenStr, msgGuard, expire)
+		err = b.receivingMessagesCache.Add(transferKey, msgGuard, expire(b.limits.ReceiveTimeout, deadline, hasDeadline))
 		// request was already stored in cache, silently
 		if err != nil {
-			cachedReceivedMessageGuard, ok := b.receivingMessagesCache.Get(tokenStr)
+			cachedReceivedMessageGuard, ok := b.receivingMessagesCache.Get(transferKey)
 			if ok {
 				msgGuard = cachedReceivedMessageGuard.(*messageGuard)
 				err := msgGuard.Acquire(cachedReceivedMessage.Context(), 1)
@@ -757,7 +901,7 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 	}
 	defer func(err *error) {
 		if *err != nil {
-			b.receivingMessagesCache.Delete(tokenStr)
+			deleteTransfer(b.receivingMessagesCache, transferKey)
 		}
 	}(&err)
 	cachedReceivedMessage := msgGuard.Message
@@ -798,6 +942,21 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 			if err != nil {
 				return fmt.Errorf("cannot seek to start of request: %w", err)
 			}
+			if b.limits.MaxReceiveBytes > 0 {
+				blockSize, errBlockSize := r.BodySize()
+				used := size(b.receivingMessagesCache) - atomic.LoadInt64(&msgGuard.size)
+				if errBlockSize == nil && used+copyn+blockSize > b.limits.MaxReceiveBytes {
+					deleteTransfer(b.receivingMessagesCache, transferKey)
+					return fmt.Errorf("cannot receive block: %w", ErrReceiveLimitExceeded)
+				}
+			}
+			if msgGuard.quota != nil {
+				blockSize, errBlockSize := r.BodySize()
+				if errBlockSize == nil && msgGuard.quota.receiveExceeded(copyn+blockSize-atomic.LoadInt64(&msgGuard.size)) {
+					deleteTransfer(b.receivingMessagesCache, transferKey)
+					return fmt.Errorf("cannot receive block: %w", ErrQuotaExceeded)
+				}
+			}
 			written, err := io.Copy(payloadFile, r.Body())
 			if err != nil {
 				return fmt.Errorf("cannot copy to cached request: %w", err)
@@ -810,11 +969,18 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 		if err != nil {
 			return fmt.Errorf("cannot truncate cached request: %w", err)
 		}
+		atomic.StoreInt64(&msgGuard.size, payloadSize)
+		b.reportProgress(token, payloadSize, announcedSize(r, sizeType))
+		if more && b.limits.ReceiveTimeout > 0 {
+			// the peer made progress, so the transfer is not stalled
+			b.receivingMessagesCache.Replace(transferKey, msgGuard, expire(b.limits.ReceiveTimeout, deadline, hasDeadline))
+		}
 		if !more {
-			b.receivingMessagesCache.Replace(tokenStr, nil, 0)
-			b.receivingMessagesCache.Delete(tokenStr)
+			b.receivingMessagesCache.Replace(transferKey, nil, 0)
+			b.receivingMessagesCache.Delete(transferKey)
 			cachedReceivedMessage.Remove(blockType)
 			cachedReceivedMessage.Remove(sizeType)
+			cachedReceivedMessage.Remove(message.RequestTag)
 			cachedReceivedMessage.SetCode(r.Code())
 			setTypeFrom(cachedReceivedMessage, r)
 			if !bytes.Equal(cachedReceivedMessage.Token(), token) {
@@ -831,6 +997,13 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 	if szx > maxSzx {
 		szx = maxSzx
 	}
+	if blockType == message.Block2 && !hasObserve(sendedRequest) && sendedRequest.Context().Err() != nil {
+		// the request was canceled, so the rest of the body isn't requested. Context of an observation
+		// can be expired while notifications are received.
+		deleteTransfer(b.receivingMessagesCache, transferKey)
+		b.rejectBlock(w, r)
+		return nil
+	}
 
 	sendMessage := b.acquireMessage(r.Context())
 	sendMessage.SetToken(token)
@@ -839,6 +1012,10 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 		sendMessage.ResetOptionsTo(sendedRequest.Options())
 		sendMessage.SetCode(sendedRequest.Code())
 		sendMessage.Remove(message.Observe)
+		// the body of the request was already sent by Block1
+		sendMessage.Remove(message.Block1)
+		sendMessage.Remove(message.Size1)
+		sendMessage.Remove(message.RequestTag)
 	} else {
 		sendMessage.SetCode(codes.Continue)
 	}
@@ -848,6 +1025,25 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 		return fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, num, more, err)
 	}
 	sendMessage.SetOptionUint32(blockType, respBlock)
+	if err := b.throttleBlock(r.Context(), r, msgGuard.throttle); err != nil {
+		b.releaseMessage(sendMessage)
+		return err
+	}
 	w.SetMessage(sendMessage)
 	return nil
 }
+
+// throttleBlock waits until the block may be transferred by the rate limits of the transfer and of the peer.
+func (b *BlockWise) throttleBlock(ctx context.Context, block Message, transfer *throttle) error {
+	if transfer == nil && b.throttle == nil {
+		return nil
+	}
+	n, err := block.BodySize()
+	if err != nil {
+		return fmt.Errorf("cannot get size of block: %w", err)
+	}
+	if err := waitThrottles(ctx, n, transfer, b.throttle); err != nil {
+		return fmt.Errorf("cannot transfer block: %w", err)
+	}
+	return nil
+}
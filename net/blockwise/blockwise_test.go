@@ -740,3 +740,223 @@ func TestBlockWise_Writetestmessage(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockWise_Limits(t *testing.T) {
+	expired := make(chan Transfer, 2)
+	b := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, false, nil, WithLimits(Limits{
+		ReceiveTimeout:  time.Millisecond * 100,
+		SendTimeout:     time.Millisecond * 100,
+		MaxReceiveBytes: 64,
+		MaxSendBytes:    64,
+		OnExpired: func(tr Transfer) {
+			expired <- tr
+		},
+	}))
+	next := func(w ResponseWriter, r Message) {
+		size, err := r.GetOptionUint32(message.Size2)
+		require.NoError(t, err)
+		w.SetMessage(&testmessage{
+			ctx:     context.Background(),
+			token:   r.Token(),
+			code:    codes.Content,
+			payload: bytes.NewReader(make([]byte, size)),
+		})
+	}
+	handle := func(code codes.Code, token []byte, opts message.Options, payload []byte) Message {
+		w := newResponseWriter(acquireMessage(context.Background()))
+		b.Handle(w, &testmessage{
+			ctx:     context.Background(),
+			token:   token,
+			options: opts,
+			code:    code,
+			payload: bytes.NewReader(payload),
+		}, SZX16, int(SZX16.Size()), next)
+		return w.Message()
+	}
+	block, err := EncodeBlockOption(SZX16, 0, true)
+	require.NoError(t, err)
+
+	// the first Block1 is kept until the transfer stalls
+	resp := handle(codes.POST, []byte{1}, message.Options{{ID: message.Block1, Value: []byte{byte(block)}}}, make([]byte, 16))
+	require.Equal(t, codes.Continue, resp.Code())
+	select {
+	case e := <-expired:
+		require.Equal(t, Transfer{Token: []byte{1}, Receiving: true, Size: 16}, e)
+	case <-time.After(time.Second):
+		require.Fail(t, "receiving transfer was not expired")
+	}
+
+	// announced size of the body exceeds the cap
+	resp = handle(codes.POST, []byte{2}, message.Options{{ID: message.Block1, Value: []byte{byte(block)}}, {ID: message.Size1, Value: []byte{128}}}, make([]byte, 16))
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code())
+
+	// the rest of Block2 is kept until the transfer stalls
+	resp = handle(codes.GET, []byte{3}, message.Options{{ID: message.Size2, Value: []byte{48}}}, nil)
+	require.Equal(t, codes.Content, resp.Code())
+	select {
+	case e := <-expired:
+		require.Equal(t, Transfer{Token: []byte{3}, Receiving: false, Size: 48}, e)
+	case <-time.After(time.Second):
+		require.Fail(t, "sending transfer was not expired")
+	}
+
+	// body of the response exceeds the cap
+	resp = handle(codes.GET, []byte{4}, message.Options{{ID: message.Size2, Value: []byte{128}}}, nil)
+	require.Equal(t, codes.ServiceUnavailable, resp.Code())
+	require.False(t, b.HasPendingTransfers())
+}
+
+func TestBlockWise_Quota(t *testing.T) {
+	quota := NewQuota(32, 32)
+	tenant := func(r Message) *Quota {
+		if len(r.Token()) > 0 && r.Token()[0] < 10 {
+			return quota
+		}
+		return nil
+	}
+	// two peers share the quota
+	peers := []*BlockWise{
+		NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, false, nil, WithQuota(tenant)),
+		NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, false, nil, WithQuota(tenant)),
+	}
+	next := func(w ResponseWriter, r Message) {
+		size, err := r.GetOptionUint32(message.Size2)
+		require.NoError(t, err)
+		w.SetMessage(&testmessage{
+			ctx:     context.Background(),
+			token:   r.Token(),
+			code:    codes.Content,
+			payload: bytes.NewReader(make([]byte, size)),
+		})
+	}
+	handle := func(b *BlockWise, code codes.Code, token []byte, opts message.Options, payload []byte) Message {
+		w := newResponseWriter(acquireMessage(context.Background()))
+		b.Handle(w, &testmessage{
+			ctx:     context.Background(),
+			token:   token,
+			options: opts,
+			code:    code,
+			payload: bytes.NewReader(payload),
+		}, SZX16, int(SZX16.Size()), next)
+		return w.Message()
+	}
+	block, err := EncodeBlockOption(SZX16, 0, true)
+	require.NoError(t, err)
+
+	resp := handle(peers[0], codes.POST, []byte{1}, message.Options{{ID: message.Block1, Value: []byte{byte(block)}}}, make([]byte, 16))
+	require.Equal(t, codes.Continue, resp.Code())
+	resp = handle(peers[1], codes.POST, []byte{2}, message.Options{{ID: message.Block1, Value: []byte{byte(block)}}}, make([]byte, 16))
+	require.Equal(t, codes.Continue, resp.Code())
+	receiving, sending := quota.Used()
+	require.Equal(t, int64(32), receiving)
+	require.Equal(t, int64(0), sending)
+
+	// the quota is exhausted by the other peer
+	block1, err := EncodeBlockOption(SZX16, 1, true)
+	require.NoError(t, err)
+	resp = handle(peers[1], codes.POST, []byte{2}, message.Options{{ID: message.Block1, Value: []byte{byte(block1)}}}, make([]byte, 16))
+	require.Equal(t, codes.ServiceUnavailable, resp.Code())
+	resp = handle(peers[1], codes.GET, []byte{3}, message.Options{{ID: message.Size2, Value: []byte{48}}}, nil)
+	require.Equal(t, codes.ServiceUnavailable, resp.Code())
+
+	// requests without the quota are not affected
+	resp = handle(peers[1], codes.GET, []byte{10}, message.Options{{ID: message.Size2, Value: []byte{48}}}, nil)
+	require.Equal(t, codes.Content, resp.Code())
+
+	peers[0].receivingMessagesCache.Flush()
+	receiving, _ = quota.Used()
+	require.Equal(t, int64(0), receiving)
+	resp = handle(peers[1], codes.GET, []byte{4}, message.Options{{ID: message.Size2, Value: []byte{32}}}, nil)
+	require.Equal(t, codes.Content, resp.Code())
+}
+
+func TestBlockWise_DoRequestTag(t *testing.T) {
+	sender := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, true, nil)
+	receiver := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, true, nil)
+	tests := []struct {
+		name    string
+		code    codes.Code
+		payload io.ReadSeeker
+		wantTag bool
+	}{
+		{name: "get", code: codes.GET},
+		{name: "single block", code: codes.POST, payload: bytes.NewReader(make([]byte, 8))},
+		{name: "multiple blocks", code: codes.POST, payload: bytes.NewReader(make([]byte, 128)), wantTag: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			do := makeDo(t, sender, receiver, SZX16, int(SZX16.Size()), SZX16, int(SZX16.Size()), func(w ResponseWriter, r Message) {
+				// the tag isn't passed to the handler
+				require.False(t, r.Options().HasOption(message.RequestTag))
+				w.SetMessage(&testmessage{
+					ctx:   context.Background(),
+					token: r.Token(),
+					code:  codes.Changed,
+				})
+			})
+			var tagged []bool
+			_, err := sender.Do(&testmessage{
+				ctx:     context.Background(),
+				token:   []byte{3},
+				code:    tt.code,
+				payload: tt.payload,
+			}, SZX16, int(SZX16.Size()), func(req Message) (Message, error) {
+				tagged = append(tagged, req.Options().HasOption(message.RequestTag))
+				return do(req)
+			})
+			require.NoError(t, err)
+			require.NotEmpty(t, tagged)
+			for _, v := range tagged {
+				require.Equal(t, tt.wantTag, v)
+			}
+		})
+	}
+}
+
+func TestBlockWise_RateLimit(t *testing.T) {
+	// a block of 16 bytes takes 100ms
+	b := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, false, nil, WithRateLimit(RateLimit{
+		PerTransfer:   160,
+		PerConnection: 320,
+	}))
+	next := func(w ResponseWriter, r Message) {
+		size, err := r.GetOptionUint32(message.Size2)
+		require.NoError(t, err)
+		w.SetMessage(&testmessage{
+			ctx:     context.Background(),
+			token:   r.Token(),
+			code:    codes.Content,
+			payload: bytes.NewReader(make([]byte, size)),
+		})
+	}
+	handle := func(token []byte, num int64) Message {
+		block, err := EncodeBlockOption(SZX16, num, false)
+		require.NoError(t, err)
+		w := newResponseWriter(acquireMessage(context.Background()))
+		b.Handle(w, &testmessage{
+			ctx:     context.Background(),
+			token:   token,
+			options: message.Options{{ID: message.Block2, Value: []byte{byte(block)}}, {ID: message.Size2, Value: []byte{64}}},
+			code:    codes.GET,
+		}, SZX16, int(SZX16.Size()), next)
+		return w.Message()
+	}
+
+	start := time.Now()
+	resp := handle([]byte{1}, 0)
+	require.Equal(t, codes.Content, resp.Code())
+	// the first block isn't delayed
+	require.Less(t, time.Since(start), time.Millisecond*50)
+	for num := int64(1); num < 4; num++ {
+		resp = handle([]byte{1}, num)
+		require.Equal(t, codes.Content, resp.Code())
+	}
+	// 3 blocks at the rate of the transfer
+	require.GreaterOrEqual(t, time.Since(start), time.Millisecond*300)
+
+	// the other transfer is paced by the limit of the connection only
+	start = time.Now()
+	resp = handle([]byte{2}, 0)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Less(t, time.Since(start), time.Millisecond*100)
+}
@@ -23,4 +23,13 @@ var (
 
 	// ErrInvalidSZX invalid block-wise transfer szx
 	ErrInvalidSZX = errors.New("invalid block-wise transfer szx")
+
+	// ErrReceiveLimitExceeded partially received bodies exceeded the memory cap
+	ErrReceiveLimitExceeded = errors.New("partially received bodies exceeded the memory cap")
+
+	// ErrSendLimitExceeded bodies cached for delivery exceeded the memory cap
+	ErrSendLimitExceeded = errors.New("bodies cached for delivery exceeded the memory cap")
+
+	// ErrQuotaExceeded transfers of peers sharing the quota exceeded the memory cap
+	ErrQuotaExceeded = errors.New("transfers of peers sharing the quota exceeded the memory cap")
 )
@@ -0,0 +1,130 @@
+package blockwise
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// Transfer describes a partial blockwise transfer with a peer.
+type Transfer struct {
+	// Token is token of the transfer.
+	Token message.Token
+	// Receiving is true for a partially received body, e.g. Block1 of a request, and false for a partially
+	// delivered body, e.g. Block2 of a response.
+	Receiving bool
+	// Size is number of bytes held by the transfer.
+	Size int64
+}
+
+// ExpiredFunc is called when a stalled transfer is dropped.
+type ExpiredFunc = func(t Transfer)
+
+// Limits bounds resources held by partial transfers of one peer. Zero value of a field means no limit.
+type Limits struct {
+	// ReceiveTimeout drops a partially received body when no block arrives in time.
+	ReceiveTimeout time.Duration
+	// SendTimeout drops a partially delivered body when no block is requested in time.
+	SendTimeout time.Duration
+	// MaxReceiveBytes caps total size of partially received bodies.
+	MaxReceiveBytes int64
+	// MaxSendBytes caps total size of bodies cached for delivery.
+	MaxSendBytes int64
+	// OnExpired is called when a transfer is dropped by ReceiveTimeout, SendTimeout or the expiration of NewBlockWise.
+	OnExpired ExpiredFunc
+}
+
+// An Option sets optional parameters of BlockWise.
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	limits    Limits
+	qblock    bool
+	quota     QuotaFunc
+	rateLimit RateLimit
+	progress  ProgressFunc
+}
+
+// LimitsOpt limits option.
+type LimitsOpt struct {
+	limits Limits
+}
+
+func (o LimitsOpt) apply(opts *options) {
+	opts.limits = o.limits
+}
+
+// WithLimits sets timeouts and memory caps of partial transfers.
+func WithLimits(limits Limits) LimitsOpt {
+	return LimitsOpt{limits: limits}
+}
+
+// expire returns expiration of a cache item, the timeout caps deadline of the request.
+func expire(timeout time.Duration, deadline time.Time, hasDeadline bool) time.Duration {
+	d := cache.DefaultExpiration
+	if hasDeadline {
+		d = time.Until(deadline)
+		if timeout > 0 && d > timeout {
+			d = timeout
+		}
+	}
+	return d
+}
+
+// size returns total size of transfers in the cache.
+func size(c *cache.Cache) int64 {
+	var n int64
+	for _, item := range c.Items() {
+		if g, ok := item.Object.(*messageGuard); ok {
+			n += atomic.LoadInt64(&g.size)
+		}
+	}
+	return n
+}
+
+// deleteTransfer removes the transfer from the cache without reporting it as expired.
+func deleteTransfer(c *cache.Cache, token string) {
+	if v, ok := c.Get(token); ok {
+		if g, ok := v.(*messageGuard); ok {
+			atomic.StoreUint32(&g.deleted, 1)
+		}
+	}
+	c.Delete(token)
+}
+
+func (b *BlockWise) onEvicted(receiving bool) func(token string, v interface{}) {
+	return func(token string, v interface{}) {
+		g, ok := v.(*messageGuard)
+		if !ok || b.onExpired == nil || atomic.LoadUint32(&g.deleted) == 1 {
+			return
+		}
+		b.onExpired(Transfer{
+			Token:     g.Token(),
+			Receiving: receiving,
+			Size:      atomic.LoadInt64(&g.size),
+		})
+	}
+}
+
+// Transfers returns partial transfers with the peer, e.g. for debugging.
+func (b *BlockWise) Transfers() []Transfer {
+	transfers := make([]Transfer, 0, 4)
+	add := func(c *cache.Cache, receiving bool) {
+		for _, item := range c.Items() {
+			if g, ok := item.Object.(*messageGuard); ok {
+				transfers = append(transfers, Transfer{
+					Token:     g.Token(),
+					Receiving: receiving,
+					Size:      atomic.LoadInt64(&g.size),
+				})
+			}
+		}
+	}
+	add(b.receivingMessagesCache, true)
+	add(b.sendingMessagesCache, false)
+	return transfers
+}
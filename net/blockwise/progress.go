@@ -0,0 +1,64 @@
+package blockwise
+
+import (
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+// ProgressFunc is called after each block of a body which is transferred in multiple blocks, e.g. to show
+// progress of a firmware update. Transferred is number of bytes of the body sent or received so far and total
+// is size of the body, or -1 when the peer didn't announce it by Size1 or Size2. It is called synchronously,
+// so it must not block.
+type ProgressFunc = func(token message.Token, transferred, total int64)
+
+// ProgressOpt progress option.
+type ProgressOpt struct {
+	progress ProgressFunc
+}
+
+func (o ProgressOpt) apply(opts *options) {
+	opts.progress = o.progress
+}
+
+// WithProgress sets function which is called with progress of transfers.
+func WithProgress(progress ProgressFunc) ProgressOpt {
+	return ProgressOpt{progress: progress}
+}
+
+func (b *BlockWise) reportProgress(token message.Token, transferred, total int64) {
+	if b.progress != nil {
+		b.progress(token, transferred, total)
+	}
+}
+
+// announcedSize returns size of the body announced by the option, or -1.
+func announcedSize(r Message, sizeType message.OptionID) int64 {
+	size, err := r.GetOptionUint32(sizeType)
+	if err != nil {
+		return -1
+	}
+	return int64(size)
+}
+
+func hasObserve(r Message) bool {
+	_, err := r.GetOptionUint32(message.Observe)
+	return err == nil
+}
+
+// rejectBlock stops the transfer of a canceled request. A block received in a confirmable or non-confirmable
+// UDP message is rejected by reset, so the peer stops retransmitting it. Other blocks are just not followed by
+// a request of the next one.
+func (b *BlockWise) rejectBlock(w ResponseWriter, r Message) {
+	udpR, ok := r.(hasType)
+	if !ok || (udpR.Type() != udpMessage.Confirmable && udpR.Type() != udpMessage.NonConfirmable) {
+		return
+	}
+	reset := b.acquireMessage(r.Context())
+	reset.SetCode(codes.Empty)
+	reset.SetToken(nil)
+	if udpReset, ok := reset.(hasType); ok {
+		udpReset.SetType(udpMessage.Reset)
+	}
+	w.SetMessage(reset)
+}
@@ -0,0 +1,863 @@
+package blockwise
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsnet/golib/memfile"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+const (
+	// maxPayloads is number of blocks of a Q-Block set, which are sent without waiting for a response (RFC 9177 section 7.2).
+	maxPayloads = 10
+	// maxRecoveryRounds is number of times the same missing blocks are sent again before Q-Block1 transfer fails.
+	maxRecoveryRounds = 4
+)
+
+const (
+	qblockPeerUnknown uint32 = iota
+	qblockPeerSupported
+	// qblockPeerUnsupported is set when the peer rejected Q-Block options by 4.02 (Bad Option)
+	qblockPeerUnsupported
+)
+
+// QBlockOpt Q-Block option.
+type QBlockOpt struct{}
+
+func (o QBlockOpt) apply(opts *options) {
+	opts.qblock = true
+}
+
+// WithQBlock enables Q-Block1 and Q-Block2 transfers (RFC 9177). Blocks of a body are sent in sets without
+// waiting for each other and only the lost blocks are sent again, so the transfer survives heavy packet loss
+// without restarting it. Both endpoints must enable it. Sets of Q-Block2 are sent only when ResponseWriter
+// is able to write additional messages, e.g. over UDP and DTLS.
+func WithQBlock() QBlockOpt {
+	return QBlockOpt{}
+}
+
+// messageWriter is implemented by ResponseWriter which sends additional Non-confirmable messages to the peer,
+// e.g. blocks of Q-Block2 set.
+type messageWriter interface {
+	WriteMessage(Message) error
+}
+
+// qblockTransfer is state of Q-Block transfer, whose blocks can arrive out of order.
+type qblockTransfer struct {
+	szx      SZX
+	received map[int64]struct{}
+	// highest is number of the highest received block
+	highest int64
+	// last is number of the last block, -1 until it is received
+	last int64
+	// size is size of the body, it is known when the last block is received
+	size int64
+	// awaited is number of the last block requested by recovery of Q-Block2, -1 when there is no recovery
+	awaited int64
+	// done is set when the body was delivered
+	done bool
+}
+
+func newQBlockTransfer(szx SZX) *qblockTransfer {
+	t := &qblockTransfer{
+		szx: szx,
+	}
+	t.reset()
+	return t
+}
+
+func (t *qblockTransfer) reset() {
+	t.received = make(map[int64]struct{})
+	t.highest = -1
+	t.last = -1
+	t.size = 0
+	t.awaited = -1
+}
+
+// missing returns numbers of blocks up to num which were not received.
+func (t *qblockTransfer) missing(num int64) []int64 {
+	var missing []int64
+	for i := int64(0); i <= num; i++ {
+		if _, ok := t.received[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+func (t *qblockTransfer) complete() bool {
+	return t.last >= 0 && int64(len(t.received)) == t.last+1
+}
+
+// isSetEnd reports whether the block is the last block of its set.
+func isSetEnd(num int64) bool {
+	return (num+1)%maxPayloads == 0
+}
+
+// qblockSet returns numbers of blocks of the set which starts by num.
+func qblockSet(num, lastNum int64) []int64 {
+	nums := make([]int64, 0, maxPayloads)
+	for ; num <= lastNum; num++ {
+		nums = append(nums, num)
+		if isSetEnd(num) {
+			break
+		}
+	}
+	return nums
+}
+
+func isRequest(r Message) bool {
+	return r.Code() >= codes.GET && r.Code() < codes.Created
+}
+
+func isConfirmable(r Message) bool {
+	t, ok := r.(hasType)
+	return ok && t.Type() == udpMessage.Confirmable
+}
+
+func setNonConfirmable(r Message) {
+	if t, ok := r.(hasType); ok {
+		t.SetType(udpMessage.NonConfirmable)
+	}
+}
+
+func setConfirmable(r Message) {
+	if t, ok := r.(hasType); ok {
+		t.SetType(udpMessage.Confirmable)
+	}
+}
+
+// encodeMissingBlocks encodes numbers of missing blocks as CBOR Sequence of unsigned integers (RFC 9177 section 5).
+func encodeMissingBlocks(missing []int64) []byte {
+	buf := make([]byte, 0, len(missing)*3)
+	for _, num := range missing {
+		buf = cbor.AppendUint(buf, uint64(uint32(num)))
+	}
+	return buf
+}
+
+// decodeMissingBlocks decodes numbers of missing blocks from CBOR Sequence of unsigned integers.
+func decodeMissingBlocks(data []byte) ([]int64, error) {
+	missing := make([]int64, 0, len(data))
+	for len(data) > 0 {
+		v, rest, err := cbor.ReadUint(data)
+		if err != nil {
+			return nil, err
+		}
+		if v > maxBlockNumber {
+			return nil, ErrBlockNumberExceedLimit
+		}
+		missing = append(missing, int64(v))
+		data = rest
+	}
+	return missing, nil
+}
+
+func isMissingBlocks(r Message) bool {
+	cf, err := r.GetOptionUint32(message.ContentFormat)
+	return err == nil && message.MediaType(cf) == message.AppMissingBlocks
+}
+
+func readMissingBlocks(r Message) ([]int64, error) {
+	if r.Body() == nil {
+		return nil, nil
+	}
+	_, err := r.Body().Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek to start of missing blocks: %w", err)
+	}
+	data, err := ioutil.ReadAll(r.Body())
+	if err != nil {
+		return nil, fmt.Errorf("cannot read missing blocks: %w", err)
+	}
+	return decodeMissingBlocks(data)
+}
+
+func equalBlocks(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DoQBlock sends an coap message and returns an coap response via Q-Block transfer (RFC 9177) when it is
+// enabled by WithQBlock, otherwise it is the same as Do. Blocks of Q-Block1 set are sent by write without
+// waiting for a response, the last block of the set is sent by do. When the peer rejects Q-Block options
+// by 4.02 (Bad Option), the request is sent again by Block1 and Block2 and the following requests don't use Q-Block.
+func (b *BlockWise) DoQBlock(r Message, maxSzx SZX, maxMessageSize int, do func(req Message) (Message, error), write func(req Message) error) (Message, error) {
+	if !b.qblock || atomic.LoadUint32(&b.qblockPeer) == qblockPeerUnsupported {
+		return b.Do(r, maxSzx, maxMessageSize, do)
+	}
+	if maxSzx > SZXBERT {
+		return nil, fmt.Errorf("invalid szx")
+	}
+	if len(r.Token()) == 0 {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if maxSzx > SZX1024 {
+		// BERT is not defined for Q-Block
+		maxSzx = SZX1024
+	}
+	switch r.Code() {
+	case codes.GET:
+		if r.Options().HasOption(message.Observe) {
+			break
+		}
+		resp, err := b.doQBlock2(r, maxSzx, maxMessageSize, do)
+		if err != nil || resp.Code() != codes.BadOption {
+			return resp, err
+		}
+		b.releaseMessage(resp)
+		return b.fallbackQBlock(r, maxSzx, maxMessageSize, do)
+	case codes.POST, codes.PUT:
+		if r.Body() == nil {
+			break
+		}
+		payloadSize, err := r.BodySize()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get size of payload: %w", err)
+		}
+		if payloadSize <= maxSzx.Size() {
+			break
+		}
+		resp, err := b.doQBlock1(r, maxSzx, maxMessageSize, payloadSize, do, write)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+		return b.fallbackQBlock(r, maxSzx, maxMessageSize, do)
+	}
+	return b.Do(r, maxSzx, maxMessageSize, do)
+}
+
+// fallbackQBlock sends the request rejected by the peer without Q-Block again by Block1 and Block2.
+func (b *BlockWise) fallbackQBlock(r Message, maxSzx SZX, maxMessageSize int, do func(req Message) (Message, error)) (Message, error) {
+	if m, ok := r.(hasMessageID); ok {
+		// the peer would answer the duplicate by the rejection
+		m.ResetMessageID()
+	}
+	resp, err := b.Do(r, maxSzx, maxMessageSize, do)
+	if err == nil && resp.Code() != codes.BadOption {
+		// the peer accepted the request without Q-Block options
+		atomic.StoreUint32(&b.qblockPeer, qblockPeerUnsupported)
+	}
+	return resp, err
+}
+
+// doQBlock2 requests the body of the response via Q-Block2.
+func (b *BlockWise) doQBlock2(r Message, maxSzx SZX, maxMessageSize int, do func(req Message) (Message, error)) (Message, error) {
+	block, err := EncodeBlockOption(maxSzx, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode block option(%v, %v, %v): %w", maxSzx, 0, false, err)
+	}
+	r.SetOptionUint32(message.QBlock2, block)
+	defer r.Remove(message.QBlock2)
+	defer deleteTransfer(b.receivingMessagesCache, r.Token().String())
+	return b.Do(r, maxSzx, maxMessageSize, do)
+}
+
+// doQBlock1 sends the body of the request via Q-Block1. Until the peer is known to support Q-Block, only the first
+// block is sent as Confirmable, so the peer without Q-Block rejects it before the set is sent. It returns nil response
+// when the peer rejected Q-Block1 by 4.02 (Bad Option).
+func (b *BlockWise) doQBlock1(r Message, szx SZX, maxMessageSize int, payloadSize int64, do func(req Message) (Message, error), write func(req Message) error) (Message, error) {
+	req := b.newSendRequestMessage(r, true)
+	defer req.release()
+	err := b.bwSendedRequest.store(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot store sended request %v: %v", req.String(), err)
+	}
+	defer b.bwSendedRequest.deleteByToken(req.Token().String())
+	tag, err := message.GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get request tag: %w", err)
+	}
+	req.SetOptionUint32(message.Size1, uint32(payloadSize))
+	req.SetOptionBytes(message.RequestTag, tag)
+	req.SetBody(r.Body())
+
+	lastNum := (payloadSize - 1) / szx.Size()
+	nums := qblockSet(0, lastNum)
+	probe := atomic.LoadUint32(&b.qblockPeer) != qblockPeerSupported
+	if probe {
+		nums = nums[:1]
+	}
+	var lastMissing []int64
+	rounds := 0
+	for {
+		resp, err := b.sendQBlock1Set(req.Message, r, nums, szx, maxMessageSize, probe, do, write)
+		if err != nil {
+			return nil, err
+		}
+		if probe {
+			probe = false
+			if resp.Code() == codes.BadOption {
+				b.releaseMessage(resp)
+				return nil, nil
+			}
+			atomic.StoreUint32(&b.qblockPeer, qblockPeerSupported)
+		}
+		trigger := nums[len(nums)-1]
+		switch {
+		case resp.Code() == codes.Continue && trigger < lastNum:
+			b.releaseMessage(resp)
+			nums = qblockSet(trigger+1, lastNum)
+			lastMissing = nil
+			rounds = 0
+		case resp.Code() == codes.RequestEntityIncomplete && isMissingBlocks(resp):
+			missing, err := readMissingBlocks(resp)
+			b.releaseMessage(resp)
+			if err != nil {
+				return nil, err
+			}
+			if equalBlocks(missing, lastMissing) {
+				rounds++
+			} else {
+				rounds = 0
+				lastMissing = missing
+			}
+			if rounds >= maxRecoveryRounds {
+				return nil, fmt.Errorf("cannot recover missing blocks %v", missing)
+			}
+			// the missing blocks are sent again and the trigger block asks for the next response
+			nums = make([]int64, 0, len(missing)+1)
+			for _, num := range missing {
+				if num < trigger {
+					nums = append(nums, num)
+				}
+			}
+			nums = append(nums, trigger)
+		default:
+			return resp, nil
+		}
+	}
+}
+
+// sendQBlock1Set sends blocks of the request, only the last one waits for a response. The last block of the probe
+// is Confirmable, so the peer responds to it.
+func (b *BlockWise) sendQBlock1Set(sendingMessage Message, r Message, nums []int64, szx SZX, maxMessageSize int, probe bool, do func(req Message) (Message, error), write func(req Message) error) (Message, error) {
+	for i, num := range nums {
+		msg, _, err := b.newBlockMessage(sendingMessage, num*szx.Size(), szx, maxMessageSize, sendingMessage.Token(), message.QBlock1, message.Size1)
+		if err != nil {
+			return nil, err
+		}
+		if i < len(nums)-1 {
+			setNonConfirmable(msg)
+			err = write(msg)
+			b.releaseMessage(msg)
+			if err != nil {
+				return nil, fmt.Errorf("cannot write block %v: %w", num, err)
+			}
+			continue
+		}
+		setTypeFrom(msg, r)
+		if probe {
+			setConfirmable(msg)
+		}
+		resp, err := do(msg)
+		b.releaseMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot do bw request: %w", err)
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("empty set of blocks")
+}
+
+// handleQBlock handles blocks of Q-Block transfers and requests for them, it returns false for other messages.
+func (b *BlockWise) handleQBlock(w ResponseWriter, r Message, maxSZX SZX, maxMessageSize int, next func(w ResponseWriter, r Message)) bool {
+	token := r.Token()
+	if len(token) == 0 {
+		return false
+	}
+	options := r.Options()
+	switch {
+	case isRequest(r) && options.HasOption(message.QBlock1):
+		err := b.processQBlock1(w, r, next)
+		if err != nil {
+			b.sendEntityIncomplete(w, token, err)
+			b.errors(fmt.Errorf("processQBlock1(%v): %w", r, err))
+		}
+		return true
+	case isRequest(r) && options.HasOption(message.QBlock2):
+		mw, ok := w.(messageWriter)
+		if !ok {
+			// the body is sent by Block2
+			r.Remove(message.QBlock2)
+			return false
+		}
+		err := b.handleQBlock2Request(w, mw, r, maxSZX, maxMessageSize, next)
+		if err != nil {
+			b.sendEntityIncomplete(w, token, err)
+			b.errors(fmt.Errorf("handleQBlock2Request(%v): %w", r, err))
+		}
+		return true
+	case !isRequest(r) && options.HasOption(message.QBlock2):
+		err := b.processQBlock2(w, r, next)
+		if err != nil {
+			deleteTransfer(b.receivingMessagesCache, token.String())
+			b.errors(fmt.Errorf("processQBlock2(%v): %w", r, err))
+		}
+		return true
+	}
+	return false
+}
+
+func decodeQBlock(r Message, blockType message.OptionID) (SZX, int64, bool, error) {
+	block, err := r.GetOptionUint32(blockType)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("cannot get %v option: %w", blockType, err)
+	}
+	szx, num, more, err := DecodeBlockOption(block)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("cannot decode %v(%v) option: %w", blockType, block, err)
+	}
+	if szx == SZXBERT {
+		return 0, 0, false, fmt.Errorf("invalid %v(%v) option: %w", blockType, block, ErrInvalidSZX)
+	}
+	return szx, num, more, nil
+}
+
+// acquireQBlockTransfer returns locked Q-Block transfer of the token, it creates the transfer by the first received block.
+func (b *BlockWise) acquireQBlockTransfer(r Message, szx SZX, sizeType message.OptionID, deadline time.Time, hasDeadline bool) (*messageGuard, error) {
+	tokenStr := r.Token().String()
+	for {
+		v, ok := b.receivingMessagesCache.Get(tokenStr)
+		if ok && v != nil {
+			msgGuard := v.(*messageGuard)
+			if msgGuard.qblock == nil {
+				return nil, fmt.Errorf("transfer is not Q-Block")
+			}
+			err := msgGuard.Acquire(r.Context(), 1)
+			if err != nil {
+				return nil, fmt.Errorf("cannot lock message: %v", err)
+			}
+			if msgGuard.qblock.szx != szx {
+				msgGuard.Release(1)
+				return nil, fmt.Errorf("block size was changed(%v != %v)", msgGuard.qblock.szx, szx)
+			}
+			return msgGuard, nil
+		}
+		// report stalled transfers before the new one is counted
+		b.receivingMessagesCache.DeleteExpired()
+		if b.limits.MaxReceiveBytes > 0 {
+			size, errSize := r.GetOptionUint32(sizeType)
+			if errSize == nil && int64(size) > b.limits.MaxReceiveBytes {
+				return nil, fmt.Errorf("cannot receive body of size %v: %w", size, ErrReceiveLimitExceeded)
+			}
+		}
+		q := b.quotaOf(r)
+		if size, errSize := r.GetOptionUint32(sizeType); errSize == nil && q.receiveExceeded(int64(size)) {
+			return nil, fmt.Errorf("cannot receive body of size %v: %w", size, ErrQuotaExceeded)
+		}
+		cachedReceivedMessage := b.acquireMessage(r.Context())
+		cachedReceivedMessage.ResetOptionsTo(r.Options())
+		cachedReceivedMessage.SetToken(r.Token())
+		cachedReceivedMessage.SetSequence(r.Sequence())
+		cachedReceivedMessage.SetBody(memfile.New(make([]byte, 0, 1024)))
+		msgGuard := newRequestGuard(cachedReceivedMessage)
+		msgGuard.qblock = newQBlockTransfer(szx)
+		b.addToQuota(msgGuard, q)
+		err := msgGuard.Acquire(cachedReceivedMessage.Context(), 1)
+		if err != nil {
+			return nil, fmt.Errorf("cannot lock message: %v", err)
+		}
+		err = b.receivingMessagesCache.Add(tokenStr, msgGuard, expire(b.limits.ReceiveTimeout, deadline, hasDeadline))
+		if err == nil {
+			return msgGuard, nil
+		}
+		// the transfer was created by a concurrent block
+		msgGuard.Release(1)
+		b.releaseMessage(cachedReceivedMessage)
+	}
+}
+
+// storeQBlock writes the block to the body of the locked transfer. The body is dropped when value of tagID
+// option, e.g. ETag, was changed.
+func (b *BlockWise) storeQBlock(msgGuard *messageGuard, r Message, num int64, more bool, tagID message.OptionID, deadline time.Time, hasDeadline bool) error {
+	t := msgGuard.qblock
+	cachedReceivedMessage := msgGuard.Message
+	payloadFile, ok := cachedReceivedMessage.Body().(*memfile.File)
+	if !ok {
+		return fmt.Errorf("invalid body type(%T) stored in receivingMessagesCache", cachedReceivedMessage.Body())
+	}
+	tag, errTag := r.GetOptionBytes(tagID)
+	cachedTag, errCachedTag := cachedReceivedMessage.GetOptionBytes(tagID)
+	if (errTag == nil) != (errCachedTag == nil) || !bytes.Equal(tag, cachedTag) {
+		// body was changed - drop data
+		if errTag == nil {
+			cachedReceivedMessage.SetOptionBytes(tagID, tag)
+		} else {
+			cachedReceivedMessage.Remove(tagID)
+		}
+		t.reset()
+		err := payloadFile.Truncate(0)
+		if err != nil {
+			return fmt.Errorf("cannot truncate cached message: %w", err)
+		}
+	}
+	if _, ok := t.received[num]; ok {
+		// duplicate block
+		return nil
+	}
+	var data []byte
+	if r.Body() != nil {
+		_, err := r.Body().Seek(0, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("cannot seek to start of block: %w", err)
+		}
+		data, err = ioutil.ReadAll(r.Body())
+		if err != nil {
+			return fmt.Errorf("cannot read block: %w", err)
+		}
+	}
+	off := num * t.szx.Size()
+	if b.limits.MaxReceiveBytes > 0 {
+		end := off + int64(len(data))
+		if held := atomic.LoadInt64(&msgGuard.size); end < held {
+			end = held
+		}
+		used := size(b.receivingMessagesCache) - atomic.LoadInt64(&msgGuard.size)
+		if used+end > b.limits.MaxReceiveBytes {
+			return fmt.Errorf("cannot receive block: %w", ErrReceiveLimitExceeded)
+		}
+	}
+	if msgGuard.quota != nil {
+		end := off + int64(len(data))
+		if held := atomic.LoadInt64(&msgGuard.size); end > held && msgGuard.quota.receiveExceeded(end-held) {
+			return fmt.Errorf("cannot receive block: %w", ErrQuotaExceeded)
+		}
+	}
+	_, err := payloadFile.WriteAt(data, off)
+	if err != nil {
+		return fmt.Errorf("cannot write block to cached message: %w", err)
+	}
+	t.received[num] = struct{}{}
+	if num > t.highest {
+		t.highest = num
+	}
+	if !more {
+		t.last = num
+		t.size = off + int64(len(data))
+	}
+	atomic.StoreInt64(&msgGuard.size, int64(len(payloadFile.Bytes())))
+	if b.limits.ReceiveTimeout > 0 {
+		// the peer made progress, so the transfer is not stalled
+		b.receivingMessagesCache.Replace(r.Token().String(), msgGuard, expire(b.limits.ReceiveTimeout, deadline, hasDeadline))
+	}
+	return nil
+}
+
+// completeQBlock returns the received message of the complete transfer.
+func (b *BlockWise) completeQBlock(msgGuard *messageGuard, r Message, blockType message.OptionID, sizeType message.OptionID) (Message, error) {
+	t := msgGuard.qblock
+	cachedReceivedMessage := msgGuard.Message
+	payloadFile, ok := cachedReceivedMessage.Body().(*memfile.File)
+	if !ok {
+		return nil, fmt.Errorf("invalid body type(%T) stored in receivingMessagesCache", cachedReceivedMessage.Body())
+	}
+	err := payloadFile.Truncate(t.size)
+	if err != nil {
+		return nil, fmt.Errorf("cannot truncate cached message: %w", err)
+	}
+	cachedReceivedMessage.Remove(blockType)
+	cachedReceivedMessage.Remove(sizeType)
+	cachedReceivedMessage.Remove(message.RequestTag)
+	cachedReceivedMessage.SetCode(r.Code())
+	setTypeFrom(cachedReceivedMessage, r)
+	_, err = payloadFile.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek to start of cached message: %w", err)
+	}
+	t.done = true
+	atomic.StoreInt64(&msgGuard.size, 0)
+	return cachedReceivedMessage, nil
+}
+
+// processQBlock1 receives block of Q-Block1 request. The server responds only to the last block of a set,
+// which is acknowledged by 2.31 (Continue), or missing blocks of the set are requested by 4.08 (Request Entity Incomplete).
+func (b *BlockWise) processQBlock1(w ResponseWriter, r Message, next func(w ResponseWriter, r Message)) error {
+	szx, num, more, err := decodeQBlock(r, message.QBlock1)
+	if err != nil {
+		return err
+	}
+	tokenStr := r.Token().String()
+	msgGuard, err := b.acquireQBlockTransfer(r, szx, message.Size1, time.Time{}, false)
+	if err != nil {
+		return err
+	}
+	defer msgGuard.Release(1)
+	t := msgGuard.qblock
+	err = b.storeQBlock(msgGuard, r, num, more, message.RequestTag, time.Time{}, false)
+	if err != nil {
+		deleteTransfer(b.receivingMessagesCache, tokenStr)
+		return err
+	}
+	if more && !isSetEnd(num) && !isConfirmable(r) {
+		// response is sent to the last block of the set
+		return nil
+	}
+	if missing := t.missing(num); len(missing) > 0 {
+		sendMessage := b.acquireMessage(r.Context())
+		sendMessage.SetCode(codes.RequestEntityIncomplete)
+		sendMessage.SetToken(r.Token())
+		sendMessage.SetOptionUint32(message.ContentFormat, uint32(message.AppMissingBlocks))
+		sendMessage.SetBody(bytes.NewReader(encodeMissingBlocks(missing)))
+		w.SetMessage(sendMessage)
+		return nil
+	}
+	if more {
+		block, err := EncodeBlockOption(szx, num, true)
+		if err != nil {
+			return fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, num, true, err)
+		}
+		sendMessage := b.acquireMessage(r.Context())
+		sendMessage.SetCode(codes.Continue)
+		sendMessage.SetToken(r.Token())
+		sendMessage.SetOptionUint32(message.QBlock1, block)
+		w.SetMessage(sendMessage)
+		return nil
+	}
+	cachedReceivedMessage, err := b.completeQBlock(msgGuard, r, message.QBlock1, message.Size1)
+	if err != nil {
+		deleteTransfer(b.receivingMessagesCache, tokenStr)
+		return err
+	}
+	deleteTransfer(b.receivingMessagesCache, tokenStr)
+	next(w, cachedReceivedMessage)
+	return nil
+}
+
+// handleQBlock2Request sends blocks of the response requested by Q-Block2 options. The first request is handled
+// by next and the response is cached for requests of the following sets and of the missing blocks.
+func (b *BlockWise) handleQBlock2Request(w ResponseWriter, mw messageWriter, r Message, maxSZX SZX, maxMessageSize int, next func(w ResponseWriter, r Message)) error {
+	options := r.Options()
+	first, last, err := options.Find(message.QBlock2)
+	if err != nil {
+		return fmt.Errorf("cannot get %v options: %w", message.QBlock2, err)
+	}
+	blocks := make([]uint32, 0, last-first)
+	for _, opt := range options[first:last] {
+		block, _, err := message.DecodeUint32(opt.Value)
+		if err != nil {
+			return fmt.Errorf("cannot decode %v option: %w", message.QBlock2, err)
+		}
+		blocks = append(blocks, block)
+	}
+	if maxSZX > SZX1024 {
+		maxSZX = SZX1024
+	}
+	tokenStr := r.Token().String()
+	if v, ok := b.sendingMessagesCache.Get(tokenStr); ok {
+		msgGuard := v.(*messageGuard)
+		err := msgGuard.Acquire(r.Context(), 1)
+		if err != nil {
+			return fmt.Errorf("cannot lock message: %v", err)
+		}
+		defer msgGuard.Release(1)
+		err = b.sendQBlock2(w, mw, msgGuard.Message, blocks, maxSZX, maxMessageSize, r.Token())
+		if err != nil {
+			return err
+		}
+		if b.limits.SendTimeout > 0 {
+			// the peer made progress, so the transfer is not stalled
+			deadline, ok := msgGuard.Context().Deadline()
+			b.sendingMessagesCache.Replace(tokenStr, msgGuard, expire(b.limits.SendTimeout, deadline, ok))
+		}
+		return nil
+	}
+
+	r.Remove(message.QBlock2)
+	next(w, r)
+	if len(blocks) == 0 || w.Message().Body() == nil {
+		return nil
+	}
+	szx, _, _, err := DecodeBlockOption(blocks[0])
+	if err != nil {
+		return fmt.Errorf("cannot decode %v option: %w", message.QBlock2, err)
+	}
+	if szx > maxSZX {
+		szx = maxSZX
+	}
+	payloadSize, err := w.Message().BodySize()
+	if err != nil {
+		return fmt.Errorf("cannot get size of payload: %w", err)
+	}
+	if payloadSize <= szx.Size() {
+		return nil
+	}
+	sendingMessage := b.acquireMessage(w.Message().Context())
+	sendingMessage.ResetOptionsTo(w.Message().Options())
+	sendingMessage.SetBody(w.Message().Body())
+	sendingMessage.SetCode(w.Message().Code())
+	sendingMessage.SetToken(w.Message().Token())
+	// report stalled transfers before the new one is counted
+	b.sendingMessagesCache.DeleteExpired()
+	if b.limits.MaxSendBytes > 0 && size(b.sendingMessagesCache)+payloadSize > b.limits.MaxSendBytes {
+		b.releaseMessage(sendingMessage)
+		return fmt.Errorf("cannot add to response cache: %w", ErrSendLimitExceeded)
+	}
+	q := b.quotaOf(r)
+	if q.sendExceeded(payloadSize) {
+		b.releaseMessage(sendingMessage)
+		return fmt.Errorf("cannot add to response cache: %w", ErrQuotaExceeded)
+	}
+	deadline, ok := sendingMessage.Context().Deadline()
+	msgGuard := newRequestGuard(sendingMessage)
+	msgGuard.size = payloadSize
+	b.addToQuota(msgGuard, q)
+	err = b.sendingMessagesCache.Add(tokenStr, msgGuard, expire(b.limits.SendTimeout, deadline, ok))
+	if err != nil {
+		b.releaseMessage(sendingMessage)
+		return fmt.Errorf("cannot add to response cache: %w", err)
+	}
+	// the first request gets the first set
+	block, err := EncodeBlockOption(szx, 0, true)
+	if err != nil {
+		return fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, 0, true, err)
+	}
+	return b.sendQBlock2(w, mw, sendingMessage, []uint32{block}, szx, maxMessageSize, sendingMessage.Token())
+}
+
+// sendQBlock2 sends the requested blocks of sendingMessage. A block with M bit requests the rest of its set.
+// The last block is the response to the request, the others are written as separate messages before it.
+func (b *BlockWise) sendQBlock2(w ResponseWriter, mw messageWriter, sendingMessage Message, blocks []uint32, maxSZX SZX, maxMessageSize int, token message.Token) error {
+	payloadSize, err := sendingMessage.BodySize()
+	if err != nil {
+		return fmt.Errorf("cannot get size of payload: %w", err)
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no block was requested")
+	}
+	szx, _, _, err := DecodeBlockOption(blocks[0])
+	if err != nil {
+		return fmt.Errorf("cannot decode %v option: %w", message.QBlock2, err)
+	}
+	if szx > maxSZX {
+		szx = maxSZX
+	}
+	lastNum := (payloadSize - 1) / szx.Size()
+	nums := make([]int64, 0, len(blocks))
+	for _, block := range blocks {
+		blockSzx, num, more, err := DecodeBlockOption(block)
+		if err != nil {
+			return fmt.Errorf("cannot decode %v option: %w", message.QBlock2, err)
+		}
+		num = num * blockSzx.Size() / szx.Size()
+		if more {
+			nums = append(nums, qblockSet(num, lastNum)...)
+		} else if num <= lastNum {
+			nums = append(nums, num)
+		}
+	}
+	if len(nums) == 0 {
+		return fmt.Errorf("requested blocks are out of range")
+	}
+	for i, num := range nums {
+		sendMessage, _, err := b.newBlockMessage(sendingMessage, num*szx.Size(), szx, maxMessageSize, token, message.QBlock2, message.Size2)
+		if err != nil {
+			return err
+		}
+		if i == len(nums)-1 {
+			w.SetMessage(sendMessage)
+			return nil
+		}
+		err = mw.WriteMessage(sendMessage)
+		b.releaseMessage(sendMessage)
+		if err != nil {
+			return fmt.Errorf("cannot write block %v: %w", num, err)
+		}
+	}
+	return nil
+}
+
+// processQBlock2 receives block of Q-Block2 response. When the last block of a set arrives, the client requests
+// the missing blocks of the set or the next set.
+func (b *BlockWise) processQBlock2(w ResponseWriter, r Message, next func(w ResponseWriter, r Message)) error {
+	token := r.Token()
+	sendedRequest := b.getSendedRequest(token)
+	if sendedRequest == nil {
+		// the transfer was finished or canceled
+		return nil
+	}
+	defer b.releaseMessage(sendedRequest)
+	szx, num, more, err := decodeQBlock(r, message.QBlock2)
+	if err != nil {
+		return err
+	}
+	deadline, hasDeadline := sendedRequest.Context().Deadline()
+	msgGuard, err := b.acquireQBlockTransfer(r, szx, message.Size2, deadline, hasDeadline)
+	if err != nil {
+		return err
+	}
+	defer msgGuard.Release(1)
+	t := msgGuard.qblock
+	if t.done {
+		// duplicate block of the delivered body
+		return nil
+	}
+	err = b.storeQBlock(msgGuard, r, num, more, message.ETag, deadline, hasDeadline)
+	if err != nil {
+		return err
+	}
+	if t.complete() {
+		cachedReceivedMessage, err := b.completeQBlock(msgGuard, r, message.QBlock2, message.Size2)
+		if err != nil {
+			return err
+		}
+		next(w, cachedReceivedMessage)
+		return nil
+	}
+	trigger := num == t.awaited || (t.awaited < 0 && (!more || isSetEnd(num)))
+	if !trigger {
+		return nil
+	}
+	t.awaited = -1
+	var blocks []uint32
+	if missing := t.missing(t.highest); len(missing) > 0 {
+		for _, m := range missing {
+			block, err := EncodeBlockOption(szx, m, false)
+			if err != nil {
+				return fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, m, false, err)
+			}
+			blocks = append(blocks, block)
+		}
+		t.awaited = missing[len(missing)-1]
+	} else {
+		block, err := EncodeBlockOption(szx, t.highest+1, true)
+		if err != nil {
+			return fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, t.highest+1, true, err)
+		}
+		blocks = append(blocks, block)
+	}
+	w.SetMessage(b.newQBlock2Request(sendedRequest, token, blocks))
+	return nil
+}
+
+// newQBlock2Request creates request for the blocks of the response.
+func (b *BlockWise) newQBlock2Request(sendedRequest Message, token message.Token, blocks []uint32) Message {
+	options := append(message.Options{}, sendedRequest.Options()...)
+	options = options.Remove(message.QBlock2)
+	options = options.Remove(message.Observe)
+	for _, block := range blocks {
+		buf := make([]byte, 4)
+		n, _ := message.EncodeUint32(buf, block)
+		options = options.Add(message.Option{ID: message.QBlock2, Value: buf[:n]})
+	}
+	req := b.acquireMessage(sendedRequest.Context())
+	req.SetCode(sendedRequest.Code())
+	req.SetToken(token)
+	req.ResetOptionsTo(options)
+	return req
+}
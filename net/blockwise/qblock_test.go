@@ -0,0 +1,32 @@
+package blockwise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingBlocks(t *testing.T) {
+	missing := []int64{0, 23, 24, 255, 256, 65535, 65536, maxBlockNumber}
+	data := encodeMissingBlocks(missing)
+	require.Equal(t, []byte{
+		0x00, 0x17, 0x18, 0x18, 0x18, 0xff, 0x19, 0x01, 0x00, 0x19, 0xff, 0xff,
+		0x1a, 0x00, 0x01, 0x00, 0x00, 0x1a, 0x00, 0x0f, 0xff, 0xf7,
+	}, data)
+	got, err := decodeMissingBlocks(data)
+	require.NoError(t, err)
+	require.Equal(t, missing, got)
+
+	_, err = decodeMissingBlocks([]byte{0x19, 0x01})
+	require.Error(t, err)
+	_, err = decodeMissingBlocks([]byte{0x20})
+	require.Error(t, err)
+	_, err = decodeMissingBlocks([]byte{0x1a, 0x00, 0x10, 0x00, 0x00})
+	require.ErrorIs(t, err, ErrBlockNumberExceedLimit)
+}
+
+func TestQBlockSet(t *testing.T) {
+	require.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, qblockSet(0, 25))
+	require.Equal(t, []int64{20, 21, 22, 23, 24, 25}, qblockSet(20, 25))
+	require.Equal(t, []int64{7, 8, 9}, qblockSet(7, 25))
+}
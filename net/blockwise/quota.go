@@ -0,0 +1,120 @@
+package blockwise
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Quota bounds bytes held by partial transfers of multiple peers, e.g. of one tenant, so peers sharing a quota
+// cannot exhaust memory of the others. Zero value of a field means no limit. Limits of the peer still apply.
+// Quota is safe for concurrent access from multiple goroutines.
+type Quota struct {
+	// MaxReceiveBytes caps total size of partially received bodies.
+	MaxReceiveBytes int64
+	// MaxSendBytes caps total size of bodies cached for delivery.
+	MaxSendBytes int64
+
+	m sync.Mutex
+	// members are BlockWise instances which hold transfers of the quota
+	members map[*BlockWise]struct{}
+}
+
+// QuotaFunc returns quota of the request, or nil when the request has no quota.
+type QuotaFunc = func(r Message) *Quota
+
+// NewQuota creates a quota shared by peers.
+func NewQuota(maxReceiveBytes, maxSendBytes int64) *Quota {
+	return &Quota{
+		MaxReceiveBytes: maxReceiveBytes,
+		MaxSendBytes:    maxSendBytes,
+		members:         make(map[*BlockWise]struct{}),
+	}
+}
+
+// QuotaOpt quota option.
+type QuotaOpt struct {
+	quota QuotaFunc
+}
+
+func (o QuotaOpt) apply(opts *options) {
+	opts.quota = o.quota
+}
+
+// WithQuota sets function which returns the shared quota of the request, e.g. by the tenant of the peer.
+func WithQuota(quota QuotaFunc) QuotaOpt {
+	return QuotaOpt{quota: quota}
+}
+
+func (q *Quota) join(b *BlockWise) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.members == nil {
+		q.members = make(map[*BlockWise]struct{})
+	}
+	q.members[b] = struct{}{}
+}
+
+func quotaSize(c *cache.Cache, q *Quota) (int64, bool) {
+	var n int64
+	var held bool
+	for _, item := range c.Items() {
+		if g, ok := item.Object.(*messageGuard); ok && g.quota == q {
+			n += atomic.LoadInt64(&g.size)
+			held = true
+		}
+	}
+	return n, held
+}
+
+// Used returns total size of partially received bodies and of bodies cached for delivery.
+func (q *Quota) Used() (receiving int64, sending int64) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	for b := range q.members {
+		r, heldR := quotaSize(b.receivingMessagesCache, q)
+		s, heldS := quotaSize(b.sendingMessagesCache, q)
+		if !heldR && !heldS {
+			// the peer finished transfers or its connection was closed
+			delete(q.members, b)
+			continue
+		}
+		receiving += r
+		sending += s
+	}
+	return receiving, sending
+}
+
+func (q *Quota) receiveExceeded(n int64) bool {
+	if q == nil || q.MaxReceiveBytes <= 0 {
+		return false
+	}
+	receiving, _ := q.Used()
+	return receiving+n > q.MaxReceiveBytes
+}
+
+func (q *Quota) sendExceeded(n int64) bool {
+	if q == nil || q.MaxSendBytes <= 0 {
+		return false
+	}
+	_, sending := q.Used()
+	return sending+n > q.MaxSendBytes
+}
+
+// quotaOf returns quota of the request.
+func (b *BlockWise) quotaOf(r Message) *Quota {
+	if b.quota == nil {
+		return nil
+	}
+	return b.quota(r)
+}
+
+// addToQuota counts the transfer to the quota.
+func (b *BlockWise) addToQuota(g *messageGuard, q *Quota) {
+	if q == nil {
+		return
+	}
+	g.quota = q
+	q.join(b)
+}
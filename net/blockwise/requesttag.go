@@ -0,0 +1,53 @@
+package blockwise
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+const requestTagSeparator = "#"
+
+// receivingTransferKey returns key of the received body. Bodies of requests with the same token are distinguished
+// by Request-Tag option (RFC 9175 section 3), so concurrent transfers from the endpoint are not mixed.
+func receivingTransferKey(tokenStr string, r Message, blockType message.OptionID) string {
+	if blockType != message.Block1 {
+		return tokenStr
+	}
+	tag, err := r.GetOptionBytes(message.RequestTag)
+	if err != nil {
+		return tokenStr
+	}
+	return tokenStr + requestTagSeparator + hex.EncodeToString(tag)
+}
+
+// transferToken returns token of the transfer key.
+func transferToken(key string) string {
+	if i := strings.Index(key, requestTagSeparator); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// setRequestTag sets random Request-Tag to the request whose body is sent in multiple blocks, so the body
+// is distinguished from other bodies sent with the same token. As RFC 9175 section 3.3 scopes it, only
+// requests of unsafe methods are tagged and a tag set by the application is kept.
+func setRequestTag(req Message) error {
+	switch req.Code() {
+	case codes.POST, codes.PUT, codes.DELETE, codes.PATCH, codes.IPATCH:
+	default:
+		return nil
+	}
+	if req.Options().HasOption(message.RequestTag) {
+		return nil
+	}
+	tag, err := message.GetToken()
+	if err != nil {
+		return fmt.Errorf("cannot get request tag: %w", err)
+	}
+	req.SetOptionBytes(message.RequestTag, tag)
+	return nil
+}
@@ -0,0 +1,87 @@
+package blockwise
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit bounds throughput of blockwise transfers in bytes per second, e.g. so a single firmware download
+// doesn't saturate a narrowband link shared by many devices. Zero value of a field means no limit.
+//
+// Blocks are sent, and the next blocks are requested, no sooner than the rate allows, so the peer waits for them
+// instead of the link being congested. The first block of a transfer isn't delayed by the limit of the transfer.
+type RateLimit struct {
+	// PerTransfer bounds every transfer, e.g. one download of a body by Block2.
+	PerTransfer int64
+	// PerConnection bounds all transfers with the peer together.
+	PerConnection int64
+}
+
+// RateLimitOpt rate limit option.
+type RateLimitOpt struct {
+	limit RateLimit
+}
+
+func (o RateLimitOpt) apply(opts *options) {
+	opts.rateLimit = o.limit
+}
+
+// WithRateLimit sets bandwidth of blockwise transfers.
+func WithRateLimit(limit RateLimit) RateLimitOpt {
+	return RateLimitOpt{limit: limit}
+}
+
+// throttle paces transfers of blocks to the rate, nil throttle doesn't limit.
+type throttle struct {
+	bytesPerSecond int64
+
+	mutex sync.Mutex
+	// next is time when the next block may be transferred
+	next time.Time
+}
+
+func newThrottle(bytesPerSecond int64) *throttle {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &throttle{bytesPerSecond: bytesPerSecond}
+}
+
+// reserve returns delay before the transfer of n bytes, the following transfer is delayed by the time
+// of n bytes at the rate.
+func (t *throttle) reserve(n int64) time.Duration {
+	if t == nil || n <= 0 {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	d := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(n) * time.Second / time.Duration(t.bytesPerSecond))
+	return d
+}
+
+// waitThrottles waits until n bytes may be transferred by all throttles.
+func waitThrottles(ctx context.Context, n int64, throttles ...*throttle) error {
+	var d time.Duration
+	for _, t := range throttles {
+		if v := t.reserve(n); v > d {
+			d = v
+		}
+	}
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -17,6 +17,9 @@ type Conn struct {
 	connection     net.Conn
 	onReadTimeout  func() error
 	onWriteTimeout func() error
+	// readIdleTimeout and writeIdleTimeout are disabled by zero
+	readIdleTimeout  time.Duration
+	writeIdleTimeout time.Duration
 
 	handshake  func() error
 	readBuffer *bufio.Reader
@@ -28,9 +31,11 @@ var defaultConnOptions = connOptions{
 }
 
 type connOptions struct {
-	heartBeat      time.Duration
-	onReadTimeout  func() error
-	onWriteTimeout func() error
+	heartBeat        time.Duration
+	onReadTimeout    func() error
+	onWriteTimeout   func() error
+	readIdleTimeout  time.Duration
+	writeIdleTimeout time.Duration
 }
 
 // A ConnOption sets options such as heartBeat, errors parameters, etc.
@@ -45,11 +50,13 @@ func NewConn(c net.Conn, opts ...ConnOption) *Conn {
 		o.applyConn(&cfg)
 	}
 	connection := Conn{
-		connection:     c,
-		heartBeat:      cfg.heartBeat,
-		readBuffer:     bufio.NewReaderSize(c, 2048),
-		onReadTimeout:  cfg.onReadTimeout,
-		onWriteTimeout: cfg.onWriteTimeout,
+		connection:       c,
+		heartBeat:        cfg.heartBeat,
+		readBuffer:       bufio.NewReaderSize(c, 2048),
+		onReadTimeout:    cfg.onReadTimeout,
+		onWriteTimeout:   cfg.onWriteTimeout,
+		readIdleTimeout:  cfg.readIdleTimeout,
+		writeIdleTimeout: cfg.writeIdleTimeout,
 	}
 	if v, ok := c.(interface{ Handshake() error }); ok {
 		connection.handshake = v.Handshake
@@ -83,6 +90,7 @@ func (c *Conn) WriteWithContext(ctx context.Context, data []byte) error {
 	written := 0
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	lastWrite := time.Now()
 	for written < len(data) {
 		select {
 		case <-ctx.Done():
@@ -104,6 +112,7 @@ func (c *Conn) WriteWithContext(ctx context.Context, data []byte) error {
 			if isTemporary(err, deadline) {
 				if n > 0 {
 					written += n
+					lastWrite = time.Now()
 				}
 				if c.onWriteTimeout != nil {
 					err := c.onWriteTimeout()
@@ -111,6 +120,9 @@ func (c *Conn) WriteWithContext(ctx context.Context, data []byte) error {
 						return fmt.Errorf("cannot write to connection: on timeout returns error: %w", err)
 					}
 				}
+				if c.writeIdleTimeout > 0 && time.Since(lastWrite) >= c.writeIdleTimeout {
+					return ErrWriteIdleTimeout
+				}
 				continue
 			}
 			return err
@@ -180,6 +192,7 @@ func (c *Conn) doHandshake(ctx context.Context, onTimeout func() error) error {
 
 // ReadWithContext reads stream with context.
 func (c *Conn) ReadWithContext(ctx context.Context, buffer []byte) (int, error) {
+	start := time.Now()
 	for {
 		select {
 		case <-ctx.Done():
@@ -207,6 +220,9 @@ func (c *Conn) ReadWithContext(ctx context.Context, buffer []byte) (int, error)
 						return -1, fmt.Errorf("cannot read from connection: on timeout returns error: %w", err)
 					}
 				}
+				if c.readIdleTimeout > 0 && time.Since(start) >= c.readIdleTimeout {
+					return -1, ErrReadIdleTimeout
+				}
 				continue
 			}
 			return -1, err
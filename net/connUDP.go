@@ -2,6 +2,7 @@ package net
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -23,23 +24,46 @@ type UDPConn struct {
 	network        string
 	onReadTimeout  func() error
 	onWriteTimeout func() error
+	// batch is number of datagrams read or written by one syscall, see WithBatchIO.
+	batch int
 
-	lock sync.Mutex
+	controlMessageDst sync.Once
+	lock              sync.Mutex
+
+	readLock  sync.Mutex
+	readMsgs  []ipv4.Message
+	readNext  int
+	readCount int
+
+	writeLock     sync.Mutex
+	pendingWrites []*batchWrite
+	// fair orders pending writes by WithFairScheduling instead of pendingWrites.
+	fair *fairQueue
+	// flowLabel labels written IPv6 datagrams by WithFlowLabel.
+	flowLabel  FlowLabelFunc
+	flowLabels flowLabels
+
+	groups groups
 }
 
 type ControlMessage struct {
 	Src     net.IP // source address, specifying only
+	Dst     net.IP // destination address, receiving only
 	IfIndex int    // interface index, must be 1 <= value when specifying
 }
 
 type packetConn interface {
 	SetWriteDeadline(t time.Time) error
 	WriteTo(b []byte, cm *ControlMessage, dst net.Addr) (n int, err error)
+	ReadFrom(b []byte) (n int, cm *ControlMessage, src net.Addr, err error)
+	SetControlMessageDst(on bool) error
 	SetMulticastInterface(ifi *net.Interface) error
 	SetMulticastHopLimit(hoplim int) error
 	SetMulticastLoopback(on bool) error
 	JoinGroup(ifi *net.Interface, group net.Addr) error
 	LeaveGroup(ifi *net.Interface, group net.Addr) error
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
 }
 
 type packetConnIPv4 struct {
@@ -69,6 +93,21 @@ func (p *packetConnIPv4) WriteTo(b []byte, cm *ControlMessage, dst net.Addr) (n
 	return p.packetConnIPv4.WriteTo(b, c, dst)
 }
 
+func (p *packetConnIPv4) ReadFrom(b []byte) (n int, cm *ControlMessage, src net.Addr, err error) {
+	n, c, src, err := p.packetConnIPv4.ReadFrom(b)
+	if c != nil {
+		cm = &ControlMessage{
+			Dst:     c.Dst,
+			IfIndex: c.IfIndex,
+		}
+	}
+	return n, cm, src, err
+}
+
+func (p *packetConnIPv4) SetControlMessageDst(on bool) error {
+	return p.packetConnIPv4.SetControlMessage(ipv4.FlagDst|ipv4.FlagInterface, on)
+}
+
 func (p *packetConnIPv4) SetMulticastHopLimit(hoplim int) error {
 	return p.packetConnIPv4.SetMulticastTTL(hoplim)
 }
@@ -85,6 +124,14 @@ func (p *packetConnIPv4) LeaveGroup(ifi *net.Interface, group net.Addr) error {
 	return p.packetConnIPv4.LeaveGroup(ifi, group)
 }
 
+func (p *packetConnIPv4) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	return p.packetConnIPv4.ReadBatch(ms, flags)
+}
+
+func (p *packetConnIPv4) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return p.packetConnIPv4.WriteBatch(ms, flags)
+}
+
 type packetConnIPv6 struct {
 	packetConnIPv6 *ipv6.PacketConn
 }
@@ -112,6 +159,21 @@ func (p *packetConnIPv6) WriteTo(b []byte, cm *ControlMessage, dst net.Addr) (n
 	return p.packetConnIPv6.WriteTo(b, c, dst)
 }
 
+func (p *packetConnIPv6) ReadFrom(b []byte) (n int, cm *ControlMessage, src net.Addr, err error) {
+	n, c, src, err := p.packetConnIPv6.ReadFrom(b)
+	if c != nil {
+		cm = &ControlMessage{
+			Dst:     c.Dst,
+			IfIndex: c.IfIndex,
+		}
+	}
+	return n, cm, src, err
+}
+
+func (p *packetConnIPv6) SetControlMessageDst(on bool) error {
+	return p.packetConnIPv6.SetControlMessage(ipv6.FlagDst|ipv6.FlagInterface, on)
+}
+
 func (p *packetConnIPv6) SetMulticastHopLimit(hoplim int) error {
 	return p.packetConnIPv6.SetMulticastHopLimit(hoplim)
 }
@@ -128,6 +190,15 @@ func (p *packetConnIPv6) LeaveGroup(ifi *net.Interface, group net.Addr) error {
 	return p.packetConnIPv6.LeaveGroup(ifi, group)
 }
 
+// ReadBatch reads messages of ipv6 connection, ipv4.Message and ipv6.Message are the same type.
+func (p *packetConnIPv6) ReadBatch(ms []ipv4.Message, flags int) (int, error) {
+	return p.packetConnIPv6.ReadBatch(ms, flags)
+}
+
+func (p *packetConnIPv6) WriteBatch(ms []ipv4.Message, flags int) (int, error) {
+	return p.packetConnIPv6.WriteBatch(ms, flags)
+}
+
 func (p *packetConnIPv6) SetControlMessage(on bool) error {
 	return p.packetConnIPv6.SetMulticastLoopback(on)
 }
@@ -152,6 +223,9 @@ type udpConnOptions struct {
 	errors         func(err error)
 	onReadTimeout  func() error
 	onWriteTimeout func() error
+	batch          int
+	fairQuantum    int
+	flowLabel      FlowLabelFunc
 }
 
 func NewListenUDP(network, addr string, opts ...UDPOption) (*UDPConn, error) {
@@ -181,7 +255,7 @@ func NewUDPConn(network string, c *net.UDPConn, opts ...UDPOption) *UDPConn {
 		packetConn = newPacketConnIPv4(ipv4.NewPacketConn(c))
 	}
 
-	return &UDPConn{
+	conn := &UDPConn{
 		network:        network,
 		connection:     c,
 		heartBeat:      cfg.heartBeat,
@@ -189,7 +263,16 @@ func NewUDPConn(network string, c *net.UDPConn, opts ...UDPOption) *UDPConn {
 		errors:         cfg.errors,
 		onReadTimeout:  cfg.onReadTimeout,
 		onWriteTimeout: cfg.onWriteTimeout,
+		flowLabel:      cfg.flowLabel,
+	}
+	if cfg.batch > 1 {
+		conn.batch = cfg.batch
+		conn.readMsgs = newBatchMessages(cfg.batch)
 	}
+	if cfg.fairQuantum > 0 {
+		conn.fair = newFairQueue(cfg.fairQuantum)
+	}
+	return conn
 }
 
 // LocalAddr returns the local network address. The Addr returned is shared by all invocations of LocalAddr, so do not modify it.
@@ -263,6 +346,7 @@ func (c *UDPConn) WriteMulticast(ctx context.Context, raddr *net.UDPAddr, hopLim
 	if err != nil {
 		return fmt.Errorf("cannot write multicast with context: cannot get interfaces for multicast connection: %w", err)
 	}
+	hopLimit = c.groups.hopLimit(raddr.IP, hopLimit)
 	c.lock.Lock()
 	defer c.lock.Unlock()
 LOOP:
@@ -313,10 +397,17 @@ func (c *UDPConn) WriteWithContext(ctx context.Context, raddr *net.UDPAddr, buff
 	if raddr == nil {
 		return fmt.Errorf("cannot write with context: invalid raddr")
 	}
-
-	written := 0
+	if c.batch > 1 || c.fair != nil {
+		return c.writeQueued(ctx, raddr, buffer)
+	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	return c.writeTo(ctx, raddr, buffer)
+}
+
+// writeTo writes the datagram, the caller holds lock.
+func (c *UDPConn) writeTo(ctx context.Context, raddr *net.UDPAddr, buffer []byte) error {
+	written := 0
 	for written < len(buffer) {
 		select {
 		case <-ctx.Done():
@@ -328,7 +419,7 @@ func (c *UDPConn) WriteWithContext(ctx context.Context, raddr *net.UDPAddr, buff
 		if err != nil {
 			return fmt.Errorf("cannot set write deadline for udp connection: %w", err)
 		}
-		n, err := WriteToUDP(c.connection, raddr, buffer[written:])
+		n, err := c.writeDatagram(ctx, raddr, buffer[written:])
 		if err != nil {
 			if isTemporary(err, deadline) {
 				if c.onWriteTimeout != nil {
@@ -347,8 +438,24 @@ func (c *UDPConn) WriteWithContext(ctx context.Context, raddr *net.UDPAddr, buff
 	return nil
 }
 
+// writeDatagram writes the datagram labeled by the flow label of the connection.
+func (c *UDPConn) writeDatagram(ctx context.Context, raddr *net.UDPAddr, buffer []byte) (int, error) {
+	if c.flowLabel != nil && IsIPv6(raddr.IP) {
+		if label := c.flowLabel(ctx, raddr); label != 0 {
+			n, err := c.flowLabels.write(c, raddr, label&maxFlowLabel, buffer)
+			if !errors.Is(err, errFlowLabelUnavailable) {
+				return n, err
+			}
+		}
+	}
+	return WriteToUDP(c.connection, raddr, buffer)
+}
+
 // ReadWithContext reads packet with context.
 func (c *UDPConn) ReadWithContext(ctx context.Context, buffer []byte) (int, *net.UDPAddr, error) {
+	if c.batch > 1 {
+		return c.readBatched(ctx, buffer)
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -378,6 +485,52 @@ func (c *UDPConn) ReadWithContext(ctx context.Context, buffer []byte) (int, *net
 	}
 }
 
+// ReadWithDestination reads packet with context as ReadWithContext and it returns also destination address
+// of the packet, e.g. to recognize requests sent to a multicast group. The destination is nil when
+// the platform doesn't report it.
+func (c *UDPConn) ReadWithDestination(ctx context.Context, buffer []byte) (int, *net.UDPAddr, net.IP, error) {
+	c.controlMessageDst.Do(func() {
+		if err := c.packetConn.SetControlMessageDst(true); err != nil {
+			c.errors(fmt.Errorf("cannot enable destination of received packets: %w", err))
+		}
+	})
+	for {
+		select {
+		case <-ctx.Done():
+			return -1, nil, nil, ctx.Err()
+		default:
+		}
+		deadline := time.Now().Add(c.heartBeat)
+		err := c.connection.SetReadDeadline(deadline)
+		if err != nil {
+			return -1, nil, nil, fmt.Errorf("cannot set read deadline for udp connection: %w", err)
+		}
+		n, cm, s, err := c.packetConn.ReadFrom(buffer)
+		if err != nil {
+			// check context in regular intervals and then resume listening
+			if isTemporary(err, deadline) {
+				if c.onReadTimeout != nil {
+					err := c.onReadTimeout()
+					if err != nil {
+						return -1, nil, nil, fmt.Errorf("cannot read from udp connection: on timeout returns error: %w", err)
+					}
+				}
+				continue
+			}
+			return -1, nil, nil, fmt.Errorf("cannot read from udp connection: %w", err)
+		}
+		raddr, ok := s.(*net.UDPAddr)
+		if !ok {
+			return -1, nil, nil, fmt.Errorf("cannot read from udp connection: unsupported address %T", s)
+		}
+		var dst net.IP
+		if cm != nil {
+			dst = cm.Dst
+		}
+		return n, raddr, dst, nil
+	}
+}
+
 // SetMulticastLoopback sets whether transmitted multicast packets
 // should be copied and send back to the originator.
 func (c *UDPConn) SetMulticastLoopback(on bool) error {
@@ -394,11 +547,25 @@ func (c *UDPConn) SetMulticastLoopback(on bool) error {
 // depends on platforms and sometimes it might require routing
 // configuration.
 func (c *UDPConn) JoinGroup(ifi *net.Interface, group net.Addr) error {
-	return c.packetConn.JoinGroup(ifi, group)
+	ip, err := groupIP(group)
+	if err != nil {
+		return err
+	}
+	err = c.packetConn.JoinGroup(ifi, group)
+	if err != nil {
+		return err
+	}
+	c.groups.add(ip, ifi, false)
+	return nil
 }
 
 // LeaveGroup leaves the group address group on the interface ifi
 // regardless of whether the group is any-source group or source-specific group.
 func (c *UDPConn) LeaveGroup(ifi *net.Interface, group net.Addr) error {
+	ip, err := groupIP(group)
+	if err != nil {
+		return err
+	}
+	c.groups.remove(ip, ifi)
 	return c.packetConn.LeaveGroup(ifi, group)
 }
@@ -0,0 +1,183 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// maxUDPPayload is the maximal payload of UDP datagram.
+const maxUDPPayload = 65535
+
+// batchWrite is a datagram waiting for the next batch or for its turn.
+type batchWrite struct {
+	// ctx is context of the writer, the datagram can be written by another one.
+	ctx    context.Context
+	raddr  *net.UDPAddr
+	buffer []byte
+	// done and err are guarded by writeLock of the connection.
+	done bool
+	err  error
+}
+
+func newBatchMessages(n int) []ipv4.Message {
+	msgs := make([]ipv4.Message, n)
+	for i := range msgs {
+		msgs[i].Buffers = [][]byte{make([]byte, maxUDPPayload)}
+	}
+	return msgs
+}
+
+// readBatched returns the next datagram of the batch, the batch is read when all its datagrams were returned.
+func (c *UDPConn) readBatched(ctx context.Context, buffer []byte) (int, *net.UDPAddr, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	for c.readNext >= c.readCount {
+		select {
+		case <-ctx.Done():
+			return -1, nil, ctx.Err()
+		default:
+		}
+		deadline := time.Now().Add(c.heartBeat)
+		err := c.connection.SetReadDeadline(deadline)
+		if err != nil {
+			return -1, nil, fmt.Errorf("cannot set read deadline for udp connection: %w", err)
+		}
+		n, err := c.packetConn.ReadBatch(c.readMsgs, 0)
+		if err != nil {
+			// check context in regular intervals and then resume listening
+			if isTemporary(err, deadline) {
+				if c.onReadTimeout != nil {
+					err := c.onReadTimeout()
+					if err != nil {
+						return -1, nil, fmt.Errorf("cannot read from udp connection: on timeout returns error: %w", err)
+					}
+				}
+				continue
+			}
+			return -1, nil, fmt.Errorf("cannot read from udp connection: %w", err)
+		}
+		c.readNext, c.readCount = 0, n
+	}
+	m := &c.readMsgs[c.readNext]
+	c.readNext++
+	raddr, ok := m.Addr.(*net.UDPAddr)
+	if !ok {
+		return -1, nil, fmt.Errorf("cannot read from udp connection: unsupported address %T", m.Addr)
+	}
+	n := copy(buffer, m.Buffers[0][:m.N])
+	return n, raddr, nil
+}
+
+// writeQueued queues the datagram and writes the queued datagrams, in batches by WithBatchIO and in the order
+// of WithFairScheduling, unless another writer has already written them.
+func (c *UDPConn) writeQueued(ctx context.Context, raddr *net.UDPAddr, buffer []byte) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	w := &batchWrite{
+		ctx:    ctx,
+		raddr:  raddr,
+		buffer: buffer,
+	}
+	c.writeLock.Lock()
+	if c.fair != nil {
+		c.fair.push(w)
+	} else {
+		c.pendingWrites = append(c.pendingWrites, w)
+	}
+	c.writeLock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for {
+		c.writeLock.Lock()
+		if w.done {
+			err := w.err
+			c.writeLock.Unlock()
+			return err
+		}
+		writes := c.popWritesLocked()
+		c.writeLock.Unlock()
+
+		var sent int
+		var err error
+		if c.batch > 1 {
+			sent, err = c.writeBatch(writes)
+		} else if err = c.writeTo(writes[0].ctx, writes[0].raddr, writes[0].buffer); err == nil {
+			sent = 1
+		}
+		c.writeLock.Lock()
+		for i, bw := range writes {
+			bw.done = true
+			if i >= sent {
+				bw.err = err
+			}
+		}
+		c.writeLock.Unlock()
+	}
+}
+
+// popWritesLocked removes datagrams of the next write from the queue.
+func (c *UDPConn) popWritesLocked() []*batchWrite {
+	n := c.batch
+	if n < 1 {
+		n = 1
+	}
+	if c.fair != nil {
+		writes := make([]*batchWrite, 0, n)
+		for len(writes) < n {
+			w := c.fair.pop()
+			if w == nil {
+				break
+			}
+			writes = append(writes, w)
+		}
+		return writes
+	}
+	if n > len(c.pendingWrites) {
+		n = len(c.pendingWrites)
+	}
+	writes := append([]*batchWrite(nil), c.pendingWrites[:n]...)
+	c.pendingWrites = c.pendingWrites[n:]
+	return writes
+}
+
+// writeBatch writes the datagrams, it returns number of written datagrams.
+func (c *UDPConn) writeBatch(writes []*batchWrite) (int, error) {
+	msgs := make([]ipv4.Message, len(writes))
+	for i, w := range writes {
+		msgs[i].Buffers = [][]byte{w.buffer}
+		msgs[i].Addr = w.raddr
+	}
+	sent := 0
+	for sent < len(msgs) {
+		deadline := time.Now().Add(c.heartBeat)
+		err := c.connection.SetWriteDeadline(deadline)
+		if err != nil {
+			return sent, fmt.Errorf("cannot set write deadline for udp connection: %w", err)
+		}
+		n, err := c.packetConn.WriteBatch(msgs[sent:], 0)
+		if n > 0 {
+			sent += n
+		}
+		if err != nil {
+			if isTemporary(err, deadline) {
+				if c.onWriteTimeout != nil {
+					err := c.onWriteTimeout()
+					if err != nil {
+						return sent, fmt.Errorf("cannot write to udp connection: on timeout returns error: %w", err)
+					}
+				}
+				continue
+			}
+			return sent, fmt.Errorf("cannot write to udp connection: %w", err)
+		}
+	}
+	return sent, nil
+}
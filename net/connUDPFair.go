@@ -0,0 +1,57 @@
+package net
+
+// fairFlow is the queue of datagrams to one remote address.
+type fairFlow struct {
+	key     string
+	writes  []*batchWrite
+	deficit int
+}
+
+// fairQueue orders datagrams waiting for write by deficit round robin over remote addresses, so every peer
+// gets the quantum of bytes per round regardless of how many datagrams the others queue.
+type fairQueue struct {
+	quantum int
+	flows   map[string]*fairFlow
+	// active are flows with queued datagrams in the order of their turns
+	active []*fairFlow
+}
+
+func newFairQueue(quantum int) *fairQueue {
+	return &fairQueue{
+		quantum: quantum,
+		flows:   make(map[string]*fairFlow),
+	}
+}
+
+func (q *fairQueue) push(w *batchWrite) {
+	key := w.raddr.String()
+	f, ok := q.flows[key]
+	if !ok {
+		f = &fairFlow{key: key, deficit: q.quantum}
+		q.flows[key] = f
+		q.active = append(q.active, f)
+	}
+	f.writes = append(f.writes, w)
+}
+
+// pop returns the next datagram to write or nil when the queue is empty.
+func (q *fairQueue) pop() *batchWrite {
+	for len(q.active) > 0 {
+		f := q.active[0]
+		if len(f.writes) == 0 {
+			q.active = q.active[1:]
+			delete(q.flows, f.key)
+			continue
+		}
+		w := f.writes[0]
+		if len(w.buffer) <= f.deficit {
+			f.writes = f.writes[1:]
+			f.deficit -= len(w.buffer)
+			return w
+		}
+		// the turn of the flow is over, it gets the quantum for the next one
+		f.deficit += q.quantum
+		q.active = append(q.active[1:], f)
+	}
+	return nil
+}
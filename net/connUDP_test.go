@@ -183,3 +183,158 @@ func TestUDPConn_writeMulticastWithContext(t *testing.T) {
 		})
 	}
 }
+
+func TestUDPConn_BatchIO(t *testing.T) {
+	const count = 200
+	a, err := net.ResolveUDPAddr("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	l1, err := net.ListenUDP("udp4", a)
+	require.NoError(t, err)
+	c1 := NewUDPConn("udp4", l1, WithHeartBeat(time.Millisecond*100), WithBatchIO(16))
+	defer c1.Close()
+	l2, err := net.ListenUDP("udp4", a)
+	require.NoError(t, err)
+	c2 := NewUDPConn("udp4", l2, WithHeartBeat(time.Millisecond*100), WithBatchIO(16))
+	defer c2.Close()
+	require.NoError(t, l2.SetReadBuffer(1024*1024))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := c1.WriteWithContext(ctx, c2.LocalAddr().(*net.UDPAddr), []byte(strconv.Itoa(i)))
+			assert.NoError(t, err)
+		}(i)
+	}
+	received := make(map[string]bool)
+	buf := make([]byte, 1024)
+	for len(received) < count {
+		n, raddr, err := c2.ReadWithContext(ctx, buf)
+		require.NoError(t, err)
+		require.Equal(t, c1.LocalAddr().String(), raddr.String())
+		received[string(buf[:n])] = true
+	}
+	wg.Wait()
+	for i := 0; i < count; i++ {
+		require.True(t, received[strconv.Itoa(i)])
+	}
+}
+
+func TestFairQueue(t *testing.T) {
+	chatty := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	quiet := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2}
+	q := newFairQueue(100)
+	for i := 0; i < 4; i++ {
+		q.push(&batchWrite{raddr: chatty, buffer: make([]byte, 60)})
+	}
+	q.push(&batchWrite{raddr: quiet, buffer: make([]byte, 60)})
+	q.push(&batchWrite{raddr: quiet, buffer: make([]byte, 60)})
+
+	var order []int
+	for w := q.pop(); w != nil; w = q.pop() {
+		order = append(order, w.raddr.Port)
+	}
+	// the quiet peer gets its turn after the quantum of the chatty one, the unused part
+	// of the quantum is carried to the next round
+	require.Equal(t, []int{1, 2, 1, 1, 2, 1}, order)
+	require.Empty(t, q.flows)
+}
+
+func TestUDPConn_FairScheduling(t *testing.T) {
+	const count = 100
+	a, err := net.ResolveUDPAddr("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	l1, err := net.ListenUDP("udp4", a)
+	require.NoError(t, err)
+	c1 := NewUDPConn("udp4", l1, WithHeartBeat(time.Millisecond*100), WithFairScheduling(1500))
+	defer c1.Close()
+	receivers := make([]*UDPConn, 2)
+	for i := range receivers {
+		l, err := net.ListenUDP("udp4", a)
+		require.NoError(t, err)
+		require.NoError(t, l.SetReadBuffer(1024*1024))
+		receivers[i] = NewUDPConn("udp4", l, WithHeartBeat(time.Millisecond*100))
+		defer receivers[i].Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		for _, r := range receivers {
+			wg.Add(1)
+			go func(i int, raddr *net.UDPAddr) {
+				defer wg.Done()
+				err := c1.WriteWithContext(ctx, raddr, []byte(strconv.Itoa(i)))
+				assert.NoError(t, err)
+			}(i, r.LocalAddr().(*net.UDPAddr))
+		}
+	}
+	wg.Wait()
+	for _, r := range receivers {
+		received := make(map[string]bool)
+		buf := make([]byte, 1024)
+		for len(received) < count {
+			n, _, err := r.ReadWithContext(ctx, buf)
+			require.NoError(t, err)
+			received[string(buf[:n])] = true
+		}
+	}
+}
+
+func TestMulticastScopeOf(t *testing.T) {
+	for group, scope := range map[string]MulticastScope{
+		"224.0.0.251": ScopeLinkLocal,
+		"239.255.0.1": ScopeSiteLocal,
+		"224.0.1.187": ScopeGlobal,
+		"ff02::fd":    ScopeLinkLocal,
+		"ff05::fd":    ScopeSiteLocal,
+		"ff0e::fd":    ScopeGlobal,
+	} {
+		require.Equal(t, scope, MulticastScopeOf(net.ParseIP(group)), group)
+	}
+}
+
+func TestUDPConn_Groups(t *testing.T) {
+	ifaces, err := MulticastInterfaces()
+	require.NoError(t, err)
+	if len(ifaces) == 0 {
+		t.Skip("no multicast interface")
+	}
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	c := NewUDPConn("udp4", l, WithErrors(func(err error) { t.Log(err) }))
+	defer c.Close()
+
+	group := &net.UDPAddr{IP: net.ParseIP("224.0.1.187")}
+	err = c.JoinGroupAll(group)
+	require.NoError(t, err)
+	err = c.SetGroupHopLimit(group, 3)
+	require.NoError(t, err)
+	groups := c.Groups()
+	require.Len(t, groups, 1)
+	require.True(t, groups[0].IP.Equal(group.IP))
+	require.True(t, groups[0].AllInterfaces)
+	require.NotEmpty(t, groups[0].Interfaces)
+	require.Equal(t, 3, groups[0].HopLimit)
+
+	c.SetScopeHopLimit(ScopeGlobal, 5)
+	require.Equal(t, 3, c.groups.hopLimit(group.IP, 2))
+	require.Equal(t, 5, c.groups.hopLimit(net.ParseIP("224.0.1.188"), 2))
+	require.Equal(t, 2, c.groups.hopLimit(net.ParseIP("224.0.0.251"), 2))
+
+	// refreshing keeps the group on the present interfaces
+	err = c.RefreshGroups()
+	require.NoError(t, err)
+	require.Equal(t, len(groups[0].Interfaces), len(c.Groups()[0].Interfaces))
+
+	err = c.LeaveGroupAll(group)
+	require.NoError(t, err)
+	require.Empty(t, c.Groups())
+
+	err = c.JoinGroup(nil, &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.Error(t, err)
+}
@@ -8,7 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
-	dtls "github.com/pion/dtls/v2"
+	dtls "github.com/pion/dtls/v3"
 )
 
 type connData struct {
@@ -19,14 +19,18 @@ type connData struct {
 // DTLSListener is a DTLS listener that provides accept with context.
 type DTLSListener struct {
 	listener  net.Listener
+	dtlsCfg   *dtls.Config
+	handshake *handshakeStats
 	heartBeat time.Duration
 	wg        sync.WaitGroup
 	doneCh    chan struct{}
 	connCh    chan connData
 	onTimeout func() error
 
-	cancel context.CancelFunc
-	mutex  sync.Mutex
+	handshakeTimeout time.Duration
+	ctx              context.Context
+	cancel           context.CancelFunc
+	mutex            sync.Mutex
 
 	closed   uint32
 	deadline atomic.Value
@@ -35,7 +39,7 @@ type DTLSListener struct {
 func (l *DTLSListener) acceptLoop() {
 	defer l.wg.Done()
 	for {
-		conn, err := l.listener.Accept()
+		conn, err := l.accept()
 		if err != nil {
 			select {
 			case <-l.doneCh:
@@ -52,13 +56,50 @@ func (l *DTLSListener) acceptLoop() {
 	}
 }
 
+// accept waits for the first message of a new peer and performs the handshake.
+func (l *DTLSListener) accept() (net.Conn, error) {
+	conn, err := l.listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	dtlsConn, ok := conn.(*dtls.Conn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected connection type %T", conn)
+	}
+	ctx, cancel := context.WithTimeout(l.ctx, l.handshakeTimeout)
+	defer cancel()
+	start := time.Now()
+	err = dtlsConn.HandshakeContext(ctx)
+	h := Handshake{
+		RemoteAddr: conn.RemoteAddr(),
+		Start:      start,
+		Duration:   time.Since(start),
+		Err:        err,
+	}
+	if err != nil {
+		h.Failure = handshakeFailure(err)
+	}
+	l.handshake.add(h)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return dtlsConn, nil
+}
+
 var defaultDTLSListenerOptions = dtlsListenerOptions{
-	heartBeat: time.Millisecond * 200,
+	heartBeat:        time.Millisecond * 200,
+	handshakeTimeout: time.Second * 30,
 }
 
 type dtlsListenerOptions struct {
-	heartBeat time.Duration
-	onTimeout func() error
+	heartBeat        time.Duration
+	onTimeout        func() error
+	onHandshake      HandshakeFunc
+	handshakeTimeout time.Duration
+
+	connectionIDGenerator func() []byte
 }
 
 // A DTLSListenerOption sets options such as heartBeat parameters, etc.
@@ -73,34 +114,28 @@ func NewDTLSListener(network string, addr string, dtlsCfg *dtls.Config, opts ...
 	for _, o := range opts {
 		o.applyDTLSListener(&cfg)
 	}
+	if cfg.connectionIDGenerator != nil {
+		c := *dtlsCfg
+		c.ConnectionIDGenerator = cfg.connectionIDGenerator
+		dtlsCfg = &c
+	}
 
 	a, err := net.ResolveUDPAddr(network, addr)
 	if err != nil {
 		return nil, fmt.Errorf("cannot resolve address: %w", err)
 	}
 	l := DTLSListener{
-		heartBeat: cfg.heartBeat,
-		connCh:    make(chan connData),
-		doneCh:    make(chan struct{}),
-	}
-
-	connectContextMaker := dtlsCfg.ConnectContextMaker
-	if connectContextMaker == nil {
-		connectContextMaker = func() (context.Context, func()) {
-			return context.WithTimeout(context.Background(), 30*time.Second)
-		}
-	}
-	dtlsCfg.ConnectContextMaker = func() (context.Context, func()) {
-		ctx, cancel := connectContextMaker()
-		l.mutex.Lock()
-		defer l.mutex.Unlock()
-		if l.closed > 0 {
-			cancel()
-		}
-		l.cancel = cancel
-		return ctx, cancel
+		heartBeat:        cfg.heartBeat,
+		handshakeTimeout: cfg.handshakeTimeout,
+		connCh:           make(chan connData),
+		doneCh:           make(chan struct{}),
+		dtlsCfg:          dtlsCfg,
+		handshake:        newHandshakeStats(cfg.onHandshake),
 	}
+	l.ctx, l.cancel = context.WithCancel(context.Background())
 
+	// handshakes are performed by the listener, so they can be measured. When connection IDs (RFC 9146) are
+	// negotiated, datagrams are routed by them, so the peer may change its address.
 	listener, err := dtls.Listen(network, a, dtlsCfg)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create new dtls listener: %w", err)
@@ -187,10 +222,9 @@ func (l *DTLSListener) close() (bool, error) {
 		return false, nil
 	}
 	close(l.doneCh)
+	// pending handshake is canceled
+	l.cancel()
 	err := l.listener.Close()
-	if l.cancel != nil {
-		l.cancel()
-	}
 	return true, err
 }
 
@@ -203,6 +237,12 @@ func (l *DTLSListener) Close() error {
 	return err
 }
 
+// HandshakeStats returns statistics of handshakes accepted by the listener. Abbreviated handshakes are not
+// supported by DTLS, so all successful handshakes are full.
+func (l *DTLSListener) HandshakeStats() HandshakeStats {
+	return l.handshake.get()
+}
+
 // Addr represents a network end point address.
 func (l *DTLSListener) Addr() net.Addr {
 	return l.listener.Addr()
@@ -3,3 +3,10 @@ package net
 import "errors"
 
 var ErrListenerIsClosed = errors.New("listen socket was closed")
+
+// ErrReadIdleTimeout is returned when nothing was read from the connection within the read idle timeout.
+var ErrReadIdleTimeout = errors.New("read idle timeout")
+
+// ErrWriteIdleTimeout is returned when nothing was written to the connection within the write idle timeout,
+// e.g. the peer stopped reading.
+var ErrWriteIdleTimeout = errors.New("write idle timeout")
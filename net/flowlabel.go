@@ -0,0 +1,52 @@
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"net"
+
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+)
+
+// maxFlowLabel bounds labels to the range of the flow label manager, 0x80000-0xFFFFF is reserved for stateless
+// labels when net.ipv6.flowlabel_state_ranges of Linux is enabled.
+const maxFlowLabel = 0x7ffff
+
+// errFlowLabelUnavailable is returned when the datagram can't be labeled, so it is written without the label.
+var errFlowLabelUnavailable = errors.New("flow label is unavailable")
+
+// FlowLabelFunc returns IPv6 flow label of a datagram written to raddr with context ctx, e.g. context of
+// the message. Zero leaves the label of the datagram unset.
+type FlowLabelFunc func(ctx context.Context, raddr *net.UDPAddr) uint32
+
+// FlowLabelPerPeer labels all datagrams to a peer by the same label derived from its address.
+func FlowLabelPerPeer(_ context.Context, raddr *net.UDPAddr) uint32 {
+	return flowLabel(raddr, 0)
+}
+
+// FlowLabelPerExchange labels datagrams of an exchange, e.g. blocks of a blockwise transfer, by the same label
+// derived from the address of the peer and ID of the exchange in ctx, see trace.ExchangeIDFromContext. Datagrams
+// without the exchange are labeled per peer.
+func FlowLabelPerExchange(ctx context.Context, raddr *net.UDPAddr) uint32 {
+	var id trace.ExchangeID
+	if ctx != nil {
+		id, _ = trace.ExchangeIDFromContext(ctx)
+	}
+	return flowLabel(raddr, uint64(id))
+}
+
+func flowLabel(raddr *net.UDPAddr, id uint64) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write(raddr.IP.To16())
+	var b [10]byte
+	binary.BigEndian.PutUint16(b[:2], uint16(raddr.Port))
+	binary.BigEndian.PutUint64(b[2:], id)
+	_, _ = h.Write(b[:])
+	label := h.Sum32() & maxFlowLabel
+	if label == 0 {
+		return 1
+	}
+	return label
+}
@@ -0,0 +1,160 @@
+//go:build linux && !tinygo
+
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Flow label socket options of Linux, see linux/in6.h.
+const (
+	ipv6FlowLabelMgr = 32
+	ipv6FlowInfoSend = 33
+
+	ipv6FlActionGet  = 0
+	ipv6FlActionPut  = 1
+	ipv6FlFlagCreate = 1
+	ipv6FlShareAny   = 255
+
+	// maxFlowLeases bounds labels leased by a socket, the oldest lease is released for a new one.
+	maxFlowLeases = 32
+)
+
+type flowLease struct {
+	label uint32
+	dst   [16]byte
+}
+
+// flowLabels leases labels of the connection from the flow label manager, which rejects datagrams with labels
+// which weren't leased for their destinations.
+type flowLabels struct {
+	mutex     sync.Mutex
+	enabled   bool
+	errEnable error
+	leases    map[flowLease]error
+	order     []flowLease
+}
+
+func (l *flowLabels) write(c *UDPConn, raddr *net.UDPAddr, label uint32, buffer []byte) (int, error) {
+	var lease flowLease
+	copy(lease.dst[:], raddr.IP.To16())
+	lease.label = label
+	rawConn, err := c.connection.SyscallConn()
+	if err != nil {
+		return 0, errFlowLabelUnavailable
+	}
+	if err := l.lease(c, rawConn, lease); err != nil {
+		return 0, errFlowLabelUnavailable
+	}
+	var zone uint32
+	if raddr.Zone != "" {
+		if iface, err := net.InterfaceByName(raddr.Zone); err == nil {
+			zone = uint32(iface.Index)
+		}
+	}
+	sa := unix.RawSockaddrInet6{
+		Family:   unix.AF_INET6,
+		Addr:     lease.dst,
+		Scope_id: zone,
+	}
+	binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&sa.Port))[:], uint16(raddr.Port))
+	binary.BigEndian.PutUint32((*[4]byte)(unsafe.Pointer(&sa.Flowinfo))[:], label)
+	var n int
+	var errno unix.Errno
+	err = rawConn.Write(func(fd uintptr) bool {
+		var p unsafe.Pointer
+		if len(buffer) > 0 {
+			p = unsafe.Pointer(&buffer[0])
+		}
+		r, _, e := unix.Syscall6(unix.SYS_SENDTO, fd, uintptr(p), uintptr(len(buffer)), 0, uintptr(unsafe.Pointer(&sa)), unix.SizeofSockaddrInet6)
+		n, errno = int(r), e
+		return errno != unix.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, &net.OpError{Op: "write", Net: "udp", Source: c.connection.LocalAddr(), Addr: raddr, Err: errno}
+	}
+	return n, nil
+}
+
+// lease enables labels of the socket and leases the label for the destination. The result is cached, so
+// a label which can't be leased, e.g. because it is leased by another socket for another destination, is
+// reported to the errors handler once.
+func (l *flowLabels) lease(c *UDPConn, rawConn syscall.RawConn, lease flowLease) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.enabled {
+		l.enabled = true
+		l.errEnable = control(rawConn, func(fd int) error {
+			return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, ipv6FlowInfoSend, 1)
+		})
+		if l.errEnable != nil {
+			l.errEnable = fmt.Errorf("cannot enable flow labels: %w", l.errEnable)
+			if c.errors != nil {
+				c.errors(l.errEnable)
+			}
+		}
+	}
+	if l.errEnable != nil {
+		return l.errEnable
+	}
+	if err, ok := l.leases[lease]; ok {
+		return err
+	}
+	if l.leases == nil {
+		l.leases = make(map[flowLease]error)
+	}
+	if len(l.order) >= maxFlowLeases {
+		oldest := l.order[0]
+		l.order = l.order[1:]
+		if l.leases[oldest] == nil {
+			_ = control(rawConn, func(fd int) error {
+				return setFlowLabelMgr(fd, oldest, ipv6FlActionPut, 0)
+			})
+		}
+		delete(l.leases, oldest)
+	}
+	err := control(rawConn, func(fd int) error {
+		return setFlowLabelMgr(fd, lease, ipv6FlActionGet, ipv6FlFlagCreate)
+	})
+	if err != nil {
+		err = fmt.Errorf("cannot lease flow label %#x for %v: %w", lease.label, net.IP(lease.dst[:]), err)
+		if c.errors != nil {
+			c.errors(err)
+		}
+	}
+	l.leases[lease] = err
+	l.order = append(l.order, lease)
+	return err
+}
+
+// setFlowLabelMgr sets struct in6_flowlabel_req of the lease.
+func setFlowLabelMgr(fd int, lease flowLease, action uint8, flags uint16) error {
+	var req [32]byte
+	copy(req[:16], lease.dst[:])
+	binary.BigEndian.PutUint32(req[16:20], lease.label)
+	req[20] = action
+	req[21] = ipv6FlShareAny
+	*(*uint16)(unsafe.Pointer(&req[22])) = flags
+	return unix.SetsockoptString(fd, unix.IPPROTO_IPV6, ipv6FlowLabelMgr, string(req[:]))
+}
+
+func control(rawConn syscall.RawConn, f func(fd int) error) error {
+	var err error
+	errControl := rawConn.Control(func(fd uintptr) {
+		err = f(int(fd))
+	})
+	if errControl != nil {
+		return errControl
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+//go:build linux && !tinygo
+
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// ipv6FlowInfo enables reception of the flow information of datagrams.
+const ipv6FlowInfo = 11
+
+func TestUDPConn_FlowLabel(t *testing.T) {
+	l, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 is unavailable: %v", err)
+	}
+	defer l.Close()
+	rawConn, err := l.SyscallConn()
+	require.NoError(t, err)
+	err = control(rawConn, func(fd int) error {
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, ipv6FlowInfo, 1)
+	})
+	require.NoError(t, err)
+
+	s, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	require.NoError(t, err)
+	c := NewUDPConn("udp6", s, WithFlowLabel(FlowLabelPerExchange), WithErrors(func(err error) { t.Log(err) }))
+	defer c.Close()
+
+	readLabel := func() uint32 {
+		buf := make([]byte, 64)
+		oob := make([]byte, 128)
+		err := l.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		_, oobn, _, _, err := l.ReadMsgUDP(buf, oob)
+		require.NoError(t, err)
+		msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+		require.NoError(t, err)
+		for _, m := range msgs {
+			if m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == ipv6FlowInfo {
+				return binary.BigEndian.Uint32(m.Data) & 0xfffff
+			}
+		}
+		return 0
+	}
+	raddr := l.LocalAddr().(*net.UDPAddr)
+	write := func(ctx context.Context) uint32 {
+		err := c.WriteWithContext(ctx, raddr, []byte("block"))
+		require.NoError(t, err)
+		return readLabel()
+	}
+
+	first := trace.WithExchangeID(context.Background(), trace.NewExchangeID())
+	label := write(first)
+	require.Equal(t, FlowLabelPerExchange(first, raddr), label)
+	// datagrams of the exchange share the label
+	require.Equal(t, label, write(first))
+	second := trace.WithExchangeID(context.Background(), trace.NewExchangeID())
+	require.Equal(t, FlowLabelPerExchange(second, raddr), write(second))
+	require.NotEqual(t, label, FlowLabelPerExchange(second, raddr))
+}
@@ -0,0 +1,12 @@
+//go:build !linux || tinygo
+
+package net
+
+import "net"
+
+// flowLabels labels datagrams only on Linux.
+type flowLabels struct{}
+
+func (l *flowLabels) write(*UDPConn, *net.UDPAddr, uint32, []byte) (int, error) {
+	return 0, errFlowLabelUnavailable
+}
@@ -0,0 +1,6 @@
+// Package handoff passes listening sockets of CoAP servers across process restarts without downtime. The sockets
+// are inherited from systemd socket activation (sd_listen_fds) or from the previous process, which starts
+// the new one by Upgrade and drains its servers by their graceful shutdown once the new process is Ready.
+// Sockets which aren't inherited are created, optionally with SO_REUSEPORT so the new process may bind them
+// while the old one still serves. It is supported on Unix systems.
+package handoff
@@ -0,0 +1,535 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package handoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Environment of systemd socket activation, which is used by Upgrade as well.
+const (
+	envListenPID     = "LISTEN_PID"
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+	// envReadyFD is descriptor of the pipe to the previous process, which waits for Ready.
+	envReadyFD = "COAP_HANDOFF_READY_FD"
+	// envNotifySocket is socket of the systemd service manager, which waits for Ready.
+	envNotifySocket = "NOTIFY_SOCKET"
+)
+
+// listenFDsStart is the first descriptor of the passed sockets.
+const listenFDsStart = 3
+
+// ErrNotReady is returned by Upgrade when the new process exits before it is ready.
+var ErrNotReady = errors.New("new process exited before it was ready")
+
+type inherited struct {
+	name     string
+	listener *net.TCPListener
+	conn     *net.UDPConn
+}
+
+// Listeners are sockets of the servers, which are inherited by the process or created by it.
+//
+// Multiple goroutines may invoke methods on Listeners simultaneously.
+type Listeners struct {
+	opts    options
+	readyFD int
+
+	mutex     sync.Mutex
+	inherited []inherited
+	// active are sockets returned by UDP and TCP, they are passed to the new process by Upgrade.
+	active []inherited
+	ready  bool
+}
+
+// Inherited returns sockets passed to the process by systemd socket activation or by Upgrade of the previous
+// process. When there are none, sockets are created by UDP and TCP. The environment of socket activation
+// is removed, so child processes don't inherit it.
+func Inherited(opt ...Option) (*Listeners, error) {
+	l := &Listeners{
+		readyFD: -1,
+	}
+	for _, o := range opt {
+		o.apply(&l.opts)
+	}
+	if v := os.Getenv(envReadyFD); v != "" {
+		fd, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %w", envReadyFD, err)
+		}
+		syscall.CloseOnExec(fd)
+		l.readyFD = fd
+	}
+	files, err := listenFiles()
+	for _, k := range []string{envListenPID, envListenFDs, envListenFDNames, envReadyFD} {
+		os.Unsetenv(k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		in, err := fileSocket(f)
+		f.Close()
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.inherited = append(l.inherited, in)
+	}
+	return l, nil
+}
+
+// listenFiles returns the passed sockets (sd_listen_fds). LISTEN_PID is checked only when it is set, because
+// Upgrade doesn't know PID of the new process before it starts.
+func listenFiles() ([]*os.File, error) {
+	v := os.Getenv(envListenFDs)
+	if v == "" {
+		return nil, nil
+	}
+	if pid := os.Getenv(envListenPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid %v: %v", envListenFDs, v)
+	}
+	var names []string
+	if v := os.Getenv(envListenFDNames); v != "" {
+		names = strings.Split(v, ":")
+	}
+	files := make([]*os.File, 0, n)
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) {
+			name = unescapeName(names[i])
+		}
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+	return files, nil
+}
+
+// unescapeName decodes the name escaped by Upgrade, because LISTEN_FDNAMES is separated by colons
+// of the addresses. Names set by systemd are returned unchanged.
+func unescapeName(name string) string {
+	v, err := url.QueryUnescape(name)
+	if err != nil {
+		return name
+	}
+	return v
+}
+
+func fileSocket(f *os.File) (inherited, error) {
+	in := inherited{name: f.Name()}
+	soType, err := syscall.GetsockoptInt(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return in, fmt.Errorf("cannot inherit socket %v: %w", in.name, err)
+	}
+	switch soType {
+	case syscall.SOCK_STREAM:
+		l, err := net.FileListener(f)
+		if err != nil {
+			return in, fmt.Errorf("cannot inherit socket %v: %w", in.name, err)
+		}
+		tcp, ok := l.(*net.TCPListener)
+		if !ok {
+			l.Close()
+			return in, fmt.Errorf("cannot inherit socket %v: unsupported listener %T", in.name, l)
+		}
+		in.listener = tcp
+	case syscall.SOCK_DGRAM:
+		c, err := net.FilePacketConn(f)
+		if err != nil {
+			return in, fmt.Errorf("cannot inherit socket %v: %w", in.name, err)
+		}
+		udp, ok := c.(*net.UDPConn)
+		if !ok {
+			c.Close()
+			return in, fmt.Errorf("cannot inherit socket %v: unsupported connection %T", in.name, c)
+		}
+		in.conn = udp
+	default:
+		return in, fmt.Errorf("cannot inherit socket %v: unsupported type %v", in.name, soType)
+	}
+	return in, nil
+}
+
+func (in inherited) addr() net.Addr {
+	if in.listener != nil {
+		return in.listener.Addr()
+	}
+	return in.conn.LocalAddr()
+}
+
+func (in inherited) file() (*os.File, error) {
+	if in.listener != nil {
+		return in.listener.File()
+	}
+	return in.conn.File()
+}
+
+func (in inherited) close() error {
+	if in.listener != nil {
+		return in.listener.Close()
+	}
+	return in.conn.Close()
+}
+
+// take removes the inherited socket with the name or the address, it returns false when there is none.
+func (l *Listeners) take(addr net.Addr, name string) (inherited, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, in := range l.inherited {
+		if in.name == name || sameAddr(in.addr(), addr) {
+			l.inherited = append(l.inherited[:i], l.inherited[i+1:]...)
+			return in, true
+		}
+	}
+	return inherited{}, false
+}
+
+func sameAddr(a, b net.Addr) bool {
+	if a.Network() != b.Network() {
+		return false
+	}
+	switch a := a.(type) {
+	case *net.UDPAddr:
+		b := b.(*net.UDPAddr)
+		return a.Port == b.Port && a.IP.Equal(b.IP)
+	case *net.TCPAddr:
+		b := b.(*net.TCPAddr)
+		return a.Port == b.Port && a.IP.Equal(b.IP)
+	}
+	return false
+}
+
+func (l *Listeners) activate(in inherited) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.active = append(l.active, in)
+}
+
+func (l *Listeners) listenConfig() net.ListenConfig {
+	if !l.opts.reusePort {
+		return net.ListenConfig{}
+	}
+	return net.ListenConfig{Control: reusePort}
+}
+
+// UDP returns the inherited UDP socket bound to the address or named by LISTEN_FDNAMES as the address,
+// otherwise it creates one. The socket is served by udp.Server after it is wrapped by coapNet.NewUDPConn.
+func (l *Listeners) UDP(network, addr string) (*net.UDPConn, error) {
+	a, err := net.ResolveUDPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if in, ok := l.take(a, addr); ok && in.conn != nil {
+		l.activate(in)
+		return in.conn, nil
+	} else if ok {
+		in.close()
+		return nil, fmt.Errorf("inherited socket %v isn't UDP", in.name)
+	}
+	lc := l.listenConfig()
+	c, err := lc.ListenPacket(context.Background(), network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.(*net.UDPConn)
+	l.activate(inherited{name: addr, conn: conn})
+	return conn, nil
+}
+
+// TCP returns the inherited TCP listener bound to the address or named by LISTEN_FDNAMES as the address,
+// otherwise it creates one. The listener is served by tcp.Server after it is wrapped by coapNet.NewTCPListenerFrom.
+func (l *Listeners) TCP(network, addr string) (*net.TCPListener, error) {
+	a, err := net.ResolveTCPAddr(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if in, ok := l.take(a, addr); ok && in.listener != nil {
+		l.activate(in)
+		return in.listener, nil
+	} else if ok {
+		in.close()
+		return nil, fmt.Errorf("inherited socket %v isn't TCP", in.name)
+	}
+	lc := l.listenConfig()
+	ln, err := lc.Listen(context.Background(), network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp := ln.(*net.TCPListener)
+	l.activate(inherited{name: addr, listener: tcp})
+	return tcp, nil
+}
+
+// Close closes inherited sockets which weren't returned by UDP or TCP.
+func (l *Listeners) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var errs []string
+	for _, in := range l.inherited {
+		if err := in.close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	l.inherited = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot close inherited sockets: %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Ready signals that the servers are serving the sockets: the previous process, which called Upgrade, starts
+// to drain its servers, and systemd with Type=notify is notified by READY=1.
+func (l *Listeners) Ready() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.ready {
+		return nil
+	}
+	l.ready = true
+	if l.readyFD >= 0 {
+		f := os.NewFile(uintptr(l.readyFD), "ready")
+		_, err := f.Write([]byte{1})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("cannot signal readiness to previous process: %w", err)
+		}
+	}
+	if sock := os.Getenv(envNotifySocket); sock != "" {
+		c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sock, Net: "unixgram"})
+		if err != nil {
+			return fmt.Errorf("cannot signal readiness to service manager: %w", err)
+		}
+		defer c.Close()
+		if _, err := c.Write([]byte("READY=1")); err != nil {
+			return fmt.Errorf("cannot signal readiness to service manager: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *Listeners) newCommand() (*exec.Cmd, error) {
+	if l.opts.newCommand != nil {
+		return l.opts.newCommand(), nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+// Upgrade starts the new process with the sockets returned by UDP and TCP and waits until it calls Ready.
+// Then the shutdown functions, e.g. Shutdown of the servers, are called with ctx, so the servers stop reading
+// and finish requests in progress while the new process already serves the sockets. When the new process exits
+// or ctx is done before it is ready, the error is returned and the servers of this process go on.
+func (l *Listeners) Upgrade(ctx context.Context, shutdown ...func(context.Context) error) error {
+	cmd, err := l.newCommand()
+	if err != nil {
+		return fmt.Errorf("cannot create new process: %w", err)
+	}
+	l.mutex.Lock()
+	names := make([]string, 0, len(l.active))
+	files := make([]*os.File, 0, len(l.active)+1)
+	for _, in := range l.active {
+		f, err := in.file()
+		if err != nil {
+			l.mutex.Unlock()
+			closeFiles(files)
+			return fmt.Errorf("cannot pass socket %v: %w", in.name, err)
+		}
+		names = append(names, url.QueryEscape(in.name))
+		files = append(files, f)
+	}
+	l.mutex.Unlock()
+	defer closeFiles(files)
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("cannot create pipe for readiness: %w", err)
+	}
+	defer readyR.Close()
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		envListenFDs+"="+strconv.Itoa(len(files)),
+		envListenFDNames+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+	err = startProcess(cmd, append(files, readyW))
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("cannot start new process: %w", err)
+	}
+	ready := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := readyR.Read(b[:])
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			// the pipe is closed without readiness
+			cmd.Process.Wait()
+			return ErrNotReady
+		}
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+		return ctx.Err()
+	}
+	// the process is reaped when it exits before this one
+	go cmd.Process.Wait()
+
+	var errs []string
+	for _, s := range shutdown {
+		if err := s(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot shutdown servers: %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// startProcess starts the command with the extra files, it sets Process of the command. Unlike Start of the command,
+// it passes descriptors of the sockets without Fd of os.File, which switches them to blocking mode. The mode
+// is shared with the sockets served by this process, so their reads would ignore deadlines.
+func startProcess(cmd *exec.Cmd, extraFiles []*os.File) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	path, err := exec.LookPath(cmd.Path)
+	if err != nil {
+		return err
+	}
+	in, err := inputFile(cmd.Stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := outputFile(cmd.Stdout)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	errOut, err := outputFile(cmd.Stderr)
+	if err != nil {
+		return err
+	}
+	defer errOut.Close()
+	fds := make([]uintptr, 0, 3+len(extraFiles))
+	for _, f := range append([]*os.File{in, out, errOut}, extraFiles...) {
+		fd, err := rawFD(f)
+		if err != nil {
+			return err
+		}
+		fds = append(fds, fd)
+	}
+	pid, err := syscall.ForkExec(path, cmd.Args, &syscall.ProcAttr{
+		Dir:   cmd.Dir,
+		Env:   cmd.Env,
+		Files: fds,
+		Sys:   cmd.SysProcAttr,
+	})
+	if err != nil {
+		return err
+	}
+	cmd.Process, err = os.FindProcess(pid)
+	return err
+}
+
+// inputFile returns file of the standard input of the command: /dev/null for nil or a pipe copied from the reader.
+// The file is closed after the start.
+func inputFile(r io.Reader) (*os.File, error) {
+	if f, ok := r.(*os.File); ok {
+		return dup(f)
+	}
+	if r == nil {
+		return os.Open(os.DevNull)
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer pw.Close()
+		_, _ = io.Copy(pw, r)
+	}()
+	return pr, nil
+}
+
+// outputFile returns file of the standard output or error of the command: /dev/null for nil or a pipe copied
+// to the writer. The file is closed after the start.
+func outputFile(w io.Writer) (*os.File, error) {
+	if f, ok := w.(*os.File); ok {
+		return dup(f)
+	}
+	if w == nil {
+		return os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer pr.Close()
+		_, _ = io.Copy(w, pr)
+	}()
+	return pw, nil
+}
+
+// dup duplicates the file, so it can be closed after the start like the other files.
+func dup(f *os.File) (*os.File, error) {
+	fd, err := rawFD(f)
+	if err != nil {
+		return nil, err
+	}
+	d, err := syscall.Dup(int(fd))
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(d)
+	return os.NewFile(uintptr(d), f.Name()), nil
+}
+
+// rawFD returns descriptor of the file without changing its mode, unlike Fd.
+func rawFD(f *os.File) (uintptr, error) {
+	c, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd uintptr
+	err = c.Control(func(d uintptr) {
+		fd = d
+	})
+	return fd, err
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
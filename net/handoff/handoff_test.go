@@ -0,0 +1,194 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package handoff_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/handoff"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+const helperEnv = "COAP_HANDOFF_HELPER"
+
+func newServer(body string, opt ...udp.ServerOption) *udp.Server {
+	return udp.NewServer(append([]udp.ServerOption{udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(body)))
+	})}, opt...)...)
+}
+
+// newOldServer returns the server of the process which calls Upgrade and channel of acknowledged responses.
+func newOldServer() (*udp.Server, <-chan struct{}) {
+	acked := make(chan struct{}, 1)
+	s := newServer("old", udp.WithOnExchange(func(*client.ClientConn, client.Exchange) {
+		select {
+		case acked <- struct{}{}:
+		default:
+		}
+	}))
+	return s, acked
+}
+
+// TestHelperProcess is the new process started by Upgrade.
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv(helperEnv) {
+	case "serve":
+	case "exit":
+		os.Exit(0)
+	default:
+		t.Skip("helper process")
+	}
+	l, err := handoff.Inherited()
+	require.NoError(t, err)
+	c, err := l.UDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := newServer("new")
+	go s.Serve(coapNet.NewUDPConn("udp4", c))
+	require.NoError(t, l.Ready())
+	// the test kills the process
+	time.Sleep(time.Second * 10)
+	os.Exit(0)
+}
+
+// get returns body of the resource. When acked isn't nil, the connection is closed after the server reports
+// the acknowledgement of the separate response: the acknowledgement is sent after Get returns, and when it's lost,
+// Shutdown of the server waits for retransmissions of the response.
+func get(t *testing.T, addr string, acked <-chan struct{}) string {
+	cc, err := udp.Dial(addr)
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	body, err := io.ReadAll(resp.Body())
+	require.NoError(t, err)
+	if acked != nil {
+		select {
+		case <-acked:
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "response isn't acknowledged")
+		}
+	}
+	return string(body)
+}
+
+func TestListeners_Upgrade(t *testing.T) {
+	var child *exec.Cmd
+	l, err := handoff.Inherited(handoff.WithCommand(func() *exec.Cmd {
+		child = exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		child.Env = append(os.Environ(), helperEnv+"=serve")
+		child.Stderr = os.Stderr
+		return child
+	}))
+	require.NoError(t, err)
+	c, err := l.UDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := c.LocalAddr().String()
+
+	s, acked := newOldServer()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(coapNet.NewUDPConn("udp4", c))
+		require.NoError(t, err)
+	}()
+	require.Equal(t, "old", get(t, addr, acked))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	err = l.Upgrade(ctx, s.Shutdown)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = child.Process.Kill()
+	})
+	// the socket is served by the new process after the old one stopped reading
+	wg.Wait()
+	require.Equal(t, "new", get(t, addr, nil))
+}
+
+func TestListeners_UpgradeWhileReading(t *testing.T) {
+	var child *exec.Cmd
+	l, err := handoff.Inherited(handoff.WithCommand(func() *exec.Cmd {
+		child = exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		child.Env = append(os.Environ(), helperEnv+"=serve")
+		child.Stderr = os.Stderr
+		return child
+	}))
+	require.NoError(t, err)
+	c, err := l.UDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s, acked := newOldServer()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(coapNet.NewUDPConn("udp4", c))
+	}()
+	require.Equal(t, "old", get(t, c.LocalAddr().String(), acked))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	// the old server is blocked in read of the socket while the new process starts
+	err = l.Upgrade(ctx, s.Shutdown)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = child.Process.Kill()
+	})
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "server doesn't stop reading after upgrade")
+	}
+}
+
+func TestListeners_UpgradeNotReady(t *testing.T) {
+	l, err := handoff.Inherited(handoff.WithCommand(func() *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		cmd.Env = append(os.Environ(), helperEnv+"=exit")
+		return cmd
+	}))
+	require.NoError(t, err)
+	c, err := l.TCP("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	var shutdown bool
+	err = l.Upgrade(ctx, func(context.Context) error {
+		shutdown = true
+		return nil
+	})
+	require.ErrorIs(t, err, handoff.ErrNotReady)
+	require.False(t, shutdown)
+}
+
+func TestListeners_ReusePort(t *testing.T) {
+	l, err := handoff.Inherited(handoff.WithReusePort())
+	require.NoError(t, err)
+	c, err := l.UDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer c.Close()
+	// the other process binds the same address
+	other, err := handoff.Inherited(handoff.WithReusePort())
+	require.NoError(t, err)
+	c2, err := other.UDP("udp4", c.LocalAddr().String())
+	require.NoError(t, err)
+	c2.Close()
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package handoff
+
+import (
+	"os/exec"
+)
+
+// An Option sets options such as SO_REUSEPORT, command of the new process, etc.
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	reusePort  bool
+	newCommand func() *exec.Cmd
+}
+
+// ReusePortOpt reuse port option.
+type ReusePortOpt struct {
+}
+
+func (o ReusePortOpt) apply(opts *options) {
+	opts.reusePort = true
+}
+
+// WithReusePort creates sockets which aren't inherited with SO_REUSEPORT, so the new process started
+// by other means than Upgrade, e.g. by a supervisor, binds the same addresses before the old one drains.
+func WithReusePort() ReusePortOpt {
+	return ReusePortOpt{}
+}
+
+// CommandOpt command option.
+type CommandOpt struct {
+	newCommand func() *exec.Cmd
+}
+
+func (o CommandOpt) apply(opts *options) {
+	opts.newCommand = o.newCommand
+}
+
+// WithCommand sets function which creates command of the new process started by Upgrade. The sockets and
+// the environment of the handoff are added to the command. By default it is the same executable with the same
+// arguments, environment and standard output and error.
+func WithCommand(newCommand func() *exec.Cmd) CommandOpt {
+	return CommandOpt{newCommand: newCommand}
+}
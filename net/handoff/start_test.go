@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package handoff
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func isNonblock(t *testing.T, c *net.UDPConn) bool {
+	raw, err := c.SyscallConn()
+	require.NoError(t, err)
+	var flags int
+	err = raw.Control(func(fd uintptr) {
+		flags, err = unix.FcntlInt(fd, unix.F_GETFL, 0)
+	})
+	require.NoError(t, err)
+	return flags&unix.O_NONBLOCK != 0
+}
+
+func TestStartProcess_KeepsNonblocking(t *testing.T) {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer c.Close()
+	f, err := c.File()
+	require.NoError(t, err)
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err = startProcess(cmd, []*os.File{f})
+	require.NoError(t, err)
+	// the mode is shared by the served socket, whose reads must keep honoring deadlines
+	require.True(t, isNonblock(t, c))
+	_, err = cmd.Process.Wait()
+	require.NoError(t, err)
+}
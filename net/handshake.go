@@ -0,0 +1,180 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// HandshakeFailure is cause of a failed TLS/DTLS handshake.
+type HandshakeFailure int
+
+const (
+	// HandshakeFailureOther is failure without more specific cause, e.g. an invalid message.
+	HandshakeFailureOther HandshakeFailure = iota
+	// HandshakeFailureTimeout means the handshake was not finished in time.
+	HandshakeFailureTimeout
+	// HandshakeFailureAlert means an alert was sent or received, e.g. for a bad certificate or PSK.
+	HandshakeFailureAlert
+	// HandshakeFailureClosed means the connection was closed by the peer or by the listener.
+	HandshakeFailureClosed
+)
+
+func (f HandshakeFailure) String() string {
+	switch f {
+	case HandshakeFailureTimeout:
+		return "timeout"
+	case HandshakeFailureAlert:
+		return "alert"
+	case HandshakeFailureClosed:
+		return "closed"
+	default:
+		return "other"
+	}
+}
+
+// Handshake is outcome of a TLS/DTLS handshake accepted by a listener.
+type Handshake struct {
+	// RemoteAddr is address of the peer.
+	RemoteAddr net.Addr
+	// Start is time when the first message of the handshake was received.
+	Start time.Time
+	// Duration is time from Start until the handshake was finished or failed.
+	Duration time.Duration
+	// Resumed signals abbreviated handshake, which resumed a previous session.
+	Resumed bool
+	// Err is error of the failed handshake, it is nil on success.
+	Err error
+	// Failure is cause of the failed handshake.
+	Failure HandshakeFailure
+}
+
+// HandshakeFunc is called with the outcome of every handshake.
+type HandshakeFunc = func(h Handshake)
+
+// HandshakeStats summarizes handshakes accepted by a listener.
+type HandshakeStats struct {
+	// Full is number of successful full handshakes.
+	Full uint64
+	// Resumed is number of successful abbreviated handshakes.
+	Resumed uint64
+	// Failed is number of failed handshakes.
+	Failed uint64
+	// Failures is number of failed handshakes by cause.
+	Failures map[HandshakeFailure]uint64
+	// FullDuration is total duration of successful full handshakes.
+	FullDuration time.Duration
+	// ResumedDuration is total duration of successful abbreviated handshakes.
+	ResumedDuration time.Duration
+}
+
+type handshakeStats struct {
+	mutex       sync.Mutex
+	stats       HandshakeStats
+	onHandshake HandshakeFunc
+}
+
+func newHandshakeStats(onHandshake HandshakeFunc) *handshakeStats {
+	return &handshakeStats{
+		stats: HandshakeStats{
+			Failures: make(map[HandshakeFailure]uint64),
+		},
+		onHandshake: onHandshake,
+	}
+}
+
+func (s *handshakeStats) add(h Handshake) {
+	s.mutex.Lock()
+	switch {
+	case h.Err != nil:
+		s.stats.Failed++
+		s.stats.Failures[h.Failure]++
+	case h.Resumed:
+		s.stats.Resumed++
+		s.stats.ResumedDuration += h.Duration
+	default:
+		s.stats.Full++
+		s.stats.FullDuration += h.Duration
+	}
+	s.mutex.Unlock()
+	if s.onHandshake != nil {
+		s.onHandshake(h)
+	}
+}
+
+func (s *handshakeStats) get() HandshakeStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := s.stats
+	stats.Failures = make(map[HandshakeFailure]uint64, len(s.stats.Failures))
+	for k, v := range s.stats.Failures {
+		stats.Failures[k] = v
+	}
+	return stats
+}
+
+// handshakeFailure classifies error of a failed handshake.
+func handshakeFailure(err error) HandshakeFailure {
+	var netErr net.Error
+	var alert interface{ IsFatalOrCloseNotify() bool }
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return HandshakeFailureTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return HandshakeFailureTimeout
+	case errors.As(err, &alert):
+		return HandshakeFailureAlert
+	case errors.Is(err, io.EOF), errors.Is(err, context.Canceled):
+		return HandshakeFailureClosed
+	}
+	return HandshakeFailureOther
+}
+
+type OnHandshakeOpt struct {
+	onHandshake HandshakeFunc
+}
+
+func (o OnHandshakeOpt) applyTLSListener(opts *tlsListenerOptions) {
+	opts.onHandshake = o.onHandshake
+}
+
+func (o OnHandshakeOpt) applyDTLSListener(opts *dtlsListenerOptions) {
+	opts.onHandshake = o.onHandshake
+}
+
+// WithOnHandshake sets function which is called with the outcome of every handshake accepted by the listener.
+func WithOnHandshake(onHandshake HandshakeFunc) OnHandshakeOpt {
+	return OnHandshakeOpt{onHandshake: onHandshake}
+}
+
+type HandshakeTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o HandshakeTimeoutOpt) applyDTLSListener(opts *dtlsListenerOptions) {
+	opts.handshakeTimeout = o.timeout
+}
+
+// WithHandshakeTimeout sets maximal duration of a handshake accepted by the DTLS listener, 30 seconds by default.
+func WithHandshakeTimeout(timeout time.Duration) HandshakeTimeoutOpt {
+	return HandshakeTimeoutOpt{timeout: timeout}
+}
+
+type ConnectionIDOpt struct {
+	generator func() []byte
+}
+
+func (o ConnectionIDOpt) applyDTLSListener(opts *dtlsListenerOptions) {
+	opts.connectionIDGenerator = o.generator
+}
+
+// WithConnectionID negotiates Connection ID (RFC 9146) generated by generator, e.g. dtls.RandomCIDGenerator(8), with
+// every peer of the DTLS listener. Datagrams are routed to connections by the connection ID instead of the
+// address, so a peer whose address changed, e.g. by NAT rebinding, keeps its connection. It overrides
+// ConnectionIDGenerator of the config.
+func WithConnectionID(generator func() []byte) ConnectionIDOpt {
+	return ConnectionIDOpt{generator: generator}
+}
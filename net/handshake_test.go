@@ -0,0 +1,146 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	piondtls "github.com/pion/dtls/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSListener_HandshakeStats(t *testing.T) {
+	handshakes := make(chan Handshake, 3)
+	listener, err := NewTLSListener("tcp", "127.0.0.1:", SetTLSConfig(t), WithHeartBeat(time.Millisecond*100), WithOnHandshake(func(h Handshake) {
+		handshakes <- h
+	}))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			c, err := listener.AcceptWithContext(ctx)
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, err := c.Write([]byte("hi"))
+				if err != nil {
+					return
+				}
+				b := make([]byte, 16)
+				for {
+					_, err := c.Read(b)
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	cert, err := tls.X509KeyPair(CertPEMBlock, KeyPEMBlock)
+	require.NoError(t, err)
+	clientCfg := &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{cert},
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+	for i := 0; i < 2; i++ {
+		c, err := tls.Dial("tcp", listener.Addr().String(), clientCfg)
+		require.NoError(t, err)
+		b := make([]byte, 2)
+		_, err = c.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, i == 1, c.ConnectionState().DidResume)
+		c.Close()
+	}
+	// the client rejects the server certificate by an alert
+	_, err = tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		ServerName: "unknown",
+		RootCAs:    x509.NewCertPool(),
+	})
+	require.Error(t, err)
+
+	var got []Handshake
+	for len(got) < 3 {
+		select {
+		case h := <-handshakes:
+			got = append(got, h)
+		case <-time.After(time.Second * 3):
+			require.FailNow(t, "handshake was not reported")
+		}
+	}
+	require.NoError(t, got[0].Err)
+	require.False(t, got[0].Resumed)
+	require.NoError(t, got[1].Err)
+	require.True(t, got[1].Resumed)
+	require.Error(t, got[2].Err)
+	require.Equal(t, HandshakeFailureAlert, got[2].Failure)
+
+	stats := listener.HandshakeStats()
+	require.Equal(t, uint64(1), stats.Full)
+	require.Equal(t, uint64(1), stats.Resumed)
+	require.Equal(t, uint64(1), stats.Failed)
+	require.Equal(t, map[HandshakeFailure]uint64{HandshakeFailureAlert: 1}, stats.Failures)
+	require.Equal(t, got[0].Duration, stats.FullDuration)
+	require.Equal(t, got[1].Duration, stats.ResumedDuration)
+}
+
+func TestDTLSListener_HandshakeStats(t *testing.T) {
+	newConfig := func(psk []byte) *piondtls.Config {
+		return &piondtls.Config{
+			PSK: func(hint []byte) ([]byte, error) {
+				return psk, nil
+			},
+			PSKIdentityHint: []byte("server"),
+			CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+		}
+	}
+	listener, err := NewDTLSListener("udp4", "127.0.0.1:", newConfig([]byte{1, 2, 3}), WithHeartBeat(time.Millisecond*100), WithHandshakeTimeout(time.Second))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			c, err := listener.AcceptWithContext(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			c.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.UDPAddr)
+	c, err := piondtls.Dial("udp4", addr, newConfig([]byte{1, 2, 3}))
+	require.NoError(t, err)
+	err = c.Handshake()
+	require.NoError(t, err)
+	c.Close()
+	c, err = piondtls.Dial("udp4", addr, newConfig([]byte{4, 5, 6}))
+	require.NoError(t, err)
+	hctx, hcancel := context.WithTimeout(ctx, time.Second)
+	defer hcancel()
+	err = c.HandshakeContext(hctx)
+	require.Error(t, err)
+	c.Close()
+
+	require.Eventually(t, func() bool {
+		return listener.HandshakeStats().Failed == 1
+	}, time.Second*3, time.Millisecond*10)
+	stats := listener.HandshakeStats()
+	require.Equal(t, uint64(1), stats.Full)
+	require.Equal(t, uint64(0), stats.Resumed)
+	require.NotZero(t, stats.FullDuration)
+}
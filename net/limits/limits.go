@@ -0,0 +1,263 @@
+// Package limits bounds resources which peers can hold on a server, so a gateway exposed to the internet survives
+// abusive or broken devices. Requests over a limit are rejected by 4.29 (Too Many Requests) with Max-Age as
+// the hint when to retry (RFC 8516).
+package limits
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// DefaultRetryAfter is default Max-Age of rejections by MaxSessions, MaxInFlight and MaxObservations.
+const DefaultRetryAfter = time.Second * 5
+
+// Limits bounds sessions, exchanges and observations of peers and rate of their messages. Zero value of a field
+// means no limit.
+type Limits struct {
+	// MaxSessions caps concurrent sessions of the server. Over the cap UDP requests of a new peer are rejected
+	// statelessly and new TCP and DTLS connections are closed.
+	MaxSessions int
+	// MaxInFlight caps requests of a peer processed concurrently.
+	MaxInFlight int
+	// MaxObservations caps observations registered by a peer.
+	MaxObservations int
+	// MessageRate is average number of messages per second accepted from a source IP address. UDP counts every
+	// datagram, TCP and DTLS count requests. Over the rate requests are rejected and other messages are dropped.
+	MessageRate float64
+	// MessageBurst is number of messages accepted at once from an idle source address, by default MessageRate
+	// rounded up.
+	MessageBurst int
+	// RetryAfter is Max-Age of rejections by MaxSessions, MaxInFlight and MaxObservations, by default
+	// DefaultRetryAfter.
+	RetryAfter time.Duration
+}
+
+// Bucket is token bucket limiting rate of messages of a source, it isn't safe for concurrent use. Rate and
+// burst are passed to its methods, so they can change while the bucket is used.
+type Bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// burstOf returns the burst, by default the rate rounded up.
+func burstOf(rate float64, burst int) float64 {
+	if burst <= 0 {
+		return math.Ceil(rate)
+	}
+	return float64(burst)
+}
+
+// NewBucket creates bucket filled to the burst.
+func NewBucket(now time.Time, rate float64, burst int) *Bucket {
+	return &Bucket{tokens: burstOf(rate, burst), last: now}
+}
+
+// Take refills the bucket by rate tokens per second up to the burst, by default the rate rounded up, and
+// consumes a token, otherwise it returns time until the next token.
+func (b *Bucket) Take(now time.Time, rate float64, burst int) (time.Duration, bool) {
+	b.tokens = math.Min(burstOf(rate, burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// full reports whether the bucket is refilled to the burst, so it is same as a new one.
+func (b *Bucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= burstOf(rate, burst)
+}
+
+// peer holds resources of a session.
+type peer struct {
+	inFlight     int
+	observations map[string]struct{}
+}
+
+// Limiter enforces Limits, it is safe for concurrent use. Sessions and peers are identified by the caller,
+// e.g. by the connection.
+type Limiter struct {
+	limits Limits
+
+	mutex    sync.Mutex
+	sessions int
+	buckets  map[string]*Bucket
+	// pruneAt is number of buckets when full ones are removed
+	pruneAt int
+	peers   map[interface{}]*peer
+}
+
+// minPruneAt is the least number of buckets when full ones are removed.
+const minPruneAt = 1024
+
+// NewLimiter creates limiter of the limits.
+func NewLimiter(limits Limits) *Limiter {
+	if limits.RetryAfter <= 0 {
+		limits.RetryAfter = DefaultRetryAfter
+	}
+	return &Limiter{
+		limits:  limits,
+		buckets: make(map[string]*Bucket),
+		pruneAt: minPruneAt,
+		peers:   make(map[interface{}]*peer),
+	}
+}
+
+// Limits returns limits of the limiter.
+func (l *Limiter) Limits() Limits {
+	return l.limits
+}
+
+// AcquireSession counts a new session, it returns false when MaxSessions is reached.
+func (l *Limiter) AcquireSession() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.limits.MaxSessions > 0 && l.sessions >= l.limits.MaxSessions {
+		return false
+	}
+	l.sessions++
+	return true
+}
+
+// ReleaseSession releases the session counted by AcquireSession.
+func (l *Limiter) ReleaseSession() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.sessions > 0 {
+		l.sessions--
+	}
+}
+
+// Allow consumes a token of the source address of the message, otherwise it returns time until the next token.
+func (l *Limiter) Allow(addr net.Addr) (time.Duration, bool) {
+	rate, burst := l.limits.MessageRate, l.limits.MessageBurst
+	if rate <= 0 {
+		return 0, true
+	}
+	key := sourceIP(addr)
+	now := time.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		l.pruneLocked(now, rate, burst)
+		b = NewBucket(now, rate, burst)
+		l.buckets[key] = b
+	}
+	return b.Take(now, rate, burst)
+}
+
+// pruneLocked removes buckets refilled to the burst, they are same as new ones. It runs when the number
+// of buckets doubles, so the cost is amortized.
+func (l *Limiter) pruneLocked(now time.Time, rate float64, burst int) {
+	if len(l.buckets) < l.pruneAt {
+		return
+	}
+	for key, b := range l.buckets {
+		if b.full(now, rate, burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruneAt = 2 * len(l.buckets)
+	if l.pruneAt < minPruneAt {
+		l.pruneAt = minPruneAt
+	}
+}
+
+func sourceIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func (l *Limiter) peerLocked(key interface{}) *peer {
+	p, ok := l.peers[key]
+	if !ok {
+		p = &peer{observations: make(map[string]struct{})}
+		l.peers[key] = p
+	}
+	return p
+}
+
+// AcquireRequest counts a request of the peer in progress, it returns false when MaxInFlight is reached.
+func (l *Limiter) AcquireRequest(key interface{}) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	p := l.peerLocked(key)
+	if l.limits.MaxInFlight > 0 && p.inFlight >= l.limits.MaxInFlight {
+		return false
+	}
+	p.inFlight++
+	return true
+}
+
+// ReleaseRequest releases the request counted by AcquireRequest.
+func (l *Limiter) ReleaseRequest(key interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if p, ok := l.peers[key]; ok && p.inFlight > 0 {
+		p.inFlight--
+	}
+}
+
+// Register counts the observation of the peer, it returns false when MaxObservations is reached.
+// A registration with the token of a registered observation replaces it.
+func (l *Limiter) Register(key interface{}, token message.Token) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	p := l.peerLocked(key)
+	if _, ok := p.observations[token.String()]; ok {
+		return true
+	}
+	if l.limits.MaxObservations > 0 && len(p.observations) >= l.limits.MaxObservations {
+		return false
+	}
+	p.observations[token.String()] = struct{}{}
+	return true
+}
+
+// Deregister releases the observation counted by Register.
+func (l *Limiter) Deregister(key interface{}, token message.Token) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if p, ok := l.peers[key]; ok {
+		delete(p.observations, token.String())
+	}
+}
+
+// Observations returns number of observations of the peer.
+func (l *Limiter) Observations(key interface{}) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if p, ok := l.peers[key]; ok {
+		return len(p.observations)
+	}
+	return 0
+}
+
+// RemovePeer releases requests and observations of the peer when its session is closed.
+func (l *Limiter) RemovePeer(key interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.peers, key)
+}
+
+// MaxAge returns Max-Age option of the rejection, the duration is rounded up to seconds.
+func MaxAge(retryAfter time.Duration) message.Option {
+	buf := make([]byte, 4)
+	n, _ := message.EncodeUint32(buf, uint32(math.Ceil(retryAfter.Seconds())))
+	return message.Option{ID: message.MaxAge, Value: buf[:n]}
+}
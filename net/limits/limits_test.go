@@ -0,0 +1,79 @@
+package limits_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	l := limits.NewLimiter(limits.Limits{
+		MaxSessions:     1,
+		MaxInFlight:     1,
+		MaxObservations: 1,
+		MessageRate:     1,
+		MessageBurst:    2,
+	})
+	require.Equal(t, limits.DefaultRetryAfter, l.Limits().RetryAfter)
+
+	require.True(t, l.AcquireSession())
+	require.False(t, l.AcquireSession())
+	l.ReleaseSession()
+	require.True(t, l.AcquireSession())
+
+	// the source address is the IP address, the port isn't relevant
+	for i := 0; i < 2; i++ {
+		_, ok := l.Allow(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683 + i})
+		require.True(t, ok)
+	}
+	wait, ok := l.Allow(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683})
+	require.False(t, ok)
+	require.Greater(t, wait, time.Duration(0))
+	require.LessOrEqual(t, wait, time.Second)
+	_, ok = l.Allow(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5683})
+	require.True(t, ok)
+
+	peer := "a"
+	require.True(t, l.AcquireRequest(peer))
+	require.False(t, l.AcquireRequest(peer))
+	require.True(t, l.AcquireRequest("b"))
+	l.ReleaseRequest(peer)
+	require.True(t, l.AcquireRequest(peer))
+
+	require.True(t, l.Register(peer, message.Token{1}))
+	// re-registration
+	require.True(t, l.Register(peer, message.Token{1}))
+	require.False(t, l.Register(peer, message.Token{2}))
+	require.Equal(t, 1, l.Observations(peer))
+	l.Deregister(peer, message.Token{1})
+	require.True(t, l.Register(peer, message.Token{2}))
+	l.RemovePeer(peer)
+	require.Equal(t, 0, l.Observations(peer))
+	require.True(t, l.AcquireRequest(peer))
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	// the burst is the rate rounded up by default
+	b := limits.NewBucket(now, 1.5, 0)
+	for i := 0; i < 2; i++ {
+		_, ok := b.Take(now, 1.5, 0)
+		require.True(t, ok)
+	}
+	wait, ok := b.Take(now, 1.5, 0)
+	require.False(t, ok)
+	require.InDelta(t, float64(time.Second*2/3), float64(wait), float64(time.Millisecond))
+	// the changed rate refills the bucket
+	_, ok = b.Take(now.Add(time.Second), 2, 0)
+	require.True(t, ok)
+}
+
+func TestMaxAge(t *testing.T) {
+	opt := limits.MaxAge(time.Millisecond * 1500)
+	require.Equal(t, message.MaxAge, opt.ID)
+	require.Equal(t, []byte{2}, opt.Value)
+}
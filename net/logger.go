@@ -0,0 +1,81 @@
+package net
+
+import (
+	"errors"
+	"net"
+
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+)
+
+// Logger is leveled logger with structured fields passed as alternating keys and values, e.g.
+// Info("session started", "remoteAddr", addr). It is satisfied by adapters of common loggers, e.g. of log/slog,
+// zap's SugaredLogger or logr. Multiple goroutines may invoke methods on a Logger simultaneously.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// ConnError is an error of a connection, connections of udp, dtls, tcp and ws report their errors wrapped in it.
+// Its message is the one of Err, RemoteAddr identifies the connection for loggers, e.g. LogErrors.
+type ConnError struct {
+	RemoteAddr net.Addr
+	Err        error
+}
+
+func (e *ConnError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// LogErrors returns function which reports errors by Error of the logger. The message is the error, which
+// describes what failed, and the connection of ConnError is logged as remoteAddr. It is used by WithLogger
+// of udp, dtls, tcp and ws instead of the function of WithErrors.
+func LogErrors(l Logger) func(err error) {
+	return func(err error) {
+		var connErr *ConnError
+		if errors.As(err, &connErr) {
+			l.Error(err.Error(), "remoteAddr", connErr.RemoteAddr)
+			return
+		}
+		l.Error(err.Error())
+	}
+}
+
+// LogTraceHandler returns trace handler which logs events of connections by l and then passes them to next,
+// which may be nil: opening and closing of sessions by Info, retransmissions, dropped duplicates, blockwise
+// steps and registrations and deregistrations of observations by Debug. Sent and received messages aren't
+// logged. It is used by WithLogger of udp, dtls, tcp and ws.
+func LogTraceHandler(l Logger, next trace.Handler) trace.Handler {
+	return func(e trace.Event) {
+		logEvent(l, e)
+		if next != nil {
+			next(e)
+		}
+	}
+}
+
+func logEvent(l Logger, e trace.Event) {
+	switch e.Type {
+	case trace.SessionStarted:
+		l.Info("session started", "remoteAddr", e.RemoteAddr)
+	case trace.SessionClosed:
+		l.Info("session closed", "remoteAddr", e.RemoteAddr)
+	case trace.Retransmit:
+		l.Debug("message retransmitted", "remoteAddr", e.RemoteAddr, "messageID", e.MessageID,
+			"token", e.Message.Token(), "retransmission", e.Retransmission, "elapsed", e.Elapsed)
+	case trace.DuplicateDropped:
+		l.Debug("duplicate dropped", "remoteAddr", e.RemoteAddr, "messageID", e.MessageID, "token", e.Message.Token())
+	case trace.BlockwiseStep:
+		l.Debug("blockwise step", "remoteAddr", e.RemoteAddr, "token", e.Message.Token(), "option", e.Block.Option,
+			"num", e.Block.Num, "more", e.Block.More, "szx", e.Block.SZX, "sent", e.Block.Sent)
+	case trace.ObservationRegistered:
+		l.Debug("observation registered", "remoteAddr", e.RemoteAddr, "token", e.Message.Token())
+	case trace.ObservationDeregistered:
+		l.Debug("observation deregistered", "remoteAddr", e.RemoteAddr, "token", e.Message.Token())
+	}
+}
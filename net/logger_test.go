@@ -0,0 +1,40 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type errorLog struct {
+	msg           string
+	keysAndValues []interface{}
+}
+
+func (l *errorLog) Debug(string, ...interface{}) {}
+func (l *errorLog) Info(string, ...interface{})  {}
+func (l *errorLog) Warn(string, ...interface{})  {}
+func (l *errorLog) Error(msg string, keysAndValues ...interface{}) {
+	l.msg = msg
+	l.keysAndValues = keysAndValues
+}
+
+func TestLogErrors(t *testing.T) {
+	var l errorLog
+	logErrors := LogErrors(&l)
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683}
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("udp: %w", &ConnError{RemoteAddr: addr, Err: fmt.Errorf("cannot write response: %w", cause)})
+	require.ErrorIs(t, err, cause)
+	logErrors(err)
+	require.Equal(t, "udp: cannot write response: connection refused", l.msg)
+	require.Equal(t, []interface{}{"remoteAddr", addr}, l.keysAndValues)
+
+	logErrors(errors.New("cannot accept connection"))
+	require.Equal(t, "cannot accept connection", l.msg)
+	require.Empty(t, l.keysAndValues)
+}
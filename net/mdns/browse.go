@@ -0,0 +1,175 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var defaultBrowseOptions = browseOptions{
+	addr: IPv4Group,
+	errors: func(err error) {
+		fmt.Println(err)
+	},
+}
+
+type browseOptions struct {
+	addr   *net.UDPAddr
+	errors ErrorFunc
+}
+
+type srvRecord struct {
+	target string
+	port   uint16
+}
+
+type instanceRecord struct {
+	name  string
+	raddr *net.UDPAddr
+}
+
+type browser struct {
+	instances map[string]instanceRecord
+	srv       map[string]srvRecord
+	txt       map[string][]string
+	hosts     map[string][]net.IP
+}
+
+func (b *browser) process(raddr *net.UDPAddr, rs []dnsmessage.Resource) {
+	for _, r := range rs {
+		name := strings.ToLower(r.Header.Name.String())
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name != ServiceType {
+				continue
+			}
+			instance := strings.ToLower(body.PTR.String())
+			if !strings.HasSuffix(instance, "."+ServiceType) {
+				continue
+			}
+			if _, ok := b.instances[instance]; !ok {
+				b.instances[instance] = instanceRecord{
+					name:  body.PTR.String(),
+					raddr: raddr,
+				}
+			}
+		case *dnsmessage.SRVResource:
+			b.srv[name] = srvRecord{
+				target: strings.ToLower(body.Target.String()),
+				port:   body.Port,
+			}
+		case *dnsmessage.TXTResource:
+			b.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			b.hosts[name] = appendIP(b.hosts[name], net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			b.hosts[name] = appendIP(b.hosts[name], net.IP(body.AAAA[:]))
+		}
+	}
+}
+
+func appendIP(ips []net.IP, ip net.IP) []net.IP {
+	for _, v := range ips {
+		if v.Equal(ip) {
+			return ips
+		}
+	}
+	return append(ips, append(net.IP(nil), ip...))
+}
+
+func (b *browser) endpoints() []Endpoint {
+	endpoints := make([]Endpoint, 0, len(b.instances))
+	for instance, rec := range b.instances {
+		srv, ok := b.srv[instance]
+		if !ok {
+			continue
+		}
+		ips := b.hosts[srv.target]
+		if len(ips) == 0 {
+			ips = []net.IP{rec.raddr.IP}
+		}
+		addrs := make([]*net.UDPAddr, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, &net.UDPAddr{IP: ip, Port: int(srv.port), Zone: rec.raddr.Zone})
+		}
+		resourceTypes, text := decodeText(b.txt[instance])
+		endpoints = append(endpoints, Endpoint{
+			Instance:      rec.name[:len(rec.name)-len(ServiceType)-1],
+			Host:          srv.target,
+			Addrs:         addrs,
+			ResourceTypes: resourceTypes,
+			Text:          text,
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Instance < endpoints[j].Instance
+	})
+	return endpoints
+}
+
+// Browse queries CoAP servers advertised via DNS-SD and collects responses until ctx is done.
+// The conn must not be bound to the mDNS port, so responders answer directly to it.
+func Browse(ctx context.Context, conn *coapNet.UDPConn, opt ...BrowseOption) ([]Endpoint, error) {
+	opts := defaultBrowseOptions
+	for _, o := range opt {
+		o.applyBrowse(&opts)
+	}
+	if opts.errors == nil {
+		opts.errors = func(error) {}
+	}
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{
+				Name:  dnsmessage.MustNewName(ServiceType),
+				Type:  dnsmessage.TypePTR,
+				Class: dnsmessage.ClassINET,
+			},
+		},
+	}
+	out, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("cannot pack query: %w", err)
+	}
+	if opts.addr.IP.IsMulticast() {
+		err = conn.WriteMulticast(ctx, opts.addr, 255, out)
+	} else {
+		err = conn.WriteWithContext(ctx, opts.addr, out)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot send query: %w", err)
+	}
+
+	b := browser{
+		instances: make(map[string]instanceRecord),
+		srv:       make(map[string]srvRecord),
+		txt:       make(map[string][]string),
+		hosts:     make(map[string][]net.IP),
+	}
+	buf := make([]byte, 9000)
+	for {
+		n, raddr, err := conn.ReadWithContext(ctx, buf)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return b.endpoints(), nil
+			}
+			return nil, err
+		}
+		var resp dnsmessage.Message
+		err = resp.Unpack(buf[:n])
+		if err != nil {
+			opts.errors(fmt.Errorf("cannot unpack response from %v: %w", raddr, err))
+			continue
+		}
+		if !resp.Response {
+			continue
+		}
+		b.process(raddr, resp.Answers)
+		b.process(raddr, resp.Additionals)
+	}
+}
@@ -0,0 +1,97 @@
+// Package mdns advertises CoAP servers via DNS-SD over multicast DNS (RFC 6762, RFC 6763)
+// and browses for them. It is meant for local networks where multicast CoAP discovery
+// of /.well-known/core is blocked but mDNS works.
+package mdns
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// ServiceType is DNS-SD service type of CoAP over UDP.
+	ServiceType = "_coap._udp.local."
+	// servicesEnumeration is DNS-SD name for enumerating service types (RFC 6763 section 9).
+	servicesEnumeration = "_services._dns-sd._udp.local."
+	// mdnsPort is port of multicast DNS.
+	mdnsPort = 5353
+	// ttl of resource records in seconds.
+	ttl = 120
+	// classUnicastResponse is bit of question class which requests unicast response (RFC 6762 section 5.4).
+	classUnicastResponse = 1 << 15
+	// classCacheFlush is bit of record class which marks unique records (RFC 6762 section 10.2).
+	classCacheFlush = 1 << 15
+)
+
+var (
+	// IPv4Group is multicast address of mDNS for IPv4.
+	IPv4Group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+	// IPv6Group is multicast address of mDNS for IPv6.
+	IPv6Group = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: mdnsPort}
+)
+
+// Service describes advertised CoAP server.
+type Service struct {
+	// Instance is unique name of the server on the local network.
+	Instance string
+	// Port is UDP port of the server.
+	Port uint16
+	// ResourceTypes are published in TXT record as rt=.
+	ResourceTypes []string
+	// Text contains additional key=value pairs of TXT record.
+	Text []string
+}
+
+// Endpoint is CoAP server found by Browse.
+type Endpoint struct {
+	Instance      string
+	Host          string
+	Addrs         []*net.UDPAddr
+	ResourceTypes []string
+	Text          []string
+}
+
+func instanceName(instance string) string {
+	return instance + "." + ServiceType
+}
+
+func hostName(host string) string {
+	host = strings.TrimSuffix(host, ".")
+	if strings.HasSuffix(host, ".local") {
+		return host + "."
+	}
+	return host + ".local."
+}
+
+func equalNames(a dnsmessage.Name, b string) bool {
+	return strings.EqualFold(a.String(), b)
+}
+
+func encodeText(service Service) []string {
+	txt := make([]string, 0, len(service.Text)+1)
+	if len(service.ResourceTypes) > 0 {
+		txt = append(txt, "rt="+strings.Join(service.ResourceTypes, " "))
+	}
+	txt = append(txt, service.Text...)
+	if len(txt) == 0 {
+		// TXT record must contain at least one string (RFC 6763 section 6.1)
+		txt = append(txt, "")
+	}
+	return txt
+}
+
+func decodeText(txt []string) (resourceTypes []string, text []string) {
+	for _, t := range txt {
+		if t == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(t), "rt=") {
+			resourceTypes = append(resourceTypes, strings.Fields(t[len("rt="):])...)
+			continue
+		}
+		text = append(text, t)
+	}
+	return resourceTypes, text
+}
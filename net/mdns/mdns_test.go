@@ -0,0 +1,55 @@
+package mdns_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/mdns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrowse(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s, err := mdns.NewServer(mdns.Service{
+		Instance:      "Sensor 1",
+		Port:          5683,
+		ResourceTypes: []string{"oic.r.temperature", "oic.r.humidity"},
+		Text:          []string{"fw=1.0"},
+	}, mdns.WithHostName("sensor"), mdns.WithHostAddresses(net.IPv4(192, 168, 1, 10)))
+	require.NoError(t, err)
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	conn, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	endpoints, err := mdns.Browse(ctx, conn, mdns.WithAddress(l.LocalAddr().(*net.UDPAddr)))
+	require.NoError(t, err)
+	require.Equal(t, []mdns.Endpoint{
+		{
+			Instance:      "Sensor 1",
+			Host:          "sensor.local.",
+			Addrs:         []*net.UDPAddr{{IP: net.IPv4(192, 168, 1, 10).To4(), Port: 5683}},
+			ResourceTypes: []string{"oic.r.temperature", "oic.r.humidity"},
+			Text:          []string{"fw=1.0"},
+		},
+	}, endpoints)
+}
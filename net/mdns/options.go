@@ -0,0 +1,73 @@
+package mdns
+
+import "net"
+
+// A ServerOption sets options such as host name, addresses, etc.
+type ServerOption interface {
+	applyServer(*serverOptions)
+}
+
+// A BrowseOption sets options such as destination address, etc.
+type BrowseOption interface {
+	applyBrowse(*browseOptions)
+}
+
+// ErrorsOpt errors option.
+type ErrorsOpt struct {
+	errors ErrorFunc
+}
+
+func (o ErrorsOpt) applyServer(opts *serverOptions) {
+	opts.errors = o.errors
+}
+
+func (o ErrorsOpt) applyBrowse(opts *browseOptions) {
+	opts.errors = o.errors
+}
+
+// WithErrors set function for logging error.
+func WithErrors(errors ErrorFunc) ErrorsOpt {
+	return ErrorsOpt{errors: errors}
+}
+
+// HostNameOpt host name option.
+type HostNameOpt struct {
+	hostName string
+}
+
+func (o HostNameOpt) applyServer(opts *serverOptions) {
+	opts.hostName = o.hostName
+}
+
+// WithHostName sets host name which is advertised in SRV record. The .local suffix is added when it is missing.
+func WithHostName(hostName string) HostNameOpt {
+	return HostNameOpt{hostName: hostName}
+}
+
+// HostAddressesOpt host addresses option.
+type HostAddressesOpt struct {
+	addrs []net.IP
+}
+
+func (o HostAddressesOpt) applyServer(opts *serverOptions) {
+	opts.hostAddrs = o.addrs
+}
+
+// WithHostAddresses sets addresses advertised in A and AAAA records. By default addresses of all non-loopback interfaces are used.
+func WithHostAddresses(addrs ...net.IP) HostAddressesOpt {
+	return HostAddressesOpt{addrs: addrs}
+}
+
+// AddressOpt address option.
+type AddressOpt struct {
+	addr *net.UDPAddr
+}
+
+func (o AddressOpt) applyBrowse(opts *browseOptions) {
+	opts.addr = o.addr
+}
+
+// WithAddress sets address where the query is sent. It is IPv4Group by default, a unicast address queries a single host.
+func WithAddress(addr *net.UDPAddr) AddressOpt {
+	return AddressOpt{addr: addr}
+}
@@ -0,0 +1,271 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type ErrorFunc = func(error)
+
+var defaultServerOptions = serverOptions{
+	errors: func(err error) {
+		fmt.Println(err)
+	},
+}
+
+type serverOptions struct {
+	errors    ErrorFunc
+	hostName  string
+	hostAddrs []net.IP
+}
+
+// Server responds to mDNS queries for the advertised service.
+type Server struct {
+	service   Service
+	instance  string
+	hostName  string
+	hostAddrs []net.IP
+	errors    ErrorFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewServer creates server which advertises service.
+func NewServer(service Service, opt ...ServerOption) (*Server, error) {
+	opts := defaultServerOptions
+	for _, o := range opt {
+		o.applyServer(&opts)
+	}
+	if service.Instance == "" {
+		return nil, fmt.Errorf("invalid instance name")
+	}
+	if _, err := dnsmessage.NewName(instanceName(service.Instance)); err != nil {
+		return nil, fmt.Errorf("invalid instance name: %w", err)
+	}
+	if service.Port == 0 {
+		return nil, fmt.Errorf("invalid port")
+	}
+	if opts.errors == nil {
+		opts.errors = func(error) {}
+	}
+	if opts.hostName == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get host name: %w", err)
+		}
+		opts.hostName = h
+	}
+	if _, err := dnsmessage.NewName(hostName(opts.hostName)); err != nil {
+		return nil, fmt.Errorf("invalid host name: %w", err)
+	}
+	if len(opts.hostAddrs) == 0 {
+		addrs, err := interfaceAddrs()
+		if err != nil {
+			return nil, err
+		}
+		opts.hostAddrs = addrs
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		service:   service,
+		instance:  instanceName(service.Instance),
+		hostName:  hostName(opts.hostName),
+		hostAddrs: opts.hostAddrs,
+		errors:    opts.errors,
+		ctx:       ctx,
+		cancel:    cancel,
+	}, nil
+}
+
+func interfaceAddrs() ([]net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get interface addresses: %w", err)
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		ips = append(ips, ipnet.IP)
+	}
+	return ips, nil
+}
+
+// Listen creates connection on mDNS port which joins mDNS group on all multicast interfaces.
+// Network is udp4 or udp6.
+func Listen(network string) (*coapNet.UDPConn, error) {
+	group := IPv4Group
+	if network == "udp6" {
+		group = IPv6Group
+	}
+	l, err := coapNet.NewListenUDP(network, fmt.Sprintf(":%v", mdnsPort))
+	if err != nil {
+		return nil, err
+	}
+	err = l.JoinGroupAll(group)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve responds to queries received by l until Stop is called.
+func (s *Server) Serve(l *coapNet.UDPConn) error {
+	buf := make([]byte, 9000)
+	for {
+		n, raddr, err := l.ReadWithContext(s.ctx, buf)
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return nil
+			default:
+				return err
+			}
+		}
+		err = s.handle(l, raddr, buf[:n])
+		if err != nil {
+			s.errors(fmt.Errorf("%v: %w", raddr, err))
+		}
+	}
+}
+
+// Stop stops serving.
+func (s *Server) Stop() {
+	s.cancel()
+}
+
+func (s *Server) handle(l *coapNet.UDPConn, raddr *net.UDPAddr, data []byte) error {
+	var req dnsmessage.Message
+	err := req.Unpack(data)
+	if err != nil {
+		return fmt.Errorf("cannot unpack query: %w", err)
+	}
+	if req.Response || req.OpCode != 0 {
+		return nil
+	}
+	var r records
+	unicast := raddr.Port != mdnsPort
+	for _, q := range req.Questions {
+		if q.Class&classUnicastResponse != 0 {
+			unicast = true
+		}
+		s.answer(q, &r)
+	}
+	if len(r.answers) == 0 {
+		return nil
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			Response:      true,
+			Authoritative: true,
+		},
+		Answers:     r.answers,
+		Additionals: r.additionals,
+	}
+	if raddr.Port != mdnsPort {
+		// legacy unicast response must repeat id and questions (RFC 6762 section 6.7)
+		resp.ID = req.ID
+		resp.Questions = req.Questions
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		return fmt.Errorf("cannot pack response: %w", err)
+	}
+	if unicast {
+		return l.WriteWithContext(s.ctx, raddr, out)
+	}
+	group := IPv4Group
+	if coapNet.IsIPv6(raddr.IP) {
+		group = IPv6Group
+	}
+	return l.WriteMulticast(s.ctx, group, 255, out)
+}
+
+type records struct {
+	answers     []dnsmessage.Resource
+	additionals []dnsmessage.Resource
+}
+
+func (s *Server) answer(q dnsmessage.Question, r *records) {
+	switch {
+	case equalNames(q.Name, ServiceType) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+		r.answers = append(r.answers, s.ptr())
+		r.additionals = append(r.additionals, s.srv(), s.txt())
+		r.additionals = append(r.additionals, s.addrs(dnsmessage.TypeALL)...)
+	case equalNames(q.Name, servicesEnumeration) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+		r.answers = append(r.answers, s.resource(servicesEnumeration, dnsmessage.ClassINET, &dnsmessage.PTRResource{
+			PTR: dnsmessage.MustNewName(ServiceType),
+		}))
+	case equalNames(q.Name, s.instance):
+		if q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL {
+			r.answers = append(r.answers, s.srv())
+			r.additionals = append(r.additionals, s.addrs(dnsmessage.TypeALL)...)
+		}
+		if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+			r.answers = append(r.answers, s.txt())
+		}
+	case equalNames(q.Name, s.hostName):
+		r.answers = append(r.answers, s.addrs(q.Type)...)
+	}
+}
+
+func (s *Server) resource(name string, class dnsmessage.Class, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(name),
+			Class: class,
+			TTL:   ttl,
+		},
+		Body: body,
+	}
+}
+
+func (s *Server) ptr() dnsmessage.Resource {
+	return s.resource(ServiceType, dnsmessage.ClassINET, &dnsmessage.PTRResource{
+		PTR: dnsmessage.MustNewName(s.instance),
+	})
+}
+
+func (s *Server) srv() dnsmessage.Resource {
+	return s.resource(s.instance, dnsmessage.ClassINET|classCacheFlush, &dnsmessage.SRVResource{
+		Target: dnsmessage.MustNewName(s.hostName),
+		Port:   s.service.Port,
+	})
+}
+
+func (s *Server) txt() dnsmessage.Resource {
+	return s.resource(s.instance, dnsmessage.ClassINET|classCacheFlush, &dnsmessage.TXTResource{
+		TXT: encodeText(s.service),
+	})
+}
+
+func (s *Server) addrs(typ dnsmessage.Type) []dnsmessage.Resource {
+	res := make([]dnsmessage.Resource, 0, len(s.hostAddrs))
+	for _, ip := range s.hostAddrs {
+		if ip4 := ip.To4(); ip4 != nil {
+			if typ != dnsmessage.TypeA && typ != dnsmessage.TypeALL {
+				continue
+			}
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			res = append(res, s.resource(s.hostName, dnsmessage.ClassINET|classCacheFlush, &a))
+			continue
+		}
+		if typ != dnsmessage.TypeAAAA && typ != dnsmessage.TypeALL {
+			continue
+		}
+		var a dnsmessage.AAAAResource
+		copy(a.AAAA[:], ip.To16())
+		res = append(res, s.resource(s.hostName, dnsmessage.ClassINET|classCacheFlush, &a))
+	}
+	return res
+}
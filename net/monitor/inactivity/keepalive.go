@@ -1,55 +1,166 @@
 package inactivity
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
-type KeepAlive struct {
-	pongToken uint64
-	sendToken uint64
-	numFails  uint32
+// RTTFunc is called with round-trip time of a ping answered by the peer of the connection.
+type RTTFunc = func(cc ClientConn, rtt time.Duration)
 
-	maxRetries uint32
-	onInactive OnInactiveFunc
+// KeepAliveParams are ping interval and timeout shared by keepalive monitors, they can be changed
+// while the connections run.
+type KeepAliveParams struct {
+	interval int64
+	timeout  int64
+	// onRTT stores RTTFunc
+	onRTT atomic.Value
+}
+
+// NewKeepAliveParams creates parameters of keepalive monitors.
+func NewKeepAliveParams(interval, timeout time.Duration) *KeepAliveParams {
+	p := &KeepAliveParams{}
+	p.Set(interval, timeout)
+	return p
+}
+
+// MinKeepAliveInterval is the least ping interval, a shorter one is raised to it. It catches callers of
+// WithKeepAlive which still pass the number of retries of the former API, e.g. WithKeepAlive(3, ...) would
+// mean pings every 3ns.
+const MinKeepAliveInterval = 10 * time.Millisecond
 
+// Set changes the parameters, monitors use them at the next check. Zero interval disables pings, a positive
+// one is at least MinKeepAliveInterval.
+func (p *KeepAliveParams) Set(interval, timeout time.Duration) {
+	if interval > 0 && interval < MinKeepAliveInterval {
+		interval = MinKeepAliveInterval
+	}
+	atomic.StoreInt64(&p.interval, int64(interval))
+	atomic.StoreInt64(&p.timeout, int64(timeout))
+}
+
+// Get returns ping interval and timeout.
+func (p *KeepAliveParams) Get() (time.Duration, time.Duration) {
+	return time.Duration(atomic.LoadInt64(&p.interval)), time.Duration(atomic.LoadInt64(&p.timeout))
+}
+
+// SetOnRTT sets function which the monitors call with round-trip time of each answered ping, e.g. to aggregate
+// it by metrics.KeepAliveRTT. It must not block.
+func (p *KeepAliveParams) SetOnRTT(onRTT RTTFunc) {
+	p.onRTT.Store(onRTT)
+}
+
+func (p *KeepAliveParams) reportRTT(cc ClientConn, rtt time.Duration) {
+	if onRTT, ok := p.onRTT.Load().(RTTFunc); ok && onRTT != nil {
+		onRTT(cc, rtt)
+	}
+}
+
+// KeepAlive is a Monitor which pings the connection idle for interval and calls onInactive when nothing
+// is received from the peer within timeout after the first ping. The ping is sent again every interval
+// until the peer answers.
+type KeepAlive struct {
+	params     *KeepAliveParams
+	onInactive OnInactiveFunc
 	sendPing   func(cc ClientConn, receivePong func()) (func(), error)
-	cancelPing func()
+
+	// rtt stores round-trip time of the last answered ping in nanoseconds
+	rtt int64
+
+	mutex        sync.Mutex
+	lastActivity time.Time
+	firstPing    time.Time
+	lastPing     time.Time
+	cancelPing   func()
+	inactive     bool
 }
 
-func NewKeepAlive(maxRetries uint32, onInactive OnInactiveFunc, sendPing func(cc ClientConn, receivePong func()) (func(), error)) *KeepAlive {
+// NewKeepAlive creates a keepalive monitor, sendPing sends a ping to the connection and calls receivePong
+// when the pong is received. It returns function which stops waiting for the pong.
+func NewKeepAlive(interval, timeout time.Duration, onInactive OnInactiveFunc, sendPing func(cc ClientConn, receivePong func()) (func(), error)) *KeepAlive {
+	return NewKeepAliveWithParams(NewKeepAliveParams(interval, timeout), onInactive, sendPing)
+}
+
+// NewKeepAliveWithParams creates a keepalive monitor with parameters shared by other monitors.
+func NewKeepAliveWithParams(params *KeepAliveParams, onInactive OnInactiveFunc, sendPing func(cc ClientConn, receivePong func()) (func(), error)) *KeepAlive {
 	return &KeepAlive{
-		maxRetries: maxRetries,
-		sendPing:   sendPing,
-		onInactive: onInactive,
+		params:       params,
+		onInactive:   onInactive,
+		sendPing:     sendPing,
+		lastActivity: time.Now(),
 	}
 }
 
-func (m *KeepAlive) OnInactive(cc ClientConn) {
-	v := m.incrementFails()
-	if m.cancelPing != nil {
-		m.cancelPing()
-		m.cancelPing = nil
+// Notify records activity of the connection.
+func (m *KeepAlive) Notify() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastActivity = time.Now()
+	m.inactive = false
+}
+
+// RTT returns round-trip time of the last answered ping, zero when no ping was answered yet.
+func (m *KeepAlive) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.rtt))
+}
+
+func (m *KeepAlive) CheckInactivity(cc ClientConn) {
+	interval, timeout := m.params.Get()
+	if interval <= 0 {
+		return
 	}
-	if v > m.maxRetries {
-		m.onInactive(cc)
+	now := time.Now()
+	m.mutex.Lock()
+	if now.Sub(m.lastActivity) < interval {
+		m.mutex.Unlock()
 		return
 	}
-	pongToken := atomic.AddUint64(&m.pongToken, 1)
-	cancel, err := m.sendPing(cc, func() {
-		if atomic.LoadUint64(&m.pongToken) == pongToken {
-			m.resetFails()
+	// pending is set when the peer didn't answer the pings sent since its last activity
+	pending := m.firstPing.After(m.lastActivity)
+	if pending && now.Sub(m.firstPing) >= timeout {
+		m.stopPingLocked()
+		inactive := m.inactive
+		m.inactive = true
+		m.mutex.Unlock()
+		if !inactive && m.onInactive != nil {
+			m.onInactive(cc)
 		}
+		return
+	}
+	if pending && now.Sub(m.lastPing) < interval {
+		m.mutex.Unlock()
+		return
+	}
+	m.stopPingLocked()
+	if !pending {
+		m.firstPing = now
+	}
+	m.lastPing = now
+	m.mutex.Unlock()
+
+	cancel, err := m.sendPing(cc, func() {
+		rtt := time.Since(now)
+		atomic.StoreInt64(&m.rtt, int64(rtt))
+		m.Notify()
+		m.params.reportRTT(cc, rtt)
 	})
 	if err != nil {
 		return
 	}
-	m.cancelPing = cancel
-}
-
-func (m *KeepAlive) incrementFails() uint32 {
-	return atomic.AddUint32(&m.numFails, 1)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.lastPing.Equal(now) {
+		m.cancelPing = cancel
+		return
+	}
+	// a newer ping was sent meanwhile
+	cancel()
 }
 
-func (m *KeepAlive) resetFails() {
-	atomic.StoreUint32(&m.numFails, 0)
+func (m *KeepAlive) stopPingLocked() {
+	if m.cancelPing != nil {
+		m.cancelPing()
+		m.cancelPing = nil
+	}
 }
@@ -0,0 +1,26 @@
+package inactivity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAliveParams_MinInterval(t *testing.T) {
+	// the number of retries of the former WithKeepAlive isn't taken as nanoseconds
+	p := inactivity.NewKeepAliveParams(3, time.Second*30)
+	interval, timeout := p.Get()
+	require.Equal(t, inactivity.MinKeepAliveInterval, interval)
+	require.Equal(t, time.Second*30, timeout)
+
+	// zero disables pings
+	p.Set(0, time.Second)
+	interval, _ = p.Get()
+	require.Equal(t, time.Duration(0), interval)
+
+	p.Set(time.Second, time.Second*5)
+	interval, _ = p.Get()
+	require.Equal(t, time.Second, interval)
+}
@@ -0,0 +1,41 @@
+package inactivity
+
+import "time"
+
+// Liveness is liveness of a connection, reported the same way by monitors of all transports, whether the peer
+// is pinged by CoAP Ping, by an empty confirmable message or by a WebSocket Ping frame.
+type Liveness struct {
+	// LastActivity is time when something was received from the peer.
+	LastActivity time.Time
+	// RTT is round-trip time of the last ping answered by the peer, zero when no ping was answered yet.
+	RTT time.Duration
+	// Inactive is set when the peer didn't answer pings within the timeout.
+	Inactive bool
+}
+
+// LivenessOf returns liveness reported by the monitor, monitors which don't track it report zero Liveness.
+func LivenessOf(m interface{ Notify() }) Liveness {
+	if r, ok := m.(interface{ Liveness() Liveness }); ok {
+		return r.Liveness()
+	}
+	return Liveness{}
+}
+
+// Liveness returns time of the last activity.
+func (m *inactivityMonitor) Liveness() Liveness {
+	return Liveness{
+		LastActivity: m.LastActivity(),
+	}
+}
+
+// Liveness returns time of the last activity, round-trip time of the last answered ping and whether the peer
+// stopped answering.
+func (m *KeepAlive) Liveness() Liveness {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return Liveness{
+		LastActivity: m.lastActivity,
+		RTT:          m.RTT(),
+		Inactive:     m.inactive,
+	}
+}
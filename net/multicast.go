@@ -0,0 +1,329 @@
+package net
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+// MulticastScope is scope of a multicast group address.
+type MulticastScope int
+
+const (
+	// ScopeGlobal is scope of groups which are neither link-local nor site-local.
+	ScopeGlobal MulticastScope = iota
+	// ScopeLinkLocal is scope of 224.0.0.0/24 and of interface-local and link-local IPv6 groups, e.g. ff02::fd.
+	ScopeLinkLocal
+	// ScopeSiteLocal is scope of IPv4 local scope 239.255.0.0/16 (RFC 2365) and of site-local IPv6 groups, e.g. ff05::fd.
+	ScopeSiteLocal
+)
+
+func (s MulticastScope) String() string {
+	switch s {
+	case ScopeGlobal:
+		return "global"
+	case ScopeLinkLocal:
+		return "link-local"
+	case ScopeSiteLocal:
+		return "site-local"
+	}
+	return fmt.Sprintf("MulticastScope(%d)", int(s))
+}
+
+// MulticastScopeOf returns scope of the multicast group address.
+func MulticastScopeOf(group net.IP) MulticastScope {
+	if ip4 := group.To4(); ip4 != nil {
+		switch {
+		case ip4.IsLinkLocalMulticast():
+			return ScopeLinkLocal
+		case ip4[0] == 239 && ip4[1] == 255:
+			return ScopeSiteLocal
+		}
+		return ScopeGlobal
+	}
+	if len(group) != net.IPv6len {
+		return ScopeGlobal
+	}
+	switch group[1] & 0x0f {
+	case 0x1, 0x2:
+		return ScopeLinkLocal
+	case 0x5:
+		return ScopeSiteLocal
+	}
+	return ScopeGlobal
+}
+
+// MulticastInterfaces returns interfaces which are up and support multicast.
+func MulticastInterfaces() ([]net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get interfaces: %w", err)
+	}
+	res := make([]net.Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		res = append(res, iface)
+	}
+	return res, nil
+}
+
+// MulticastGroup is membership of the connection in a multicast group.
+type MulticastGroup struct {
+	// IP is address of the group.
+	IP net.IP
+	// Interfaces are interfaces on which the group was joined, an interface with zero index is the system
+	// assigned one.
+	Interfaces []net.Interface
+	// AllInterfaces reports whether the group was joined by JoinGroupAll, so RefreshGroups follows interfaces.
+	AllInterfaces bool
+	// HopLimit is hop limit or TTL of multicast messages sent to the group, zero when the default is used.
+	HopLimit int
+}
+
+type membership struct {
+	ip     net.IP
+	all    bool
+	ifaces map[int]net.Interface
+}
+
+// groups tracks multicast memberships and hop limits of the connection.
+type groups struct {
+	mutex          sync.Mutex
+	memberships    map[string]*membership
+	groupHopLimits map[string]int
+	scopeHopLimits map[MulticastScope]int
+}
+
+func groupIP(group net.Addr) (net.IP, error) {
+	var ip net.IP
+	switch g := group.(type) {
+	case *net.UDPAddr:
+		ip = g.IP
+	case *net.IPAddr:
+		ip = g.IP
+	}
+	if ip == nil || !ip.IsMulticast() {
+		return nil, fmt.Errorf("invalid multicast group %v", group)
+	}
+	return ip, nil
+}
+
+func (g *groups) add(ip net.IP, ifi *net.Interface, all bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.memberships == nil {
+		g.memberships = make(map[string]*membership)
+	}
+	m, ok := g.memberships[ip.String()]
+	if !ok {
+		m = &membership{ip: ip, ifaces: make(map[int]net.Interface)}
+		g.memberships[ip.String()] = m
+	}
+	m.all = m.all || all
+	var iface net.Interface
+	if ifi != nil {
+		iface = *ifi
+	}
+	m.ifaces[iface.Index] = iface
+}
+
+func (g *groups) remove(ip net.IP, ifi *net.Interface) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	m, ok := g.memberships[ip.String()]
+	if !ok {
+		return
+	}
+	var index int
+	if ifi != nil {
+		index = ifi.Index
+	}
+	delete(m.ifaces, index)
+	if len(m.ifaces) == 0 {
+		delete(g.memberships, ip.String())
+	}
+}
+
+func (g *groups) interfaces(ip net.IP) []net.Interface {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	m, ok := g.memberships[ip.String()]
+	if !ok {
+		return nil
+	}
+	ifaces := make([]net.Interface, 0, len(m.ifaces))
+	for _, iface := range m.ifaces {
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces
+}
+
+// followed returns groups joined on all interfaces with indexes of their interfaces.
+func (g *groups) followed() map[string]map[int]bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	res := make(map[string]map[int]bool)
+	for key, m := range g.memberships {
+		if !m.all {
+			continue
+		}
+		indexes := make(map[int]bool, len(m.ifaces))
+		for index := range m.ifaces {
+			indexes[index] = true
+		}
+		res[key] = indexes
+	}
+	return res
+}
+
+func (g *groups) hopLimit(ip net.IP, hopLimit int) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if v, ok := g.groupHopLimits[ip.String()]; ok {
+		return v
+	}
+	if v, ok := g.scopeHopLimits[MulticastScopeOf(ip)]; ok {
+		return v
+	}
+	return hopLimit
+}
+
+// JoinGroupAll joins the group address group on all interfaces which are up and support multicast. The group
+// follows the interfaces by RefreshGroups, e.g. when interfaces of a gateway come and go.
+func (c *UDPConn) JoinGroupAll(group net.Addr) error {
+	ip, err := groupIP(group)
+	if err != nil {
+		return err
+	}
+	ifaces, err := MulticastInterfaces()
+	if err != nil {
+		return fmt.Errorf("cannot join multicast group %v: %w", ip, err)
+	}
+	var joined bool
+	for i := range ifaces {
+		if c.packetConn.JoinGroup(&ifaces[i], group) == nil {
+			c.groups.add(ip, &ifaces[i], true)
+			joined = true
+		}
+	}
+	if !joined {
+		return fmt.Errorf("cannot join multicast group %v: no interface", ip)
+	}
+	return nil
+}
+
+// LeaveGroupAll leaves the group address group on all interfaces on which it was joined.
+func (c *UDPConn) LeaveGroupAll(group net.Addr) error {
+	ip, err := groupIP(group)
+	if err != nil {
+		return err
+	}
+	var errLeave error
+	for _, iface := range c.groups.interfaces(ip) {
+		iface := iface
+		var ifi *net.Interface
+		if iface.Index != 0 {
+			ifi = &iface
+		}
+		if err := c.packetConn.LeaveGroup(ifi, group); err != nil && errLeave == nil {
+			errLeave = fmt.Errorf("cannot leave multicast group %v on %v: %w", ip, iface.Name, err)
+		}
+		c.groups.remove(ip, ifi)
+	}
+	return errLeave
+}
+
+// RefreshGroups joins groups of JoinGroupAll on interfaces which appeared since they were joined and forgets
+// interfaces which disappeared. Failures of single interfaces are reported to the errors handler.
+func (c *UDPConn) RefreshGroups() error {
+	ifaces, err := MulticastInterfaces()
+	if err != nil {
+		return fmt.Errorf("cannot refresh multicast groups: %w", err)
+	}
+	present := make(map[int]bool, len(ifaces))
+	for _, iface := range ifaces {
+		present[iface.Index] = true
+	}
+	for key, joined := range c.groups.followed() {
+		ip := net.ParseIP(key)
+		group := &net.UDPAddr{IP: ip}
+		for i := range ifaces {
+			if joined[ifaces[i].Index] {
+				continue
+			}
+			if err := c.packetConn.JoinGroup(&ifaces[i], group); err != nil {
+				if c.errors != nil {
+					c.errors(fmt.Errorf("cannot join multicast group %v on %v: %w", ip, ifaces[i].Name, err))
+				}
+				continue
+			}
+			c.groups.add(ip, &ifaces[i], true)
+		}
+		for index := range joined {
+			if !present[index] {
+				c.groups.remove(ip, &net.Interface{Index: index})
+			}
+		}
+	}
+	return nil
+}
+
+// Groups returns multicast groups joined by the connection.
+func (c *UDPConn) Groups() []MulticastGroup {
+	c.groups.mutex.Lock()
+	defer c.groups.mutex.Unlock()
+	res := make([]MulticastGroup, 0, len(c.groups.memberships))
+	for key, m := range c.groups.memberships {
+		ifaces := make([]net.Interface, 0, len(m.ifaces))
+		for _, iface := range m.ifaces {
+			ifaces = append(ifaces, iface)
+		}
+		sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Index < ifaces[j].Index })
+		res = append(res, MulticastGroup{
+			IP:            m.ip,
+			Interfaces:    ifaces,
+			AllInterfaces: m.all,
+			HopLimit:      c.groups.groupHopLimits[key],
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].IP.String() < res[j].IP.String() })
+	return res
+}
+
+// SetGroupHopLimit sets hop limit of IPv6 or TTL of IPv4 multicast messages sent to the group by WriteMulticast,
+// it overrides the hop limit passed to WriteMulticast and the hop limit of the scope. Zero restores the default.
+func (c *UDPConn) SetGroupHopLimit(group net.Addr, hopLimit int) error {
+	ip, err := groupIP(group)
+	if err != nil {
+		return err
+	}
+	c.groups.mutex.Lock()
+	defer c.groups.mutex.Unlock()
+	if hopLimit <= 0 {
+		delete(c.groups.groupHopLimits, ip.String())
+		return nil
+	}
+	if c.groups.groupHopLimits == nil {
+		c.groups.groupHopLimits = make(map[string]int)
+	}
+	c.groups.groupHopLimits[ip.String()] = hopLimit
+	return nil
+}
+
+// SetScopeHopLimit sets hop limit or TTL of multicast messages sent by WriteMulticast to groups of the scope,
+// e.g. 1 for link-local groups. Zero restores the default.
+func (c *UDPConn) SetScopeHopLimit(scope MulticastScope, hopLimit int) {
+	c.groups.mutex.Lock()
+	defer c.groups.mutex.Unlock()
+	if hopLimit <= 0 {
+		delete(c.groups.scopeHopLimits, scope)
+		return
+	}
+	if c.groups.scopeHopLimits == nil {
+		c.groups.scopeHopLimits = make(map[MulticastScope]int)
+	}
+	c.groups.scopeHopLimits[scope] = hopLimit
+}
@@ -0,0 +1,113 @@
+//go:build !tinygo
+
+package observation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// FileStore is Store which keeps records in a JSON file. The file is rewritten on every change.
+type FileStore struct {
+	path    string
+	mutex   sync.Mutex
+	records map[string]Record
+}
+
+// NewFileStore creates store backed by file at path and loads records it contains.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:    path,
+		records: make(map[string]Record),
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("cannot read observation store: %w", err)
+	}
+	var records []Record
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode observation store: %w", err)
+	}
+	for _, r := range records {
+		s.records[r.Token.String()] = r
+	}
+	return s, nil
+}
+
+// Save inserts or updates the record with the same token.
+func (s *FileStore) Save(record Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[record.Token.String()] = record
+	return s.flush()
+}
+
+// Delete removes the record with the token.
+func (s *FileStore) Delete(token message.Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.records[token.String()]; !ok {
+		return nil
+	}
+	delete(s.records, token.String())
+	return s.flush()
+}
+
+// Load returns all records ordered by path.
+func (s *FileStore) Load() ([]Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sorted(), nil
+}
+
+func (s *FileStore) sorted() []Record {
+	records := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Path == records[j].Path {
+			return records[i].Token.String() < records[j].Token.String()
+		}
+		return records[i].Path < records[j].Path
+	})
+	return records
+}
+
+func (s *FileStore) flush() error {
+	data, err := json.Marshal(s.sorted())
+	if err != nil {
+		return fmt.Errorf("cannot encode observation store: %w", err)
+	}
+	// write to temporary file first, so a crash doesn't leave file half written
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot write observation store: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write observation store: %w", err)
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("cannot write observation store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build !tinygo
+
+package observation_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "observation")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "observations.json")
+
+	s, err := observation.NewFileStore(path)
+	require.NoError(t, err)
+	records, err := s.Load()
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	a := observation.Record{
+		Token:     message.Token("a"),
+		Path:      "/a",
+		Options:   message.Options{{ID: message.URIQuery, Value: []byte("if=oic.if.baseline")}},
+		Sequence:  2,
+		LastEvent: time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+	b := observation.Record{
+		Token: message.Token("b"),
+		Path:  "/b",
+	}
+	require.NoError(t, s.Save(b))
+	require.NoError(t, s.Save(a))
+	a.Sequence = 3
+	require.NoError(t, s.Save(a))
+
+	s, err = observation.NewFileStore(path)
+	require.NoError(t, err)
+	records, err = s.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, a.Path, records[0].Path)
+	require.Equal(t, a.Token, records[0].Token)
+	require.Equal(t, a.Options, records[0].Options)
+	require.Equal(t, uint32(3), records[0].Sequence)
+	require.True(t, a.LastEvent.Equal(records[0].LastEvent))
+	require.Equal(t, b.Token, records[1].Token)
+
+	require.NoError(t, s.Delete(a.Token))
+	require.NoError(t, s.Delete(message.Token("unknown")))
+	s, err = observation.NewFileStore(path)
+	require.NoError(t, err)
+	records, err = s.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, b.Token, records[0].Token)
+}
@@ -0,0 +1,28 @@
+package observation
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// Record describes observation registered by a client.
+type Record struct {
+	Token     message.Token   `json:"token"`
+	Path      string          `json:"path"`
+	Options   message.Options `json:"options,omitempty"`
+	Sequence  uint32          `json:"sequence"`
+	LastEvent time.Time       `json:"lastEvent"`
+}
+
+// Store persists observations of a client, so they can be re-established after restart.
+//
+// Multiple goroutines may invoke methods on a Store simultaneously.
+type Store interface {
+	// Save inserts or updates the record with the same token.
+	Save(record Record) error
+	// Delete removes the record with the token. Unknown token is not an error.
+	Delete(token message.Token) error
+	// Load returns all records.
+	Load() ([]Record, error)
+}
@@ -27,6 +27,10 @@ func (h HeartBeatOpt) applyTLSListener(o *tlsListenerOptions) {
 	o.heartBeat = h.heartBeat
 }
 
+func (h HeartBeatOpt) applyUnixListener(o *unixListenerOptions) {
+	o.heartBeat = h.heartBeat
+}
+
 func (h HeartBeatOpt) applyDTLSListener(o *dtlsListenerOptions) {
 	o.heartBeat = h.heartBeat
 }
@@ -79,6 +83,10 @@ func (h OnTimeoutOpt) applyTLSListener(o *tlsListenerOptions) {
 	o.onTimeout = h.onTimeout
 }
 
+func (h OnTimeoutOpt) applyUnixListener(o *unixListenerOptions) {
+	o.onTimeout = h.onTimeout
+}
+
 func (h OnTimeoutOpt) applyDTLSListener(o *dtlsListenerOptions) {
 	o.onTimeout = h.onTimeout
 }
@@ -118,3 +126,84 @@ func (h OnWriteTimeoutOpt) applyConn(o *connOptions) {
 func (h OnWriteTimeoutOpt) applyUDP(o *udpConnOptions) {
 	o.onWriteTimeout = h.onWriteTimeout
 }
+
+type ReadIdleTimeoutOpt struct {
+	timeout time.Duration
+}
+
+// WithReadIdleTimeout closes reading of the connection by ErrReadIdleTimeout when nothing is read within timeout.
+func WithReadIdleTimeout(timeout time.Duration) ReadIdleTimeoutOpt {
+	return ReadIdleTimeoutOpt{
+		timeout: timeout,
+	}
+}
+
+func (h ReadIdleTimeoutOpt) applyConn(o *connOptions) {
+	o.readIdleTimeout = h.timeout
+}
+
+type WriteIdleTimeoutOpt struct {
+	timeout time.Duration
+}
+
+// WithWriteIdleTimeout fails writing to the connection by ErrWriteIdleTimeout when nothing is written within timeout.
+func WithWriteIdleTimeout(timeout time.Duration) WriteIdleTimeoutOpt {
+	return WriteIdleTimeoutOpt{
+		timeout: timeout,
+	}
+}
+
+func (h WriteIdleTimeoutOpt) applyConn(o *connOptions) {
+	o.writeIdleTimeout = h.timeout
+}
+
+type BatchIOOpt struct {
+	batch int
+}
+
+// WithBatchIO reads and writes up to n datagrams of UDP connection by one syscall, e.g. recvmmsg and sendmmsg
+// on Linux, so a busy server isn't bound by number of syscalls. Every datagram of the read batch has a buffer
+// of the maximal UDP payload size. Platforms without batch syscalls transfer one datagram per syscall.
+func WithBatchIO(n int) BatchIOOpt {
+	return BatchIOOpt{
+		batch: n,
+	}
+}
+
+func (h BatchIOOpt) applyUDP(o *udpConnOptions) {
+	o.batch = h.batch
+}
+
+type FairSchedulingOpt struct {
+	quantum int
+}
+
+// WithFairScheduling writes datagrams queued by concurrent writers of UDP connection in deficit round robin order
+// of remote addresses, every address gets quantum bytes per round, so a few chatty peers don't starve the others
+// when the uplink is congested. The quantum should be at least the maximal message size.
+func WithFairScheduling(quantum int) FairSchedulingOpt {
+	return FairSchedulingOpt{
+		quantum: quantum,
+	}
+}
+
+func (h FairSchedulingOpt) applyUDP(o *udpConnOptions) {
+	o.fairQuantum = h.quantum
+}
+
+type FlowLabelOpt struct {
+	flowLabel FlowLabelFunc
+}
+
+// WithFlowLabel sets IPv6 flow labels of datagrams written by UDP connection, e.g. FlowLabelPerExchange, so
+// network gear balancing by the label keeps datagrams of multi-datagram exchanges on the same path. Labels are
+// leased from the flow label manager of Linux, other platforms and datagrams written by WithBatchIO aren't labeled.
+func WithFlowLabel(flowLabel FlowLabelFunc) FlowLabelOpt {
+	return FlowLabelOpt{
+		flowLabel: flowLabel,
+	}
+}
+
+func (h FlowLabelOpt) applyUDP(o *udpConnOptions) {
+	o.flowLabel = h.flowLabel
+}
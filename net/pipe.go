@@ -0,0 +1,100 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+)
+
+// pipeQueueSize is number of messages buffered by each direction of a pipe.
+const pipeQueueSize = 64
+
+// PipeAddr is address of an endpoint of the pipe.
+type PipeAddr string
+
+// Network returns "pipe".
+func (a PipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a PipeAddr) String() string {
+	return string(a)
+}
+
+type pipeTransport struct {
+	in     chan []byte
+	out    chan []byte
+	remote net.Addr
+	peer   *pipeTransport
+	closer
+}
+
+// NewPipe creates in-memory transports connected with each other, e.g. for tests of a client with a server
+// without network. The first transport has remote address of the second one and vice versa.
+func NewPipe(a, b PipeAddr) (Transport, Transport) {
+	ab := make(chan []byte, pipeQueueSize)
+	ba := make(chan []byte, pipeQueueSize)
+	ta := &pipeTransport{in: ba, out: ab, remote: b, closer: newCloser()}
+	tb := &pipeTransport{in: ab, out: ba, remote: a, closer: newCloser()}
+	ta.peer = tb
+	tb.peer = ta
+	return ta, tb
+}
+
+func (t *pipeTransport) ReadMessage(ctx context.Context, buffer []byte) (int, error) {
+	select {
+	case data := <-t.in:
+		if len(data) > len(buffer) {
+			return -1, fmt.Errorf("message of size %v exceeds the buffer of size %v", len(data), len(buffer))
+		}
+		return copy(buffer, data), nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	case <-t.done:
+		return -1, io.ErrClosedPipe
+	case <-t.peer.done:
+		select {
+		case data := <-t.in:
+			// deliver messages written before the peer was closed
+			if len(data) > len(buffer) {
+				return -1, fmt.Errorf("message of size %v exceeds the buffer of size %v", len(data), len(buffer))
+			}
+			return copy(buffer, data), nil
+		default:
+			return -1, io.EOF
+		}
+	}
+}
+
+func (t *pipeTransport) WriteMessage(ctx context.Context, data []byte) error {
+	select {
+	case <-t.done:
+		return io.ErrClosedPipe
+	case <-t.peer.done:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case t.out <- append([]byte(nil), data...):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.done:
+		return io.ErrClosedPipe
+	case <-t.peer.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (t *pipeTransport) Close() error {
+	return t.close(nil)
+}
+
+func (t *pipeTransport) RemoteAddr() net.Addr {
+	return t.remote
+}
+
+func (t *pipeTransport) Done() <-chan struct{} {
+	return t.done
+}
@@ -0,0 +1,144 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+// PipeListener accepts in-memory connections created by net.Pipe, e.g. for hermetic tests of a client
+// with a server without ports. Messages are framed as over TCP.
+type PipeListener struct {
+	addr   PipeAddr
+	connCh chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewPipeListener creates listener of connections dialed by Dial.
+func NewPipeListener(addr PipeAddr) *PipeListener {
+	return &PipeListener{
+		addr:   addr,
+		connCh: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+}
+
+// Dial creates connection to the listener, it waits until the connection is accepted.
+func (l *PipeListener) Dial(ctx context.Context) (net.Conn, error) {
+	s, c := net.Pipe()
+	server, client := newBufferedPipeConn(s), newBufferedPipeConn(c)
+	select {
+	case l.connCh <- server:
+		return client, nil
+	case <-ctx.Done():
+	case <-l.done:
+	}
+	server.Close()
+	client.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, ErrListenerIsClosed
+}
+
+// AcceptWithContext waits with context for a generic Conn.
+func (l *PipeListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, ErrListenerIsClosed
+	}
+}
+
+// Accept waits for a generic Conn.
+func (l *PipeListener) Accept() (net.Conn, error) {
+	return l.AcceptWithContext(context.Background())
+}
+
+// Close closes the listener, connections which were accepted are kept open.
+func (l *PipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Addr represents a network end point address.
+func (l *PipeListener) Addr() net.Addr {
+	return l.addr
+}
+
+// bufferedPipeConn queues writes to the pipe, so both endpoints can write at once, e.g. their CSM, without
+// waiting for the peer to read as over a socket.
+type bufferedPipeConn struct {
+	net.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+
+	mutex sync.Mutex
+	err   error
+}
+
+func newBufferedPipeConn(conn net.Conn) *bufferedPipeConn {
+	c := &bufferedPipeConn{
+		Conn:  conn,
+		queue: make(chan []byte, pipeQueueSize),
+		done:  make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+func (c *bufferedPipeConn) writeLoop() {
+	for {
+		select {
+		case data := <-c.queue:
+			if _, err := c.Conn.Write(data); err != nil {
+				c.setErr(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *bufferedPipeConn) setErr(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *bufferedPipeConn) getErr() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *bufferedPipeConn) Write(data []byte) (int, error) {
+	if err := c.getErr(); err != nil {
+		return 0, err
+	}
+	select {
+	case c.queue <- append([]byte(nil), data...):
+		return len(data), nil
+	case <-c.done:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+func (c *bufferedPipeConn) Close() error {
+	c.once.Do(func() {
+		c.setErr(io.ErrClosedPipe)
+		close(c.done)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,39 @@
+package net
+
+import (
+	"context"
+	"net"
+)
+
+// RequestInfo describes transport of a received message. Handlers get it from context of the request
+// by RequestInfoFromContext.
+type RequestInfo struct {
+	// Network is the transport, e.g. "udp", "dtls", "tcp", "tls" or "unix".
+	Network    string
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// Multicast reports whether the request was sent to a multicast group. It is known only to servers which read
+	// destinations of datagrams, e.g. with multicast leisure.
+	Multicast bool
+	// Confirmable reports whether the message was confirmable. Messages over reliable transports are neither
+	// confirmable nor non-confirmable.
+	Confirmable bool
+	// CipherSuite is name of the cipher suite negotiated by DTLS or TLS.
+	CipherSuite string
+	// NegotiatedProtocol is the application protocol negotiated by TLS ALPN.
+	NegotiatedProtocol string
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo returns copy of ctx which carries the info.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns transport of the message whose context is ctx. It returns false when
+// the context doesn't carry it, e.g. for requests created by the application.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
@@ -57,6 +57,15 @@ func NewTCPListener(network string, addr string, opts ...TCPListenerOption) (*TC
 	return &TCPListener{listener: tcp, heartBeat: cfg.heartBeat, onTimeout: cfg.onTimeout}, nil
 }
 
+// NewTCPListenerFrom creates tcp listener over the listening socket, e.g. inherited from the previous process.
+func NewTCPListenerFrom(l *net.TCPListener, opts ...TCPListenerOption) *TCPListener {
+	cfg := defaultTCPListenerOptions
+	for _, o := range opts {
+		o.applyTCPListener(&cfg)
+	}
+	return &TCPListener{listener: l, heartBeat: cfg.heartBeat, onTimeout: cfg.onTimeout}
+}
+
 // AcceptWithContext waits with context for a generic Conn.
 func (l *TCPListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
 	for {
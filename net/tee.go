@@ -0,0 +1,44 @@
+package net
+
+import (
+	"context"
+)
+
+// MessageWriter writes a marshaled message, e.g. a Transport.
+type MessageWriter interface {
+	WriteMessage(ctx context.Context, data []byte) error
+}
+
+// MessageWriterFunc is an adapter to allow the use of ordinary functions as MessageWriter.
+type MessageWriterFunc func(ctx context.Context, data []byte) error
+
+// WriteMessage calls f(ctx, data).
+func (f MessageWriterFunc) WriteMessage(ctx context.Context, data []byte) error {
+	return f(ctx, data)
+}
+
+type teeTransport struct {
+	Transport
+	mirrors []MessageWriter
+}
+
+// NewTeeTransport creates transport which writes each message to the transport and then mirrors the same marshaled
+// bytes to the mirrors, e.g. an audit sink. Mirrors must not modify or retain the data after WriteMessage returns.
+// Errors of mirrors don't fail the write to the transport and they are dropped.
+func NewTeeTransport(t Transport, mirrors ...MessageWriter) Transport {
+	return &teeTransport{
+		Transport: t,
+		mirrors:   mirrors,
+	}
+}
+
+func (t *teeTransport) WriteMessage(ctx context.Context, data []byte) error {
+	err := t.Transport.WriteMessage(ctx, data)
+	if err != nil {
+		return err
+	}
+	for _, m := range t.mirrors {
+		_ = m.WriteMessage(ctx, data)
+	}
+	return nil
+}
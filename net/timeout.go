@@ -0,0 +1,89 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutKind is cause of TimeoutError.
+type TimeoutKind int
+
+const (
+	// TimeoutNetwork is timeout of the network: the message wasn't written within the write timeout, e.g. the peer
+	// doesn't read.
+	TimeoutNetwork TimeoutKind = iota
+	// TimeoutRetransmission is exhaustion of retransmissions: the peer didn't acknowledge the message.
+	TimeoutRetransmission
+	// TimeoutExchange is timeout of the exchange: the response didn't arrive within the exchange timeout.
+	TimeoutExchange
+)
+
+func (k TimeoutKind) String() string {
+	switch k {
+	case TimeoutNetwork:
+		return "network"
+	case TimeoutRetransmission:
+		return "retransmission"
+	case TimeoutExchange:
+		return "exchange"
+	}
+	return fmt.Sprintf("TimeoutKind(%d)", int(k))
+}
+
+// TimeoutError is returned when a message or an exchange times out, its Kind tells the cause. Use errors.As
+// to get it from the error of a request.
+type TimeoutError struct {
+	Kind TimeoutKind
+	Err  error
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout: " + e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports the error is a timeout, like net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// WriteWithTimeout calls write with ctx bounded by the timeout, zero timeout disables it. It returns TimeoutError
+// of TimeoutNetwork when the timeout expired before ctx is done.
+func WriteWithTimeout(ctx context.Context, timeout time.Duration, write func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return write(ctx)
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := write(writeCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(writeCtx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Kind: TimeoutNetwork, Err: fmt.Errorf("write took longer than %v: %w", timeout, err)}
+	}
+	return err
+}
+
+// ExchangeTimeout bounds ctx of an exchange by the timeout when ctx has no deadline, e.g. the caller didn't set
+// one. The returned function releases the context and converts the error of the exchange to TimeoutError of
+// TimeoutExchange when the timeout expired.
+func ExchangeTimeout(ctx context.Context, timeout time.Duration) (context.Context, func(err error) error) {
+	if timeout <= 0 {
+		return ctx, func(err error) error { return err }
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func(err error) error { return err }
+	}
+	exchangeCtx, cancel := context.WithTimeout(ctx, timeout)
+	return exchangeCtx, func(err error) error {
+		defer cancel()
+		var timeoutErr *TimeoutError
+		if err == nil || ctx.Err() != nil || !errors.Is(exchangeCtx.Err(), context.DeadlineExceeded) || errors.As(err, &timeoutErr) {
+			return err
+		}
+		return &TimeoutError{Kind: TimeoutExchange, Err: fmt.Errorf("no response within %v: %w", timeout, err)}
+	}
+}
@@ -0,0 +1,63 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteWithTimeout(t *testing.T) {
+	blocked := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	err := WriteWithTimeout(context.Background(), time.Millisecond*10, blocked)
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, TimeoutNetwork, timeoutErr.Kind)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// cancellation by the caller isn't the timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = WriteWithTimeout(ctx, time.Hour, blocked)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, errors.As(err, &timeoutErr))
+
+	err = WriteWithTimeout(context.Background(), 0, func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		require.False(t, ok)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestExchangeTimeout(t *testing.T) {
+	ctx, finish := ExchangeTimeout(context.Background(), time.Millisecond*10)
+	<-ctx.Done()
+	err := finish(ctx.Err())
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, TimeoutExchange, timeoutErr.Kind)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the deadline of the caller is kept
+	parent, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	ctx, finish = ExchangeTimeout(parent, time.Hour)
+	require.Equal(t, parent, ctx)
+	<-ctx.Done()
+	err = finish(ctx.Err())
+	require.False(t, errors.As(err, &timeoutErr))
+
+	// timeout error of the exchange, e.g. exhausted retransmissions, is kept
+	ctx, finish = ExchangeTimeout(context.Background(), time.Millisecond*10)
+	<-ctx.Done()
+	err = finish(&TimeoutError{Kind: TimeoutRetransmission, Err: errors.New("retransmission(4) was exhausted")})
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, TimeoutRetransmission, timeoutErr.Kind)
+	require.Equal(t, "timeout: retransmission(4) was exhausted", err.Error())
+}
@@ -3,12 +3,20 @@ package net
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// errClosedConn is text of net.ErrClosed.
+const errClosedConn = "use of closed network connection"
+
+var errHandshakeClosed = errors.New("connection was closed during handshake")
+
 // TLSListener is a TLS listener that provides accept with context.
 type TLSListener struct {
 	tcp       *net.TCPListener
@@ -16,6 +24,7 @@ type TLSListener struct {
 	heartBeat time.Duration
 	closed    uint32
 	onTimeout func() error
+	handshake *handshakeStats
 }
 
 var defaultTLSListenerOptions = tlsListenerOptions{
@@ -23,8 +32,9 @@ var defaultTLSListenerOptions = tlsListenerOptions{
 }
 
 type tlsListenerOptions struct {
-	heartBeat time.Duration
-	onTimeout func() error
+	heartBeat   time.Duration
+	onTimeout   func() error
+	onHandshake HandshakeFunc
 }
 
 // A TLSListenerOption sets options such as heartBeat parameters, etc.
@@ -43,11 +53,12 @@ func NewTLSListener(network string, addr string, tlsCfg *tls.Config, opts ...TLS
 	if err != nil {
 		return nil, fmt.Errorf("cannot create new tls listener: %w", err)
 	}
-	tls := tls.NewListener(tcp, tlsCfg)
+	handshake := newHandshakeStats(cfg.onHandshake)
 	return &TLSListener{
 		tcp:       tcp,
-		listener:  tls,
+		listener:  newHandshakeListener(tcp, tlsCfg, handshake),
 		heartBeat: cfg.heartBeat,
+		handshake: handshake,
 	}, nil
 }
 
@@ -102,7 +113,154 @@ func (l *TLSListener) Close() error {
 	return l.listener.Close()
 }
 
+// HandshakeStats returns statistics of handshakes of connections accepted by the listener.
+func (l *TLSListener) HandshakeStats() HandshakeStats {
+	return l.handshake.get()
+}
+
 // Addr represents a network end point address.
 func (l *TLSListener) Addr() net.Addr {
 	return l.listener.Addr()
 }
+
+// handshakeListener is the same as tls.NewListener, but it measures handshakes of accepted connections. The handshake
+// starts when tls.ClientHelloInfo is received and it is finished when the connection is verified.
+type handshakeListener struct {
+	net.Listener
+	config    *tls.Config
+	handshake *handshakeStats
+}
+
+func newHandshakeListener(inner net.Listener, config *tls.Config, handshake *handshakeStats) *handshakeListener {
+	cfg := config.Clone()
+	getConfigForClient := config.GetConfigForClient
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		base := config
+		if getConfigForClient != nil {
+			c, err := getConfigForClient(hello)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				base = c
+			}
+		}
+		conn, ok := hello.Conn.(*handshakeConn)
+		if !ok {
+			return base, nil
+		}
+		conn.started()
+		// the config is cloned for every connection, so the verification can be bound to the connection
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		verifyConnection := c.VerifyConnection
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verifyConnection != nil {
+				err := verifyConnection(cs)
+				if err != nil {
+					return err
+				}
+			}
+			conn.finished(cs.DidResume)
+			return nil
+		}
+		return c, nil
+	}
+	return &handshakeListener{
+		Listener:  inner,
+		config:    cfg,
+		handshake: handshake,
+	}
+}
+
+func (l *handshakeListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	conn := &handshakeConn{
+		Conn:      c,
+		handshake: l.handshake,
+	}
+	conn.tls = tls.Server(conn, l.config)
+	return conn.tls, nil
+}
+
+const (
+	handshakeIdle = iota
+	handshakeStarted
+	handshakeDone
+)
+
+// handshakeConn is the raw connection under tls.Conn. When it is closed during the handshake, the handshake
+// is reported as failed.
+type handshakeConn struct {
+	net.Conn
+	tls       *tls.Conn
+	handshake *handshakeStats
+
+	mutex sync.Mutex
+	state int
+	start time.Time
+}
+
+func (c *handshakeConn) started() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state = handshakeStarted
+	c.start = time.Now()
+}
+
+func (c *handshakeConn) finished(resumed bool) {
+	c.mutex.Lock()
+	if c.state != handshakeStarted {
+		c.mutex.Unlock()
+		return
+	}
+	c.state = handshakeDone
+	h := Handshake{
+		RemoteAddr: c.RemoteAddr(),
+		Start:      c.start,
+		Duration:   time.Since(c.start),
+		Resumed:    resumed,
+	}
+	c.mutex.Unlock()
+	c.handshake.add(h)
+}
+
+func (c *handshakeConn) Close() error {
+	err := c.Conn.Close()
+	c.mutex.Lock()
+	if c.state != handshakeStarted {
+		c.mutex.Unlock()
+		return err
+	}
+	c.state = handshakeDone
+	h := Handshake{
+		RemoteAddr: c.RemoteAddr(),
+		Start:      c.start,
+		Duration:   time.Since(c.start),
+	}
+	c.mutex.Unlock()
+	// the connection is closed, so the handshake in progress fails and the error of the handshake is returned
+	h.Err = c.tls.Handshake()
+	if h.Err == nil {
+		h.Err = errHandshakeClosed
+	}
+	h.Failure = tlsHandshakeFailure(h.Err)
+	c.handshake.add(h)
+	return err
+}
+
+// tlsHandshakeFailure classifies error of failed TLS handshake. Alerts are reported by crypto/tls
+// as net.OpError with "local error" or "remote error" operation.
+func tlsHandshakeFailure(err error) HandshakeFailure {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "local error" || opErr.Op == "remote error") {
+		return HandshakeFailureAlert
+	}
+	if err == errHandshakeClosed || strings.Contains(err.Error(), errClosedConn) {
+		return HandshakeFailureClosed
+	}
+	return handshakeFailure(err)
+}
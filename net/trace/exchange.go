@@ -0,0 +1,142 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// ExchangeID identifies messages of an exchange: the request, its retransmissions and duplicates, the blocks
+// of a blockwise transfer and the responses, so logs and traces of a multi-message exchange can be stitched
+// together. Zero is not a valid ID.
+type ExchangeID uint64
+
+var lastExchangeID uint64
+
+// NewExchangeID returns ID which is unique within the process.
+func NewExchangeID() ExchangeID {
+	return ExchangeID(atomic.AddUint64(&lastExchangeID, 1))
+}
+
+type exchangeIDKey struct{}
+
+// WithExchangeID returns copy of ctx which carries the ID. A request sent with such context keeps the ID,
+// e.g. to stitch a retry of the application with the failed exchange.
+func WithExchangeID(ctx context.Context, id ExchangeID) context.Context {
+	return context.WithValue(ctx, exchangeIDKey{}, id)
+}
+
+// ExchangeIDFromContext returns ID of the exchange of the message whose context is ctx.
+func ExchangeIDFromContext(ctx context.Context) (ExchangeID, bool) {
+	id, ok := ctx.Value(exchangeIDKey{}).(ExchangeID)
+	return id, ok
+}
+
+// exchangeKey is token or message ID of a message of the exchange. Message IDs of sent and received messages
+// are chosen by different endpoints, so they are distinguished.
+type exchangeKey struct {
+	token    string
+	mid      uint16
+	hasMID   bool
+	sentByMe bool
+}
+
+type exchangeEntry struct {
+	id      ExchangeID
+	expires time.Time
+}
+
+// Exchanges maps tokens and message IDs of a connection to IDs of their exchanges, e.g. to find exchange
+// of an empty acknowledgement. An entry expires after lifetime without a message, e.g. EXCHANGE_LIFETIME,
+// so late retransmissions and duplicates get the ID of their exchange.
+//
+// Multiple goroutines may invoke methods on Exchanges simultaneously.
+type Exchanges struct {
+	lifetime  time.Duration
+	mutex     sync.Mutex
+	entries   map[exchangeKey]exchangeEntry
+	lastSweep time.Time
+}
+
+// NewExchanges creates mapping whose entries expire after lifetime.
+func NewExchanges(lifetime time.Duration) *Exchanges {
+	return &Exchanges{
+		lifetime:  lifetime,
+		entries:   make(map[exchangeKey]exchangeEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Get returns ID of the exchange of the token, a new exchange is started when there is none.
+func (e *Exchanges) Get(token message.Token) ExchangeID {
+	key := exchangeKey{token: string(token)}
+	now := time.Now()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	entry, ok := e.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		e.sweep(now)
+		entry.id = NewExchangeID()
+	}
+	entry.expires = now.Add(e.lifetime)
+	e.entries[key] = entry
+	return entry.id
+}
+
+// Lookup returns ID of the exchange of the token without starting a new one.
+func (e *Exchanges) Lookup(token message.Token) (ExchangeID, bool) {
+	return e.lookup(exchangeKey{token: string(token)})
+}
+
+// Set assigns the token to the exchange, e.g. when a blockwise transfer continues by a request with a new token.
+func (e *Exchanges) Set(token message.Token, id ExchangeID) {
+	e.set(exchangeKey{token: string(token)}, id)
+}
+
+// SetMessageID assigns the message ID to the exchange. Sent reports whether the message was sent by the connection.
+func (e *Exchanges) SetMessageID(mid uint16, sent bool, id ExchangeID) {
+	e.set(exchangeKey{mid: mid, hasMID: true, sentByMe: sent}, id)
+}
+
+// LookupMessageID returns ID of the exchange of the message ID, e.g. of an acknowledgement of the message which
+// was sent by the connection when sent is set.
+func (e *Exchanges) LookupMessageID(mid uint16, sent bool) (ExchangeID, bool) {
+	return e.lookup(exchangeKey{mid: mid, hasMID: true, sentByMe: sent})
+}
+
+func (e *Exchanges) lookup(key exchangeKey) (ExchangeID, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	entry, ok := e.entries[key]
+	if !ok || !time.Now().Before(entry.expires) {
+		return 0, false
+	}
+	return entry.id, true
+}
+
+func (e *Exchanges) set(key exchangeKey, id ExchangeID) {
+	now := time.Now()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.sweep(now)
+	e.entries[key] = exchangeEntry{
+		id:      id,
+		expires: now.Add(e.lifetime),
+	}
+}
+
+// sweep removes expired entries at most once per lifetime.
+func (e *Exchanges) sweep(now time.Time) {
+	if now.Sub(e.lastSweep) < e.lifetime {
+		return
+	}
+	e.lastSweep = now
+	for key, entry := range e.entries {
+		if !now.Before(entry.expires) {
+			delete(e.entries, key)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package trace defines events of messages of a connection, e.g. to create OpenTelemetry spans
+// or to debug a connection at the wire level without intercepting the socket.
+package trace
+
+import (
+	"net"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+)
+
+// EventType is type of the event.
+type EventType uint8
+
+const (
+	// MessageSent is emitted when a message was written to the connection.
+	MessageSent EventType = iota + 1
+	// MessageReceived is emitted when a message was read from the connection and parsed.
+	MessageReceived
+	// Retransmit is emitted before a confirmable message is retransmitted or a non-confirmable request is retried.
+	Retransmit
+	// DuplicateDropped is emitted when a duplicate request is not passed to the handler and the cached response
+	// is sent again.
+	DuplicateDropped
+	// BlockwiseStep is emitted for each sent or received message with Block1 or Block2 option.
+	BlockwiseStep
+	// ExchangeFinished is emitted when the response of a request sent by the connection is received. Elapsed is
+	// time since the request was sent.
+	ExchangeFinished
+	// ObservationRegistered is emitted when an observation of the peer was accepted by the response.
+	ObservationRegistered
+	// ObservationDeregistered is emitted when an observation of the peer was deregistered.
+	ObservationDeregistered
+	// SessionStarted is emitted when a server creates connection of a new peer or a client dials the connection.
+	SessionStarted
+	// SessionClosed is emitted when the connection is closed.
+	SessionClosed
+)
+
+var eventTypeToString = map[EventType]string{
+	MessageSent:             "MessageSent",
+	MessageReceived:         "MessageReceived",
+	Retransmit:              "Retransmit",
+	DuplicateDropped:        "DuplicateDropped",
+	BlockwiseStep:           "BlockwiseStep",
+	ExchangeFinished:        "ExchangeFinished",
+	ObservationRegistered:   "ObservationRegistered",
+	ObservationDeregistered: "ObservationDeregistered",
+	SessionStarted:          "SessionStarted",
+	SessionClosed:           "SessionClosed",
+}
+
+func (t EventType) String() string {
+	val, ok := eventTypeToString[t]
+	if ok {
+		return val
+	}
+	return "Unknown"
+}
+
+// Block describes the block of BlockwiseStep event.
+type Block struct {
+	// Option is message.Block1 or message.Block2.
+	Option message.OptionID
+	Num    int64
+	More   bool
+	SZX    blockwise.SZX
+	// Sent is set when the block was sent, otherwise it was received.
+	Sent bool
+}
+
+// Event is a traced event of a message.
+type Event struct {
+	Type EventType
+	// Message is the parsed message. It is valid only during the call of the handler, it is nil for SessionStarted
+	// and SessionClosed.
+	Message *pool.Message
+	// MessageID is message ID of UDP or DTLS message, -1 for TCP or when it is not assigned yet.
+	MessageID int32
+	// MessageType is type of UDP or DTLS message, e.g. "Confirmable", empty for TCP.
+	MessageType string
+	RemoteAddr  net.Addr
+	// Time when the event occurred.
+	Time time.Time
+	// Retransmission is number of the retransmission of Retransmit event.
+	Retransmission int
+	// Elapsed is time since the first transmission of Retransmit event.
+	Elapsed time.Duration
+	// Block is set for BlockwiseStep event.
+	Block Block
+	// ExchangeID identifies the exchange of the message, it is zero when the exchange isn't known, e.g. for empty
+	// acknowledgements.
+	ExchangeID ExchangeID
+}
+
+// Handler is called with traced events. It is called synchronously, so it must not block.
+type Handler = func(e Event)
+
+// Emit calls h with the event and, when the sent or received message carries Block1 or Block2 option,
+// with BlockwiseStep events.
+func Emit(h Handler, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	h(e)
+	if e.Type != MessageSent && e.Type != MessageReceived {
+		return
+	}
+	for _, id := range []message.OptionID{message.Block1, message.Block2} {
+		v, err := e.Message.GetOptionUint32(id)
+		if err != nil {
+			continue
+		}
+		szx, num, more, err := blockwise.DecodeBlockOption(v)
+		if err != nil {
+			continue
+		}
+		step := e
+		step.Type = BlockwiseStep
+		step.Block = Block{
+			Option: id,
+			Num:    num,
+			More:   more,
+			SZX:    szx,
+			Sent:   e.Type == MessageSent,
+		}
+		h(step)
+	}
+}
+
+// EmitSession calls h with SessionStarted or SessionClosed event of the connection, nil h is ignored.
+func EmitSession(h Handler, typ EventType, raddr net.Addr) {
+	if h == nil {
+		return
+	}
+	Emit(h, Event{
+		Type:       typ,
+		MessageID:  -1,
+		RemoteAddr: raddr,
+	})
+}
@@ -0,0 +1,182 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Transport carries CoAP messages of one connection, one message per ReadMessage and WriteMessage. Implement it to
+// reuse client and server machinery over a custom transport, e.g. serial line, BLE GATT or an in-memory pipe in tests.
+//
+// Multiple goroutines may invoke methods on a Transport simultaneously.
+type Transport interface {
+	// ReadMessage reads one message to the buffer and returns its size. It returns an error when ctx is done.
+	ReadMessage(ctx context.Context, buffer []byte) (int, error)
+	// WriteMessage writes one message.
+	WriteMessage(ctx context.Context, data []byte) error
+	// Close closes the transport.
+	Close() error
+	// RemoteAddr returns address of the peer.
+	RemoteAddr() net.Addr
+	// Done is closed when the transport is closed.
+	Done() <-chan struct{}
+}
+
+// closer closes done channel of a transport once.
+type closer struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func newCloser() closer {
+	return closer{done: make(chan struct{})}
+}
+
+func (c *closer) close(f func() error) error {
+	var err error
+	c.once.Do(func() {
+		defer close(c.done)
+		if f != nil {
+			err = f()
+		}
+	})
+	return err
+}
+
+type connTransport struct {
+	conn *Conn
+	closer
+}
+
+// NewConnTransport creates transport over a message-oriented connection, e.g. DTLS, which delivers one message
+// per read.
+func NewConnTransport(c *Conn) Transport {
+	return &connTransport{
+		conn:   c,
+		closer: newCloser(),
+	}
+}
+
+func (t *connTransport) ReadMessage(ctx context.Context, buffer []byte) (int, error) {
+	return t.conn.ReadWithContext(ctx, buffer)
+}
+
+func (t *connTransport) WriteMessage(ctx context.Context, data []byte) error {
+	return t.conn.WriteWithContext(ctx, data)
+}
+
+func (t *connTransport) Close() error {
+	return t.close(t.conn.Close)
+}
+
+func (t *connTransport) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+func (t *connTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// FrameFunc returns length of the message at the start of data of a stream, 0 when data is too short to determine it.
+type FrameFunc = func(data []byte) (int, error)
+
+type streamTransport struct {
+	conn   *Conn
+	frame  FrameFunc
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	closer
+}
+
+// NewStreamTransport creates transport over a stream connection, e.g. TCP or TLS, whose messages are delimited
+// by frame. When the buffer of ReadMessage is shorter than the message, it returns io.ErrShortBuffer and keeps
+// the message for the next read.
+func NewStreamTransport(c *Conn, frame FrameFunc) Transport {
+	return &streamTransport{
+		conn:   c,
+		frame:  frame,
+		closer: newCloser(),
+	}
+}
+
+func (t *streamTransport) ReadMessage(ctx context.Context, buffer []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	readBuf := make([]byte, 1024)
+	for {
+		if t.buffer.Len() > 0 {
+			n, err := t.frame(t.buffer.Bytes())
+			if err != nil {
+				return 0, err
+			}
+			if n > len(buffer) {
+				return 0, fmt.Errorf("message of %v bytes: %w", n, io.ErrShortBuffer)
+			}
+			if n > 0 && t.buffer.Len() >= n {
+				return t.buffer.Read(buffer[:n])
+			}
+		}
+		readLen, err := t.conn.ReadWithContext(ctx, readBuf)
+		if err != nil {
+			return 0, err
+		}
+		t.buffer.Write(readBuf[:readLen])
+	}
+}
+
+func (t *streamTransport) WriteMessage(ctx context.Context, data []byte) error {
+	return t.conn.WriteWithContext(ctx, data)
+}
+
+func (t *streamTransport) Close() error {
+	return t.close(t.conn.Close)
+}
+
+func (t *streamTransport) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+func (t *streamTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+type udpTransport struct {
+	conn  *UDPConn
+	raddr *net.UDPAddr
+	closer
+}
+
+// NewUDPTransport creates transport which writes messages to raddr by the socket. It reads messages
+// from all peers of the socket.
+func NewUDPTransport(c *UDPConn, raddr *net.UDPAddr) Transport {
+	return &udpTransport{
+		conn:   c,
+		raddr:  raddr,
+		closer: newCloser(),
+	}
+}
+
+func (t *udpTransport) ReadMessage(ctx context.Context, buffer []byte) (int, error) {
+	n, _, err := t.conn.ReadWithContext(ctx, buffer)
+	return n, err
+}
+
+func (t *udpTransport) WriteMessage(ctx context.Context, data []byte) error {
+	return t.conn.WriteWithContext(ctx, t.raddr, data)
+}
+
+func (t *udpTransport) Close() error {
+	return t.close(t.conn.Close)
+}
+
+func (t *udpTransport) RemoteAddr() net.Addr {
+	return t.raddr
+}
+
+func (t *udpTransport) Done() <-chan struct{} {
+	return t.done
+}
@@ -0,0 +1,38 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTransport_ReadMessage(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	// messages are prefixed by their length
+	tr := NewStreamTransport(NewConn(c1), func(data []byte) (int, error) {
+		return 1 + int(data[0]), nil
+	})
+	defer tr.Close()
+	go func() {
+		// messages are split and coalesced by the stream
+		_, _ = c2.Write([]byte{3, 'a'})
+		_, _ = c2.Write([]byte{'b', 'c', 2, 'd', 'e', 5, 'f'})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	buf := make([]byte, 4)
+	n, err := tr.ReadMessage(ctx, buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{3, 'a', 'b', 'c'}, buf[:n])
+	n, err = tr.ReadMessage(ctx, buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2, 'd', 'e'}, buf[:n])
+	_, err = tr.ReadMessage(ctx, buf)
+	require.ErrorIs(t, err, io.ErrShortBuffer)
+}
@@ -0,0 +1,107 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// UnixListener is a Unix domain socket listener that provides accept with context, e.g. for local IPC
+// of processes on a gateway. Messages are framed as over TCP.
+type UnixListener struct {
+	listener  *net.UnixListener
+	heartBeat time.Duration
+	closed    uint32
+	onTimeout func() error
+}
+
+var defaultUnixListenerOptions = unixListenerOptions{
+	heartBeat: time.Millisecond * 200,
+}
+
+type unixListenerOptions struct {
+	heartBeat time.Duration
+	onTimeout func() error
+}
+
+// A UnixListenerOption sets options such as heartBeat parameters, etc.
+type UnixListenerOption interface {
+	applyUnixListener(*unixListenerOptions)
+}
+
+// NewUnixListener creates unix listener. The socket file is removed when the listener is closed.
+// Known network is "unix".
+func NewUnixListener(network string, addr string, opts ...UnixListenerOption) (*UnixListener, error) {
+	cfg := defaultUnixListenerOptions
+	for _, o := range opts {
+		o.applyUnixListener(&cfg)
+	}
+	a, err := net.ResolveUnixAddr(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new unix listener: %w", err)
+	}
+	unix, err := net.ListenUnix(network, a)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new unix listener: %w", err)
+	}
+	return &UnixListener{listener: unix, heartBeat: cfg.heartBeat, onTimeout: cfg.onTimeout}, nil
+}
+
+// AcceptWithContext waits with context for a generic Conn.
+func (l *UnixListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if atomic.LoadUint32(&l.closed) == 1 {
+			return nil, ErrListenerIsClosed
+		}
+		deadline := time.Now().Add(l.heartBeat)
+		err := l.SetDeadline(deadline)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set deadline to accept connection: %w", err)
+		}
+		rw, err := l.listener.Accept()
+		if err != nil {
+			// check context in regular intervals and then resume listening
+			if isTemporary(err, deadline) {
+				if l.onTimeout != nil {
+					err := l.onTimeout()
+					if err != nil {
+						return nil, fmt.Errorf("cannot accept connection : on timeout returns error: %w", err)
+					}
+				}
+				continue
+			}
+			return nil, fmt.Errorf("cannot accept connection: %w", err)
+		}
+		return rw, nil
+	}
+}
+
+// SetDeadline sets deadline for accept operation.
+func (l *UnixListener) SetDeadline(t time.Time) error {
+	return l.listener.SetDeadline(t)
+}
+
+// Accept waits for a generic Conn.
+func (l *UnixListener) Accept() (net.Conn, error) {
+	return l.AcceptWithContext(context.Background())
+}
+
+// Close closes the connection.
+func (l *UnixListener) Close() error {
+	if !atomic.CompareAndSwapUint32(&l.closed, 0, 1) {
+		return nil
+	}
+	return l.listener.Close()
+}
+
+// Addr represents a network end point address.
+func (l *UnixListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
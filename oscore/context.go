@@ -0,0 +1,264 @@
+// Package oscore implements Object Security for Constrained RESTful Environments (RFC 8613).
+//
+// OSCORE protects code, options and payload of a CoAP message end-to-end, so the message
+// can pass through proxies. The security context is derived from a master secret shared
+// by both endpoints. AES-CCM-16-64-128 is used as AEAD algorithm and HKDF SHA-256 as key
+// derivation function.
+package oscore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pion/dtls/v3/pkg/crypto/ccm"
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// algAESCCM16_64_128 is COSE identifier of AES-CCM-16-64-128.
+	algAESCCM16_64_128 = 10
+	keyLength          = 16
+	nonceLength        = 13
+	tagLength          = 8
+	// maxIDLength is maximal length of sender and recipient ID for the nonce length.
+	maxIDLength = nonceLength - 6
+	// maxSequenceNumber is maximal sender sequence number, so partial IV fits into 5 bytes.
+	maxSequenceNumber = 1<<40 - 1
+	// DefaultReplayWindow is default size of the replay window.
+	DefaultReplayWindow = 32
+)
+
+// Params are input parameters of a security context (RFC 8613 section 3.2).
+type Params struct {
+	// MasterSecret is the secret shared by both endpoints. It is required.
+	MasterSecret []byte
+	// MasterSalt is optional salt of the key derivation.
+	MasterSalt []byte
+	// SenderID identifies the local endpoint. It is the recipient ID of the remote endpoint.
+	SenderID []byte
+	// RecipientID identifies the remote endpoint. It is the sender ID of the remote endpoint.
+	RecipientID []byte
+	// IDContext is optional identifier of the security context.
+	IDContext []byte
+	// SenderSequenceNumber is the first sequence number used to protect messages. It allows
+	// to continue with a persisted sequence number after restart (RFC 8613 appendix B.1).
+	SenderSequenceNumber uint64
+	// ReplayWindow is number of recently received sequence numbers which are accepted out of order.
+	// Zero means DefaultReplayWindow.
+	ReplayWindow int
+}
+
+// Context is OSCORE security context which holds the keys derived from Params together with
+// the sender sequence number and the replay window of the recipient.
+//
+// Multiple goroutines may invoke methods on a Context simultaneously.
+type Context struct {
+	senderID    []byte
+	recipientID []byte
+	idContext   []byte
+	commonIV    []byte
+	sender      cipher.AEAD
+	recipient   cipher.AEAD
+
+	mutex     sync.Mutex
+	senderSeq uint64
+	replay    replayWindow
+}
+
+// NewContext derives security context from params.
+func NewContext(params Params) (*Context, error) {
+	if len(params.MasterSecret) == 0 {
+		return nil, fmt.Errorf("invalid master secret")
+	}
+	if len(params.SenderID) > maxIDLength {
+		return nil, fmt.Errorf("invalid sender id: length %v exceeds %v", len(params.SenderID), maxIDLength)
+	}
+	if len(params.RecipientID) > maxIDLength {
+		return nil, fmt.Errorf("invalid recipient id: length %v exceeds %v", len(params.RecipientID), maxIDLength)
+	}
+	if bytes.Equal(params.SenderID, params.RecipientID) {
+		return nil, fmt.Errorf("sender id and recipient id must differ")
+	}
+	if params.SenderSequenceNumber > maxSequenceNumber {
+		return nil, fmt.Errorf("invalid sender sequence number")
+	}
+	if params.ReplayWindow <= 0 {
+		params.ReplayWindow = DefaultReplayWindow
+	}
+	if params.ReplayWindow > 64 {
+		return nil, fmt.Errorf("invalid replay window: %v exceeds 64", params.ReplayWindow)
+	}
+	senderKey, err := derive(params, params.SenderID, "Key", keyLength)
+	if err != nil {
+		return nil, err
+	}
+	recipientKey, err := derive(params, params.RecipientID, "Key", keyLength)
+	if err != nil {
+		return nil, err
+	}
+	commonIV, err := derive(params, []byte{}, "IV", nonceLength)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := newAEAD(senderKey)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := newAEAD(recipientKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Context{
+		senderID:    append([]byte{}, params.SenderID...),
+		recipientID: append([]byte{}, params.RecipientID...),
+		idContext:   append([]byte(nil), params.IDContext...),
+		commonIV:    commonIV,
+		sender:      sender,
+		recipient:   recipient,
+		senderSeq:   params.SenderSequenceNumber,
+		replay: replayWindow{
+			size: uint64(params.ReplayWindow),
+		},
+	}, nil
+}
+
+// derive derives key or IV for id (RFC 8613 section 3.2.1).
+func derive(params Params, id []byte, typ string, length int) ([]byte, error) {
+	info := cbor.AppendArray(nil, 5)
+	info = cbor.AppendBytes(info, id)
+	info = cbor.AppendBytesOrNull(info, params.IDContext)
+	info = cbor.AppendUint(info, algAESCCM16_64_128)
+	info = cbor.AppendText(info, typ)
+	info = cbor.AppendUint(info, uint64(length))
+	out := make([]byte, length)
+	_, err := io.ReadFull(hkdf.New(sha256.New, params.MasterSecret, params.MasterSalt, info), out)
+	if err != nil {
+		return nil, fmt.Errorf("cannot derive %v: %w", typ, err)
+	}
+	return out, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cipher: %w", err)
+	}
+	aead, err := ccm.NewCCM(block, tagLength, nonceLength)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// SenderSequenceNumber returns the next sender sequence number, e.g. to persist it.
+func (c *Context) SenderSequenceNumber() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.senderSeq
+}
+
+func (c *Context) nextSequenceNumber() ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.senderSeq > maxSequenceNumber {
+		return nil, ErrSequenceNumberExhausted
+	}
+	seq := c.senderSeq
+	c.senderSeq++
+	return encodePartialIV(seq), nil
+}
+
+// nonce computes AEAD nonce for id and partial IV (RFC 8613 section 5.2).
+func (c *Context) nonce(id, piv []byte) []byte {
+	nonce := make([]byte, nonceLength)
+	nonce[0] = byte(len(id))
+	copy(nonce[1+maxIDLength-len(id):], id)
+	copy(nonce[nonceLength-len(piv):], piv)
+	for i := range nonce {
+		nonce[i] ^= c.commonIV[i]
+	}
+	return nonce
+}
+
+// encodePartialIV encodes sequence number to the shortest big-endian form, zero is encoded as one byte.
+func encodePartialIV(seq uint64) []byte {
+	piv := make([]byte, 0, 5)
+	for shift := 32; shift > 0; shift -= 8 {
+		if seq>>uint(shift) != 0 || len(piv) > 0 {
+			piv = append(piv, byte(seq>>uint(shift)))
+		}
+	}
+	return append(piv, byte(seq))
+}
+
+func decodePartialIV(piv []byte) uint64 {
+	var seq uint64
+	for _, b := range piv {
+		seq = seq<<8 | uint64(b)
+	}
+	return seq
+}
+
+// replayWindow is sliding window of received sequence numbers (RFC 8613 section 7.4).
+type replayWindow struct {
+	size     uint64
+	received bool
+	highest  uint64
+	bitmap   uint64
+}
+
+// check returns ErrReplay when seq was already received or is too old.
+func (w *replayWindow) check(seq uint64) error {
+	if !w.received || seq > w.highest {
+		return nil
+	}
+	diff := w.highest - seq
+	if diff >= w.size || w.bitmap&(1<<diff) != 0 {
+		return ErrReplay
+	}
+	return nil
+}
+
+func (w *replayWindow) accept(seq uint64) {
+	if !w.received {
+		w.received = true
+		w.highest = seq
+		w.bitmap = 1
+		return
+	}
+	if seq > w.highest {
+		shift := seq - w.highest
+		if shift >= 64 {
+			w.bitmap = 0
+		} else {
+			w.bitmap <<= shift
+		}
+		w.bitmap |= 1
+		w.highest = seq
+		return
+	}
+	w.bitmap |= 1 << (w.highest - seq)
+}
+
+func (c *Context) checkReplay(seq uint64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.replay.check(seq)
+}
+
+// acceptReplay records seq of verified request. It fails when the same request was verified concurrently.
+func (c *Context) acceptReplay(seq uint64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.replay.check(seq); err != nil {
+		return err
+	}
+	c.replay.accept(seq)
+	return nil
+}
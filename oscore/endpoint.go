@@ -0,0 +1,114 @@
+package oscore
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+)
+
+// exchangeLifetime is how long binding of a request without observe is kept (RFC 7252 EXCHANGE_LIFETIME).
+const exchangeLifetime = 247 * time.Second
+
+// Endpoint protects messages exchanged with one remote endpoint. It keeps bindings of requests
+// by token, so their responses and notifications are protected with the request's partial IV.
+//
+// Multiple goroutines may invoke methods on an Endpoint simultaneously.
+type Endpoint struct {
+	ctx      *Context
+	bindings *cache.Cache
+}
+
+// NewEndpoint creates endpoint which protects messages by the security context. The context
+// can be shared by endpoints.
+func NewEndpoint(ctx *Context) *Endpoint {
+	return &Endpoint{
+		ctx:      ctx,
+		bindings: cache.New(exchangeLifetime, 60*time.Second),
+	}
+}
+
+// Context returns security context of the endpoint.
+func (e *Endpoint) Context() *Context {
+	return e.ctx
+}
+
+func (e *Endpoint) storeBinding(token message.Token, b *Binding) {
+	if b.Observe() {
+		e.bindings.Set(string(token), b, cache.NoExpiration)
+		return
+	}
+	e.bindings.SetDefault(string(token), b)
+}
+
+func (e *Endpoint) loadBinding(token message.Token) (*Binding, bool) {
+	v, ok := e.bindings.Get(string(token))
+	if !ok {
+		return nil, false
+	}
+	return v.(*Binding), true
+}
+
+// Protect encrypts outgoing msg in place. Requests are protected by a new partial IV, responses are
+// protected for their requests. Empty messages are not protected.
+func (e *Endpoint) Protect(msg *pool.Message) error {
+	switch {
+	case msg.Code() == codes.Empty:
+		return nil
+	case isRequest(msg.Code()):
+		b, err := e.ctx.ProtectRequest(msg)
+		if err != nil {
+			return err
+		}
+		e.storeBinding(msg.Token(), b)
+		return nil
+	}
+	b, ok := e.loadBinding(msg.Token())
+	if !ok {
+		return ErrRequestNotFound
+	}
+	notification := msg.HasOption(message.Observe)
+	err := e.ctx.ProtectResponse(msg, b)
+	if err != nil {
+		return err
+	}
+	if !notification {
+		// the exchange or the observation is finished
+		e.bindings.Delete(string(msg.Token()))
+	}
+	return nil
+}
+
+// Unprotect verifies and decrypts incoming msg in place. Unprotected requests are rejected by ErrUnprotected,
+// see ErrorCode for code of the response. Empty messages and unprotected responses to unprotected requests
+// are passed as they are.
+func (e *Endpoint) Unprotect(msg *pool.Message) error {
+	switch {
+	case msg.Code() == codes.Empty:
+		return nil
+	case isRequest(msg.Code()):
+		b, err := e.ctx.UnprotectRequest(msg)
+		if err != nil {
+			return err
+		}
+		e.storeBinding(msg.Token(), b)
+		return nil
+	}
+	b, ok := e.loadBinding(msg.Token())
+	if !ok {
+		if msg.HasOption(message.OSCORE) {
+			return ErrRequestNotFound
+		}
+		return nil
+	}
+	err := e.ctx.UnprotectResponse(msg, b)
+	if err != nil {
+		return err
+	}
+	if !msg.HasOption(message.Observe) {
+		e.bindings.Delete(string(msg.Token()))
+	}
+	return nil
+}
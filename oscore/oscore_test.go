@@ -0,0 +1,195 @@
+package oscore_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	v, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return v
+}
+
+// test vectors of RFC 8613 appendix C.1.1
+func newRFCContexts(t *testing.T, clientSeq, serverSeq uint64) (client *oscore.Context, server *oscore.Context) {
+	secret := mustDecodeHex(t, "0102030405060708090a0b0c0d0e0f10")
+	salt := mustDecodeHex(t, "9e7ca92223786340")
+	client, err := oscore.NewContext(oscore.Params{
+		MasterSecret:         secret,
+		MasterSalt:           salt,
+		SenderID:             []byte{},
+		RecipientID:          []byte{0x01},
+		SenderSequenceNumber: clientSeq,
+	})
+	require.NoError(t, err)
+	server, err = oscore.NewContext(oscore.Params{
+		MasterSecret:         secret,
+		MasterSalt:           salt,
+		SenderID:             []byte{0x01},
+		RecipientID:          []byte{},
+		SenderSequenceNumber: serverSeq,
+	})
+	require.NoError(t, err)
+	return client, server
+}
+
+func TestContext_ProtectRequest_RFC8613(t *testing.T) {
+	client, server := newRFCContexts(t, 20, 0)
+
+	// C.4: GET coap://localhost/tv1
+	req := pool.NewMessage()
+	req.SetCode(codes.GET)
+	req.SetToken(mustDecodeHex(t, "00003974"))
+	req.SetOptionString(message.URIHost, "localhost")
+	req.SetPath("/tv1")
+	b, err := client.ProtectRequest(req)
+	require.NoError(t, err)
+	require.Equal(t, codes.POST, req.Code())
+	host, err := req.Options().GetString(message.URIHost)
+	require.NoError(t, err)
+	require.Equal(t, "localhost", host)
+	require.False(t, req.HasOption(message.URIPath))
+	opt, err := req.GetOptionBytes(message.OSCORE)
+	require.NoError(t, err)
+	require.Equal(t, mustDecodeHex(t, "0914"), opt)
+	ciphertext, err := req.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, mustDecodeHex(t, "612f1092f1776f1c1668b3825e"), ciphertext)
+	require.Equal(t, uint64(21), client.SenderSequenceNumber())
+
+	sb, err := server.UnprotectRequest(req)
+	require.NoError(t, err)
+	require.Equal(t, codes.GET, req.Code())
+	path, err := req.Path()
+	require.NoError(t, err)
+	require.Equal(t, "tv1", path)
+	require.False(t, req.HasOption(message.OSCORE))
+
+	// C.7: 2.05 Content "Hello World!"
+	resp := pool.NewMessage()
+	resp.SetCode(codes.Content)
+	resp.SetToken(mustDecodeHex(t, "00003974"))
+	resp.SetBody(bytes.NewReader([]byte("Hello World!")))
+	err = server.ProtectResponse(resp, sb)
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	opt, err = resp.GetOptionBytes(message.OSCORE)
+	require.NoError(t, err)
+	require.Empty(t, opt)
+	ciphertext, err = resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, mustDecodeHex(t, "dbaad1e9a7e7b2a813d3c31524378303cdafae119106"), ciphertext)
+
+	err = client.UnprotectResponse(resp, b)
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	payload, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("Hello World!"), payload)
+}
+
+func TestContext_UnprotectRequest_Replay(t *testing.T) {
+	client, server := newRFCContexts(t, 0, 0)
+	for i := 0; i < 2; i++ {
+		req := pool.NewMessage()
+		req.SetCode(codes.PUT)
+		req.SetPath("/a")
+		_, err := client.ProtectRequest(req)
+		require.NoError(t, err)
+		dup := pool.NewMessage()
+		dup.SetCode(req.Code())
+		dup.ResetOptionsTo(req.Options())
+		dup.SetBody(req.Body())
+
+		_, err = server.UnprotectRequest(req)
+		require.NoError(t, err)
+		_, err = server.UnprotectRequest(dup)
+		require.ErrorIs(t, err, oscore.ErrReplay)
+		require.Equal(t, codes.Unauthorized, oscore.ErrorCode(err))
+	}
+}
+
+func TestContext_UnprotectRequest_Tampered(t *testing.T) {
+	client, server := newRFCContexts(t, 0, 0)
+	req := pool.NewMessage()
+	req.SetCode(codes.GET)
+	req.SetPath("/a")
+	_, err := client.ProtectRequest(req)
+	require.NoError(t, err)
+	ciphertext, err := req.ReadBody()
+	require.NoError(t, err)
+	ciphertext[0] ^= 0xff
+	req.SetBody(bytes.NewReader(ciphertext))
+	_, err = server.UnprotectRequest(req)
+	require.ErrorIs(t, err, oscore.ErrDecryption)
+	require.Equal(t, codes.BadRequest, oscore.ErrorCode(err))
+
+	// the other endpoint uses different key
+	other, err := oscore.NewContext(oscore.Params{
+		MasterSecret: []byte("secret"),
+		SenderID:     []byte{0x02},
+		RecipientID:  []byte{0x03},
+	})
+	require.NoError(t, err)
+	req = pool.NewMessage()
+	req.SetCode(codes.GET)
+	_, err = other.ProtectRequest(req)
+	require.NoError(t, err)
+	_, err = server.UnprotectRequest(req)
+	require.ErrorIs(t, err, oscore.ErrContextNotFound)
+}
+
+func TestEndpoint_Observe(t *testing.T) {
+	clientCtx, serverCtx := newRFCContexts(t, 0, 0)
+	client := oscore.NewEndpoint(clientCtx)
+	server := oscore.NewEndpoint(serverCtx)
+	token := []byte{1, 2, 3}
+
+	req := pool.NewMessage()
+	req.SetCode(codes.GET)
+	req.SetToken(token)
+	req.SetPath("/obs")
+	req.SetObserve(0)
+	require.NoError(t, client.Protect(req))
+	require.Equal(t, codes.FETCH, req.Code())
+	obs, err := req.Observe()
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), obs)
+	require.NoError(t, server.Unprotect(req))
+
+	notifications := make([]*pool.Message, 0, 3)
+	for i := 0; i < 3; i++ {
+		n := pool.NewMessage()
+		n.SetCode(codes.Content)
+		n.SetToken(token)
+		n.SetObserve(uint32(i + 2))
+		n.SetBody(bytes.NewReader([]byte{byte(i)}))
+		require.NoError(t, server.Protect(n))
+		notifications = append(notifications, n)
+	}
+	require.NoError(t, client.Unprotect(notifications[0]))
+	require.NoError(t, client.Unprotect(notifications[2]))
+	payload, err := notifications[2].ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, payload)
+	// older notification is rejected
+	require.ErrorIs(t, client.Unprotect(notifications[1]), oscore.ErrReplay)
+
+	unprotected := pool.NewMessage()
+	unprotected.SetCode(codes.GET)
+	unprotected.SetPath("/obs")
+	require.ErrorIs(t, server.Unprotect(unprotected), oscore.ErrUnprotected)
+
+	resp := pool.NewMessage()
+	resp.SetCode(codes.Content)
+	resp.SetToken([]byte{9})
+	require.ErrorIs(t, server.Protect(resp), oscore.ErrRequestNotFound)
+}
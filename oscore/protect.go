@@ -0,0 +1,384 @@
+package oscore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/cbor"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+)
+
+const (
+	flagKIDContext = 0x10
+	flagKID        = 0x08
+	flagsPIVLength = 0x07
+	flagsReserved  = 0xe0
+	payloadMarker  = 0xff
+)
+
+var (
+	// ErrUnprotected is returned when a message is not protected by OSCORE.
+	ErrUnprotected = errors.New("message is not protected")
+	// ErrContextNotFound is returned when a request is protected by an unknown security context.
+	ErrContextNotFound = errors.New("security context not found")
+	// ErrReplay is returned when a request with the same sequence number was already received.
+	ErrReplay = errors.New("replay detected")
+	// ErrDecryption is returned when a message cannot be decrypted or verified.
+	ErrDecryption = errors.New("decryption failed")
+	// ErrInvalidOption is returned when OSCORE option of a message cannot be parsed.
+	ErrInvalidOption = errors.New("invalid OSCORE option")
+	// ErrRequestNotFound is returned when a protected response doesn't match any protected request.
+	ErrRequestNotFound = errors.New("request of the response not found")
+	// ErrSequenceNumberExhausted is returned when all sender sequence numbers were used. The security
+	// context must be renewed.
+	ErrSequenceNumberExhausted = errors.New("sender sequence number exhausted")
+)
+
+// ErrorCode returns code of the error response which is sent when verification of a request fails
+// (RFC 8613 section 8.2).
+func ErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, ErrInvalidOption):
+		return codes.BadOption
+	case errors.Is(err, ErrUnprotected), errors.Is(err, ErrContextNotFound), errors.Is(err, ErrReplay):
+		return codes.Unauthorized
+	}
+	return codes.BadRequest
+}
+
+// classU contains options which are not protected, so proxies can process them.
+var classU = map[message.OptionID]bool{
+	message.URIHost:     true,
+	message.URIPort:     true,
+	message.ProxyURI:    true,
+	message.ProxyScheme: true,
+}
+
+// Binding binds a response to its request, so the response is protected with the request's partial IV.
+type Binding struct {
+	kid     []byte
+	piv     []byte
+	observe bool
+
+	mutex        sync.Mutex
+	notification uint64
+	notified     bool
+}
+
+// Observe signals that the request registered an observation.
+func (b *Binding) Observe() bool {
+	return b.observe
+}
+
+// checkNotification verifies that notifications are received in order (RFC 8613 section 7.4.1).
+func (b *Binding) checkNotification(seq uint64) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.notified && seq <= b.notification {
+		return ErrReplay
+	}
+	b.notified = true
+	b.notification = seq
+	return nil
+}
+
+type oscoreOption struct {
+	piv        []byte
+	kidContext []byte
+	kid        []byte
+	hasKID     bool
+}
+
+func (o oscoreOption) marshal() []byte {
+	var flags byte
+	flags |= byte(len(o.piv))
+	if o.kidContext != nil {
+		flags |= flagKIDContext
+	}
+	if o.hasKID {
+		flags |= flagKID
+	}
+	if flags == 0 {
+		return []byte{}
+	}
+	buf := make([]byte, 0, 1+len(o.piv)+1+len(o.kidContext)+len(o.kid))
+	buf = append(buf, flags)
+	buf = append(buf, o.piv...)
+	if o.kidContext != nil {
+		buf = append(buf, byte(len(o.kidContext)))
+		buf = append(buf, o.kidContext...)
+	}
+	return append(buf, o.kid...)
+}
+
+func (o *oscoreOption) unmarshal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	flags := data[0]
+	data = data[1:]
+	n := int(flags & flagsPIVLength)
+	if flags&flagsReserved != 0 || n > 5 || len(data) < n {
+		return ErrInvalidOption
+	}
+	o.piv = data[:n]
+	data = data[n:]
+	if flags&flagKIDContext != 0 {
+		if len(data) == 0 || len(data) < 1+int(data[0]) {
+			return ErrInvalidOption
+		}
+		o.kidContext = data[1 : 1+int(data[0])]
+		data = data[1+int(data[0]):]
+	}
+	if flags&flagKID != 0 {
+		o.hasKID = true
+		o.kid = data
+		return nil
+	}
+	if len(data) > 0 {
+		return ErrInvalidOption
+	}
+	return nil
+}
+
+// aad creates additional authenticated data (RFC 8613 section 5.4).
+func aad(requestKID, requestPIV []byte) []byte {
+	externalAAD := cbor.AppendArray(nil, 5)
+	externalAAD = cbor.AppendUint(externalAAD, 1)
+	externalAAD = cbor.AppendArray(externalAAD, 1)
+	externalAAD = cbor.AppendUint(externalAAD, algAESCCM16_64_128)
+	externalAAD = cbor.AppendBytes(externalAAD, requestKID)
+	externalAAD = cbor.AppendBytes(externalAAD, requestPIV)
+	externalAAD = cbor.AppendBytes(externalAAD, nil)
+
+	enc := cbor.AppendArray(nil, 3)
+	enc = cbor.AppendText(enc, "Encrypt0")
+	enc = cbor.AppendBytes(enc, nil)
+	return cbor.AppendBytes(enc, externalAAD)
+}
+
+func isRequest(code codes.Code) bool {
+	return code != codes.Empty && code < 32
+}
+
+// plaintext encodes code, inner options and payload of msg and returns outer options.
+func plaintext(msg *pool.Message) ([]byte, message.Options, error) {
+	inner := make(message.Options, 0, len(msg.Options()))
+	outer := make(message.Options, 0, 4)
+	for _, o := range msg.Options() {
+		switch {
+		case o.ID == message.OSCORE:
+		case classU[o.ID]:
+			outer = append(outer, o)
+		case o.ID == message.Observe:
+			// observe is processed by proxies too
+			outer = append(outer, o)
+			inner = append(inner, o)
+		default:
+			inner = append(inner, o)
+		}
+	}
+	payload, err := msg.ReadBody()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read payload: %w", err)
+	}
+	size, err := inner.Marshal(nil)
+	if err != nil && !errors.Is(err, message.ErrTooSmall) {
+		return nil, nil, fmt.Errorf("cannot marshal options: %w", err)
+	}
+	buf := make([]byte, 1+size, 1+size+1+len(payload)+tagLength)
+	buf[0] = byte(msg.Code())
+	_, err = inner.Marshal(buf[1:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot marshal options: %w", err)
+	}
+	if len(payload) > 0 {
+		buf = append(buf, payloadMarker)
+		buf = append(buf, payload...)
+	}
+	return buf, outer, nil
+}
+
+// restore replaces protected content of msg by decrypted plaintext.
+func restore(msg *pool.Message, plaintext []byte) error {
+	if len(plaintext) == 0 {
+		return ErrDecryption
+	}
+	code := codes.Code(plaintext[0])
+	var inner message.Options
+	var n int
+	for size := 16; ; size *= 2 {
+		inner = make(message.Options, 0, size)
+		var err error
+		n, err = inner.Unmarshal(plaintext[1:], message.CoapOptionDefs)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, message.ErrOptionsTooSmall) {
+			return fmt.Errorf("cannot unmarshal options: %w", err)
+		}
+	}
+	payload := plaintext[1+n:]
+	opts := make(message.Options, 0, len(msg.Options())+len(inner))
+	for _, o := range msg.Options() {
+		if o.ID == message.OSCORE || (o.ID == message.Observe && inner.HasOption(message.Observe)) {
+			continue
+		}
+		opts = opts.Add(o)
+	}
+	for _, o := range inner {
+		opts = opts.Add(o)
+	}
+	msg.SetCode(code)
+	msg.ResetOptionsTo(opts)
+	if len(payload) > 0 {
+		msg.SetBody(bytes.NewReader(payload))
+	} else {
+		msg.SetBody(nil)
+	}
+	return nil
+}
+
+// seal replaces content of msg by ciphertext and outer options.
+func seal(msg *pool.Message, code codes.Code, outer message.Options, opt oscoreOption, ciphertext []byte) {
+	outer = outer.Add(message.Option{
+		ID:    message.OSCORE,
+		Value: opt.marshal(),
+	})
+	msg.SetCode(code)
+	msg.ResetOptionsTo(outer)
+	msg.SetBody(bytes.NewReader(ciphertext))
+}
+
+func getOSCOREOption(msg *pool.Message) (oscoreOption, error) {
+	var opt oscoreOption
+	v, err := msg.GetOptionBytes(message.OSCORE)
+	if err != nil {
+		return opt, ErrUnprotected
+	}
+	err = opt.unmarshal(v)
+	return opt, err
+}
+
+// ProtectRequest encrypts request msg in place and returns binding for its response.
+func (c *Context) ProtectRequest(msg *pool.Message) (*Binding, error) {
+	pt, outer, err := plaintext(msg)
+	if err != nil {
+		return nil, err
+	}
+	piv, err := c.nextSequenceNumber()
+	if err != nil {
+		return nil, err
+	}
+	b := &Binding{
+		kid:     c.senderID,
+		piv:     piv,
+		observe: outer.HasOption(message.Observe),
+	}
+	ciphertext := c.sender.Seal(nil, c.nonce(c.senderID, piv), pt, aad(b.kid, b.piv))
+	code := codes.POST
+	if b.observe {
+		code = codes.FETCH
+	}
+	seal(msg, code, outer, oscoreOption{
+		piv:        piv,
+		kidContext: c.idContext,
+		kid:        c.senderID,
+		hasKID:     true,
+	}, ciphertext)
+	return b, nil
+}
+
+// UnprotectRequest verifies and decrypts request msg in place and returns binding for its response.
+func (c *Context) UnprotectRequest(msg *pool.Message) (*Binding, error) {
+	opt, err := getOSCOREOption(msg)
+	if err != nil {
+		return nil, err
+	}
+	if !opt.hasKID || len(opt.piv) == 0 {
+		return nil, ErrInvalidOption
+	}
+	if !bytes.Equal(opt.kid, c.recipientID) || (opt.kidContext != nil && !bytes.Equal(opt.kidContext, c.idContext)) {
+		return nil, ErrContextNotFound
+	}
+	seq := decodePartialIV(opt.piv)
+	if err := c.checkReplay(seq); err != nil {
+		return nil, err
+	}
+	ciphertext, err := msg.ReadBody()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read payload: %w", err)
+	}
+	b := &Binding{
+		kid: append([]byte{}, opt.kid...),
+		piv: append([]byte{}, opt.piv...),
+	}
+	pt, err := c.recipient.Open(nil, c.nonce(b.kid, b.piv), ciphertext, aad(b.kid, b.piv))
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	if err := c.acceptReplay(seq); err != nil {
+		return nil, err
+	}
+	if err := restore(msg, pt); err != nil {
+		return nil, err
+	}
+	b.observe = msg.HasOption(message.Observe)
+	return b, nil
+}
+
+// ProtectResponse encrypts response msg to the request of binding in place. Notifications
+// carry their own partial IV.
+func (c *Context) ProtectResponse(msg *pool.Message, b *Binding) error {
+	pt, outer, err := plaintext(msg)
+	if err != nil {
+		return err
+	}
+	notification := outer.HasOption(message.Observe)
+	var opt oscoreOption
+	nonce := c.nonce(b.kid, b.piv)
+	if notification {
+		opt.piv, err = c.nextSequenceNumber()
+		if err != nil {
+			return err
+		}
+		nonce = c.nonce(c.senderID, opt.piv)
+	}
+	ciphertext := c.sender.Seal(nil, nonce, pt, aad(b.kid, b.piv))
+	code := codes.Changed
+	if notification {
+		code = codes.Content
+	}
+	seal(msg, code, outer, opt, ciphertext)
+	return nil
+}
+
+// UnprotectResponse verifies and decrypts response msg to the request of binding in place.
+func (c *Context) UnprotectResponse(msg *pool.Message, b *Binding) error {
+	opt, err := getOSCOREOption(msg)
+	if err != nil {
+		return err
+	}
+	nonce := c.nonce(b.kid, b.piv)
+	if len(opt.piv) > 0 {
+		nonce = c.nonce(c.recipientID, opt.piv)
+	}
+	ciphertext, err := msg.ReadBody()
+	if err != nil {
+		return fmt.Errorf("cannot read payload: %w", err)
+	}
+	pt, err := c.recipient.Open(nil, nonce, ciphertext, aad(b.kid, b.piv))
+	if err != nil {
+		return ErrDecryption
+	}
+	if len(opt.piv) > 0 && msg.HasOption(message.Observe) {
+		if err := b.checkNotification(decodePartialIV(opt.piv)); err != nil {
+			return err
+		}
+	}
+	return restore(msg, pt)
+}
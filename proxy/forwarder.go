@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// ErrNotProxyRequest is returned for request without Proxy-Uri and Proxy-Scheme.
+var ErrNotProxyRequest = errors.New("request has neither Proxy-Uri nor Proxy-Scheme")
+
+// TargetURI returns URI of the target resource of a request to a forward-proxy. It is value of Proxy-Uri or it is
+// composed of Proxy-Scheme, Uri-Host, Uri-Port, Uri-Path and Uri-Query (RFC 7252 section 6.5).
+func TargetURI(options message.Options) (*url.URL, error) {
+	if proxyURI, err := options.GetString(message.ProxyURI); err == nil {
+		u, err := url.Parse(proxyURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Proxy-Uri: %w", err)
+		}
+		if !u.IsAbs() {
+			return nil, fmt.Errorf("invalid Proxy-Uri: %v is not absolute", proxyURI)
+		}
+		return u, nil
+	}
+	scheme, err := options.GetString(message.ProxyScheme)
+	if err != nil {
+		return nil, ErrNotProxyRequest
+	}
+	host, err := options.GetString(message.URIHost)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get Uri-Host: %w", err)
+	}
+	if port, err := options.GetUint32(message.URIPort); err == nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.FormatUint(uint64(port), 10))
+	}
+	u := url.URL{
+		Scheme: scheme,
+		Host:   host,
+		Path:   "/",
+	}
+	if path, err := options.Path(); err == nil {
+		u.Path = path
+	}
+	if queries, err := options.Queries(); err == nil {
+		u.RawQuery = strings.Join(queries, "&")
+	}
+	return &u, nil
+}
+
+// DefaultMaxBodySize is default maximal size of bodies of requests and responses forwarded by Forwarder
+// and Handler.
+const DefaultMaxBodySize = 1024 * 1024
+
+// AllowFunc reports whether the forward-proxy may forward requests to the target URI.
+type AllowFunc = func(target *url.URL) bool
+
+// AllowHosts allows targets whose host, without port, is one of hosts.
+func AllowHosts(hosts ...string) AllowFunc {
+	allowed := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = struct{}{}
+	}
+	return func(target *url.URL) bool {
+		_, ok := allowed[strings.ToLower(target.Hostname())]
+		return ok
+	}
+}
+
+var defaultForwarderOptions = forwarderOptions{
+	maxBodySize: DefaultMaxBodySize,
+}
+
+type forwarderOptions struct {
+	maxBodySize int64
+}
+
+// A ForwarderOption sets options such as maximal body size.
+type ForwarderOption interface {
+	applyForwarder(*forwarderOptions)
+}
+
+// MaxBodySizeOpt maximal body size option.
+type MaxBodySizeOpt struct {
+	maxBodySize int64
+}
+
+func (o MaxBodySizeOpt) applyForwarder(opts *forwarderOptions) {
+	opts.maxBodySize = o.maxBodySize
+}
+
+func (o MaxBodySizeOpt) applyHandler(opts *handlerOptions) {
+	opts.maxBodySize = o.maxBodySize
+}
+
+// WithMaxBodySize limits size of bodies of the forwarded requests and responses. Forwarder rejects a larger
+// request by 4.13 (Request Entity Too Large) and replaces a larger response by 5.02 (Bad Gateway), Handler
+// by 413 (Request Entity Too Large) and 502 (Bad Gateway).
+func WithMaxBodySize(maxBodySize int64) MaxBodySizeOpt {
+	return MaxBodySizeOpt{maxBodySize: maxBodySize}
+}
+
+// Forwarder is a handler of a forward-proxy, which forwards requests with Proxy-Uri or Proxy-Scheme
+// to HTTP servers and translates their responses (RFC 7252 section 10.2).
+type Forwarder struct {
+	client      *http.Client
+	allow       AllowFunc
+	maxBodySize int64
+}
+
+// NewForwarder creates Forwarder which sends requests by the client to targets allowed by allow. Requests
+// to other targets, e.g. to hosts of the internal network, are rejected by 4.03 (Forbidden); nil allow
+// rejects all of them. When the client is nil, http.DefaultClient is used.
+func NewForwarder(client *http.Client, allow AllowFunc, opts ...ForwarderOption) *Forwarder {
+	cfg := defaultForwarderOptions
+	for _, o := range opts {
+		o.applyForwarder(&cfg)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Forwarder{
+		client:      client,
+		allow:       allow,
+		maxBodySize: cfg.maxBodySize,
+	}
+}
+
+// errBodyTooLarge is returned by readBody for body larger than the maximal body size.
+var errBodyTooLarge = errors.New("body is too large")
+
+func readBody(r io.Reader, maxBodySize int64) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, fmt.Errorf("%w: limit is %v bytes", errBodyTooLarge, maxBodySize)
+	}
+	return body, nil
+}
+
+func setError(w mux.ResponseWriter, code codes.Code, err error) {
+	w.SetResponse(code, message.TextPlain, bytes.NewReader([]byte(err.Error())))
+}
+
+// ServeCOAP forwards the request to the HTTP server of its target URI.
+func (f *Forwarder) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	target, err := TargetURI(r.Options)
+	if err != nil {
+		setError(w, codes.ProxyingNotSupported, err)
+		return
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		setError(w, codes.ProxyingNotSupported, fmt.Errorf("unsupported scheme %v", target.Scheme))
+		return
+	}
+	if f.allow == nil || !f.allow(target) {
+		setError(w, codes.Forbidden, fmt.Errorf("forwarding to %v is not allowed", target.Host))
+		return
+	}
+	opts := message.ClassifyProxyOptions(r.Options, message.CoapOptionDefs)
+	if len(opts.UnknownCritical) > 0 {
+		setError(w, codes.BadOption, fmt.Errorf("unknown critical option %v", opts.UnknownCritical[0].ID))
+		return
+	}
+	if len(opts.UnknownUnsafe) > 0 {
+		setError(w, codes.BadGateway, fmt.Errorf("unknown unsafe option %v", opts.UnknownUnsafe[0].ID))
+		return
+	}
+	method, ok := HTTPMethod(r.Code)
+	if !ok {
+		setError(w, codes.MethodNotAllowed, fmt.Errorf("unsupported method %v", r.Code))
+		return
+	}
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var body []byte
+	if r.Body != nil {
+		body, err = readBody(r.Body, f.maxBodySize)
+		if errors.Is(err, errBodyTooLarge) {
+			setError(w, codes.RequestEntityTooLarge, fmt.Errorf("cannot read request: %w", err))
+			return
+		}
+		if err != nil {
+			setError(w, codes.BadRequest, fmt.Errorf("cannot read request: %w", err))
+			return
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		setError(w, codes.BadRequest, err)
+		return
+	}
+	if len(body) > 0 {
+		cf, err := r.Options.ContentFormat()
+		if err == nil {
+			ct, ok := ContentType(cf)
+			if !ok {
+				setError(w, codes.UnsupportedMediaType, fmt.Errorf("unsupported content format %v", cf))
+				return
+			}
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+	if accept, err := r.Options.Accept(); err == nil {
+		ct, ok := ContentType(accept)
+		if !ok {
+			setError(w, codes.NotAcceptable, fmt.Errorf("unsupported accept %v", accept))
+			return
+		}
+		req.Header.Set("Accept", ct)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			setError(w, codes.GatewayTimeout, err)
+			return
+		}
+		setError(w, codes.BadGateway, err)
+		return
+	}
+	defer resp.Body.Close()
+	f.setResponse(w, r.Code, resp)
+}
+
+func (f *Forwarder) setResponse(w mux.ResponseWriter, method codes.Code, resp *http.Response) {
+	body, err := readBody(resp.Body, f.maxBodySize)
+	if err != nil {
+		setError(w, codes.BadGateway, fmt.Errorf("cannot read response: %w", err))
+		return
+	}
+	var opts message.Options
+	buf := make([]byte, 4)
+	if maxAge, ok := httpMaxAge(resp.Header); ok {
+		n, _ := message.EncodeUint32(buf, maxAge)
+		opts = opts.Add(message.Option{ID: message.MaxAge, Value: buf[:n]})
+	}
+	if etag, ok := CoAPETag(resp.Header.Get("ETag")); ok {
+		opts = opts.Add(message.Option{ID: message.ETag, Value: etag})
+	}
+	code := CoAPCode(method, resp.StatusCode)
+	if len(body) == 0 {
+		w.SetResponse(code, message.TextPlain, nil, opts...)
+		return
+	}
+	// media type without content format is forwarded as opaque bytes
+	cf := message.AppOctets
+	if mt, ok := MediaType(resp.Header.Get("Content-Type")); ok {
+		cf = mt
+	}
+	w.SetResponse(code, cf, bytes.NewReader(body), opts...)
+}
+
+// httpMaxAge returns max-age of Cache-Control.
+func httpMaxAge(h http.Header) (uint32, bool) {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(strings.ToLower(directive), "max-age=") {
+			continue
+		}
+		v, err := strconv.ParseUint(directive[len("max-age="):], 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,423 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/udp"
+)
+
+// DialFunc opens connection to the upstream CoAP server at addr for the scheme of the target URI, e.g. "coap"
+// or "coaps+tcp".
+type DialFunc = func(ctx context.Context, scheme, addr string) (mux.Client, error)
+
+// Dial opens connection for schemes "coap" over UDP and "coap+tcp" over TCP. Use own DialFunc for secured
+// schemes, e.g. by dtls.Dial with the credentials of the proxy.
+func Dial(ctx context.Context, scheme, addr string) (mux.Client, error) {
+	switch scheme {
+	case "coap":
+		cc, err := udp.Dial(addr, udp.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	case "coap+tcp":
+		cc, err := tcp.Dial(addr, tcp.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	}
+	return nil, fmt.Errorf("unsupported scheme %v", scheme)
+}
+
+// defaultPorts are ports of the schemes for targets without port (RFC 7252 section 6 and RFC 8323 section 8).
+var defaultPorts = map[string]string{
+	"coap":      "5683",
+	"coaps":     "5684",
+	"coap+tcp":  "5683",
+	"coaps+tcp": "5684",
+}
+
+// perHopOptions are options which aren't forwarded, because the proxy processes them itself.
+var perHopOptions = map[message.OptionID]bool{
+	message.ProxyURI:    true,
+	message.ProxyScheme: true,
+	message.URIHost:     true,
+	message.URIPort:     true,
+	message.URIPath:     true,
+	message.URIQuery:    true,
+	message.Observe:     true,
+	message.Block1:      true,
+	message.Block2:      true,
+	message.Size1:       true,
+	message.Size2:       true,
+	message.HopLimit:    true,
+}
+
+// forwardOptions returns options of the message which are forwarded to the next hop.
+func forwardOptions(options message.Options) message.Options {
+	opts := make(message.Options, 0, len(options))
+	for _, o := range options {
+		if !perHopOptions[o.ID] {
+			opts = append(opts, o)
+		}
+	}
+	return opts
+}
+
+// observationKey identifies observation of a downstream client by the token. The client is identified by its
+// connection, because mux.Client of the connection isn't the same for every request.
+type observationKey struct {
+	conn  interface{}
+	token string
+}
+
+// ForwardHandler is a handler of a CoAP-to-CoAP forward-proxy (RFC 7252 section 5.7.2), which forwards
+// requests with Proxy-Uri or Proxy-Scheme and Uri-Host to upstream servers over connections which are kept
+// for next requests to the same server. Observations are relayed: notifications of the upstream server are
+// sent to the client until it cancels the observation or disconnects.
+//
+// Multiple goroutines may invoke methods on ForwardHandler simultaneously.
+type ForwardHandler struct {
+	dial  DialFunc
+	allow AllowFunc
+
+	mutex        sync.Mutex
+	conns        map[string]mux.Client
+	observations map[observationKey]mux.Observation
+}
+
+// NewForwardHandler creates ForwardHandler which opens upstream connections by dial to targets allowed
+// by allow. Requests to other targets are rejected by 4.03 (Forbidden); nil allow rejects all of them.
+// When dial is nil, Dial is used.
+func NewForwardHandler(dial DialFunc, allow AllowFunc) *ForwardHandler {
+	if dial == nil {
+		dial = Dial
+	}
+	return &ForwardHandler{
+		dial:         dial,
+		allow:        allow,
+		conns:        make(map[string]mux.Client),
+		observations: make(map[observationKey]mux.Observation),
+	}
+}
+
+// upstreamAddr returns address of the target with the default port of its scheme.
+func upstreamAddr(target *url.URL) (string, error) {
+	port, ok := defaultPorts[target.Scheme]
+	if !ok {
+		return "", fmt.Errorf("unsupported scheme %v", target.Scheme)
+	}
+	if target.Port() != "" {
+		port = target.Port()
+	}
+	return net.JoinHostPort(target.Hostname(), port), nil
+}
+
+// conn returns connection to the upstream server, a new one is opened when there is none.
+func (h *ForwardHandler) conn(ctx context.Context, scheme, addr string) (mux.Client, error) {
+	key := scheme + "://" + addr
+	h.mutex.Lock()
+	cc, ok := h.conns[key]
+	h.mutex.Unlock()
+	if ok {
+		return cc, nil
+	}
+	cc, err := h.dial(ctx, scheme, addr)
+	if err != nil {
+		return nil, err
+	}
+	h.mutex.Lock()
+	if c, ok := h.conns[key]; ok {
+		// the connection was opened by a concurrent request meanwhile
+		h.mutex.Unlock()
+		cc.Close()
+		return c, nil
+	}
+	h.conns[key] = cc
+	h.mutex.Unlock()
+	go func() {
+		<-cc.Done()
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if h.conns[key] == cc {
+			delete(h.conns, key)
+		}
+	}()
+	return cc, nil
+}
+
+// hopLimit returns Hop-Limit of the forwarded request, or false when the request must not be forwarded
+// (RFC 8768).
+func hopLimit(options message.Options) ([]byte, bool) {
+	v, err := options.GetUint32(message.HopLimit)
+	if err != nil {
+		return nil, true
+	}
+	if v <= 1 {
+		return nil, false
+	}
+	return []byte{byte(v - 1)}, true
+}
+
+// ServeCOAP forwards the request to the upstream server of its target URI.
+func (h *ForwardHandler) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	target, err := TargetURI(r.Options)
+	if err != nil {
+		setError(w, codes.ProxyingNotSupported, err)
+		return
+	}
+	addr, err := upstreamAddr(target)
+	if err != nil {
+		setError(w, codes.ProxyingNotSupported, err)
+		return
+	}
+	if h.allow == nil || !h.allow(target) {
+		setError(w, codes.Forbidden, fmt.Errorf("forwarding to %v is not allowed", target.Host))
+		return
+	}
+	classified := message.ClassifyProxyOptions(r.Options, message.CoapOptionDefs)
+	if len(classified.UnknownCritical) > 0 {
+		setError(w, codes.BadOption, fmt.Errorf("unknown critical option %v", classified.UnknownCritical[0].ID))
+		return
+	}
+	if len(classified.UnknownUnsafe) > 0 {
+		setError(w, codes.BadGateway, fmt.Errorf("unknown unsafe option %v", classified.UnknownUnsafe[0].ID))
+		return
+	}
+	opts := forwardOptions(r.Options)
+	if r.Options.HasOption(message.HopLimit) {
+		limit, ok := hopLimit(r.Options)
+		if !ok {
+			setError(w, codes.HopLimitReached, fmt.Errorf("hop limit of %v was reached", target.Host))
+			return
+		}
+		opts = opts.Add(message.Option{ID: message.HopLimit, Value: limit})
+	}
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cc, err := h.conn(ctx, target.Scheme, addr)
+	if err != nil {
+		setError(w, codes.BadGateway, fmt.Errorf("cannot connect to %v: %w", addr, err))
+		return
+	}
+	key := observationKey{conn: w.Client().ClientConn(), token: string(r.Token)}
+	if obs, err := r.Options.Observe(); err == nil && r.Code == codes.GET {
+		switch obs {
+		case 0:
+			h.observe(ctx, w, r, cc, target, opts, key)
+			return
+		case 1:
+			h.cancelObservation(ctx, key)
+		}
+	}
+	h.forward(ctx, w, r, cc, target, opts)
+}
+
+// upstreamOptions sets Uri-Path and Uri-Query of the target to the forwarded options.
+func upstreamOptions(target *url.URL, opts message.Options) (message.Options, error) {
+	buf := make([]byte, len(target.Path))
+	var err error
+	opts, _, err = opts.SetPath(buf, target.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %v: %w", target.Path, err)
+	}
+	return addQueries(opts, target), nil
+}
+
+func addQueries(opts message.Options, target *url.URL) message.Options {
+	for _, q := range strings.Split(target.RawQuery, "&") {
+		if q != "" {
+			opts = opts.Add(message.Option{ID: message.URIQuery, Value: []byte(q)})
+		}
+	}
+	return opts
+}
+
+func (h *ForwardHandler) forward(ctx context.Context, w mux.ResponseWriter, r *mux.Message, cc mux.Client, target *url.URL, opts message.Options) {
+	opts, err := upstreamOptions(target, opts)
+	if err != nil {
+		setError(w, codes.BadRequest, err)
+		return
+	}
+	token, err := message.GetToken()
+	if err != nil {
+		setError(w, codes.InternalServerError, fmt.Errorf("cannot get token: %w", err))
+		return
+	}
+	resp, err := cc.Do(&message.Message{
+		Context: ctx,
+		Token:   token,
+		Code:    r.Code,
+		Options: opts,
+		Body:    r.Body,
+	})
+	if err != nil {
+		setUpstreamError(w, err)
+		return
+	}
+	setResponse(w, resp)
+}
+
+// setUpstreamError responds by 5.04 (Gateway Timeout) when the upstream server didn't respond in time,
+// otherwise by 5.02 (Bad Gateway).
+func setUpstreamError(w mux.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		setError(w, codes.GatewayTimeout, err)
+		return
+	}
+	setError(w, codes.BadGateway, err)
+}
+
+// setResponse relays the response of the upstream server.
+func setResponse(w mux.ResponseWriter, resp *message.Message) {
+	opts := responseOptions(resp.Options)
+	if resp.Body == nil {
+		w.SetResponse(resp.Code, message.TextPlain, nil, opts...)
+		return
+	}
+	cf, err := resp.Options.ContentFormat()
+	if err != nil {
+		cf = message.AppOctets
+	}
+	w.SetResponse(resp.Code, cf, resp.Body, opts...)
+}
+
+// responseOptions returns options of the upstream response which are relayed, e.g. ETag and Max-Age. Observe
+// of notifications is kept, so the client orders them.
+func responseOptions(options message.Options) message.Options {
+	opts := forwardOptions(options)
+	if obs, err := options.GetBytes(message.Observe); err == nil {
+		opts = opts.Add(message.Option{ID: message.Observe, Value: obs})
+	}
+	return opts
+}
+
+// observe registers observation of the target on behalf of the client and relays its notifications.
+func (h *ForwardHandler) observe(ctx context.Context, w mux.ResponseWriter, r *mux.Message, cc mux.Client, target *url.URL, opts message.Options, key observationKey) {
+	opts = addQueries(opts, target)
+	client := w.Client()
+	token := append(message.Token(nil), r.Token...)
+	first := make(chan *message.Message, 1)
+	var firstOnce sync.Once
+	obs, err := cc.Observe(ctx, target.Path, func(n *message.Message) {
+		isFirst := false
+		firstOnce.Do(func() {
+			isFirst = true
+			first <- n
+		})
+		if isFirst {
+			return
+		}
+		relayNotification(client, token, n)
+	}, opts...)
+	if err != nil {
+		select {
+		case resp := <-first:
+			// the upstream server rejected the observation, e.g. by 4.04
+			setResponse(w, resp)
+		default:
+			setUpstreamError(w, err)
+		}
+		return
+	}
+	var resp *message.Message
+	select {
+	case resp = <-first:
+	case <-ctx.Done():
+		_ = obs.Cancel(context.Background())
+		setUpstreamError(w, ctx.Err())
+		return
+	}
+	if !resp.Options.HasOption(message.Observe) {
+		// the upstream server doesn't accept the observation, so the response ends it
+		_ = obs.Cancel(ctx)
+		setResponse(w, resp)
+		return
+	}
+	h.addObservation(key, client, obs)
+	setResponse(w, resp)
+}
+
+// relayNotification sends the notification of the upstream server to the client with token of its observation.
+func relayNotification(client mux.Client, token message.Token, n *message.Message) {
+	var body io.ReadSeeker
+	opts := responseOptions(n.Options)
+	if n.Body != nil {
+		body = n.Body
+		if !opts.HasOption(message.ContentFormat) {
+			buf := make([]byte, 4)
+			opts, _, _ = opts.SetContentFormat(buf, message.AppOctets)
+		}
+	}
+	_ = client.WriteMessage(&message.Message{
+		Context: client.Context(),
+		Token:   token,
+		Code:    n.Code,
+		Options: opts,
+		Body:    body,
+	})
+}
+
+// addObservation stores the upstream observation until the client cancels it or disconnects.
+func (h *ForwardHandler) addObservation(key observationKey, client mux.Client, obs mux.Observation) {
+	h.mutex.Lock()
+	prev, ok := h.observations[key]
+	h.observations[key] = obs
+	h.mutex.Unlock()
+	if ok {
+		// the client registered again by the same token
+		_ = prev.Cancel(context.Background())
+		return
+	}
+	go func() {
+		<-client.Done()
+		h.cancelObservation(context.Background(), key)
+	}()
+}
+
+func (h *ForwardHandler) cancelObservation(ctx context.Context, key observationKey) {
+	h.mutex.Lock()
+	obs, ok := h.observations[key]
+	delete(h.observations, key)
+	h.mutex.Unlock()
+	if ok {
+		_ = obs.Cancel(ctx)
+	}
+}
+
+// Close cancels relayed observations and closes upstream connections.
+func (h *ForwardHandler) Close() error {
+	h.mutex.Lock()
+	observations := h.observations
+	conns := h.conns
+	h.observations = make(map[observationKey]mux.Observation)
+	h.conns = make(map[string]mux.Client)
+	h.mutex.Unlock()
+	for _, obs := range observations {
+		_ = obs.Cancel(context.Background())
+	}
+	var errs []string
+	for _, cc := range conns {
+		if err := cc.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot close upstream connections: %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// defaultMaxAge is Max-Age of response without the option (RFC 7252 section 5.10.5).
+const defaultMaxAge = 60
+
+// Handler is a HTTP handler of a HTTP-to-CoAP proxy, which translates requests to CoAP requests over
+// a connection and translates their responses (RFC 8075). Path and query of the HTTP request are
+// Uri-Path and Uri-Query of the CoAP request, use http.StripPrefix to serve it under a prefix, e.g. "/hc".
+type Handler struct {
+	cc          mux.Client
+	maxBodySize int64
+}
+
+var defaultHandlerOptions = handlerOptions{
+	maxBodySize: DefaultMaxBodySize,
+}
+
+type handlerOptions struct {
+	maxBodySize int64
+}
+
+// A HandlerOption sets options such as maximal body size.
+type HandlerOption interface {
+	applyHandler(*handlerOptions)
+}
+
+// NewHandler creates Handler which sends requests over the connection, e.g. udp ClientConn.Client(). Bodies of
+// requests and responses are limited by DefaultMaxBodySize unless WithMaxBodySize is set.
+func NewHandler(cc mux.Client, opts ...HandlerOption) *Handler {
+	cfg := defaultHandlerOptions
+	for _, o := range opts {
+		o.applyHandler(&cfg)
+	}
+	return &Handler{
+		cc:          cc,
+		maxBodySize: cfg.maxBodySize,
+	}
+}
+
+func (h *Handler) request(r *http.Request) (*message.Message, int, error) {
+	code, ok := CoAPMethod(r.Method)
+	if !ok {
+		return nil, http.StatusNotImplemented, fmt.Errorf("unsupported method %v", r.Method)
+	}
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("cannot get token: %w", err)
+	}
+	var opts message.Options
+	for _, segment := range strings.Split(r.URL.Path, "/") {
+		if segment != "" {
+			opts = opts.Add(message.Option{ID: message.URIPath, Value: []byte(segment)})
+		}
+	}
+	if r.URL.RawQuery != "" {
+		for _, query := range strings.Split(r.URL.RawQuery, "&") {
+			if q, err := url.QueryUnescape(query); err == nil && q != "" {
+				opts = opts.Add(message.Option{ID: message.URIQuery, Value: []byte(q)})
+			}
+		}
+	}
+	buf := make([]byte, 8)
+	if accept := acceptMediaType(r.Header.Get("Accept")); accept != nil {
+		n, _ := message.EncodeUint32(buf, uint32(*accept))
+		opts = opts.Add(message.Option{ID: message.Accept, Value: buf[:n]})
+	}
+	req := message.Message{
+		Context: r.Context(),
+		Token:   token,
+		Code:    code,
+	}
+	body, err := readBody(r.Body, h.maxBodySize)
+	if errors.Is(err, errBodyTooLarge) {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("cannot read request: %w", err)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("cannot read request: %w", err)
+	}
+	if len(body) > 0 {
+		cf := message.AppOctets
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			cf, ok = MediaType(ct)
+			if !ok {
+				return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported media type %v", ct)
+			}
+		}
+		n, _ := message.EncodeUint32(buf[4:], uint32(cf))
+		opts = opts.Add(message.Option{ID: message.ContentFormat, Value: buf[4 : 4+n]})
+		req.Body = bytes.NewReader(body)
+	}
+	req.Options = opts
+	return &req, 0, nil
+}
+
+// acceptMediaType returns the first media type of Accept which has content format.
+func acceptMediaType(accept string) *message.MediaType {
+	for _, v := range strings.Split(accept, ",") {
+		if mt, ok := MediaType(strings.TrimSpace(v)); ok {
+			return &mt
+		}
+	}
+	return nil
+}
+
+// ServeHTTP sends the request to the CoAP server and writes its response.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, status, err := h.request(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	resp, err := h.cc.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var body []byte
+	if resp.Body != nil {
+		body, err = readBody(resp.Body, h.maxBodySize)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("cannot read response: %v", err), http.StatusBadGateway)
+			return
+		}
+	}
+	status = HTTPStatus(resp.Code)
+	if len(body) == 0 && (resp.Code == codes.Changed || resp.Code == codes.Deleted) {
+		status = http.StatusNoContent
+	}
+	if len(body) > 0 {
+		ct := "application/octet-stream"
+		if cf, err := resp.Options.ContentFormat(); err == nil {
+			if v, ok := ContentType(cf); ok {
+				ct = v
+			}
+		}
+		w.Header().Set("Content-Type", ct)
+	}
+	if resp.Code == codes.Content || resp.Code == codes.Valid {
+		maxAge := uint32(defaultMaxAge)
+		if v, err := resp.Options.GetUint32(message.MaxAge); err == nil {
+			maxAge = v
+		}
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(maxAge), 10))
+	}
+	if etag, err := resp.Options.GetBytes(message.ETag); err == nil {
+		w.Header().Set("ETag", HTTPETag(etag))
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
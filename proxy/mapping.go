@@ -0,0 +1,211 @@
+// Package proxy implements cross-proxying between CoAP and HTTP (RFC 8075), by
+// a CoAP handler which forwards requests to HTTP servers and by an HTTP handler
+// which translates requests to CoAP requests over a connection. ForwardHandler
+// is a CoAP-to-CoAP forward-proxy.
+package proxy
+
+import (
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+var contentTypes = map[message.MediaType]string{
+	message.TextPlain:         "text/plain;charset=utf-8",
+	message.AppCoseEncrypt0:   `application/cose; cose-type="cose-encrypt0"`,
+	message.AppCoseMac0:       `application/cose; cose-type="cose-mac0"`,
+	message.AppCoseSign1:      `application/cose; cose-type="cose-sign1"`,
+	message.AppLinkFormat:     "application/link-format",
+	message.AppXML:            "application/xml",
+	message.AppOctets:         "application/octet-stream",
+	message.AppExi:            "application/exi",
+	message.AppJSON:           "application/json",
+	message.AppJSONPatch:      "application/json-patch+json",
+	message.AppJSONMergePatch: "application/merge-patch+json",
+	message.AppCBOR:           "application/cbor",
+	message.AppCWT:            "application/cwt",
+	message.AppCoseEncrypt:    `application/cose; cose-type="cose-encrypt"`,
+	message.AppCoseMac:        `application/cose; cose-type="cose-mac"`,
+	message.AppCoseSign:       `application/cose; cose-type="cose-sign"`,
+	message.AppCoseKey:        "application/cose-key",
+	message.AppCoseKeySet:     "application/cose-key-set",
+	message.AppCoapGroup:      "application/coap-group+json",
+	message.AppOcfCbor:        "application/vnd.ocf+cbor",
+	message.AppLwm2mTLV:       "application/vnd.oma.lwm2m+tlv",
+	message.AppLwm2mJSON:      "application/vnd.oma.lwm2m+json",
+}
+
+var mediaTypes = func() map[string]message.MediaType {
+	m := make(map[string]message.MediaType, len(contentTypes))
+	for mt, ct := range contentTypes {
+		m[mediaTypeKey(ct)] = mt
+	}
+	return m
+}()
+
+// mediaTypeKey normalizes content type for lookup, only cose-type parameter is significant.
+func mediaTypeKey(contentType string) string {
+	t, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if t == "application/cose" {
+		return t + ";" + strings.ToLower(params["cose-type"])
+	}
+	return t
+}
+
+// ContentType returns HTTP media type of the content format.
+func ContentType(mt message.MediaType) (string, bool) {
+	ct, ok := contentTypes[mt]
+	return ct, ok
+}
+
+// MediaType returns content format of the HTTP media type, e.g. "application/json; charset=utf-8".
+// A text/plain with a charset other than utf-8 or us-ascii has no content format.
+func MediaType(contentType string) (message.MediaType, bool) {
+	t, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0, false
+	}
+	if t == "text/plain" {
+		switch strings.ToLower(params["charset"]) {
+		case "", "utf-8", "us-ascii":
+			return message.TextPlain, true
+		}
+		return 0, false
+	}
+	mt, ok := mediaTypes[mediaTypeKey(contentType)]
+	return mt, ok
+}
+
+var methods = map[codes.Code]string{
+	codes.GET:    http.MethodGet,
+	codes.POST:   http.MethodPost,
+	codes.PUT:    http.MethodPut,
+	codes.DELETE: http.MethodDelete,
+}
+
+// HTTPMethod returns HTTP method of the CoAP method.
+func HTTPMethod(code codes.Code) (string, bool) {
+	m, ok := methods[code]
+	return m, ok
+}
+
+// CoAPMethod returns CoAP method of the HTTP method.
+func CoAPMethod(method string) (codes.Code, bool) {
+	for code, m := range methods {
+		if m == method {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// httpStatuses maps CoAP response codes to HTTP status codes (RFC 8075 section 7).
+var httpStatuses = map[codes.Code]int{
+	codes.Created:                 http.StatusCreated,
+	codes.Deleted:                 http.StatusOK,
+	codes.Valid:                   http.StatusNotModified,
+	codes.Changed:                 http.StatusOK,
+	codes.Content:                 http.StatusOK,
+	codes.BadRequest:              http.StatusBadRequest,
+	codes.Unauthorized:            http.StatusForbidden,
+	codes.BadOption:               http.StatusBadRequest,
+	codes.Forbidden:               http.StatusForbidden,
+	codes.NotFound:                http.StatusNotFound,
+	codes.MethodNotAllowed:        http.StatusMethodNotAllowed,
+	codes.NotAcceptable:           http.StatusNotAcceptable,
+	codes.RequestEntityIncomplete: http.StatusBadRequest,
+	codes.PreconditionFailed:      http.StatusPreconditionFailed,
+	codes.RequestEntityTooLarge:   http.StatusRequestEntityTooLarge,
+	codes.UnsupportedMediaType:    http.StatusUnsupportedMediaType,
+	codes.InternalServerError:     http.StatusInternalServerError,
+	codes.NotImplemented:          http.StatusNotImplemented,
+	codes.BadGateway:              http.StatusBadGateway,
+	codes.ServiceUnavailable:      http.StatusServiceUnavailable,
+	codes.GatewayTimeout:          http.StatusGatewayTimeout,
+	codes.ProxyingNotSupported:    http.StatusBadGateway,
+}
+
+// HTTPStatus returns HTTP status code of the CoAP response code. Unknown codes are mapped by their class,
+// a code which isn't a response is mapped to 502 (Bad Gateway).
+func HTTPStatus(code codes.Code) int {
+	if s, ok := httpStatuses[code]; ok {
+		return s
+	}
+	switch code >> 5 {
+	case 2:
+		return http.StatusOK
+	case 4:
+		return http.StatusBadRequest
+	case 5:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadGateway
+}
+
+// coapCodes maps HTTP status codes to CoAP response codes (RFC 7252 section 10.2).
+var coapCodes = map[int]codes.Code{
+	http.StatusNotModified:           codes.Valid,
+	http.StatusBadRequest:            codes.BadRequest,
+	http.StatusUnauthorized:          codes.Unauthorized,
+	http.StatusForbidden:             codes.Forbidden,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusMethodNotAllowed:      codes.MethodNotAllowed,
+	http.StatusNotAcceptable:         codes.NotAcceptable,
+	http.StatusPreconditionFailed:    codes.PreconditionFailed,
+	http.StatusRequestEntityTooLarge: codes.RequestEntityTooLarge,
+	http.StatusUnsupportedMediaType:  codes.UnsupportedMediaType,
+	http.StatusInternalServerError:   codes.InternalServerError,
+	http.StatusNotImplemented:        codes.NotImplemented,
+	http.StatusBadGateway:            codes.BadGateway,
+	http.StatusServiceUnavailable:    codes.ServiceUnavailable,
+	http.StatusGatewayTimeout:        codes.GatewayTimeout,
+}
+
+// CoAPCode returns CoAP response code of the HTTP status code of response to the request method.
+// Unknown status codes are mapped by their class, informational and redirection status codes are mapped
+// to 5.02 (Bad Gateway).
+func CoAPCode(method codes.Code, status int) codes.Code {
+	if status >= 200 && status < 300 {
+		switch {
+		case method == codes.GET:
+			return codes.Content
+		case method == codes.DELETE:
+			return codes.Deleted
+		case status == http.StatusCreated:
+			return codes.Created
+		}
+		return codes.Changed
+	}
+	if c, ok := coapCodes[status]; ok {
+		return c
+	}
+	switch status / 100 {
+	case 4:
+		return codes.BadRequest
+	case 5:
+		return codes.InternalServerError
+	}
+	return codes.BadGateway
+}
+
+// HTTPETag returns HTTP entity-tag of the CoAP ETag, the hex encoding of the ETag in quotes.
+func HTTPETag(etag []byte) string {
+	return `"` + hex.EncodeToString(etag) + `"`
+}
+
+// CoAPETag returns CoAP ETag of the HTTP entity-tag encoded by HTTPETag. Weak entity-tags are treated as strong,
+// entity-tags which aren't hex encoding of 1 to 8 bytes have no CoAP ETag.
+func CoAPETag(entityTag string) ([]byte, bool) {
+	etag, err := hex.DecodeString(strings.Trim(strings.TrimPrefix(entityTag, "W/"), `"`))
+	if err != nil || len(etag) == 0 || len(etag) > 8 {
+		return nil, false
+	}
+	return etag, true
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaType(t *testing.T) {
+	for mt, ct := range contentTypes {
+		got, ok := MediaType(ct)
+		require.True(t, ok, ct)
+		require.Equal(t, mt, got, ct)
+	}
+	tests := []struct {
+		contentType string
+		want        message.MediaType
+		wantOk      bool
+	}{
+		{contentType: "text/plain", want: message.TextPlain, wantOk: true},
+		{contentType: "text/plain; charset=UTF-8", want: message.TextPlain, wantOk: true},
+		{contentType: "text/plain; charset=iso-8859-1"},
+		{contentType: "application/json; charset=utf-8", want: message.AppJSON, wantOk: true},
+		{contentType: `application/cose; cose-type="COSE-MAC0"`, want: message.AppCoseMac0, wantOk: true},
+		{contentType: "application/cose"},
+		{contentType: "text/html"},
+		{contentType: "invalid/"},
+	}
+	for _, tt := range tests {
+		got, ok := MediaType(tt.contentType)
+		require.Equal(t, tt.wantOk, ok, tt.contentType)
+		require.Equal(t, tt.want, got, tt.contentType)
+	}
+	_, ok := ContentType(message.MediaType(65000))
+	require.False(t, ok)
+}
+
+func TestMethod(t *testing.T) {
+	for code, method := range methods {
+		got, ok := HTTPMethod(code)
+		require.True(t, ok)
+		require.Equal(t, method, got)
+		gotCode, ok := CoAPMethod(method)
+		require.True(t, ok)
+		require.Equal(t, code, gotCode)
+	}
+	_, ok := HTTPMethod(codes.FETCH)
+	require.False(t, ok)
+	_, ok = CoAPMethod(http.MethodPatch)
+	require.False(t, ok)
+}
+
+func TestHTTPStatus(t *testing.T) {
+	require.Equal(t, http.StatusOK, HTTPStatus(codes.Content))
+	require.Equal(t, http.StatusForbidden, HTTPStatus(codes.Unauthorized))
+	require.Equal(t, http.StatusBadGateway, HTTPStatus(codes.ProxyingNotSupported))
+	require.Equal(t, http.StatusBadRequest, HTTPStatus(codes.Code(4<<5|30)))
+	require.Equal(t, http.StatusInternalServerError, HTTPStatus(codes.Code(5<<5|30)))
+	require.Equal(t, http.StatusBadGateway, HTTPStatus(codes.GET))
+}
+
+func TestCoAPCode(t *testing.T) {
+	tests := []struct {
+		method codes.Code
+		status int
+		want   codes.Code
+	}{
+		{method: codes.GET, status: http.StatusOK, want: codes.Content},
+		{method: codes.POST, status: http.StatusCreated, want: codes.Created},
+		{method: codes.PUT, status: http.StatusNoContent, want: codes.Changed},
+		{method: codes.DELETE, status: http.StatusOK, want: codes.Deleted},
+		{method: codes.GET, status: http.StatusNotModified, want: codes.Valid},
+		{method: codes.GET, status: http.StatusNotFound, want: codes.NotFound},
+		{method: codes.GET, status: http.StatusTeapot, want: codes.BadRequest},
+		{method: codes.GET, status: http.StatusHTTPVersionNotSupported, want: codes.InternalServerError},
+		{method: codes.GET, status: http.StatusFound, want: codes.BadGateway},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, CoAPCode(tt.method, tt.status), tt.status)
+	}
+}
+
+func TestETag(t *testing.T) {
+	etag := []byte{0x01, 0xab, 0xff}
+	require.Equal(t, `"01abff"`, HTTPETag(etag))
+	got, ok := CoAPETag(HTTPETag(etag))
+	require.True(t, ok)
+	require.Equal(t, etag, got)
+	got, ok = CoAPETag(`W/"01abff"`)
+	require.True(t, ok)
+	require.Equal(t, etag, got)
+	for _, v := range []string{"", `""`, `"abc"`, `"xyz1"`, `"0102030405060708ff"`} {
+		_, ok = CoAPETag(v)
+		require.False(t, ok, v)
+	}
+}
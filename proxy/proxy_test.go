@@ -0,0 +1,304 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/proxy"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func serveUDP(t *testing.T, handler mux.Handler) (addr string, stop func()) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	s := udp.NewServer(udp.WithMux(handler))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+	return l.LocalAddr().String(), func() {
+		s.Stop()
+		wg.Wait()
+		l.Close()
+	}
+}
+
+func TestForwarder(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			require.Equal(t, "a=1", r.URL.RawQuery)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Cache-Control", "public, max-age=30")
+			w.Header().Set("ETag", `"0a0b"`)
+			w.Write([]byte(`{"a":1}`))
+		case "/echo":
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "application/cbor", r.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		case "/large":
+			w.Write(bytes.Repeat([]byte("a"), 1024))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer backend.Close()
+
+	addr, stop := serveUDP(t, proxy.NewForwarder(nil, proxy.AllowHosts("127.0.0.1"), proxy.WithMaxBodySize(512)))
+	defer stop()
+	cc, err := udp.Dial(addr)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(backend.URL + "/json?a=1")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	cf, err := resp.ContentFormat()
+	require.NoError(t, err)
+	require.Equal(t, message.AppJSON, cf)
+	maxAge, err := resp.GetOptionUint32(message.MaxAge)
+	require.NoError(t, err)
+	require.Equal(t, uint32(30), maxAge)
+	etag, err := resp.GetOptionBytes(message.ETag)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x0a, 0x0b}, etag)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, `{"a":1}`, string(body))
+
+	resp, err = cc.Post(ctx, "", message.AppCBOR, bytes.NewReader([]byte{0xa0}), message.Option{ID: message.ProxyURI, Value: []byte(backend.URL + "/echo")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Created, resp.Code())
+	cf, err = resp.ContentFormat()
+	require.NoError(t, err)
+	require.Equal(t, message.AppOctets, cf)
+
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(backend.URL + "/unknown")})
+	require.NoError(t, err)
+	require.Equal(t, codes.NotFound, resp.Code())
+
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(backend.URL + "/large")})
+	require.NoError(t, err)
+	require.Equal(t, codes.BadGateway, resp.Code())
+
+	resp, err = cc.Post(ctx, "", message.AppCBOR, bytes.NewReader(make([]byte, 1024)), message.Option{ID: message.ProxyURI, Value: []byte(backend.URL + "/echo")})
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code())
+
+	// the internal network isn't reachable through the proxy
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte("http://localhost:1/admin")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Forbidden, resp.Code())
+
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte("coap://localhost/a")})
+	require.NoError(t, err)
+	require.Equal(t, codes.ProxyingNotSupported, resp.Code())
+
+	resp, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.ProxyingNotSupported, resp.Code())
+}
+
+func TestHandler(t *testing.T) {
+	m := mux.NewRouter()
+	m.Handle("/a/b", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		switch r.Code {
+		case codes.GET:
+			queries, err := r.Options.Queries()
+			require.NoError(t, err)
+			require.Equal(t, []string{"x=1", "y"}, queries)
+			accept, err := r.Options.Accept()
+			require.NoError(t, err)
+			require.Equal(t, message.AppJSON, accept)
+			w.SetResponse(codes.Content, message.AppJSON, bytes.NewReader([]byte(`{}`)), message.Option{ID: message.MaxAge, Value: []byte{10}})
+		case codes.PUT:
+			cf, err := r.Options.ContentFormat()
+			require.NoError(t, err)
+			require.Equal(t, message.TextPlain, cf)
+			w.SetResponse(codes.Changed, message.TextPlain, nil)
+		}
+	}))
+	m.Handle("/big", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(make([]byte, 513)))
+	}))
+	addr, stop := serveUDP(t, m)
+	defer stop()
+	cc, err := udp.Dial(addr)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	s := httptest.NewServer(http.StripPrefix("/hc", proxy.NewHandler(cc.Client(), proxy.WithMaxBodySize(512))))
+	defer s.Close()
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/hc/a/b?x=1&y", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/html, application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, "max-age=10", resp.Header.Get("Cache-Control"))
+	require.NotEmpty(t, resp.Header.Get("ETag"))
+	require.Equal(t, `{}`, string(body))
+
+	req, err = http.NewRequest(http.MethodPut, s.URL+"/hc/a/b", bytes.NewReader([]byte("a")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = http.Get(s.URL + "/hc/c")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, s.URL+"/hc/a/b", bytes.NewReader([]byte("a")))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/html")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPatch, s.URL+"/hc/a/b", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	// bodies over the limit aren't buffered
+	req, err = http.NewRequest(http.MethodPut, s.URL+"/hc/a/b", bytes.NewReader(make([]byte, 513)))
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = http.Get(s.URL + "/hc/big")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestForwardHandler(t *testing.T) {
+	type registration struct {
+		client mux.Client
+		token  message.Token
+	}
+	registrations := make(chan registration, 1)
+	deregistrations := make(chan struct{}, 4)
+	m := mux.NewRouter()
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		queries, err := r.Options.Queries()
+		require.NoError(t, err)
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(strings.Join(queries, "&"))),
+			message.Option{ID: message.ETag, Value: []byte{1}})
+	}))
+	m.Handle("/obs", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		obs, err := r.Options.Observe()
+		if err != nil || obs != 0 {
+			select {
+			case deregistrations <- struct{}{}:
+			default:
+			}
+			w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("0")))
+			return
+		}
+		registrations <- registration{client: w.Client(), token: append(message.Token(nil), r.Token...)}
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("1")), message.Option{ID: message.Observe, Value: []byte{2}})
+	}))
+	upstreamAddr, stopUpstream := serveUDP(t, m)
+	defer stopUpstream()
+	_, port, err := net.SplitHostPort(upstreamAddr)
+	require.NoError(t, err)
+	upstreamAddr = net.JoinHostPort("127.0.0.1", port)
+
+	fh := proxy.NewForwardHandler(nil, proxy.AllowHosts("127.0.0.1"))
+	defer fh.Close()
+	proxyAddr, stopProxy := serveUDP(t, fh)
+	defer stopProxy()
+
+	cc, err := udp.Dial(upstreamAddr, udp.WithProxy(proxyAddr, ""))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a", message.Option{ID: message.URIQuery, Value: []byte("x=1")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	etag, err := resp.GetOptionBytes(message.ETag)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, etag)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "x=1", string(body))
+
+	// a request with Proxy-Uri is forwarded too
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte("coap://" + upstreamAddr + "/a?y=2")})
+	require.NoError(t, err)
+	body, err = resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "y=2", string(body))
+
+	notifications := make(chan string, 4)
+	obs, err := cc.Observe(ctx, "/obs", func(n *pool.Message) {
+		body, err := n.ReadBody()
+		require.NoError(t, err)
+		notifications <- string(body)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1", <-notifications)
+	reg := <-registrations
+	err = reg.client.WriteMessage(&message.Message{
+		Context: ctx,
+		Token:   reg.token,
+		Code:    codes.Content,
+		Options: message.Options{{ID: message.Observe, Value: []byte{3}}, {ID: message.ContentFormat, Value: []byte{}}},
+		Body:    bytes.NewReader([]byte("2")),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2", <-notifications)
+	err = obs.Cancel(ctx)
+	require.NoError(t, err)
+	// the upstream observation is canceled by the proxy
+	<-deregistrations
+
+	// hosts out of the allow-list aren't reachable through the proxy
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte("coap://localhost:1/a")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Forbidden, resp.Code())
+
+	resp, err = cc.Get(ctx, "/a", message.Option{ID: message.HopLimit, Value: []byte{1}})
+	require.NoError(t, err)
+	require.Equal(t, codes.HopLimitReached, resp.Code())
+}
@@ -0,0 +1,395 @@
+// Package pubsub implements the broker of CoAP publish-subscribe (draft-ietf-core-coap-pubsub) and its client.
+// Topics are created in the topic collection by POST of a link in CoRE Link Format, discovered by GET of the
+// collection, published by PUT and subscribed by Observe. Max-Age of the create request sets lifetime of the topic
+// and Max-Age of the publication sets lifetime of the data.
+package pubsub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coapx"
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// ResourceType is rt attribute of the topic collection.
+const ResourceType = "core.ps"
+
+type brokerOptions struct {
+	maxTopics    int
+	topicOptions []coapx.ObservableOption
+}
+
+// A BrokerOption sets options such as maximal number of topics, etc.
+type BrokerOption interface {
+	applyBroker(*brokerOptions)
+}
+
+// MaxTopicsOpt max topics option.
+type MaxTopicsOpt struct {
+	maxTopics int
+}
+
+func (o MaxTopicsOpt) applyBroker(opts *brokerOptions) {
+	opts.maxTopics = o.maxTopics
+}
+
+// WithMaxTopics bounds number of topics, the create request over the limit is answered by 5.03 (Service
+// Unavailable). Zero means no limit.
+func WithMaxTopics(maxTopics int) MaxTopicsOpt {
+	return MaxTopicsOpt{maxTopics: maxTopics}
+}
+
+// TopicOptionsOpt topic options option.
+type TopicOptionsOpt struct {
+	opts []coapx.ObservableOption
+}
+
+func (o TopicOptionsOpt) applyBroker(opts *brokerOptions) {
+	opts.topicOptions = o.opts
+}
+
+// WithTopicOptions sets options of observable resources of topics, e.g. coapx.WithObserveQueue so a slow subscriber
+// doesn't delay the others.
+func WithTopicOptions(opts ...coapx.ObservableOption) TopicOptionsOpt {
+	return TopicOptionsOpt{opts: opts}
+}
+
+type topic struct {
+	name string
+	// contentFormat of publications, set when the topic is created with ct attribute.
+	contentFormat    message.MediaType
+	hasContentFormat bool
+	observable       *coapx.Observable
+	hasData          bool
+	dataGeneration   uint64
+	dataTimer        *time.Timer
+	lifetimeTimer    *time.Timer
+}
+
+func (t *topic) stop() {
+	if t.dataTimer != nil {
+		t.dataTimer.Stop()
+	}
+	if t.lifetimeTimer != nil {
+		t.lifetimeTimer.Stop()
+	}
+	t.observable.Close()
+}
+
+// Broker is mux.Handler of the topic collection and its topics.
+//
+// Multiple goroutines may invoke methods on a Broker simultaneously.
+type Broker struct {
+	collection string
+	opts       brokerOptions
+
+	mutex  sync.Mutex
+	topics map[string]*topic
+}
+
+// NewBroker creates broker with the topic collection at the path, e.g. "/ps".
+func NewBroker(collection string, opt ...BrokerOption) *Broker {
+	var opts brokerOptions
+	for _, o := range opt {
+		o.applyBroker(&opts)
+	}
+	return &Broker{
+		collection: strings.Trim(collection, "/"),
+		opts:       opts,
+		topics:     make(map[string]*topic),
+	}
+}
+
+// Handle adds the topic collection and its topics to the router.
+func (b *Broker) Handle(r *mux.Router) error {
+	err := r.HandleResource(b.collection, b, linkformat.Resource{
+		ResourceTypes:  []string{ResourceType},
+		ContentFormats: []message.MediaType{message.AppLinkFormat},
+	})
+	if err != nil {
+		return err
+	}
+	return r.Handle(b.collection+"/*", b)
+}
+
+// Topics returns names of the topics in ascending order.
+func (b *Broker) Topics() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	names := make([]string, 0, len(b.topics))
+	for name := range b.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close removes all topics, their subscribers are deregistered.
+func (b *Broker) Close() {
+	b.mutex.Lock()
+	topics := b.topics
+	b.topics = make(map[string]*topic)
+	b.mutex.Unlock()
+	for _, t := range topics {
+		t.stop()
+	}
+}
+
+func setResponse(w mux.ResponseWriter, code codes.Code, contentFormat message.MediaType, payload []byte, opts ...message.Option) {
+	var body io.ReadSeeker
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	w.SetResponse(code, contentFormat, body, opts...)
+}
+
+func setError(w mux.ResponseWriter, code codes.Code, err error) {
+	setResponse(w, code, message.TextPlain, []byte(err.Error()))
+}
+
+// ServeCOAP serves requests of the topic collection and of the topics.
+func (b *Broker) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	name, ok := mux.Vars(r)[mux.WildcardVar]
+	if !ok {
+		switch r.Code {
+		case codes.GET:
+			b.discover(w, r)
+		case codes.POST:
+			b.create(w, r)
+		default:
+			setResponse(w, codes.MethodNotAllowed, message.TextPlain, nil)
+		}
+		return
+	}
+	b.mutex.Lock()
+	t, ok := b.topics[name]
+	b.mutex.Unlock()
+	if !ok {
+		setResponse(w, codes.NotFound, message.TextPlain, nil)
+		return
+	}
+	switch r.Code {
+	case codes.GET:
+		b.read(t, w, r)
+	case codes.PUT:
+		b.publish(t, w, r)
+	case codes.DELETE:
+		b.remove(t)
+		setResponse(w, codes.Deleted, message.TextPlain, nil)
+	default:
+		setResponse(w, codes.MethodNotAllowed, message.TextPlain, nil)
+	}
+}
+
+// discover lists the topics filtered by the queries of the request, e.g. ct=50.
+func (b *Broker) discover(w mux.ResponseWriter, r *mux.Message) {
+	queries, err := r.Options.Queries()
+	if err != nil && !errors.Is(err, message.ErrOptionNotFound) {
+		setResponse(w, codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	b.mutex.Lock()
+	resources := make([]linkformat.Resource, 0, len(b.topics))
+	for _, t := range b.topics {
+		res := linkformat.Resource{
+			Href:       "/" + b.collection + "/" + t.name,
+			Observable: true,
+		}
+		if t.hasContentFormat {
+			res.ContentFormats = []message.MediaType{t.contentFormat}
+		}
+		resources = append(resources, res)
+	}
+	b.mutex.Unlock()
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Href < resources[j].Href
+	})
+	resources, err = linkformat.Filter(resources, queries...)
+	if err != nil {
+		setError(w, codes.BadRequest, err)
+		return
+	}
+	setResponse(w, codes.Content, message.AppLinkFormat, linkformat.Encode(resources))
+}
+
+// topicName returns name of the topic from href of the link in the create request, which is relative
+// to the collection or absolute.
+func (b *Broker) topicName(href string) (string, error) {
+	name := strings.Trim(href, "/")
+	if strings.HasPrefix(href, "/") {
+		if !strings.HasPrefix(name, b.collection+"/") {
+			return "", fmt.Errorf("topic %v is not in the collection", href)
+		}
+		name = strings.TrimPrefix(name, b.collection+"/")
+	}
+	if name == "" {
+		return "", fmt.Errorf("empty topic")
+	}
+	for _, s := range strings.Split(name, "/") {
+		if s == "" || s == "." || s == ".." {
+			return "", fmt.Errorf("invalid topic %v", href)
+		}
+	}
+	return name, nil
+}
+
+func maxAge(r *mux.Message) (time.Duration, bool) {
+	v, err := r.Options.GetUint32(message.MaxAge)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(v) * time.Second, true
+}
+
+// create creates the topic described by the link in the body of the request.
+func (b *Broker) create(w mux.ResponseWriter, r *mux.Message) {
+	if ct, err := r.Options.ContentFormat(); err == nil && ct != message.AppLinkFormat {
+		setResponse(w, codes.UnsupportedMediaType, message.TextPlain, nil)
+		return
+	}
+	if r.Body == nil {
+		setError(w, codes.BadRequest, fmt.Errorf("missing link of the topic"))
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		setError(w, codes.BadRequest, err)
+		return
+	}
+	links, err := linkformat.Parse(data)
+	if err != nil {
+		setError(w, codes.BadRequest, err)
+		return
+	}
+	if len(links) != 1 {
+		setError(w, codes.BadRequest, fmt.Errorf("expected one link of the topic, got %v", len(links)))
+		return
+	}
+	name, err := b.topicName(links[0].Href)
+	if err != nil {
+		setError(w, codes.BadRequest, err)
+		return
+	}
+	t := &topic{
+		name:       name,
+		observable: coapx.NewObservable(message.TextPlain, nil, b.opts.topicOptions...),
+	}
+	if len(links[0].ContentFormats) > 0 {
+		t.contentFormat, t.hasContentFormat = links[0].ContentFormats[0], true
+	}
+
+	b.mutex.Lock()
+	if _, ok := b.topics[name]; ok {
+		b.mutex.Unlock()
+		t.observable.Close()
+		setError(w, codes.Forbidden, fmt.Errorf("topic %v already exists", name))
+		return
+	}
+	if b.opts.maxTopics > 0 && len(b.topics) >= b.opts.maxTopics {
+		b.mutex.Unlock()
+		t.observable.Close()
+		setResponse(w, codes.ServiceUnavailable, message.TextPlain, nil)
+		return
+	}
+	b.topics[name] = t
+	if lifetime, ok := maxAge(r); ok {
+		t.lifetimeTimer = time.AfterFunc(lifetime, func() {
+			b.remove(t)
+		})
+	}
+	b.mutex.Unlock()
+
+	segments := append(strings.Split(b.collection, "/"), strings.Split(name, "/")...)
+	opts := make([]message.Option, 0, len(segments))
+	for _, s := range segments {
+		opts = append(opts, message.Option{ID: message.LocationPath, Value: []byte(s)})
+	}
+	setResponse(w, codes.Created, message.TextPlain, nil, opts...)
+}
+
+// read answers by the last publication and subscribes by Observe. GET without Observe of the topic without data
+// is answered by 4.04 (Not Found).
+func (b *Broker) read(t *topic, w mux.ResponseWriter, r *mux.Message) {
+	if !r.Options.HasOption(message.Observe) {
+		b.mutex.Lock()
+		hasData := t.hasData
+		b.mutex.Unlock()
+		if !hasData {
+			setResponse(w, codes.NotFound, message.TextPlain, nil)
+			return
+		}
+	}
+	t.observable.ServeCOAP(w, r)
+}
+
+// publish notifies the subscribers of the topic by the body of the request.
+func (b *Broker) publish(t *topic, w mux.ResponseWriter, r *mux.Message) {
+	ct, err := r.Options.ContentFormat()
+	if err != nil {
+		ct = message.TextPlain
+	}
+	if t.hasContentFormat && ct != t.contentFormat {
+		setResponse(w, codes.UnsupportedMediaType, message.TextPlain, nil)
+		return
+	}
+	var payload []byte
+	if r.Body != nil {
+		payload, err = io.ReadAll(r.Body)
+		if err != nil {
+			setError(w, codes.BadRequest, err)
+			return
+		}
+	}
+	b.mutex.Lock()
+	if b.topics[t.name] != t {
+		b.mutex.Unlock()
+		setResponse(w, codes.NotFound, message.TextPlain, nil)
+		return
+	}
+	t.hasData = true
+	t.dataGeneration++
+	if t.dataTimer != nil {
+		t.dataTimer.Stop()
+		t.dataTimer = nil
+	}
+	if lifetime, ok := maxAge(r); ok {
+		generation := t.dataGeneration
+		t.dataTimer = time.AfterFunc(lifetime, func() {
+			b.expireData(t, generation)
+		})
+	}
+	b.mutex.Unlock()
+	t.observable.Update(ct, payload)
+	setResponse(w, codes.Changed, message.TextPlain, nil)
+}
+
+// expireData removes the publication whose Max-Age elapsed, subscribers are notified by the next one.
+func (b *Broker) expireData(t *topic, generation uint64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if t.dataGeneration == generation {
+		t.hasData = false
+	}
+}
+
+// remove removes the topic, its subscribers are deregistered.
+func (b *Broker) remove(t *topic) {
+	b.mutex.Lock()
+	if b.topics[t.name] != t {
+		b.mutex.Unlock()
+		return
+	}
+	delete(b.topics, t.name)
+	b.mutex.Unlock()
+	t.stop()
+}
@@ -0,0 +1,124 @@
+package pubsub_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/pubsub"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	b := pubsub.NewBroker("/ps", pubsub.WithMaxTopics(2))
+	defer b.Close()
+	m := mux.NewRouter()
+	require.NoError(t, b.Handle(m))
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	c := pubsub.NewClient(cc.Client(), "/ps")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	json := message.AppJSON
+	require.NoError(t, c.Create(ctx, "temp", &json))
+	require.Error(t, c.Create(ctx, "temp", nil))
+	// the topic expires by Max-Age of the create request
+	require.NoError(t, c.Create(ctx, "tmp/short", nil, message.Option{ID: message.MaxAge, Value: []byte{1}}))
+	require.Error(t, c.Create(ctx, "over-limit", nil))
+
+	topics, err := c.Discover(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"temp", "tmp/short"}, topics)
+	topics, err = c.Discover(ctx, "ct=50")
+	require.NoError(t, err)
+	require.Equal(t, []string{"temp"}, topics)
+
+	publications := make(chan string, 4)
+	obs, err := c.Subscribe(ctx, "temp", func(contentFormat message.MediaType, payload []byte) {
+		publications <- string(payload)
+	})
+	require.NoError(t, err)
+	// the topic has no data yet
+	require.Equal(t, "", <-publications)
+
+	require.NoError(t, c.Publish(ctx, "temp", message.AppJSON, []byte(`{"t":20}`)))
+	require.Equal(t, `{"t":20}`, <-publications)
+	// publication in other content format than the one of the topic
+	require.Error(t, c.Publish(ctx, "temp", message.TextPlain, []byte("20")))
+	require.Error(t, c.Publish(ctx, "unknown", message.TextPlain, []byte("20")))
+	require.NoError(t, obs.Cancel(ctx))
+
+	require.Eventually(t, func() bool {
+		return len(b.Topics()) == 1
+	}, time.Second*3, time.Millisecond*50)
+	require.NoError(t, c.Remove(ctx, "temp"))
+	require.Empty(t, b.Topics())
+	require.Error(t, c.Remove(ctx, "temp"))
+}
+
+func TestBroker_DataMaxAge(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	b := pubsub.NewBroker("ps")
+	defer b.Close()
+	m := mux.NewRouter()
+	require.NoError(t, b.Handle(m))
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	c := pubsub.NewClient(cc.Client(), "ps")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, c.Create(ctx, "a", nil))
+	resp, err := cc.Get(ctx, "/ps/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.NotFound, resp.Code())
+
+	require.NoError(t, c.Publish(ctx, "a", message.TextPlain, []byte("v"), message.Option{ID: message.MaxAge, Value: []byte{1}}))
+	resp, err = cc.Get(ctx, "/ps/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	// the publication expires by its Max-Age
+	require.Eventually(t, func() bool {
+		resp, err := cc.Get(ctx, "/ps/a")
+		return err == nil && resp.Code() == codes.NotFound
+	}, time.Second*3, time.Millisecond*100)
+}
@@ -0,0 +1,132 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// PublicationFunc is called with publications of the subscribed topic.
+type PublicationFunc = func(contentFormat message.MediaType, payload []byte)
+
+// Client publishes and subscribes topics of the broker over the connection, e.g. udp or tcp client.
+type Client struct {
+	cc         mux.Client
+	collection string
+}
+
+// NewClient creates client of the topic collection at the path, e.g. "/ps".
+func NewClient(cc mux.Client, collection string) *Client {
+	return &Client{
+		cc:         cc,
+		collection: strings.Trim(collection, "/"),
+	}
+}
+
+func (c *Client) topicPath(topic string) string {
+	return "/" + c.collection + "/" + strings.Trim(topic, "/")
+}
+
+func readBody(resp *message.Message) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func checkCode(resp *message.Message, expected codes.Code, operation string) error {
+	if resp.Code == expected {
+		return nil
+	}
+	payload, _ := readBody(resp)
+	if len(payload) > 0 {
+		return fmt.Errorf("cannot %v: %v: %s", operation, resp.Code, payload)
+	}
+	return fmt.Errorf("cannot %v: %v", operation, resp.Code)
+}
+
+// Create creates the topic, the content format of its publications is set when ct isn't nil. Max-Age option sets
+// lifetime of the topic.
+func (c *Client) Create(ctx context.Context, topic string, ct *message.MediaType, opts ...message.Option) error {
+	link := linkformat.Resource{Href: strings.Trim(topic, "/")}
+	if ct != nil {
+		link.ContentFormats = []message.MediaType{*ct}
+	}
+	resp, err := c.cc.Post(ctx, "/"+c.collection, message.AppLinkFormat, bytes.NewReader([]byte(link.String())), opts...)
+	if err != nil {
+		return err
+	}
+	return checkCode(resp, codes.Created, "create topic "+topic)
+}
+
+// Discover returns names of the topics which match the queries, e.g. "ct=50".
+func (c *Client) Discover(ctx context.Context, queries ...string) ([]string, error) {
+	opts := make([]message.Option, 0, len(queries))
+	for _, q := range queries {
+		opts = append(opts, message.Option{ID: message.URIQuery, Value: []byte(q)})
+	}
+	resp, err := c.cc.Get(ctx, "/"+c.collection, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCode(resp, codes.Content, "discover topics"); err != nil {
+		return nil, err
+	}
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	links, err := linkformat.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]string, 0, len(links))
+	for _, l := range links {
+		topics = append(topics, strings.TrimPrefix(strings.Trim(l.Href, "/"), c.collection+"/"))
+	}
+	return topics, nil
+}
+
+// Publish publishes the payload to the topic. Max-Age option sets lifetime of the publication.
+func (c *Client) Publish(ctx context.Context, topic string, contentFormat message.MediaType, payload []byte, opts ...message.Option) error {
+	resp, err := c.cc.Put(ctx, c.topicPath(topic), contentFormat, bytes.NewReader(payload), opts...)
+	if err != nil {
+		return err
+	}
+	return checkCode(resp, codes.Changed, "publish to topic "+topic)
+}
+
+// Subscribe observes publications of the topic. The last publication is delivered first, it has empty payload
+// when the topic has no data.
+func (c *Client) Subscribe(ctx context.Context, topic string, onPublication PublicationFunc, opts ...message.Option) (mux.Observation, error) {
+	return c.cc.Observe(ctx, c.topicPath(topic), func(n *message.Message) {
+		if n.Code != codes.Content {
+			return
+		}
+		ct, err := n.Options.ContentFormat()
+		if err != nil {
+			ct = message.TextPlain
+		}
+		payload, err := readBody(n)
+		if err != nil {
+			return
+		}
+		onPublication(ct, payload)
+	}, opts...)
+}
+
+// Remove removes the topic, its subscribers are deregistered.
+func (c *Client) Remove(ctx context.Context, topic string) error {
+	resp, err := c.cc.Delete(ctx, c.topicPath(topic))
+	if err != nil {
+		return err
+	}
+	return checkCode(resp, codes.Deleted, "remove topic "+topic)
+}
@@ -0,0 +1,340 @@
+// Package rd registers endpoints to CoRE Resource Directory (RFC 9176) and looks up registered resources,
+// so devices behind NAT are discoverable. The registration is refreshed periodically before its lifetime expires
+// until it is removed or the connection is closed.
+package rd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+const (
+	// DefaultPath is path of the registration interface.
+	DefaultPath = "/rd"
+	// DefaultLifetime is lifetime of registration without lt parameter.
+	DefaultLifetime = 90000 * time.Second
+	// ResourceLookup is path of the resource lookup interface.
+	ResourceLookup = "/rd-lookup/res"
+	// EndpointLookup is path of the endpoint lookup interface.
+	EndpointLookup = "/rd-lookup/ep"
+)
+
+// ErrorFunc is called with errors of the refresh.
+type ErrorFunc = func(error)
+
+type options struct {
+	path   string
+	sector string
+	base   string
+	errors ErrorFunc
+}
+
+// A Option sets options such as path of the directory, sector, etc.
+type Option interface {
+	apply(*options)
+}
+
+// PathOpt path option.
+type PathOpt struct {
+	path string
+}
+
+func (o PathOpt) apply(opts *options) {
+	opts.path = o.path
+}
+
+// WithPath sets path of the registration interface of the directory, DefaultPath is used by default.
+func WithPath(path string) PathOpt {
+	return PathOpt{path: path}
+}
+
+// SectorOpt sector option.
+type SectorOpt struct {
+	sector string
+}
+
+func (o SectorOpt) apply(opts *options) {
+	opts.sector = o.sector
+}
+
+// WithSector sets sector of the endpoint, d parameter.
+func WithSector(sector string) SectorOpt {
+	return SectorOpt{sector: sector}
+}
+
+// BaseOpt base option.
+type BaseOpt struct {
+	base string
+}
+
+func (o BaseOpt) apply(opts *options) {
+	opts.base = o.base
+}
+
+// WithBase sets base URI of the links, base parameter. By default the directory uses address of the endpoint.
+func WithBase(base string) BaseOpt {
+	return BaseOpt{base: base}
+}
+
+// ErrorsOpt errors option.
+type ErrorsOpt struct {
+	errors ErrorFunc
+}
+
+func (o ErrorsOpt) apply(opts *options) {
+	opts.errors = o.errors
+}
+
+// WithErrors sets function for logging errors of the refresh.
+func WithErrors(errors ErrorFunc) ErrorsOpt {
+	return ErrorsOpt{errors: errors}
+}
+
+// Registration is registration of the endpoint in the directory.
+type Registration struct {
+	cc       mux.Client
+	endpoint string
+	links    []linkformat.Resource
+	opts     options
+
+	mutex    sync.Mutex
+	location string
+	lifetime time.Duration
+	timer    *time.Timer
+	removed  bool
+	done     chan struct{}
+}
+
+// Register registers the endpoint with its links to the directory over the connection. The registration is
+// refreshed before the lifetime expires, zero lifetime means DefaultLifetime.
+func Register(ctx context.Context, cc mux.Client, endpointName string, lifetime time.Duration, links []linkformat.Resource, opt ...Option) (*Registration, error) {
+	opts := options{
+		path:   DefaultPath,
+		errors: func(err error) { fmt.Println(err) },
+	}
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+	if opts.errors == nil {
+		opts.errors = func(error) {}
+	}
+	if lifetime <= 0 {
+		lifetime = DefaultLifetime
+	}
+	r := &Registration{
+		cc:       cc,
+		endpoint: endpointName,
+		links:    links,
+		opts:     opts,
+		lifetime: lifetime,
+		done:     make(chan struct{}),
+	}
+	if err := r.register(ctx); err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	r.scheduleLocked()
+	r.mutex.Unlock()
+	go func() {
+		select {
+		case <-cc.Done():
+			r.stop()
+		case <-r.done:
+		}
+	}()
+	return r, nil
+}
+
+func queryOption(name, value string) message.Option {
+	return message.Option{ID: message.URIQuery, Value: []byte(name + "=" + value)}
+}
+
+func lifetimeSeconds(lifetime time.Duration) string {
+	s := int64(lifetime / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return strconv.FormatInt(s, 10)
+}
+
+func checkCode(resp *message.Message, expected codes.Code, operation string) error {
+	if resp.Code == expected {
+		return nil
+	}
+	return fmt.Errorf("cannot %v: %v", operation, resp.Code)
+}
+
+// register posts the links to the registration interface and stores the location of the registration.
+func (r *Registration) register(ctx context.Context) error {
+	r.mutex.Lock()
+	lifetime := r.lifetime
+	r.mutex.Unlock()
+	opts := []message.Option{
+		queryOption("ep", r.endpoint),
+		queryOption("lt", lifetimeSeconds(lifetime)),
+	}
+	if r.opts.sector != "" {
+		opts = append(opts, queryOption("d", r.opts.sector))
+	}
+	if r.opts.base != "" {
+		opts = append(opts, queryOption("base", r.opts.base))
+	}
+	resp, err := r.cc.Post(ctx, r.opts.path, message.AppLinkFormat, bytes.NewReader(linkformat.Encode(r.links)), opts...)
+	if err != nil {
+		return fmt.Errorf("cannot register endpoint %v: %w", r.endpoint, err)
+	}
+	if err := checkCode(resp, codes.Created, "register endpoint "+r.endpoint); err != nil {
+		return err
+	}
+	location, err := resp.Options.LocationPath()
+	if err != nil {
+		return fmt.Errorf("cannot register endpoint %v: missing location of the registration", r.endpoint)
+	}
+	r.mutex.Lock()
+	r.location = "/" + strings.TrimPrefix(location, "/")
+	r.mutex.Unlock()
+	return nil
+}
+
+// Location returns path of the registration resource assigned by the directory.
+func (r *Registration) Location() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.location
+}
+
+// scheduleLocked plans the refresh when three quarters of the lifetime elapsed.
+func (r *Registration) scheduleLocked() {
+	if r.removed {
+		return
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(r.lifetime*3/4, func() {
+		ctx, cancel := context.WithTimeout(r.cc.Context(), r.lifetime/4)
+		defer cancel()
+		if err := r.Refresh(ctx); err != nil {
+			r.opts.errors(err)
+		}
+	})
+}
+
+// Refresh extends the registration by its lifetime. When the directory doesn't know the registration anymore,
+// the endpoint is registered again.
+func (r *Registration) Refresh(ctx context.Context) error {
+	return r.update(ctx, nil)
+}
+
+// Update changes lifetime of the registration.
+func (r *Registration) Update(ctx context.Context, lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return errors.New("invalid lifetime")
+	}
+	return r.update(ctx, &lifetime)
+}
+
+func (r *Registration) update(ctx context.Context, lifetime *time.Duration) error {
+	r.mutex.Lock()
+	if r.removed {
+		r.mutex.Unlock()
+		return errors.New("registration was removed")
+	}
+	location := r.location
+	if lifetime != nil {
+		r.lifetime = *lifetime
+	}
+	var opts []message.Option
+	if lifetime != nil {
+		opts = append(opts, queryOption("lt", lifetimeSeconds(*lifetime)))
+	}
+	r.mutex.Unlock()
+
+	resp, err := r.cc.Post(ctx, location, message.TextPlain, nil, opts...)
+	if err != nil {
+		return fmt.Errorf("cannot update registration of endpoint %v: %w", r.endpoint, err)
+	}
+	switch resp.Code {
+	case codes.Changed:
+	case codes.NotFound:
+		// the registration expired or the directory restarted
+		if err := r.register(ctx); err != nil {
+			return err
+		}
+	default:
+		return checkCode(resp, codes.Changed, "update registration of endpoint "+r.endpoint)
+	}
+	r.mutex.Lock()
+	r.scheduleLocked()
+	r.mutex.Unlock()
+	return nil
+}
+
+// stop stops the refresh.
+func (r *Registration) stop() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.removed {
+		return false
+	}
+	r.removed = true
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	close(r.done)
+	return true
+}
+
+// Remove removes the registration from the directory and stops the refresh.
+func (r *Registration) Remove(ctx context.Context) error {
+	if !r.stop() {
+		return nil
+	}
+	resp, err := r.cc.Delete(ctx, r.Location())
+	if err != nil {
+		return fmt.Errorf("cannot remove registration of endpoint %v: %w", r.endpoint, err)
+	}
+	if resp.Code == codes.NotFound {
+		return nil
+	}
+	return checkCode(resp, codes.Deleted, "remove registration of endpoint "+r.endpoint)
+}
+
+// Lookup looks up resources or endpoints by the lookup interface at the path, e.g. ResourceLookup, filtered
+// by the queries, e.g. "rt=temperature" or "ep=node1".
+func Lookup(ctx context.Context, cc mux.Client, path string, queries ...string) ([]linkformat.Resource, error) {
+	opts := make([]message.Option, 0, len(queries))
+	for _, q := range queries {
+		opts = append(opts, message.Option{ID: message.URIQuery, Value: []byte(q)})
+	}
+	resp, err := cc.Get(ctx, path, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lookup %v: %w", path, err)
+	}
+	if err := checkCode(resp, codes.Content, "lookup "+path); err != nil {
+		return nil, err
+	}
+	if ct, err := resp.Options.ContentFormat(); err == nil && ct != message.AppLinkFormat {
+		return nil, fmt.Errorf("cannot lookup %v: unexpected content format %v", path, ct)
+	}
+	if resp.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot lookup %v: %w", path, err)
+	}
+	return linkformat.Parse(data)
+}
@@ -0,0 +1,132 @@
+package rd_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/rd"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+// directory is a minimal resource directory which forgets the first registration on its refresh.
+type directory struct {
+	mutex         sync.Mutex
+	registrations map[string][]byte
+	queries       []string
+	next          int
+	refreshes     int
+}
+
+func (d *directory) handle(m *mux.Router) {
+	m.HandleFunc("/rd", func(w mux.ResponseWriter, r *mux.Message) {
+		queries, _ := r.Options.Queries()
+		links, _ := io.ReadAll(r.Body)
+		d.mutex.Lock()
+		d.next++
+		id := strconv.Itoa(d.next)
+		d.registrations[id] = links
+		d.queries = queries
+		d.mutex.Unlock()
+		w.SetResponse(codes.Created, message.TextPlain, nil,
+			message.Option{ID: message.LocationPath, Value: []byte("reg")},
+			message.Option{ID: message.LocationPath, Value: []byte(id)})
+	})
+	m.HandleFunc("/reg/{id}", func(w mux.ResponseWriter, r *mux.Message) {
+		id := mux.Vars(r)["id"]
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if _, ok := d.registrations[id]; !ok {
+			w.SetResponse(codes.NotFound, message.TextPlain, nil)
+			return
+		}
+		switch r.Code {
+		case codes.POST:
+			d.refreshes++
+			if id == "1" {
+				delete(d.registrations, id)
+				w.SetResponse(codes.NotFound, message.TextPlain, nil)
+				return
+			}
+			w.SetResponse(codes.Changed, message.TextPlain, nil)
+		case codes.DELETE:
+			delete(d.registrations, id)
+			w.SetResponse(codes.Deleted, message.TextPlain, nil)
+		}
+	})
+	m.HandleFunc(rd.ResourceLookup, func(w mux.ResponseWriter, r *mux.Message) {
+		d.mutex.Lock()
+		var links [][]byte
+		for _, l := range d.registrations {
+			links = append(links, l)
+		}
+		d.mutex.Unlock()
+		w.SetResponse(codes.Content, message.AppLinkFormat, bytes.NewReader(bytes.Join(links, []byte(","))))
+	})
+}
+
+func TestRegister(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	d := &directory{registrations: make(map[string][]byte)}
+	m := mux.NewRouter()
+	d.handle(m)
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	links := []linkformat.Resource{{Href: "/sensors/temp", ResourceTypes: []string{"temperature"}}}
+	reg, err := rd.Register(ctx, cc.Client(), "node1", time.Second, links, rd.WithSector("home"), rd.WithErrors(func(err error) {
+		require.NoError(t, err)
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "/reg/1", reg.Location())
+	d.mutex.Lock()
+	require.Equal(t, []string{"ep=node1", "lt=1", "d=home"}, d.queries)
+	d.mutex.Unlock()
+
+	// the directory forgot the registration, so it is registered again by the refresh
+	require.Eventually(t, func() bool {
+		return reg.Location() == "/reg/2"
+	}, time.Second*3, time.Millisecond*50)
+	require.Eventually(t, func() bool {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		return d.refreshes >= 2
+	}, time.Second*3, time.Millisecond*50)
+
+	resources, err := rd.Lookup(ctx, cc.Client(), rd.ResourceLookup, "rt=temperature")
+	require.NoError(t, err)
+	require.Equal(t, links, resources)
+
+	require.NoError(t, reg.Remove(ctx))
+	d.mutex.Lock()
+	require.Empty(t, d.registrations)
+	d.mutex.Unlock()
+	require.Error(t, reg.Refresh(ctx))
+}
@@ -0,0 +1,17 @@
+package coap
+
+import (
+	"context"
+
+	"github.com/plgd-dev/go-coap/v2/net"
+)
+
+// RequestInfo describes transport of a received request, e.g. local address, multicast, cipher suite of DTLS
+// or ALPN protocol of TLS.
+type RequestInfo = net.RequestInfo
+
+// RequestInfoFromContext returns transport of the request whose context is ctx, e.g. r.Context() in handlers
+// of udp, dtls and tcp servers.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	return net.RequestInfoFromContext(ctx)
+}
@@ -0,0 +1,119 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// Client signs requests sent over the connection, e.g. udp or tcp client.
+type Client struct {
+	mux.Client
+	sign SignFunc
+}
+
+// NewClient creates client which signs requests by the sign function.
+func NewClient(cc mux.Client, sign SignFunc) *Client {
+	return &Client{
+		Client: cc,
+		sign:   sign,
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, code codes.Code, path string, contentFormat *message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*message.Message, error) {
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get token: %w", err)
+	}
+	options := make(message.Options, 0, len(opts)+8)
+	for _, o := range opts {
+		options = options.Add(o)
+	}
+	buf := make([]byte, len(path)+4)
+	options, n, err := options.SetPath(buf, path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set path: %w", err)
+	}
+	if contentFormat != nil {
+		options, _, err = options.SetContentFormat(buf[n:], *contentFormat)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set content format: %w", err)
+		}
+	}
+	req := &message.Message{
+		Context: ctx,
+		Code:    code,
+		Token:   token,
+		Options: options,
+		Body:    payload,
+	}
+	if err := Sign(ctx, req, c.sign); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (c *Client) do(ctx context.Context, code codes.Code, path string, contentFormat *message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*message.Message, error) {
+	req, err := c.newRequest(ctx, code, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
+
+// Get issues a signed GET to the specified path.
+func (c *Client) Get(ctx context.Context, path string, opts ...message.Option) (*message.Message, error) {
+	return c.do(ctx, codes.GET, path, nil, nil, opts...)
+}
+
+// Delete issues a signed DELETE to the specified path.
+func (c *Client) Delete(ctx context.Context, path string, opts ...message.Option) (*message.Message, error) {
+	return c.do(ctx, codes.DELETE, path, nil, nil, opts...)
+}
+
+// Post issues a signed POST to the specified path.
+func (c *Client) Post(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*message.Message, error) {
+	return c.do(ctx, codes.POST, path, &contentFormat, payload, opts...)
+}
+
+// Put issues a signed PUT to the specified path.
+func (c *Client) Put(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*message.Message, error) {
+	return c.do(ctx, codes.PUT, path, &contentFormat, payload, opts...)
+}
+
+// Observe registers a signed observation of the path. The signature is valid also for the deregistration,
+// because it doesn't cover the Observe option.
+func (c *Client) Observe(ctx context.Context, path string, observeFunc func(notification *message.Message), opts ...message.Option) (mux.Observation, error) {
+	req, err := c.newRequest(ctx, codes.GET, path, nil, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := req.Options.GetBytes(OptionID)
+	if err != nil {
+		return nil, err
+	}
+	signed := make([]message.Option, 0, len(opts)+1)
+	signed = append(signed, opts...)
+	signed = append(signed, message.Option{ID: OptionID, Value: sig})
+	return c.Client.Observe(ctx, path, observeFunc, signed...)
+}
+
+// WriteMessage signs the request and sends it without waiting for the response.
+func (c *Client) WriteMessage(req *message.Message) error {
+	if err := Sign(req.Context, req, c.sign); err != nil {
+		return err
+	}
+	return c.Client.WriteMessage(req)
+}
+
+// Do signs the request and sends it.
+func (c *Client) Do(req *message.Message) (*message.Message, error) {
+	if err := Sign(req.Context, req, c.sign); err != nil {
+		return nil, err
+	}
+	return c.Client.Do(req)
+}
@@ -0,0 +1,169 @@
+// Package signature protects integrity of requests at the application layer for deployments which aren't ready
+// for OSCORE. The client signs canonical serialization of the request and carries the signature in the Signature
+// option, the server verifies it by the middleware and answers 4.01 Unauthorized when it fails.
+//
+// The signature covers the code, the options and the payload of the request. Token, message ID and options
+// maintained by the transport (Uri-Host, Uri-Port, Observe, Block1, Block2, Size1, Size2, Echo and Request-Tag)
+// aren't covered, so the signed request can be split to blocks or repeated with Echo. It doesn't prevent replay
+// of the request.
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// OptionID is the Signature option from the private range, it is elective and safe to forward.
+const OptionID message.OptionID = 65012
+
+// MaxLength is the maximal length of the signature.
+const MaxLength = 255
+
+// ErrInvalidSignature is returned by VerifyFunc when the signature doesn't match the request.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+func init() {
+	if err := message.RegisterOption(OptionID, "Signature", message.ValueOpaque, 1, MaxLength, false); err != nil {
+		panic(err)
+	}
+}
+
+// SignFunc returns signature of the canonical serialization of the request.
+type SignFunc = func(ctx context.Context, data []byte) ([]byte, error)
+
+// VerifyFunc verifies signature of the canonical serialization of the request. The context of the request
+// allows to choose the key by the peer, e.g. by tenant.Identity.
+type VerifyFunc = func(ctx context.Context, data, signature []byte) error
+
+// unsigned are options maintained by the transport, so they aren't covered by the signature.
+var unsigned = map[message.OptionID]bool{
+	OptionID:           true,
+	message.URIHost:    true,
+	message.URIPort:    true,
+	message.Observe:    true,
+	message.Block1:     true,
+	message.Block2:     true,
+	message.Size1:      true,
+	message.Size2:      true,
+	message.Echo:       true,
+	message.RequestTag: true,
+}
+
+// Canonical returns serialization of the request which is signed: the code, count of the signed options, each
+// of them as uvarint ID, uvarint length and value ordered by ID, and the payload.
+func Canonical(code codes.Code, options message.Options, payload []byte) []byte {
+	opts := make(message.Options, 0, len(options))
+	for _, o := range options {
+		if !unsigned[o.ID] {
+			opts = append(opts, o)
+		}
+	}
+	sort.SliceStable(opts, func(i, j int) bool {
+		return opts[i].ID < opts[j].ID
+	})
+	var buf bytes.Buffer
+	var v [binary.MaxVarintLen64]byte
+	buf.WriteByte(byte(code))
+	buf.Write(v[:binary.PutUvarint(v[:], uint64(len(opts)))])
+	for _, o := range opts {
+		buf.Write(v[:binary.PutUvarint(v[:], uint64(o.ID))])
+		buf.Write(v[:binary.PutUvarint(v[:], uint64(len(o.Value)))])
+		buf.Write(o.Value)
+	}
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// readPayload reads the whole body and rewinds it for the next reader.
+func readPayload(body io.ReadSeeker) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Sign signs the request and sets the signature to its Signature option.
+func Sign(ctx context.Context, req *message.Message, sign SignFunc) error {
+	payload, err := readPayload(req.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read payload: %w", err)
+	}
+	sig, err := sign(ctx, Canonical(req.Code, req.Options, payload))
+	if err != nil {
+		return fmt.Errorf("cannot sign request: %w", err)
+	}
+	if len(sig) == 0 || len(sig) > MaxLength {
+		return fmt.Errorf("cannot sign request: invalid length of signature %v", len(sig))
+	}
+	req.Options = req.Options.Set(message.Option{ID: OptionID, Value: sig})
+	return nil
+}
+
+// Verify verifies the Signature option of the request.
+func Verify(ctx context.Context, req *message.Message, verify VerifyFunc) error {
+	sig, err := req.Options.GetBytes(OptionID)
+	if err != nil {
+		return fmt.Errorf("missing signature: %w", err)
+	}
+	payload, err := readPayload(req.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read payload: %w", err)
+	}
+	return verify(ctx, Canonical(req.Code, req.Options, payload), sig)
+}
+
+// Middleware verifies signatures of requests served by the router. The request without valid signature is
+// answered by 4.01 Unauthorized and it isn't passed to the handler.
+func Middleware(verify VerifyFunc) mux.MiddlewareFunc {
+	return func(next mux.Handler) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			if err := Verify(r.Context, r.Message, verify); err != nil {
+				_ = w.SetResponse(codes.Unauthorized, message.TextPlain, bytes.NewReader([]byte(err.Error())))
+				return
+			}
+			next.ServeCOAP(w, r)
+		})
+	}
+}
+
+// HMACSigner signs requests by HMAC-SHA256 with the shared key.
+func HMACSigner(key []byte) SignFunc {
+	return func(_ context.Context, data []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	}
+}
+
+// HMACVerifier verifies HMAC-SHA256 signatures by the shared key.
+func HMACVerifier(key []byte) VerifyFunc {
+	sign := HMACSigner(key)
+	return func(ctx context.Context, data, signature []byte) error {
+		expected, _ := sign(ctx, data)
+		if !hmac.Equal(expected, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+}
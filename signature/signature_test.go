@@ -0,0 +1,104 @@
+package signature_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/signature"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	opts := message.Options{
+		{ID: message.URIQuery, Value: []byte("b")},
+		{ID: message.URIPath, Value: []byte("a")},
+		{ID: message.URIQuery, Value: []byte("c")},
+		{ID: message.Observe, Value: []byte{0}},
+	}
+	data := signature.Canonical(codes.GET, opts, []byte("p"))
+	require.Equal(t, []byte{byte(codes.GET), 3, 11, 1, 'a', 15, 1, 'b', 15, 1, 'c', 'p'}, data)
+	// options maintained by the transport aren't signed
+	require.Equal(t, data, signature.Canonical(codes.GET, opts[:3], []byte("p")))
+}
+
+func TestMiddleware(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	key := []byte("secret")
+	m := mux.NewRouter()
+	m.Use(signature.Middleware(signature.HMACVerifier(key)))
+	m.HandleFunc("/a", func(w mux.ResponseWriter, r *mux.Message) {
+		var payload []byte
+		if r.Body != nil {
+			payload, _ = io.ReadAll(r.Body)
+		}
+		if _, err := r.Options.Observe(); err == nil {
+			_ = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("obs")), message.Option{ID: message.Observe, Value: []byte{2}})
+			return
+		}
+		_ = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(payload))
+	})
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c := signature.NewClient(cc.Client(), signature.HMACSigner(key))
+	resp, err := c.Get(ctx, "/a", message.Option{ID: message.URIQuery, Value: []byte("q=1")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code)
+	resp, err = c.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	notifications := make(chan struct{}, 1)
+	obs, err := c.Observe(ctx, "/a", func(n *message.Message) {
+		if n.Code == codes.Content {
+			select {
+			case notifications <- struct{}{}:
+			default:
+			}
+		}
+	})
+	require.NoError(t, err)
+	<-notifications
+	require.NoError(t, obs.Cancel(ctx))
+
+	// unsigned request
+	resp, err = cc.Client().Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Unauthorized, resp.Code)
+
+	// signed by other key
+	other := signature.NewClient(cc.Client(), signature.HMACSigner([]byte("other")))
+	resp, err = other.Put(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Unauthorized, resp.Code)
+}
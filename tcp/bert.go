@@ -0,0 +1,25 @@
+package tcp
+
+import (
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+)
+
+// bertHeaderReserve is part of the message size reserved for the header and options of a BERT block.
+const bertHeaderReserve = 1024
+
+// blockwiseParams returns block size and maximal message size of blockwise transfers with the peer.
+func (s *Session) blockwiseParams() (blockwise.SZX, int) {
+	if !s.bert {
+		return s.peerSZX(s.blockwiseSZX), s.maxMessageSize
+	}
+	maxMessageSize := s.maxMessageSize
+	if peer := int(s.PeerMaxMessageSize()); peer > 0 && (maxMessageSize <= 0 || peer < maxMessageSize) {
+		maxMessageSize = peer
+	}
+	payloadSize := maxMessageSize - bertHeaderReserve
+	if payloadSize < 2*int(blockwise.SZXBERT.Size()) {
+		// a BERT block would carry only 1024 bytes
+		return blockwise.SZX1024, maxMessageSize
+	}
+	return blockwise.SZXBERT, payloadSize
+}
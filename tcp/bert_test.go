@@ -0,0 +1,130 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession_blockwiseParams(t *testing.T) {
+	tests := []struct {
+		name               string
+		bert               bool
+		maxMessageSize     int
+		peerMaxMessageSize uint32
+		wantSZX            blockwise.SZX
+		wantMaxMessageSize int
+	}{
+		{
+			name:               "disabled",
+			maxMessageSize:     64 * 1024,
+			peerMaxMessageSize: 64 * 1024,
+			wantSZX:            blockwise.SZX512,
+			wantMaxMessageSize: 64 * 1024,
+		},
+		{
+			name:               "bert",
+			bert:               true,
+			maxMessageSize:     64 * 1024,
+			peerMaxMessageSize: 8 * 1024,
+			wantSZX:            blockwise.SZXBERT,
+			wantMaxMessageSize: 7 * 1024,
+		},
+		{
+			name:               "peer without max message size",
+			bert:               true,
+			maxMessageSize:     16 * 1024,
+			wantSZX:            blockwise.SZXBERT,
+			wantMaxMessageSize: 15 * 1024,
+		},
+		{
+			name:               "fallback to 1024",
+			bert:               true,
+			maxMessageSize:     64 * 1024,
+			peerMaxMessageSize: 2 * 1024,
+			wantSZX:            blockwise.SZX1024,
+			wantMaxMessageSize: 2 * 1024,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Session{
+				bert:               tt.bert,
+				maxMessageSize:     tt.maxMessageSize,
+				peerMaxMessageSize: tt.peerMaxMessageSize,
+				blockwiseSZX:       blockwise.SZX512,
+			}
+			szx, maxMessageSize := s.blockwiseParams()
+			require.Equal(t, tt.wantSZX, szx)
+			require.Equal(t, tt.wantMaxMessageSize, maxMessageSize)
+		})
+	}
+}
+
+func TestClientConn_BERT(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 2*1024)
+	s := NewServer(WithBlockwise(true, blockwise.SZX1024, time.Second*5), WithBERT(), WithMaxMessageSize(8*1024),
+		WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+			err := w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(payload))
+			require.NoError(t, err)
+		}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var m sync.Mutex
+	var blocks []trace.Block
+	cc, err := Dial(l.Addr().String(), WithBlockwise(true, blockwise.SZX1024, time.Second*5), WithBERT(), WithMaxMessageSize(64*1024),
+		WithTrace(func(e trace.Event) {
+			if e.Type == trace.BlockwiseStep && !e.Block.Sent {
+				m.Lock()
+				defer m.Unlock()
+				blocks = append(blocks, e.Block)
+			}
+		}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// CSM of the server is processed asynchronously
+	require.Eventually(t, cc.Session().PeerBlockWiseTransferEnabled, time.Second, time.Millisecond*10)
+	require.Equal(t, uint32(8*1024), cc.Session().PeerMaxMessageSize())
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := ioutil.ReadAll(resp.Body())
+	require.NoError(t, err)
+	require.Equal(t, payload, body)
+	m.Lock()
+	defer m.Unlock()
+	require.NotEmpty(t, blocks)
+	for _, b := range blocks {
+		require.Equal(t, blockwise.SZXBERT, b.SZX)
+	}
+}
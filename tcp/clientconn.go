@@ -7,11 +7,16 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/metrics"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -19,10 +24,14 @@ import (
 	kitSync "github.com/plgd-dev/kit/sync"
 )
 
+// ErrConnectionClosing is returned for requests issued after CloseGracefully was called.
+var ErrConnectionClosing = errors.New("connection is closing")
+
 var defaultDialOptions = dialOptions{
 	ctx:            context.Background(),
 	maxMessageSize: 64 * 1024,
 	heartBeat:      time.Millisecond * 100,
+	drainTimeout:   DefaultDrainTimeout,
 	handler: func(w *ResponseWriter, r *pool.Message) {
 		switch r.Code() {
 		case codes.POST, codes.PUT, codes.GET, codes.DELETE:
@@ -43,6 +52,7 @@ var defaultDialOptions = dialOptions{
 	blockwiseSZX:             blockwise.SZX1024,
 	blockwiseEnable:          true,
 	blockwiseTransferTimeout: time.Second * 3,
+	controlLaneSize:          DefaultControlLaneSize,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
 	},
@@ -52,19 +62,42 @@ type dialOptions struct {
 	ctx                             context.Context
 	maxMessageSize                  int
 	heartBeat                       time.Duration
+	readIdleTimeout                 time.Duration
+	writeIdleTimeout                time.Duration
+	drainTimeout                    time.Duration
 	handler                         HandlerFunc
 	errors                          ErrorFunc
+	logger                          coapNet.Logger
 	goPool                          GoPoolFunc
 	dialer                          *net.Dialer
 	net                             string
 	blockwiseSZX                    blockwise.SZX
 	blockwiseEnable                 bool
 	blockwiseTransferTimeout        time.Duration
+	blockwiseLimits                 blockwise.Limits
+	blockwiseProgress               blockwise.ProgressFunc
 	disablePeerTCPSignalMessageCSMs bool
 	disableTCPSignalMessageCSM      bool
 	tlsCfg                          *tls.Config
 	closeSocket                     bool
 	createInactivityMonitor         func() inactivity.Monitor
+	observationStore                observation.Store
+	tokenManager                    message.TokenManager
+	backpressure                    Backpressure
+	oscoreContext                   *oscore.Context
+	controlLaneSize                 int
+	traceHandler                    TraceHandler
+	stats                           metrics.Stats
+	bert                            bool
+	csmOptions                      message.Options
+	parserLimits                    message.ParserLimits
+	strictSignaling                 bool
+	csmTimeout                      time.Duration
+	retryPolicy                     *RetryPolicy
+	retryAfter                      RetryAfterPolicy
+	writeTimeout                    time.Duration
+	exchangeTimeout                 time.Duration
+	messagePool                     *pool.Pool
 }
 
 // A DialOption sets options such as credentials, keepalive parameters, etc.
@@ -79,9 +112,19 @@ type Notifier interface {
 // ClientConn represents a virtual connection to a conceptual endpoint, to perform COAPs commands.
 type ClientConn struct {
 	noCopy
-	session                 *Session
+	session                 atomic.Value
 	observationTokenHandler *HandlerContainer
 	observationRequests     *kitSync.Map
+	observationStore        observation.Store
+	observations            *kitSync.Map
+	inFlight                *inFlight
+	tokenManager            message.TokenManager
+	backlogs                *backlogs
+	backpressure            Backpressure
+	retry                   *retrier
+	retryAfter              RetryAfterPolicy
+	newSession              func(conn net.Conn) *Session
+	exchangeTimeout         time.Duration
 }
 
 // Dial creates a client connection to the given target.
@@ -91,13 +134,50 @@ func Dial(target string, opts ...DialOption) (*ClientConn, error) {
 		o.applyDial(&cfg)
 	}
 
-	var conn net.Conn
-	var err error
+	var r *retrier
+	if cfg.retryPolicy != nil {
+		r = newRetrier(cfg.ctx, *cfg.retryPolicy)
+		cfg.ctx = r.ctx
+	}
+	conn, err := dialConn(cfg.ctx, target, &cfg)
+	if err != nil {
+		if r != nil {
+			r.cancel()
+		}
+		return nil, err
+	}
+	cfg.closeSocket = true
+	cc := newClient(conn, cfg)
+	if r != nil {
+		r.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialConn(ctx, target, &cfg)
+		}
+		cc.retry = r
+	}
+	cc.start()
+	return cc, nil
+}
+
+func dialConn(ctx context.Context, target string, cfg *dialOptions) (net.Conn, error) {
 	if cfg.tlsCfg != nil {
-		conn, err = tls.DialWithDialer(cfg.dialer, cfg.net, target, cfg.tlsCfg)
-	} else {
-		conn, err = cfg.dialer.DialContext(cfg.ctx, cfg.net, target)
+		return tls.DialWithDialer(cfg.dialer, cfg.net, target, cfg.tlsCfg)
+	}
+	return cfg.dialer.DialContext(ctx, cfg.net, target)
+}
+
+// DialUnix creates a client connection to the Unix domain socket at the path, e.g. served by Server
+// over coapNet.UnixListener.
+func DialUnix(path string, opts ...DialOption) (*ClientConn, error) {
+	return Dial(path, append(opts, WithNetwork("unix"))...)
+}
+
+// DialPipe creates a client connection over an in-memory pipe to the listener, which is served by Server.
+func DialPipe(l *coapNet.PipeListener, opts ...DialOption) (*ClientConn, error) {
+	cfg := defaultDialOptions
+	for _, o := range opts {
+		o.applyDial(&cfg)
 	}
+	conn, err := l.Dial(cfg.ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -105,19 +185,21 @@ func Dial(target string, opts ...DialOption) (*ClientConn, error) {
 	return Client(conn, opts...), nil
 }
 
-func bwAcquireMessage(ctx context.Context) blockwise.Message {
-	return pool.AcquireMessage(ctx)
+func bwAcquireMessage(messagePool *pool.Pool) func(ctx context.Context) blockwise.Message {
+	return func(ctx context.Context) blockwise.Message {
+		return messagePool.AcquireMessage(ctx)
+	}
 }
 
 func bwReleaseMessage(m blockwise.Message) {
 	pool.ReleaseMessage(m.(*pool.Message))
 }
 
-func bwCreateHandlerFunc(observationRequests *kitSync.Map) func(token message.Token) (blockwise.Message, bool) {
+func bwCreateHandlerFunc(messagePool *pool.Pool, observationRequests *kitSync.Map) func(token message.Token) (blockwise.Message, bool) {
 	return func(token message.Token) (blockwise.Message, bool) {
 		msg, ok := observationRequests.LoadWithFunc(token.String(), func(v interface{}) interface{} {
 			r := v.(message.Message)
-			d := pool.AcquireMessage(r.Context)
+			d := messagePool.AcquireMessage(r.Context)
 			d.ResetOptionsTo(r.Options)
 			d.SetCode(r.Code)
 			d.SetToken(r.Token)
@@ -137,6 +219,19 @@ func Client(conn net.Conn, opts ...DialOption) *ClientConn {
 	for _, o := range opts {
 		o.applyDial(&cfg)
 	}
+	cc := newClient(conn, cfg)
+	cc.start()
+	return cc
+}
+
+// newClient creates client over the connection, it is started by start.
+func newClient(conn net.Conn, cfg dialOptions) *ClientConn {
+	if cfg.logger != nil {
+		cfg.traceHandler = coapNet.LogTraceHandler(cfg.logger, cfg.traceHandler)
+	}
+	if cfg.stats != nil {
+		cfg.traceHandler = metrics.TraceHandler(cfg.stats, cfg.traceHandler)
+	}
 	if cfg.errors == nil {
 		cfg.errors = func(error) {}
 	}
@@ -155,26 +250,39 @@ func Client(conn net.Conn, opts ...DialOption) *ClientConn {
 	}
 
 	observationRequests := kitSync.NewMap()
+	observationTokenHandler := NewHandlerContainer()
+	var cc *ClientConn
+	newSession := func(conn net.Conn) *Session {
+		return newClientSession(conn, &cfg, observationTokenHandler, observationRequests, func() *ClientConn { return cc })
+	}
+	cc = NewClientConn(newSession(conn), observationTokenHandler, observationRequests, cfg.observationStore, cfg.tokenManager, cfg.backpressure, cfg.exchangeTimeout)
+	cc.newSession = newSession
+	cc.retryAfter = cfg.retryAfter
+	return cc
+}
+
+// newClientSession creates session of the client over the connection.
+func newClientSession(conn net.Conn, cfg *dialOptions, observationTokenHandler *HandlerContainer, observationRequests *kitSync.Map, getClientConn func() *ClientConn) *Session {
 	var blockWise *blockwise.BlockWise
 	if cfg.blockwiseEnable {
 		blockWise = blockwise.NewBlockWise(
-			bwAcquireMessage,
+			bwAcquireMessage(cfg.messagePool),
 			bwReleaseMessage,
 			cfg.blockwiseTransferTimeout,
 			cfg.errors,
 			false,
-			bwCreateHandlerFunc(observationRequests),
+			bwCreateHandlerFunc(cfg.messagePool, observationRequests),
+			blockwise.WithLimits(cfg.blockwiseLimits),
+			blockwise.WithProgress(cfg.blockwiseProgress),
 		)
 	}
 
-	observationTokenHandler := NewHandlerContainer()
 	monitor := cfg.createInactivityMonitor()
-	var cc *ClientConn
 	l := coapNet.NewConn(conn, coapNet.WithHeartBeat(cfg.heartBeat), coapNet.WithOnReadTimeout(func() error {
-		monitor.CheckInactivity(cc)
+		monitor.CheckInactivity(getClientConn())
 		return nil
-	}))
-	session := NewSession(cfg.ctx,
+	}), coapNet.WithReadIdleTimeout(cfg.readIdleTimeout), coapNet.WithWriteIdleTimeout(cfg.writeIdleTimeout))
+	return NewSession(cfg.ctx,
 		l,
 		NewObservationHandler(observationTokenHandler, cfg.handler),
 		cfg.maxMessageSize,
@@ -186,35 +294,104 @@ func Client(conn net.Conn, opts ...DialOption) *ClientConn {
 		cfg.disableTCPSignalMessageCSM,
 		cfg.closeSocket,
 		monitor,
+		cfg.oscoreContext,
+		cfg.controlLaneSize,
+		cfg.traceHandler,
+		cfg.bert,
+		cfg.drainTimeout,
+		cfg.csmOptions,
+		cfg.parserLimits,
+		cfg.strictSignaling,
+		cfg.csmTimeout,
+		cfg.writeTimeout,
+		cfg.messagePool,
 	)
-	cc = NewClientConn(session, observationTokenHandler, observationRequests)
+}
 
+// start runs the client, errors of the connection are reported to errors handler of the session.
+func (cc *ClientConn) start() {
+	if cc.retry != nil {
+		go cc.retry.run(cc)
+		return
+	}
 	go func() {
 		err := cc.Run()
 		if err != nil {
-			cfg.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+			cc.Session().errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
 		}
 	}()
-
-	return cc
 }
 
 // NewClientConn creates connection over session and observation.
-func NewClientConn(session *Session, observationTokenHandler *HandlerContainer, observationRequests *kitSync.Map) *ClientConn {
-	return &ClientConn{
-		session:                 session,
+func NewClientConn(session *Session, observationTokenHandler *HandlerContainer, observationRequests *kitSync.Map, observationStore observation.Store, tokenManager message.TokenManager, backpressure Backpressure, exchangeTimeout time.Duration) *ClientConn {
+	if tokenManager == nil {
+		tokenManager = message.NewTokenManager(message.DefaultTokenLength)
+	}
+	cc := &ClientConn{
 		observationTokenHandler: observationTokenHandler,
 		observationRequests:     observationRequests,
-	}
+		observationStore:        observationStore,
+		observations:            kitSync.NewMap(),
+		inFlight:                newInFlight(),
+		tokenManager:            tokenManager,
+		backlogs:                newBacklogs(),
+		backpressure:            backpressure,
+		exchangeTimeout:         exchangeTimeout,
+	}
+	cc.session.Store(session)
+	session.traceSession()
+	return cc
 }
 
 func (cc *ClientConn) Session() *Session {
-	return cc.session
+	return cc.session.Load().(*Session)
 }
 
 // Close closes connection without wait of ends Run function.
 func (cc *ClientConn) Close() error {
-	return cc.session.Close()
+	if cc.retry != nil {
+		cc.retry.cancel()
+	}
+	return cc.Session().Close()
+}
+
+// CloseGracefully rejects new requests, waits until requests in progress and blockwise transfers
+// are finished, cancels observations at the server and closes the connection. When ctx is done
+// before that, the connection is closed immediately and ctx error is returned. Records in
+// the observation store are kept, so observations can be restored later.
+func (cc *ClientConn) CloseGracefully(ctx context.Context) error {
+	err := cc.drain(ctx)
+	if err == nil {
+		err = cc.cancelObservations(ctx)
+	}
+	errClose := cc.Close()
+	if err != nil {
+		return err
+	}
+	return errClose
+}
+
+func (cc *ClientConn) drain(ctx context.Context) error {
+	select {
+	case <-cc.inFlight.drain():
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-cc.Context().Done():
+		return nil
+	}
+	if cc.Session().blockWise == nil {
+		return nil
+	}
+	for cc.Session().blockWise.HasPendingTransfers() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-cc.Context().Done():
+			return nil
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	return nil
 }
 
 func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
@@ -222,8 +399,9 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 	if token == nil {
 		return nil, fmt.Errorf("invalid token")
 	}
+	session := cc.Session()
 	respChan := make(chan *pool.Message, 1)
-	err := cc.session.TokenHandler().Insert(token, func(w *ResponseWriter, r *pool.Message) {
+	err := session.TokenHandler().Insert(token, func(w *ResponseWriter, r *pool.Message) {
 		r.Hijack()
 		select {
 		case respChan <- r:
@@ -233,8 +411,9 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot add token handler: %w", err)
 	}
-	defer cc.session.TokenHandler().Pop(token)
-	err = cc.session.WriteMessage(req)
+	defer session.TokenHandler().Pop(token)
+	start := time.Now()
+	err = session.WriteMessage(req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot write request: %w", err)
 	}
@@ -242,13 +421,35 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 	select {
 	case <-req.Context().Done():
 		return nil, req.Context().Err()
-	case <-cc.session.Context().Done():
-		return nil, fmt.Errorf("connection was closed: %w", cc.Context().Err())
+	case <-session.Context().Done():
+		return nil, fmt.Errorf("connection was closed: %w", session.Context().Err())
 	case resp := <-respChan:
+		session.traceElapsed(trace.ExchangeFinished, resp, time.Since(start))
 		return resp, nil
 	}
 }
 
+// acquireToken replaces token of the request by a token of the token manager, which must be released when
+// the exchange is finished.
+func (cc *ClientConn) acquireToken(req *pool.Message) (message.Token, error) {
+	token, err := cc.tokenManager.NewToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get token: %w", err)
+	}
+	req.SetToken(token)
+	return token, nil
+}
+
+// doWithToken does the request with a token of the token manager.
+func (cc *ClientConn) doWithToken(req *pool.Message) (*pool.Message, error) {
+	token, err := cc.acquireToken(req)
+	if err != nil {
+		return nil, err
+	}
+	defer cc.tokenManager.Release(token)
+	return cc.Do(req)
+}
+
 // Do sends an coap message and returns an coap response.
 //
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
@@ -256,10 +457,30 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 //
 // Caller is responsible to release request and response.
 func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
-	if !cc.session.PeerBlockWiseTransferEnabled() || cc.session.blockWise == nil {
+	if !cc.inFlight.acquire() {
+		return nil, ErrConnectionClosing
+	}
+	defer cc.inFlight.release()
+	ctx := req.Context()
+	exchangeCtx, finish := coapNet.ExchangeTimeout(ctx, cc.exchangeTimeout)
+	req.SetContext(exchangeCtx)
+	defer req.SetContext(ctx)
+	var resp *pool.Message
+	var err error
+	if cc.retry != nil {
+		resp, err = cc.retry.do(cc, req, cc.doRequestWithRetryAfter)
+	} else {
+		resp, err = cc.doRequestWithRetryAfter(req)
+	}
+	return resp, finish(err)
+}
+
+func (cc *ClientConn) doRequest(req *pool.Message) (*pool.Message, error) {
+	if !cc.Session().PeerBlockWiseTransferEnabled() || cc.Session().blockWise == nil {
 		return cc.do(req)
 	}
-	bwresp, err := cc.session.blockWise.Do(req, cc.session.blockwiseSZX, cc.session.maxMessageSize, func(bwreq blockwise.Message) (blockwise.Message, error) {
+	szx, maxMessageSize := cc.Session().blockwiseParams()
+	bwresp, err := cc.Session().blockWise.Do(req, szx, maxMessageSize, func(bwreq blockwise.Message) (blockwise.Message, error) {
 		return cc.do(bwreq.(*pool.Message))
 	})
 	if err != nil {
@@ -269,25 +490,31 @@ func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
 }
 
 func (cc *ClientConn) writeMessage(req *pool.Message) error {
-	return cc.session.WriteMessage(req)
+	return cc.Session().WriteMessage(req)
 }
 
 // WriteMessage sends an coap message.
 func (cc *ClientConn) WriteMessage(req *pool.Message) error {
-	if !cc.session.PeerBlockWiseTransferEnabled() || cc.session.blockWise == nil {
+	if !cc.inFlight.acquire() {
+		return ErrConnectionClosing
+	}
+	defer cc.inFlight.release()
+	defer cc.trackNotification(req)()
+	if !cc.Session().PeerBlockWiseTransferEnabled() || cc.Session().blockWise == nil {
 		return cc.writeMessage(req)
 	}
-	return cc.session.blockWise.WriteMessage(cc.RemoteAddr(), req, cc.session.blockwiseSZX, cc.session.maxMessageSize, func(bwreq blockwise.Message) error {
+	szx, maxMessageSize := cc.Session().blockwiseParams()
+	return cc.Session().blockWise.WriteMessage(cc.RemoteAddr(), req, szx, maxMessageSize, func(bwreq blockwise.Message) error {
 		return cc.writeMessage(bwreq.(*pool.Message))
 	})
 }
 
-func newCommonRequest(ctx context.Context, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
+func newCommonRequest(ctx context.Context, messagePool *pool.Pool, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
 	token, err := message.GetToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot get token: %w", err)
 	}
-	req := pool.AcquireMessage(ctx)
+	req := messagePool.AcquireMessage(ctx)
 	req.SetCode(code)
 	req.SetToken(token)
 	req.ResetOptionsTo(opts)
@@ -299,7 +526,7 @@ func newCommonRequest(ctx context.Context, code codes.Code, path string, opts ..
 //
 // Use ctx to set timeout.
 func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.GET, path, opts...)
+	return newCommonRequest(ctx, nil, codes.GET, path, opts...)
 }
 
 // Get issues a GET to the specified path.
@@ -309,12 +536,12 @@ func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*p
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
 // Any status code doesn't cause an error.
 func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	req, err := newCommonRequest(ctx, cc.Session().messagePool, codes.GET, path, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create get request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
 }
 
 // NewPostRequest creates post request.
@@ -326,7 +553,7 @@ func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Opti
 //
 // If payload is nil then content format is not used.
 func NewPostRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.POST, path, opts...)
+	req, err := newCommonRequest(ctx, nil, codes.POST, path, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -346,12 +573,12 @@ func NewPostRequest(ctx context.Context, path string, contentFormat message.Medi
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPostRequest(ctx, path, contentFormat, payload, opts...)
+	req, err := newPayloadRequest(ctx, cc.Session().messagePool, codes.POST, path, contentFormat, payload, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create post request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
 }
 
 // NewPutRequest creates put request.
@@ -360,7 +587,7 @@ func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat messa
 //
 // If payload is nil then content format is not used.
 func NewPutRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.PUT, path, opts...)
+	req, err := newCommonRequest(ctx, nil, codes.PUT, path, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -380,38 +607,132 @@ func NewPutRequest(ctx context.Context, path string, contentFormat message.Media
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Put(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPutRequest(ctx, path, contentFormat, payload, opts...)
+	req, err := newPayloadRequest(ctx, cc.Session().messagePool, codes.PUT, path, contentFormat, payload, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create put request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
 }
 
 // NewDeleteRequest creates delete request.
 //
 // Use ctx to set timeout.
 func NewDeleteRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.DELETE, path, opts...)
+	return newCommonRequest(ctx, nil, codes.DELETE, path, opts...)
 }
 
 // Delete deletes the resource identified by the request path.
 //
 // Use ctx to set timeout.
 func (cc *ClientConn) Delete(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewDeleteRequest(ctx, path, opts...)
+	req, err := newCommonRequest(ctx, cc.Session().messagePool, codes.DELETE, path, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create delete request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
+}
+
+func newPayloadRequest(ctx context.Context, messagePool *pool.Pool, code codes.Code, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newCommonRequest(ctx, messagePool, code, path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.SetContentFormat(contentFormat)
+		req.SetBody(payload)
+	}
+	return req, nil
+}
+
+// NewFetchRequest creates fetch request (RFC 8132), the payload describes the requested part of the resource.
+//
+// Use ctx to set timeout.
+//
+// If payload is nil then content format is not used.
+func NewFetchRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	return newPayloadRequest(ctx, nil, codes.FETCH, path, contentFormat, payload, opts...)
+}
+
+// Fetch issues a FETCH to the specified path. Large payload is sent by Block1 and large response
+// is received by Block2 as for Post.
+//
+// Use ctx to set timeout.
+//
+// An error is returned if by failure to speak COAP (such as a network connectivity problem).
+// Any status code doesn't cause an error.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) Fetch(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newPayloadRequest(ctx, cc.Session().messagePool, codes.FETCH, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create fetch request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	return cc.doWithToken(req)
+}
+
+// NewPatchRequest creates patch request (RFC 8132).
+//
+// Use ctx to set timeout.
+//
+// If payload is nil then content format is not used.
+func NewPatchRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	return newPayloadRequest(ctx, nil, codes.PATCH, path, contentFormat, payload, opts...)
+}
+
+// Patch issues a PATCH to the specified path.
+//
+// Use ctx to set timeout.
+//
+// An error is returned if by failure to speak COAP (such as a network connectivity problem).
+// Any status code doesn't cause an error.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) Patch(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newPayloadRequest(ctx, cc.Session().messagePool, codes.PATCH, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create patch request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	return cc.doWithToken(req)
+}
+
+// NewIPatchRequest creates iPATCH request (RFC 8132), which is idempotent PATCH.
+//
+// Use ctx to set timeout.
+//
+// If payload is nil then content format is not used.
+func NewIPatchRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	return newPayloadRequest(ctx, nil, codes.IPATCH, path, contentFormat, payload, opts...)
+}
+
+// IPatch issues an iPATCH to the specified path.
+//
+// Use ctx to set timeout.
+//
+// An error is returned if by failure to speak COAP (such as a network connectivity problem).
+// Any status code doesn't cause an error.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) IPatch(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newPayloadRequest(ctx, cc.Session().messagePool, codes.IPATCH, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create ipatch request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	return cc.doWithToken(req)
 }
 
 // Context returns the client's context.
 //
 // If connections was closed context is cancelled.
 func (cc *ClientConn) Context() context.Context {
-	return cc.session.Context()
+	if cc.retry != nil {
+		return cc.retry.ctx
+	}
+	return cc.Session().Context()
 }
 
 // Ping issues a PING to the client and waits for PONG reponse.
@@ -444,12 +765,13 @@ func (cc *ClientConn) AsyncPing(receivedPong func()) (func(), error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot get token: %w", err)
 	}
-	req := pool.AcquireMessage(cc.Context())
+	session := cc.Session()
+	req := session.messagePool.AcquireMessage(cc.Context())
 	req.SetToken(token)
 	req.SetCode(codes.Ping)
 	defer pool.ReleaseMessage(req)
 
-	err = cc.session.TokenHandler().Insert(token, func(w *ResponseWriter, r *pool.Message) {
+	err = session.TokenHandler().Insert(token, func(w *ResponseWriter, r *pool.Message) {
 		if r.Code() == codes.Pong {
 			receivedPong()
 		}
@@ -457,29 +779,38 @@ func (cc *ClientConn) AsyncPing(receivedPong func()) (func(), error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot add token handler: %w", err)
 	}
-	err = cc.session.WriteMessage(req)
+	err = session.WriteMessage(req)
 	if err != nil {
-		cc.session.TokenHandler().Pop(token)
+		session.TokenHandler().Pop(token)
 		return nil, fmt.Errorf("cannot write request: %w", err)
 	}
 	return func() {
-		cc.session.TokenHandler().Pop(token)
+		session.TokenHandler().Pop(token)
 	}, nil
 }
 
 // Run reads and process requests from a connection, until the connection is not closed.
 func (cc *ClientConn) Run() (err error) {
-	return cc.session.Run(cc)
+	return cc.Session().Run(cc)
 }
 
 // AddOnClose calls function on close connection event.
 func (cc *ClientConn) AddOnClose(f EventFunc) {
-	cc.session.AddOnClose(f)
+	if cc.retry != nil {
+		cc.retry.addOnClose(f)
+		return
+	}
+	cc.Session().AddOnClose(f)
 }
 
 // RemoteAddr gets remote address.
 func (cc *ClientConn) RemoteAddr() net.Addr {
-	return cc.session.connection.RemoteAddr()
+	return cc.Session().connection.RemoteAddr()
+}
+
+// NetConn returns the connection which carries CoAP messages, e.g. *tls.Conn.
+func (cc *ClientConn) NetConn() net.Conn {
+	return cc.Session().netConn
 }
 
 // Client get instance which implements mux.Client.
@@ -489,15 +820,18 @@ func (cc *ClientConn) Client() *ClientTCP {
 
 // Sequence acquires sequence number.
 func (cc *ClientConn) Sequence() uint64 {
-	return cc.session.Sequence()
+	return cc.Session().Sequence()
 }
 
 // SetContextValue stores the value associated with key to context of connection.
 func (cc *ClientConn) SetContextValue(key interface{}, val interface{}) {
-	cc.session.SetContextValue(key, val)
+	cc.Session().SetContextValue(key, val)
 }
 
 // Done signalizes that connection is not more processed.
 func (cc *ClientConn) Done() <-chan struct{} {
-	return cc.session.Done()
+	if cc.retry != nil {
+		return cc.retry.done
+	}
+	return cc.Session().Done()
 }
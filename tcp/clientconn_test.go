@@ -8,15 +8,21 @@ import (
 	"io/ioutil"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -467,6 +473,70 @@ func TestClientConn_Delete(t *testing.T) {
 	}
 }
 
+func TestClientConn_FetchPatch(t *testing.T) {
+	payload := make([]byte, 7000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	tests := []struct {
+		name     string
+		code     codes.Code
+		wantCode codes.Code
+		do       func(cc *ClientConn, ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error)
+	}{
+		{name: "fetch", code: codes.FETCH, wantCode: codes.Content, do: (*ClientConn).Fetch},
+		{name: "patch", code: codes.PATCH, wantCode: codes.Changed, do: (*ClientConn).Patch},
+		{name: "ipatch", code: codes.IPATCH, wantCode: codes.Changed, do: (*ClientConn).IPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := coapNet.NewTCPListener("tcp", "")
+			require.NoError(t, err)
+			defer l.Close()
+			var wg sync.WaitGroup
+			defer wg.Wait()
+
+			m := mux.NewRouter()
+			m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+				assert.Equal(t, tt.code, r.Code)
+				ct, err := r.Options.GetUint32(message.ContentFormat)
+				require.NoError(t, err)
+				assert.Equal(t, message.AppCBOR, message.MediaType(ct))
+				buf, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, payload, buf)
+				// the body is echoed, so the response is sent by blocks as well
+				err = w.SetResponse(tt.wantCode, message.AppCBOR, bytes.NewReader(buf))
+				require.NoError(t, err)
+			}))
+
+			s := NewServer(WithMux(m))
+			defer s.Stop()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Serve(l)
+				require.NoError(t, err)
+			}()
+
+			cc, err := Dial(l.Addr().String())
+			require.NoError(t, err)
+			defer cc.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			got, err := tt.do(cc, ctx, "/a", message.AppCBOR, bytes.NewReader(payload))
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCode, got.Code())
+			body, err := ioutil.ReadAll(got.Body())
+			require.NoError(t, err)
+			require.Equal(t, payload, body)
+		})
+	}
+}
+
 func TestClientConn_Ping(t *testing.T) {
 	l, err := coapNet.NewTCPListener("tcp", "")
 	require.NoError(t, err)
@@ -597,7 +667,7 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 
 	cc, err := Dial(
 		ld.Addr().String(),
-		WithKeepAlive(3, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+		WithKeepAlive(50*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
 			require.False(t, inactivityDetected)
 			inactivityDetected = true
 			cc.Close()
@@ -617,3 +687,600 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestClient_KeepAliveRTT(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := NewServer()
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(
+		ld.Addr().String(),
+		WithHeartBeat(time.Millisecond*10),
+		WithKeepAlive(20*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+			require.Fail(t, "the server answers pings")
+		}),
+	)
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	require.Eventually(t, func() bool {
+		return cc.Snapshot().PingRTT > 0
+	}, time.Second, time.Millisecond*10)
+	// the connection stays alive while the server answers the pings
+	time.Sleep(time.Millisecond * 300)
+	select {
+	case <-cc.Done():
+		require.Fail(t, "connection was closed")
+	default:
+	}
+}
+
+func newOSCOREContexts(t *testing.T) (client *oscore.Context, server *oscore.Context) {
+	client, err := oscore.NewContext(oscore.Params{
+		MasterSecret: []byte("0123456789abcdef"),
+		SenderID:     []byte("c"),
+		RecipientID:  []byte("s"),
+	})
+	require.NoError(t, err)
+	server, err = oscore.NewContext(oscore.Params{
+		MasterSecret: []byte("0123456789abcdef"),
+		SenderID:     []byte("s"),
+		RecipientID:  []byte("c"),
+	})
+	require.NoError(t, err)
+	return client, server
+}
+
+func TestClientConn_OSCORE(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	m.Handle("/echo", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		assert.Equal(t, codes.POST, r.Code)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+
+	s := NewServer(WithMux(m), WithOSCORE(serverCtx))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String(), WithOSCORE(clientCtx))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/echo", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+
+	unprotected, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		unprotected.Close()
+		<-unprotected.Done()
+	}()
+	resp, err = unprotected.Post(ctx, "/echo", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Unauthorized, resp.Code())
+}
+
+func TestClientConn_Trace(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var m sync.Mutex
+	received := make(map[codes.Code]int)
+	s := NewServer(WithTrace(func(e trace.Event) {
+		require.Equal(t, int32(-1), e.MessageID)
+		if e.Type == trace.MessageReceived {
+			m.Lock()
+			defer m.Unlock()
+			received[e.Message.Code()]++
+		}
+	}), WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var sent []codes.Code
+	cc, err := Dial(l.Addr().String(), WithTrace(func(e trace.Event) {
+		if e.Type == trace.MessageSent {
+			m.Lock()
+			defer m.Unlock()
+			sent = append(sent, e.Message.Code())
+		}
+	}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	m.Lock()
+	defer m.Unlock()
+	require.Equal(t, []codes.Code{codes.CSM, codes.GET}, sent)
+	require.Equal(t, 1, received[codes.CSM])
+	require.Equal(t, 1, received[codes.GET])
+}
+
+func TestClientConn_StaleMessage(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	received := make(chan []byte, 2)
+	s := NewServer(WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		received <- body
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	send := func(body string, ctx context.Context) error {
+		n := pool.AcquireMessage(cc.Context())
+		defer pool.ReleaseMessage(n)
+		n.SetContext(ctx)
+		n.SetCode(codes.POST)
+		n.SetToken([]byte(body))
+		n.SetBody(bytes.NewReader([]byte(body)))
+		return cc.WriteMessage(n)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = send("stale", ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	// the connection is not affected
+	require.NoError(t, cc.Context().Err())
+	err = send("next", context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []byte("next"), <-received)
+}
+
+func TestClientConn_PeerCapabilities(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	const customOption message.OptionID = 6
+	received := make(chan []byte, 1)
+	s := NewServer(WithMaxMessageSize(1000),
+		WithCSMOptions(message.Option{ID: coapTCP.BlockWiseTransfer}, message.Option{ID: customOption, Value: []byte("v1")}),
+		WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+			body, err := r.ReadBody()
+			require.NoError(t, err)
+			received <- body
+			err = w.SetResponse(codes.Changed, message.TextPlain, nil)
+			require.NoError(t, err)
+		}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 128)
+
+	cc, err := Dial(l.Addr().String(), WithBlockwise(true, blockwise.SZX1024, time.Second*5),
+		WithCSMOptions(message.Option{ID: coapTCP.BlockWiseTransfer}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	// CSM of the server is processed asynchronously
+	require.Eventually(t, func() bool { return cc.PeerCapabilities().CSMReceived }, time.Second, time.Millisecond*10)
+	caps := cc.PeerCapabilities()
+	require.Equal(t, uint32(1000), caps.MaxMessageSize)
+	require.True(t, caps.BlockWiseTransfer)
+	v, err := caps.Options.GetBytes(customOption)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), v)
+
+	// blocks are shrunk to the size of the peer
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, payload, <-received)
+
+	cc1, err := Dial(l.Addr().String(), WithBlockwise(false, blockwise.SZX1024, time.Second*5))
+	require.NoError(t, err)
+	defer func() {
+		cc1.Close()
+		<-cc1.Done()
+	}()
+	require.Eventually(t, func() bool { return cc1.PeerCapabilities().CSMReceived }, time.Second, time.Millisecond*10)
+	_, err = cc1.Post(ctx, "/a", message.TextPlain, bytes.NewReader(payload))
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+	// the connection is not affected
+	require.NoError(t, cc1.Context().Err())
+	resp, err = cc1.Post(ctx, "/a", message.TextPlain, bytes.NewReader(payload[:100]))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, payload[:100], <-received)
+}
+
+func TestClientConn_RetryPolicy(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var mutex sync.Mutex
+	gets := 0
+	registrations := 0
+	s := NewServer(WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		path, err := r.Options().Path()
+		require.NoError(t, err)
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch path {
+		case "obs":
+			registrations++
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("registered")))
+			require.NoError(t, err)
+		case "a":
+			gets++
+			if gets == 1 {
+				// the connection drops before the response
+				w.ClientConn().Close()
+				return
+			}
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("a")))
+			require.NoError(t, err)
+		default:
+			w.ClientConn().Close()
+		}
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	notRetried := make(chan codes.Code, 1)
+	cc, err := Dial(l.Addr().String(), WithRetryPolicy(RetryPolicy{
+		MinBackoff: time.Millisecond * 10,
+		Jitter:     0.2,
+		OnNotRetried: func(req *pool.Message, err error) {
+			notRetried <- req.Code()
+		},
+	}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	notifications := make(chan struct{}, 4)
+	obs, err := cc.Observe(ctx, "/obs", func(req *pool.Message) {
+		notifications <- struct{}{}
+	})
+	require.NoError(t, err)
+	<-notifications
+
+	// the GET is replayed over the new connection
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("a"), body)
+	require.NoError(t, cc.Context().Err())
+
+	// the observation is re-subscribed
+	select {
+	case <-notifications:
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	mutex.Lock()
+	require.Equal(t, 2, gets)
+	require.Equal(t, 2, registrations)
+	mutex.Unlock()
+
+	// the POST isn't idempotent
+	_, err = cc.Post(ctx, "/b", message.TextPlain, bytes.NewReader([]byte("b")))
+	require.ErrorIs(t, err, ErrNotRetried)
+	require.Equal(t, codes.POST, <-notRetried)
+
+	err = obs.Cancel(ctx)
+	require.NoError(t, err)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: time.Millisecond * 10, MaxBackoff: time.Millisecond * 50}
+	require.Equal(t, time.Millisecond*10, p.backoff(1))
+	require.Equal(t, time.Millisecond*20, p.backoff(2))
+	require.Equal(t, time.Millisecond*40, p.backoff(3))
+	require.Equal(t, time.Millisecond*50, p.backoff(4))
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := p.backoff(1)
+		require.GreaterOrEqual(t, d, time.Millisecond*5)
+		require.LessOrEqual(t, d, time.Millisecond*15)
+	}
+}
+
+func TestClientConn_WriteTimeout(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	// the peer neither reads nor answers
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		c, err := l.AcceptWithContext(context.Background())
+		if err != nil {
+			return
+		}
+		<-stop
+		c.Close()
+	}()
+
+	cc, err := Dial(l.Addr().String(), WithWriteTimeout(time.Millisecond*100), WithExchangeTimeout(time.Millisecond*100))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	var timeoutErr *coapNet.TimeoutError
+	_, err = cc.Get(context.Background(), "/a")
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, coapNet.TimeoutExchange, timeoutErr.Kind)
+
+	payload := make([]byte, 1024)
+	for i := 0; i < 1024*1024; i++ {
+		req := pool.AcquireMessage(context.Background())
+		req.SetCode(codes.POST)
+		req.SetToken([]byte{1})
+		req.SetBody(bytes.NewReader(payload))
+		err = cc.WriteMessage(req)
+		pool.ReleaseMessage(req)
+		if err != nil {
+			break
+		}
+	}
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, coapNet.TimeoutNetwork, timeoutErr.Kind)
+	// the message could be written partially, so the connection is closed
+	<-cc.Done()
+}
+
+func TestClientConn_RetryAfter(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// every odd request is rejected
+	var mutex sync.Mutex
+	requests := 0
+	s := NewServer(WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		mutex.Lock()
+		requests++
+		rejected := requests%2 == 1
+		mutex.Unlock()
+		if rejected {
+			err := w.SetResponse(codes.TooManyRequests, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: []byte{}})
+			require.NoError(t, err)
+			return
+		}
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String(), WithRetryAfter(RetryAfterPolicy{MaxRetries: 1}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Changed, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+	mutex.Lock()
+	require.Equal(t, 2, requests)
+	mutex.Unlock()
+}
+
+func TestClientConn_OSCOREEchoVerification(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var handled uint32
+	s := NewServer(WithOSCORE(serverCtx), WithEchoVerification(time.Minute), WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&handled, 1)
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String(), WithOSCORE(clientCtx))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// the challenged request is protected again with Echo, so it isn't rejected as a replay
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Changed, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&handled))
+}
+
+func TestClientConn_OSCORERetryAfter(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// the first request is rejected
+	var handled uint32
+	s := NewServer(WithOSCORE(serverCtx), WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		if atomic.AddUint32(&handled, 1) == 1 {
+			err := w.SetResponse(codes.ServiceUnavailable, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: []byte{}})
+			require.NoError(t, err)
+			return
+		}
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String(), WithOSCORE(clientCtx), WithRetryAfter(RetryAfterPolicy{MaxRetries: 1}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	req, err := NewPostRequest(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	resp, err := cc.Do(req)
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&handled))
+	// the request isn't changed by the protected attempts
+	require.Equal(t, codes.POST, req.Code())
+	require.False(t, req.HasOption(message.OSCORE))
+	body, err = req.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+}
@@ -24,10 +24,21 @@ func NewObservationHandler(obsertionTokenHandler *HandlerContainer, next Handler
 	}
 }
 
+const (
+	// defaultMaxAge is freshness of notification without Max-Age option (RFC 7252 section 5.10.5).
+	defaultMaxAge = 60 * time.Second
+	// refreshTimeout limits GET which refreshes stale observation.
+	refreshTimeout = 10 * time.Second
+)
+
+// StaleFunc is called when Max-Age of the last notification expired without a new notification.
+type StaleFunc = func(o *Observation)
+
 //Observation represents subscription to resource on the server
 type Observation struct {
 	token        message.Token
 	path         string
+	opts         []message.Option
 	cc           *ClientConn
 	observeFunc  func(req *pool.Message)
 	respCodeChan chan codes.Code
@@ -36,13 +47,23 @@ type Observation struct {
 	lastEvent   time.Time
 	mutex       sync.Mutex
 
+	onStale         StaleFunc
+	refreshOnStale  bool
+	staleTimer      *time.Timer
+	staleGeneration uint64
+	// staleDeadline is when Max-Age of the last notification expires.
+	staleDeadline time.Time
+	canceled        bool
+
 	waitForReponse uint32
+	tokenReleased  uint32
 }
 
-func newObservation(token message.Token, path string, cc *ClientConn, observeFunc func(req *pool.Message), respCodeChan chan codes.Code) *Observation {
+func newObservation(token message.Token, path string, opts []message.Option, cc *ClientConn, observeFunc func(req *pool.Message), respCodeChan chan codes.Code) *Observation {
 	return &Observation{
 		token:          token,
 		path:           path,
+		opts:           opts,
 		obsSequence:    0,
 		cc:             cc,
 		waitForReponse: 1,
@@ -61,11 +82,112 @@ func (o *Observation) handler(w *ResponseWriter, r *pool.Message) {
 		o.respCodeChan = nil
 	}
 	if o.wantBeNotified(r) {
+		o.restartStaleTimer(getMaxAge(r))
 		o.observeFunc(r)
 	}
 }
 
+// SetStaleHandler sets onStale which is called when Max-Age of the last notification expires
+// without a new notification. When refresh is set, the resource is fetched by GET afterwards
+// and the response is passed to the observe function.
+func (o *Observation) SetStaleHandler(onStale StaleFunc, refresh bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.onStale = onStale
+	o.refreshOnStale = refresh
+	if !o.canceled && !o.staleDeadline.IsZero() {
+		o.armStaleTimerLocked()
+	}
+}
+
+func getMaxAge(r *pool.Message) time.Duration {
+	maxAge, err := r.GetOptionUint32(message.MaxAge)
+	if err != nil {
+		return defaultMaxAge
+	}
+	return time.Duration(maxAge) * time.Second
+}
+
+func (o *Observation) restartStaleTimer(maxAge time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.canceled {
+		return
+	}
+	o.staleDeadline = time.Now().Add(maxAge)
+	o.armStaleTimerLocked()
+}
+
+// armStaleTimerLocked arms the timer to staleDeadline. The timer is armed only when somebody handles the expiration,
+// so the observation without it doesn't create a timer per notification.
+func (o *Observation) armStaleTimerLocked() {
+	if o.staleTimer != nil {
+		o.staleTimer.Stop()
+	}
+	o.staleGeneration++
+	if !(o.onStale != nil || o.refreshOnStale) {
+		o.staleTimer = nil
+		return
+	}
+	generation := o.staleGeneration
+	o.staleTimer = time.AfterFunc(time.Until(o.staleDeadline), func() {
+		o.expired(generation)
+	})
+}
+
+func (o *Observation) stopStaleTimer() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.canceled = true
+	if o.staleTimer != nil {
+		o.staleTimer.Stop()
+	}
+}
+
+func (o *Observation) expired(generation uint64) {
+	if o.cc.Context().Err() != nil {
+		return
+	}
+	o.mutex.Lock()
+	if o.canceled || o.staleGeneration != generation {
+		// observation was canceled or a new notification arrived meanwhile
+		o.mutex.Unlock()
+		return
+	}
+	onStale := o.onStale
+	refresh := o.refreshOnStale
+	o.mutex.Unlock()
+
+	if onStale != nil {
+		onStale(o)
+	}
+	if refresh {
+		o.refresh()
+	}
+}
+
+func (o *Observation) refresh() {
+	ctx, cancel := context.WithTimeout(o.cc.Context(), refreshTimeout)
+	defer cancel()
+	resp, err := o.cc.Get(ctx, o.path, o.opts...)
+	if err != nil {
+		o.cc.Session().errors(fmt.Errorf("cannot refresh stale observation of %v: %w", o.path, err))
+		return
+	}
+	defer pool.ReleaseMessage(resp)
+	o.restartStaleTimer(getMaxAge(resp))
+	o.observeFunc(resp)
+}
+
 func (o *Observation) cleanUp() {
+	o.deleteRecord()
+	o.release()
+}
+
+// release removes observation from the connection.
+func (o *Observation) release() {
+	o.stopStaleTimer()
+	o.cc.observations.Delete(o.token.String())
 	o.cc.observationTokenHandler.Pop(o.token)
 	o.cc.observationRequests.PullOut(o.token.String())
 }
@@ -73,14 +195,33 @@ func (o *Observation) cleanUp() {
 // Cancel remove observation from server. For recreate observation use Observe.
 func (o *Observation) Cancel(ctx context.Context) error {
 	o.cleanUp()
-	req, err := NewGetRequest(ctx, o.path)
+	err := o.deregister(ctx)
+	o.releaseToken()
+	return err
+}
+
+// releaseToken returns the token to the token manager once the observation is deregistered.
+func (o *Observation) releaseToken() {
+	if atomic.CompareAndSwapUint32(&o.tokenReleased, 0, 1) {
+		o.cc.tokenManager.Release(o.token)
+	}
+}
+
+func (o *Observation) deregister(ctx context.Context) error {
+	// RFC 7641 3.6: options of the deregistration are identical to the registration
+	req, err := newCommonRequest(ctx, o.cc.Session().messagePool, codes.GET, o.path, o.opts...)
 	if err != nil {
 		return fmt.Errorf("cannot cancel observation request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
 	req.SetObserve(1)
 	req.SetToken(o.token)
-	resp, err := o.cc.Do(req)
+	var resp *pool.Message
+	if o.cc.retry != nil {
+		resp, err = o.cc.retry.do(o.cc, req, o.cc.doRequest)
+	} else {
+		resp, err = o.cc.doRequest(req)
+	}
 	if err != nil {
 		return err
 	}
@@ -103,24 +244,106 @@ func (o *Observation) wantBeNotified(r *pool.Message) bool {
 	if observation.ValidSequenceNumber(o.obsSequence, obsSequence, o.lastEvent, now) {
 		o.obsSequence = obsSequence
 		o.lastEvent = now
+		o.saveRecordLocked()
 		return true
 	}
 
 	return false
 }
 
+func (o *Observation) saveRecordLocked() {
+	if o.cc.observationStore == nil {
+		return
+	}
+	err := o.cc.observationStore.Save(observation.Record{
+		Token:     o.token,
+		Path:      o.path,
+		Options:   message.Options(o.opts),
+		Sequence:  o.obsSequence,
+		LastEvent: o.lastEvent,
+	})
+	if err != nil {
+		o.cc.Session().errors(fmt.Errorf("cannot save observation of %v: %w", o.path, err))
+	}
+}
+
+func (o *Observation) deleteRecord() {
+	if o.cc.observationStore == nil {
+		return
+	}
+	err := o.cc.observationStore.Delete(o.token)
+	if err != nil {
+		o.cc.Session().errors(fmt.Errorf("cannot delete observation of %v: %w", o.path, err))
+	}
+}
+
+func (cc *ClientConn) cancelObservations(ctx context.Context) error {
+	observations := make([]*Observation, 0, 4)
+	cc.observations.Range(func(key, value interface{}) bool {
+		observations = append(observations, value.(*Observation))
+		return true
+	})
+	var errors []error
+	for _, o := range observations {
+		o.release()
+		err := o.deregister(ctx)
+		o.releaseToken()
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%v: %w", o.path, err))
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("cannot cancel observations: %v", errors)
+	}
+	return nil
+}
+
+// RestoreObservations re-establishes observations saved in the observation store, e.g. after restart
+// of the device. Observe function of each observation is created by observeFunc. Records of restored
+// observations are replaced by records of the new ones, records which cannot be restored are kept.
+func (cc *ClientConn) RestoreObservations(ctx context.Context, observeFunc func(record observation.Record) func(req *pool.Message)) ([]*Observation, error) {
+	if cc.observationStore == nil {
+		return nil, fmt.Errorf("observation store is not set")
+	}
+	records, err := cc.observationStore.Load()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load observations: %w", err)
+	}
+	observations := make([]*Observation, 0, len(records))
+	var errors []error
+	for _, r := range records {
+		o, err := cc.Observe(ctx, r.Path, observeFunc(r), r.Options...)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%v: %w", r.Path, err))
+			continue
+		}
+		err = cc.observationStore.Delete(r.Token)
+		if err != nil {
+			cc.Session().errors(fmt.Errorf("cannot delete restored observation of %v: %w", r.Path, err))
+		}
+		observations = append(observations, o)
+	}
+	if len(errors) > 0 {
+		return observations, fmt.Errorf("cannot restore observations: %v", errors)
+	}
+	return observations, nil
+}
+
 // Observe subscribes for every change of resource on path.
 func (cc *ClientConn) Observe(ctx context.Context, path string, observeFunc func(req *pool.Message), opts ...message.Option) (*Observation, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	req, err := newCommonRequest(ctx, cc.Session().messagePool, codes.GET, path, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create observe request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	token := req.Token()
+	token, err := cc.acquireToken(req)
+	if err != nil {
+		return nil, err
+	}
 	req.SetObserve(0)
 
 	respCodeChan := make(chan codes.Code, 1)
-	o := newObservation(token, path, cc, observeFunc, respCodeChan)
+	o := newObservation(token, path, opts, cc, observeFunc, respCodeChan)
 
 	options, err := req.Options().Clone()
 	if err != nil {
@@ -134,10 +357,12 @@ func (cc *ClientConn) Observe(ctx context.Context, path string, observeFunc func
 		Options: options,
 	}
 	cc.observationRequests.Store(token.String(), obs)
+	cc.observations.Store(token.String(), o)
 	err = o.cc.observationTokenHandler.Insert(token.String(), o.handler)
 	defer func(err *error) {
 		if *err != nil {
 			o.cleanUp()
+			o.releaseToken()
 		}
 	}(&err)
 	if err != nil {
@@ -62,3 +62,10 @@ func (s *HandlerContainer) Pop(key interface{}) (HandlerFunc, error) {
 	delete(s.datas, key)
 	return v, nil
 }
+
+// Len returns number of registered handlers.
+func (s *HandlerContainer) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.datas)
+}
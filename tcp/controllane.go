@@ -0,0 +1,49 @@
+package tcp
+
+import "sync"
+
+// DefaultControlLaneSize is default number of signal messages queued for the control lane.
+const DefaultControlLaneSize = 16
+
+// controlLane processes signal messages, e.g. pings and pongs, by a dedicated go routine,
+// so the reading of the connection isn't blocked by writing of pongs or by handlers of pongs.
+type controlLane struct {
+	queue chan func()
+	once  sync.Once
+}
+
+func newControlLane(size int) *controlLane {
+	if size <= 0 {
+		return nil
+	}
+	return &controlLane{
+		queue: make(chan func(), size),
+	}
+}
+
+// push queues f to the lane, which runs until done is closed. It returns false when the lane is disabled or full.
+func (l *controlLane) push(done <-chan struct{}, f func()) bool {
+	if l == nil {
+		return false
+	}
+	l.once.Do(func() {
+		go l.run(done)
+	})
+	select {
+	case l.queue <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *controlLane) run(done <-chan struct{}) {
+	for {
+		select {
+		case f := <-l.queue:
+			f()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// blockHeaderReserve is part of the message size reserved for the header and options of a block, so a 1024 bytes
+// block fits into the default Max-Message-Size 1152 of RFC 8323.
+const blockHeaderReserve = 128
+
+// ErrMessageTooLarge is returned when the message exceeds Max-Message-Size which the peer indicated in CSM.
+var ErrMessageTooLarge = errors.New("message exceeds max message size of the peer")
+
+// PeerCapabilities are capabilities and settings which the peer indicated in CSM messages (RFC 8323 section 5.3).
+type PeerCapabilities struct {
+	// CSMReceived reports whether the peer sent CSM.
+	CSMReceived bool
+	// MaxMessageSize is Max-Message-Size of the peer, zero when the peer didn't send it.
+	MaxMessageSize uint32
+	// BlockWiseTransfer reports whether the peer supports block-wise transfers.
+	BlockWiseTransfer bool
+	// Options are all options of CSM messages of the peer, e.g. custom ones. A later CSM overrides options
+	// with the same ID.
+	Options message.Options
+}
+
+// PeerCapabilities returns capabilities of the peer, e.g. to adapt payload sizes to its Max-Message-Size.
+func (cc *ClientConn) PeerCapabilities() PeerCapabilities {
+	return cc.Session().PeerCapabilities()
+}
+
+func (s *Session) PeerCapabilities() PeerCapabilities {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return PeerCapabilities{
+		CSMReceived:       s.peerCSMOptions != nil,
+		MaxMessageSize:    s.PeerMaxMessageSize(),
+		BlockWiseTransfer: s.PeerBlockWiseTransferEnabled(),
+		Options:           append(message.Options(nil), s.peerCSMOptions...),
+	}
+}
+
+// handleCSM stores settings of the peer. Settings are cumulative, options missing in CSM keep their values.
+func (s *Session) handleCSM(r *pool.Message) error {
+	opts, err := r.Options().Clone()
+	if err != nil {
+		return fmt.Errorf("cannot clone options of CSM: %w", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	peer := s.peerCSMOptions
+	if peer == nil {
+		peer = make(message.Options, 0, len(opts))
+	}
+	for _, o := range opts {
+		peer = peer.Remove(o.ID)
+	}
+	for _, o := range opts {
+		peer = peer.Add(o)
+	}
+	s.peerCSMOptions = peer
+	if size, err := r.GetOptionUint32(coapTCP.MaxMessageSize); err == nil {
+		atomic.StoreUint32(&s.peerMaxMessageSize, size)
+	}
+	if r.HasOption(coapTCP.BlockWiseTransfer) {
+		atomic.StoreUint32(&s.peerBlockWiseTranferEnabled, 1)
+	}
+	return nil
+}
+
+// checkPeerMaxMessageSize returns ErrMessageTooLarge when the message of size can't be sent to the peer.
+func (s *Session) checkPeerMaxMessageSize(size int64) error {
+	peer := s.PeerMaxMessageSize()
+	if peer > 0 && size > int64(peer) {
+		return fmt.Errorf("%w: %v > %v", ErrMessageTooLarge, size, peer)
+	}
+	return nil
+}
+
+// peerSZX returns the largest block size up to szx whose blocks fit into Max-Message-Size of the peer.
+func (s *Session) peerSZX(szx blockwise.SZX) blockwise.SZX {
+	peer := int64(s.PeerMaxMessageSize())
+	if peer <= 0 {
+		return szx
+	}
+	for szx > blockwise.SZX16 && szx.Size()+blockHeaderReserve > peer {
+		szx--
+	}
+	return szx
+}
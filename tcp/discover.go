@@ -0,0 +1,41 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// Discover gets resources of the server from /.well-known/core (RFC 6690 section 4).
+// The query, e.g. "rt=temperature", filters the resources at the server, empty query lists all of them.
+//
+// Use ctx to set timeout.
+func (cc *ClientConn) Discover(ctx context.Context, query string) ([]linkformat.Resource, error) {
+	var opts []message.Option
+	if query != "" {
+		opts = append(opts, message.Option{ID: message.URIQuery, Value: []byte(query)})
+	}
+	resp, err := cc.Get(ctx, linkformat.WellKnownCore, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover resources: %w", err)
+	}
+	defer pool.ReleaseMessage(resp)
+	if resp.Code() != codes.Content {
+		return nil, fmt.Errorf("cannot discover resources: unexpected return code(%v)", resp.Code())
+	}
+	if ct, err := resp.ContentFormat(); err == nil && ct != message.AppLinkFormat {
+		return nil, fmt.Errorf("cannot discover resources: unexpected content format(%v)", ct)
+	}
+	if resp.Body() == nil {
+		return nil, nil
+	}
+	data, err := resp.ReadBody()
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover resources: %w", err)
+	}
+	return linkformat.Parse(data)
+}
@@ -83,7 +83,7 @@ var signalPingPongOptionDefs = map[message.OptionID]message.OptionDef{
 }
 
 var signalReleaseOptionDefs = map[message.OptionID]message.OptionDef{
-	AlternativeAddress: {ValueFormat: message.ValueString, MinLen: 1, MaxLen: 255},
+	AlternativeAddress: {ValueFormat: message.ValueString, MinLen: 1, MaxLen: 255, Repeatable: true},
 	HoldOff:            {ValueFormat: message.ValueUint, MinLen: 0, MaxLen: 3},
 }
 
@@ -117,10 +117,23 @@ func (m Message) Marshal() ([]byte, error) {
 		b = append(b[:0], make([]byte, l)...)
 		l, err = m.MarshalTo(b)
 	}
-	return b[:l], err
+	if err != nil {
+		return nil, err
+	}
+	return b[:l], nil
 }
 
 func (m Message) MarshalTo(buf []byte) (int, error) {
+	return m.marshalTo(buf, len(m.Payload), true)
+}
+
+// MarshalHeaderTo marshals the message without payload, for payload of payloadSize bytes written after it.
+// It returns size of the marshaled data.
+func (m Message) MarshalHeaderTo(buf []byte, payloadSize int) (int, error) {
+	return m.marshalTo(buf, payloadSize, false)
+}
+
+func (m Message) marshalTo(buf []byte, payloadSize int, withPayload bool) (int, error) {
 	/*
 	   A CoAP Message message lomessage.OKs like:
 
@@ -151,7 +164,7 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 		return -1, message.ErrInvalidTokenLen
 	}
 
-	payloadLen := len(m.Payload)
+	payloadLen := payloadSize
 	if payloadLen > 0 {
 		//for separator 0xff
 		payloadLen++
@@ -207,6 +220,9 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 	}
 
 	bufLen = bufLen + hdrLen
+	if !withPayload && payloadSize > 0 {
+		bufLen -= payloadSize
+	}
 	if len(buf) < bufLen {
 		return bufLen, message.ErrTooSmall
 	}
@@ -220,9 +236,11 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 	default:
 		return -1, err
 	}
-	if len(m.Payload) > 0 {
-		copy(buf[hdrLen+optionsLen:], []byte{0xff})
-		copy(buf[hdrLen+optionsLen+1:], m.Payload)
+	if payloadSize > 0 {
+		buf[hdrLen+optionsLen] = 0xff
+		if withPayload {
+			copy(buf[hdrLen+optionsLen+1:], m.Payload)
+		}
 	}
 
 	return bufLen, nil
@@ -249,6 +267,9 @@ func (i *MessageHeader) Unmarshal(data []byte) error {
 
 	lenNib := (firstByte & 0xf0) >> 4
 	tkl := firstByte & 0x0f
+	if tkl > message.MaxTokenSize {
+		return message.ErrInvalidTokenLen
+	}
 
 	var opLen int
 	switch {
@@ -301,6 +322,12 @@ func (i *MessageHeader) Unmarshal(data []byte) error {
 }
 
 func (m *Message) UnmarshalWithHeader(header MessageHeader, data []byte) (int, error) {
+	return m.UnmarshalWithHeaderAndLimits(header, data, message.ParserLimits{})
+}
+
+// UnmarshalWithHeaderAndLimits decodes the message and checks it by the limits. The message exceeding them
+// is decoded and message.ParserLimitError is returned.
+func (m *Message) UnmarshalWithHeaderAndLimits(header MessageHeader, data []byte, limits message.ParserLimits) (int, error) {
 	optionDefs := message.CoapOptionDefs
 	processed := header.HeaderLen
 	switch codes.Code(header.Code) {
@@ -328,10 +355,19 @@ func (m *Message) UnmarshalWithHeader(header MessageHeader, data []byte) (int, e
 	m.Code = header.Code
 	m.Token = header.Token
 
+	if err := limits.Check(m.Token, m.Options, m.Payload); err != nil {
+		return processed, err
+	}
 	return processed, nil
 }
 
 func (m *Message) Unmarshal(data []byte) (int, error) {
+	return m.UnmarshalWithLimits(data, message.ParserLimits{})
+}
+
+// UnmarshalWithLimits decodes the message and checks it by the limits. The message exceeding them is decoded
+// and message.ParserLimitError is returned.
+func (m *Message) UnmarshalWithLimits(data []byte, limits message.ParserLimits) (int, error) {
 	header := MessageHeader{Token: m.Token}
 	err := header.Unmarshal(data)
 	if err != nil {
@@ -340,5 +376,5 @@ func (m *Message) Unmarshal(data []byte) (int, error) {
 	if len(data) < header.TotalLen {
 		return -1, message.ErrShortRead
 	}
-	return m.UnmarshalWithHeader(header, data[header.HeaderLen:])
+	return m.UnmarshalWithHeaderAndLimits(header, data[header.HeaderLen:], limits)
 }
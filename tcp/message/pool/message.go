@@ -5,22 +5,13 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"sync"
-	"sync/atomic"
+	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/pool"
 	tcp "github.com/plgd-dev/go-coap/v2/tcp/message"
 )
 
-const maxMessagePool = 10240
-const maxMessageBufferSize = 2048
-
-var (
-	currentMessagesInPool int32
-	messagePool           sync.Pool
-)
-
 type Message struct {
 	*pool.Message
 
@@ -30,29 +21,50 @@ type Message struct {
 
 	ctx        context.Context
 	isModified bool
+	// owner is the pool which acquired the message.
+	owner *Pool
 }
 
 // Reset clear message for next reuse
 func (r *Message) Reset() {
 	r.Message.Reset()
-	if cap(r.rawData) > maxMessageBufferSize {
-		r.rawData = make([]byte, 256)
-	}
-	if cap(r.rawMarshalData) > maxMessageBufferSize {
-		r.rawMarshalData = make([]byte, 256)
-	}
+	p := r.pool()
+	r.rawData = p.shrink(r.rawData)
+	r.rawMarshalData = p.shrink(r.rawMarshalData)
 	r.isModified = false
 }
 
+// pool returns the pool which acquired the message, the package-level one for messages created by NewMessage.
+func (r *Message) pool() *Pool {
+	if r.owner == nil {
+		return defaultPool
+	}
+	return r.owner
+}
+
 func (r *Message) Context() context.Context {
 	return r.ctx
 }
 
+// SetContext replaces context of the message, which is independent of the context of the connection. Messages over
+// TCP aren't paced, so when it is done before the message is written, e.g. the message waits in the control lane or
+// for another message to be written to the connection, the stale message is dropped instead of sent and writing fails
+// with the context error.
+func (r *Message) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 func (r *Message) IsModified() bool {
 	return r.isModified || r.Message.IsModified()
 }
 
 func (r *Message) Unmarshal(data []byte) (int, error) {
+	return r.UnmarshalWithLimits(data, message.ParserLimits{})
+}
+
+// UnmarshalWithLimits is Unmarshal which checks the message by the limits. The message exceeding them is decoded
+// and message.ParserLimitError is returned, so the request can be answered.
+func (r *Message) UnmarshalWithLimits(data []byte, limits message.ParserLimits) (int, error) {
 	if len(r.rawData) < len(data) {
 		r.rawData = append(r.rawData, make([]byte, len(data)-len(r.rawData))...)
 	}
@@ -62,8 +74,8 @@ func (r *Message) Unmarshal(data []byte) (int, error) {
 		Options: make(message.Options, 0, 16),
 	}
 
-	n, err := m.Unmarshal(r.rawData)
-	if err != nil {
+	n, err := m.UnmarshalWithLimits(r.rawData, limits)
+	if _, ok := err.(*message.ParserLimitError); err != nil && !ok {
 		return n, err
 	}
 	r.Message.SetCode(m.Code)
@@ -75,6 +87,21 @@ func (r *Message) Unmarshal(data []byte) (int, error) {
 	return n, err
 }
 
+// Size returns length of the encoded message without encoding it.
+func (r *Message) Size() (int, error) {
+	payload, err := r.ReadBody()
+	if err != nil {
+		return -1, err
+	}
+	m := tcp.Message{
+		Code:    r.Code(),
+		Token:   r.Message.Token(),
+		Options: r.Message.Options(),
+		Payload: payload,
+	}
+	return m.Size()
+}
+
 func (r *Message) Marshal() ([]byte, error) {
 	m := tcp.Message{
 		Code:    r.Code(),
@@ -101,40 +128,81 @@ func (r *Message) Marshal() ([]byte, error) {
 	return r.rawMarshalData, nil
 }
 
+// MarshalHeader marshals the message without the body set by SetBodyStream, which is written after it.
+func (r *Message) MarshalHeader() ([]byte, error) {
+	m := tcp.Message{
+		Code:    r.Code(),
+		Token:   r.Message.Token(),
+		Options: r.Message.Options(),
+	}
+	payloadSize, err := r.BodySize()
+	if err != nil {
+		return nil, err
+	}
+	size, err := m.MarshalHeaderTo(nil, int(payloadSize))
+	if err != nil && err != message.ErrTooSmall {
+		return nil, err
+	}
+	if len(r.rawMarshalData) < size {
+		r.rawMarshalData = append(r.rawMarshalData, make([]byte, size-len(r.rawMarshalData))...)
+	}
+	n, err := m.MarshalHeaderTo(r.rawMarshalData, int(payloadSize))
+	if err != nil {
+		return nil, err
+	}
+	r.rawMarshalData = r.rawMarshalData[:n]
+	return r.rawMarshalData, nil
+}
+
 // AcquireMessage returns an empty Message instance from Message pool.
 //
 // The returned Message instance may be passed to ReleaseMessage when it is
 // no longer needed. This allows Message recycling, reduces GC pressure
 // and usually improves performance.
 func AcquireMessage(ctx context.Context) *Message {
-	v := messagePool.Get()
-	if v == nil {
-		return &Message{
-			Message:        pool.NewMessage(),
-			rawData:        make([]byte, 256),
-			rawMarshalData: make([]byte, 256),
-			ctx:            ctx,
-		}
-	}
-	atomic.AddInt32(&currentMessagesInPool, -1)
-	r := v.(*Message)
-	r.ctx = ctx
-	return r
+	return defaultPool.AcquireMessage(ctx)
 }
 
-// ReleaseMessage returns req acquired via AcquireMessage to Message pool.
+// ReleaseMessage returns req acquired via AcquireMessage or Pool.AcquireMessage to the pool which acquired it.
 //
 // It is forbidden accessing req and/or its' members after returning
 // it to Message pool.
 func ReleaseMessage(req *Message) {
-	v := atomic.LoadInt32(&currentMessagesInPool)
-	if v >= maxMessagePool {
-		return
-	}
-	atomic.AddInt32(&currentMessagesInPool, 1)
-	req.Reset()
-	req.ctx = nil
-	messagePool.Put(req)
+	req.pool().release(req)
+}
+
+// Stats returns usage statistics of Message pool.
+func Stats() pool.Stats {
+	return defaultPool.Stats()
+}
+
+// SetOccupancyWatermark calls onCross when number of acquired and not yet released messages reaches watermark.
+//
+// It helps to detect messages which are acquired but never released.
+func SetOccupancyWatermark(watermark int64, onCross pool.WatermarkFunc) {
+	defaultPool.instrumentation.SetOccupancyWatermark(watermark, onCross)
+}
+
+// SetMissRateWatermark calls onCross when ratio of allocations to acquisitions over window of acquisitions
+// reaches watermark.
+func SetMissRateWatermark(watermark float64, window uint64, onCross pool.WatermarkFunc) {
+	defaultPool.instrumentation.SetMissRateWatermark(watermark, window, onCross)
+}
+
+// EnableLeakDetection records acquisition stacks of messages and every interval reports
+// messages which are held longer than threshold. It returns function which stops the detection.
+//
+// Recording stacks is expensive, use it only for debugging.
+func EnableLeakDetection(threshold, interval time.Duration, onLeak pool.LeakFunc) func() {
+	return defaultPool.instrumentation.EnableLeakDetection(threshold, interval, onLeak)
+}
+
+// SetAllocationAudit calls onAlloc for every allocation made by the pool or by pooled messages.
+// Nil onAlloc disables the audit.
+//
+// Recording stacks is expensive, use it only for debugging.
+func SetAllocationAudit(onAlloc pool.AllocationFunc) {
+	defaultPool.instrumentation.SetAllocationAudit(onAlloc)
 }
 
 // ConvertFrom converts common message to pool message.
@@ -6,8 +6,15 @@ import (
 	"net"
 	"time"
 
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/metrics"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 )
 
 // HandlerFuncOpt handler function option.
@@ -82,6 +89,28 @@ func WithErrors(errors ErrorFunc) ErrorsOpt {
 	return ErrorsOpt{errors: errors}
 }
 
+// LoggerOpt logger option.
+type LoggerOpt struct {
+	logger coapNet.Logger
+}
+
+func (o LoggerOpt) apply(opts *serverOptions) {
+	opts.logger = o.logger
+	opts.errors = coapNet.LogErrors(o.logger)
+}
+
+func (o LoggerOpt) applyDial(opts *dialOptions) {
+	opts.logger = o.logger
+	opts.errors = coapNet.LogErrors(o.logger)
+}
+
+// WithLogger sets leveled logger of errors and of events of connections: opening and closing of sessions,
+// retransmissions, dropped duplicates, blockwise steps and registrations and deregistrations of observations.
+// It replaces the function set by WithErrors before it.
+func WithLogger(logger coapNet.Logger) LoggerOpt {
+	return LoggerOpt{logger: logger}
+}
+
 // GoPoolOpt gopool option.
 type GoPoolOpt struct {
 	goPool GoPoolFunc
@@ -102,37 +131,60 @@ func WithGoPool(goPool GoPoolFunc) GoPoolOpt {
 	return GoPoolOpt{goPool: goPool}
 }
 
+// PingFunc pings the peer of the connection and calls receivePong when the peer answers. It returns function
+// which stops waiting for the answer.
+type PingFunc = func(cc *ClientConn, receivePong func()) (func(), error)
+
 // KeepAliveOpt keepalive option.
 type KeepAliveOpt struct {
-	maxRetries uint32
-	timeout    time.Duration
+	params     *inactivity.KeepAliveParams
 	onInactive inactivity.OnInactiveFunc
+	ping       PingFunc
 }
 
 func (o KeepAliveOpt) apply(opts *serverOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
-	}
+	opts.createInactivityMonitor = o.createMonitor
 }
 
 func (o KeepAliveOpt) applyDial(opts *dialOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
+	opts.createInactivityMonitor = o.createMonitor
+}
+
+func (o KeepAliveOpt) createMonitor() inactivity.Monitor {
+	ping := o.ping
+	if ping == nil {
+		ping = func(cc *ClientConn, receivePong func()) (func(), error) {
+			return cc.AsyncPing(receivePong)
+		}
+	}
+	return inactivity.NewKeepAliveWithParams(o.params, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
+		return ping(cc.(*ClientConn), receivePong)
+	})
+}
+
+// WithKeepAlive pings the connection idle for interval by a Ping signal and calls onInactive when the peer
+// doesn't answer within timeout, e.g. to clean up state of a device which went silent. Round-trip time of the last
+// ping is reported by Snapshot of the connection. The interval is at least inactivity.MinKeepAliveInterval.
+func WithKeepAlive(interval, timeout time.Duration, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+	return WithKeepAliveParams(inactivity.NewKeepAliveParams(interval, timeout), onInactive)
+}
+
+// WithKeepAliveParams is WithKeepAlive with the interval and timeout shared by all connections, which can be
+// changed without restarting the server.
+func WithKeepAliveParams(params *inactivity.KeepAliveParams, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+	return KeepAliveOpt{
+		params:     params,
+		onInactive: onInactive,
 	}
 }
 
-// WithKeepAlive monitoring's client connection's.
-func WithKeepAlive(maxRetries uint32, timeout time.Duration, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+// WithKeepAlivePing is WithKeepAliveParams which pings the peer by ping instead of the Ping signal, e.g. by
+// control frames of the transport which carries the connection.
+func WithKeepAlivePing(params *inactivity.KeepAliveParams, onInactive inactivity.OnInactiveFunc, ping PingFunc) KeepAliveOpt {
 	return KeepAliveOpt{
-		maxRetries: maxRetries,
-		timeout:    timeout,
+		params:     params,
 		onInactive: onInactive,
+		ping:       ping,
 	}
 }
 
@@ -194,6 +246,78 @@ func WithHeartBeat(heartbeat time.Duration) HeartBeatOpt {
 	return HeartBeatOpt{heartbeat: heartbeat}
 }
 
+// IdleTimeoutOpt idle timeouts of read and write operations over connection.
+type IdleTimeoutOpt struct {
+	read  time.Duration
+	write time.Duration
+}
+
+func (o IdleTimeoutOpt) apply(opts *serverOptions) {
+	opts.readIdleTimeout = o.read
+	opts.writeIdleTimeout = o.write
+}
+
+func (o IdleTimeoutOpt) applyDial(opts *dialOptions) {
+	opts.readIdleTimeout = o.read
+	opts.writeIdleTimeout = o.write
+}
+
+// WithIdleTimeout closes the connection when nothing is read from it within read or a write doesn't progress
+// within write, e.g. the peer stopped reading. Zero disables the timeout.
+func WithIdleTimeout(read, write time.Duration) IdleTimeoutOpt {
+	return IdleTimeoutOpt{read: read, write: write}
+}
+
+// DrainTimeoutOpt drain timeout of half-closed connection.
+type DrainTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o DrainTimeoutOpt) apply(opts *serverOptions) {
+	opts.drainTimeout = o.timeout
+}
+
+func (o DrainTimeoutOpt) applyDial(opts *dialOptions) {
+	opts.drainTimeout = o.timeout
+}
+
+// WithDrainTimeout sets time for which responses of requests in progress are sent when the peer half-closed
+// the connection, before the connection is closed. Zero closes the connection immediately.
+func WithDrainTimeout(timeout time.Duration) DrainTimeoutOpt {
+	return DrainTimeoutOpt{timeout: timeout}
+}
+
+// ShutdownMaxAgeOpt shutdown Max-Age option.
+type ShutdownMaxAgeOpt struct {
+	maxAge time.Duration
+}
+
+func (o ShutdownMaxAgeOpt) apply(opts *serverOptions) {
+	opts.shutdownMaxAge = o.maxAge
+}
+
+// WithShutdownMaxAge sets Max-Age of 5.03 Service Unavailable responses which cancel observations of the clients
+// by Shutdown, so the clients know when to register again. By default it is DefaultShutdownMaxAge.
+func WithShutdownMaxAge(maxAge time.Duration) ShutdownMaxAgeOpt {
+	return ShutdownMaxAgeOpt{maxAge: maxAge}
+}
+
+// LimitsOpt limits option.
+type LimitsOpt struct {
+	limits limits.Limits
+}
+
+func (o LimitsOpt) apply(opts *serverOptions) {
+	opts.limits = &o.limits
+}
+
+// WithLimits bounds sessions of the server, requests in progress and observations per peer and rate of messages
+// per source address. Requests over the limits are rejected by 4.29 Too Many Requests with Max-Age as the hint
+// when to retry.
+func WithLimits(l limits.Limits) LimitsOpt {
+	return LimitsOpt{limits: l}
+}
+
 // BlockwiseOpt network option.
 type BlockwiseOpt struct {
 	enable          bool
@@ -222,6 +346,65 @@ func WithBlockwise(enable bool, szx blockwise.SZX, transferTimeout time.Duration
 	}
 }
 
+// BlockwiseLimitsOpt network option.
+type BlockwiseLimitsOpt struct {
+	limits blockwise.Limits
+}
+
+func (o BlockwiseLimitsOpt) apply(opts *serverOptions) {
+	opts.blockwiseLimits = o.limits
+}
+
+func (o BlockwiseLimitsOpt) applyDial(opts *dialOptions) {
+	opts.blockwiseLimits = o.limits
+}
+
+// WithBlockwiseLimits sets timeouts and memory caps of partial blockwise transfers per peer, and function
+// which is called when a stalled transfer is dropped.
+func WithBlockwiseLimits(limits blockwise.Limits) BlockwiseLimitsOpt {
+	return BlockwiseLimitsOpt{limits: limits}
+}
+
+// BlockwiseProgressOpt network option.
+type BlockwiseProgressOpt struct {
+	progress blockwise.ProgressFunc
+}
+
+func (o BlockwiseProgressOpt) apply(opts *serverOptions) {
+	opts.blockwiseProgress = o.progress
+}
+
+func (o BlockwiseProgressOpt) applyDial(opts *dialOptions) {
+	opts.blockwiseProgress = o.progress
+}
+
+// WithBlockwiseProgress sets function which is called after each block of bodies transferred in multiple blocks,
+// e.g. to show progress of a firmware update. A transfer of a request is aborted by cancellation of its context.
+func WithBlockwiseProgress(progress blockwise.ProgressFunc) BlockwiseProgressOpt {
+	return BlockwiseProgressOpt{progress: progress}
+}
+
+// ControlLaneOpt control lane option.
+type ControlLaneOpt struct {
+	size int
+}
+
+func (o ControlLaneOpt) apply(opts *serverOptions) {
+	opts.controlLaneSize = o.size
+}
+
+func (o ControlLaneOpt) applyDial(opts *dialOptions) {
+	opts.controlLaneSize = o.size
+}
+
+// WithControlLane sets number of queued signal messages, e.g. pings and pongs, which are processed by
+// a dedicated go routine, so reading of the connection isn't blocked by them while a synchronous Do waits.
+// When the queue is full or zero, signal messages are processed by the reading go routine.
+// Default is DefaultControlLaneSize.
+func WithControlLane(size int) ControlLaneOpt {
+	return ControlLaneOpt{size: size}
+}
+
 // OnNewClientConnOpt network option.
 type OnNewClientConnOpt struct {
 	onNewClientConn OnNewClientConnFunc
@@ -321,3 +504,306 @@ func WithDialer(dialer *net.Dialer) DialerOpt {
 		dialer: dialer,
 	}
 }
+
+// ObservationStoreOpt observation store option.
+type ObservationStoreOpt struct {
+	store observation.Store
+}
+
+func (o ObservationStoreOpt) applyDial(opts *dialOptions) {
+	opts.observationStore = o.store
+}
+
+// WithObservationStore persists observations of the client to store, so they can be re-established
+// by ClientConn.RestoreObservations after restart.
+func WithObservationStore(store observation.Store) ObservationStoreOpt {
+	return ObservationStoreOpt{store: store}
+}
+
+// TokenManagerOpt token manager option.
+type TokenManagerOpt struct {
+	tokenManager message.TokenManager
+}
+
+func (o TokenManagerOpt) applyDial(opts *dialOptions) {
+	opts.tokenManager = o.tokenManager
+}
+
+// WithTokenManager sets generator of tokens of requests of the client. By default tokens of
+// message.DefaultTokenLength bytes are generated by crypto/rand and they aren't reused while their exchanges
+// or observations are outstanding.
+func WithTokenManager(tokenManager message.TokenManager) TokenManagerOpt {
+	return TokenManagerOpt{tokenManager: tokenManager}
+}
+
+// BackpressureOpt backpressure option.
+type BackpressureOpt struct {
+	backpressure Backpressure
+}
+
+func (o BackpressureOpt) apply(opts *serverOptions) {
+	opts.backpressure = o.backpressure
+}
+
+func (o BackpressureOpt) applyDial(opts *dialOptions) {
+	opts.backpressure = o.backpressure
+}
+
+// WithBackpressure set function which is called when a notification is written to the observer with threshold
+// or more notifications being written to the connection, so the application can downsample notifications
+// for the congested observer. The backlog is available by ClientConn.ObserverBacklog regardless of the option.
+func WithBackpressure(threshold int, onSlow SlowObserverFunc) BackpressureOpt {
+	return BackpressureOpt{backpressure: Backpressure{Threshold: threshold, OnSlow: onSlow}}
+}
+
+// OSCOREOpt OSCORE option.
+type OSCOREOpt struct {
+	ctx *oscore.Context
+}
+
+func (o OSCOREOpt) apply(opts *serverOptions) {
+	opts.oscoreContext = o.ctx
+}
+
+func (o OSCOREOpt) applyDial(opts *dialOptions) {
+	opts.oscoreContext = o.ctx
+}
+
+// WithOSCORE protects requests, responses and notifications end-to-end by OSCORE (RFC 8613) security context.
+// Unprotected requests are rejected with 4.01 Unauthorized. A server shares the context by all connections.
+func WithOSCORE(ctx *oscore.Context) OSCOREOpt {
+	return OSCOREOpt{ctx: ctx}
+}
+
+// TraceOpt trace option.
+type TraceOpt struct {
+	handler TraceHandler
+}
+
+func (o TraceOpt) apply(opts *serverOptions) {
+	opts.traceHandler = o.handler
+}
+
+func (o TraceOpt) applyDial(opts *dialOptions) {
+	opts.traceHandler = o.handler
+}
+
+// WithTrace calls handler with events of sent and received messages and blockwise steps of each connection,
+// e.g. to create OpenTelemetry spans.
+func WithTrace(handler TraceHandler) TraceOpt {
+	return TraceOpt{handler: handler}
+}
+
+// StatsOpt stats option.
+type StatsOpt struct {
+	stats metrics.Stats
+}
+
+func (o StatsOpt) apply(opts *serverOptions) {
+	opts.stats = o.stats
+}
+
+func (o StatsOpt) applyDial(opts *dialOptions) {
+	opts.stats = o.stats
+}
+
+// WithStats passes statistics of each connection to the collector: messages by code and type, retransmissions,
+// duplicates, blockwise transfers, sessions, observations and exchange latency. The collector of the package
+// metrics/prometheus exposes them to Prometheus.
+func WithStats(collector metrics.Stats) StatsOpt {
+	return StatsOpt{stats: collector}
+}
+
+// EchoVerificationOpt echo verification option.
+type EchoVerificationOpt struct {
+	window time.Duration
+}
+
+func (o EchoVerificationOpt) apply(opts *serverOptions) {
+	opts.echoWindow = o.window
+}
+
+// WithEchoVerification verifies freshness of unsafe requests by Echo option (RFC 9175). A request without
+// an Echo value created by the server within window is challenged by 4.01 Unauthorized with a new Echo value,
+// which the client repeats in the request.
+func WithEchoVerification(window time.Duration) EchoVerificationOpt {
+	return EchoVerificationOpt{window: window}
+}
+
+// BERTOpt BERT option.
+type BERTOpt struct{}
+
+func (o BERTOpt) apply(opts *serverOptions) {
+	opts.bert = true
+}
+
+func (o BERTOpt) applyDial(opts *dialOptions) {
+	opts.bert = true
+}
+
+// WithBERT enables BERT block-wise transfers (RFC 8323 section 6), which carry multiples of 1024 bytes per block.
+// Blocks are sized by the smaller of own and peer's Max-Message-Size, so BERT is used only when both peers indicate
+// Block-Wise-Transfer in CSM and the size allows more than one 1024 bytes block. It requires enabled blockwise.
+func WithBERT() BERTOpt {
+	return BERTOpt{}
+}
+
+// CSMOptionsOpt CSM options option.
+type CSMOptionsOpt struct {
+	opts message.Options
+}
+
+func (o CSMOptionsOpt) apply(opts *serverOptions) {
+	opts.csmOptions = o.opts
+}
+
+func (o CSMOptionsOpt) applyDial(opts *dialOptions) {
+	opts.csmOptions = o.opts
+}
+
+// WithCSMOptions adds the options to CSM which is sent when the connection is created, e.g. custom capability
+// options of the application. The peer gets them by PeerCapabilities.
+func WithCSMOptions(opts ...message.Option) CSMOptionsOpt {
+	return CSMOptionsOpt{opts: opts}
+}
+
+// ParserLimitsOpt parser limits option.
+type ParserLimitsOpt struct {
+	limits message.ParserLimits
+}
+
+func (o ParserLimitsOpt) apply(opts *serverOptions) {
+	opts.parserLimits = o.limits
+}
+
+func (o ParserLimitsOpt) applyDial(opts *dialOptions) {
+	opts.parserLimits = o.limits
+}
+
+// WithParserLimits bounds received messages independently of the max message size: the number of options,
+// the length of an option value, the length of the token and the length of the payload. Zero disables a limit.
+// A request which exceeds them is answered by 4.13 (Request Entity Too Large), other messages are dropped,
+// and message.ParserLimitError is passed to the errors handler.
+func WithParserLimits(maxOptions, maxOptionLen, maxTokenLen, maxPayload int) ParserLimitsOpt {
+	return ParserLimitsOpt{limits: message.ParserLimits{
+		MaxOptions:   maxOptions,
+		MaxOptionLen: maxOptionLen,
+		MaxTokenLen:  maxTokenLen,
+		MaxPayload:   maxPayload,
+	}}
+}
+
+// StrictSignalingOpt strict signaling option.
+type StrictSignalingOpt struct {
+	csmTimeout time.Duration
+}
+
+func (o StrictSignalingOpt) apply(opts *serverOptions) {
+	opts.strictSignaling = true
+	opts.csmTimeout = o.csmTimeout
+}
+
+func (o StrictSignalingOpt) applyDial(opts *dialOptions) {
+	opts.strictSignaling = true
+	opts.csmTimeout = o.csmTimeout
+}
+
+// WithStrictSignaling enforces the signaling state machine of RFC 8323 instead of the lenient default: when
+// the first message of the peer isn't CSM or the peer doesn't send CSM within csmTimeout, the connection is
+// aborted by Abort (7.05) and closed, and Abort of the peer closes the connection. Zero csmTimeout waits for
+// CSM without limit. The state is reported by SignalingState of the connection.
+func WithStrictSignaling(csmTimeout time.Duration) StrictSignalingOpt {
+	return StrictSignalingOpt{csmTimeout: csmTimeout}
+}
+
+// RetryPolicyOpt retry policy option.
+type RetryPolicyOpt struct {
+	policy RetryPolicy
+}
+
+func (o RetryPolicyOpt) applyDial(opts *dialOptions) {
+	opts.retryPolicy = &o.policy
+}
+
+// WithRetryPolicy re-dials the target of Dial when the connection drops, re-establishes CSM and re-subscribes
+// active observations. Idempotent requests (GET and FETCH) interrupted by the drop are replayed over the new
+// connection, other ones fail and are reported to OnNotRetried of the policy.
+func WithRetryPolicy(policy RetryPolicy) RetryPolicyOpt {
+	return RetryPolicyOpt{policy: policy}
+}
+
+// RetryAfterOpt retry after option.
+type RetryAfterOpt struct {
+	policy RetryAfterPolicy
+}
+
+func (o RetryAfterOpt) applyDial(opts *dialOptions) {
+	opts.retryAfter = o.policy
+}
+
+// WithRetryAfter repeats requests of the client which the server rejected by 4.29 (Too Many Requests, RFC 8516)
+// or 5.03 (Service Unavailable) after Max-Age of the rejection, see RetryAfter. By default the rejection is
+// returned to the caller.
+func WithRetryAfter(policy RetryAfterPolicy) RetryAfterOpt {
+	return RetryAfterOpt{policy: policy}
+}
+
+// WriteTimeoutOpt write timeout option.
+type WriteTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o WriteTimeoutOpt) apply(opts *serverOptions) {
+	opts.writeTimeout = o.timeout
+}
+
+func (o WriteTimeoutOpt) applyDial(opts *dialOptions) {
+	opts.writeTimeout = o.timeout
+}
+
+// WithWriteTimeout bounds each write of a message to the connection by the timeout, independently of context
+// of the message, so a peer which doesn't read stalls the writers at most for the timeout. A write which
+// doesn't complete in time fails with coapNet.TimeoutError of coapNet.TimeoutNetwork and closes the connection,
+// because the message may be written partially. Zero disables the timeout.
+func WithWriteTimeout(timeout time.Duration) WriteTimeoutOpt {
+	return WriteTimeoutOpt{timeout: timeout}
+}
+
+// ExchangeTimeoutOpt exchange timeout option.
+type ExchangeTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o ExchangeTimeoutOpt) apply(opts *serverOptions) {
+	opts.exchangeTimeout = o.timeout
+}
+
+func (o ExchangeTimeoutOpt) applyDial(opts *dialOptions) {
+	opts.exchangeTimeout = o.timeout
+}
+
+// WithExchangeTimeout bounds each request whose context has no deadline by the timeout. A request without
+// the response in time fails with coapNet.TimeoutError of coapNet.TimeoutExchange. Zero disables the timeout.
+func WithExchangeTimeout(timeout time.Duration) ExchangeTimeoutOpt {
+	return ExchangeTimeoutOpt{timeout: timeout}
+}
+
+// MessagePoolOpt message pool option.
+type MessagePoolOpt struct {
+	pool *pool.Pool
+}
+
+func (o MessagePoolOpt) apply(opts *serverOptions) {
+	opts.messagePool = o.pool
+}
+
+func (o MessagePoolOpt) applyDial(opts *dialOptions) {
+	opts.messagePool = o.pool
+}
+
+// WithMessagePool sets pool of messages acquired by the connections, e.g. received messages and responses,
+// so memory of messages is bounded and observed per server or client by Stats of the pool. Nil, the default,
+// is the package-level pool of pool.AcquireMessage.
+func WithMessagePool(p *pool.Pool) MessagePoolOpt {
+	return MessagePoolOpt{pool: p}
+}
@@ -0,0 +1,61 @@
+package tcp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+func newOSCOREEndpoint(ctx *oscore.Context) *oscore.Endpoint {
+	if ctx == nil {
+		return nil
+	}
+	return oscore.NewEndpoint(ctx)
+}
+
+// isSignal returns true for signaling messages (RFC 8323 section 5), which are never protected.
+func isSignal(code codes.Code) bool {
+	return code >= codes.CSM && code <= codes.Abort
+}
+
+// protect encrypts outgoing message by OSCORE.
+func (s *Session) protect(msg *pool.Message) error {
+	if s.oscore == nil || isSignal(msg.Code()) || msg.HasOption(message.OSCORE) {
+		return nil
+	}
+	err := s.oscore.Protect(msg.Message)
+	if err != nil {
+		return fmt.Errorf("cannot protect message: %w", err)
+	}
+	return nil
+}
+
+// unprotect decrypts incoming message by OSCORE. When it fails, error response is sent to the request
+// and false is returned.
+func (s *Session) unprotect(req *pool.Message) bool {
+	if s.oscore == nil {
+		return true
+	}
+	err := s.oscore.Unprotect(req.Message)
+	if err == nil {
+		return true
+	}
+	if req.Code() >= 32 {
+		s.errors(fmt.Errorf("cannot unprotect response: %w", err))
+		return false
+	}
+	resp := s.messagePool.AcquireMessage(s.Context())
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(oscore.ErrorCode(err))
+	resp.SetToken(req.Token())
+	resp.SetBody(bytes.NewReader([]byte(err.Error())))
+	err = s.writeMessage(resp)
+	if err != nil {
+		s.errors(fmt.Errorf("cannot write response: %w", err))
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+const (
+	defaultRetryMinBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// ErrNotRetried is returned for a request which was interrupted by drop of the connection and cannot be safely
+// replayed, because it isn't idempotent.
+var ErrNotRetried = errors.New("request cannot be retried")
+
+// RetryPolicy configures re-dialing of the connection and replaying of requests, see WithRetryPolicy.
+type RetryPolicy struct {
+	// MinBackoff is delay before the first re-dial, it doubles with each failed re-dial. Zero means 100ms.
+	MinBackoff time.Duration
+	// MaxBackoff bounds the delay. Zero means 10s.
+	MaxBackoff time.Duration
+	// Jitter randomizes the delay by up to the fraction of it, e.g. 0.2 for ±20%.
+	Jitter float64
+	// MaxRetries limits re-dials after a drop and replays of a request, zero means no limit.
+	MaxRetries int
+	// OnNotRetried is called for a request which was interrupted by the drop and isn't idempotent, the request
+	// fails with ErrNotRetried.
+	OnNotRetried func(req *pool.Message, err error)
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	d := minBackoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d)) //nolint:gosec
+	}
+	return d
+}
+
+func isIdempotent(code codes.Code) bool {
+	return code == codes.GET || code == codes.FETCH
+}
+
+// retrier replaces the session of the client when its connection drops. The client lives until it is closed
+// or re-dials are exhausted.
+type retrier struct {
+	policy RetryPolicy
+	ctx    context.Context
+	cancel context.CancelFunc
+	dial   func(ctx context.Context) (net.Conn, error)
+	done   chan struct{}
+
+	mutex   sync.Mutex
+	changed chan struct{}
+	onClose []EventFunc
+}
+
+func newRetrier(ctx context.Context, policy RetryPolicy) *retrier {
+	ctx, cancel := context.WithCancel(ctx)
+	return &retrier{
+		policy:  policy,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// run runs sessions of the client until it is closed or re-dials are exhausted.
+func (r *retrier) run(cc *ClientConn) {
+	defer r.close()
+	for {
+		s := cc.Session()
+		err := s.Run(cc)
+		if err != nil {
+			s.errors(fmt.Errorf("%v: %w", s.connection.RemoteAddr(), err))
+		}
+		if r.ctx.Err() != nil || !r.reconnect(cc) {
+			return
+		}
+	}
+}
+
+func (r *retrier) reconnect(cc *ClientConn) bool {
+	for attempt := 1; r.policy.MaxRetries <= 0 || attempt <= r.policy.MaxRetries; attempt++ {
+		select {
+		case <-time.After(r.policy.backoff(attempt)):
+		case <-r.ctx.Done():
+			return false
+		}
+		conn, err := r.dial(r.ctx)
+		if err != nil {
+			cc.Session().errors(fmt.Errorf("cannot re-dial: %w", err))
+			continue
+		}
+		s := cc.newSession(conn)
+		s.traceSession()
+		cc.session.Store(s)
+		r.notify()
+		go cc.resubscribeObservations()
+		return true
+	}
+	cc.Session().errors(fmt.Errorf("cannot re-dial: retries(%v) were exhausted", r.policy.MaxRetries))
+	return false
+}
+
+// notify wakes up requests waiting for the new session.
+func (r *retrier) notify() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *retrier) close() {
+	r.cancel()
+	r.mutex.Lock()
+	close(r.changed)
+	onClose := r.onClose
+	r.onClose = nil
+	r.mutex.Unlock()
+	for _, f := range onClose {
+		f()
+	}
+	close(r.done)
+}
+
+func (r *retrier) addOnClose(f EventFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onClose = append(r.onClose, f)
+}
+
+// waitSession waits until the session replaces the old one.
+func (r *retrier) waitSession(ctx context.Context, cc *ClientConn, old *Session) (*Session, error) {
+	for {
+		r.mutex.Lock()
+		changed := r.changed
+		r.mutex.Unlock()
+		if s := cc.Session(); s != old {
+			return s, nil
+		}
+		if r.ctx.Err() != nil {
+			return nil, fmt.Errorf("connection was closed: %w", r.ctx.Err())
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// do does the request by do, an idempotent request interrupted by drop of the connection is replayed over
+// the new one.
+func (r *retrier) do(cc *ClientConn, req *pool.Message, do func(req *pool.Message) (*pool.Message, error)) (*pool.Message, error) {
+	for retries := 0; ; retries++ {
+		s := cc.Session()
+		if s.Context().Err() != nil {
+			// the connection dropped before the request was sent
+			var err error
+			s, err = r.waitSession(req.Context(), cc, s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		resp, err := do(req)
+		if err == nil || !dropped(s, err) || req.Context().Err() != nil || r.ctx.Err() != nil {
+			return resp, err
+		}
+		if !isIdempotent(req.Code()) {
+			err = fmt.Errorf("%w: %v", ErrNotRetried, err)
+			if r.policy.OnNotRetried != nil {
+				r.policy.OnNotRetried(req, err)
+			}
+			return nil, err
+		}
+		if r.policy.MaxRetries > 0 && retries >= r.policy.MaxRetries {
+			return nil, fmt.Errorf("retries(%v) were exhausted: %w", r.policy.MaxRetries, err)
+		}
+		if body := req.Body(); body != nil {
+			if _, errSeek := body.Seek(0, io.SeekStart); errSeek != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// dropped reports whether the request failed by drop of the connection of the session.
+func dropped(s *Session, err error) bool {
+	return s.Context().Err() != nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// resubscribeObservations registers observations of the client at the server of the new connection.
+func (cc *ClientConn) resubscribeObservations() {
+	observations := make([]*Observation, 0, 4)
+	cc.observations.Range(func(key, value interface{}) bool {
+		observations = append(observations, value.(*Observation))
+		return true
+	})
+	for _, o := range observations {
+		if err := o.resubscribe(); err != nil {
+			cc.Session().errors(fmt.Errorf("cannot re-subscribe observation of %v: %w", o.path, err))
+		}
+	}
+}
+
+func (o *Observation) resubscribe() error {
+	ctx, cancel := context.WithTimeout(o.cc.Context(), refreshTimeout)
+	defer cancel()
+	req, err := newCommonRequest(ctx, o.cc.Session().messagePool, codes.GET, o.path, o.opts...)
+	if err != nil {
+		return err
+	}
+	defer pool.ReleaseMessage(req)
+	req.SetObserve(0)
+	req.SetToken(o.token)
+
+	o.mutex.Lock()
+	// the server of the new connection numbers notifications from scratch
+	o.obsSequence = 0
+	o.lastEvent = time.Time{}
+	o.mutex.Unlock()
+	if atomic.LoadUint32(&o.waitForReponse) == 1 {
+		// Observe still waits for the response of the registration
+		return o.cc.WriteMessage(req)
+	}
+	respCodeChan := make(chan codes.Code, 1)
+	o.respCodeChan = respCodeChan
+	atomic.StoreUint32(&o.waitForReponse, 1)
+	if err = o.cc.WriteMessage(req); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case code := <-respCodeChan:
+		if code != codes.Content {
+			return fmt.Errorf("unexpected return code(%v)", code)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package tcp
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// RetryAfter returns time after which the request rejected by the response can be retried. It is Max-Age
+// of 4.29 (Too Many Requests, RFC 8516) and 5.03 (Service Unavailable, RFC 7252 section 5.9.3.4) responses,
+// by default 60 seconds. It returns false for other responses.
+func RetryAfter(r *pool.Message) (time.Duration, bool) {
+	switch r.Code() {
+	case codes.TooManyRequests, codes.ServiceUnavailable:
+		return getMaxAge(r), true
+	}
+	return 0, false
+}
+
+// RetryAfterPolicy repeats requests of the client rejected by 4.29 (Too Many Requests) or 5.03 (Service
+// Unavailable) after RetryAfter of the response. A rejection which cannot be waited for before the deadline
+// of the request is returned to the caller.
+type RetryAfterPolicy struct {
+	// MaxRetries limits repetitions of a request, zero disables them.
+	MaxRetries int
+	// MaxDelay bounds the waited time, a rejection with longer RetryAfter is returned. Zero means no bound.
+	MaxDelay time.Duration
+}
+
+// delay returns time to wait before the request of ctx rejected by the response is repeated.
+func (p RetryAfterPolicy) delay(ctx context.Context, r *pool.Message) (time.Duration, bool) {
+	d, ok := RetryAfter(r)
+	if !ok || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		return 0, false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return 0, false
+	}
+	return d, true
+}
+
+// doRequestWithRetryAfter repeats the request rejected by the server after RetryAfter of the rejection. The
+// request isn't changed by the retries, they send its copies.
+func (cc *ClientConn) doRequestWithRetryAfter(req *pool.Message) (*pool.Message, error) {
+	for retries := 0; ; retries++ {
+		resp, err := cc.doRequestWithEcho(req, retries > 0)
+		if err != nil || retries >= cc.retryAfter.MaxRetries {
+			return resp, err
+		}
+		d, ok := cc.retryAfter.delay(req.Context(), resp)
+		if !ok {
+			return resp, nil
+		}
+		select {
+		case <-time.After(d):
+		case <-req.Context().Done():
+			return resp, nil
+		}
+		if body := req.Body(); body != nil {
+			if _, err = body.Seek(0, io.SeekStart); err != nil {
+				return resp, nil
+			}
+		}
+		pool.ReleaseMessage(resp)
+	}
+}
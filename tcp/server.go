@@ -7,15 +7,20 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/metrics"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 	kitSync "github.com/plgd-dev/kit/sync"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/echo"
 
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 )
@@ -59,8 +64,11 @@ var defaultServerOptions = serverOptions{
 	blockwiseEnable:          true,
 	blockwiseSZX:             blockwise.SZX1024,
 	blockwiseTransferTimeout: time.Second * 3,
+	controlLaneSize:          DefaultControlLaneSize,
 	onNewClientConn:          func(cc *ClientConn, tlscon *tls.Conn) {},
 	heartBeat:                time.Millisecond * 100,
+	drainTimeout:             DefaultDrainTimeout,
+	shutdownMaxAge:           DefaultShutdownMaxAge,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
 	},
@@ -71,15 +79,37 @@ type serverOptions struct {
 	maxMessageSize                  int
 	handler                         HandlerFunc
 	errors                          ErrorFunc
+	logger                          coapNet.Logger
 	goPool                          GoPoolFunc
 	createInactivityMonitor         func() inactivity.Monitor
 	blockwiseSZX                    blockwise.SZX
 	blockwiseEnable                 bool
 	blockwiseTransferTimeout        time.Duration
+	blockwiseLimits                 blockwise.Limits
+	blockwiseProgress               blockwise.ProgressFunc
 	onNewClientConn                 OnNewClientConnFunc
 	heartBeat                       time.Duration
+	readIdleTimeout                 time.Duration
+	writeIdleTimeout                time.Duration
+	drainTimeout                    time.Duration
 	disablePeerTCPSignalMessageCSMs bool
 	disableTCPSignalMessageCSM      bool
+	oscoreContext                   *oscore.Context
+	controlLaneSize                 int
+	traceHandler                    TraceHandler
+	backpressure                    Backpressure
+	stats                           metrics.Stats
+	echoWindow                      time.Duration
+	bert                            bool
+	csmOptions                      message.Options
+	parserLimits                    message.ParserLimits
+	strictSignaling                 bool
+	csmTimeout                      time.Duration
+	writeTimeout                    time.Duration
+	exchangeTimeout                 time.Duration
+	messagePool                     *pool.Pool
+	shutdownMaxAge                  time.Duration
+	limits                          *limits.Limits
 }
 
 // Listener defined used by coap
@@ -97,16 +127,39 @@ type Server struct {
 	blockwiseSZX                    blockwise.SZX
 	blockwiseEnable                 bool
 	blockwiseTransferTimeout        time.Duration
+	blockwiseLimits                 blockwise.Limits
+	blockwiseProgress               blockwise.ProgressFunc
 	onNewClientConn                 OnNewClientConnFunc
 	heartBeat                       time.Duration
+	readIdleTimeout                 time.Duration
+	writeIdleTimeout                time.Duration
+	drainTimeout                    time.Duration
 	disablePeerTCPSignalMessageCSMs bool
 	disableTCPSignalMessageCSM      bool
+	oscoreContext                   *oscore.Context
+	controlLaneSize                 int
+	traceHandler                    TraceHandler
+	backpressure                    Backpressure
+	bert                            bool
+	csmOptions                      message.Options
+	parserLimits                    message.ParserLimits
+	strictSignaling                 bool
+	csmTimeout                      time.Duration
+	writeTimeout                    time.Duration
+	exchangeTimeout                 time.Duration
+	messagePool                     *pool.Pool
+	shutdownMaxAge                  time.Duration
+	limiter                         *limits.Limiter
+	shuttingDown                    uint32
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	listen      Listener
 	listenMutex sync.Mutex
+
+	conns      map[*ClientConn]struct{}
+	connsMutex sync.Mutex
 }
 
 func NewServer(opt ...ServerOption) *Server {
@@ -123,9 +176,31 @@ func NewServer(opt ...ServerOption) *Server {
 		}
 	}
 
+	if opts.echoWindow > 0 {
+		verifier, err := echo.NewVerifier(opts.echoWindow)
+		if err != nil {
+			opts.errors(fmt.Errorf("tcp: cannot create echo verifier: %w", err))
+		}
+		opts.handler = NewEchoVerificationHandler(verifier, opts.handler)
+	}
+
+	var limiter *limits.Limiter
+	if opts.limits != nil {
+		limiter = limits.NewLimiter(*opts.limits)
+		opts.handler = NewRateLimitHandler(limiter, NewLimitsHandler(limiter, opts.handler))
+	}
+
+	if opts.logger != nil {
+		opts.traceHandler = coapNet.LogTraceHandler(opts.logger, opts.traceHandler)
+	}
+	if opts.stats != nil {
+		opts.traceHandler = metrics.TraceHandler(opts.stats, opts.traceHandler)
+	}
+
 	return &Server{
 		ctx:            ctx,
 		cancel:         cancel,
+		conns:          make(map[*ClientConn]struct{}),
 		handler:        opts.handler,
 		maxMessageSize: opts.maxMessageSize,
 		errors: func(err error) {
@@ -139,9 +214,28 @@ func NewServer(opt ...ServerOption) *Server {
 		blockwiseSZX:                    opts.blockwiseSZX,
 		blockwiseEnable:                 opts.blockwiseEnable,
 		blockwiseTransferTimeout:        opts.blockwiseTransferTimeout,
+		blockwiseLimits:                 opts.blockwiseLimits,
+		blockwiseProgress:               opts.blockwiseProgress,
 		heartBeat:                       opts.heartBeat,
+		readIdleTimeout:                 opts.readIdleTimeout,
+		writeIdleTimeout:                opts.writeIdleTimeout,
+		drainTimeout:                    opts.drainTimeout,
 		disablePeerTCPSignalMessageCSMs: opts.disablePeerTCPSignalMessageCSMs,
 		disableTCPSignalMessageCSM:      opts.disableTCPSignalMessageCSM,
+		oscoreContext:                   opts.oscoreContext,
+		controlLaneSize:                 opts.controlLaneSize,
+		traceHandler:                    opts.traceHandler,
+		backpressure:                    opts.backpressure,
+		bert:                            opts.bert,
+		csmOptions:                      opts.csmOptions,
+		parserLimits:                    opts.parserLimits,
+		strictSignaling:                 opts.strictSignaling,
+		csmTimeout:                      opts.csmTimeout,
+		writeTimeout:                    opts.writeTimeout,
+		exchangeTimeout:                 opts.exchangeTimeout,
+		messagePool:                     opts.messagePool,
+		shutdownMaxAge:                  opts.shutdownMaxAge,
+		limiter:                         limiter,
 		onNewClientConn:                 opts.onNewClientConn,
 		createInactivityMonitor:         opts.createInactivityMonitor,
 	}
@@ -204,10 +298,21 @@ func (s *Server) Serve(l Listener) error {
 		if !ok {
 			return nil
 		}
+		if rw != nil && atomic.LoadUint32(&s.shuttingDown) == 1 {
+			rw.Close()
+			continue
+		}
+		if rw != nil && s.limiter != nil && !s.limiter.AcquireSession() {
+			rw.Close()
+			continue
+		}
 		if rw != nil {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
+				if s.limiter != nil {
+					defer s.limiter.ReleaseSession()
+				}
 				var cc *ClientConn
 				monitor := s.createInactivityMonitor()
 				opts := []coapNet.ConnOption{
@@ -216,6 +321,8 @@ func (s *Server) Serve(l Listener) error {
 						monitor.CheckInactivity(cc)
 						return nil
 					}),
+					coapNet.WithReadIdleTimeout(s.readIdleTimeout),
+					coapNet.WithWriteIdleTimeout(s.writeIdleTimeout),
 				}
 				cc = s.createClientConn(coapNet.NewConn(rw, opts...), monitor)
 				if s.onNewClientConn != nil {
@@ -225,6 +332,11 @@ func (s *Server) Serve(l Listener) error {
 						s.onNewClientConn(cc, nil)
 					}
 				}
+				s.addClientConn(cc)
+				defer s.removeClientConn(cc)
+				if s.limiter != nil {
+					defer s.limiter.RemovePeer(cc)
+				}
 				err := cc.Run()
 				if err != nil {
 					s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
@@ -234,16 +346,67 @@ func (s *Server) Serve(l Listener) error {
 	}
 }
 
+func (s *Server) addClientConn(cc *ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	s.conns[cc] = struct{}{}
+}
+
+func (s *Server) removeClientConn(cc *ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	delete(s.conns, cc)
+}
+
+func (s *Server) getClientConns() []*ClientConn {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	conns := make([]*ClientConn, 0, len(s.conns))
+	for cc := range s.conns {
+		conns = append(conns, cc)
+	}
+	return conns
+}
+
 // Stop stops server without wait of ends Serve function.
 func (s *Server) Stop() {
 	s.cancel()
 }
 
+// Shutdown stops accepting new connections, waits until requests in progress, separate responses and blockwise
+// transfers of the connections are finished, cancels observations of the clients by 5.03 Service Unavailable
+// with Max-Age set by WithShutdownMaxAge and stops the server. When ctx is done before that, the server
+// is stopped immediately and ctx error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreUint32(&s.shuttingDown, 1)
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var err error
+	for _, cc := range s.getClientConns() {
+		wg.Add(1)
+		go func(cc *ClientConn) {
+			defer wg.Done()
+			errShutdown := cc.shutdown(ctx, s.shutdownMaxAge)
+			errMutex.Lock()
+			defer errMutex.Unlock()
+			if err == nil && errShutdown != nil {
+				err = fmt.Errorf("%v: %w", cc.RemoteAddr(), errShutdown)
+			}
+		}(cc)
+	}
+	wg.Wait()
+	s.Stop()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.Monitor) *ClientConn {
 	var blockWise *blockwise.BlockWise
 	if s.blockwiseEnable {
 		blockWise = blockwise.NewBlockWise(
-			bwAcquireMessage,
+			bwAcquireMessage(s.messagePool),
 			bwReleaseMessage,
 			s.blockwiseTransferTimeout,
 			s.errors,
@@ -251,6 +414,8 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 			func(token message.Token) (blockwise.Message, bool) {
 				return nil, false
 			},
+			blockwise.WithLimits(s.blockwiseLimits),
+			blockwise.WithProgress(s.blockwiseProgress),
 		)
 	}
 	obsHandler := NewHandlerContainer()
@@ -267,8 +432,19 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 			s.disablePeerTCPSignalMessageCSMs,
 			s.disableTCPSignalMessageCSM,
 			true,
-			monitor),
-		obsHandler, kitSync.NewMap(),
+			monitor,
+			s.oscoreContext,
+			s.controlLaneSize,
+			s.traceHandler,
+			s.bert,
+			s.drainTimeout,
+			s.csmOptions,
+			s.parserLimits,
+			s.strictSignaling,
+			s.csmTimeout,
+			s.writeTimeout,
+			s.messagePool),
+		obsHandler, kitSync.NewMap(), nil, nil, s.backpressure, s.exchangeTimeout,
 	)
 
 	return cc
@@ -5,7 +5,11 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
 	"math/big"
+	"net"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -14,8 +18,10 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
 	"github.com/plgd-dev/go-coap/v2/tcp"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 	"github.com/stretchr/testify/require"
 )
@@ -232,7 +238,7 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 				checkCloseWg.Done()
 			})
 		}),
-		tcp.WithKeepAlive(3, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+		tcp.WithKeepAlive(50*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
 			require.False(t, inactivityDetected)
 			inactivityDetected = true
 			cc.Close()
@@ -271,3 +277,468 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestServer_DebugDump(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sd := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+	}))
+	defer sd.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	var buf bytes.Buffer
+	err = sd.DebugDump(&buf)
+	require.NoError(t, err)
+	var snapshot tcp.DebugSnapshot
+	err = json.Unmarshal(buf.Bytes(), &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, ld.Addr().String(), snapshot.LocalAddr)
+	require.Len(t, snapshot.Sessions, 1)
+	require.NotEmpty(t, snapshot.Sessions[0].RemoteAddr)
+	require.Greater(t, snapshot.MessagePool.Acquired, uint64(0))
+}
+
+func TestServer_HalfClose(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := tcp.NewServer(tcp.WithDrainTimeout(time.Second*5), tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		// the response is written after the client half-closed the connection
+		time.Sleep(time.Millisecond * 200)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		require.NoError(t, err)
+	}))
+	var serverWg sync.WaitGroup
+	defer serverWg.Wait()
+	defer sd.Stop()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	conn, err := net.Dial("tcp4", ld.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	req, err := tcp.NewGetRequest(context.Background(), "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	req.SetToken([]byte{1, 2, 3})
+	data, err := req.Marshal()
+	require.NoError(t, err)
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+	err = conn.(*net.TCPConn).CloseWrite()
+	require.NoError(t, err)
+
+	err = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+	require.NoError(t, err)
+	received, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	// the server closed the connection after the response, CSM of the server is first
+	for len(received) > 0 {
+		var hdr coapTCP.MessageHeader
+		err = hdr.Unmarshal(received)
+		require.NoError(t, err)
+		resp := pool.AcquireMessage(context.Background())
+		_, err = resp.Unmarshal(received[:hdr.TotalLen])
+		require.NoError(t, err)
+		received = received[hdr.TotalLen:]
+		if resp.Code() == codes.CSM {
+			continue
+		}
+		require.Equal(t, codes.Content, resp.Code())
+		require.Equal(t, message.Token([]byte{1, 2, 3}), resp.Token())
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		require.Equal(t, []byte("done"), body)
+		require.Empty(t, received)
+		return
+	}
+	require.Fail(t, "response wasn't received")
+}
+
+func TestServer_ReadIdleTimeout(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := tcp.NewServer(tcp.WithIdleTimeout(time.Millisecond*300, 0))
+	var serverWg sync.WaitGroup
+	defer serverWg.Wait()
+	defer sd.Stop()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	conn, err := net.Dial("tcp4", ld.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	start := time.Now()
+	err = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+	require.NoError(t, err)
+	// the idle connection is closed by the server
+	_, err = ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), time.Second*2)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := tcp.NewServer(tcp.WithShutdownMaxAge(time.Second*10), tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		path, err := r.Path()
+		require.NoError(t, err)
+		switch path {
+		case "slow":
+			time.Sleep(time.Millisecond * 300)
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		case "obs":
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("0")), message.Option{ID: message.Observe, Value: []byte{2}})
+		}
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	notifications := make(chan *pool.Message, 4)
+	_, err = cc.Observe(ctx, "/obs", func(n *pool.Message) {
+		n.Hijack()
+		notifications <- n
+	})
+	require.NoError(t, err)
+	<-notifications
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		resp, err := cc.Get(ctx, "/slow")
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+	}()
+	// the slow request is in progress
+	time.Sleep(time.Millisecond * 100)
+	err = sd.Shutdown(ctx)
+	require.NoError(t, err)
+	<-slowDone
+
+	select {
+	case n := <-notifications:
+		require.Equal(t, codes.ServiceUnavailable, n.Code())
+		require.False(t, n.HasOption(message.Observe))
+		maxAge, err := n.GetOptionUint32(message.MaxAge)
+		require.NoError(t, err)
+		require.Equal(t, uint32(10), maxAge)
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+}
+
+func TestServer_Limits(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}), tcp.WithLimits(limits.Limits{
+		MaxSessions:  1,
+		MessageRate:  0.5,
+		MessageBurst: 1,
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	pool.ReleaseMessage(resp)
+	// over the rate
+	resp, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.TooManyRequests, resp.Code())
+	maxAge, err := resp.GetOptionUint32(message.MaxAge)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), maxAge)
+	pool.ReleaseMessage(resp)
+
+	// the connection over MaxSessions is closed
+	cc2, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer cc2.Close()
+	select {
+	case <-cc2.Done():
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+}
+
+func testServeLocal(t *testing.T, l tcp.Listener, dial func() (*tcp.ClientConn, error)) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	s := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("local")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := dial()
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("local"), body)
+}
+
+func TestServer_Unix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coap.sock")
+	l, err := coapNet.NewUnixListener("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+	testServeLocal(t, l, func() (*tcp.ClientConn, error) {
+		return tcp.DialUnix(path)
+	})
+}
+
+func TestServer_Pipe(t *testing.T) {
+	l := coapNet.NewPipeListener("server")
+	defer l.Close()
+	testServeLocal(t, l, func() (*tcp.ClientConn, error) {
+		return tcp.DialPipe(l)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := tcp.DialPipe(l, tcp.WithContext(ctx))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestServer_RequestInfo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	serverCgf, clientCgf, _, err := createTLSConfig(ctx)
+	require.NoError(t, err)
+	serverCgf.NextProtos = []string{"coap"}
+	clientCgf.NextProtos = []string{"coap"}
+
+	ld, err := coapNet.NewTLSListener("tcp4", "", serverCgf)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	infos := make(chan coapNet.RequestInfo, 1)
+	sd := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		info, ok := coapNet.RequestInfoFromContext(r.Context())
+		require.True(t, ok)
+		infos <- info
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		require.NoError(t, err)
+	}))
+	defer sd.Stop()
+	go func() {
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String(), tcp.WithTLS(clientCgf))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	_, err = cc.Get(ctx, "/")
+	require.NoError(t, err)
+
+	info := <-infos
+	require.Equal(t, "tls", info.Network)
+	require.Equal(t, ld.Addr().(*net.TCPAddr).Port, info.LocalAddr.(*net.TCPAddr).Port)
+	require.NotNil(t, info.RemoteAddr)
+	require.NotEmpty(t, info.CipherSuite)
+	require.Equal(t, "coap", info.NegotiatedProtocol)
+	require.False(t, info.Confirmable)
+}
+
+func TestServer_ParserLimits(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	errs := make(chan error, 4)
+	sd := tcp.NewServer(tcp.WithParserLimits(8, 16, 0, 4), tcp.WithErrors(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}), tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Changed, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("too large")))
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code())
+	size, err := resp.GetOptionUint32(message.Size1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), size)
+	var limitErr *message.ParserLimitError
+	require.ErrorAs(t, <-errs, &limitErr)
+	require.Equal(t, message.LimitPayload, limitErr.Limit)
+
+	// the connection is not closed by the rejected request
+	resp, err = cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("ok")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+}
+
+func TestServer_StrictSignaling(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	errs := make(chan error, 4)
+	sd := tcp.NewServer(tcp.WithStrictSignaling(time.Millisecond*200), tcp.WithErrors(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}), tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// the client sends CSM first
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, tcp.SignalingEstablished, cc.SignalingState())
+	cc.Close()
+	<-cc.Done()
+
+	// the request before CSM is aborted
+	cc, err = tcp.Dial(ld.Addr().String(), tcp.WithDisableTCPSignalMessageCSM())
+	require.NoError(t, err)
+	_, err = cc.Get(ctx, "/a")
+	require.Error(t, err)
+	<-cc.Done()
+	require.Equal(t, tcp.SignalingAborted, cc.SignalingState())
+	require.ErrorIs(t, <-errs, tcp.ErrCSMExpected)
+
+	// the peer which doesn't send anything is aborted after the CSM timeout
+	cc, err = tcp.Dial(ld.Addr().String(), tcp.WithDisableTCPSignalMessageCSM())
+	require.NoError(t, err)
+	select {
+	case <-cc.Done():
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.Equal(t, tcp.SignalingAborted, cc.SignalingState())
+	require.ErrorIs(t, <-errs, tcp.ErrCSMTimeout)
+}
@@ -1,29 +1,44 @@
 package tcp
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/noresponse"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 )
 
 type EventFunc func()
 
+// DefaultDrainTimeout is default time for which responses are sent after the peer half-closed the connection.
+const DefaultDrainTimeout = time.Second * 5
+
+// streamChunkSize is size of chunks of a body set by SetBodyStream written to the connection.
+const streamChunkSize = 16 * 1024
+
 type Session struct {
 	// This field needs to be the first in the struct to ensure proper word alignment on 32-bit platforms.
 	// See: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	sequence   uint64
-	connection *coapNet.Conn
+	connection coapNet.Transport
+	netConn    net.Conn
+	// requestInfoSet is set when transport of received messages is in the context
+	requestInfoSet bool
 
 	maxMessageSize                  int
 	peerMaxMessageSize              uint32
@@ -34,6 +49,18 @@ type Session struct {
 	errors                          ErrorFunc
 	closeSocket                     bool
 	inactivityMonitor               Notifier
+	oscore                          *oscore.Endpoint
+	controlLane                     *controlLane
+	traceHandler                    TraceHandler
+	bert                            bool
+	drainTimeout                    time.Duration
+	csmOptions                      message.Options
+	parserLimits                    message.ParserLimits
+	strictSignaling                 bool
+	csmTimeout                      time.Duration
+	writeTimeout                    time.Duration
+	messagePool                     *pool.Pool
+	signalingState                  uint32
 
 	tokenHandlerContainer *HandlerContainer
 	midHandlerContainer   *HandlerContainer
@@ -44,12 +71,21 @@ type Session struct {
 
 	mutex   sync.Mutex
 	onClose []EventFunc
+	// peerCSMOptions are options of CSM messages of the peer, nil until the peer sends CSM
+	peerCSMOptions message.Options
+	// writeMutex keeps chunks of a streamed body together
+	writeMutex sync.Mutex
+	// handlers counts requests whose responses weren't written yet
+	handlers  *inFlight
+	observers *observers
 
 	cancel context.CancelFunc
 	ctx    atomic.Value
 
 	errSendCSM error
-	done       chan struct{}
+	// errSignaling is reason why the signaling was aborted
+	errSignaling error
+	done         chan struct{}
 }
 
 func NewSession(
@@ -65,6 +101,17 @@ func NewSession(
 	disableTCPSignalMessageCSM bool,
 	closeSocket bool,
 	inactivityMonitor Notifier,
+	oscoreContext *oscore.Context,
+	controlLaneSize int,
+	traceHandler TraceHandler,
+	bert bool,
+	drainTimeout time.Duration,
+	csmOptions message.Options,
+	parserLimits message.ParserLimits,
+	strictSignaling bool,
+	csmTimeout time.Duration,
+	writeTimeout time.Duration,
+	messagePool *pool.Pool,
 ) *Session {
 	ctx, cancel := context.WithCancel(ctx)
 	if errors == nil {
@@ -76,21 +123,37 @@ func NewSession(
 
 	s := &Session{
 		cancel:                          cancel,
-		connection:                      connection,
 		handler:                         handler,
 		maxMessageSize:                  maxMessageSize,
 		tokenHandlerContainer:           NewHandlerContainer(),
 		midHandlerContainer:             NewHandlerContainer(),
 		goPool:                          goPool,
-		errors:                          errors,
 		blockWise:                       blockWise,
 		blockwiseSZX:                    blockwiseSZX,
 		disablePeerTCPSignalMessageCSMs: disablePeerTCPSignalMessageCSMs,
 		disableTCPSignalMessageCSM:      disableTCPSignalMessageCSM,
 		closeSocket:                     closeSocket,
 		inactivityMonitor:               inactivityMonitor,
+		oscore:                          newOSCOREEndpoint(oscoreContext),
+		controlLane:                     newControlLane(controlLaneSize),
+		traceHandler:                    traceHandler,
+		bert:                            bert,
+		drainTimeout:                    drainTimeout,
+		csmOptions:                      csmOptions,
+		parserLimits:                    parserLimits,
+		strictSignaling:                 strictSignaling,
+		csmTimeout:                      csmTimeout,
+		writeTimeout:                    writeTimeout,
+		messagePool:                     messagePool,
+		handlers:                        newInFlight(),
+		observers:                       newObservers(),
 		done:                            make(chan struct{}),
 	}
+	s.errors = func(err error) {
+		errors(&coapNet.ConnError{RemoteAddr: connection.RemoteAddr(), Err: err})
+	}
+	s.connection = coapNet.NewStreamTransport(connection, s.frame)
+	s.netConn = connection.Connection()
 	s.ctx.Store(&ctx)
 
 	if !disableTCPSignalMessageCSM {
@@ -111,6 +174,27 @@ func (s *Session) SetContextValue(key interface{}, val interface{}) {
 	s.ctx.Store(&ctx)
 }
 
+// setRequestInfo stores transport of received messages to context of connection, so handlers get it by
+// net.RequestInfoFromContext. It is called when the first message was read, so the TLS handshake is done.
+func (s *Session) setRequestInfo() {
+	s.requestInfoSet = true
+	info := coapNet.RequestInfo{
+		Network:    s.netConn.LocalAddr().Network(),
+		LocalAddr:  s.netConn.LocalAddr(),
+		RemoteAddr: s.netConn.RemoteAddr(),
+	}
+	if tlsConn, ok := s.netConn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		info.Network = "tls"
+		info.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		info.NegotiatedProtocol = state.NegotiatedProtocol
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ctx := coapNet.WithRequestInfo(s.Context(), info)
+	s.ctx.Store(&ctx)
+}
+
 // Done signalizes that connection is not more processed.
 func (s *Session) Done() <-chan struct{} {
 	return s.done
@@ -167,7 +251,8 @@ func (s *Session) handleBlockwise(w *ResponseWriter, r *pool.Message) {
 		bwr := bwResponseWriter{
 			w: w,
 		}
-		s.blockWise.Handle(&bwr, r, s.blockwiseSZX, s.maxMessageSize, func(bw blockwise.ResponseWriter, br blockwise.Message) {
+		szx, maxMessageSize := s.blockwiseParams()
+		s.blockWise.Handle(&bwr, r, szx, maxMessageSize, func(bw blockwise.ResponseWriter, br blockwise.Message) {
 			h, err := s.tokenHandlerContainer.Pop(r.Token())
 			w := bw.(*bwResponseWriter).w
 			r := br.(*pool.Message)
@@ -193,18 +278,21 @@ func (s *Session) handleSignals(r *pool.Message, cc *ClientConn) bool {
 		if s.disablePeerTCPSignalMessageCSMs {
 			return true
 		}
-		if size, err := r.GetOptionUint32(coapTCP.MaxMessageSize); err == nil {
-			atomic.StoreUint32(&s.peerMaxMessageSize, size)
-		}
-		if r.HasOption(coapTCP.BlockWiseTransfer) {
-			atomic.StoreUint32(&s.peerBlockWiseTranferEnabled, 1)
+		if err := s.handleCSM(r); err != nil {
+			s.errors(fmt.Errorf("cannot handle CSM from %v: %w", s.connection.RemoteAddr(), err))
 		}
 		return true
 	case codes.Ping:
 		if r.HasOption(coapTCP.Custody) {
 			//TODO
 		}
-		s.sendPong(r.Token())
+		s.processControl(func() {
+			defer pool.ReleaseMessage(r)
+			err := s.sendPong(r.Token())
+			if err != nil {
+				s.errors(fmt.Errorf("cannot send pong to %v: %w", s.connection.RemoteAddr(), err))
+			}
+		})
 		return true
 	case codes.Release:
 		if r.HasOption(coapTCP.AlternativeAddress) {
@@ -219,13 +307,24 @@ func (s *Session) handleSignals(r *pool.Message, cc *ClientConn) bool {
 	case codes.Pong:
 		h, err := s.tokenHandlerContainer.Pop(r.Token())
 		if err == nil {
-			s.processReq(r, cc, h)
+			s.processControl(func() {
+				s.processReq(r, cc, h)
+			})
 		}
 		return true
 	}
 	return false
 }
 
+// processControl processes signal message by the control lane, so the pong isn't written by the go routine
+// which reads the connection. When the control lane is disabled or full, f is called directly.
+func (s *Session) processControl(f func()) {
+	if s.controlLane.push(s.Done(), f) {
+		return
+	}
+	f()
+}
+
 type bwResponseWriter struct {
 	w *ResponseWriter
 }
@@ -252,15 +351,23 @@ func (s *Session) TokenHandler() *HandlerContainer {
 }
 
 func (s *Session) processReq(req *pool.Message, cc *ClientConn, handler func(w *ResponseWriter, r *pool.Message)) {
-	origResp := pool.AcquireMessage(s.Context())
+	origResp := s.messagePool.AcquireMessage(s.Context())
 	origResp.SetToken(req.Token())
 	w := NewResponseWriter(origResp, cc, req.Options())
+	obs, isObserve := observeRequest(req)
 	handler(w, req)
+	if isObserve {
+		s.traceObservation(s.observers.update(obs, w.response), w.response)
+	}
 	defer pool.ReleaseMessage(w.response)
 	if !req.IsHijacked() {
 		pool.ReleaseMessage(req)
 	}
 	if w.response.IsModified() {
+		if w.noResponseValue != nil && noresponse.IsSuppressed(w.response.Code(), *w.noResponseValue) {
+			// the client isn't interested in the response (RFC 7967)
+			return
+		}
 		err := s.WriteMessage(w.response)
 		if err != nil {
 			s.Close()
@@ -269,85 +376,215 @@ func (s *Session) processReq(req *pool.Message, cc *ClientConn, handler func(w *
 	}
 }
 
-func (s *Session) processBuffer(buffer *bytes.Buffer, cc *ClientConn) error {
-	for buffer.Len() > 0 {
-		var hdr coapTCP.MessageHeader
-		err := hdr.Unmarshal(buffer.Bytes())
-		if err == message.ErrShortRead {
-			return nil
-		}
-		if s.maxMessageSize >= 0 && hdr.TotalLen > s.maxMessageSize {
-			return fmt.Errorf("max message size(%v) was exceeded %v", s.maxMessageSize, hdr.TotalLen)
-		}
-		if buffer.Len() < hdr.TotalLen {
-			return nil
-		}
-		req := pool.AcquireMessage(s.Context())
-		readed, err := req.Unmarshal(buffer.Bytes()[:hdr.TotalLen])
-		if err != nil {
+// frame returns length of the message at the start of data, it rejects the message exceeding max message size.
+func (s *Session) frame(data []byte) (int, error) {
+	var hdr coapTCP.MessageHeader
+	err := hdr.Unmarshal(data)
+	if err == message.ErrShortRead {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if s.maxMessageSize >= 0 && hdr.TotalLen > s.maxMessageSize {
+		return 0, fmt.Errorf("max message size(%v) was exceeded %v", s.maxMessageSize, hdr.TotalLen)
+	}
+	return hdr.TotalLen, nil
+}
+
+func (s *Session) processMessage(data []byte, cc *ClientConn) error {
+	req := s.messagePool.AcquireMessage(s.Context())
+	_, err := req.UnmarshalWithLimits(data, s.parserLimits)
+	if err != nil {
+		var limitErr *message.ParserLimitError
+		if errors.As(err, &limitErr) {
+			// the message is framed, so the connection continues
+			s.rejectOverLimit(req, limitErr)
 			pool.ReleaseMessage(req)
-			return fmt.Errorf("cannot unmarshal with header: %w", err)
-		}
-		if readed == buffer.Len() {
-			// buffer is empty so reset it
-			buffer.Reset()
-		} else {
-			// rewind to next message
-			trimmed := 0
-			for trimmed != readed {
-				b := make([]byte, 4096)
-				max := 4096
-				if readed-trimmed < max {
-					max = readed - trimmed
-				}
-				v, _ := buffer.Read(b[:max])
-				trimmed += v
-			}
+			s.errors(fmt.Errorf("%v: %w", s.connection.RemoteAddr(), err))
+			return nil
 		}
-		req.SetSequence(s.Sequence())
-		s.inactivityMonitor.Notify()
-		if s.handleSignals(req, cc) {
-			continue
+		pool.ReleaseMessage(req)
+		return fmt.Errorf("cannot unmarshal with header: %w", err)
+	}
+	req.SetSequence(s.Sequence())
+	s.trace(trace.MessageReceived, req)
+	s.inactivityMonitor.Notify()
+	if err := s.checkSignaling(req); err != nil {
+		pool.ReleaseMessage(req)
+		return err
+	}
+	if s.handleSignals(req, cc) {
+		return nil
+	}
+	if !s.unprotect(req) {
+		pool.ReleaseMessage(req)
+		return nil
+	}
+	counted := s.handlers.acquire()
+	err = s.goPool(func() {
+		if counted {
+			defer s.handlers.release()
 		}
-		s.goPool(func() {
-			s.processReq(req, cc, s.Handle)
-		})
+		s.processReq(req, cc, s.Handle)
+	})
+	if err != nil && counted {
+		s.handlers.release()
 	}
 	return nil
 }
 
 func (s *Session) WriteMessage(req *pool.Message) error {
+	err := s.protect(req)
+	if err != nil {
+		return err
+	}
+	return s.writeMessage(req)
+}
+
+// writeMessage writes message to the connection as it is.
+func (s *Session) writeMessage(req *pool.Message) error {
+	if err := req.Context().Err(); err != nil {
+		// the stale message is dropped
+		return err
+	}
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if req.IsBodyStream() {
+		return s.writeMessageStream(req)
+	}
 	data, err := req.Marshal()
 	if err != nil {
 		return fmt.Errorf("cannot marshal: %w", err)
 	}
-	err = s.connection.WriteWithContext(req.Context(), data)
+	if err = s.checkPeerMaxMessageSize(int64(len(data))); err != nil {
+		return err
+	}
+	err = s.write(req.Context(), data)
 	if err != nil {
 		return fmt.Errorf("cannot write to connection: %w", err)
 	}
+	s.trace(trace.MessageSent, req)
 	return err
 }
 
+// write writes data to the connection within the write timeout. The connection is closed when the timeout
+// expires, the peer cannot find start of the next message after a partial write.
+func (s *Session) write(ctx context.Context, data []byte) error {
+	err := coapNet.WriteWithTimeout(ctx, s.writeTimeout, func(ctx context.Context) error {
+		return s.connection.WriteMessage(ctx, data)
+	})
+	var timeoutErr *coapNet.TimeoutError
+	if errors.As(err, &timeoutErr) {
+		s.Close()
+	}
+	return err
+}
+
+// writeMessageStream writes the header of the message and then its body chunk by chunk, so the body set
+// by SetBodyStream isn't kept in memory.
+func (s *Session) writeMessageStream(req *pool.Message) error {
+	data, err := req.MarshalHeader()
+	if err != nil {
+		return fmt.Errorf("cannot marshal: %w", err)
+	}
+	size, err := req.BodySize()
+	if err != nil {
+		return fmt.Errorf("cannot get body size: %w", err)
+	}
+	if err = s.checkPeerMaxMessageSize(int64(len(data)) + size); err != nil {
+		return err
+	}
+	err = s.write(req.Context(), data)
+	if err != nil {
+		return fmt.Errorf("cannot write to connection: %w", err)
+	}
+	_, err = req.Body().Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("cannot seek body: %w", err)
+	}
+	chunk := make([]byte, streamChunkSize)
+	for size > 0 {
+		if size < int64(len(chunk)) {
+			chunk = chunk[:size]
+		}
+		n, err := io.ReadFull(req.Body(), chunk)
+		if err == nil {
+			err = s.write(req.Context(), chunk[:n])
+		}
+		if err != nil {
+			// the peer cannot find start of the next message in the stream
+			s.Close()
+			return fmt.Errorf("cannot write body to connection: %w", err)
+		}
+		size -= int64(n)
+	}
+	s.trace(trace.MessageSent, req)
+	return nil
+}
+
 func (s *Session) sendCSM() error {
 	token, err := message.GetToken()
 	if err != nil {
 		return fmt.Errorf("cannot get token: %w", err)
 	}
-	req := pool.AcquireMessage(s.Context())
+	req := s.messagePool.AcquireMessage(s.Context())
 	defer pool.ReleaseMessage(req)
 	req.SetCode(codes.CSM)
 	req.SetToken(token)
+	if s.maxMessageSize > 0 {
+		req.SetOptionUint32(coapTCP.MaxMessageSize, uint32(s.maxMessageSize))
+	}
+	if s.bert && s.blockWise != nil {
+		// BERT is negotiated by Max-Message-Size and Block-Wise-Transfer of both peers.
+		req.SetOptionBytes(coapTCP.BlockWiseTransfer, nil)
+	}
+	for _, o := range s.csmOptions {
+		req.AddOptionBytes(o.ID, o.Value)
+	}
 	return s.WriteMessage(req)
 }
 
+// rejectOverLimit answers the request which exceeds the parser limits by 4.13 (Request Entity Too Large),
+// with Size1 of the maximal payload when the payload is too large. Other messages are dropped.
+func (s *Session) rejectOverLimit(req *pool.Message, limitErr *message.ParserLimitError) {
+	if !codes.IsRequest(req.Code()) {
+		return
+	}
+	resp := s.messagePool.AcquireMessage(s.Context())
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.RequestEntityTooLarge)
+	resp.SetToken(req.Token())
+	if limitErr.Limit == message.LimitPayload {
+		resp.SetOptionUint32(message.Size1, uint32(limitErr.Max))
+	}
+	if err := s.WriteMessage(resp); err != nil {
+		s.errors(fmt.Errorf("%v: cannot reject request: %w", s.connection.RemoteAddr(), err))
+	}
+}
+
 func (s *Session) sendPong(token message.Token) error {
-	req := pool.AcquireMessage(s.Context())
+	req := s.messagePool.AcquireMessage(s.Context())
 	defer pool.ReleaseMessage(req)
 	req.SetCode(codes.Pong)
 	req.SetToken(token)
 	return s.WriteMessage(req)
 }
 
+// drain waits until responses of requests in progress are written, at most for the drain timeout.
+func (s *Session) drain() {
+	if s.drainTimeout <= 0 {
+		return
+	}
+	t := time.NewTimer(s.drainTimeout)
+	defer t.Stop()
+	select {
+	case <-s.handlers.drain():
+	case <-t.C:
+	case <-s.Context().Done():
+	}
+}
+
 // Run reads and process requests from a connection, until the connection is not closed.
 func (s *Session) Run(cc *ClientConn) (err error) {
 	defer func() {
@@ -363,19 +600,37 @@ func (s *Session) Run(cc *ClientConn) (err error) {
 	if s.errSendCSM != nil {
 		return s.errSendCSM
 	}
-	buffer := bytes.NewBuffer(make([]byte, 0, 1024))
-	readBuf := make([]byte, 1024)
+	stopWatchCSM := s.watchCSM()
+	defer stopWatchCSM()
+	size := s.maxMessageSize
+	if size < 0 {
+		// unlimited messages grow the buffer
+		size = 1024
+	}
+	readBuf := make([]byte, size)
 	for {
-		err = s.processBuffer(buffer, cc)
-		if err != nil {
-			return err
+		readLen, err := s.connection.ReadMessage(s.Context(), readBuf)
+		if errors.Is(err, io.ErrShortBuffer) && s.maxMessageSize < 0 {
+			readBuf = make([]byte, 2*len(readBuf))
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			// the peer half-closed the connection, it still reads the responses
+			s.drain()
+			return nil
 		}
-		readLen, err := s.connection.ReadWithContext(s.Context(), readBuf)
 		if err != nil {
+			if errSignaling := s.signalingErr(); errSignaling != nil {
+				return errSignaling
+			}
 			return fmt.Errorf("cannot read from connection: %w", err)
 		}
-		if readLen > 0 {
-			buffer.Write(readBuf[:readLen])
+		if !s.requestInfoSet {
+			s.setRequestInfo()
+		}
+		err = s.processMessage(readBuf[:readLen], cc)
+		if err != nil {
+			return err
 		}
 	}
 }
@@ -0,0 +1,132 @@
+package tcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// SignalingState is state of the signaling of a connection (RFC 8323 section 5).
+type SignalingState uint32
+
+const (
+	// SignalingWaitingForCSM means the peer didn't send CSM yet.
+	SignalingWaitingForCSM SignalingState = iota
+	// SignalingEstablished means the peer sent CSM, so its capabilities are known.
+	SignalingEstablished
+	// SignalingAborted means the connection was aborted by an Abort signal of either peer.
+	SignalingAborted
+)
+
+func (s SignalingState) String() string {
+	switch s {
+	case SignalingWaitingForCSM:
+		return "WaitingForCSM"
+	case SignalingEstablished:
+		return "Established"
+	case SignalingAborted:
+		return "Aborted"
+	}
+	return fmt.Sprintf("SignalingState(%d)", uint32(s))
+}
+
+var (
+	// ErrCSMExpected is returned when the first message of the peer isn't CSM in the strict signaling.
+	ErrCSMExpected = errors.New("CSM expected")
+	// ErrCSMTimeout is returned when the peer didn't send CSM in time in the strict signaling.
+	ErrCSMTimeout = errors.New("CSM wasn't received in time")
+	// ErrAborted is returned when the peer aborted the connection by Abort.
+	ErrAborted = errors.New("connection was aborted by the peer")
+)
+
+// SignalingState returns state of the signaling with the peer.
+func (cc *ClientConn) SignalingState() SignalingState {
+	return cc.Session().SignalingState()
+}
+
+func (s *Session) SignalingState() SignalingState {
+	return SignalingState(atomic.LoadUint32(&s.signalingState))
+}
+
+// checkSignaling tracks the signaling state of the peer. In the strict signaling it enforces the state machine:
+// the first message of the peer must be CSM and Abort closes the connection. It returns error which closes
+// the connection.
+func (s *Session) checkSignaling(r *pool.Message) error {
+	switch {
+	case r.Code() == codes.CSM:
+		atomic.CompareAndSwapUint32(&s.signalingState, uint32(SignalingWaitingForCSM), uint32(SignalingEstablished))
+		return nil
+	case r.Code() == codes.Abort:
+		s.setSignalingErr(fmt.Errorf("%w: %v", ErrAborted, abortDiagnostic(r)))
+		if s.strictSignaling {
+			return s.signalingErr()
+		}
+		return nil
+	case !s.strictSignaling, s.SignalingState() != SignalingWaitingForCSM:
+		return nil
+	}
+	s.abort(fmt.Errorf("%w, got %v", ErrCSMExpected, r.Code()))
+	return s.signalingErr()
+}
+
+// watchCSM aborts the connection when the peer doesn't send CSM within the CSM timeout.
+func (s *Session) watchCSM() (stop func()) {
+	if !s.strictSignaling || s.csmTimeout <= 0 {
+		return func() {}
+	}
+	t := time.AfterFunc(s.csmTimeout, func() {
+		if s.SignalingState() == SignalingWaitingForCSM {
+			s.abort(fmt.Errorf("%w: %v", ErrCSMTimeout, s.csmTimeout))
+			s.Close()
+		}
+	})
+	return func() { t.Stop() }
+}
+
+// abort sends Abort with the error as the diagnostic payload and stores the error.
+func (s *Session) abort(err error) {
+	if !s.setSignalingErr(err) {
+		return
+	}
+	req := s.messagePool.AcquireMessage(s.Context())
+	defer pool.ReleaseMessage(req)
+	req.SetCode(codes.Abort)
+	req.SetBody(bytes.NewReader([]byte(err.Error())))
+	if errW := s.WriteMessage(req); errW != nil {
+		s.errors(fmt.Errorf("cannot send abort to %v: %w", s.connection.RemoteAddr(), errW))
+	}
+}
+
+// setSignalingErr moves the signaling to the aborted state, only the first error is kept.
+func (s *Session) setSignalingErr(err error) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.errSignaling != nil {
+		return false
+	}
+	s.errSignaling = err
+	atomic.StoreUint32(&s.signalingState, uint32(SignalingAborted))
+	return true
+}
+
+func (s *Session) signalingErr() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.errSignaling
+}
+
+func abortDiagnostic(r *pool.Message) string {
+	if r.Body() == nil {
+		return ""
+	}
+	b, err := r.ReadBody()
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
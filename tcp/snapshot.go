@@ -0,0 +1,65 @@
+package tcp
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+)
+
+// TransferSnapshot describes a partial blockwise transfer of a connection.
+type TransferSnapshot struct {
+	Token     string `json:"token"`
+	Receiving bool   `json:"receiving"`
+	Size      int64  `json:"size"`
+}
+
+// ConnSnapshot is state of a connection, e.g. to attach to a bug report.
+type ConnSnapshot struct {
+	RemoteAddr string `json:"remoteAddr"`
+	// Requests is number of requests in progress.
+	Requests int `json:"requests"`
+	// Exchanges is number of exchanges waiting for a response by token.
+	Exchanges int `json:"exchanges"`
+	// Observations contains tokens of observations of the remote endpoint's resources.
+	Observations []string           `json:"observations,omitempty"`
+	Transfers    []TransferSnapshot `json:"transfers,omitempty"`
+	// PeerMaxMessageSize is Max-Message-Size of CSM of the peer, zero when the peer didn't send it.
+	PeerMaxMessageSize    uint32 `json:"peerMaxMessageSize"`
+	PeerBlockWiseTransfer bool   `json:"peerBlockWiseTransfer"`
+	// PingRTT is round-trip time of the last ping answered by the peer, which is sent by the keepalive monitor.
+	PingRTT time.Duration `json:"pingRTT,omitempty"`
+}
+
+// Snapshot returns state of the connection, e.g. for debugging.
+func (cc *ClientConn) Snapshot() ConnSnapshot {
+	s := ConnSnapshot{
+		RemoteAddr:            cc.RemoteAddr().String(),
+		Requests:              cc.inFlight.len(),
+		Exchanges:             cc.Session().TokenHandler().Len(),
+		PeerMaxMessageSize:    cc.Session().PeerMaxMessageSize(),
+		PeerBlockWiseTransfer: cc.Session().PeerBlockWiseTransferEnabled(),
+	}
+	if m, ok := cc.Session().inactivityMonitor.(interface{ RTT() time.Duration }); ok {
+		s.PingRTT = m.RTT()
+	}
+	cc.observations.Range(func(key, value interface{}) bool {
+		s.Observations = append(s.Observations, key.(string))
+		return true
+	})
+	if cc.Session().blockWise != nil {
+		for _, t := range cc.Session().blockWise.Transfers() {
+			s.Transfers = append(s.Transfers, TransferSnapshot{
+				Token:     t.Token.String(),
+				Receiving: t.Receiving,
+				Size:      t.Size,
+			})
+		}
+	}
+	return s
+}
+
+// Liveness returns liveness of the peer reported by the inactivity monitor, e.g. round-trip time of the last
+// keepalive ping.
+func (cc *ClientConn) Liveness() inactivity.Liveness {
+	return inactivity.LivenessOf(cc.Session().inactivityMonitor)
+}
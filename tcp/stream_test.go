@@ -0,0 +1,89 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConn_BodyStream(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	tests := []struct {
+		name           string
+		blockwise      bool
+		maxMessageSize int
+	}{
+		{
+			name:           "chunked",
+			maxMessageSize: 2 * 1024 * 1024,
+		},
+		{
+			name:           "bert",
+			blockwise:      true,
+			maxMessageSize: 16 * 1024,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := coapNet.NewTCPListener("tcp", "")
+			require.NoError(t, err)
+			defer l.Close()
+			var wg sync.WaitGroup
+			defer wg.Wait()
+
+			s := NewServer(WithBlockwise(tt.blockwise, blockwise.SZX1024, time.Second*5), WithBERT(), WithMaxMessageSize(tt.maxMessageSize), WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+				body, err := ioutil.ReadAll(r.Body())
+				require.NoError(t, err)
+				require.Equal(t, payload, body)
+				err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader([]byte(strconv.Itoa(len(body)))))
+				require.NoError(t, err)
+			}))
+			defer s.Stop()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Serve(l)
+				require.NoError(t, err)
+			}()
+
+			cc, err := Dial(l.Addr().String(), WithBlockwise(tt.blockwise, blockwise.SZX1024, time.Second*5), WithBERT(), WithMaxMessageSize(tt.maxMessageSize))
+			require.NoError(t, err)
+			defer func() {
+				cc.Close()
+				<-cc.Done()
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			if tt.blockwise {
+				// CSM of the server is processed asynchronously
+				require.Eventually(t, cc.Session().PeerBlockWiseTransferEnabled, time.Second, time.Millisecond*10)
+			}
+			req, err := NewPostRequest(ctx, "/a", message.AppOctets, nil)
+			require.NoError(t, err)
+			defer pool.ReleaseMessage(req)
+			req.SetContentFormat(message.AppOctets)
+			// hides Seek of bytes.Reader, so the body can be read only once
+			req.SetBodyStream(struct{ io.Reader }{bytes.NewReader(payload)}, int64(len(payload)))
+			resp, err := cc.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, codes.Changed, resp.Code())
+			body, err := ioutil.ReadAll(resp.Body())
+			require.NoError(t, err)
+			require.Equal(t, strconv.Itoa(len(payload)), string(body))
+		})
+	}
+}
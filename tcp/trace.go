@@ -0,0 +1,50 @@
+package tcp
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// TraceHandler receives events of messages sent and received by the connection.
+type TraceHandler = trace.Handler
+
+func (s *Session) trace(typ trace.EventType, m *pool.Message) {
+	s.traceElapsed(typ, m, 0)
+}
+
+func (s *Session) traceElapsed(typ trace.EventType, m *pool.Message, elapsed time.Duration) {
+	if s.traceHandler == nil {
+		return
+	}
+	trace.Emit(s.traceHandler, trace.Event{
+		Type:       typ,
+		Message:    m.Message,
+		MessageID:  -1,
+		RemoteAddr: s.connection.RemoteAddr(),
+		Elapsed:    elapsed,
+	})
+}
+
+// traceObservation traces the change of observations of the peer returned by observers.update.
+func (s *Session) traceObservation(change int, resp *pool.Message) {
+	switch change {
+	case 1:
+		s.trace(trace.ObservationRegistered, resp)
+	case -1:
+		s.trace(trace.ObservationDeregistered, resp)
+	}
+}
+
+// traceSession traces SessionStarted of the new connection and SessionClosed when it is closed.
+func (s *Session) traceSession() {
+	if s.traceHandler == nil {
+		return
+	}
+	raddr := s.connection.RemoteAddr()
+	trace.EmitSession(s.traceHandler, trace.SessionStarted, raddr)
+	s.AddOnClose(func() {
+		trace.EmitSession(s.traceHandler, trace.SessionClosed, raddr)
+	})
+}
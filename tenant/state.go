@@ -0,0 +1,167 @@
+package tenant
+
+import (
+	"context"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+)
+
+type observerKey struct {
+	// conn is mux.Client.ClientConn of the observer
+	conn  interface{}
+	token string
+}
+
+// state holds limits and counters of a tenant.
+type state struct {
+	m                 sync.Mutex
+	tenant            Tenant
+	quota             *blockwise.Quota
+	inflight          int
+	observers         map[observerKey]struct{}
+	conns             map[interface{}]struct{}
+	requests          uint64
+	rejected          uint64
+	rejectedObservers uint64
+}
+
+func newQuota(limits Limits) *blockwise.Quota {
+	if limits.MaxReceiveBytes <= 0 && limits.MaxSendBytes <= 0 {
+		return nil
+	}
+	return blockwise.NewQuota(limits.MaxReceiveBytes, limits.MaxSendBytes)
+}
+
+func newState(t Tenant) *state {
+	return &state{
+		tenant:    t,
+		quota:     newQuota(t.Limits),
+		observers: make(map[observerKey]struct{}),
+		conns:     make(map[interface{}]struct{}),
+	}
+}
+
+func (s *state) setTenant(t Tenant) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.tenant.Limits.MaxReceiveBytes != t.Limits.MaxReceiveBytes || s.tenant.Limits.MaxSendBytes != t.Limits.MaxSendBytes {
+		// transfers in progress are counted by the previous quota
+		s.quota = newQuota(t.Limits)
+	}
+	s.tenant = t
+}
+
+func (s *state) getQuota() *blockwise.Quota {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.quota
+}
+
+func (s *state) stats() Stats {
+	s.m.Lock()
+	st := Stats{
+		Requests:          s.requests,
+		Rejected:          s.rejected,
+		Observers:         len(s.observers),
+		RejectedObservers: s.rejectedObservers,
+	}
+	quota := s.quota
+	s.m.Unlock()
+	if quota != nil {
+		st.ReceivingBytes, st.SendingBytes = quota.Used()
+	}
+	return st
+}
+
+// acquire reserves a slot for the request.
+func (s *state) acquire() (Tenant, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.requests++
+	if s.tenant.Limits.MaxConcurrentRequests > 0 && s.inflight >= s.tenant.Limits.MaxConcurrentRequests {
+		s.rejected++
+		return Tenant{}, false
+	}
+	s.inflight++
+	return s.tenant, true
+}
+
+func (s *state) release() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.inflight--
+}
+
+// register counts the observation, it returns false when MaxObservers is reached.
+func (s *state) register(cc mux.Client, token message.Token) bool {
+	key := observerKey{conn: cc.ClientConn(), token: token.String()}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, ok := s.observers[key]; ok {
+		return true
+	}
+	if s.tenant.Limits.MaxObservers > 0 && len(s.observers) >= s.tenant.Limits.MaxObservers {
+		s.rejectedObservers++
+		return false
+	}
+	s.observers[key] = struct{}{}
+	if _, ok := s.conns[key.conn]; !ok {
+		// release observations of the closed connection
+		go func() {
+			<-cc.Done()
+			s.removeConn(key.conn)
+		}()
+	}
+	s.conns[key.conn] = struct{}{}
+	return true
+}
+
+func (s *state) deregister(cc mux.Client, token message.Token) {
+	key := observerKey{conn: cc.ClientConn(), token: token.String()}
+	s.m.Lock()
+	defer s.m.Unlock()
+	delete(s.observers, key)
+}
+
+func (s *state) removeConn(conn interface{}) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for key := range s.observers {
+		if key.conn == conn {
+			delete(s.observers, key)
+		}
+	}
+	delete(s.conns, conn)
+}
+
+// serveCOAP serves the request within limits of the tenant. An observation is counted from the registration
+// until the peer deregisters it or the connection is closed.
+func (s *state) serveCOAP(w mux.ResponseWriter, r *mux.Message) {
+	t, ok := s.acquire()
+	if !ok {
+		w.SetResponse(codes.ServiceUnavailable, message.TextPlain, nil)
+		return
+	}
+	defer s.release()
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r.Context = context.WithValue(ctx, tenantKey{}, t)
+	if obs, err := r.Options.Observe(); err == nil && r.Code == codes.GET {
+		switch obs {
+		case 0:
+			if !s.register(w.Client(), r.Token) {
+				// serve the request without registration
+				r.Options = r.Options.Remove(message.Observe)
+			}
+		case 1:
+			s.deregister(w.Client(), r.Token)
+		}
+	}
+	t.Handler.ServeCOAP(w, r)
+}
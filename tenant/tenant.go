@@ -0,0 +1,214 @@
+// Package tenant serves multiple tenants on one listener. Each tenant has own handler tree, metrics labels and
+// limits of observations, concurrent requests and block-wise transfers shared by all its peers, so a noisy tenant
+// cannot exhaust resources of another one.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+)
+
+// ResolveFunc returns name of the tenant of the request.
+type ResolveFunc = func(ctx context.Context, options message.Options) (string, bool)
+
+type identityKey struct{}
+
+type tenantKey struct{}
+
+// ContextSetter is implemented by client connections, e.g. *client.ClientConn of udp/dtls.
+type ContextSetter interface {
+	SetContextValue(key interface{}, val interface{})
+}
+
+// SetIdentity sets security identity of the peer to the context of the connection, e.g. the PSK identity
+// or the subject of the client certificate in OnNewClientConn.
+func SetIdentity(cc ContextSetter, identity string) {
+	cc.SetContextValue(identityKey{}, identity)
+}
+
+// Identity returns security identity of the peer set by SetIdentity.
+func Identity(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok && identity != ""
+}
+
+// ByIdentity resolves the tenant by the security identity of the peer.
+func ByIdentity(ctx context.Context, _ message.Options) (string, bool) {
+	return Identity(ctx)
+}
+
+// ByURIHost resolves the tenant by Uri-Host of the request, it is case insensitive.
+func ByURIHost(_ context.Context, options message.Options) (string, bool) {
+	uriHost, err := options.GetString(message.URIHost)
+	if err != nil || uriHost == "" {
+		return "", false
+	}
+	return strings.ToLower(uriHost), true
+}
+
+// Limits bounds resources held by all peers of a tenant. Zero value of a field means no limit.
+type Limits struct {
+	// MaxObservers caps registered observations. Over the cap the request is served without registration
+	// (RFC 7641 section 4.1).
+	MaxObservers int
+	// MaxConcurrentRequests caps requests processed concurrently. Over the cap the request is rejected
+	// by 5.03 (Service Unavailable).
+	MaxConcurrentRequests int
+	// MaxReceiveBytes caps total size of partially received block-wise bodies.
+	MaxReceiveBytes int64
+	// MaxSendBytes caps total size of block-wise bodies cached for delivery.
+	MaxSendBytes int64
+}
+
+// Tenant is configuration of a tenant.
+type Tenant struct {
+	// Name identifies the tenant, it is matched with the value returned by ResolveFunc.
+	Name string
+	// Handler serves requests of the tenant, e.g. a mux.Router.
+	Handler mux.Handler
+	// Limits bounds resources of the tenant.
+	Limits Limits
+	// Labels are metrics labels of the tenant, handlers get them by FromContext.
+	Labels map[string]string
+}
+
+// Stats are counters of a tenant.
+type Stats struct {
+	// Requests is number of served requests.
+	Requests uint64
+	// Rejected is number of requests rejected by MaxConcurrentRequests.
+	Rejected uint64
+	// Observers is number of registered observations.
+	Observers int
+	// RejectedObservers is number of registrations refused by MaxObservers.
+	RejectedObservers uint64
+	// ReceivingBytes is size of partially received block-wise bodies.
+	ReceivingBytes int64
+	// SendingBytes is size of block-wise bodies cached for delivery.
+	SendingBytes int64
+}
+
+// FromContext returns the tenant of the request served by Router.
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(Tenant)
+	return t, ok
+}
+
+// Router is a mux.Handler which dispatches requests to handlers of tenants and enforces limits of them.
+// Router is also safe for concurrent access from multiple goroutines.
+type Router struct {
+	resolvers      []ResolveFunc
+	m              sync.RWMutex
+	tenants        map[string]*state
+	defaultHandler mux.Handler
+}
+
+// NewRouter creates router which resolves the tenant of a request by resolvers in the given order.
+// By default the tenant is resolved by ByIdentity and then by ByURIHost.
+func NewRouter(resolvers ...ResolveFunc) *Router {
+	if len(resolvers) == 0 {
+		resolvers = []ResolveFunc{ByIdentity, ByURIHost}
+	}
+	return &Router{
+		resolvers: resolvers,
+		tenants:   make(map[string]*state),
+		defaultHandler: mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			w.SetResponse(codes.NotFound, message.TextPlain, nil)
+		}),
+	}
+}
+
+// Handle adds or replaces the tenant. Registered observations of the replaced tenant are kept.
+func (r *Router) Handle(t Tenant) error {
+	if t.Name == "" {
+		return errors.New("empty tenant name")
+	}
+	if t.Handler == nil {
+		return errors.New("nil handler")
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if s, ok := r.tenants[t.Name]; ok {
+		s.setTenant(t)
+		return nil
+	}
+	r.tenants[t.Name] = newState(t)
+	return nil
+}
+
+// HandleRemove removes the tenant.
+func (r *Router) HandleRemove(name string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.tenants[name]; ok {
+		delete(r.tenants, name)
+		return nil
+	}
+	return errors.New("tenant is not registered in")
+}
+
+// DefaultHandle sets handler for requests without a registered tenant.
+func (r *Router) DefaultHandle(handler mux.Handler) {
+	r.m.Lock()
+	r.defaultHandler = handler
+	r.m.Unlock()
+}
+
+// Stats returns counters of the tenant.
+func (r *Router) Stats(name string) (Stats, bool) {
+	s, ok := r.tenant(name)
+	if !ok {
+		return Stats{}, false
+	}
+	return s.stats(), true
+}
+
+func (r *Router) tenant(name string) (*state, bool) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	s, ok := r.tenants[name]
+	return s, ok
+}
+
+func (r *Router) resolve(ctx context.Context, options message.Options) (*state, bool) {
+	for _, resolve := range r.resolvers {
+		name, ok := resolve(ctx, options)
+		if !ok {
+			continue
+		}
+		return r.tenant(name)
+	}
+	return nil, false
+}
+
+// Quota returns block-wise quota of the tenant of the request. Set it to the server by
+// WithBlockwiseOptions(blockwise.WithQuota(router.Quota)).
+func (r *Router) Quota(req blockwise.Message) *blockwise.Quota {
+	s, ok := r.resolve(req.Context(), req.Options())
+	if !ok {
+		return nil
+	}
+	return s.getQuota()
+}
+
+// ServeCOAP dispatches the request to the handler of its tenant.
+func (r *Router) ServeCOAP(w mux.ResponseWriter, req *mux.Message) {
+	s, ok := r.resolve(req.Context, req.Options)
+	if !ok {
+		r.m.RLock()
+		h := r.defaultHandler
+		r.m.RUnlock()
+		if h != nil {
+			h.ServeCOAP(w, req)
+		}
+		return
+	}
+	s.serveCOAP(w, req)
+}
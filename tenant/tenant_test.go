@@ -0,0 +1,161 @@
+package tenant_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+type client struct {
+	mux.Client
+	done chan struct{}
+}
+
+func (c *client) ClientConn() interface{} {
+	return c
+}
+
+func (c *client) Done() <-chan struct{} {
+	return c.done
+}
+
+type responseWriter struct {
+	code codes.Code
+	cc   *client
+}
+
+func (w *responseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	return nil
+}
+
+func (w *responseWriter) Client() mux.Client {
+	return w.cc
+}
+
+func TestRouter(t *testing.T) {
+	var m sync.Mutex
+	observed := make(map[string]bool)
+	handler := mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		ten, ok := tenant.FromContext(r.Context)
+		require.True(t, ok)
+		_, err := r.Options.Observe()
+		m.Lock()
+		observed[ten.Labels["tenant"]] = err == nil
+		m.Unlock()
+		w.SetResponse(codes.Content, message.TextPlain, nil)
+	})
+	r := tenant.NewRouter()
+	require.NoError(t, r.Handle(tenant.Tenant{Name: "a.example", Handler: handler, Labels: map[string]string{"tenant": "a"}, Limits: tenant.Limits{MaxObservers: 1}}))
+	require.NoError(t, r.Handle(tenant.Tenant{Name: "device-b", Handler: handler, Labels: map[string]string{"tenant": "b"}}))
+	require.Error(t, r.Handle(tenant.Tenant{Name: "", Handler: handler}))
+	require.Error(t, r.Handle(tenant.Tenant{Name: "c"}))
+
+	cc := &client{done: make(chan struct{})}
+	serve := func(ctx context.Context, token string, opts ...message.Option) codes.Code {
+		w := &responseWriter{cc: cc}
+		r.ServeCOAP(w, &mux.Message{Message: &message.Message{Context: ctx, Code: codes.GET, Token: message.Token(token), Options: opts}})
+		return w.code
+	}
+	host := message.Option{ID: message.URIHost, Value: []byte("A.example")}
+	observe := message.Option{ID: message.Observe, Value: []byte{}}
+	deregister := message.Option{ID: message.Observe, Value: []byte{1}}
+
+	require.Equal(t, codes.Content, serve(context.Background(), "1", host, observe))
+	require.True(t, observed["a"])
+	// the quota of observers of tenant a is exhausted
+	require.Equal(t, codes.Content, serve(context.Background(), "2", host, observe))
+	require.False(t, observed["a"])
+
+	// tenant b resolved by security identity is not affected
+	identity := &identityClient{ctx: context.Background()}
+	tenant.SetIdentity(identity, "device-b")
+	require.Equal(t, codes.Content, serve(identity.ctx, "1", host, observe))
+	require.True(t, observed["b"])
+	require.Equal(t, codes.Content, serve(identity.ctx, "2", observe))
+	require.True(t, observed["b"])
+
+	stats, ok := r.Stats("a.example")
+	require.True(t, ok)
+	require.Equal(t, tenant.Stats{Requests: 2, Observers: 1, RejectedObservers: 1}, stats)
+	stats, ok = r.Stats("device-b")
+	require.True(t, ok)
+	require.Equal(t, 2, stats.Observers)
+
+	// deregistration releases the quota
+	require.Equal(t, codes.Content, serve(context.Background(), "1", host, deregister))
+	require.Equal(t, codes.Content, serve(context.Background(), "2", host, observe))
+	require.True(t, observed["a"])
+
+	// closed connection releases the quota
+	close(cc.done)
+	require.Eventually(t, func() bool {
+		stats, _ := r.Stats("device-b")
+		return stats.Observers == 0
+	}, time.Second, time.Millisecond*10)
+
+	require.Equal(t, codes.NotFound, serve(context.Background(), "3"))
+	require.NoError(t, r.HandleRemove("a.example"))
+	require.Error(t, r.HandleRemove("a.example"))
+	require.Equal(t, codes.NotFound, serve(context.Background(), "3", host))
+	r.DefaultHandle(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		w.SetResponse(codes.Valid, message.TextPlain, nil)
+	}))
+	require.Equal(t, codes.Valid, serve(context.Background(), "3", host))
+}
+
+type identityClient struct {
+	ctx context.Context
+}
+
+func (c *identityClient) SetContextValue(key interface{}, val interface{}) {
+	c.ctx = context.WithValue(c.ctx, key, val)
+}
+
+func TestRouter_MaxConcurrentRequests(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{})
+	r := tenant.NewRouter(tenant.ByURIHost)
+	require.NoError(t, r.Handle(tenant.Tenant{
+		Name: "a.example",
+		Handler: mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			close(started)
+			<-block
+			w.SetResponse(codes.Content, message.TextPlain, nil)
+		}),
+		Limits: tenant.Limits{MaxConcurrentRequests: 1},
+	}))
+	require.NoError(t, r.Handle(tenant.Tenant{
+		Name: "b.example",
+		Handler: mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			w.SetResponse(codes.Content, message.TextPlain, nil)
+		}),
+	}))
+	serve := func(host string) codes.Code {
+		w := &responseWriter{cc: &client{done: make(chan struct{})}}
+		r.ServeCOAP(w, &mux.Message{Message: &message.Message{Context: context.Background(), Code: codes.GET, Options: message.Options{{ID: message.URIHost, Value: []byte(host)}}}})
+		return w.code
+	}
+	done := make(chan codes.Code)
+	go func() {
+		done <- serve("a.example")
+	}()
+	<-started
+	require.Equal(t, codes.ServiceUnavailable, serve("a.example"))
+	require.Equal(t, codes.Content, serve("b.example"))
+	close(block)
+	require.Equal(t, codes.Content, <-done)
+
+	stats, ok := r.Stats("a.example")
+	require.True(t, ok)
+	require.Equal(t, uint64(2), stats.Requests)
+	require.Equal(t, uint64(1), stats.Rejected)
+}
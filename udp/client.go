@@ -7,9 +7,13 @@ import (
 	"net"
 	"time"
 
+	"github.com/plgd-dev/go-coap/v2/cache"
 	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/metrics"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	kitSync "github.com/plgd-dev/kit/sync"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -21,7 +25,7 @@ import (
 
 var defaultDialOptions = dialOptions{
 	ctx:            context.Background(),
-	maxMessageSize: 64 * 1024,
+	maxMessageSize: defaultMaxMessageSize,
 	heartBeat:      time.Millisecond * 100,
 	handler: func(w *client.ResponseWriter, r *pool.Message) {
 		switch r.Code() {
@@ -40,13 +44,15 @@ var defaultDialOptions = dialOptions{
 	},
 	dialer:                         &net.Dialer{Timeout: time.Second * 3},
 	net:                            "udp",
-	blockwiseSZX:                   blockwise.SZX1024,
+	blockwiseSZX:                   defaultBlockwiseSZX,
 	blockwiseEnable:                true,
 	blockwiseTransferTimeout:       time.Second * 3,
 	transmissionNStart:             time.Second,
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	newMIDGenerator:                client.NewSequentialMIDGenerator,
+	controlLaneSize:                client.DefaultControlLaneSize,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
 	},
@@ -58,18 +64,56 @@ type dialOptions struct {
 	heartBeat                      time.Duration
 	handler                        HandlerFunc
 	errors                         ErrorFunc
+	logger                         coapNet.Logger
 	goPool                         GoPoolFunc
 	dialer                         *net.Dialer
 	net                            string
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseLimits                blockwise.Limits
+	blockwiseProgress              blockwise.ProgressFunc
+	blockwiseOptions               []blockwise.Option
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
 	getMID                         GetMIDFunc
+	newMIDGenerator                client.NewMIDGeneratorFunc
 	closeSocket                    bool
 	createInactivityMonitor        func() inactivity.Monitor
+	rawHandler                     RawHandlerFunc
+	reliableTransport              bool
+	observationStore               observation.Store
+	onExchange                     ExchangeFunc
+	onDuplicate                    DuplicateFunc
+	backpressure                   Backpressure
+	nStart                         int
+	parserLimits                   message.ParserLimits
+	nonConfirmableRetry            client.NonConfirmableRetry
+	retryAfter                     client.RetryAfterPolicy
+	writeTimeout                   time.Duration
+	exchangeTimeout                time.Duration
+	messagePool                    *pool.Pool
+	nonResponsePolicy              NonResponsePolicy
+	pacing                         Pacing
+	oscoreContext                  *oscore.Context
+	newTransmissionParams          client.NewTransmissionParamsFunc
+	observeRecovery                client.ObserveRecovery
+	controlLaneSize                int
+	onRetransmit                   client.RetransmitFunc
+	traceHandler                   client.TraceHandler
+	stats                          metrics.Stats
+	newDedup                       client.NewDedupFunc
+	pooledResponses                bool
+	responseCache                  cache.Store
+	uriAuthority                   *client.Authority
+	stampURIAuthority              bool
+	proxyAddr                      string
+	proxyScheme                    string
+	tokenManager                   message.TokenManager
+	demux                          DemuxFunc
+	flowLabel                      coapNet.FlowLabelFunc
+	rebindPolicy                   *RebindPolicy
 }
 
 // A DialOption sets options such as credentials, keepalive parameters, etc.
@@ -84,7 +128,11 @@ func Dial(target string, opts ...DialOption) (*client.ClientConn, error) {
 		o.applyDial(&cfg)
 	}
 
-	c, err := cfg.dialer.DialContext(cfg.ctx, cfg.net, target)
+	addr := target
+	if cfg.proxyAddr != "" {
+		addr = cfg.proxyAddr
+	}
+	c, err := cfg.dialer.DialContext(cfg.ctx, cfg.net, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -93,22 +141,31 @@ func Dial(target string, opts ...DialOption) (*client.ClientConn, error) {
 		return nil, fmt.Errorf("unsupported connection type: %T", c)
 	}
 	opts = append(opts, WithCloseSocket())
+	switch {
+	case cfg.proxyAddr != "":
+		// the peer is the proxy, the target is the origin server
+		opts = append(opts, URIAuthorityOpt{authority: target, proxyScheme: cfg.proxyScheme})
+	case cfg.stampURIAuthority && cfg.uriAuthority == nil:
+		opts = append(opts, WithURIAuthority(target))
+	}
 	return Client(conn, opts...), nil
 }
 
-func bwAcquireMessage(ctx context.Context) blockwise.Message {
-	return pool.AcquireMessage(ctx)
+func bwAcquireMessage(messagePool *pool.Pool) func(ctx context.Context) blockwise.Message {
+	return func(ctx context.Context) blockwise.Message {
+		return messagePool.AcquireMessage(ctx)
+	}
 }
 
 func bwReleaseMessage(m blockwise.Message) {
 	pool.ReleaseMessage(m.(*pool.Message))
 }
 
-func bwCreateHandlerFunc(observatioRequests *kitSync.Map) func(token message.Token) (blockwise.Message, bool) {
+func bwCreateHandlerFunc(messagePool *pool.Pool, observatioRequests *kitSync.Map) func(token message.Token) (blockwise.Message, bool) {
 	return func(token message.Token) (blockwise.Message, bool) {
 		msg, ok := observatioRequests.LoadWithFunc(token.String(), func(v interface{}) interface{} {
 			r := v.(*pool.Message)
-			d := pool.AcquireMessage(r.Context())
+			d := messagePool.AcquireMessage(r.Context())
 			d.ResetOptionsTo(r.Options())
 			d.SetCode(r.Code())
 			d.SetToken(r.Token())
@@ -129,6 +186,12 @@ func Client(conn *net.UDPConn, opts ...DialOption) *client.ClientConn {
 	for _, o := range opts {
 		o.applyDial(&cfg)
 	}
+	if cfg.logger != nil {
+		cfg.traceHandler = coapNet.LogTraceHandler(cfg.logger, cfg.traceHandler)
+	}
+	if cfg.stats != nil {
+		cfg.traceHandler = metrics.TraceHandler(cfg.stats, cfg.traceHandler)
+	}
 	if cfg.errors == nil {
 		cfg.errors = func(error) {}
 	}
@@ -152,22 +215,26 @@ func Client(conn *net.UDPConn, opts ...DialOption) *client.ClientConn {
 	var blockWise *blockwise.BlockWise
 	if cfg.blockwiseEnable {
 		blockWise = blockwise.NewBlockWise(
-			bwAcquireMessage,
+			bwAcquireMessage(cfg.messagePool),
 			bwReleaseMessage,
 			cfg.blockwiseTransferTimeout,
 			cfg.errors,
 			false,
-			bwCreateHandlerFunc(observatioRequests),
+			bwCreateHandlerFunc(cfg.messagePool, observatioRequests),
+			append([]blockwise.Option{blockwise.WithLimits(cfg.blockwiseLimits), blockwise.WithProgress(cfg.blockwiseProgress)}, cfg.blockwiseOptions...)...,
 		)
 	}
 
 	observationTokenHandler := client.NewHandlerContainer()
 	monitor := cfg.createInactivityMonitor()
 	var cc *client.ClientConn
-	l := coapNet.NewUDPConn(cfg.net, conn, coapNet.WithHeartBeat(cfg.heartBeat), coapNet.WithErrors(cfg.errors), coapNet.WithOnReadTimeout(func() error {
-		monitor.CheckInactivity(cc)
-		return nil
-	}))
+	newUDPConn := func(conn *net.UDPConn) *coapNet.UDPConn {
+		return coapNet.NewUDPConn(cfg.net, conn, coapNet.WithHeartBeat(cfg.heartBeat), coapNet.WithErrors(cfg.errors), coapNet.WithOnReadTimeout(func() error {
+			monitor.CheckInactivity(cc)
+			return nil
+		}), coapNet.WithFlowLabel(cfg.flowLabel))
+	}
+	l := newUDPConn(conn)
 	session := NewSession(cfg.ctx,
 		l,
 		addr,
@@ -175,17 +242,76 @@ func Client(conn *net.UDPConn, opts ...DialOption) *client.ClientConn {
 		cfg.closeSocket,
 		context.Background(),
 	)
-	cc = client.NewClientConn(session,
-		observationTokenHandler, observatioRequests, cfg.transmissionNStart, cfg.transmissionAcknowledgeTimeout, cfg.transmissionMaxRetransmit,
-		client.NewObservationHandler(observationTokenHandler, cfg.handler),
-		cfg.blockwiseSZX,
-		blockWise,
-		cfg.goPool,
-		cfg.errors,
-		cfg.getMID,
-		monitor,
+	session.demux = cfg.demux
+	if cfg.rebindPolicy != nil && addr != nil {
+		policy := *cfg.rebindPolicy
+		session.connection = newRebindingTransport(session.Context(), policy, l, addr, cfg.closeSocket, func(ctx context.Context) (*coapNet.UDPConn, error) {
+			c, err := cfg.dialer.DialContext(ctx, cfg.net, addr.String())
+			if err != nil {
+				return nil, err
+			}
+			conn, ok := c.(*net.UDPConn)
+			if !ok {
+				c.Close()
+				return nil, fmt.Errorf("unsupported connection type: %T", c)
+			}
+			return newUDPConn(conn), nil
+		}, cfg.errors, func(oldAddr, newAddr net.Addr) {
+			policy.onRebind(cc, cfg.errors, oldAddr, newAddr)
+		})
+		// the transport closes the sockets it bound, the initial one only by WithCloseSocket
+		session.closeSocket = true
+	}
+	cc = client.NewClientConn(
+		session,
+		observationTokenHandler,
+		observatioRequests,
+		client.Config{
+			TransmissionNStart:             cfg.transmissionNStart,
+			TransmissionAcknowledgeTimeout: cfg.transmissionAcknowledgeTimeout,
+			TransmissionMaxRetransmit:      cfg.transmissionMaxRetransmit,
+			Handler:                        client.NewObservationHandler(observationTokenHandler, cfg.handler),
+			BlockwiseSZX:                   cfg.blockwiseSZX,
+			BlockWise:                      blockWise,
+			GoPool:                         cfg.goPool,
+			Errors:                         cfg.errors,
+			MIDGenerator:                   cfg.newMIDGenerator(session.RemoteAddr()),
+			ActivityMonitor:                monitor,
+			RawHandler:                     cfg.rawHandler,
+			ReliableTransport:              cfg.reliableTransport,
+			ObservationStore:               cfg.observationStore,
+			OnExchange:                     cfg.onExchange,
+			NonResponsePolicy:              cfg.nonResponsePolicy,
+			Pacing:                         cfg.pacing,
+			OSCOREContext:                  cfg.oscoreContext,
+			NewTransmissionParams:          cfg.newTransmissionParams,
+			ObserveRecovery:                cfg.observeRecovery,
+			ControlLaneSize:                cfg.controlLaneSize,
+			OnRetransmit:                   cfg.onRetransmit,
+			TraceHandler:                   cfg.traceHandler,
+			NewDedup:                       cfg.newDedup,
+			PooledResponses:                cfg.pooledResponses,
+			ResponseCache:                  cfg.responseCache,
+			Authority:                      cfg.uriAuthority,
+			TokenManager:                   cfg.tokenManager,
+			OnDuplicate:                    cfg.onDuplicate,
+			Backpressure:                   cfg.backpressure,
+			NStart:                         cfg.nStart,
+			ParserLimits:                   cfg.parserLimits,
+			NonConfirmableRetry:            cfg.nonConfirmableRetry,
+			RetryAfter:                     cfg.retryAfter,
+			WriteTimeout:                   cfg.writeTimeout,
+			ExchangeTimeout:                cfg.exchangeTimeout,
+			MessagePool:                    cfg.messagePool,
+		},
 	)
 
+	cc.SetRequestInfo(coapNet.RequestInfo{
+		Network:    "udp",
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+	})
+
 	go func() {
 		err := cc.Run()
 		if err != nil {
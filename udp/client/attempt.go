@@ -0,0 +1,38 @@
+package client
+
+import (
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// copyRequest returns new message with the code, the token, the type, the options and the body of the request.
+func (cc *ClientConn) copyRequest(req *pool.Message) *pool.Message {
+	r := cc.messagePool.AcquireMessage(req.Context())
+	r.SetCode(req.Code())
+	r.SetToken(req.Token())
+	r.SetType(req.Type())
+	r.ResetOptionsTo(req.Options())
+	if req.Body() != nil {
+		r.SetBody(req.Body())
+	}
+	return r
+}
+
+// doAttempt sends the request and returns the response. OSCORE protects the sent message in place, so the request
+// is sent by a copy when it is protected or when the attempt repeats it. Then the request stays unchanged and every
+// attempt is protected with a new sender sequence number. The repeated attempt is a new exchange with a new message
+// ID, so it isn't deduplicated by the server. Echo is set to the copy, it's an inner option protected by OSCORE.
+func (cc *ClientConn) doAttempt(req *pool.Message, repeated bool, echo []byte) (*pool.Message, error) {
+	if !repeated && cc.oscore == nil {
+		return cc.doRequest(req)
+	}
+	r := cc.copyRequest(req)
+	defer pool.ReleaseMessage(r)
+	if !repeated && req.HasMessageID() {
+		r.SetMessageID(req.MessageID())
+	}
+	if echo != nil {
+		r.SetOptionBytes(message.Echo, echo)
+	}
+	return cc.doRequest(r)
+}
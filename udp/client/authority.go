@@ -0,0 +1,117 @@
+package client
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// Authority of the origin server is stamped to requests as Uri-Host and Uri-Port options by the rules
+// of RFC 7252 section 6.4: Uri-Host is omitted when the host is IP literal of the peer and Uri-Port is omitted
+// when the port is the port of the peer. So requests carry the name of the server dialed by name and the origin
+// server of requests sent via a proxy.
+type Authority struct {
+	// Host is name or IP literal of the origin server.
+	Host string
+	// Port of the origin server, zero means the port of the peer.
+	Port uint16
+	// ProxyScheme is scheme of the origin server, e.g. "coap" or "http", when the peer is a forward-proxy. Requests
+	// then carry Proxy-Scheme, Uri-Host and Uri-Port of the origin server (RFC 7252 section 6.5), unless the caller
+	// set Proxy-Uri.
+	ProxyScheme string
+}
+
+// NewAuthority parses authority of the origin server, "host" or "host:port". It returns nil for authority
+// without host.
+func NewAuthority(authority string) *Authority {
+	var a Authority
+	if host, port, err := net.SplitHostPort(authority); err == nil {
+		a.Host = host
+		if v, err := strconv.ParseUint(port, 10, 16); err == nil {
+			a.Port = uint16(v)
+		}
+	} else {
+		a.Host = strings.TrimSuffix(strings.TrimPrefix(authority, "["), "]")
+	}
+	if a.Host == "" {
+		return nil
+	}
+	return &a
+}
+
+// stamp sets Uri-Host and Uri-Port of the request sent to the peer. Options set by the caller take precedence,
+// but they are removed as well when they are redundant.
+func (a *Authority) stamp(req *pool.Message, peer net.Addr) {
+	if a == nil || !codes.IsRequest(req.Code()) {
+		return
+	}
+	if a.ProxyScheme != "" {
+		a.stampProxy(req)
+		return
+	}
+	var peerIP net.IP
+	var peerPort uint32
+	if host, port, err := net.SplitHostPort(peer.String()); err == nil {
+		peerIP = net.ParseIP(host)
+		if v, err := strconv.ParseUint(port, 10, 16); err == nil {
+			peerPort = uint32(v)
+		}
+	}
+
+	host, err := req.Options().GetString(message.URIHost)
+	if err != nil {
+		host = a.Host
+	}
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")); ip != nil && ip.Equal(peerIP) {
+		req.Remove(message.URIHost)
+	} else {
+		req.SetOptionString(message.URIHost, uriHost(host))
+	}
+
+	port, err := req.GetOptionUint32(message.URIPort)
+	if err != nil {
+		port = uint32(a.Port)
+		if port == 0 {
+			port = peerPort
+		}
+	}
+	if port == peerPort {
+		req.Remove(message.URIPort)
+	} else {
+		req.SetOptionUint32(message.URIPort, port)
+	}
+}
+
+// stampProxy sets Proxy-Scheme, Uri-Host and Uri-Port of the origin server to the request sent via a forward-proxy.
+// Uri-Host is never omitted, the peer is the proxy.
+func (a *Authority) stampProxy(req *pool.Message) {
+	if req.HasOption(message.ProxyURI) {
+		return
+	}
+	if !req.HasOption(message.ProxyScheme) {
+		req.SetOptionString(message.ProxyScheme, a.ProxyScheme)
+	}
+	host, err := req.Options().GetString(message.URIHost)
+	if err != nil {
+		host = a.Host
+	}
+	req.SetOptionString(message.URIHost, uriHost(host))
+	if !req.HasOption(message.URIPort) && a.Port != 0 {
+		req.SetOptionUint32(message.URIPort, uint32(a.Port))
+	}
+}
+
+// uriHost formats the host as value of Uri-Host: IPv6 literal is enclosed in brackets and name is lowercase.
+func uriHost(host string) string {
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")); ip != nil {
+		if ip.To4() == nil {
+			return "[" + ip.String() + "]"
+		}
+		return ip.String()
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// SlowObserverFunc is called when a notification is written to the observer whose backlog reached the threshold,
+// so the data source can downsample notifications of the congested observer instead of piling them up.
+type SlowObserverFunc = func(cc *ClientConn, token message.Token, backlog int)
+
+// Backpressure reports observers which don't keep up with notifications.
+type Backpressure struct {
+	// Threshold is backlog of an observer which is reported to OnSlow. Zero disables reporting.
+	Threshold int
+	// OnSlow is called with backlog of the observer including the written notification.
+	OnSlow SlowObserverFunc
+}
+
+// backlogs counts notifications of observers which are being written, i.e. they wait for pacing,
+// for the acknowledgement or for the socket.
+type backlogs struct {
+	mutex  sync.Mutex
+	tokens map[string]int
+}
+
+func newBacklogs() *backlogs {
+	return &backlogs{
+		tokens: make(map[string]int),
+	}
+}
+
+func (b *backlogs) add(key string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens[key]++
+	return b.tokens[key]
+}
+
+func (b *backlogs) remove(key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	n := b.tokens[key] - 1
+	if n <= 0 {
+		delete(b.tokens, key)
+		return
+	}
+	b.tokens[key] = n
+}
+
+func (b *backlogs) get(key string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.tokens[key]
+}
+
+// isNotification reports whether the message is a notification of an observation.
+func isNotification(m *pool.Message) bool {
+	return !codes.IsRequest(m.Code()) && m.Code() != codes.Empty && m.HasOption(message.Observe)
+}
+
+// ObserverBacklog returns number of notifications of the observation with the token which are being written
+// to the peer. A growing backlog means the peer or the network doesn't keep up with the notifications.
+func (cc *ClientConn) ObserverBacklog(token message.Token) int {
+	return cc.backlogs.get(token.String())
+}
+
+// trackNotification counts the notification in backlog of its observer until the returned function is called.
+func (cc *ClientConn) trackNotification(m *pool.Message) func() {
+	if !isNotification(m) {
+		return func() {}
+	}
+	key := m.Token().String()
+	backlog := cc.backlogs.add(key)
+	if cc.backpressure.OnSlow != nil && cc.backpressure.Threshold > 0 && backlog >= cc.backpressure.Threshold {
+		cc.backpressure.OnSlow(cc, m.Token(), backlog)
+	}
+	return func() {
+		cc.backlogs.remove(key)
+	}
+}
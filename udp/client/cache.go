@@ -0,0 +1,54 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+func newCache(store cache.Store) *cache.Cache {
+	if store == nil {
+		return nil
+	}
+	return cache.New(store)
+}
+
+// doCached answers the request by the fresh cached response, otherwise the response is requested and cached.
+// The stale response is revalidated by its ETag, and 2.03 (Valid) is answered by the cached representation.
+func (cc *ClientConn) doCached(req *pool.Message) (*pool.Message, error) {
+	key := cache.Key(cc.RemoteAddr().String(), req.Message)
+	cached, fresh := cc.cache.Lookup(key)
+	if fresh {
+		resp := cc.messagePool.AcquireMessage(req.Context())
+		cached.CopyTo(resp.Message)
+		resp.SetToken(req.Token())
+		resp.SetType(udpMessage.Acknowledgement)
+		return resp, nil
+	}
+	var revalidate bool
+	if cached != nil && !req.HasOption(message.ETag) {
+		if etag, ok := cached.ETag(); ok {
+			req.SetOptionBytes(message.ETag, etag)
+			defer req.Remove(message.ETag)
+			revalidate = true
+		}
+	}
+	resp, err := cc.doRequestWithRetryAfter(req)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := cc.cache.Update(key, resp.Message)
+	if err != nil {
+		pool.ReleaseMessage(resp)
+		return nil, fmt.Errorf("cannot cache response: %w", err)
+	}
+	if revalidate && resp.Code() == codes.Valid && updated != nil {
+		// the application didn't validate its own representation, so it gets the cached one
+		updated.CopyTo(resp.Message)
+	}
+	return resp, nil
+}
@@ -2,30 +2,44 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	atomicTypes "go.uber.org/atomic"
 
-	"github.com/patrickmn/go-cache"
+	"github.com/plgd-dev/go-coap/v2/cache"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/noresponse"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 	kitSync "github.com/plgd-dev/kit/sync"
 )
 
+// ErrConnectionClosing is returned for requests issued after CloseGracefully was called.
+var ErrConnectionClosing = errors.New("connection is closing")
+
 type HandlerFunc = func(*ResponseWriter, *pool.Message)
 type ErrorFunc = func(error)
 type GoPoolFunc = func(func()) error
 type EventFunc = func()
 type GetMIDFunc = func() uint16
 
+// RawHandlerFunc processes incoming message before the message layer. When it returns true,
+// the message is considered as processed and it is neither deduplicated, acknowledged nor passed to the handler.
+type RawHandlerFunc = func(cc *ClientConn, msg *pool.Message) bool
+
 type Session interface {
 	Context() context.Context
 	Close() error
@@ -47,19 +61,57 @@ type ClientConn struct {
 	// This field needs to be the first in the struct to ensure proper word alignment on 32-bit platforms.
 	// See: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	sequence                uint64
-	msgID                   uint32
+	midGenerator            MIDGenerator
 	session                 Session
 	handler                 HandlerFunc
 	observationTokenHandler *HandlerContainer
 	observationRequests     *kitSync.Map
 	transmission            *Transmission
+	transmissionParams      TransmissionParams
 	blockwiseSZX            blockwise.SZX
 	blockWise               *blockwise.BlockWise
 	goPool                  GoPoolFunc
 	errors                  ErrorFunc
-	responseMsgCache        *cache.Cache
+	dedup                   Dedup
 	msgIdMutex              *MutexMap
 	activityMonitor         Notifier
+	rawHandler              RawHandlerFunc
+	reliableTransport       bool
+	observationStore        observation.Store
+	observations            *kitSync.Map
+	inFlight                *inFlight
+	handlers                *inFlight
+	observers               *observers
+	resets                  *resets
+	authority               *Authority
+	tokenManager            message.TokenManager
+	exchangeStats           exchangeStats
+	onExchange              ExchangeFunc
+	duplicateStats          duplicateStats
+	onDuplicate             DuplicateFunc
+	backlogs                *backlogs
+	backpressure            Backpressure
+	nonResponsePolicy       NonResponsePolicy
+	pacer                   *pacer
+	nStart                  *nStart
+	parserLimits            message.ParserLimits
+	nonConfirmableRetry     NonConfirmableRetry
+	retryAfter              RetryAfterPolicy
+	writeTimeout            time.Duration
+	exchangeTimeout         time.Duration
+	messagePool             *pool.Pool
+	exchanges               *trace.Exchanges
+	oscore                  *oscore.Endpoint
+	observeRecovery         ObserveRecovery
+	unresponsive            uint32
+	controlLane             *controlLane
+	onRetransmit            RetransmitFunc
+	traceHandler            TraceHandler
+	pooledResponses         bool
+	// requestInfo is set to context of received messages
+	requestInfo *coapNet.RequestInfo
+	// cache answers GET requests by cached responses
+	cache *cache.Cache
 
 	tokenHandlerContainer *HandlerContainer
 	midHandlerContainer   *HandlerContainer
@@ -93,47 +145,90 @@ func NewClientConn(
 	session Session,
 	observationTokenHandler *HandlerContainer,
 	observationRequests *kitSync.Map,
-	transmissionNStart time.Duration,
-	transmissionAcknowledgeTimeout time.Duration,
-	transmissionMaxRetransmit int,
-	handler HandlerFunc,
-	blockwiseSZX blockwise.SZX,
-	blockWise *blockwise.BlockWise,
-	goPool GoPoolFunc,
-	errors ErrorFunc,
-	getMID GetMIDFunc,
-	activityMonitor Notifier,
+	cfg Config,
 ) *ClientConn {
+	errors := cfg.Errors
 	if errors == nil {
 		errors = func(error) {}
 	}
-	if getMID == nil {
-		getMID = udpMessage.GetMID
+	midGenerator := cfg.MIDGenerator
+	if midGenerator == nil {
+		midGenerator = NewSequentialMIDGenerator(session.RemoteAddr())
+	}
+	tokenManager := cfg.TokenManager
+	if tokenManager == nil {
+		tokenManager = message.NewTokenManager(message.DefaultTokenLength)
+	}
+	transmission := &Transmission{
+		atomicTypes.NewDuration(cfg.TransmissionNStart),
+		atomicTypes.NewDuration(cfg.TransmissionAcknowledgeTimeout),
+		atomicTypes.NewInt32(int32(cfg.TransmissionMaxRetransmit)),
+	}
+	var transmissionParams TransmissionParams = transmission
+	var dedup Dedup
+	if cfg.NewDedup != nil {
+		dedup = cfg.NewDedup()
+	} else {
+		dedup = NewDedupCache(DedupConfig{})
+	}
+	if cfg.NewTransmissionParams != nil {
+		transmissionParams = cfg.NewTransmissionParams()
 	}
 
-	return &ClientConn{
-		msgID:                   uint32(getMID() - 0xffff/2),
+	cc := &ClientConn{
+		midGenerator:            midGenerator,
 		session:                 session,
 		observationTokenHandler: observationTokenHandler,
 		observationRequests:     observationRequests,
-		transmission: &Transmission{
-			atomicTypes.NewDuration(transmissionNStart),
-			atomicTypes.NewDuration(transmissionAcknowledgeTimeout),
-			atomicTypes.NewInt32(int32(transmissionMaxRetransmit)),
-		},
-		handler:      handler,
-		blockwiseSZX: blockwiseSZX,
-		blockWise:    blockWise,
+		transmission:            transmission,
+		transmissionParams:      transmissionParams,
+		handler:                 cfg.Handler,
+		blockwiseSZX:            cfg.BlockwiseSZX,
+		blockWise:               cfg.BlockWise,
 
 		tokenHandlerContainer: NewHandlerContainer(),
 		midHandlerContainer:   NewHandlerContainer(),
-		goPool:                goPool,
-		errors:                errors,
-		// EXCHANGE_LIFETIME = 247
-		responseMsgCache: cache.New(247*time.Second, 60*time.Second),
-		msgIdMutex:       NewMutexMap(),
-		activityMonitor:  activityMonitor,
+		goPool:                cfg.GoPool,
+		dedup:                 dedup,
+		msgIdMutex:            NewMutexMap(),
+		activityMonitor:       cfg.ActivityMonitor,
+		rawHandler:            cfg.RawHandler,
+		reliableTransport:     cfg.ReliableTransport,
+		observationStore:      cfg.ObservationStore,
+		observations:          kitSync.NewMap(),
+		inFlight:              newInFlight(),
+		handlers:              newInFlight(),
+		observers:             newObservers(),
+		resets:                newResets(),
+		authority:             cfg.Authority,
+		tokenManager:          tokenManager,
+		onExchange:            cfg.OnExchange,
+		onDuplicate:           cfg.OnDuplicate,
+		backlogs:              newBacklogs(),
+		backpressure:          cfg.Backpressure,
+		nonResponsePolicy:     cfg.NonResponsePolicy,
+		pacer:                 newPacer(cfg.Pacing),
+		nStart:                newNStart(cfg.NStart),
+		parserLimits:          cfg.ParserLimits,
+		nonConfirmableRetry:   cfg.NonConfirmableRetry,
+		retryAfter:            cfg.RetryAfter,
+		writeTimeout:          cfg.WriteTimeout,
+		exchangeTimeout:       cfg.ExchangeTimeout,
+		messagePool:           cfg.MessagePool,
+		exchanges:             trace.NewExchanges(ExchangeLifetime),
+		oscore:                newOSCOREEndpoint(cfg.OSCOREContext),
+		observeRecovery:       cfg.ObserveRecovery,
+		controlLane:           newControlLane(cfg.ControlLaneSize),
+		onRetransmit:          cfg.OnRetransmit,
+		traceHandler:          cfg.TraceHandler,
+		pooledResponses:       cfg.PooledResponses,
+		cache:                 newCache(cfg.ResponseCache),
 	}
+	cc.errors = func(err error) {
+		errors(&coapNet.ConnError{RemoteAddr: cc.RemoteAddr(), Err: err})
+	}
+	cc.traceSession()
+	return cc
 }
 
 func (cc *ClientConn) Session() Session {
@@ -141,7 +236,7 @@ func (cc *ClientConn) Session() Session {
 }
 
 func (cc *ClientConn) getMID() uint16 {
-	return uint16(atomic.AddUint32(&cc.msgID, 1))
+	return cc.midGenerator.NextMID()
 }
 
 // Close closes connection without wait of ends Run function.
@@ -149,7 +244,50 @@ func (cc *ClientConn) Close() error {
 	return cc.session.Close()
 }
 
+// CloseGracefully rejects new requests, waits until requests in progress and blockwise transfers
+// are finished, cancels observations at the server and closes the connection. When ctx is done
+// before that, the connection is closed immediately and ctx error is returned. Records in
+// the observation store are kept, so observations can be restored later.
+func (cc *ClientConn) CloseGracefully(ctx context.Context) error {
+	err := cc.drain(ctx)
+	if err == nil {
+		err = cc.cancelObservations(ctx)
+	}
+	errClose := cc.Close()
+	if err != nil {
+		return err
+	}
+	return errClose
+}
+
+func (cc *ClientConn) drain(ctx context.Context) error {
+	select {
+	case <-cc.inFlight.drain():
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-cc.Context().Done():
+		return nil
+	}
+	if cc.blockWise == nil {
+		return nil
+	}
+	for cc.blockWise.HasPendingTransfers() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-cc.Context().Done():
+			return nil
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	return nil
+}
+
 func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
+	return cc.doWith(req, cc.writeMessage)
+}
+
+func (cc *ClientConn) doWith(req *pool.Message, writeMessage func(req *pool.Message) error) (*pool.Message, error) {
 	token := req.Token()
 	if token == nil {
 		return nil, fmt.Errorf("invalid token")
@@ -167,7 +305,8 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 		return nil, fmt.Errorf("cannot add token handler: %w", err)
 	}
 	defer cc.tokenHandlerContainer.Pop(token)
-	err = cc.writeMessage(req)
+	start := time.Now()
+	err = writeMessage(req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot write request: %w", err)
 	}
@@ -177,6 +316,7 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 	case <-cc.session.Context().Done():
 		return nil, fmt.Errorf("connection was closed: %w", cc.session.Context().Err())
 	case resp := <-respChan:
+		cc.trace(trace.ExchangeFinished, resp, 0, time.Since(start))
 		return resp, nil
 	}
 }
@@ -188,18 +328,68 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 //
 // Caller is responsible to release request and response.
 func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
+	if !cc.inFlight.acquire() {
+		return nil, ErrConnectionClosing
+	}
+	defer cc.inFlight.release()
+	cc.startExchange(req)
+	ctx := req.Context()
+	exchangeCtx, finish := coapNet.ExchangeTimeout(ctx, cc.exchangeTimeout)
+	req.SetContext(exchangeCtx)
+	defer req.SetContext(ctx)
+	if cc.cache != nil && cache.Cacheable(req.Message) {
+		resp, err := cc.doCached(req)
+		return resp, finish(err)
+	}
+	resp, err := cc.doRequestWithRetryAfter(req)
+	return resp, finish(err)
+}
+
+// acquireToken replaces token of the request by a token of the token manager, which must be released when
+// the exchange is finished.
+func (cc *ClientConn) acquireToken(req *pool.Message) (message.Token, error) {
+	token, err := cc.tokenManager.NewToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get token: %w", err)
+	}
+	req.SetToken(token)
+	return token, nil
+}
+
+// doWithToken does the request with a token of the token manager.
+func (cc *ClientConn) doWithToken(req *pool.Message) (*pool.Message, error) {
+	token, err := cc.acquireToken(req)
+	if err != nil {
+		return nil, err
+	}
+	defer cc.tokenManager.Release(token)
+	return cc.Do(req)
+}
+
+func (cc *ClientConn) doRequest(req *pool.Message) (*pool.Message, error) {
+	cc.authority.stamp(req, cc.RemoteAddr())
+	do := cc.do
+	if retry, ok := cc.nonConfirmableRetryOf(req); ok {
+		do = func(req *pool.Message) (*pool.Message, error) {
+			return cc.doNonConfirmable(req, retry)
+		}
+	}
 	if cc.blockWise == nil {
 		req.UpsertMessageID(cc.getMID())
-		return cc.do(req)
+		return do(req)
 	}
-	bwresp, err := cc.blockWise.Do(req, cc.blockwiseSZX, cc.session.MaxMessageSize(), func(bwreq blockwise.Message) (blockwise.Message, error) {
+	bwresp, err := cc.blockWise.DoQBlock(req, cc.blockwiseSZX, cc.session.MaxMessageSize(), func(bwreq blockwise.Message) (blockwise.Message, error) {
 		req := bwreq.(*pool.Message)
-		if req.Options().HasOption(message.Block1) || req.Options().HasOption(message.Block2) {
+		if isBlock(req) {
 			req.SetMessageID(cc.getMID())
 		} else {
 			req.UpsertMessageID(cc.getMID())
 		}
-		return cc.do(req)
+		return do(req)
+	}, func(bwreq blockwise.Message) error {
+		req := bwreq.(*pool.Message)
+		req.SetMessageID(cc.getMID())
+		return cc.writeMessage(req)
 	})
 	if err != nil {
 		return nil, err
@@ -207,70 +397,164 @@ func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
 	return bwresp.(*pool.Message), nil
 }
 
+// isBlock reports whether the request is a block of blockwise transfer, which needs a new message ID.
+func isBlock(req *pool.Message) bool {
+	options := req.Options()
+	return options.HasOption(message.Block1) || options.HasOption(message.Block2) ||
+		options.HasOption(message.QBlock1) || options.HasOption(message.QBlock2)
+}
+
 func (cc *ClientConn) writeMessage(req *pool.Message) error {
+	if cc.resets.pop(req.Token()) {
+		// the previous non-confirmable message with the token was rejected
+		return message.ErrMessageReset
+	}
+	err := cc.protect(req)
+	if err != nil {
+		return err
+	}
+	if cc.reliableTransport {
+		// delivery is guaranteed by the transport so acknowledgement is not awaited
+		err := cc.writeToSession(req)
+		if err != nil {
+			return fmt.Errorf("cannot write request: %w", err)
+		}
+		return nil
+	}
 	respChan := make(chan struct{})
+	var respOnce sync.Once
+	var reset bool
+	midHandler := func(w *ResponseWriter, r *pool.Message) {
+		respOnce.Do(func() {
+			reset = r.Type() == udpMessage.Reset
+			close(respChan)
+		})
+		if r.Type() == udpMessage.Reset {
+			// the peer rejected the message
+			return
+		}
+		if r.IsSeparate() {
+			// separate message - just accept
+			return
+		}
+		cc.handleBW(w, r)
+	}
 
 	// Only confirmable messages ever match an message ID
+	var mids []uint16
 	if req.Type() == udpMessage.Confirmable {
-		err := cc.midHandlerContainer.Insert(req.MessageID(), func(w *ResponseWriter, r *pool.Message) {
-			close(respChan)
-			if r.IsSeparate() {
-				// separate message - just accept
-				return
-			}
-			cc.handleBW(w, r)
-		})
+		err := cc.nStart.acquire(req.Context(), cc.Context().Done())
+		if err != nil {
+			return fmt.Errorf("cannot start exchange: %w", err)
+		}
+		defer cc.nStart.release()
+		err = cc.midHandlerContainer.Insert(req.MessageID(), midHandler)
 		if err != nil {
 			return fmt.Errorf("cannot insert mid handler: %w", err)
 		}
-		defer cc.midHandlerContainer.Pop(req.MessageID())
+		mids = append(mids, req.MessageID())
+		defer func() {
+			// acknowledgement of an earlier transmission is accepted as well
+			for _, mid := range mids {
+				cc.midHandlerContainer.Pop(mid)
+			}
+		}()
 	}
 
-	err := cc.session.WriteMessage(req)
+	err = cc.pace(req)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = cc.writeToSession(req)
 	if err != nil {
 		return fmt.Errorf("cannot write request: %w", err)
 	}
 	if req.Type() != udpMessage.Confirmable {
 		// If the request is not confirmable, we do not need to wait for a response
 		// and skip retransmissions
+		cc.resets.store(req.MessageID(), req.Token())
 		close(respChan)
 	}
 
-	maxRetransmit := cc.transmission.maxRetransmit.Load()
-	for i := int32(0); i < maxRetransmit; i++ {
+	timeouts := cc.transmissionParams.RetransmissionTimeouts()
+	for i, timeout := range timeouts {
 		select {
 		case <-respChan:
+			if req.Type() == udpMessage.Confirmable {
+				cc.addExchange(Exchange{
+					Start:       start,
+					RTT:         time.Since(start),
+					Retransmits: i,
+				})
+			}
+			if reset {
+				return message.ErrMessageReset
+			}
 			return nil
 		case <-req.Context().Done():
 			return req.Context().Err()
 		case <-cc.Context().Done():
 			return fmt.Errorf("connection was closed: %w", cc.Context().Err())
-		case <-time.After(cc.transmission.acknowledgeTimeout.Load()):
-			select {
-			case <-req.Context().Done():
-				return req.Context().Err()
-			case <-cc.session.Context().Done():
-				return fmt.Errorf("connection was closed: %w", cc.Context().Err())
-			case <-time.After(cc.transmission.nStart.Load()):
-				err = cc.session.WriteMessage(req)
+		case <-time.After(timeout):
+			if req.Type() == udpMessage.Confirmable && cc.onRetransmit != nil {
+				modified, err := cc.onRetransmit(req, i+1)
 				if err != nil {
-					return fmt.Errorf("cannot write request: %w", err)
+					return fmt.Errorf("cannot update request for retransmission: %w", err)
+				}
+				if modified {
+					mid := cc.getMID()
+					err = cc.midHandlerContainer.Insert(mid, midHandler)
+					if err != nil {
+						return fmt.Errorf("cannot insert mid handler: %w", err)
+					}
+					mids = append(mids, mid)
+					req.SetMessageID(mid)
 				}
 			}
+			err = cc.pace(req)
+			if err != nil {
+				return err
+			}
+			cc.trace(trace.Retransmit, req, i+1, time.Since(start))
+			err = cc.writeToSession(req)
+			if err != nil {
+				return fmt.Errorf("cannot write request: %w", err)
+			}
 		}
 	}
-	return fmt.Errorf("timeout: retransmission(%v) was exhausted", cc.transmission.maxRetransmit.Load())
+	if req.Type() == udpMessage.Confirmable {
+		cc.addExchange(Exchange{
+			Start:       start,
+			Retransmits: len(timeouts),
+			Timeout:     true,
+		})
+	}
+	return &coapNet.TimeoutError{Kind: coapNet.TimeoutRetransmission, Err: fmt.Errorf("retransmission(%v) was exhausted", len(timeouts))}
 }
 
 // WriteMessage sends an coap message.
 func (cc *ClientConn) WriteMessage(req *pool.Message) error {
+	if !cc.inFlight.acquire() {
+		return ErrConnectionClosing
+	}
+	defer cc.inFlight.release()
+	defer cc.trackNotification(req)()
+	cc.startExchange(req)
+	return cc.writeBlockwiseMessage(req)
+}
+
+// writeBlockwiseMessage sends the message, split to blocks when blockwise is enabled. It isn't gated
+// by graceful close, so it is used for responses to requests which were accepted before.
+func (cc *ClientConn) writeBlockwiseMessage(req *pool.Message) error {
+	cc.authority.stamp(req, cc.RemoteAddr())
 	if cc.blockWise == nil {
 		req.UpsertMessageID(cc.getMID())
 		return cc.writeMessage(req)
 	}
 	return cc.blockWise.WriteMessage(cc.RemoteAddr(), req, cc.blockwiseSZX, cc.session.MaxMessageSize(), func(bwreq blockwise.Message) error {
 		req := bwreq.(*pool.Message)
-		if req.Options().HasOption(message.Block1) || req.Options().HasOption(message.Block2) {
+		if isBlock(req) {
 			req.SetMessageID(cc.getMID())
 		} else {
 			req.UpsertMessageID(cc.getMID())
@@ -279,12 +563,30 @@ func (cc *ClientConn) WriteMessage(req *pool.Message) error {
 	})
 }
 
-func newCommonRequest(ctx context.Context, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
+// WriteRawMessage sends an coap message as is. The type, message ID and token are not modified and
+// the message is neither retransmitted nor split to blocks.
+func (cc *ClientConn) WriteRawMessage(req *pool.Message) error {
+	return cc.writeToSession(req)
+}
+
+// DoRaw sends an coap message as is and returns the first response with the same token.
+//
+// The type, message ID and token are not modified and the message is neither retransmitted nor
+// split to blocks. Caller is responsible to release request and response.
+func (cc *ClientConn) DoRaw(req *pool.Message) (*pool.Message, error) {
+	if !cc.inFlight.acquire() {
+		return nil, ErrConnectionClosing
+	}
+	defer cc.inFlight.release()
+	return cc.doWith(req, cc.WriteRawMessage)
+}
+
+func newCommonRequest(ctx context.Context, messagePool *pool.Pool, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
 	token, err := message.GetToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot get token: %w", err)
 	}
-	req := pool.AcquireMessage(ctx)
+	req := messagePool.AcquireMessage(ctx)
 	req.SetCode(code)
 	req.SetToken(token)
 	req.ResetOptionsTo(opts)
@@ -297,7 +599,7 @@ func newCommonRequest(ctx context.Context, code codes.Code, path string, opts ..
 //
 // Use ctx to set timeout.
 func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.GET, path, opts...)
+	return newCommonRequest(ctx, nil, codes.GET, path, opts...)
 }
 
 // Get issues a GET to the specified path.
@@ -307,12 +609,12 @@ func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*p
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
 // Any status code doesn't cause an error.
 func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	req, err := newCommonRequest(ctx, cc.messagePool, codes.GET, path, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create get request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
 }
 
 // NewPostRequest creates post request.
@@ -324,7 +626,7 @@ func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Opti
 //
 // If payload is nil then content format is not used.
 func NewPostRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.POST, path, opts...)
+	req, err := newCommonRequest(ctx, nil, codes.POST, path, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -344,12 +646,12 @@ func NewPostRequest(ctx context.Context, path string, contentFormat message.Medi
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPostRequest(ctx, path, contentFormat, payload, opts...)
+	req, err := newPayloadRequest(ctx, cc.messagePool, codes.POST, path, contentFormat, payload, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create post request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
 }
 
 // NewPutRequest creates put request.
@@ -358,7 +660,7 @@ func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat messa
 //
 // If payload is nil then content format is not used.
 func NewPutRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.PUT, path, opts...)
+	req, err := newCommonRequest(ctx, nil, codes.PUT, path, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -378,31 +680,122 @@ func NewPutRequest(ctx context.Context, path string, contentFormat message.Media
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Put(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPutRequest(ctx, path, contentFormat, payload, opts...)
+	req, err := newPayloadRequest(ctx, cc.messagePool, codes.PUT, path, contentFormat, payload, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create put request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
 }
 
 // NewDeleteRequest creates delete request.
 //
 // Use ctx to set timeout.
 func NewDeleteRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.DELETE, path, opts...)
+	return newCommonRequest(ctx, nil, codes.DELETE, path, opts...)
 }
 
 // Delete deletes the resource identified by the request path.
 //
 // Use ctx to set timeout.
 func (cc *ClientConn) Delete(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewDeleteRequest(ctx, path, opts...)
+	req, err := newCommonRequest(ctx, cc.messagePool, codes.DELETE, path, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create delete request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	return cc.Do(req)
+	return cc.doWithToken(req)
+}
+
+func newPayloadRequest(ctx context.Context, messagePool *pool.Pool, code codes.Code, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newCommonRequest(ctx, messagePool, code, path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.SetContentFormat(contentFormat)
+		req.SetBody(payload)
+	}
+	return req, nil
+}
+
+// NewFetchRequest creates fetch request (RFC 8132), the payload describes the requested part of the resource.
+//
+// Use ctx to set timeout.
+//
+// If payload is nil then content format is not used.
+func NewFetchRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	return newPayloadRequest(ctx, nil, codes.FETCH, path, contentFormat, payload, opts...)
+}
+
+// Fetch issues a FETCH to the specified path. Large payload is sent by Block1 and large response
+// is received by Block2 as for Post.
+//
+// Use ctx to set timeout.
+//
+// An error is returned if by failure to speak COAP (such as a network connectivity problem).
+// Any status code doesn't cause an error.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) Fetch(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newPayloadRequest(ctx, cc.messagePool, codes.FETCH, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create fetch request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	return cc.doWithToken(req)
+}
+
+// NewPatchRequest creates patch request (RFC 8132).
+//
+// Use ctx to set timeout.
+//
+// If payload is nil then content format is not used.
+func NewPatchRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	return newPayloadRequest(ctx, nil, codes.PATCH, path, contentFormat, payload, opts...)
+}
+
+// Patch issues a PATCH to the specified path.
+//
+// Use ctx to set timeout.
+//
+// An error is returned if by failure to speak COAP (such as a network connectivity problem).
+// Any status code doesn't cause an error.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) Patch(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newPayloadRequest(ctx, cc.messagePool, codes.PATCH, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create patch request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	return cc.doWithToken(req)
+}
+
+// NewIPatchRequest creates iPATCH request (RFC 8132), which is idempotent PATCH.
+//
+// Use ctx to set timeout.
+//
+// If payload is nil then content format is not used.
+func NewIPatchRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	return newPayloadRequest(ctx, nil, codes.IPATCH, path, contentFormat, payload, opts...)
+}
+
+// IPatch issues an iPATCH to the specified path.
+//
+// Use ctx to set timeout.
+//
+// An error is returned if by failure to speak COAP (such as a network connectivity problem).
+// Any status code doesn't cause an error.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) IPatch(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
+	req, err := newPayloadRequest(ctx, cc.messagePool, codes.IPATCH, path, contentFormat, payload, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create ipatch request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	return cc.doWithToken(req)
 }
 
 // Context returns the client's context.
@@ -438,7 +831,7 @@ func (cc *ClientConn) Ping(ctx context.Context) error {
 
 // AsyncPing sends ping and receivedPong will be called when pong arrives. It returns cancellation of ping operation.
 func (cc *ClientConn) AsyncPing(receivedPong func()) (func(), error) {
-	req := pool.AcquireMessage(cc.Context())
+	req := cc.messagePool.AcquireMessage(cc.Context())
 	defer pool.ReleaseMessage(req)
 	req.SetType(udpMessage.Confirmable)
 	req.SetCode(codes.Empty)
@@ -452,7 +845,7 @@ func (cc *ClientConn) AsyncPing(receivedPong func()) (func(), error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot insert mid handler: %w", err)
 	}
-	err = cc.session.WriteMessage(req)
+	err = cc.writeToSession(req)
 	if err != nil {
 		cc.midHandlerContainer.Pop(mid)
 		return nil, fmt.Errorf("cannot write request: %w", err)
@@ -497,6 +890,14 @@ func (b *bwResponseWriter) RemoteAddr() net.Addr {
 	return b.w.cc.RemoteAddr()
 }
 
+// WriteMessage sends the message to the peer in a new Non-confirmable message, e.g. a block of Q-Block2 set.
+func (b *bwResponseWriter) WriteMessage(m blockwise.Message) error {
+	req := m.(*pool.Message)
+	req.SetType(udpMessage.NonConfirmable)
+	req.SetMessageID(b.w.cc.getMID())
+	return b.w.cc.writeMessage(req)
+}
+
 func (cc *ClientConn) handleBW(w *ResponseWriter, r *pool.Message) {
 	if cc.blockWise != nil {
 		bwr := bwResponseWriter{
@@ -532,6 +933,15 @@ func (cc *ClientConn) handle(w *ResponseWriter, r *pool.Message) {
 		h(w, r)
 		return
 	}
+	if r.Type() == udpMessage.Reset {
+		// reset of a non-confirmable message isn't answered
+		cc.resets.reject(r.MessageID())
+		return
+	}
+	if r.Type() == udpMessage.Acknowledgement {
+		// the message was already acknowledged, the peer retransmitted the acknowledgement
+		cc.addDuplicate(DuplicateAcknowledgement, r)
+	}
 	if r.IsSeparate() {
 		// msg was processed by token handler - just drop it.
 		return
@@ -551,64 +961,147 @@ func (cc *ClientConn) addResponseToCache(resp *pool.Message) error {
 	}
 	cacheMsg := make([]byte, len(marshaledResp))
 	copy(cacheMsg, marshaledResp)
-	cc.responseMsgCache.SetDefault(fmt.Sprintf("%d", resp.MessageID()), cacheMsg)
+	cc.dedup.Store(resp.MessageID(), resp.Token(), cacheMsg)
 	return nil
 }
 
-func (cc *ClientConn) getResponseFromCache(mid uint16, resp *pool.Message) (bool, error) {
-	cachedResp, _ := cc.responseMsgCache.Get(fmt.Sprintf("%d", mid))
-	if rawMsg, ok := cachedResp.([]byte); ok {
-		_, err := resp.Unmarshal(rawMsg)
-		if err != nil {
-			return false, err
-		}
-		return true, nil
+// storeSuppressedResponse marks the exchange whose response wasn't sent, so a duplicate request isn't
+// handled again.
+func (cc *ClientConn) storeSuppressedResponse(mid uint16, token message.Token) {
+	if cc.reliableTransport {
+		return
+	}
+	cc.dedup.Store(mid, token, []byte{})
+}
+
+// checkDuplicate reports whether the request is a duplicate and returns its cached response or nil
+// when the response isn't known. Only messages with a code are deduplicated.
+func (cc *ClientConn) checkDuplicate(req *pool.Message) ([]byte, bool) {
+	if cc.reliableTransport {
+		return nil, false
 	}
-	return false, nil
+	if req.Type() != udpMessage.Confirmable && req.Type() != udpMessage.NonConfirmable {
+		return nil, false
+	}
+	if req.Code() == codes.Empty {
+		// pings and empty messages don't have any response to replay
+		return nil, false
+	}
+	return cc.dedup.CheckAndStore(req.MessageID(), req.Token())
 }
 
-// CheckMyMessageID compare client msgID against peer messageID and if it is near < 0xffff/4 then incrase msgID.
-// When msgIDs met it can cause issue because cache can send message to which doesn't bellows to request.
+// CheckMyMessageID passes message ID of the confirmable message of the peer to the message ID generator, so message IDs
+// of both sides don't meet. When they meet, the cache can send a message which doesn't belong to the request.
 func (cc *ClientConn) CheckMyMessageID(req *pool.Message) {
-	if req.Type() == udpMessage.Confirmable && req.MessageID()-uint16(atomic.LoadUint32(&cc.msgID)) < 0xffff/4 {
-		atomic.AddUint32(&cc.msgID, 0xffff/2)
+	if req.Type() == udpMessage.Confirmable {
+		cc.midGenerator.ObservePeerMID(req.MessageID())
 	}
 }
 
 func (cc *ClientConn) Process(datagram []byte) error {
+	return cc.process(datagram, false)
+}
+
+// ProcessMulticast processes the datagram which was sent to a multicast group.
+func (cc *ClientConn) ProcessMulticast(datagram []byte) error {
+	return cc.process(datagram, true)
+}
+
+// SetRequestInfo sets transport of messages received by the connection, so handlers get it from context
+// of the request by net.RequestInfoFromContext. It must be called before the connection processes messages.
+func (cc *ClientConn) SetRequestInfo(info coapNet.RequestInfo) {
+	cc.requestInfo = &info
+}
+
+func (cc *ClientConn) process(datagram []byte, multicast bool) error {
 	if cc.session.MaxMessageSize() >= 0 && len(datagram) > cc.session.MaxMessageSize() {
 		return fmt.Errorf("max message size(%v) was exceeded %v", cc.session.MaxMessageSize(), len(datagram))
 	}
-	req := pool.AcquireMessage(cc.Context())
-	_, err := req.Unmarshal(datagram)
+	req := cc.messagePool.AcquireMessage(cc.Context())
+	_, err := req.UnmarshalWithLimits(datagram, cc.parserLimits)
 	if err != nil {
+		var limitErr *message.ParserLimitError
+		if errors.As(err, &limitErr) {
+			// the datagram is well-formed, so the connection continues
+			cc.rejectOverLimit(req, limitErr)
+			pool.ReleaseMessage(req)
+			cc.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+			return nil
+		}
 		pool.ReleaseMessage(req)
 		return err
 	}
+	if cc.requestInfo != nil {
+		info := *cc.requestInfo
+		info.Multicast = multicast
+		info.Confirmable = req.Type() == udpMessage.Confirmable
+		req.SetContext(coapNet.WithRequestInfo(req.Context(), info))
+	}
+	cc.startExchange(req)
+	cc.assignMessageID(req, false)
 	req.SetSequence(cc.Sequence())
+	cc.trace(trace.MessageReceived, req, 0, 0)
 	cc.CheckMyMessageID(req)
 	cc.activityMonitor.Notify()
-	cc.goPool(func() {
+	cc.setUnresponsive(false)
+	process := func() {
 		defer cc.activityMonitor.Notify()
+		if cc.handlers.acquire() {
+			// requests received after shutdown started aren't waited for
+			defer cc.handlers.release()
+		}
+		if cc.rawHandler != nil && cc.rawHandler(cc, req) {
+			if !req.IsHijacked() {
+				pool.ReleaseMessage(req)
+			}
+			return
+		}
 		reqMid := req.MessageID()
 
-		// The same message ID can not be handled concurrently
-		// for deduplication to work
-		l := cc.msgIdMutex.Lock(reqMid)
-		defer l.Unlock()
+		if !cc.reliableTransport {
+			// The same message ID can not be handled concurrently
+			// for deduplication to work
+			l := cc.msgIdMutex.Lock(reqMid)
+			defer l.Unlock()
+		}
 
-		origResp := pool.AcquireMessage(cc.Context())
+		origResp := cc.messagePool.AcquireMessage(cc.Context())
 		origResp.SetToken(req.Token())
 		// If a request is sent in a Non-confirmable message, then the response
 		// is sent using a new Non-confirmable message, although the server may
 		// instead send a Confirmable message.
 		origResp.SetType(req.Type())
-		w := NewResponseWriter(origResp, cc, req.Options())
-		if ok, err := cc.getResponseFromCache(req.MessageID(), w.response); ok {
+		var w *ResponseWriter
+		if cc.pooledResponses {
+			w = acquireResponseWriter(origResp, cc, req.Options())
+			defer releaseResponseWriter(w)
+		} else {
+			w = NewResponseWriter(origResp, cc, req.Options())
+		}
+		w.requestMessageID = reqMid
+		if cachedResp, ok := cc.checkDuplicate(req); ok {
+			cc.trace(trace.DuplicateDropped, req, 0, 0)
+			if codes.IsRequest(req.Code()) {
+				cc.addDuplicate(DuplicateRequest, req)
+			} else {
+				cc.addDuplicate(DuplicateResponse, req)
+			}
 			defer pool.ReleaseMessage(w.response)
 			if !req.IsHijacked() {
 				defer pool.ReleaseMessage(req)
 			}
+			if len(cachedResp) == 0 {
+				// the response isn't known or it was suppressed so only the duplicate confirmable request is acknowledged
+				if req.Type() != udpMessage.Confirmable {
+					return
+				}
+				w.response.Reset()
+				w.response.SetCode(codes.Empty)
+			} else if _, err := w.response.Unmarshal(cachedResp); err != nil {
+				cc.Close()
+				cc.errors(fmt.Errorf("cannot unmarshal response from cache: %w", err))
+				return
+			}
 			if req.Type() == udpMessage.Confirmable {
 				w.response.SetType(udpMessage.Acknowledgement)
 				w.response.SetMessageID(reqMid)
@@ -616,22 +1109,34 @@ func (cc *ClientConn) Process(datagram []byte) error {
 				w.response.SetType(udpMessage.NonConfirmable)
 				w.response.SetMessageID(cc.getMID())
 			}
-			err = cc.session.WriteMessage(w.response)
+			err = cc.writeToSession(w.response)
 			if err != nil {
 				cc.Close()
 				cc.errors(fmt.Errorf("cannot write response: %w", err))
 				return
 			}
 			return
-		} else if err != nil {
-			cc.Close()
-			cc.errors(fmt.Errorf("cannot unmarshal response from cache: %w", err))
+		}
+
+		if !cc.unprotect(req) {
+			pool.ReleaseMessage(w.response)
+			if !req.IsHijacked() {
+				pool.ReleaseMessage(req)
+			}
 			return
 		}
 
 		reqType := req.Type()
+		if codes.IsRequest(req.Code()) {
+			// the token of a new request isn't rejected anymore
+			cc.resets.pop(req.Token())
+		}
+		obs, isObserve := observeRequest(req)
 		origResp.SetModified(false)
 		cc.handle(w, req)
+		if isObserve {
+			cc.traceObservation(cc.observers.update(obs, w.response), w.response)
+		}
 
 		defer pool.ReleaseMessage(w.response)
 		if !req.IsHijacked() {
@@ -640,13 +1145,16 @@ func (cc *ClientConn) Process(datagram []byte) error {
 
 		if w.response.IsModified() && (w.response.Type() == udpMessage.Reset || w.response.Code() == codes.Empty) {
 			// handle pong and reset message
-			if reqType == udpMessage.Confirmable {
+			if w.response.Type() == udpMessage.Reset {
+				// reset rejects the message by its message ID
+				w.response.SetMessageID(reqMid)
+			} else if reqType == udpMessage.Confirmable {
 				w.response.SetType(udpMessage.Acknowledgement)
 				w.response.SetMessageID(reqMid)
 			} else {
 				w.response.SetMessageID(cc.getMID())
 			}
-			err := cc.session.WriteMessage(w.response)
+			err := cc.writeToSession(w.response)
 			if err != nil {
 				cc.Close()
 				cc.errors(fmt.Errorf("cannot write response: %w", err))
@@ -655,12 +1163,12 @@ func (cc *ClientConn) Process(datagram []byte) error {
 			return
 		} else if reqType == udpMessage.Confirmable {
 			// send separate message to confirm received message.
-			separateMessage := pool.AcquireMessage(cc.Context())
+			separateMessage := cc.messagePool.AcquireMessage(cc.Context())
 			defer pool.ReleaseMessage(separateMessage)
 			separateMessage.SetCode(codes.Empty)
 			separateMessage.SetType(udpMessage.Acknowledgement)
 			separateMessage.SetMessageID(reqMid)
-			err := cc.session.WriteMessage(separateMessage)
+			err := cc.writeToSession(separateMessage)
 			if err != nil {
 				cc.Close()
 				cc.errors(fmt.Errorf("cannot write ack reponse: %w", err))
@@ -669,20 +1177,44 @@ func (cc *ClientConn) Process(datagram []byte) error {
 		}
 		if !w.response.IsModified() {
 			// don't send response
+			cc.storeSuppressedResponse(reqMid, w.response.Token())
+			return
+		}
+		if reqType == udpMessage.NonConfirmable && w.nonResponsePolicy == NonResponseSuppressed {
+			cc.storeSuppressedResponse(reqMid, w.response.Token())
+			return
+		}
+		if w.noResponseValue != nil && noresponse.IsSuppressed(w.response.Code(), *w.noResponseValue) {
+			// the client isn't interested in the response (RFC 7967)
+			cc.storeSuppressedResponse(reqMid, w.response.Token())
 			return
 		}
 
-		// send message with confirmation
-		w.response.SetType(udpMessage.Confirmable)
-		w.response.SetMessageID(cc.getMID())
-		err := cc.writeMessage(w.response)
+		var err error
+		if reqType == udpMessage.NonConfirmable && w.nonResponsePolicy == NonResponseNonConfirmable {
+			w.response.SetType(udpMessage.NonConfirmable)
+			w.response.SetMessageID(cc.getMID())
+			err = cc.protect(w.response)
+			if err == nil {
+				err = cc.writeToSession(w.response)
+			}
+		} else {
+			// send message with confirmation
+			w.response.SetType(udpMessage.Confirmable)
+			w.response.SetMessageID(cc.getMID())
+			err = cc.writeMessage(w.response)
+		}
+		if errors.Is(err, message.ErrMessageReset) {
+			// the peer isn't interested in the response anymore
+			return
+		}
 		if err != nil {
 			cc.Close()
 			cc.errors(fmt.Errorf("cannot write response: %w", err))
 			return
 		}
 
-		if reqType == udpMessage.Confirmable || reqType == udpMessage.NonConfirmable {
+		if !cc.reliableTransport && (reqType == udpMessage.Confirmable || reqType == udpMessage.NonConfirmable) {
 			// store message to cache
 			w.response.SetMessageID(reqMid)
 			w.response.SetType(reqType)
@@ -693,7 +1225,11 @@ func (cc *ClientConn) Process(datagram []byte) error {
 				return
 			}
 		}
-	})
+	}
+	if isControlMessage(req) && cc.controlLane.push(cc.Done(), process) {
+		return nil
+	}
+	cc.goPool(process)
 	return nil
 }
 
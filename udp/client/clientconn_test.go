@@ -8,17 +8,24 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/plgd-dev/go-coap/v2/cache"
 	"github.com/plgd-dev/go-coap/v2/mux"
 	"github.com/plgd-dev/go-coap/v2/udp"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/noresponse"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	"github.com/plgd-dev/go-coap/v2/proxy"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
@@ -192,6 +199,61 @@ func TestClientConn_DeduplicationRetransmission(t *testing.T) {
 
 }
 
+func TestClientConn_OnRetransmit(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	m.Handle("/auth", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		token, err := r.Options.GetString(message.URIQuery)
+		require.NoError(t, err)
+		if token == "token=stale" {
+			// delay the acknowledgement to trigger retransmissions
+			time.Sleep(300 * time.Millisecond)
+			err = w.SetResponse(codes.Unauthorized, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(token)))
+		require.NoError(t, err)
+	}))
+
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var retransmissions int32
+	cc, err := udp.Dial(l.LocalAddr().String(),
+		udp.WithTransmission(20*time.Millisecond, 50*time.Millisecond, 4),
+		udp.WithOnRetransmit(func(req *pool.Message, retransmission int) (bool, error) {
+			atomic.AddInt32(&retransmissions, 1)
+			if retransmission > 1 {
+				return false, nil
+			}
+			req.SetOptionString(message.URIQuery, "token=fresh")
+			return true, nil
+		}),
+	)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := cc.Get(ctx, "/auth", message.Option{ID: message.URIQuery, Value: []byte("token=stale")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, got.Code())
+	require.Equal(t, []byte("token=fresh"), bodyToBytes(t, got.Body()))
+	require.GreaterOrEqual(t, atomic.LoadInt32(&retransmissions), int32(1))
+}
+
 func TestClientConn_Get(t *testing.T) {
 	type args struct {
 		path string
@@ -694,6 +756,68 @@ func TestClientConn_Delete(t *testing.T) {
 	}
 }
 
+func TestClientConn_FetchPatch(t *testing.T) {
+	payload := make([]byte, 7000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	tests := []struct {
+		name     string
+		code     codes.Code
+		wantCode codes.Code
+		do       func(cc *client.ClientConn, ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error)
+	}{
+		{name: "fetch", code: codes.FETCH, wantCode: codes.Content, do: (*client.ClientConn).Fetch},
+		{name: "patch", code: codes.PATCH, wantCode: codes.Changed, do: (*client.ClientConn).Patch},
+		{name: "ipatch", code: codes.IPATCH, wantCode: codes.Changed, do: (*client.ClientConn).IPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := coapNet.NewListenUDP("udp", "")
+			require.NoError(t, err)
+			defer l.Close()
+			var wg sync.WaitGroup
+			defer wg.Wait()
+
+			m := mux.NewRouter()
+			m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+				assert.Equal(t, tt.code, r.Code)
+				ct, err := r.Options.GetUint32(message.ContentFormat)
+				require.NoError(t, err)
+				assert.Equal(t, message.AppCBOR, message.MediaType(ct))
+				buf, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, payload, buf)
+				// the body is echoed, so the response is sent by blocks as well
+				err = w.SetResponse(tt.wantCode, message.AppCBOR, bytes.NewReader(buf))
+				require.NoError(t, err)
+			}))
+
+			s := udp.NewServer(udp.WithMux(m))
+			defer s.Stop()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Serve(l)
+				require.NoError(t, err)
+			}()
+
+			cc, err := udp.Dial(l.LocalAddr().String())
+			require.NoError(t, err)
+			defer cc.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			got, err := tt.do(cc, ctx, "/a", message.AppCBOR, bytes.NewReader(payload))
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCode, got.Code())
+			require.Equal(t, payload, bodyToBytes(t, got.Body()))
+		})
+	}
+}
+
 func TestClientConn_Ping(t *testing.T) {
 	l, err := coapNet.NewListenUDP("udp", "")
 	require.NoError(t, err)
@@ -725,3 +849,2101 @@ func TestClientConn_Ping(t *testing.T) {
 	err = cc.Ping(ctx)
 	require.NoError(t, err)
 }
+
+func TestClientConn_ControlLane(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		wantPong bool
+	}{
+		{name: "enabled", size: client.DefaultControlLaneSize, wantPong: true},
+		{name: "disabled", size: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := coapNet.NewListenUDP("udp", "")
+			require.NoError(t, err)
+			defer l.Close()
+			var wg sync.WaitGroup
+			defer wg.Wait()
+
+			// goPool with a single worker, which is blocked by the handler
+			tasks := make(chan func(), 64)
+			block := make(chan struct{})
+			defer close(block)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case f := <-tasks:
+						f()
+					case <-block:
+						return
+					}
+				}
+			}()
+			blocked := make(chan struct{}, 1)
+
+			m := mux.NewRouter()
+			m.Handle("/block", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+				select {
+				case blocked <- struct{}{}:
+				default:
+				}
+				<-block
+			}))
+			s := udp.NewServer(udp.WithMux(m), udp.WithControlLane(tt.size), udp.WithGoPool(func(f func()) error {
+				select {
+				case tasks <- f:
+				case <-block:
+				}
+				return nil
+			}))
+			defer s.Stop()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Serve(l)
+				require.NoError(t, err)
+			}()
+
+			cc, err := udp.Dial(l.LocalAddr().String())
+			require.NoError(t, err)
+			defer cc.Close()
+
+			req, err := client.NewGetRequest(context.Background(), "/block")
+			require.NoError(t, err)
+			req.SetType(udpMessage.NonConfirmable)
+			req.SetMessageID(udpMessage.GetMID())
+			err = cc.WriteRawMessage(req)
+			require.NoError(t, err)
+			pool.ReleaseMessage(req)
+			<-blocked
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+			defer cancel()
+			err = cc.Ping(ctx)
+			if tt.wantPong {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestClientConn_DoRaw(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithRawHandler(func(cc *client.ClientConn, r *pool.Message) bool {
+		if r.Code() != codes.GET {
+			return false
+		}
+		resp := pool.AcquireMessage(r.Context())
+		defer pool.ReleaseMessage(resp)
+		resp.SetCode(codes.Content)
+		resp.SetToken(r.Token())
+		resp.SetType(udpMessage.NonConfirmable)
+		resp.SetMessageID(r.MessageID() + 1)
+		err := cc.WriteRawMessage(resp)
+		require.NoError(t, err)
+		return true
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := client.NewGetRequest(ctx, "/raw")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	req.SetType(udpMessage.NonConfirmable)
+	req.SetMessageID(42)
+	resp, err := cc.DoRaw(req)
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, udpMessage.NonConfirmable, resp.Type())
+	require.Equal(t, uint16(43), resp.MessageID())
+}
+
+func TestClientConn_ReliableTransport(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var calls uint32
+	m := mux.NewRouter()
+	err = m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		atomic.AddUint32(&calls, 1)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	require.NoError(t, err)
+
+	s := udp.NewServer(udp.WithMux(m), udp.WithReliableTransport())
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithReliableTransport())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		req, err := client.NewGetRequest(ctx, "/a")
+		require.NoError(t, err)
+		// reuse message id, it must not be deduplicated
+		req.SetMessageID(1)
+		resp, err := cc.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		pool.ReleaseMessage(resp)
+		pool.ReleaseMessage(req)
+		cancel()
+	}
+	require.Equal(t, uint32(2), atomic.LoadUint32(&calls))
+}
+
+func TestClientConn_CloseGracefully(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	deregistered := make(chan struct{})
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		opts := []message.Option{}
+		obs, err := r.Observe()
+		switch {
+		case err == nil && obs == 0:
+			opts = append(opts, message.Option{
+				ID:    message.Observe,
+				Value: []byte{2},
+			})
+		case err == nil && obs == 1:
+			close(deregistered)
+		default:
+			time.Sleep(time.Millisecond * 200)
+		}
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")), opts...)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = cc.Observe(ctx, "/obs", func(req *pool.Message) {})
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	slowErr := make(chan error, 1)
+	go func() {
+		req, err := client.NewGetRequest(ctx, "/slow")
+		require.NoError(t, err)
+		defer pool.ReleaseMessage(req)
+		close(started)
+		resp, err := cc.Do(req)
+		if err == nil {
+			pool.ReleaseMessage(resp)
+		}
+		slowErr <- err
+	}()
+	<-started
+	time.Sleep(time.Millisecond * 50)
+
+	err = cc.CloseGracefully(ctx)
+	require.NoError(t, err)
+	require.NoError(t, <-slowErr)
+	select {
+	case <-deregistered:
+	default:
+		require.FailNow(t, "observation was not canceled")
+	}
+	_, err = cc.Get(ctx, "/a")
+	require.True(t, errors.Is(err, client.ErrConnectionClosing))
+	<-cc.Done()
+}
+
+func TestClientConn_ExchangeStats(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var exchanges uint32
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithOnExchange(func(cc *client.ClientConn, e client.Exchange) {
+		atomic.AddUint32(&exchanges, 1)
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		resp, err := cc.Get(ctx, "/a")
+		require.NoError(t, err)
+		pool.ReleaseMessage(resp)
+	}
+	stats := cc.ExchangeStats()
+	require.Len(t, stats.Exchanges, 2)
+	require.Equal(t, 0, stats.Retransmits)
+	require.Equal(t, 0, stats.Timeouts)
+	require.Greater(t, int64(stats.RTO), int64(0))
+	require.Equal(t, uint32(2), atomic.LoadUint32(&exchanges))
+
+	// nobody answers on the other side
+	silent, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer silent.Close()
+	cc1, err := udp.Dial(silent.LocalAddr().String(), udp.WithTransmission(time.Millisecond, time.Millisecond*10, 2))
+	require.NoError(t, err)
+	defer cc1.Close()
+	_, err = cc1.Get(ctx, "/a")
+	require.Error(t, err)
+	stats = cc1.ExchangeStats()
+	require.Len(t, stats.Exchanges, 1)
+	require.True(t, stats.Exchanges[0].Timeout)
+	require.Equal(t, 2, stats.Retransmits)
+	require.Equal(t, time.Duration(0), stats.RTO)
+}
+
+func TestClientConn_ExchangeTimeout(t *testing.T) {
+	// nobody answers on the other side
+	silent, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer silent.Close()
+
+	cc, err := udp.Dial(silent.LocalAddr().String(), udp.WithTransmission(time.Millisecond, time.Millisecond*10, 2))
+	require.NoError(t, err)
+	defer cc.Close()
+	_, err = cc.Get(context.Background(), "/a")
+	var timeoutErr *coapNet.TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, coapNet.TimeoutRetransmission, timeoutErr.Kind)
+
+	cc1, err := udp.Dial(silent.LocalAddr().String(), udp.WithTransmission(time.Second, time.Second*2, 4),
+		udp.WithExchangeTimeout(time.Millisecond*50), udp.WithWriteTimeout(time.Second))
+	require.NoError(t, err)
+	defer cc1.Close()
+	_, err = cc1.Get(context.Background(), "/a")
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Equal(t, coapNet.TimeoutExchange, timeoutErr.Kind)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the deadline of the caller wins
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	_, err = cc1.Get(ctx, "/a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.False(t, errors.As(err, &timeoutErr))
+	require.GreaterOrEqual(t, time.Since(start), time.Millisecond*100)
+}
+
+func TestClientConn_NonResponsePolicy(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	handler := mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	})
+	m := mux.NewRouter()
+	err = m.Handle("/command", handler)
+	require.NoError(t, err)
+	err = m.Handle("/telemetry", client.NonResponsePolicyHandler(client.NonResponseNonConfirmable, handler))
+	require.NoError(t, err)
+	err = m.Handle("/silent", client.NonResponsePolicyHandler(client.NonResponseSuppressed, handler))
+	require.NoError(t, err)
+
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var typesMutex sync.Mutex
+	types := make(map[string]udpMessage.Type)
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithRawHandler(func(cc *client.ClientConn, msg *pool.Message) bool {
+		if msg.Code() == codes.Content {
+			typesMutex.Lock()
+			types[msg.Token().String()] = msg.Type()
+			typesMutex.Unlock()
+		}
+		return false
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	tests := []struct {
+		path    string
+		typ     udpMessage.Type
+		wantErr bool
+	}{
+		{path: "/command", typ: udpMessage.Confirmable},
+		{path: "/telemetry", typ: udpMessage.NonConfirmable},
+		{path: "/silent", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+			defer cancel()
+			req, err := client.NewGetRequest(ctx, tt.path)
+			require.NoError(t, err)
+			defer pool.ReleaseMessage(req)
+			req.SetType(udpMessage.NonConfirmable)
+			resp, err := cc.Do(req)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer pool.ReleaseMessage(resp)
+			require.Equal(t, codes.Content, resp.Code())
+			typesMutex.Lock()
+			defer typesMutex.Unlock()
+			require.Equal(t, tt.typ, types[req.Token().String()])
+		})
+	}
+}
+
+func TestClientConn_Pacing(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	// each request has 14 bytes
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithPacing(140, 0))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := cc.Get(ctx, "/a")
+		cancel()
+		require.NoError(t, err)
+		pool.ReleaseMessage(resp)
+	}
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*180))
+}
+
+func newOSCOREContexts(t *testing.T) (client *oscore.Context, server *oscore.Context) {
+	client, err := oscore.NewContext(oscore.Params{
+		MasterSecret: []byte("0123456789abcdef"),
+		SenderID:     []byte("c"),
+		RecipientID:  []byte("s"),
+	})
+	require.NoError(t, err)
+	server, err = oscore.NewContext(oscore.Params{
+		MasterSecret: []byte("0123456789abcdef"),
+		SenderID:     []byte("s"),
+		RecipientID:  []byte("c"),
+	})
+	require.NoError(t, err)
+	return client, server
+}
+
+func TestClientConn_OSCORE(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	big := bytes.Repeat([]byte("x"), 3000)
+	var rawTypesMutex sync.Mutex
+	var rawCodes []codes.Code
+	s := udp.NewServer(udp.WithOSCORE(serverCtx), udp.WithRawHandler(func(cc *client.ClientConn, msg *pool.Message) bool {
+		if msg.Code() == codes.Empty {
+			return false
+		}
+		rawTypesMutex.Lock()
+		defer rawTypesMutex.Unlock()
+		rawCodes = append(rawCodes, msg.Code())
+		return false
+	}), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		path, err := r.Path()
+		require.NoError(t, err)
+		switch path {
+		case "big":
+			err = w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(big))
+		default:
+			body, err := r.ReadBody()
+			require.NoError(t, err)
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(append([]byte("echo:"), body...)))
+			require.NoError(t, err)
+		}
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithOSCORE(clientCtx))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("echo:hello"), body)
+	pool.ReleaseMessage(resp)
+
+	// inner blockwise transfer
+	resp, err = cc.Get(ctx, "/big")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err = resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, big, body)
+	pool.ReleaseMessage(resp)
+
+	// the server sees only protected requests
+	rawTypesMutex.Lock()
+	require.NotEmpty(t, rawCodes)
+	for _, c := range rawCodes {
+		require.Equal(t, codes.POST, c)
+	}
+	rawTypesMutex.Unlock()
+
+	// unprotected client is rejected
+	plain, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer plain.Close()
+	resp, err = plain.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Unauthorized, resp.Code())
+	pool.ReleaseMessage(resp)
+}
+
+func TestClientConn_OSCOREObserve(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithOSCORE(serverCtx), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		obs, err := r.Observe()
+		if err != nil || obs != 0 {
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+			require.NoError(t, err)
+			return
+		}
+		cc := w.ClientConn()
+		for i := 0; i < 3; i++ {
+			n := pool.AcquireMessage(cc.Context())
+			n.SetCode(codes.Content)
+			n.SetContentFormat(message.TextPlain)
+			n.SetObserve(uint32(i) + 2)
+			n.SetBody(bytes.NewReader([]byte{byte('a' + i)}))
+			n.SetToken(r.Token())
+			err = cc.WriteMessage(n)
+			pool.ReleaseMessage(n)
+			require.NoError(t, err)
+		}
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithOSCORE(clientCtx))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	received := make(chan string, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	obs, err := cc.Observe(ctx, "/obs", func(n *pool.Message) {
+		body, err := n.ReadBody()
+		require.NoError(t, err)
+		received <- string(body)
+	})
+	require.NoError(t, err)
+	defer obs.Cancel(ctx)
+
+	// reordered notifications are dropped, but the last one is always delivered
+	for {
+		select {
+		case v := <-received:
+			if v == "c" {
+				return
+			}
+		case <-ctx.Done():
+			require.NoError(t, ctx.Err())
+		}
+	}
+}
+
+func TestClientConn_OSCOREEchoVerification(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var handled uint32
+	s := udp.NewServer(udp.WithOSCORE(serverCtx), udp.WithEchoVerification(time.Minute), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&handled, 1)
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithOSCORE(clientCtx))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// the challenged request is protected again with Echo, so it isn't rejected as a replay
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Changed, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&handled))
+}
+
+func TestClientConn_OSCORERetryAfter(t *testing.T) {
+	clientCtx, serverCtx := newOSCOREContexts(t)
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// the first request is rejected
+	var handled uint32
+	s := udp.NewServer(udp.WithOSCORE(serverCtx), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if atomic.AddUint32(&handled, 1) == 1 {
+			err := w.SetResponse(codes.ServiceUnavailable, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: []byte{}})
+			require.NoError(t, err)
+			return
+		}
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithOSCORE(clientCtx), udp.WithRetryAfter(client.RetryAfterPolicy{
+		MaxRetries: 1,
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	req, err := client.NewPostRequest(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	resp, err := cc.Do(req)
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&handled))
+	// the request isn't changed by the protected attempts
+	require.Equal(t, codes.POST, req.Code())
+	require.False(t, req.HasOption(message.OSCORE))
+	body, err = req.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+}
+
+// lossyRelay forwards datagrams between a client and the server, drop reports whether the datagram is lost.
+func lossyRelay(t *testing.T, server string, drop func(m *pool.Message) bool) (string, func()) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s, err := net.Dial("udp", server)
+	require.NoError(t, err)
+	var client atomic.Value
+	lost := func(datagram []byte) bool {
+		m := pool.AcquireMessage(context.Background())
+		defer pool.ReleaseMessage(m)
+		_, err := m.Unmarshal(datagram)
+		return err == nil && drop(m)
+	}
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := l.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			client.Store(addr)
+			if !lost(buf[:n]) {
+				_, _ = s.Write(buf[:n])
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, err := s.Read(buf)
+			if err != nil {
+				return
+			}
+			addr, ok := client.Load().(net.Addr)
+			if ok && !lost(buf[:n]) {
+				_, _ = l.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+	return l.LocalAddr().String(), func() {
+		l.Close()
+		s.Close()
+	}
+}
+
+func TestClientConn_QBlock(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	firmware := make([]byte, 64*25+10)
+	for i := range firmware {
+		firmware[i] = byte(i)
+	}
+	var stored atomic.Value
+	m := mux.NewRouter()
+	m.Handle("/fw", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		switch r.Code {
+		case codes.POST:
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			stored.Store(body)
+			err = w.SetResponse(codes.Changed, message.TextPlain, nil)
+			require.NoError(t, err)
+		case codes.GET:
+			err := w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(firmware))
+			require.NoError(t, err)
+		}
+	}))
+
+	s := udp.NewServer(udp.WithMux(m),
+		udp.WithBlockwise(true, blockwise.SZX64, 5*time.Second),
+		udp.WithBlockwiseOptions(blockwise.WithQBlock()),
+	)
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	// the first transmission of some Non-confirmable blocks is lost in both directions
+	var dropMutex sync.Mutex
+	dropped := make(map[string]bool)
+	drop := func(m *pool.Message) bool {
+		if m.Type() != udpMessage.NonConfirmable {
+			return false
+		}
+		for _, id := range []message.OptionID{message.QBlock1, message.QBlock2} {
+			block, err := m.GetOptionUint32(id)
+			if err != nil {
+				continue
+			}
+			_, num, _, err := blockwise.DecodeBlockOption(block)
+			require.NoError(t, err)
+			if num%4 != 2 {
+				return false
+			}
+			key := fmt.Sprintf("%v:%v", id, num)
+			dropMutex.Lock()
+			defer dropMutex.Unlock()
+			if dropped[key] {
+				return false
+			}
+			dropped[key] = true
+			return true
+		}
+		return false
+	}
+	relay, closeRelay := lossyRelay(t, l.LocalAddr().String(), drop)
+	defer closeRelay()
+
+	cc, err := udp.Dial(relay,
+		udp.WithBlockwise(true, blockwise.SZX64, 5*time.Second),
+		udp.WithBlockwiseOptions(blockwise.WithQBlock()),
+	)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/fw", message.AppOctets, bytes.NewReader(firmware))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, firmware, stored.Load())
+
+	resp, err = cc.Get(ctx, "/fw")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, firmware, bodyToBytes(t, resp.Body()))
+
+	dropMutex.Lock()
+	defer dropMutex.Unlock()
+	require.True(t, dropped[fmt.Sprintf("%v:%v", message.QBlock1, 2)])
+	require.True(t, dropped[fmt.Sprintf("%v:%v", message.QBlock2, 2)])
+}
+
+func TestClientConn_QBlockUnsupported(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	firmware := make([]byte, 64*25+10)
+	for i := range firmware {
+		firmware[i] = byte(i)
+	}
+	var rejected uint32
+	var stored atomic.Value
+	m := mux.NewRouter()
+	m.Handle("/fw", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		// the peer without Q-Block rejects the unrecognized critical options (RFC 7252 section 5.4.1)
+		if r.Options.HasOption(message.QBlock1) || r.Options.HasOption(message.QBlock2) {
+			atomic.AddUint32(&rejected, 1)
+			err := w.SetResponse(codes.BadOption, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		switch r.Code {
+		case codes.POST:
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			stored.Store(body)
+			err = w.SetResponse(codes.Changed, message.TextPlain, nil)
+			require.NoError(t, err)
+		case codes.GET:
+			err := w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(firmware))
+			require.NoError(t, err)
+		}
+	}))
+
+	s := udp.NewServer(udp.WithMux(m), udp.WithBlockwise(true, blockwise.SZX64, 5*time.Second))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	dial := func() *client.ClientConn {
+		cc, err := udp.Dial(l.LocalAddr().String(),
+			udp.WithBlockwise(true, blockwise.SZX64, 5*time.Second),
+			udp.WithBlockwiseOptions(blockwise.WithQBlock()),
+		)
+		require.NoError(t, err)
+		return cc
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	post := func(cc *client.ClientConn) {
+		stored.Store([]byte(nil))
+		resp, err := cc.Post(ctx, "/fw", message.AppOctets, bytes.NewReader(firmware))
+		require.NoError(t, err)
+		require.Equal(t, codes.Changed, resp.Code())
+		require.Equal(t, firmware, stored.Load())
+	}
+	get := func(cc *client.ClientConn) {
+		resp, err := cc.Get(ctx, "/fw")
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		require.Equal(t, firmware, bodyToBytes(t, resp.Body()))
+	}
+
+	// Q-Block1 is rejected once, the following requests use Block1 and Block2
+	cc := dial()
+	defer cc.Close()
+	post(cc)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&rejected))
+	get(cc)
+	post(cc)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&rejected))
+
+	// Q-Block2 is rejected once
+	cc1 := dial()
+	defer cc1.Close()
+	get(cc1)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&rejected))
+	post(cc1)
+	get(cc1)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&rejected))
+}
+
+func TestClientConn_DeferFallback(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		path, err := r.Path()
+		require.NoError(t, err)
+		sr := w.Defer(time.Millisecond*100, codes.Empty)
+		if path != "slow" {
+			go func() {
+				err := sr.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+				require.NoError(t, err)
+				err = sr.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+				require.ErrorIs(t, err, client.ErrSeparateResponseSent)
+			}()
+		}
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	pool.ReleaseMessage(resp)
+
+	// the handler forgot to respond
+	resp, err = cc.Get(ctx, "/slow")
+	require.NoError(t, err)
+	require.Equal(t, codes.GatewayTimeout, resp.Code())
+	pool.ReleaseMessage(resp)
+}
+
+func TestClientConn_DeferRespond(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// results of both responses of the handler
+	responded := make(chan error, 2)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		sr := w.Defer(time.Second*5, codes.Empty)
+		cc := w.ClientConn()
+		// the handler returns, so the request is acknowledged by an empty message
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			resp := pool.AcquireMessage(cc.Context())
+			defer pool.ReleaseMessage(resp)
+			resp.SetCode(codes.Content)
+			resp.SetContentFormat(message.TextPlain)
+			resp.SetBody(bytes.NewReader([]byte("done")))
+			responded <- sr.Respond(resp)
+			responded <- sr.Respond(resp)
+		}()
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, []byte("done"), bodyToBytes(t, resp.Body()))
+	pool.ReleaseMessage(resp)
+
+	// the client is still open, so the separate response is acknowledged
+	require.NoError(t, <-responded)
+	require.ErrorIs(t, <-responded, client.ErrSeparateResponseSent)
+}
+
+func TestClientConn_DeferGracefulClose(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	closed := make(chan error, 1)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		sr := w.Defer(time.Second*5, codes.Empty)
+		cc := w.ClientConn()
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			closed <- cc.CloseGracefully(ctx)
+		}()
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			select {
+			case <-closed:
+				assert.Fail(t, "connection was closed before the separate response")
+			default:
+			}
+			// the pending separate response is sent even when the connection is closing
+			err := sr.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+			assert.NoError(t, err)
+		}()
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	pool.ReleaseMessage(resp)
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		require.FailNow(t, "connection wasn't closed")
+	}
+}
+
+func TestClientConn_NoResponse(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	err = m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		if err != nil {
+			require.ErrorIs(t, err, noresponse.ErrMessageNotInterested)
+		}
+	}))
+	require.NoError(t, err)
+
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	tests := []struct {
+		path       string
+		noResponse uint32
+		want       codes.Code
+	}{
+		{path: "/a", noResponse: noresponse.Suppress4xx, want: codes.Content},
+		{path: "/a", noResponse: noresponse.Suppress2xx},
+		{path: "/missing", noResponse: noresponse.Suppress2xx, want: codes.NotFound},
+		{path: "/missing", noResponse: noresponse.SuppressAll},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v-%v", tt.path, tt.noResponse), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+			defer cancel()
+			req, err := client.NewGetRequest(ctx, tt.path)
+			require.NoError(t, err)
+			defer pool.ReleaseMessage(req)
+			req.SetType(udpMessage.NonConfirmable)
+			req.SetNoResponse(tt.noResponse)
+			resp, err := cc.Do(req)
+			if tt.want == codes.Empty {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				return
+			}
+			require.NoError(t, err)
+			defer pool.ReleaseMessage(resp)
+			require.Equal(t, tt.want, resp.Code())
+		})
+	}
+}
+
+func TestClientConn_NonConfirmableRequest(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	telemetry := make(chan string, 1)
+	m := mux.NewRouter()
+	err = m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		if err != nil {
+			require.ErrorIs(t, err, noresponse.ErrMessageNotInterested)
+		}
+	}))
+	require.NoError(t, err)
+	err = m.Handle("/telemetry", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		require.False(t, r.IsConfirmable)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		telemetry <- string(body)
+		err = w.SetResponse(codes.Changed, message.TextPlain, nil)
+		require.ErrorIs(t, err, noresponse.ErrMessageNotInterested)
+	}))
+	require.NoError(t, err)
+
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := client.NewGetRequest(context.Background(), "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	resp, err := cc.NonConfirmableRequest(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	pool.ReleaseMessage(resp)
+
+	// the response is suppressed, so nothing arrives before the deadline
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Millisecond*200)
+	defer waitCancel()
+	req.SetNoResponse(noresponse.Suppress2xx)
+	_, err = cc.NonConfirmableRequest(waitCtx, req)
+	require.ErrorIs(t, err, client.ErrNoResponse)
+
+	err = cc.Notify(ctx, "/telemetry", message.TextPlain, bytes.NewReader([]byte("21.5")))
+	require.NoError(t, err)
+	require.Equal(t, "21.5", <-telemetry)
+}
+
+func TestClientConn_NStart(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer l.Close()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithTransmissionConfig(udp.TransmissionConfig{
+		AckTimeout: time.Second * 5,
+		NStart:     1,
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, path := range []string{"/a", "/b"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			resp, err := cc.Get(ctx, path)
+			require.NoError(t, err)
+			require.Equal(t, codes.Content, resp.Code())
+		}(path)
+	}
+
+	read := func(timeout time.Duration) (udpMessage.Message, *net.UDPAddr, error) {
+		buf := make([]byte, 1500)
+		err := l.SetReadDeadline(time.Now().Add(timeout))
+		require.NoError(t, err)
+		n, raddr, err := l.ReadFromUDP(buf)
+		if err != nil {
+			return udpMessage.Message{}, nil, err
+		}
+		m := udpMessage.Message{Options: make(message.Options, 0, 16)}
+		_, err = m.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		return m, raddr, nil
+	}
+	respond := func(req udpMessage.Message, raddr *net.UDPAddr) {
+		data, err := udpMessage.Message{
+			Code:      codes.Content,
+			Token:     req.Token,
+			MessageID: req.MessageID,
+			Type:      udpMessage.Acknowledgement,
+		}.Marshal()
+		require.NoError(t, err)
+		_, err = l.WriteToUDP(data, raddr)
+		require.NoError(t, err)
+	}
+
+	first, raddr, err := read(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, udpMessage.Confirmable, first.Type)
+	// the second exchange doesn't start until the first one is acknowledged
+	_, _, err = read(time.Millisecond * 300)
+	require.Error(t, err)
+	respond(first, raddr)
+	second, raddr, err := read(time.Second)
+	require.NoError(t, err)
+	require.NotEqual(t, first.MessageID, second.MessageID)
+	respond(second, raddr)
+}
+
+func TestClientConn_NonConfirmableRetry(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer l.Close()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithNonConfirmableRetry(time.Millisecond*100, 2))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	read := func() (udpMessage.Message, *net.UDPAddr) {
+		buf := make([]byte, 1500)
+		err := l.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		n, raddr, err := l.ReadFromUDP(buf)
+		require.NoError(t, err)
+		m := udpMessage.Message{Options: make(message.Options, 0, 16)}
+		_, err = m.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		return m, raddr
+	}
+	respond := func(req udpMessage.Message, raddr *net.UDPAddr, typ udpMessage.Type) {
+		data, err := udpMessage.Message{
+			Code:      codes.Content,
+			Token:     req.Token,
+			MessageID: req.MessageID,
+			Type:      typ,
+		}.Marshal()
+		require.NoError(t, err)
+		_, err = l.WriteToUDP(data, raddr)
+		require.NoError(t, err)
+	}
+	get := func(ctx context.Context) <-chan error {
+		errs := make(chan error, 1)
+		go func() {
+			resp, err := cc.Get(ctx, "/a")
+			if err == nil {
+				require.Equal(t, codes.Content, resp.Code())
+			}
+			errs <- err
+		}()
+		return errs
+	}
+
+	// the first request is lost, the retry has the same token and a new message ID
+	errs := get(context.Background())
+	first, _ := read()
+	require.Equal(t, udpMessage.NonConfirmable, first.Type)
+	second, raddr := read()
+	require.Equal(t, udpMessage.NonConfirmable, second.Type)
+	require.Equal(t, first.Token, second.Token)
+	require.NotEqual(t, first.MessageID, second.MessageID)
+	respond(second, raddr, udpMessage.NonConfirmable)
+	require.NoError(t, <-errs)
+
+	// the request overrides the connection
+	errs = get(client.WithNonConfirmableRetry(context.Background(), client.NonConfirmableRetry{}))
+	req, raddr := read()
+	require.Equal(t, udpMessage.Confirmable, req.Type)
+	respond(req, raddr, udpMessage.Acknowledgement)
+	require.NoError(t, <-errs)
+
+	// no response to the request and its retries
+	errs = get(context.Background())
+	for i := 0; i < 3; i++ {
+		req, _ := read()
+		require.Equal(t, udpMessage.NonConfirmable, req.Type)
+	}
+	require.ErrorIs(t, <-errs, client.ErrNoResponse)
+}
+
+func TestClientConn_EchoVerification(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var handled uint32
+	s := udp.NewServer(udp.WithEchoVerification(time.Minute), udp.WithBlockwise(true, blockwise.SZX16, time.Second*5), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&handled, 1)
+		if r.Code() != codes.GET {
+			_, err := r.GetOptionBytes(message.Echo)
+			require.NoError(t, err)
+		}
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithBlockwise(true, blockwise.SZX16, time.Second*5))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// safe request isn't challenged
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&handled))
+
+	// the client repeats the challenged request with Echo, the body is sent blockwise with Request-Tag
+	body := bytes.Repeat([]byte("x"), 50)
+	resp, err = cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader(body))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Changed, resp.Code())
+	respBody, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, body, respBody)
+	require.Equal(t, uint32(2), atomic.LoadUint32(&handled))
+
+	// PATCH and iPATCH change state of the server as well
+	resp, err = cc.Patch(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("p")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, uint32(3), atomic.LoadUint32(&handled))
+	resp, err = cc.IPatch(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("i")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, uint32(4), atomic.LoadUint32(&handled))
+}
+
+func TestClientConn_MessageDeadline(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	received := make(chan []byte, 3)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		received <- body
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	// the second notification waits 100ms for pacing
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithPacing(100, 0))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	send := func(body string, timeout time.Duration) error {
+		n := pool.AcquireMessage(cc.Context())
+		defer pool.ReleaseMessage(n)
+		ctx, cancel := context.WithTimeout(cc.Context(), timeout)
+		defer cancel()
+		n.SetContext(ctx)
+		n.SetCode(codes.POST)
+		n.SetType(udpMessage.NonConfirmable)
+		n.SetBody(bytes.NewReader([]byte(body)))
+		return cc.WriteMessage(n)
+	}
+	err = send("fresh", time.Second)
+	require.NoError(t, err)
+	err = send("stale", time.Millisecond*20)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	// the connection is not affected
+	require.NoError(t, cc.Context().Err())
+	err = send("next", time.Second)
+	require.NoError(t, err)
+
+	require.Equal(t, []byte("fresh"), <-received)
+	require.Equal(t, []byte("next"), <-received)
+}
+
+func TestClientConn_DuplicatePing(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	dedup := &countingDedup{Dedup: client.NewDedupCache(client.DedupConfig{})}
+	s := udp.NewServer(udp.WithDeduplication(func() client.Dedup {
+		return dedup
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	raw, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer raw.Close()
+
+	ping := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(ping)
+	ping.SetCode(codes.Empty)
+	ping.SetType(udpMessage.Confirmable)
+	ping.SetMessageID(1)
+	data, err := ping.Marshal()
+	require.NoError(t, err)
+
+	// pings aren't deduplicated
+	for i := 0; i < 2; i++ {
+		_, err = raw.Write(data)
+		require.NoError(t, err)
+		err = raw.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		buf := make([]byte, 1024)
+		n, err := raw.Read(buf)
+		require.NoError(t, err)
+		resp := pool.AcquireMessage(context.Background())
+		_, err = resp.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		require.Equal(t, udpMessage.Acknowledgement, resp.Type())
+		require.Equal(t, uint16(1), resp.MessageID())
+		pool.ReleaseMessage(resp)
+	}
+	require.Equal(t, uint32(0), atomic.LoadUint32(&dedup.checked))
+}
+
+type countingDedup struct {
+	client.Dedup
+	checked uint32
+}
+
+func (d *countingDedup) CheckAndStore(mid uint16, token message.Token) ([]byte, bool) {
+	atomic.AddUint32(&d.checked, 1)
+	return d.Dedup.CheckAndStore(mid, token)
+}
+
+func TestClientConn_NoResponseDuplicate(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stored := make(chan []byte, 1)
+	var handled uint32
+	s := udp.NewServer(udp.WithDeduplication(func() client.Dedup {
+		return &storingDedup{Dedup: client.NewDedupCache(client.DedupConfig{}), stored: stored}
+	}), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&handled, 1)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.ErrorIs(t, err, noresponse.ErrMessageNotInterested)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	raw, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer raw.Close()
+
+	req, err := client.NewGetRequest(context.Background(), "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	req.SetType(udpMessage.NonConfirmable)
+	req.SetMessageID(1)
+	req.SetNoResponse(noresponse.SuppressAll)
+	data, err := req.Marshal()
+	require.NoError(t, err)
+
+	_, err = raw.Write(data)
+	require.NoError(t, err)
+	select {
+	case resp := <-stored:
+		// suppressed response is marked by empty response
+		require.NotNil(t, resp)
+		require.Empty(t, resp)
+	case <-time.After(time.Second):
+		require.FailNow(t, "suppressed response was not stored")
+	}
+	_, err = raw.Write(data)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 100)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&handled))
+}
+
+type storingDedup struct {
+	client.Dedup
+	stored chan []byte
+}
+
+func (d *storingDedup) Store(mid uint16, token message.Token, response []byte) {
+	d.Dedup.Store(mid, token, response)
+	select {
+	case d.stored <- response:
+	default:
+	}
+}
+
+func TestClientConn_PooledResponses(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	err = m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		buf := []byte("hello")
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(buf))
+		require.NoError(t, err)
+		// the body was copied to the response
+		copy(buf, "xxxxx")
+	}))
+	require.NoError(t, err)
+
+	s := udp.NewServer(udp.WithMux(m), udp.WithPooledResponses())
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := cc.Get(ctx, "/a")
+		cancel()
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		require.Equal(t, []byte("hello"), bodyToBytes(t, resp.Body()))
+		etag, err := resp.GetOptionBytes(message.ETag)
+		require.NoError(t, err)
+		require.Equal(t, message.AppendETag(nil, []byte("hello")), etag)
+		pool.ReleaseMessage(resp)
+	}
+}
+
+func benchmarkClientConnGet(b *testing.B, opts ...udp.ServerOption) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(b, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	payload := bytes.Repeat([]byte("a"), 256)
+	m := mux.NewRouter()
+	err = m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(payload))
+		if err != nil {
+			b.Error(err)
+		}
+	}))
+	require.NoError(b, err)
+
+	s := udp.NewServer(append([]udp.ServerOption{udp.WithMux(m)}, opts...)...)
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(b, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(b, err)
+	defer cc.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := cc.Get(context.Background(), "/a")
+		if err != nil {
+			b.Fatal(err)
+		}
+		pool.ReleaseMessage(resp)
+	}
+}
+
+func BenchmarkClientConn_Get(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		benchmarkClientConnGet(b)
+	})
+	b.Run("pooledResponses", func(b *testing.B) {
+		benchmarkClientConnGet(b, udp.WithPooledResponses())
+	})
+}
+
+func TestClientConn_Cache(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var requests int32
+	etags := make(chan []byte, 4)
+	m := mux.NewRouter()
+	m.Handle("/fresh", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		atomic.AddInt32(&requests, 1)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("fresh")), message.Option{ID: message.MaxAge, Value: []byte{60}})
+		require.NoError(t, err)
+	}))
+	m.Handle("/stale", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		atomic.AddInt32(&requests, 1)
+		etag, err := r.Options.GetBytes(message.ETag)
+		etags <- etag
+		if err == nil && bytes.Equal(etag, []byte("v1")) {
+			err = w.SetResponse(codes.Valid, message.TextPlain, nil, message.Option{ID: message.ETag, Value: []byte("v1")}, message.Option{ID: message.MaxAge, Value: []byte{}})
+			require.NoError(t, err)
+			return
+		}
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("stale")), message.Option{ID: message.ETag, Value: []byte("v1")}, message.Option{ID: message.MaxAge, Value: []byte{}})
+		require.NoError(t, err)
+	}))
+
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithCache(cache.NewMemoryStore(16)))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	get := func(path string) (codes.Code, []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		resp, err := cc.Get(ctx, path)
+		require.NoError(t, err)
+		defer pool.ReleaseMessage(resp)
+		return resp.Code(), bodyToBytes(t, resp.Body())
+	}
+
+	// the fresh response is answered from the cache
+	for i := 0; i < 3; i++ {
+		code, body := get("/fresh")
+		require.Equal(t, codes.Content, code)
+		require.Equal(t, []byte("fresh"), body)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// the stale response is revalidated by its ETag
+	for i := 0; i < 2; i++ {
+		code, body := get("/stale")
+		require.Equal(t, codes.Content, code)
+		require.Equal(t, []byte("stale"), body)
+	}
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	require.Nil(t, <-etags)
+	require.Equal(t, []byte("v1"), <-etags)
+}
+
+func TestClientConn_URIAuthority(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	type authority struct {
+		host string
+		port uint32
+	}
+	authorities := make(chan authority, 1)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		var a authority
+		a.host, _ = r.Options().GetString(message.URIHost)
+		a.port, _ = r.Options().GetUint32(message.URIPort)
+		authorities <- a
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+	_, port, err := net.SplitHostPort(l.LocalAddr().String())
+	require.NoError(t, err)
+
+	get := func(target string, opts ...udp.DialOption) authority {
+		cc, err := udp.Dial(target, append(opts, udp.WithNetwork("udp4"))...)
+		require.NoError(t, err)
+		defer cc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		resp, err := cc.Get(ctx, "/a")
+		require.NoError(t, err)
+		pool.ReleaseMessage(resp)
+		return <-authorities
+	}
+
+	// the name of the server is stamped, the port is the port of the server
+	require.Equal(t, authority{host: "localhost"}, get("LocalHost:"+port, udp.WithURIAuthority("")))
+	// IP literal of the server is omitted
+	require.Equal(t, authority{}, get("127.0.0.1:"+port, udp.WithURIAuthority("")))
+	// origin server behind the proxy
+	require.Equal(t, authority{host: "example.com", port: 5683}, get("127.0.0.1:"+port, udp.WithURIAuthority("example.com:5683")))
+	require.Equal(t, authority{host: "[::1]"}, get("127.0.0.1:"+port, udp.WithURIAuthority("::1")))
+	// nothing is stamped without the option
+	require.Equal(t, authority{}, get("localhost:"+port))
+}
+
+type countingTokenManager struct {
+	message.TokenManager
+	outstanding int32
+}
+
+func (m *countingTokenManager) NewToken() (message.Token, error) {
+	token, err := m.TokenManager.NewToken()
+	if err == nil {
+		atomic.AddInt32(&m.outstanding, 1)
+	}
+	return token, err
+}
+
+func (m *countingTokenManager) Release(token message.Token) {
+	atomic.AddInt32(&m.outstanding, -1)
+	m.TokenManager.Release(token)
+}
+
+func TestClientConn_TokenManager(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	tokens := make(chan message.Token, 4)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		tokens <- r.Token()
+		var opts []message.Option
+		if obs, err := r.Observe(); err == nil && obs == 0 {
+			opts = append(opts, message.Option{ID: message.Observe, Value: []byte{2}})
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, nil, opts...)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	m := &countingTokenManager{TokenManager: message.NewTokenManager(4)}
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithTokenManager(m))
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+	require.Len(t, <-tokens, 4)
+	require.Equal(t, int32(0), atomic.LoadInt32(&m.outstanding))
+
+	// the token of the observation is held until it is canceled
+	obs, err := cc.Observe(ctx, "/a", func(*pool.Message) {})
+	require.NoError(t, err)
+	token := <-tokens
+	require.Len(t, token, 4)
+	require.Equal(t, int32(1), atomic.LoadInt32(&m.outstanding))
+	require.NoError(t, obs.Cancel(ctx))
+	require.Equal(t, token, <-tokens)
+	require.Equal(t, int32(0), atomic.LoadInt32(&m.outstanding))
+}
+
+func TestClientConn_LongPoll(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	lp := client.NewLongPoll(time.Millisecond * 100)
+	var polls int32
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddInt32(&polls, 1)
+		lp.Wait(w)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	data := make(chan string, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := cc.LongPoll(ctx, "/data", time.Millisecond*100)
+		require.NoError(t, err)
+		defer pool.ReleaseMessage(resp)
+		require.Equal(t, codes.Content, resp.Code())
+		payload, err := resp.ReadBody()
+		require.NoError(t, err)
+		data <- string(payload)
+	}()
+
+	// the parked request times out by 2.03 Valid and the client polls again
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&polls) >= 2 && lp.Len() == 1
+	}, time.Second*3, time.Millisecond*10)
+	require.Equal(t, 1, lp.Publish(codes.Content, message.TextPlain, []byte("hello")))
+	require.Equal(t, "hello", <-data)
+	require.Equal(t, 0, lp.Len())
+
+	// request without a long-poll client gets 2.03 Valid after the timeout
+	resp, err := cc.Get(ctx, "/data")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Valid, resp.Code())
+}
+
+func TestClientConn_Proxy(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	var m sync.Mutex
+	targets := make(map[string]bool)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		target, err := proxy.TargetURI(r.Options())
+		require.NoError(t, err)
+		m.Lock()
+		targets[target.String()] = true
+		m.Unlock()
+		var opts message.Options
+		if obs, err := r.Observe(); err == nil && obs == 0 {
+			opts = append(opts, message.Option{ID: message.Observe, Value: []byte{2}})
+		}
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(body), opts...)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var sent []message.Options
+	cc, err := udp.Dial("Example.com:5684", udp.WithProxy(l.LocalAddr().String(), ""), udp.WithNetwork("udp4"),
+		udp.WithBlockwise(true, blockwise.SZX256, time.Second*5),
+		udp.WithTrace(func(e trace.Event) {
+			if e.Type == trace.MessageSent && codes.IsRequest(e.Message.Code()) {
+				opts, err := e.Message.Options().Clone()
+				require.NoError(t, err)
+				m.Lock()
+				defer m.Unlock()
+				sent = append(sent, opts)
+			}
+		}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	resp, err := cc.Get(ctx, "/a", message.Option{ID: message.URIQuery, Value: []byte("x=1")})
+	require.NoError(t, err)
+	got, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, body, got)
+	m.Lock()
+	require.True(t, targets["coap://example.com:5684/a?x=1"])
+	// the response is transferred in blocks, every block is requested via the proxy
+	require.Greater(t, len(sent), 1)
+	for _, opts := range sent {
+		scheme, err := opts.GetString(message.ProxyScheme)
+		require.NoError(t, err)
+		require.Equal(t, "coap", scheme)
+		host, err := opts.GetString(message.URIHost)
+		require.NoError(t, err)
+		require.Equal(t, "example.com", host)
+	}
+	m.Unlock()
+
+	notifications := make(chan []byte, 1)
+	obs, err := cc.Observe(ctx, "/obs", func(n *pool.Message) {
+		b, err := n.ReadBody()
+		require.NoError(t, err)
+		select {
+		case notifications <- b:
+		default:
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, body, <-notifications)
+	m.Lock()
+	require.True(t, targets["coap://example.com:5684/obs"])
+	m.Unlock()
+	err = obs.Cancel(ctx)
+	require.NoError(t, err)
+}
+
+func TestClientConn_RetryAfter(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// every odd request of a path is rejected, /slow rejects all requests for a second
+	var handled sync.Map
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		path, err := r.Path()
+		require.NoError(t, err)
+		if path == "slow" {
+			err = w.SetResponse(codes.ServiceUnavailable, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: []byte{1}})
+			require.NoError(t, err)
+			return
+		}
+		v, _ := handled.LoadOrStore(path, new(uint32))
+		if atomic.AddUint32(v.(*uint32), 1)%2 == 1 {
+			err = w.SetResponse(codes.TooManyRequests, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: []byte{}})
+			require.NoError(t, err)
+			return
+		}
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// by default the rejection is returned
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.TooManyRequests, resp.Code())
+	pool.ReleaseMessage(resp)
+
+	cc, err = udp.Dial(l.LocalAddr().String(), udp.WithRetryAfter(client.RetryAfterPolicy{
+		MaxRetries: 1,
+		MaxDelay:   time.Millisecond * 500,
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+	resp, err = cc.Get(ctx, "/b")
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	pool.ReleaseMessage(resp)
+	// the body is sent again
+	resp, err = cc.Post(ctx, "/c", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+	pool.ReleaseMessage(resp)
+
+	// Max-Age over MaxDelay isn't waited for
+	start := time.Now()
+	resp, err = cc.Get(ctx, "/slow")
+	require.NoError(t, err)
+	require.Equal(t, codes.ServiceUnavailable, resp.Code())
+	require.Less(t, time.Since(start), time.Millisecond*500)
+	pool.ReleaseMessage(resp)
+}
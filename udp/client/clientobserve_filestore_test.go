@@ -0,0 +1,111 @@
+//go:build !tinygo
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConn_RestoreObservations(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if r.Code() != codes.GET {
+			return
+		}
+		opts := []message.Option{}
+		if obs, err := r.Observe(); err == nil && obs == 0 {
+			opts = append(opts, message.Option{
+				ID:    message.Observe,
+				Value: []byte{2},
+			})
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")), opts...)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	dir, err := ioutil.TempDir("", "observation")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := observation.NewFileStore(filepath.Join(dir, "observations.json"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithObservationStore(store))
+	require.NoError(t, err)
+	_, err = cc.Observe(ctx, "/a", func(req *pool.Message) {}, message.Option{
+		ID:    message.URIQuery,
+		Value: []byte("q=1"),
+	})
+	require.NoError(t, err)
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "/a", records[0].Path)
+	require.Equal(t, uint32(2), records[0].Sequence)
+	oldToken := records[0].Token
+	// connection is lost without canceling observation
+	err = cc.Close()
+	require.NoError(t, err)
+
+	cc, err = udp.Dial(l.LocalAddr().String(), udp.WithObservationStore(store))
+	require.NoError(t, err)
+	defer cc.Close()
+	notified := make(chan observation.Record, 1)
+	restored, err := cc.RestoreObservations(ctx, func(record observation.Record) func(req *pool.Message) {
+		return func(req *pool.Message) {
+			select {
+			case notified <- record:
+			default:
+			}
+		}
+	})
+	require.NoError(t, err)
+	require.Len(t, restored, 1)
+	select {
+	case record := <-notified:
+		require.Equal(t, "/a", record.Path)
+	case <-ctx.Done():
+		require.FailNow(t, "restored observation was not notified")
+	}
+	records, err = store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.NotEqual(t, oldToken, records[0].Token)
+	require.Equal(t, message.Options{{ID: message.URIQuery, Value: []byte("q=1")}}, records[0].Options)
+
+	err = restored[0].Cancel(ctx)
+	require.NoError(t, err)
+	records, err = store.Load()
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
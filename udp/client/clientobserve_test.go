@@ -3,6 +3,7 @@ package client_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -177,3 +178,239 @@ func (o *observer) observe(req *pool.Message) {
 		}
 	}
 }
+
+func TestObservation_SetStaleHandler(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if r.Code() != codes.GET {
+			return
+		}
+		if _, err := r.Observe(); err != nil {
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("refreshed")))
+			require.NoError(t, err)
+			return
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("observed")), message.Option{
+			ID:    message.Observe,
+			Value: []byte{2},
+		}, message.Option{
+			ID:    message.MaxAge,
+			Value: []byte{1},
+		})
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	bodies := make(chan string, 4)
+	got, err := cc.Observe(ctx, "/a", func(r *pool.Message) {
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		bodies <- string(body)
+	})
+	require.NoError(t, err)
+	stale := make(chan struct{}, 1)
+	got.SetStaleHandler(func(o *client.Observation) {
+		require.Equal(t, got, o)
+		stale <- struct{}{}
+	}, true)
+
+	require.Equal(t, "observed", <-bodies)
+	select {
+	case <-stale:
+	case <-ctx.Done():
+		require.FailNow(t, "observation was not reported as stale")
+	}
+	select {
+	case body := <-bodies:
+		require.Equal(t, "refreshed", body)
+	case <-ctx.Done():
+		require.FailNow(t, "stale observation was not refreshed")
+	}
+	err = got.Cancel(ctx)
+	require.NoError(t, err)
+}
+
+func TestClientConn_ObserveRecovery(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var registrations int
+	var registrationsMutex sync.Mutex
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if r.Code() != codes.GET {
+			return
+		}
+		obs, err := r.Observe()
+		if err != nil || obs != 0 {
+			err := w.SetResponse(codes.Content, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		registrationsMutex.Lock()
+		registrations++
+		n := registrations
+		registrationsMutex.Unlock()
+		if n > 1 {
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("reregistered")), message.Option{
+				ID:    message.Observe,
+				Value: []byte{3},
+			})
+			require.NoError(t, err)
+			return
+		}
+		cc := w.ClientConn()
+		token := r.Token()
+		// the last notification is reordered
+		for _, seq := range []uint32{2, 5, 4} {
+			req := pool.AcquireMessage(cc.Context())
+			req.SetCode(codes.Content)
+			req.SetContentFormat(message.TextPlain)
+			req.SetObserve(seq)
+			req.SetOptionUint32(message.MaxAge, 1)
+			req.SetBody(bytes.NewReader([]byte(fmt.Sprintf("%v", seq))))
+			req.SetToken(token)
+			err = cc.WriteMessage(req)
+			pool.ReleaseMessage(req)
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond * 100)
+		}
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	gaps := make(chan client.ObserveGap, 4)
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithObserveRecovery(client.ObserveRecovery{
+		ReregisterOnStale: true,
+		OnGap: func(o *client.Observation, gap client.ObserveGap) {
+			gaps <- gap
+		},
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	bodies := make(chan string, 4)
+	got, err := cc.Observe(ctx, "/a", func(r *pool.Message) {
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		bodies <- string(body)
+	})
+	require.NoError(t, err)
+
+	for _, want := range []string{"2", "5", "reregistered"} {
+		select {
+		case body := <-bodies:
+			require.Equal(t, want, body)
+		case <-ctx.Done():
+			require.FailNow(t, "notification was not received", want)
+		}
+	}
+	// the jump from 2 to 5 is allowed by RFC 7641 section 4.4
+	require.Equal(t, client.ObserveGap{Last: 5, Received: 4, Reordered: true}, <-gaps)
+	registrationsMutex.Lock()
+	require.Equal(t, 2, registrations)
+	registrationsMutex.Unlock()
+	err = got.Cancel(ctx)
+	require.NoError(t, err)
+}
+
+func TestClientConn_ObserveTooManyRequests(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// the first and the third registration are rejected
+	registrations := make(chan time.Time, 8)
+	var n int
+	var nMutex sync.Mutex
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if obs, err := r.Observe(); r.Code() != codes.GET || err != nil || obs != 0 {
+			return
+		}
+		registrations <- time.Now()
+		nMutex.Lock()
+		n++
+		seq := n
+		nMutex.Unlock()
+		if seq%2 == 1 {
+			err := w.SetResponse(codes.TooManyRequests, message.TextPlain, nil, message.Option{
+				ID:    message.MaxAge,
+				Value: []byte{1},
+			})
+			require.NoError(t, err)
+			return
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")), message.Option{
+			ID:    message.Observe,
+			Value: []byte{byte(seq)},
+		}, message.Option{
+			ID:    message.MaxAge,
+			Value: []byte{1},
+		})
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithObserveRecovery(client.ObserveRecovery{
+		ReregisterOnStale: true,
+		RetryInterval:     time.Millisecond * 10,
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	_, err = cc.Observe(ctx, "/a", func(r *pool.Message) {})
+	var errRetry *client.RetryAfterError
+	require.ErrorAs(t, err, &errRetry)
+	require.Equal(t, codes.TooManyRequests, errRetry.Code)
+	require.Equal(t, time.Second, errRetry.RetryAfter)
+	<-registrations
+
+	got, err := cc.Observe(ctx, "/a", func(r *pool.Message) {})
+	require.NoError(t, err)
+	<-registrations
+	// the stale observation is re-registered, the rejection is retried after its Max-Age instead of RetryInterval
+	rejected := <-registrations
+	retried := <-registrations
+	require.GreaterOrEqual(t, retried.Sub(rejected), time.Millisecond*900)
+	err = got.Cancel(ctx)
+	require.NoError(t, err)
+}
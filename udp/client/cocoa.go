@@ -0,0 +1,141 @@
+package client
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	cocoaInitialRTO = 2 * time.Second
+	cocoaMaxRTO     = 60 * time.Second
+)
+
+// CoCoA adapts retransmission timeout to the remote endpoint by CoAP Simple Congestion Control/Advanced
+// (draft-ietf-core-cocoa).
+//
+// The strong estimator measures RTT of exchanges without retransmission, the weak estimator measures RTT
+// from the first transmission of exchanges with one or two retransmissions. The overall RTO is their blend,
+// it is dithered for a new message and backed off by a factor which depends on it.
+type CoCoA struct {
+	mutex         sync.Mutex
+	maxRetransmit int
+	strong        rttEstimator
+	weak          rttEstimator
+	rto           time.Duration
+	updated       time.Time
+	now           func() time.Time
+	random        func() float64
+}
+
+type rttEstimator struct {
+	k      time.Duration
+	srtt   time.Duration
+	rttvar time.Duration
+	hasRTT bool
+}
+
+// update returns RTO of the estimator after the RTT sample (RFC 6298).
+func (e *rttEstimator) update(rtt time.Duration) time.Duration {
+	if !e.hasRTT {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.hasRTT = true
+	} else {
+		delta := e.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar = (3*e.rttvar + delta) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+	return e.srtt + e.k*e.rttvar
+}
+
+// NewCoCoA creates CoCoA which retransmits a message at most maxRetransmit times.
+func NewCoCoA(maxRetransmit int) *CoCoA {
+	return &CoCoA{
+		maxRetransmit: maxRetransmit,
+		strong:        rttEstimator{k: 4},
+		weak:          rttEstimator{k: 1},
+		rto:           cocoaInitialRTO,
+		now:           time.Now,
+		random:        rand.Float64,
+	}
+}
+
+// RTO returns the overall retransmission timeout.
+func (c *CoCoA) RTO() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.age()
+	return c.rto
+}
+
+// age moves RTO which was not updated for a long time toward the initial RTO.
+func (c *CoCoA) age() {
+	if c.updated.IsZero() {
+		return
+	}
+	now := c.now()
+	switch {
+	case c.rto < time.Second && now.Sub(c.updated) > 16*c.rto:
+		c.rto = (time.Second + 2*c.rto) / 3
+		c.updated = now
+	case c.rto > 3*time.Second && now.Sub(c.updated) > 4*c.rto:
+		c.rto = (cocoaInitialRTO + c.rto) / 2
+		c.updated = now
+	}
+}
+
+// backoff returns variable backoff factor of RTO.
+func backoff(rto time.Duration) float64 {
+	switch {
+	case rto < time.Second:
+		return 3
+	case rto > 3*time.Second:
+		return 1.5
+	}
+	return 2
+}
+
+// RetransmissionTimeouts returns dithered RTO backed off by the variable backoff factor.
+func (c *CoCoA) RetransmissionTimeouts() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.age()
+	n := c.maxRetransmit
+	if n < 0 {
+		n = 0
+	}
+	timeouts := make([]time.Duration, n)
+	timeout := time.Duration(float64(c.rto) * (1 + c.random()/2))
+	factor := backoff(c.rto)
+	for i := range timeouts {
+		if timeout > cocoaMaxRTO {
+			timeout = cocoaMaxRTO
+		}
+		timeouts[i] = timeout
+		timeout = time.Duration(float64(timeout) * factor)
+	}
+	return timeouts
+}
+
+// OnExchange updates the estimators by RTT of the exchange.
+func (c *CoCoA) OnExchange(e Exchange) {
+	if e.Timeout || e.Retransmits > 2 {
+		// RTT is not measured or it is too ambiguous
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e.Retransmits == 0 {
+		c.rto = (c.rto + c.strong.update(e.RTT)) / 2
+	} else {
+		c.rto = (3*c.rto + c.weak.update(e.RTT)) / 4
+	}
+	if c.rto > cocoaMaxRTO {
+		c.rto = cocoaMaxRTO
+	}
+	c.updated = c.now()
+}
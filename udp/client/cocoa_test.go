@@ -0,0 +1,53 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	atomicTypes "go.uber.org/atomic"
+)
+
+func TestTransmission_RetransmissionTimeouts(t *testing.T) {
+	tr := &Transmission{
+		atomicTypes.NewDuration(time.Second),
+		atomicTypes.NewDuration(time.Second * 2),
+		atomicTypes.NewInt32(2),
+	}
+	require.Equal(t, []time.Duration{time.Second * 3, time.Second * 3}, tr.RetransmissionTimeouts())
+	tr.SetTransmissionMaxRetransmit(0)
+	require.Empty(t, tr.RetransmissionTimeouts())
+}
+
+func TestCoCoA(t *testing.T) {
+	now := time.Now()
+	c := NewCoCoA(4)
+	c.random = func() float64 { return 0 }
+	c.now = func() time.Time { return now }
+	require.Equal(t, []time.Duration{time.Second * 2, time.Second * 4, time.Second * 8, time.Second * 16}, c.RetransmissionTimeouts())
+
+	// strong estimator
+	c.OnExchange(Exchange{RTT: time.Millisecond * 100})
+	require.Equal(t, time.Millisecond*1150, c.RTO())
+	require.Equal(t, []time.Duration{time.Millisecond * 1150, time.Millisecond * 2300, time.Millisecond * 4600, time.Millisecond * 9200}, c.RetransmissionTimeouts())
+	c.OnExchange(Exchange{RTT: time.Millisecond * 100})
+	require.Equal(t, time.Millisecond*700, c.RTO())
+	// small RTO is backed off faster
+	require.Equal(t, []time.Duration{time.Millisecond * 700, time.Millisecond * 2100, time.Millisecond * 6300, time.Millisecond * 18900}, c.RetransmissionTimeouts())
+
+	// weak estimator
+	c.OnExchange(Exchange{RTT: time.Second, Retransmits: 1})
+	require.Equal(t, time.Millisecond*900, c.RTO())
+	// ambiguous exchanges are ignored
+	c.OnExchange(Exchange{RTT: time.Second * 10, Retransmits: 3})
+	c.OnExchange(Exchange{Retransmits: 4, Timeout: true})
+	require.Equal(t, time.Millisecond*900, c.RTO())
+
+	// dithering
+	c.random = func() float64 { return 1 }
+	require.Equal(t, time.Millisecond*1350, c.RetransmissionTimeouts()[0])
+
+	// aging of small RTO
+	now = now.Add(time.Millisecond*900*16 + 1)
+	require.Equal(t, (time.Second+time.Millisecond*1800)/3, c.RTO())
+}
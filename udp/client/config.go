@@ -0,0 +1,84 @@
+package client
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// Config holds settings of ClientConn, which are set by options of udp and dtls. Zero values disable
+// the feature or mean its default.
+type Config struct {
+	// TransmissionNStart, TransmissionAcknowledgeTimeout and TransmissionMaxRetransmit are transmission
+	// parameters of confirmable messages (RFC 7252 section 4.8).
+	TransmissionNStart             time.Duration
+	TransmissionAcknowledgeTimeout time.Duration
+	TransmissionMaxRetransmit      int
+	// NewTransmissionParams creates transmission parameters of the connection instead of the fixed ones.
+	NewTransmissionParams NewTransmissionParamsFunc
+	// Handler handles requests of the peer.
+	Handler HandlerFunc
+	// BlockwiseSZX is size of blocks sent by BlockWise, BlockWise is nil when blockwise transfers are disabled.
+	BlockwiseSZX blockwise.SZX
+	BlockWise    *blockwise.BlockWise
+	// GoPool runs handlers, Errors reports errors of the connection.
+	GoPool GoPoolFunc
+	Errors ErrorFunc
+	// MIDGenerator generates message IDs, by default sequentially from a random one.
+	MIDGenerator MIDGenerator
+	// ActivityMonitor is notified about received messages.
+	ActivityMonitor Notifier
+	// RawHandler processes received messages before the message layer.
+	RawHandler RawHandlerFunc
+	// ReliableTransport disables retransmissions and deduplication, e.g. over a reliable transport.
+	ReliableTransport bool
+	// ObservationStore keeps records of observations of the client.
+	ObservationStore observation.Store
+	// OnExchange and OnDuplicate are called with statistics of exchanges and dropped duplicates.
+	OnExchange  ExchangeFunc
+	OnDuplicate DuplicateFunc
+	// NonResponsePolicy suppresses responses of the handler.
+	NonResponsePolicy NonResponsePolicy
+	// Pacing bounds the rate of sent messages.
+	Pacing Pacing
+	// OSCOREContext protects messages by OSCORE (RFC 8613).
+	OSCOREContext *oscore.Context
+	// ObserveRecovery keeps observations alive.
+	ObserveRecovery ObserveRecovery
+	// ControlLaneSize is capacity of the lane of acknowledgements and resets.
+	ControlLaneSize int
+	// OnRetransmit is called on retransmission of a confirmable message.
+	OnRetransmit RetransmitFunc
+	// TraceHandler gets events of the connection.
+	TraceHandler TraceHandler
+	// NewDedup creates deduplication of received messages, by default DedupCache.
+	NewDedup NewDedupFunc
+	// PooledResponses returns responses to handlers of requests from the message pool.
+	PooledResponses bool
+	// ResponseCache caches responses of GET requests.
+	ResponseCache cache.Store
+	// Authority sets Uri-Host and Uri-Port options of requests.
+	Authority *Authority
+	// TokenManager issues tokens of requests, by default of message.DefaultTokenLength.
+	TokenManager message.TokenManager
+	// Backpressure bounds queued notifications of observers.
+	Backpressure Backpressure
+	// NStart limits outstanding confirmable exchanges (RFC 7252 section 4.7).
+	NStart int
+	// ParserLimits bound received messages.
+	ParserLimits message.ParserLimits
+	// NonConfirmableRetry repeats non-confirmable requests without response.
+	NonConfirmableRetry NonConfirmableRetry
+	// RetryAfter repeats requests rejected by 4.29 and 5.03 responses.
+	RetryAfter RetryAfterPolicy
+	// WriteTimeout bounds writes of messages, ExchangeTimeout bounds exchanges.
+	WriteTimeout    time.Duration
+	ExchangeTimeout time.Duration
+	// MessagePool acquires messages of the connection, nil is the package-level pool.
+	MessagePool *pool.Pool
+}
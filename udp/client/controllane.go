@@ -0,0 +1,60 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// DefaultControlLaneSize is default number of control messages queued for the control lane.
+const DefaultControlLaneSize = 16
+
+// controlLane processes control messages, e.g. pings and acknowledgements, by a dedicated go routine,
+// so they aren't starved when go routines of goPool are blocked by handlers, e.g. by synchronous Do of
+// a long blockwise transfer.
+type controlLane struct {
+	queue chan func()
+	once  sync.Once
+}
+
+func newControlLane(size int) *controlLane {
+	if size <= 0 {
+		return nil
+	}
+	return &controlLane{
+		queue: make(chan func(), size),
+	}
+}
+
+// push queues f to the lane, which runs until done is closed. It returns false when the lane is disabled or full.
+func (l *controlLane) push(done <-chan struct{}, f func()) bool {
+	if l == nil {
+		return false
+	}
+	l.once.Do(func() {
+		go l.run(done)
+	})
+	select {
+	case l.queue <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *controlLane) run(done <-chan struct{}) {
+	for {
+		select {
+		case f := <-l.queue:
+			f()
+		case <-done:
+			return
+		}
+	}
+}
+
+// isControlMessage reports whether the message is empty, so it is a ping, an acknowledgement or a reset.
+func isControlMessage(r *pool.Message) bool {
+	return r.Code() == codes.Empty && len(r.Token()) == 0 && r.Body() == nil
+}
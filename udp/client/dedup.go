@@ -0,0 +1,157 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// ExchangeLifetime is default time for which a response is kept to be sent again for a duplicate request
+// (EXCHANGE_LIFETIME, RFC 7252 section 4.8.2).
+const ExchangeLifetime = 247 * time.Second
+
+// Dedup detects duplicate requests of a connection and keeps their responses. Every ClientConn gets own instance,
+// so message IDs of different endpoints don't collide.
+type Dedup interface {
+	// CheckAndStore reports whether a request with the message ID and token was already received and returns
+	// the marshaled response stored for it, nil when the response isn't known yet. Otherwise it records the exchange
+	// and returns false.
+	CheckAndStore(mid uint16, token message.Token) (cachedResponse []byte, ok bool)
+	// Store stores the marshaled response of the exchange recorded by CheckAndStore. An empty response
+	// marks the exchange whose response was suppressed.
+	Store(mid uint16, token message.Token, response []byte)
+}
+
+// NewDedupFunc creates deduplication of a new connection.
+type NewDedupFunc = func() Dedup
+
+// EvictionPolicy determines which exchange is evicted when DedupCache is full.
+type EvictionPolicy uint8
+
+const (
+	// EvictLRU evicts the least recently used exchange, a duplicate request refreshes its exchange.
+	EvictLRU EvictionPolicy = iota
+	// EvictOldest evicts the exchange which was recorded first.
+	EvictOldest
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLRU:
+		return "LRU"
+	case EvictOldest:
+		return "Oldest"
+	}
+	return "Unknown"
+}
+
+// DedupConfig configures DedupCache.
+type DedupConfig struct {
+	// ExchangeLifetime is time for which an exchange is kept. Zero means ExchangeLifetime.
+	ExchangeLifetime time.Duration
+	// MaxEntries is maximal number of kept exchanges. Zero means unlimited.
+	MaxEntries int
+	// Eviction determines which exchange is evicted when MaxEntries is reached.
+	Eviction EvictionPolicy
+}
+
+type dedupKey struct {
+	mid   uint16
+	token string
+}
+
+type dedupEntry struct {
+	key      dedupKey
+	response []byte
+	expires  time.Time
+}
+
+// DedupCache is default implementation of Dedup bounded by time and number of entries.
+type DedupCache struct {
+	cfg       DedupConfig
+	mutex     sync.Mutex
+	entries   map[dedupKey]*list.Element
+	order     *list.List
+	lastSweep time.Time
+}
+
+// NewDedupCache creates deduplication cache.
+func NewDedupCache(cfg DedupConfig) *DedupCache {
+	if cfg.ExchangeLifetime <= 0 {
+		cfg.ExchangeLifetime = ExchangeLifetime
+	}
+	return &DedupCache{
+		cfg:       cfg,
+		entries:   make(map[dedupKey]*list.Element),
+		order:     list.New(),
+		lastSweep: time.Now(),
+	}
+}
+
+// CheckAndStore implements Dedup.
+func (c *DedupCache) CheckAndStore(mid uint16, token message.Token) ([]byte, bool) {
+	key := dedupKey{mid: mid, token: string(token)}
+	now := time.Now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*dedupEntry)
+		if now.Before(e.expires) {
+			if c.cfg.Eviction == EvictLRU {
+				c.order.MoveToFront(el)
+			}
+			return e.response, true
+		}
+		c.remove(el)
+	}
+	c.sweep(now)
+	if c.cfg.MaxEntries > 0 {
+		for c.order.Len() >= c.cfg.MaxEntries {
+			c.remove(c.order.Back())
+		}
+	}
+	c.entries[key] = c.order.PushFront(&dedupEntry{
+		key:     key,
+		expires: now.Add(c.cfg.ExchangeLifetime),
+	})
+	return nil, false
+}
+
+// Store implements Dedup.
+func (c *DedupCache) Store(mid uint16, token message.Token, response []byte) {
+	key := dedupKey{mid: mid, token: string(token)}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*dedupEntry).response = response
+	}
+}
+
+// Len returns number of kept exchanges.
+func (c *DedupCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+func (c *DedupCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*dedupEntry).key)
+}
+
+// sweep removes expired exchanges at most once per exchange lifetime.
+func (c *DedupCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.cfg.ExchangeLifetime {
+		return
+	}
+	c.lastSweep = now
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if !now.Before(el.Value.(*dedupEntry).expires) {
+			c.remove(el)
+		}
+		el = next
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupCache(t *testing.T) {
+	c := NewDedupCache(DedupConfig{})
+	_, ok := c.CheckAndStore(1, []byte("a"))
+	require.False(t, ok)
+	// response isn't known yet
+	resp, ok := c.CheckAndStore(1, []byte("a"))
+	require.True(t, ok)
+	require.Nil(t, resp)
+	c.Store(1, []byte("a"), []byte("resp"))
+	resp, ok = c.CheckAndStore(1, []byte("a"))
+	require.True(t, ok)
+	require.Equal(t, []byte("resp"), resp)
+	// other token is other exchange
+	_, ok = c.CheckAndStore(1, []byte("b"))
+	require.False(t, ok)
+	require.Equal(t, 2, c.Len())
+}
+
+func TestDedupCache_ExchangeLifetime(t *testing.T) {
+	c := NewDedupCache(DedupConfig{ExchangeLifetime: time.Millisecond * 10})
+	_, ok := c.CheckAndStore(1, nil)
+	require.False(t, ok)
+	time.Sleep(time.Millisecond * 20)
+	_, ok = c.CheckAndStore(1, nil)
+	require.False(t, ok)
+	_, ok = c.CheckAndStore(2, nil)
+	require.False(t, ok)
+	time.Sleep(time.Millisecond * 20)
+	// expired exchanges are swept
+	_, ok = c.CheckAndStore(3, nil)
+	require.False(t, ok)
+	require.Equal(t, 1, c.Len())
+}
+
+func TestDedupCache_Eviction(t *testing.T) {
+	tests := []struct {
+		eviction EvictionPolicy
+		kept     uint16
+		evicted  uint16
+	}{
+		{eviction: EvictLRU, kept: 1, evicted: 2},
+		{eviction: EvictOldest, kept: 2, evicted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.eviction.String(), func(t *testing.T) {
+			c := NewDedupCache(DedupConfig{MaxEntries: 2, Eviction: tt.eviction})
+			c.CheckAndStore(1, nil)
+			c.CheckAndStore(2, nil)
+			// duplicate refreshes exchange 1 for LRU
+			_, ok := c.CheckAndStore(1, nil)
+			require.True(t, ok)
+			c.CheckAndStore(3, nil)
+			require.Equal(t, 2, c.Len())
+			_, ok = c.CheckAndStore(tt.kept, nil)
+			require.True(t, ok)
+			_, ok = c.CheckAndStore(tt.evicted, nil)
+			require.False(t, ok)
+		})
+	}
+}
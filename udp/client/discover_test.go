@@ -0,0 +1,148 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/linkformat"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConn_Discover(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	handler := mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	})
+	m := mux.NewRouter()
+	err = m.HandleResource("/sensors/temp", handler, linkformat.Resource{
+		ResourceTypes:  []string{"temperature-c"},
+		Interfaces:     []string{"sensor"},
+		ContentFormats: []message.MediaType{message.TextPlain},
+		Observable:     true,
+	})
+	require.NoError(t, err)
+	err = m.HandleResource("sensors/light", handler, linkformat.Resource{
+		ResourceTypes: []string{"light-lux"},
+		Title:         "Light",
+	})
+	require.NoError(t, err)
+	err = m.Handle("/config", handler)
+	require.NoError(t, err)
+	err = m.HandleWellKnownCore()
+	require.NoError(t, err)
+
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resources, err := cc.Discover(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []linkformat.Resource{
+		{Href: "/config"},
+		{Href: "/sensors/light", ResourceTypes: []string{"light-lux"}, Title: "Light"},
+		{Href: "/sensors/temp", ResourceTypes: []string{"temperature-c"}, Interfaces: []string{"sensor"}, ContentFormats: []message.MediaType{message.TextPlain}, Observable: true},
+	}, resources)
+
+	resources, err = cc.Discover(ctx, "rt=light*")
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	require.Equal(t, "/sensors/light", resources[0].Href)
+
+	resources, err = cc.Discover(ctx, "if=unknown")
+	require.NoError(t, err)
+	require.Empty(t, resources)
+
+	require.NoError(t, m.HandleRemove("sensors/temp"))
+	resources, err = cc.Discover(ctx, "obs")
+	require.NoError(t, err)
+	require.Empty(t, resources)
+}
+
+func TestClientConn_DiscoverBlockwise(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	handler := mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	})
+	m := mux.NewRouter()
+	const n = 100
+	for i := 0; i < n; i++ {
+		ct := message.TextPlain
+		if i%2 == 1 {
+			ct = message.AppJSON
+		}
+		err = m.HandleResource(fmt.Sprintf("/sensors/%03d", i), handler, linkformat.Resource{
+			ResourceTypes:  []string{"temperature-c"},
+			ContentFormats: []message.MediaType{ct},
+		})
+		require.NoError(t, err)
+	}
+	err = m.HandleWellKnownCore(mux.WithBlockSize(blockwise.SZX256))
+	require.NoError(t, err)
+
+	// the listing is paginated by the handler, because the server doesn't split responses
+	s := udp.NewServer(udp.WithMux(m), udp.WithBlockwise(false, blockwise.SZX1024, time.Second))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resources, err := cc.Discover(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, resources, n)
+	require.Equal(t, "/sensors/099", resources[n-1].Href)
+
+	resources, err = cc.Discover(ctx, "ct=50")
+	require.NoError(t, err)
+	require.Len(t, resources, n/2)
+	for _, r := range resources {
+		require.Equal(t, []message.MediaType{message.AppJSON}, r.ContentFormats)
+	}
+
+	// block out of the listing
+	resp, err := cc.Get(ctx, linkformat.WellKnownCore, message.Option{ID: message.Block2, Value: []byte{0xff, 0x06}})
+	require.NoError(t, err)
+	require.Equal(t, codes.BadOption, resp.Code())
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// DuplicateKind is kind of a suppressed duplicate message.
+type DuplicateKind uint8
+
+const (
+	// DuplicateRequest is a retransmitted request which wasn't passed to the handler.
+	DuplicateRequest DuplicateKind = iota + 1
+	// DuplicateResponse is a retransmitted separate response which wasn't passed to the handler.
+	DuplicateResponse
+	// DuplicateAcknowledgement is an acknowledgement of a message which was already acknowledged.
+	DuplicateAcknowledgement
+)
+
+var duplicateKindToString = map[DuplicateKind]string{
+	DuplicateRequest:         "DuplicateRequest",
+	DuplicateResponse:        "DuplicateResponse",
+	DuplicateAcknowledgement: "DuplicateAcknowledgement",
+}
+
+func (k DuplicateKind) String() string {
+	val, ok := duplicateKindToString[k]
+	if ok {
+		return val
+	}
+	return "Unknown"
+}
+
+// DuplicateFunc is called with every duplicate message suppressed on the connection.
+type DuplicateFunc = func(cc *ClientConn, kind DuplicateKind, msg *pool.Message)
+
+// DuplicateStats counts duplicate messages of the remote endpoint suppressed on the connection. High counts
+// point to a device with broken retransmission timers flooding the network.
+type DuplicateStats struct {
+	Requests         uint64
+	Responses        uint64
+	Acknowledgements uint64
+}
+
+type duplicateStats struct {
+	requests         uint64
+	responses        uint64
+	acknowledgements uint64
+}
+
+func (s *duplicateStats) add(kind DuplicateKind) {
+	switch kind {
+	case DuplicateRequest:
+		atomic.AddUint64(&s.requests, 1)
+	case DuplicateResponse:
+		atomic.AddUint64(&s.responses, 1)
+	case DuplicateAcknowledgement:
+		atomic.AddUint64(&s.acknowledgements, 1)
+	}
+}
+
+func (s *duplicateStats) stats() DuplicateStats {
+	return DuplicateStats{
+		Requests:         atomic.LoadUint64(&s.requests),
+		Responses:        atomic.LoadUint64(&s.responses),
+		Acknowledgements: atomic.LoadUint64(&s.acknowledgements),
+	}
+}
+
+// DuplicateStats returns counts of duplicate messages of the remote endpoint suppressed since the connection
+// was created.
+func (cc *ClientConn) DuplicateStats() DuplicateStats {
+	return cc.duplicateStats.stats()
+}
+
+func (cc *ClientConn) addDuplicate(kind DuplicateKind, msg *pool.Message) {
+	cc.duplicateStats.add(kind)
+	if cc.onDuplicate != nil {
+		cc.onDuplicate(cc, kind, msg)
+	}
+}
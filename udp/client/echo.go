@@ -0,0 +1,64 @@
+package client
+
+import (
+	"bytes"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/echo"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// NewEchoVerificationHandler returns handler which challenges unsafe requests without a fresh Echo option
+// by 4.01 Unauthorized with Echo (RFC 9175 section 2.4), other requests are passed to h. Nil verifier
+// disables the verification.
+func NewEchoVerificationHandler(v *echo.Verifier, h HandlerFunc) HandlerFunc {
+	return func(w *ResponseWriter, r *pool.Message) {
+		if v == nil || !echo.IsUnsafe(r.Code()) {
+			h(w, r)
+			return
+		}
+		remoteAddr := w.ClientConn().RemoteAddr()
+		value, err := r.GetOptionBytes(message.Echo)
+		if err == nil && v.Verify(value, remoteAddr) {
+			h(w, r)
+			return
+		}
+		w.SetResponse(codes.Unauthorized, message.TextPlain, nil, message.Option{
+			ID:    message.Echo,
+			Value: v.NewValue(remoteAddr),
+		})
+	}
+}
+
+// echoChallenge returns Echo value of 4.01 Unauthorized response, which the request doesn't carry yet.
+func echoChallenge(req, resp *pool.Message) ([]byte, bool) {
+	if resp.Code() != codes.Unauthorized {
+		return nil, false
+	}
+	value, err := resp.GetOptionBytes(message.Echo)
+	if err != nil {
+		return nil, false
+	}
+	sent, err := req.GetOptionBytes(message.Echo)
+	if err == nil && bytes.Equal(sent, value) {
+		return nil, false
+	}
+	return value, true
+}
+
+// doRequestWithEcho repeats the request once with the Echo value of the server's challenge. The request is repeated
+// when the response to the previous attempt is retried after its RetryAfter.
+func (cc *ClientConn) doRequestWithEcho(req *pool.Message, repeated bool) (*pool.Message, error) {
+	resp, err := cc.doAttempt(req, repeated, nil)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := echoChallenge(req, resp)
+	if !ok {
+		return resp, nil
+	}
+	// the value is valid until the challenge is released
+	defer pool.ReleaseMessage(resp)
+	return cc.doAttempt(req, true, value)
+}
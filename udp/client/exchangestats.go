@@ -0,0 +1,115 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// exchangeHistorySize is number of recent exchanges kept per connection.
+const exchangeHistorySize = 32
+
+// Exchange is outcome of a confirmable message exchange.
+type Exchange struct {
+	// Start is time when the message was sent for the first time.
+	Start time.Time
+	// RTT is time between the first transmission and the acknowledgement. It is zero when the exchange timed out.
+	RTT time.Duration
+	// Retransmits is number of retransmissions of the message.
+	Retransmits int
+	// Timeout signals that the message was not acknowledged before retransmissions were exhausted.
+	Timeout bool
+}
+
+// ExchangeFunc is called with the outcome of every confirmable exchange.
+type ExchangeFunc = func(cc *ClientConn, e Exchange)
+
+// ExchangeStats summarizes recent exchanges with the remote endpoint.
+type ExchangeStats struct {
+	// Exchanges are recent exchanges, the oldest first.
+	Exchanges []Exchange
+	// Retransmits is number of retransmissions in recent exchanges.
+	Retransmits int
+	// Timeouts is number of recent exchanges which timed out.
+	Timeouts int
+	// SmoothedRTT is smoothed round trip time (RFC 6298) of exchanges without retransmissions.
+	SmoothedRTT time.Duration
+	// RTTVariation is round trip time variation (RFC 6298).
+	RTTVariation time.Duration
+	// RTO is retransmission timeout estimated from SmoothedRTT and RTTVariation. It is zero until the first RTT is measured.
+	RTO time.Duration
+}
+
+type exchangeStats struct {
+	mutex   sync.Mutex
+	history [exchangeHistorySize]Exchange
+	next    int
+	count   int
+	srtt    time.Duration
+	rttvar  time.Duration
+	hasRTT  bool
+}
+
+func (s *exchangeStats) add(e Exchange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.history[s.next] = e
+	s.next = (s.next + 1) % exchangeHistorySize
+	if s.count < exchangeHistorySize {
+		s.count++
+	}
+	if e.Timeout || e.Retransmits > 0 {
+		// RTT of retransmitted message is ambiguous (Karn's algorithm)
+		return
+	}
+	if !s.hasRTT {
+		s.srtt = e.RTT
+		s.rttvar = e.RTT / 2
+		s.hasRTT = true
+		return
+	}
+	delta := s.srtt - e.RTT
+	if delta < 0 {
+		delta = -delta
+	}
+	s.rttvar = (3*s.rttvar + delta) / 4
+	s.srtt = (7*s.srtt + e.RTT) / 8
+}
+
+func (s *exchangeStats) stats() ExchangeStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := ExchangeStats{
+		Exchanges: make([]Exchange, 0, s.count),
+	}
+	start := (s.next - s.count + exchangeHistorySize) % exchangeHistorySize
+	for i := 0; i < s.count; i++ {
+		e := s.history[(start+i)%exchangeHistorySize]
+		stats.Exchanges = append(stats.Exchanges, e)
+		stats.Retransmits += e.Retransmits
+		if e.Timeout {
+			stats.Timeouts++
+		}
+	}
+	if s.hasRTT {
+		stats.SmoothedRTT = s.srtt
+		stats.RTTVariation = s.rttvar
+		stats.RTO = s.srtt + 4*s.rttvar
+	}
+	return stats
+}
+
+// ExchangeStats returns statistics of recent confirmable exchanges with the remote endpoint.
+func (cc *ClientConn) ExchangeStats() ExchangeStats {
+	return cc.exchangeStats.stats()
+}
+
+func (cc *ClientConn) addExchange(e Exchange) {
+	cc.exchangeStats.add(e)
+	cc.transmissionParams.OnExchange(e)
+	if e.Timeout {
+		cc.setUnresponsive(true)
+	}
+	if cc.onExchange != nil {
+		cc.onExchange(cc, e)
+	}
+}
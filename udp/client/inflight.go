@@ -0,0 +1,56 @@
+package client
+
+import "sync"
+
+// inFlight counts requests in progress and rejects new ones once the connection is closing.
+type inFlight struct {
+	mutex   sync.Mutex
+	closing bool
+	count   int
+	drained chan struct{}
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{
+		drained: make(chan struct{}),
+	}
+}
+
+// acquire registers new request. It returns false when the connection is closing.
+func (f *inFlight) acquire() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closing {
+		return false
+	}
+	f.count++
+	return true
+}
+
+func (f *inFlight) release() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count--
+	if f.closing && f.count == 0 {
+		close(f.drained)
+	}
+}
+
+// drain rejects new requests and returns channel which is closed when all requests are finished.
+func (f *inFlight) drain() <-chan struct{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.closing {
+		f.closing = true
+		if f.count == 0 {
+			close(f.drained)
+		}
+	}
+	return f.drained
+}
+
+func (f *inFlight) len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.count
+}
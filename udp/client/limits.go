@@ -0,0 +1,66 @@
+package client
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// NewLimitsHandler returns handler which rejects requests over MaxInFlight and registrations of observations
+// over MaxObservations of the peer by 4.29 (Too Many Requests) with Max-Age, other requests are passed to h.
+// Observations are counted until they are deregistered or the connection is closed. Nil limiter disables
+// the limits.
+func NewLimitsHandler(l *limits.Limiter, h HandlerFunc) HandlerFunc {
+	return func(w *ResponseWriter, r *pool.Message) {
+		if l == nil || !codes.IsRequest(r.Code()) {
+			h(w, r)
+			return
+		}
+		cc := w.ClientConn()
+		retryAfter := l.Limits().RetryAfter
+		if !l.AcquireRequest(cc) {
+			RejectTooManyRequests(w, retryAfter)
+			return
+		}
+		defer l.ReleaseRequest(cc)
+		obs, isObserve := observeRequest(r)
+		if !isObserve {
+			h(w, r)
+			return
+		}
+		token := append(message.Token(nil), r.Token()...)
+		if obs == 0 && !l.Register(cc, token) {
+			RejectTooManyRequests(w, retryAfter)
+			return
+		}
+		h(w, r)
+		if obs != 0 || !w.response.IsModified() || !w.response.HasOption(message.Observe) || !codes.IsSuccess(w.response.Code()) {
+			l.Deregister(cc, token)
+		}
+	}
+}
+
+// RejectTooManyRequests sets 4.29 (Too Many Requests) response with Max-Age of retryAfter (RFC 8516).
+func RejectTooManyRequests(w *ResponseWriter, retryAfter time.Duration) {
+	_ = w.SetResponse(codes.TooManyRequests, message.TextPlain, nil, limits.MaxAge(retryAfter))
+}
+
+// NewRateLimitHandler returns handler which rejects requests over MessageRate of the source address by 4.29
+// (Too Many Requests) with Max-Age, e.g. for DTLS where datagrams aren't seen by the server. Nil limiter
+// disables the limit.
+func NewRateLimitHandler(l *limits.Limiter, h HandlerFunc) HandlerFunc {
+	return func(w *ResponseWriter, r *pool.Message) {
+		if l == nil || !codes.IsRequest(r.Code()) {
+			h(w, r)
+			return
+		}
+		if wait, ok := l.Allow(w.ClientConn().RemoteAddr()); !ok {
+			RejectTooManyRequests(w, wait)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// DefaultLongPollTimeout is how long a request of the long-poll resource is parked by default.
+const DefaultLongPollTimeout = time.Minute
+
+// LongPoll is a long-poll resource, a lighter alternative to observe for single-shot waits. A request is parked
+// by the handler until data are published or the timeout elapses, then it is answered by the separate response
+// (RFC 7252 section 5.2.2). Without data it is answered by 2.03 Valid without payload, so the client polls again.
+type LongPoll struct {
+	timeout time.Duration
+
+	mutex   sync.Mutex
+	waiting map[*SeparateResponse]struct{}
+}
+
+// NewLongPoll creates long-poll resource which parks requests for the timeout, zero means
+// DefaultLongPollTimeout.
+func NewLongPoll(timeout time.Duration) *LongPoll {
+	if timeout <= 0 {
+		timeout = DefaultLongPollTimeout
+	}
+	return &LongPoll{
+		timeout: timeout,
+		waiting: make(map[*SeparateResponse]struct{}),
+	}
+}
+
+// Wait parks the request served by the handler until Publish. The handler must not set the response of w.
+func (p *LongPoll) Wait(w *ResponseWriter) {
+	var s *SeparateResponse
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	s = w.deferResponse(p.timeout, codes.Valid, func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		delete(p.waiting, s)
+	})
+	p.waiting[s] = struct{}{}
+}
+
+// Publish answers all parked requests by the response and returns how many of them were answered.
+func (p *LongPoll) Publish(code codes.Code, contentFormat message.MediaType, payload []byte, opts ...message.Option) int {
+	p.mutex.Lock()
+	waiting := p.waiting
+	p.waiting = make(map[*SeparateResponse]struct{})
+	p.mutex.Unlock()
+	var n int
+	for s := range waiting {
+		var body io.ReadSeeker
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		err := s.SetResponse(code, contentFormat, body, opts...)
+		if err == nil {
+			n++
+		} else if !errors.Is(err, ErrSeparateResponseSent) {
+			s.cc.errors(err)
+		}
+	}
+	return n
+}
+
+// Len returns count of parked requests.
+func (p *LongPoll) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.waiting)
+}
+
+// maxTransmitWait is the maximal time from the first transmission of a confirmable message to the time when
+// the sender gives up on receiving an acknowledgement (MAX_TRANSMIT_WAIT, RFC 7252 section 4.8.2).
+func (cc *ClientConn) maxTransmitWait() time.Duration {
+	wait := cc.transmission.acknowledgeTimeout.Load()
+	for _, t := range cc.transmissionParams.RetransmissionTimeouts() {
+		wait += t
+	}
+	return wait
+}
+
+// LongPoll waits for data of the long-poll resource on the path by GET. The wait is the timeout of the resource,
+// each request waits for the separate response wait plus MAX_TRANSMIT_WAIT of the confirmable response. When
+// the resource answers by 2.03 Valid or the request times out, it is polled again until ctx is done.
+//
+// Caller is responsible to release the response.
+func (cc *ClientConn) LongPoll(ctx context.Context, path string, wait time.Duration, opts ...message.Option) (*pool.Message, error) {
+	if wait <= 0 {
+		wait = DefaultLongPollTimeout
+	}
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, wait+cc.maxTransmitWait())
+		resp, err := cc.Get(pollCtx, path, opts...)
+		cancel()
+		switch {
+		case err == nil && resp.Code() == codes.Valid:
+			pool.ReleaseMessage(resp)
+		case err == nil:
+			return resp, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case !errors.Is(err, context.DeadlineExceeded):
+			return nil, err
+		}
+	}
+}
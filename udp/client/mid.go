@@ -0,0 +1,115 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+)
+
+// MIDGenerator allocates message IDs of messages sent to one remote endpoint. Every ClientConn gets own instance,
+// so a gateway serving many endpoints doesn't share one sequence of message IDs between them.
+type MIDGenerator interface {
+	// NextMID returns message ID of the next message.
+	NextMID() uint16
+	// ObservePeerMID is called with message ID of each confirmable message received from the endpoint,
+	// so the generator avoids message IDs which the endpoint uses.
+	ObservePeerMID(mid uint16)
+}
+
+// NewMIDGeneratorFunc creates message ID generator of a new connection to the remote endpoint.
+type NewMIDGeneratorFunc = func(raddr net.Addr) MIDGenerator
+
+type sequentialMIDGenerator struct {
+	mid uint32
+}
+
+// NewSequentialMIDGenerator creates generator of monotonic message IDs starting at a random value, it's the default.
+func NewSequentialMIDGenerator(net.Addr) MIDGenerator {
+	return &sequentialMIDGenerator{
+		mid: uint32(udpMessage.RandMID()),
+	}
+}
+
+func (g *sequentialMIDGenerator) NextMID() uint16 {
+	return uint16(atomic.AddUint32(&g.mid, 1))
+}
+
+// ObservePeerMID moves the sequence by half of the space when message IDs of the endpoint come near, so a cached
+// response isn't sent for a message which doesn't belong to it.
+func (g *sequentialMIDGenerator) ObservePeerMID(mid uint16) {
+	if mid-uint16(atomic.LoadUint32(&g.mid)) < 0xffff/4 {
+		atomic.AddUint32(&g.mid, 0xffff/2)
+	}
+}
+
+const (
+	// randomMIDAttempts bounds random draws of an unused message ID before it is searched linearly.
+	randomMIDAttempts = 16
+)
+
+type midUse struct {
+	mid     uint16
+	expires time.Time
+}
+
+type randomMIDGenerator struct {
+	mutex sync.Mutex
+	used  map[uint16]struct{}
+	queue []midUse
+}
+
+// NewRandomMIDGenerator creates generator of unpredictable message IDs, so an off-path attacker cannot spoof
+// acknowledgements or resets of the messages. A message ID isn't reused within ExchangeLifetime.
+func NewRandomMIDGenerator(net.Addr) MIDGenerator {
+	return &randomMIDGenerator{
+		used: make(map[uint16]struct{}),
+	}
+}
+
+func (g *randomMIDGenerator) NextMID() uint16 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.expireLocked(time.Now())
+	mid := udpMessage.RandMID()
+	for i := 1; i < randomMIDAttempts && g.isUsedLocked(mid); i++ {
+		mid = udpMessage.RandMID()
+	}
+	for i := 0; i <= 0xffff && g.isUsedLocked(mid); i++ {
+		mid++
+	}
+	g.useLocked(mid)
+	return mid
+}
+
+func (g *randomMIDGenerator) ObservePeerMID(mid uint16) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.isUsedLocked(mid) {
+		g.useLocked(mid)
+	}
+}
+
+func (g *randomMIDGenerator) isUsedLocked(mid uint16) bool {
+	_, ok := g.used[mid]
+	return ok
+}
+
+func (g *randomMIDGenerator) useLocked(mid uint16) {
+	g.used[mid] = struct{}{}
+	g.queue = append(g.queue, midUse{mid: mid, expires: time.Now().Add(ExchangeLifetime)})
+}
+
+// expireLocked releases message IDs used before ExchangeLifetime.
+func (g *randomMIDGenerator) expireLocked(now time.Time) {
+	var i int
+	for i < len(g.queue) && now.After(g.queue[i].expires) {
+		delete(g.used, g.queue[i].mid)
+		i++
+	}
+	if i > 0 {
+		g.queue = append(g.queue[:0], g.queue[i:]...)
+	}
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequentialMIDGenerator(t *testing.T) {
+	g := NewSequentialMIDGenerator(nil)
+	mid := g.NextMID()
+	require.Equal(t, mid+1, g.NextMID())
+	// message IDs of the peer come near, so the sequence jumps away
+	g.ObservePeerMID(mid + 10)
+	next := g.NextMID()
+	require.Greater(t, next-mid, uint16(0xffff/4))
+}
+
+func TestRandomMIDGenerator(t *testing.T) {
+	g := NewRandomMIDGenerator(nil).(*randomMIDGenerator)
+	g.ObservePeerMID(7)
+	mids := make(map[uint16]bool)
+	for i := 0; i < 0xffff; i++ {
+		mid := g.NextMID()
+		require.False(t, mids[mid])
+		require.NotEqual(t, uint16(7), mid)
+		mids[mid] = true
+	}
+	// message IDs are released after the exchange lifetime
+	g.expireLocked(time.Now().Add(ExchangeLifetime + time.Second))
+	require.Empty(t, g.used)
+	require.Empty(t, g.queue)
+}
@@ -36,6 +36,10 @@ func (w *muxResponseWriter) SetResponse(code codes.Code, contentFormat message.M
 	return w.w.SetResponse(code, contentFormat, d, opts...)
 }
 
+func (w *muxResponseWriter) SetNonResponsePolicy(policy NonResponsePolicy) {
+	w.w.SetNonResponsePolicy(policy)
+}
+
 func (w *muxResponseWriter) Client() mux.Client {
 	return w.w.ClientConn().Client()
 }
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/noresponse"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// ErrNoResponse is returned by NonConfirmableRequest when no response arrived before ctx is done.
+var ErrNoResponse = errors.New("no response")
+
+// NonConfirmableRequest sends the request in a Non-confirmable message and returns the first response with
+// the same token. The message is neither retransmitted nor acknowledged, so the request or the response may be
+// lost; ctx, which replaces context of the request, bounds the wait, e.g. by a deadline.
+//
+// Caller is responsible to release request and response.
+func (cc *ClientConn) NonConfirmableRequest(ctx context.Context, req *pool.Message) (*pool.Message, error) {
+	req.SetType(udpMessage.NonConfirmable)
+	req.SetContext(ctx)
+	resp, err := cc.doWithToken(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNoResponse, ctx.Err())
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Notify sends POST to the path in a Non-confirmable message with No-Response option suppressing all responses
+// (RFC 7967), e.g. for telemetry. It returns once the message is written.
+//
+// If payload is nil then content format is not used.
+func (cc *ClientConn) Notify(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) error {
+	req, err := newPayloadRequest(ctx, cc.messagePool, codes.POST, path, contentFormat, payload, opts...)
+	if err != nil {
+		return fmt.Errorf("cannot create post request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	req.SetType(udpMessage.NonConfirmable)
+	req.SetOptionUint32(message.NoResponse, noresponse.SuppressAll)
+	return cc.WriteMessage(req)
+}
+
+// NonConfirmableRetry sends idempotent requests, GET and FETCH, in Non-confirmable messages instead of Confirmable
+// ones. When no response arrives within Timeout, the request is sent again with the same token and a new message
+// ID, so the first response to any of the copies finishes the exchange. It avoids waiting for acknowledgements
+// of separate responses and their backoff, e.g. for short-lived sensor queries. Zero Timeout disables it.
+type NonConfirmableRetry struct {
+	// Timeout is the time to wait for a response before the request is sent again, it doubles with every retry.
+	Timeout time.Duration
+	// MaxRetries is the maximal number of repetitions of the request.
+	MaxRetries int
+}
+
+type nonConfirmableRetryKey struct{}
+
+// WithNonConfirmableRetry returns copy of ctx which overrides NonConfirmableRetry of the connection for requests
+// sent with such context. Zero retry sends the request in a Confirmable message.
+func WithNonConfirmableRetry(ctx context.Context, retry NonConfirmableRetry) context.Context {
+	return context.WithValue(ctx, nonConfirmableRetryKey{}, retry)
+}
+
+// nonConfirmableRetryOf returns the retry of the request when it is sent in Non-confirmable messages.
+func (cc *ClientConn) nonConfirmableRetryOf(req *pool.Message) (NonConfirmableRetry, bool) {
+	if cc.reliableTransport || req.Type() != udpMessage.Confirmable {
+		return NonConfirmableRetry{}, false
+	}
+	switch req.Code() {
+	case codes.GET, codes.FETCH:
+	default:
+		return NonConfirmableRetry{}, false
+	}
+	retry := cc.nonConfirmableRetry
+	if r, ok := req.Context().Value(nonConfirmableRetryKey{}).(NonConfirmableRetry); ok {
+		retry = r
+	}
+	return retry, retry.Timeout > 0
+}
+
+// doNonConfirmable sends the request in Non-confirmable messages until a response with the token arrives
+// or the retries are exhausted.
+func (cc *ClientConn) doNonConfirmable(req *pool.Message, retry NonConfirmableRetry) (*pool.Message, error) {
+	token := req.Token()
+	if token == nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	respChan := make(chan *pool.Message, 1)
+	err := cc.tokenHandlerContainer.Insert(token, func(w *ResponseWriter, r *pool.Message) {
+		r.Hijack()
+		select {
+		case respChan <- r:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot add token handler: %w", err)
+	}
+	defer cc.tokenHandlerContainer.Pop(token)
+	req.SetType(udpMessage.NonConfirmable)
+	start := time.Now()
+	timeout := retry.Timeout
+	for i := 0; ; i++ {
+		if i > 0 {
+			req.SetMessageID(cc.getMID())
+			cc.trace(trace.Retransmit, req, i, time.Since(start))
+		}
+		err = cc.writeMessage(req)
+		if err != nil {
+			return nil, fmt.Errorf("cannot write request: %w", err)
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-cc.session.Context().Done():
+			return nil, fmt.Errorf("connection was closed: %w", cc.session.Context().Err())
+		case resp := <-respChan:
+			cc.trace(trace.ExchangeFinished, resp, 0, time.Since(start))
+			return resp, nil
+		case <-time.After(timeout):
+		}
+		if i >= retry.MaxRetries {
+			return nil, &coapNet.TimeoutError{
+				Kind: coapNet.TimeoutRetransmission,
+				Err:  fmt.Errorf("%w: retries(%v) were exhausted", ErrNoResponse, retry.MaxRetries),
+			}
+		}
+		timeout *= 2
+	}
+}
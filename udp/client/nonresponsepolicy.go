@@ -0,0 +1,44 @@
+package client
+
+import (
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+// NonResponsePolicy determines how response to a Non-confirmable request is sent.
+type NonResponsePolicy uint8
+
+const (
+	// NonResponseConfirmable sends response in a Confirmable message, which is retransmitted until it is acknowledged.
+	NonResponseConfirmable NonResponsePolicy = iota
+	// NonResponseNonConfirmable sends response in a Non-confirmable message (fire and forget).
+	NonResponseNonConfirmable
+	// NonResponseSuppressed doesn't send response at all.
+	NonResponseSuppressed
+)
+
+func (p NonResponsePolicy) String() string {
+	switch p {
+	case NonResponseConfirmable:
+		return "Confirmable"
+	case NonResponseNonConfirmable:
+		return "NonConfirmable"
+	case NonResponseSuppressed:
+		return "Suppressed"
+	}
+	return "Unknown"
+}
+
+type nonResponsePolicySetter interface {
+	SetNonResponsePolicy(policy NonResponsePolicy)
+}
+
+// NonResponsePolicyHandler returns mux handler which sets policy for responses of h to Non-confirmable requests,
+// e.g. to configure it per route of mux.Router.
+func NonResponsePolicyHandler(policy NonResponsePolicy, h mux.Handler) mux.Handler {
+	return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		if s, ok := w.(nonResponsePolicySetter); ok {
+			s.SetNonResponsePolicy(policy)
+		}
+		h.ServeCOAP(w, r)
+	})
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// maxObserveSequence is the largest value of the Observe option, which has 24 bits.
+const maxObserveSequence = 1<<24 - 1
+
+// ObserveGap describes notification which is out of order or, when consecutive sequence numbers are expected,
+// doesn't follow the previous one.
+type ObserveGap struct {
+	// Last is sequence number of the last accepted notification.
+	Last uint32
+	// Received is sequence number of the received notification.
+	Received uint32
+	// Reordered signals that the notification is older than the last one, so it was dropped.
+	// Otherwise notifications between Last and Received were missed.
+	Reordered bool
+}
+
+// GapFunc is called when a gap in sequence numbers of notifications is detected.
+type GapFunc = func(o *Observation, gap ObserveGap)
+
+// ObserveRecovery is policy which keeps observations created by Observe alive.
+type ObserveRecovery struct {
+	// ReregisterOnStale re-registers observation when Max-Age of the last notification expired
+	// without a new notification. It takes precedence over refresh of SetStaleHandler.
+	ReregisterOnStale bool
+	// ReregisterOnReconnect re-registers observations when the remote endpoint responds again
+	// after a confirmable exchange timed out.
+	ReregisterOnReconnect bool
+	// RetryInterval is time after which failed re-registration on stale observation is retried. Zero disables retries.
+	// Re-registrations rejected by 4.29 (Too Many Requests) or 5.03 (Service Unavailable) are retried after Max-Age
+	// of the rejection when it is longer.
+	RetryInterval time.Duration
+	// OnGap is called when a notification is out of order, which means it isn't fresher than the last one
+	// by comparison of sequence numbers from RFC 7641 section 3.4.
+	OnGap GapFunc
+	// ExpectConsecutive reports to OnGap also notifications whose sequence number doesn't follow the previous
+	// one by one. RFC 7641 section 4.4 doesn't require it, so it fits only servers which increment it by one.
+	ExpectConsecutive bool
+}
+
+// observeGap returns gap between the last and the received sequence number. The received notification is fresh
+// when valid reports so by RFC 7641 section 3.4.
+func observeGap(last, received uint32, valid, expectConsecutive bool) (ObserveGap, bool) {
+	if !valid {
+		return ObserveGap{Last: last, Received: received, Reordered: true}, true
+	}
+	if !expectConsecutive || received == (last+1)&maxObserveSequence {
+		return ObserveGap{}, false
+	}
+	return ObserveGap{Last: last, Received: received}, true
+}
+
+// reregister sends observe request with the token of the observation again, so the server renews
+// the registration (RFC 7641 section 3.3.1). The response is handled as a notification.
+func (o *Observation) reregister() error {
+	ctx, cancel := context.WithTimeout(o.cc.Context(), refreshTimeout)
+	defer cancel()
+	req, err := newCommonRequest(ctx, o.cc.messagePool, codes.GET, o.path, o.opts...)
+	if err != nil {
+		return fmt.Errorf("cannot create observe request: %w", err)
+	}
+	defer pool.ReleaseMessage(req)
+	req.SetToken(o.token)
+	req.SetObserve(0)
+	respCodeChan := make(chan codes.Code, 1)
+
+	o.mutex.Lock()
+	if o.canceled {
+		o.mutex.Unlock()
+		return nil
+	}
+	// the server could be restarted, so sequence numbers start again
+	o.obsSequence = 0
+	o.lastEvent = time.Time{}
+	o.respCodeChan = respCodeChan
+	o.mutex.Unlock()
+	atomic.StoreUint32(&o.waitForReponse, 1)
+
+	err = o.cc.WriteMessage(req)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case respCode := <-respCodeChan:
+		if respCode != codes.Content {
+			return o.rejected(respCode)
+		}
+		return nil
+	}
+}
+
+// rejected returns error of the registration which was answered by the code. Rejections by 4.29 (Too Many
+// Requests) and 5.03 (Service Unavailable) carry Max-Age of the response.
+func (o *Observation) rejected(code codes.Code) error {
+	switch code {
+	case codes.TooManyRequests, codes.ServiceUnavailable:
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		return &RetryAfterError{Code: code, RetryAfter: o.retryAfter}
+	}
+	return fmt.Errorf("unexpected return code(%v)", code)
+}
+
+func (o *Observation) reregisterStale() {
+	err := o.reregister()
+	if err == nil {
+		return
+	}
+	o.cc.errors(fmt.Errorf("cannot re-register stale observation of %v: %w", o.path, err))
+	retryInterval := o.cc.observeRecovery.RetryInterval
+	if retryInterval <= 0 {
+		return
+	}
+	// the server tells when it accepts the registration again
+	var errRetry *RetryAfterError
+	if errors.As(err, &errRetry) && errRetry.RetryAfter > retryInterval {
+		retryInterval = errRetry.RetryAfter
+	}
+	o.restartStaleTimer(retryInterval)
+}
+
+// onResponsive re-registers observations after the remote endpoint became responsive again.
+func (cc *ClientConn) onResponsive() {
+	if !cc.observeRecovery.ReregisterOnReconnect {
+		return
+	}
+	go cc.ReregisterObservations()
+}
+
+// ReregisterObservations re-registers observations created by Observe, e.g. after the local address of the client
+// changed, so the server sends notifications to the current one. Failures are reported to the error function
+// of the client.
+func (cc *ClientConn) ReregisterObservations() {
+	observations := make([]*Observation, 0, 4)
+	cc.observations.Range(func(key, value interface{}) bool {
+		observations = append(observations, value.(*Observation))
+		return true
+	})
+	for _, o := range observations {
+		err := o.reregister()
+		if err != nil {
+			cc.errors(fmt.Errorf("cannot re-register observation of %v: %w", o.path, err))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveGap(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name              string
+		last              uint32
+		received          uint32
+		lastEvent         time.Time
+		expectConsecutive bool
+		want              ObserveGap
+		wantGap           bool
+	}{
+		{name: "next", last: 2, received: 3, lastEvent: now},
+		{name: "jump", last: 2, received: 10, lastEvent: now},
+		{name: "jump consecutive", last: 2, received: 10, lastEvent: now, expectConsecutive: true, want: ObserveGap{Last: 2, Received: 10}, wantGap: true},
+		{name: "wrap", last: maxObserveSequence, received: 0, lastEvent: now, expectConsecutive: true},
+		{name: "wrap jump", last: maxObserveSequence - 5, received: 3, lastEvent: now},
+		{name: "reordered", last: 10, received: 4, lastEvent: now, want: ObserveGap{Last: 10, Received: 4, Reordered: true}, wantGap: true},
+		{name: "reordered after wrap", last: 3, received: maxObserveSequence - 5, lastEvent: now, want: ObserveGap{Last: 3, Received: maxObserveSequence - 5, Reordered: true}, wantGap: true},
+		{name: "older after 128s", last: 10, received: 4, lastEvent: now.Add(-observation.ObservationSequenceTimeout - time.Second)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := observation.ValidSequenceNumber(tt.last, tt.received, tt.lastEvent, now)
+			gap, ok := observeGap(tt.last, tt.received, valid, tt.expectConsecutive)
+			require.Equal(t, tt.wantGap, ok)
+			require.Equal(t, tt.want, gap)
+		})
+	}
+}
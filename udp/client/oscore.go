@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+func newOSCOREEndpoint(ctx *oscore.Context) *oscore.Endpoint {
+	if ctx == nil {
+		return nil
+	}
+	return oscore.NewEndpoint(ctx)
+}
+
+// protect encrypts outgoing message by OSCORE. Already protected message is sent as it is, e.g. a retransmission.
+func (cc *ClientConn) protect(msg *pool.Message) error {
+	if cc.oscore == nil || msg.HasOption(message.OSCORE) {
+		return nil
+	}
+	err := cc.oscore.Protect(msg.Message)
+	if err != nil {
+		return fmt.Errorf("cannot protect message: %w", err)
+	}
+	return nil
+}
+
+// unprotect decrypts incoming message by OSCORE. When it fails, error response is sent to the request
+// and false is returned.
+func (cc *ClientConn) unprotect(req *pool.Message) bool {
+	if cc.oscore == nil {
+		return true
+	}
+	err := cc.oscore.Unprotect(req.Message)
+	if err == nil {
+		return true
+	}
+	resp := cc.messagePool.AcquireMessage(cc.Context())
+	defer pool.ReleaseMessage(resp)
+	if req.Code() >= 32 {
+		cc.errors(fmt.Errorf("cannot unprotect response: %w", err))
+		if req.Type() != udpMessage.Confirmable {
+			return false
+		}
+		// acknowledge it, so it is not retransmitted
+		resp.SetCode(codes.Empty)
+		resp.SetType(udpMessage.Acknowledgement)
+		resp.SetMessageID(req.MessageID())
+		err = cc.writeToSession(resp)
+		if err != nil {
+			cc.errors(fmt.Errorf("cannot write ack reponse: %w", err))
+		}
+		return false
+	}
+	resp.SetCode(oscore.ErrorCode(err))
+	resp.SetToken(req.Token())
+	resp.SetBody(bytes.NewReader([]byte(err.Error())))
+	if req.Type() == udpMessage.Confirmable {
+		resp.SetType(udpMessage.Acknowledgement)
+		resp.SetMessageID(req.MessageID())
+	} else {
+		resp.SetType(udpMessage.NonConfirmable)
+		resp.SetMessageID(cc.getMID())
+	}
+	err = cc.writeToSession(resp)
+	if err != nil {
+		cc.errors(fmt.Errorf("cannot write response: %w", err))
+	}
+	return false
+}
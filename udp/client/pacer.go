@@ -0,0 +1,176 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// ProbingRate is default rate in bytes per second toward an endpoint which doesn't respond (RFC 7252 section 4.8).
+const ProbingRate = 1
+
+// Pacing configures pacing of messages sent to the remote endpoint.
+//
+// Pacing is based on token buckets: a message is sent when the bucket isn't in debt
+// and its size is taken from the bucket, so the average rate is kept even for messages bigger than Burst.
+type Pacing struct {
+	// Rate is average number of bytes per second sent to the endpoint. Zero disables pacing.
+	Rate int
+	// Burst is number of bytes which can be sent at once after the endpoint was idle.
+	Burst int
+	// ProbingRate is average number of bytes per second sent to the endpoint which doesn't respond,
+	// i.e. a confirmable exchange timed out and nothing was received since then. Zero disables it.
+	ProbingRate int
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) tokenBucket {
+	return tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller must wait before sending them.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return wait
+}
+
+// cancel returns n bytes taken by reserve.
+func (b *tokenBucket) cancel(n int) {
+	if b.rate <= 0 || n == 0 {
+		return
+	}
+	b.tokens += float64(n)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+type pacer struct {
+	mutex        sync.Mutex
+	paced        tokenBucket
+	probing      tokenBucket
+	unresponsive uint32
+}
+
+func newPacer(p Pacing) *pacer {
+	if p.Rate <= 0 && p.ProbingRate <= 0 {
+		return nil
+	}
+	return &pacer{
+		paced:   newTokenBucket(p.Rate, p.Burst),
+		probing: newTokenBucket(p.ProbingRate, 0),
+	}
+}
+
+func (p *pacer) setUnresponsive(unresponsive bool) {
+	if !unresponsive {
+		atomic.StoreUint32(&p.unresponsive, 0)
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&p.unresponsive, 0, 1) {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	// the first probe is sent immediately
+	p.probing.tokens = 0
+	p.probing.last = time.Now()
+}
+
+// reservation is number of bytes taken from the buckets for a message.
+type reservation struct {
+	paced   int
+	probing int
+}
+
+func (p *pacer) reserve(n int) (time.Duration, reservation) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	wait := p.paced.reserve(now, n)
+	r := reservation{paced: n}
+	if atomic.LoadUint32(&p.unresponsive) == 1 {
+		if w := p.probing.reserve(now, n); w > wait {
+			wait = w
+		}
+		r.probing = n
+	}
+	return wait, r
+}
+
+// cancel returns bytes of a reservation of the message which wasn't sent to the buckets they were taken from,
+// regardless of whether the endpoint became responsive or unresponsive since then.
+func (p *pacer) cancel(r reservation) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.paced.cancel(r.paced)
+	p.probing.cancel(r.probing)
+}
+
+// pace blocks until req can be sent to the remote endpoint. The message is sized without marshaling,
+// so it is marshaled only when it is written.
+func (cc *ClientConn) pace(req *pool.Message) error {
+	if cc.pacer == nil {
+		return nil
+	}
+	size, err := req.Size()
+	if err != nil {
+		return fmt.Errorf("cannot get size of request: %w", err)
+	}
+	wait, r := cc.pacer.reserve(size)
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-req.Context().Done():
+		// the stale message is dropped, so it doesn't delay the next one
+		cc.pacer.cancel(r)
+		return req.Context().Err()
+	case <-cc.Context().Done():
+		return fmt.Errorf("connection was closed: %w", cc.Context().Err())
+	}
+}
+
+func (cc *ClientConn) setUnresponsive(unresponsive bool) {
+	if cc.pacer != nil {
+		cc.pacer.setUnresponsive(unresponsive)
+	}
+	if unresponsive {
+		atomic.StoreUint32(&cc.unresponsive, 1)
+		return
+	}
+	if atomic.CompareAndSwapUint32(&cc.unresponsive, 1, 0) {
+		cc.onResponsive()
+	}
+}
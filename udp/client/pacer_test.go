@@ -0,0 +1,70 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(100, 50)
+	now := time.Now()
+	// burst
+	require.Equal(t, time.Duration(0), b.reserve(now, 30))
+	require.Equal(t, time.Duration(0), b.reserve(now, 30))
+	// bucket is in debt of 10 bytes
+	require.Equal(t, time.Millisecond*100, b.reserve(now, 10))
+	// next message waits for previous reservation too
+	require.Equal(t, time.Millisecond*200, b.reserve(now, 10))
+	// idle endpoint refills the bucket up to burst
+	now = now.Add(time.Second * 10)
+	require.Equal(t, time.Duration(0), b.reserve(now, 50))
+	require.Equal(t, time.Duration(0), b.reserve(now, 1))
+	require.Equal(t, time.Millisecond*10, b.reserve(now, 1))
+}
+
+func TestTokenBucket_Disabled(t *testing.T) {
+	b := newTokenBucket(0, 0)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		require.Equal(t, time.Duration(0), b.reserve(now, 1000))
+	}
+}
+
+func reserveWait(p *pacer, n int) time.Duration {
+	wait, _ := p.reserve(n)
+	return wait
+}
+
+func TestPacer_ProbingRate(t *testing.T) {
+	require.Nil(t, newPacer(Pacing{}))
+	p := newPacer(Pacing{ProbingRate: 10})
+	for i := 0; i < 10; i++ {
+		require.Equal(t, time.Duration(0), reserveWait(p, 20))
+	}
+	p.setUnresponsive(true)
+	// first probe is sent immediately
+	require.Equal(t, time.Duration(0), reserveWait(p, 20))
+	require.InDelta(t, float64(time.Second*2), float64(reserveWait(p, 20)), float64(time.Millisecond*100))
+	p.setUnresponsive(false)
+	require.Equal(t, time.Duration(0), reserveWait(p, 20))
+}
+
+func TestPacer_Cancel(t *testing.T) {
+	p := newPacer(Pacing{Rate: 10, ProbingRate: 10})
+	_, charged := p.reserve(20)
+	require.Equal(t, reservation{paced: 20}, charged)
+	p.setUnresponsive(true)
+	probingTokens := p.probing.tokens
+	// the message was charged before the endpoint became unresponsive, so probing tokens aren't refunded
+	p.cancel(charged)
+	require.Equal(t, probingTokens, p.probing.tokens)
+
+	_, charged = p.reserve(20)
+	require.Equal(t, reservation{paced: 20, probing: 20}, charged)
+	p.setUnresponsive(false)
+	probingTokens = p.probing.tokens
+	p.cancel(charged)
+	require.Equal(t, probingTokens+20, p.probing.tokens)
+}
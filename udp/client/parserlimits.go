@@ -0,0 +1,38 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// rejectOverLimit answers the request which exceeds the parser limits by 4.13 (Request Entity Too Large),
+// with Size1 of the maximal payload when the payload is too large. Other messages are dropped.
+func (cc *ClientConn) rejectOverLimit(req *pool.Message, limitErr *message.ParserLimitError) {
+	if !codes.IsRequest(req.Code()) {
+		return
+	}
+	resp := cc.messagePool.AcquireMessage(cc.Context())
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.RequestEntityTooLarge)
+	resp.SetToken(req.Token())
+	if limitErr.Limit == message.LimitPayload {
+		resp.SetOptionUint32(message.Size1, uint32(limitErr.Max))
+	}
+	switch req.Type() {
+	case udpMessage.Confirmable:
+		resp.SetType(udpMessage.Acknowledgement)
+		resp.SetMessageID(req.MessageID())
+	case udpMessage.NonConfirmable:
+		resp.SetType(udpMessage.NonConfirmable)
+		resp.SetMessageID(cc.getMID())
+	default:
+		return
+	}
+	if err := cc.writeToSession(resp); err != nil {
+		cc.errors(fmt.Errorf("%v: cannot reject request: %w", cc.RemoteAddr(), err))
+	}
+}
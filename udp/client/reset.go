@@ -0,0 +1,97 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+const (
+	// nonLifetime is time for which a non-confirmable message may be rejected by reset (NON_LIFETIME).
+	nonLifetime = 145 * time.Second
+	// maxSentNonConfirmable bounds remembered non-confirmable messages.
+	maxSentNonConfirmable = 256
+)
+
+type sentNonConfirmable struct {
+	token   string
+	expires time.Time
+}
+
+// resets remembers tokens of sent non-confirmable messages, so a reset which rejects one of them fails the next
+// message with the token, e.g. the next notification to the observer which went away (RFC 7641 section 4.5).
+type resets struct {
+	mutex    sync.Mutex
+	sent     map[uint16]sentNonConfirmable
+	rejected map[string]struct{}
+}
+
+func newResets() *resets {
+	return &resets{
+		sent:     make(map[uint16]sentNonConfirmable),
+		rejected: make(map[string]struct{}),
+	}
+}
+
+// store remembers the non-confirmable message.
+func (r *resets) store(mid uint16, token message.Token) {
+	if len(token) == 0 {
+		return
+	}
+	now := time.Now()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.sent) >= maxSentNonConfirmable {
+		for k, v := range r.sent {
+			if now.After(v.expires) {
+				delete(r.sent, k)
+			}
+		}
+	}
+	if len(r.sent) >= maxSentNonConfirmable {
+		for k := range r.sent {
+			delete(r.sent, k)
+			break
+		}
+	}
+	r.sent[mid] = sentNonConfirmable{
+		token:   string(token),
+		expires: now.Add(nonLifetime),
+	}
+}
+
+// reject marks the token of the non-confirmable message rejected by the reset.
+func (r *resets) reject(mid uint16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	v, ok := r.sent[mid]
+	if !ok {
+		return
+	}
+	delete(r.sent, mid)
+	if time.Now().After(v.expires) {
+		return
+	}
+	if len(r.rejected) >= maxSentNonConfirmable {
+		for k := range r.rejected {
+			delete(r.rejected, k)
+			break
+		}
+	}
+	r.rejected[v.token] = struct{}{}
+}
+
+// pop reports whether a message with the token was rejected and forgets it.
+func (r *resets) pop(token message.Token) bool {
+	if len(token) == 0 {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.rejected[string(token)]; !ok {
+		return false
+	}
+	delete(r.rejected, string(token))
+	return true
+}
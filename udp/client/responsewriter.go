@@ -2,6 +2,7 @@ package client
 
 import (
 	"io"
+	"sync"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -12,23 +13,52 @@ import (
 
 // A ResponseWriter interface is used by an COAP handler to construct an COAP response.
 type ResponseWriter struct {
-	noResponseValue *uint32
-	response        *pool.Message
-	cc              *ClientConn
+	noResponseValue   *uint32
+	noResponse        uint32
+	response          *pool.Message
+	cc                *ClientConn
+	nonResponsePolicy NonResponsePolicy
+	requestMessageID  uint16
+	// pooled is set for writers of the pool, they copy the body to the response.
+	pooled bool
 }
 
+var responseWriterPool sync.Pool
+
 func NewResponseWriter(response *pool.Message, cc *ClientConn, requestOptions message.Options) *ResponseWriter {
-	var noResponseValue *uint32
+	r := &ResponseWriter{}
+	r.reset(response, cc, requestOptions)
+	return r
+}
+
+func (r *ResponseWriter) reset(response *pool.Message, cc *ClientConn, requestOptions message.Options) {
+	*r = ResponseWriter{
+		response:          response,
+		cc:                cc,
+		nonResponsePolicy: cc.nonResponsePolicy,
+	}
 	v, err := requestOptions.GetUint32(message.NoResponse)
 	if err == nil {
-		noResponseValue = &v
+		r.noResponse = v
+		r.noResponseValue = &r.noResponse
 	}
+}
 
-	return &ResponseWriter{
-		response:        response,
-		cc:              cc,
-		noResponseValue: noResponseValue,
+// acquireResponseWriter returns ResponseWriter of the pool, it must be returned by releaseResponseWriter
+// when the exchange is done.
+func acquireResponseWriter(response *pool.Message, cc *ClientConn, requestOptions message.Options) *ResponseWriter {
+	r, ok := responseWriterPool.Get().(*ResponseWriter)
+	if !ok {
+		r = &ResponseWriter{}
 	}
+	r.reset(response, cc, requestOptions)
+	r.pooled = true
+	return r
+}
+
+func releaseResponseWriter(r *ResponseWriter) {
+	*r = ResponseWriter{}
+	responseWriterPool.Put(r)
 }
 
 func (r *ResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
@@ -43,6 +73,12 @@ func (r *ResponseWriter) SetResponse(code codes.Code, contentFormat message.Medi
 	r.response.ResetOptionsTo(opts)
 	if d != nil {
 		r.response.SetContentFormat(contentFormat)
+		if r.pooled {
+			copied, err := r.copyBody(d)
+			if copied || err != nil {
+				return err
+			}
+		}
 		r.response.SetBody(d)
 		if !r.response.HasOption(message.ETag) {
 			etag, err := message.GetETag(d)
@@ -55,10 +91,37 @@ func (r *ResponseWriter) SetResponse(code codes.Code, contentFormat message.Medi
 	return nil
 }
 
+// copyBody copies the body to the pooled buffer of the response, so the handler may reuse d. The body sent
+// by blockwise transfer is read after the exchange, so it isn't copied.
+func (r *ResponseWriter) copyBody(d io.ReadSeeker) (bool, error) {
+	size, err := d.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	if r.cc.blockWise != nil && size > r.cc.blockwiseSZX.Size() {
+		return false, nil
+	}
+	payload, err := r.response.CopyBody(d)
+	if err != nil {
+		return false, err
+	}
+	if !r.response.HasOption(message.ETag) {
+		var etag [8]byte
+		r.response.SetOptionBytes(message.ETag, message.AppendETag(etag[:0], payload))
+	}
+	return true, nil
+}
+
 func (r *ResponseWriter) ClientConn() *ClientConn {
 	return r.cc
 }
 
+// SetNonResponsePolicy overrides policy of the connection for the response to a Non-confirmable request.
+// It has no effect on responses to Confirmable requests.
+func (r *ResponseWriter) SetNonResponsePolicy(policy NonResponsePolicy) {
+	r.nonResponsePolicy = policy
+}
+
 func (r *ResponseWriter) SendReset() {
 	r.response.Reset()
 	r.response.SetCode(codes.Empty)
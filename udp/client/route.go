@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+var (
+	// ErrInvalidRoute is returned by RespondTo when the route doesn't identify a request of the remote endpoint.
+	ErrInvalidRoute = errors.New("invalid response route")
+	// ErrRouteExpired is returned by RespondTo when the client doesn't wait for the response anymore.
+	ErrRouteExpired = errors.New("response route expired")
+)
+
+// ResponseRoute identifies a deferred request, so its response can be sent by another connection or another
+// server which routes to the same client, e.g. the passive node of an active-passive cluster which took over
+// the address. The fields are exported, so the route can be replicated between the nodes.
+type ResponseRoute struct {
+	// RemoteAddr is address of the client.
+	RemoteAddr string
+	// Token is token of the request, the response is matched by it.
+	Token message.Token
+	// MessageID is message ID of the request, its duplicates are answered by the response.
+	MessageID uint16
+	// Expires is time after which the client doesn't wait for the response (EXCHANGE_LIFETIME of RFC 7252).
+	Expires time.Time
+}
+
+// Route returns route of the deferred request. When another connection responds by the route, Cancel stops
+// the fallback response of this one.
+func (s *SeparateResponse) Route() ResponseRoute {
+	return ResponseRoute{
+		RemoteAddr: s.cc.RemoteAddr().String(),
+		Token:      append(message.Token(nil), s.token...),
+		MessageID:  s.mid,
+		Expires:    s.received.Add(ExchangeLifetime),
+	}
+}
+
+// RespondTo sends resp as the separate response of the request of the route, which was acknowledged by another
+// connection to the same remote endpoint. The token, the type and the message ID of resp are replaced, so
+// the response matches the request and is retransmitted until it is acknowledged. The caller keeps
+// ownership of resp.
+func (cc *ClientConn) RespondTo(route ResponseRoute, resp *pool.Message) error {
+	if len(route.Token) == 0 {
+		return fmt.Errorf("%w: response without token cannot be matched", ErrInvalidRoute)
+	}
+	if route.RemoteAddr != cc.RemoteAddr().String() {
+		return fmt.Errorf("%w: route to %v doesn't lead to %v", ErrInvalidRoute, route.RemoteAddr, cc.RemoteAddr())
+	}
+	if codes.IsRequest(resp.Code()) || resp.Code() == codes.Empty {
+		return fmt.Errorf("%w: %v isn't a response", ErrInvalidRoute, resp.Code())
+	}
+	if !time.Now().Before(route.Expires) {
+		// the client might have reused the token meanwhile
+		return ErrRouteExpired
+	}
+	resp.ResetMessageID()
+	return cc.writeSeparateResponse(route.Token, route.MessageID, resp)
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/noresponse"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// ErrSeparateResponseSent is returned when the separate response was already sent, by the responder
+// or by the fallback after its deadline.
+var ErrSeparateResponseSent = errors.New("separate response was already sent")
+
+// SeparateResponse sends a separate response (RFC 7252 section 5.2.2) to the request after the handler returned.
+// When it isn't sent until the deadline, the fallback response is sent instead. The pending response
+// delays graceful close of the connection, it is sent even when the connection is closing.
+type SeparateResponse struct {
+	cc              *ClientConn
+	token           message.Token
+	mid             uint16
+	noResponseValue *uint32
+	fallbackCode    codes.Code
+	timer           *time.Timer
+	sent            uint32
+	inFlight        bool
+	onExpire        func()
+	received        time.Time
+}
+
+// Defer detaches the response from the handler. The request is acknowledged by an empty message when the handler
+// returns and the response is sent later by SetResponse of the returned SeparateResponse. When it isn't called
+// within timeout, a response with fallbackCode is sent, codes.GatewayTimeout when fallbackCode is codes.Empty.
+// The handler must not set the response of w.
+func (r *ResponseWriter) Defer(timeout time.Duration, fallbackCode codes.Code) *SeparateResponse {
+	return r.deferResponse(timeout, fallbackCode, nil)
+}
+
+// deferResponse detaches the response as Defer, onExpire is called before the fallback response is sent.
+func (r *ResponseWriter) deferResponse(timeout time.Duration, fallbackCode codes.Code, onExpire func()) *SeparateResponse {
+	if fallbackCode == codes.Empty {
+		fallbackCode = codes.GatewayTimeout
+	}
+	s := &SeparateResponse{
+		cc:           r.cc,
+		token:        append(message.Token(nil), r.response.Token()...),
+		mid:          r.requestMessageID,
+		fallbackCode: fallbackCode,
+		inFlight:     r.cc.inFlight.acquire(),
+		onExpire:     onExpire,
+		received:     time.Now(),
+	}
+	if r.noResponseValue != nil {
+		// the writer is reused after the handler returns
+		v := *r.noResponseValue
+		s.noResponseValue = &v
+	}
+	s.timer = time.AfterFunc(timeout, s.expire)
+	return s
+}
+
+// SetResponse sends the separate response in a Confirmable message.
+func (s *SeparateResponse) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	if err := s.acquire(code); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.send(code, contentFormat, d, opts...)
+}
+
+// Respond sends msg as the separate response, e.g. a response built by another component. The token, the type
+// and the message ID of msg are replaced, so the response matches the request and is retransmitted until
+// it is acknowledged. The caller keeps ownership of msg.
+func (s *SeparateResponse) Respond(msg *pool.Message) error {
+	if err := s.acquire(msg.Code()); err != nil {
+		return err
+	}
+	defer s.release()
+	msg.ResetMessageID()
+	return s.write(msg)
+}
+
+// acquire reserves sending of the response with the code, the caller must release it.
+func (s *SeparateResponse) acquire(code codes.Code) error {
+	if s.noResponseValue != nil {
+		err := noresponse.IsNoResponseCode(code, *s.noResponseValue)
+		if err != nil {
+			if s.cancel() {
+				s.release()
+			}
+			return err
+		}
+	}
+	if !s.cancel() {
+		return ErrSeparateResponseSent
+	}
+	return nil
+}
+
+// Cancel stops the deadline without sending any response. It reports whether the response wasn't sent yet.
+func (s *SeparateResponse) Cancel() bool {
+	if !s.cancel() {
+		return false
+	}
+	s.release()
+	return true
+}
+
+func (s *SeparateResponse) cancel() bool {
+	if !atomic.CompareAndSwapUint32(&s.sent, 0, 1) {
+		return false
+	}
+	s.timer.Stop()
+	return true
+}
+
+// release stops delaying graceful close of the connection.
+func (s *SeparateResponse) release() {
+	if s.inFlight {
+		s.cc.inFlight.release()
+	}
+}
+
+func (s *SeparateResponse) expire() {
+	if !atomic.CompareAndSwapUint32(&s.sent, 0, 1) {
+		return
+	}
+	defer s.release()
+	if s.onExpire != nil {
+		s.onExpire()
+	}
+	select {
+	case <-s.cc.Done():
+		return
+	default:
+	}
+	if s.noResponseValue != nil && noresponse.IsNoResponseCode(s.fallbackCode, *s.noResponseValue) != nil {
+		return
+	}
+	err := s.send(s.fallbackCode, 0, nil)
+	if err != nil {
+		s.cc.errors(fmt.Errorf("cannot write fallback of separate response: %w", err))
+	}
+}
+
+func (s *SeparateResponse) send(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	resp := s.cc.messagePool.AcquireMessage(s.cc.Context())
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(code)
+	resp.ResetOptionsTo(opts)
+	if d != nil {
+		resp.SetContentFormat(contentFormat)
+		resp.SetBody(d)
+	}
+	return s.write(resp)
+}
+
+func (s *SeparateResponse) write(resp *pool.Message) error {
+	return s.cc.writeSeparateResponse(s.token, s.mid, resp)
+}
+
+// writeSeparateResponse sends resp to the request with the token and the message ID in a Confirmable message.
+func (cc *ClientConn) writeSeparateResponse(token message.Token, mid uint16, resp *pool.Message) error {
+	resp.SetToken(token)
+	resp.SetType(udpMessage.Confirmable)
+	// the request was accepted before, so the response isn't rejected by graceful close
+	err := cc.writeBlockwiseMessage(resp)
+	if err != nil {
+		return err
+	}
+	if cc.reliableTransport {
+		return nil
+	}
+	// duplicate of the request is answered by the response instead of the empty acknowledgement
+	resp.SetMessageID(mid)
+	return cc.addResponseToCache(resp)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// DefaultShutdownMaxAge is default Max-Age of 5.03 Service Unavailable responses which cancel observations
+// at shutdown of the server.
+const DefaultShutdownMaxAge = time.Second * 30
+
+// observers holds tokens of observations registered by the peer.
+type observers struct {
+	mutex  sync.Mutex
+	tokens map[string]message.Token
+}
+
+func newObservers() *observers {
+	return &observers{
+		tokens: make(map[string]message.Token),
+	}
+}
+
+// observeRequest returns value of Observe option of GET request.
+func observeRequest(r *pool.Message) (uint32, bool) {
+	if r.Code() != codes.GET {
+		return 0, false
+	}
+	obs, err := r.Observe()
+	return obs, err == nil
+}
+
+// update registers the observation accepted by the response or removes the deregistered one. It returns
+// 1 for a new observation, -1 for a removed one and 0 otherwise.
+func (o *observers) update(obs uint32, resp *pool.Message) int {
+	key := resp.Token().String()
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	_, registered := o.tokens[key]
+	if obs == 0 && resp.IsModified() && resp.HasOption(message.Observe) && codes.IsSuccess(resp.Code()) {
+		o.tokens[key] = append(message.Token(nil), resp.Token()...)
+		if registered {
+			return 0
+		}
+		return 1
+	}
+	delete(o.tokens, key)
+	if registered {
+		return -1
+	}
+	return 0
+}
+
+func (o *observers) pop() []message.Token {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	tokens := make([]message.Token, 0, len(o.tokens))
+	for _, t := range o.tokens {
+		tokens = append(tokens, t)
+	}
+	o.tokens = make(map[string]message.Token)
+	return tokens
+}
+
+// Shutdown waits until requests in progress, separate responses and blockwise transfers are finished, cancels
+// observations registered by the peer by 5.03 Service Unavailable with maxAge and closes the connection. It is used
+// by servers, when ctx is done before that, the connection is closed immediately and ctx error is returned.
+func (cc *ClientConn) Shutdown(ctx context.Context, maxAge time.Duration) error {
+	err := cc.drain(ctx)
+	if err == nil {
+		select {
+		case <-cc.handlers.drain():
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-cc.Context().Done():
+		}
+	}
+	if err == nil {
+		err = cc.cancelObservers(maxAge)
+	}
+	errClose := cc.Close()
+	if err != nil {
+		return err
+	}
+	return errClose
+}
+
+func (cc *ClientConn) cancelObservers(maxAge time.Duration) error {
+	for _, token := range cc.observers.pop() {
+		err := cc.sendServiceUnavailable(token, maxAge)
+		if err != nil {
+			return fmt.Errorf("cannot cancel observation %v: %w", token, err)
+		}
+	}
+	return nil
+}
+
+// sendServiceUnavailable sends the response without Observe option, which ends the observation (RFC 7641 section 3.2).
+func (cc *ClientConn) sendServiceUnavailable(token message.Token, maxAge time.Duration) error {
+	resp := cc.messagePool.AcquireMessage(cc.Context())
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.ServiceUnavailable)
+	resp.SetToken(token)
+	resp.SetOptionUint32(message.MaxAge, uint32(maxAge/time.Second))
+	resp.SetType(udpMessage.NonConfirmable)
+	resp.SetMessageID(cc.getMID())
+	err := cc.protect(resp)
+	if err != nil {
+		return err
+	}
+	return cc.writeToSession(resp)
+}
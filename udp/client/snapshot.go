@@ -0,0 +1,83 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+)
+
+// TransferSnapshot describes a partial blockwise transfer of a connection.
+type TransferSnapshot struct {
+	Token     string `json:"token"`
+	Receiving bool   `json:"receiving"`
+	Size      int64  `json:"size"`
+}
+
+// ConnSnapshot is state of a connection, e.g. to attach to a bug report.
+type ConnSnapshot struct {
+	RemoteAddr string `json:"remoteAddr"`
+	// Requests is number of requests in progress.
+	Requests int `json:"requests"`
+	// Exchanges is number of exchanges waiting for a response by token.
+	Exchanges int `json:"exchanges"`
+	// Unacknowledged is number of confirmable messages waiting for an acknowledgement.
+	Unacknowledged int `json:"unacknowledged"`
+	// Observations contains tokens of observations of the remote endpoint's resources.
+	Observations []string           `json:"observations,omitempty"`
+	Transfers    []TransferSnapshot `json:"transfers,omitempty"`
+	Unresponsive bool               `json:"unresponsive"`
+	SmoothedRTT  time.Duration      `json:"smoothedRTT"`
+	RTO          time.Duration      `json:"rto"`
+	Retransmits  int                `json:"retransmits"`
+	Timeouts     int                `json:"timeouts"`
+	// PingRTT is round-trip time of the last ping answered by the peer, which is sent by the keepalive monitor.
+	PingRTT time.Duration `json:"pingRTT,omitempty"`
+	// DuplicateRequests, DuplicateResponses and DuplicateAcks are counts of suppressed duplicates of the peer.
+	DuplicateRequests  uint64 `json:"duplicateRequests"`
+	DuplicateResponses uint64 `json:"duplicateResponses"`
+	DuplicateAcks      uint64 `json:"duplicateAcks"`
+}
+
+// Snapshot returns state of the connection, e.g. for debugging.
+func (cc *ClientConn) Snapshot() ConnSnapshot {
+	stats := cc.ExchangeStats()
+	s := ConnSnapshot{
+		RemoteAddr:     cc.RemoteAddr().String(),
+		Requests:       cc.inFlight.len(),
+		Exchanges:      cc.tokenHandlerContainer.Len(),
+		Unacknowledged: cc.midHandlerContainer.Len(),
+		Unresponsive:   atomic.LoadUint32(&cc.unresponsive) == 1,
+		SmoothedRTT:    stats.SmoothedRTT,
+		RTO:            stats.RTO,
+		Retransmits:    stats.Retransmits,
+		Timeouts:       stats.Timeouts,
+	}
+	duplicates := cc.DuplicateStats()
+	s.DuplicateRequests = duplicates.Requests
+	s.DuplicateResponses = duplicates.Responses
+	s.DuplicateAcks = duplicates.Acknowledgements
+	if m, ok := cc.activityMonitor.(interface{ RTT() time.Duration }); ok {
+		s.PingRTT = m.RTT()
+	}
+	cc.observations.Range(func(key, value interface{}) bool {
+		s.Observations = append(s.Observations, key.(string))
+		return true
+	})
+	if cc.blockWise != nil {
+		for _, t := range cc.blockWise.Transfers() {
+			s.Transfers = append(s.Transfers, TransferSnapshot{
+				Token:     t.Token.String(),
+				Receiving: t.Receiving,
+				Size:      t.Size,
+			})
+		}
+	}
+	return s
+}
+
+// Liveness returns liveness of the peer reported by the inactivity monitor, e.g. round-trip time of the last
+// keepalive ping.
+func (cc *ClientConn) Liveness() inactivity.Liveness {
+	return inactivity.LivenessOf(cc.activityMonitor)
+}
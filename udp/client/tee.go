@@ -0,0 +1,19 @@
+package client
+
+import (
+	"context"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+)
+
+// TeeResponses passes only marshaled responses and notifications to the writer, e.g. as a mirror of
+// coapNet.NewTeeTransport, which mirrors all messages including requests and empty messages.
+func TeeResponses(w coapNet.MessageWriter) coapNet.MessageWriter {
+	return coapNet.MessageWriterFunc(func(ctx context.Context, data []byte) error {
+		if len(data) < 2 || codes.Code(data[1])>>5 < 2 {
+			return nil
+		}
+		return w.WriteMessage(ctx, data)
+	})
+}
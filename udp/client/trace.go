@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// TraceHandler receives events of messages sent and received by the connection.
+type TraceHandler = trace.Handler
+
+func (cc *ClientConn) trace(typ trace.EventType, m *pool.Message, retransmission int, elapsed time.Duration) {
+	if cc.traceHandler == nil {
+		return
+	}
+	// a response isn't assigned message ID until it is written
+	mid := int32(-1)
+	if m.HasMessageID() {
+		mid = int32(m.MessageID())
+	}
+	trace.Emit(cc.traceHandler, trace.Event{
+		Type:           typ,
+		Message:        m.Message,
+		MessageID:      mid,
+		MessageType:    m.Type().String(),
+		RemoteAddr:     cc.RemoteAddr(),
+		Retransmission: retransmission,
+		Elapsed:        elapsed,
+		ExchangeID:     cc.exchangeID(typ, m),
+	})
+}
+
+// exchangeID returns ID of the exchange of the message. Responses and notifications which are created with
+// context of the connection are found by token, empty acknowledgements and resets by message ID of the message
+// they match.
+func (cc *ClientConn) exchangeID(typ trace.EventType, m *pool.Message) trace.ExchangeID {
+	if m.Context() != nil {
+		if id, ok := trace.ExchangeIDFromContext(m.Context()); ok {
+			return id
+		}
+	}
+	if len(m.Token()) > 0 {
+		id, _ := cc.exchanges.Lookup(m.Token())
+		return id
+	}
+	if !m.HasMessageID() || (m.Type() != udpMessage.Acknowledgement && m.Type() != udpMessage.Reset) {
+		return 0
+	}
+	// acknowledgement of a sent message is received and vice versa
+	id, _ := cc.exchanges.LookupMessageID(m.MessageID(), typ != trace.MessageSent)
+	return id
+}
+
+// startExchange sets ID of the exchange of the token to context of the message. It keeps ID which is already
+// set, e.g. by the application, and assigns the token to it.
+func (cc *ClientConn) startExchange(m *pool.Message) {
+	if len(m.Token()) == 0 {
+		return
+	}
+	if id, ok := trace.ExchangeIDFromContext(m.Context()); ok {
+		cc.exchanges.Set(m.Token(), id)
+		return
+	}
+	m.SetContext(trace.WithExchangeID(m.Context(), cc.exchanges.Get(m.Token())))
+}
+
+// assignMessageID assigns message ID of the message to its exchange, so the matching acknowledgement or reset
+// gets ID of the exchange.
+func (cc *ClientConn) assignMessageID(m *pool.Message, sent bool) {
+	if !m.HasMessageID() || (m.Type() != udpMessage.Confirmable && m.Type() != udpMessage.NonConfirmable) {
+		return
+	}
+	if id := cc.exchangeID(trace.MessageSent, m); id != 0 {
+		cc.exchanges.SetMessageID(m.MessageID(), sent, id)
+	}
+}
+
+// writeToSession writes the message to the session and traces it. Requests which continue a blockwise transfer
+// by a new token carry ID of the exchange in the context, so the token is assigned to it.
+func (cc *ClientConn) writeToSession(m *pool.Message) error {
+	if m.Context() != nil && len(m.Token()) > 0 {
+		if id, ok := trace.ExchangeIDFromContext(m.Context()); ok {
+			cc.exchanges.Set(m.Token(), id)
+		}
+	}
+	cc.assignMessageID(m, true)
+	err := cc.writeWithTimeout(m)
+	if err == nil {
+		cc.trace(trace.MessageSent, m, 0, 0)
+	}
+	return err
+}
+
+// writeWithTimeout writes the message to the session within the write timeout, so a slow peer doesn't stall
+// the exchange beyond it.
+func (cc *ClientConn) writeWithTimeout(m *pool.Message) error {
+	if cc.writeTimeout <= 0 {
+		return cc.session.WriteMessage(m)
+	}
+	ctx := m.Context()
+	defer m.SetContext(ctx)
+	return coapNet.WriteWithTimeout(ctx, cc.writeTimeout, func(ctx context.Context) error {
+		m.SetContext(ctx)
+		return cc.session.WriteMessage(m)
+	})
+}
+
+// traceObservation traces the change of observations of the peer returned by observers.update.
+func (cc *ClientConn) traceObservation(change int, resp *pool.Message) {
+	switch change {
+	case 1:
+		cc.trace(trace.ObservationRegistered, resp, 0, 0)
+	case -1:
+		cc.trace(trace.ObservationDeregistered, resp, 0, 0)
+	}
+}
+
+// traceSession traces SessionStarted of the new connection and SessionClosed when it is closed.
+func (cc *ClientConn) traceSession() {
+	if cc.traceHandler == nil {
+		return
+	}
+	trace.EmitSession(cc.traceHandler, trace.SessionStarted, cc.RemoteAddr())
+	cc.AddOnClose(func() {
+		trace.EmitSession(cc.traceHandler, trace.SessionClosed, cc.RemoteAddr())
+	})
+}
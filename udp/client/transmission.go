@@ -0,0 +1,42 @@
+package client
+
+import (
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// TransmissionParams computes retransmission timeouts of confirmable messages. Every ClientConn
+// gets own instance, so an adaptive implementation can keep state of the remote endpoint.
+type TransmissionParams interface {
+	// RetransmissionTimeouts returns time to wait for the acknowledgement before each retransmission
+	// of a new confirmable message. The exchange times out after the last retransmission.
+	RetransmissionTimeouts() []time.Duration
+	// OnExchange updates the parameters by the outcome of an exchange.
+	OnExchange(e Exchange)
+}
+
+// NewTransmissionParamsFunc creates transmission parameters of a new connection.
+type NewTransmissionParamsFunc = func() TransmissionParams
+
+// RetransmissionTimeouts waits acknowledgeTimeout and nStart before every retransmission.
+func (t *Transmission) RetransmissionTimeouts() []time.Duration {
+	n := int(t.maxRetransmit.Load())
+	if n < 0 {
+		n = 0
+	}
+	timeouts := make([]time.Duration, n)
+	for i := range timeouts {
+		timeouts[i] = t.acknowledgeTimeout.Load() + t.nStart.Load()
+	}
+	return timeouts
+}
+
+// OnExchange does nothing, the parameters are fixed.
+func (t *Transmission) OnExchange(e Exchange) {}
+
+// RetransmitFunc is called before a retransmission of the confirmable request, so it can update options
+// of the request, e.g. to refresh a short-lived authorization token. It reports whether the request was modified,
+// then the request is retransmitted with a new message ID, so the server doesn't deduplicate it by the stale one.
+// When it returns an error, the request fails with the error. With OSCORE it updates outer options.
+type RetransmitFunc = func(req *pool.Message, retransmission int) (modified bool, err error)
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Default transmission parameters of RFC 7252 section 4.8.
+const (
+	DefaultAckTimeout      = 2 * time.Second
+	DefaultAckRandomFactor = 1.5
+	DefaultMaxRetransmit   = 4
+	DefaultNStart          = 1
+	DefaultLeisure         = 5 * time.Second
+)
+
+// TransmissionConfig holds transmission parameters of RFC 7252 section 4.8, e.g. to tune them for constrained
+// radio links. Zero value of a field means its default.
+type TransmissionConfig struct {
+	// AckTimeout is ACK_TIMEOUT, the initial timeout of a confirmable message, by default DefaultAckTimeout.
+	AckTimeout time.Duration
+	// AckRandomFactor is ACK_RANDOM_FACTOR, the initial timeout is chosen randomly between AckTimeout and
+	// AckTimeout * AckRandomFactor. By default it is DefaultAckRandomFactor, it must not be below 1.
+	AckRandomFactor float64
+	// MaxRetransmit is MAX_RETRANSMIT, by default DefaultMaxRetransmit. Negative value disables retransmissions.
+	MaxRetransmit int
+	// NStart is NSTART, the maximum of outstanding confirmable exchanges with a peer, by default DefaultNStart.
+	// Negative value disables the limit.
+	NStart int
+	// DefaultLeisure is DEFAULT_LEISURE of servers, see WithMulticastLeisure, by default DefaultLeisure.
+	DefaultLeisure time.Duration
+	// ProbingRate is PROBING_RATE in bytes per second toward a peer which doesn't respond, by default ProbingRate.
+	// Negative value disables it.
+	ProbingRate int
+}
+
+// Normalize returns the config with defaults instead of zero values. Negative values are kept.
+func (c TransmissionConfig) Normalize() TransmissionConfig {
+	if c.AckTimeout <= 0 {
+		c.AckTimeout = DefaultAckTimeout
+	}
+	if c.AckRandomFactor < 1 {
+		c.AckRandomFactor = DefaultAckRandomFactor
+	}
+	if c.MaxRetransmit == 0 {
+		c.MaxRetransmit = DefaultMaxRetransmit
+	}
+	if c.NStart == 0 {
+		c.NStart = DefaultNStart
+	}
+	if c.DefaultLeisure <= 0 {
+		c.DefaultLeisure = DefaultLeisure
+	}
+	if c.ProbingRate == 0 {
+		c.ProbingRate = ProbingRate
+	}
+	return c
+}
+
+// NewTransmissionParams creates transmission parameters of a connection by the config.
+func (c TransmissionConfig) NewTransmissionParams() TransmissionParams {
+	return &transmissionConfigParams{
+		config: c.Normalize(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())).Float64, //nolint:gosec
+	}
+}
+
+// transmissionConfigParams retransmits by binary exponential back-off from the randomized initial timeout
+// (RFC 7252 section 4.2).
+type transmissionConfigParams struct {
+	config TransmissionConfig
+	mutex  sync.Mutex
+	random func() float64
+}
+
+// RetransmissionTimeouts doubles the initial timeout before every retransmission.
+func (p *transmissionConfigParams) RetransmissionTimeouts() []time.Duration {
+	p.mutex.Lock()
+	r := p.random()
+	p.mutex.Unlock()
+	timeout := p.config.AckTimeout + time.Duration(float64(p.config.AckTimeout)*(p.config.AckRandomFactor-1)*r)
+	n := p.config.MaxRetransmit
+	if n < 0 {
+		n = 0
+	}
+	timeouts := make([]time.Duration, n)
+	for i := range timeouts {
+		timeouts[i] = timeout
+		timeout *= 2
+	}
+	return timeouts
+}
+
+// OnExchange does nothing, the parameters are fixed.
+func (p *transmissionConfigParams) OnExchange(e Exchange) {}
+
+// nStart limits outstanding confirmable exchanges with the peer.
+type nStart struct {
+	slots chan struct{}
+}
+
+func newNStart(n int) *nStart {
+	if n <= 0 {
+		return nil
+	}
+	return &nStart{
+		slots: make(chan struct{}, n),
+	}
+}
+
+// acquire blocks until the exchange can be started.
+func (s *nStart) acquire(ctx context.Context, closed <-chan struct{}) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-closed:
+		return fmt.Errorf("connection was closed")
+	}
+}
+
+func (s *nStart) release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransmissionConfig_RetransmissionTimeouts(t *testing.T) {
+	p := TransmissionConfig{
+		AckTimeout:      time.Second,
+		AckRandomFactor: 2,
+		MaxRetransmit:   3,
+	}.NewTransmissionParams().(*transmissionConfigParams)
+	p.random = func() float64 { return 0.5 }
+	require.Equal(t, []time.Duration{time.Millisecond * 1500, time.Second * 3, time.Second * 6}, p.RetransmissionTimeouts())
+
+	cfg := TransmissionConfig{MaxRetransmit: -1, NStart: -1}.Normalize()
+	require.Equal(t, DefaultAckTimeout, cfg.AckTimeout)
+	require.Equal(t, DefaultAckRandomFactor, cfg.AckRandomFactor)
+	require.Equal(t, -1, cfg.MaxRetransmit)
+	require.Equal(t, -1, cfg.NStart)
+	require.Equal(t, ProbingRate, cfg.ProbingRate)
+	require.Empty(t, cfg.NewTransmissionParams().RetransmissionTimeouts())
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// TransportSession is Session of a connection over coapNet.Transport, e.g. DTLS or a custom transport.
+type TransportSession struct {
+	transport      coapNet.Transport
+	maxMessageSize int
+	closeTransport bool
+
+	mutex   sync.Mutex
+	onClose []EventFunc
+
+	cancel context.CancelFunc
+	ctx    atomic.Value
+
+	done chan struct{}
+}
+
+// NewTransportSession creates session over the transport, which is closed with the session when closeTransport is set.
+func NewTransportSession(
+	ctx context.Context,
+	transport coapNet.Transport,
+	maxMessageSize int,
+	closeTransport bool,
+) *TransportSession {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &TransportSession{
+		cancel:         cancel,
+		transport:      transport,
+		maxMessageSize: maxMessageSize,
+		closeTransport: closeTransport,
+		done:           make(chan struct{}),
+	}
+	s.ctx.Store(&ctx)
+	return s
+}
+
+// Done signalizes that connection is not more processed.
+func (s *TransportSession) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *TransportSession) AddOnClose(f EventFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onClose = append(s.onClose, f)
+}
+
+func (s *TransportSession) popOnClose() []EventFunc {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tmp := s.onClose
+	s.onClose = nil
+	return tmp
+}
+
+func (s *TransportSession) close() error {
+	defer close(s.done)
+	for _, f := range s.popOnClose() {
+		f()
+	}
+	if s.closeTransport {
+		return s.transport.Close()
+	}
+	return nil
+}
+
+func (s *TransportSession) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *TransportSession) Context() context.Context {
+	return *s.ctx.Load().(*context.Context)
+}
+
+// SetContextValue stores the value associated with key to context of connection.
+func (s *TransportSession) SetContextValue(key interface{}, val interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ctx := context.WithValue(s.Context(), key, val)
+	s.ctx.Store(&ctx)
+}
+
+func (s *TransportSession) WriteMessage(req *pool.Message) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return fmt.Errorf("cannot marshal: %w", err)
+	}
+	err = s.transport.WriteMessage(req.Context(), data)
+	if err != nil {
+		return fmt.Errorf("cannot write to connection: %w", err)
+	}
+	return err
+}
+
+func (s *TransportSession) MaxMessageSize() int {
+	return s.maxMessageSize
+}
+
+func (s *TransportSession) RemoteAddr() net.Addr {
+	return s.transport.RemoteAddr()
+}
+
+// Run reads and process requests from a connection, until the connection is not closed.
+func (s *TransportSession) Run(cc *ClientConn) (err error) {
+	defer func() {
+		err1 := s.Close()
+		if err == nil {
+			err = err1
+		}
+		err1 = s.close()
+		if err == nil {
+			err = err1
+		}
+	}()
+	m := make([]byte, s.maxMessageSize)
+	for {
+		readBuf := m
+		readLen, err := s.transport.ReadMessage(s.Context(), readBuf)
+		if err != nil {
+			return fmt.Errorf("cannot read from connection: %w", err)
+		}
+		readBuf = readBuf[:readLen]
+		err = cc.Process(readBuf)
+		if err != nil {
+			return err
+		}
+	}
+}
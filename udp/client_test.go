@@ -7,13 +7,17 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/trace"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -724,7 +728,7 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 
 	cc, err := Dial(
 		ld.LocalAddr().String(),
-		WithKeepAlive(3, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+		WithKeepAlive(50*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
 			require.False(t, inactivityDetected)
 			inactivityDetected = true
 			cc.Close()
@@ -744,3 +748,313 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+type traceRecorder struct {
+	sync.Mutex
+	events []trace.Event
+}
+
+func (r *traceRecorder) handle(e trace.Event) {
+	r.Lock()
+	defer r.Unlock()
+	// message is valid only during the call
+	e.Message = nil
+	r.events = append(r.events, e)
+}
+
+func (r *traceRecorder) count(typ trace.EventType, filter func(e trace.Event) bool) int {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, e := range r.events {
+		if e.Type == typ && (filter == nil || filter(e)) {
+			n++
+		}
+	}
+	return n
+}
+
+// exchangeIDs returns IDs of exchanges of the messages.
+func (r *traceRecorder) exchangeIDs() map[trace.ExchangeID]int {
+	r.Lock()
+	defer r.Unlock()
+	ids := make(map[trace.ExchangeID]int)
+	for _, e := range r.events {
+		if e.Type != trace.SessionStarted && e.Type != trace.SessionClosed {
+			ids[e.ExchangeID]++
+		}
+	}
+	return ids
+}
+
+func TestClientConn_Trace(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var serverTrace traceRecorder
+	handlerIDs := make(chan trace.ExchangeID, 4)
+	sd := NewServer(WithBlockwise(true, blockwise.SZX16, time.Second), WithTrace(serverTrace.handle), WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		id, ok := trace.ExchangeIDFromContext(r.Context())
+		require.True(t, ok)
+		handlerIDs <- id
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(make([]byte, 40)))
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	var clientTrace traceRecorder
+	cc, err := Dial(ld.LocalAddr().String(), WithTrace(clientTrace.handle))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Len(t, body, 40)
+
+	// a request for each of 3 blocks of the response
+	require.Equal(t, 3, clientTrace.count(trace.MessageSent, func(e trace.Event) bool {
+		return e.MessageType == udpMessage.Confirmable.String()
+	}))
+	require.Equal(t, 3, clientTrace.count(trace.MessageReceived, func(e trace.Event) bool {
+		return e.MessageType == udpMessage.Acknowledgement.String() && e.RemoteAddr.String() == cc.RemoteAddr().String()
+	}))
+	require.Equal(t, 3, clientTrace.count(trace.BlockwiseStep, func(e trace.Event) bool {
+		return e.Block.Option == message.Block2 && !e.Block.Sent
+	}))
+	require.Equal(t, 3, serverTrace.count(trace.MessageReceived, func(e trace.Event) bool {
+		return e.MessageType == udpMessage.Confirmable.String()
+	}))
+	require.Equal(t, 3, serverTrace.count(trace.BlockwiseStep, func(e trace.Event) bool {
+		return e.Block.Option == message.Block2 && e.Block.Sent && e.Block.SZX == blockwise.SZX16
+	}))
+
+	// all messages of the blockwise transfer belong to one exchange
+	clientIDs := clientTrace.exchangeIDs()
+	require.Len(t, clientIDs, 1)
+	require.NotContains(t, clientIDs, trace.ExchangeID(0))
+	serverIDs := serverTrace.exchangeIDs()
+	require.Len(t, serverIDs, 1)
+	id := <-handlerIDs
+	require.Contains(t, serverIDs, id)
+	require.NotZero(t, id)
+}
+
+type logRecorder struct {
+	sync.Mutex
+	entries []string
+}
+
+func (r *logRecorder) log(level, msg string) {
+	r.Lock()
+	defer r.Unlock()
+	r.entries = append(r.entries, level+" "+msg)
+}
+
+func (r *logRecorder) Debug(msg string, _ ...interface{}) { r.log("debug", msg) }
+func (r *logRecorder) Info(msg string, _ ...interface{})  { r.log("info", msg) }
+func (r *logRecorder) Warn(msg string, _ ...interface{})  { r.log("warn", msg) }
+func (r *logRecorder) Error(msg string, _ ...interface{}) { r.log("error", msg) }
+
+func (r *logRecorder) count(entry string) int {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, e := range r.entries {
+		if e == entry {
+			n++
+		}
+	}
+	return n
+}
+
+func TestClientConn_Logger(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var serverLog logRecorder
+	sd := NewServer(WithBlockwise(true, blockwise.SZX16, time.Second), WithLogger(&serverLog), WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(make([]byte, 40)))
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	// the logger doesn't replace the trace handler
+	var clientLog logRecorder
+	var clientTrace traceRecorder
+	cc, err := Dial(ld.LocalAddr().String(), WithTrace(clientTrace.handle), WithLogger(&clientLog))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Len(t, body, 40)
+
+	require.Equal(t, 1, clientLog.count("info session started"))
+	require.Equal(t, 1, serverLog.count("info session started"))
+	// 3 received blocks of the response and 2 requests of the next blocks
+	require.Equal(t, 5, clientLog.count("debug blockwise step"))
+	require.Equal(t, 3, clientTrace.count(trace.BlockwiseStep, func(e trace.Event) bool {
+		return e.Block.Option == message.Block2 && !e.Block.Sent
+	}))
+	clientLog.Lock()
+	for _, e := range clientLog.entries {
+		require.False(t, strings.HasPrefix(e, "error "), e)
+	}
+	clientLog.Unlock()
+
+	err = cc.Close()
+	require.NoError(t, err)
+	<-cc.Done()
+	require.Eventually(t, func() bool { return clientLog.count("info session closed") == 1 }, time.Second, time.Millisecond*10)
+}
+
+func TestClientConn_MessagePool(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	serverPool := pool.NewPool(16, 0)
+	sd := NewServer(WithMessagePool(serverPool), WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("a")))
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	clientPool := pool.NewPool(16, 0)
+	cc, err := Dial(ld.LocalAddr().String(), WithMessagePool(clientPool))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "a", string(body))
+
+	// both acquired the request and the response
+	require.Eventually(t, func() bool {
+		s := serverPool.Stats()
+		return s.Acquired >= 2 && s.InUse == 0
+	}, time.Second, time.Millisecond*10)
+	require.GreaterOrEqual(t, clientPool.Stats().Acquired, uint64(2))
+}
+
+func TestClientConn_Rebind(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	requests := make(chan string, 4)
+	sd := NewServer(WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		requests <- w.ClientConn().RemoteAddr().String()
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("a")))
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	raddr, err := net.ResolveUDPAddr("udp4", ld.LocalAddr().String())
+	require.NoError(t, err)
+	conn, err := net.DialUDP("udp4", nil, raddr)
+	require.NoError(t, err)
+	type migration struct {
+		oldAddr, newAddr net.Addr
+	}
+	migrations := make(chan migration, 1)
+	cc := Client(conn, WithRebind(RebindPolicy{
+		Ping: true,
+		OnMigration: func(cc *client.ClientConn, oldAddr, newAddr net.Addr) {
+			migrations <- migration{oldAddr: oldAddr, newAddr: newAddr}
+		},
+	}))
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, conn.LocalAddr().String(), <-requests)
+
+	// the socket is gone beneath the client, e.g. as when the interface went down
+	err = conn.Close()
+	require.NoError(t, err)
+	var m migration
+	select {
+	case m = <-migrations:
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.Equal(t, conn.LocalAddr().String(), m.oldAddr.String())
+	require.NotEqual(t, m.oldAddr.String(), m.newAddr.String())
+
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "a", string(body))
+	require.Equal(t, m.newAddr.String(), <-requests)
+}
+
+func TestWithTransmission_Params(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var created int
+	cc, err := Dial(ld.LocalAddr().String(), WithTransmission(time.Second, time.Second*2, 4, func() client.TransmissionParams {
+		created++
+		return client.NewCoCoA(4)
+	}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	require.Equal(t, 1, created)
+}
@@ -0,0 +1,15 @@
+//go:build !tinygo
+
+package udp
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// DebugDump writes DebugSnapshot as indented JSON to w.
+func (s *Server) DebugDump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.DebugSnapshot())
+}
@@ -0,0 +1,10 @@
+//go:build !tinygo
+
+package udp
+
+import "github.com/plgd-dev/go-coap/v2/net/blockwise"
+
+// defaultMaxMessageSize is size of the read buffer, it fits the largest UDP datagram.
+const defaultMaxMessageSize = 64 * 1024
+
+const defaultBlockwiseSZX = blockwise.SZX1024
@@ -0,0 +1,11 @@
+//go:build tinygo
+
+package udp
+
+import "github.com/plgd-dev/go-coap/v2/net/blockwise"
+
+// defaultMaxMessageSize is size of the read buffer. Embedded targets can't spare 64KiB per connection,
+// so larger representations are transferred blockwise.
+const defaultMaxMessageSize = 1280
+
+const defaultBlockwiseSZX = blockwise.SZX512
@@ -23,6 +23,20 @@ type MulticastOption interface {
 	apply(*multicastOptions)
 }
 
+// MulticastHopLimitOpt multicast hop limit option.
+type MulticastHopLimitOpt struct {
+	hopLimit int
+}
+
+func (o MulticastHopLimitOpt) apply(opts *multicastOptions) {
+	opts.hopLimit = o.hopLimit
+}
+
+// WithMulticastHopLimit sets hop limit (TTL) of multicast requests, default is 2.
+func WithMulticastHopLimit(hopLimit int) MulticastHopLimitOpt {
+	return MulticastHopLimitOpt{hopLimit: hopLimit}
+}
+
 // Discover sends GET to multicast or unicast address and waits for responses until context timeouts or server shutdown.
 // For unicast there is a difference against the Dial. The Dial is connection-oriented and it means that, if you send a request to an address, the peer must send the response from the same
 // address where was request sent. For Discover it allows the client to send a response from another address where was request send.
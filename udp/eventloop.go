@@ -0,0 +1,82 @@
+package udp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+)
+
+// ErrServerNotAttached is returned by ProcessDatagram, RespondTo and ClientConnTo when the server isn't attached
+// to a connection nor serving one.
+var ErrServerNotAttached = errors.New("server isn't attached to a connection")
+
+// Attach binds the server to the connection without the read loop of Serve, so the server is embedded
+// in an event loop of the application instead of blocking a goroutine. The application waits for readiness
+// of the socket by its own poller, reads the datagrams and passes them to ProcessDatagram, and it calls
+// ProcessTimers when the returned period elapses. Handlers run by the GoPoolFunc of WithGoPool, so they can be
+// queued to the event loop too. Responses are written to the connection. Detach releases the connection.
+func (s *Server) Attach(l *coapNet.UDPConn) error {
+	if s.blockwiseSZX > blockwise.SZX1024 {
+		return fmt.Errorf("invalid blockwiseSZX")
+	}
+	err := s.checkAndSetListener(l)
+	if err != nil {
+		return err
+	}
+	if len(s.multicastGroups) > 0 {
+		groups := s.joinMulticastGroups(l)
+		s.listenMutex.Lock()
+		s.attachedGroups = groups
+		s.listenMutex.Unlock()
+	}
+	return nil
+}
+
+// Detach closes connections of the clients and releases the connection bound by Attach, as when Serve returns.
+func (s *Server) Detach() {
+	s.listenMutex.Lock()
+	l := s.listen
+	groups := s.attachedGroups
+	s.attachedGroups = nil
+	s.listenMutex.Unlock()
+	if l == nil {
+		return
+	}
+	leaveMulticastGroups(l, groups)
+	s.closeSessions()
+	s.doneCancel()
+	s.listenMutex.Lock()
+	defer s.listenMutex.Unlock()
+	s.listen = nil
+	s.serverStartedChan = make(chan struct{}, 1)
+}
+
+// ProcessDatagram processes the datagram which the application read from the connection bound by Attach.
+// The dst is destination address of the datagram, e.g. the multicast group, or nil when it isn't known.
+// The buffer can be reused when it returns.
+func (s *Server) ProcessDatagram(buf []byte, raddr *net.UDPAddr, dst net.IP) error {
+	select {
+	case <-s.ctx.Done():
+		return fmt.Errorf("server was stopped: %w", s.ctx.Err())
+	default:
+	}
+	s.listenMutex.Lock()
+	l := s.listen
+	s.listenMutex.Unlock()
+	if l == nil {
+		return ErrServerNotAttached
+	}
+	s.processDatagram(l, buf, raddr, dst)
+	return nil
+}
+
+// ProcessTimers releases closed connections and checks inactivity of the others. It returns the period after
+// which it should be called again.
+func (s *Server) ProcessTimers() time.Duration {
+	s.checkInactivity()
+	return inactivityCheckInterval
+}
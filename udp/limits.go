@@ -0,0 +1,49 @@
+package udp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+var errTooManySessions = errors.New("too many sessions")
+
+// rejectDatagram answers the request of the datagram by 4.29 Too Many Requests with Max-Age of retryAfter without
+// a session, other messages are dropped.
+func (s *Server) rejectDatagram(l *coapNet.UDPConn, buf []byte, raddr *net.UDPAddr, retryAfter time.Duration) {
+	req := s.messagePool.AcquireMessage(s.ctx)
+	defer pool.ReleaseMessage(req)
+	if _, err := req.Unmarshal(buf); err != nil || !codes.IsRequest(req.Code()) {
+		return
+	}
+	resp := s.messagePool.AcquireMessage(s.ctx)
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.TooManyRequests)
+	resp.SetToken(req.Token())
+	resp.ResetOptionsTo(message.Options{limits.MaxAge(retryAfter)})
+	switch req.Type() {
+	case udpMessage.Confirmable:
+		resp.SetType(udpMessage.Acknowledgement)
+		resp.SetMessageID(req.MessageID())
+	case udpMessage.NonConfirmable:
+		resp.SetType(udpMessage.NonConfirmable)
+		resp.SetMessageID(s.getMID())
+	default:
+		return
+	}
+	data, err := resp.Marshal()
+	if err != nil {
+		return
+	}
+	if err := l.WriteWithContext(s.ctx, raddr, data); err != nil {
+		s.errors(fmt.Errorf("%v: cannot reject request: %w", raddr, err))
+	}
+}
@@ -53,7 +53,10 @@ func (m Message) Marshal() ([]byte, error) {
 		b = append(b[:0], make([]byte, l)...)
 		l, err = m.MarshalTo(b)
 	}
-	return b[:l], err
+	if err != nil {
+		return nil, err
+	}
+	return b[:l], nil
 }
 
 func (m Message) MarshalTo(buf []byte) (int, error) {
@@ -112,6 +115,12 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 }
 
 func (m *Message) Unmarshal(data []byte) (int, error) {
+	return m.UnmarshalWithLimits(data, message.ParserLimits{})
+}
+
+// UnmarshalWithLimits decodes the message and checks it by the limits. The message exceeding them is decoded
+// and message.ParserLimitError is returned.
+func (m *Message) UnmarshalWithLimits(data []byte, limits message.ParserLimits) (int, error) {
 	size := len(data)
 	if size < 4 {
 		return -1, ErrMessageTruncated
@@ -155,5 +164,8 @@ func (m *Message) Unmarshal(data []byte) (int, error) {
 	m.Type = typ
 	m.MessageID = messageID
 
+	if err := limits.Check(token, m.Options, data); err != nil {
+		return size, err
+	}
 	return size, nil
 }
@@ -0,0 +1,83 @@
+//go:build !race
+
+// The race detector drops messages of sync.Pool randomly, so allocations are counted only without it.
+
+package pool_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapPool "github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageFastPathAllocations(t *testing.T) {
+	ctx := context.Background()
+	// fill the pool
+	require.NoError(t, marshalConfirmableRequest(ctx))
+	require.NoError(t, unmarshalAcknowledgement(ctx))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		err := marshalConfirmableRequest(ctx)
+		require.NoError(t, err)
+	})
+	require.Equal(t, float64(0), allocs, "marshal of confirmable request")
+	allocs = testing.AllocsPerRun(100, func() {
+		err := unmarshalAcknowledgement(ctx)
+		require.NoError(t, err)
+	})
+	require.Equal(t, float64(0), allocs, "unmarshal of acknowledgement")
+}
+
+func TestCopyBody(t *testing.T) {
+	ctx := context.Background()
+	var body bytes.Reader
+	// fill the pool
+	require.NoError(t, marshalResponse(ctx, &body))
+	allocs := testing.AllocsPerRun(100, func() {
+		err := marshalResponse(ctx, &body)
+		require.NoError(t, err)
+	})
+	require.Equal(t, float64(0), allocs, "marshal of response")
+
+	resp := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(resp)
+	buf := []byte("hello")
+	_, err := resp.CopyBody(bytes.NewReader(buf))
+	require.NoError(t, err)
+	copy(buf, "xxxxx")
+	data, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), data)
+}
+
+func TestSetAllocationAudit(t *testing.T) {
+	ctx := context.Background()
+	// fill the pool
+	require.NoError(t, unmarshalAcknowledgement(ctx))
+
+	var allocs []coapPool.Allocation
+	pool.SetAllocationAudit(func(a coapPool.Allocation) {
+		allocs = append(allocs, a)
+	})
+	defer pool.SetAllocationAudit(nil)
+
+	require.NoError(t, unmarshalAcknowledgement(ctx))
+	require.Empty(t, allocs)
+
+	req := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(req)
+	req.SetCode(codes.POST)
+	req.SetMessageID(1)
+	req.SetBody(bytes.NewReader(make([]byte, 1024)))
+	_, err := req.Marshal()
+	require.NoError(t, err)
+	require.NotEmpty(t, allocs)
+	require.Equal(t, "body", allocs[0].What)
+	require.Equal(t, 1024, allocs[0].Size)
+	require.NotEmpty(t, allocs[0].Stack)
+}
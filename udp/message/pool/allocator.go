@@ -0,0 +1,98 @@
+package pool
+
+import (
+	"sync/atomic"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+)
+
+// Allocator recycles messages of AcquireMessage and ReleaseMessage, e.g. to keep them with their buffers in an
+// arena or in a memory mapped file instead of the Go heap. As clients, servers and blockwise transfers acquire
+// and release messages by AcquireMessage and ReleaseMessage, the allocator is used by all of them, except of those
+// which own a Pool set by WithMessagePool.
+//
+// Implementations must be safe for concurrent use.
+type Allocator interface {
+	// Get returns a released message or nil, then AcquireMessage creates a new one by NewMessage.
+	Get() *Message
+	// Put keeps the released message for reuse or drops it. The message is already reset.
+	Put(m *Message)
+}
+
+// Buffers are initial buffers of a message. Unmarshaling, marshaling and reading of body reuse them,
+// and they are reallocated on the Go heap when they are too small or when Reset finds them too big.
+type Buffers struct {
+	// Data holds the unmarshaled datagram.
+	Data []byte
+	// MarshalData holds the marshaled message.
+	MarshalData []byte
+	// BodyData holds the body read by ReadBody.
+	BodyData []byte
+	// Options holds options of the unmarshaled message.
+	Options message.Options
+}
+
+// NewMessage creates message with the buffers, e.g. allocated by an Allocator in an arena. Buffers which are
+// nil are allocated on the Go heap.
+func NewMessage(buffers Buffers) *Message {
+	return newMessage(buffers, defaultPool.instrumentation)
+}
+
+func newMessage(buffers Buffers, instrumentation *pool.Instrumentation) *Message {
+	if buffers.Data == nil {
+		buffers.Data = make([]byte, initialBufferSize)
+	}
+	if buffers.MarshalData == nil {
+		buffers.MarshalData = make([]byte, initialBufferSize)
+	}
+	if buffers.BodyData == nil {
+		buffers.BodyData = make([]byte, initialBufferSize)
+	}
+	if buffers.Options == nil {
+		buffers.Options = make(message.Options, 0, 16)
+	}
+	return &Message{
+		Message:        instrumentation.NewMessage(),
+		rawData:        buffers.Data,
+		rawMarshalData: buffers.MarshalData,
+		rawBodyData:    buffers.BodyData,
+		rawOptions:     buffers.Options[:0],
+	}
+}
+
+var _ pool.Codec = (*Message)(nil)
+
+// defaultAllocator keeps messages in the package-level pool.
+type defaultAllocator struct{}
+
+func (defaultAllocator) Get() *Message {
+	return defaultPool.take()
+}
+
+func (defaultAllocator) Put(m *Message) {
+	defaultPool.keep(m)
+}
+
+type allocatorHolder struct {
+	allocator Allocator
+}
+
+var allocator atomic.Value
+
+func getAllocator() Allocator {
+	if h, ok := allocator.Load().(allocatorHolder); ok {
+		return h.allocator
+	}
+	return defaultAllocator{}
+}
+
+// SetAllocator replaces allocator of AcquireMessage and ReleaseMessage, nil restores the default one. Messages
+// released after the change are passed to the new allocator, so it should be set before the first message is
+// acquired.
+func SetAllocator(a Allocator) {
+	if a == nil {
+		a = defaultAllocator{}
+	}
+	allocator.Store(allocatorHolder{allocator: a})
+}
@@ -5,8 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"sync"
-	"sync/atomic"
+	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -14,63 +13,89 @@ import (
 	udp "github.com/plgd-dev/go-coap/v2/udp/message"
 )
 
-const maxMessagePool = 10240
-const maxMessageBufferSize = 2048
-
-var (
-	currentMessagesInPool int32
-	messagePool           sync.Pool
-)
-
 type Message struct {
 	*pool.Message
-	messageID *uint16
-	typ       udp.Type
+	messageID    uint16
+	hasMessageID bool
+	typ          udp.Type
 
 	//local vars
 	rawData        []byte
 	rawMarshalData []byte
+	rawBodyData    []byte
+	rawOptions     message.Options
+	rawBody        bytes.Reader
 
 	ctx        context.Context
 	isModified bool
+	// owner is the pool which acquired the message.
+	owner *Pool
 }
 
 // Reset clear message for next reuse
 func (r *Message) Reset() {
 	r.Message.Reset()
-	r.messageID = nil
+	r.messageID = 0
+	r.hasMessageID = false
 	r.typ = udp.NonConfirmable
-	if cap(r.rawData) > maxMessageBufferSize {
-		r.rawData = make([]byte, 256)
-	}
-	if cap(r.rawMarshalData) > maxMessageBufferSize {
-		r.rawMarshalData = make([]byte, 256)
-	}
+	p := r.pool()
+	r.rawData = p.shrink(r.rawData)
+	r.rawMarshalData = p.shrink(r.rawMarshalData)
+	r.rawBodyData = p.shrink(r.rawBodyData)
+	r.rawBody.Reset(nil)
 	r.isModified = false
 }
 
+// pool returns the pool which acquired the message, the package-level one for messages created by NewMessage.
+func (r *Message) pool() *Pool {
+	if r.owner == nil {
+		return defaultPool
+	}
+	return r.owner
+}
+
 func (r *Message) Context() context.Context {
 	return r.ctx
 }
 
+// SetContext replaces context of the message, which is independent of the context of the connection. When it is done
+// before the message is written, e.g. a notification waits for pacing, the stale message is dropped instead of sent
+// and writing fails with the context error.
+func (r *Message) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 func (r *Message) SetMessageID(mid uint16) {
-	r.messageID = &mid
+	r.messageID = mid
+	r.hasMessageID = true
 	r.isModified = true
 }
 
 func (r *Message) UpsertMessageID(mid uint16) uint16 {
-	if r.messageID != nil {
-		return *r.messageID
+	if r.hasMessageID {
+		return r.messageID
 	}
-	r.messageID = &mid
+	r.messageID = mid
+	r.hasMessageID = true
 	return mid
 }
 
+// ResetMessageID removes the message ID, so the request sent again gets a new one.
+func (r *Message) ResetMessageID() {
+	r.hasMessageID = false
+	r.isModified = true
+}
+
+// HasMessageID reports whether the message ID is set.
+func (r *Message) HasMessageID() bool {
+	return r.hasMessageID
+}
+
 func (r *Message) MessageID() uint16 {
-	if r.messageID == nil {
+	if !r.hasMessageID {
 		panic("messageID is not set")
 	}
-	return *r.messageID
+	return r.messageID
 }
 
 func (r *Message) SetType(typ udp.Type) {
@@ -91,40 +116,116 @@ func (r *Message) SetModified(b bool) {
 	r.Message.SetModified(b)
 }
 
+// Unmarshal decodes data into the message. Messages which fit into pooled buffers are decoded without allocations.
 func (r *Message) Unmarshal(data []byte) (int, error) {
+	return r.UnmarshalWithLimits(data, message.ParserLimits{})
+}
+
+// UnmarshalWithLimits is Unmarshal which checks the message by the limits. The message exceeding them is decoded
+// and message.ParserLimitError is returned, so the request can be answered.
+func (r *Message) UnmarshalWithLimits(data []byte, limits message.ParserLimits) (int, error) {
 	if len(r.rawData) < len(data) {
 		r.rawData = append(r.rawData, make([]byte, len(data)-len(r.rawData))...)
+		r.pool().instrumentation.OnAllocation("data", cap(r.rawData))
 	}
 	copy(r.rawData, data)
 	r.rawData = r.rawData[:len(data)]
-	m := &udp.Message{
-		Options: make(message.Options, 0, 16),
+	m := udp.Message{
+		Options: r.rawOptions[:0],
 	}
 
-	n, err := m.Unmarshal(r.rawData)
-	if err != nil {
+	n, err := m.UnmarshalWithLimits(r.rawData, limits)
+	if _, ok := err.(*message.ParserLimitError); err != nil && !ok {
 		return n, err
 	}
+	if cap(m.Options) > cap(r.rawOptions) {
+		r.pool().instrumentation.OnAllocation("options", cap(m.Options))
+		r.rawOptions = m.Options
+	}
 	r.Message.SetCode(m.Code)
 	r.Message.SetToken(m.Token)
 	r.Message.ResetOptionsTo(m.Options)
 	r.typ = m.Type
-	r.messageID = &m.MessageID
+	r.messageID = m.MessageID
+	r.hasMessageID = true
 	if len(m.Payload) > 0 {
-		r.Message.SetBody(bytes.NewReader(m.Payload))
+		r.rawBody.Reset(m.Payload)
+		r.Message.SetBody(&r.rawBody)
 	}
 	return n, err
 }
 
+// readBody reads body to the pooled buffer.
+func (r *Message) readBody() ([]byte, error) {
+	if r.Body() == nil {
+		return nil, nil
+	}
+	size, err := r.BodySize()
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	_, err = r.Body().Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	if int64(cap(r.rawBodyData)) < size {
+		r.rawBodyData = make([]byte, size)
+		r.pool().instrumentation.OnAllocation("body", int(size))
+	}
+	payload := r.rawBodyData[:size]
+	n, err := io.ReadFull(r.Body(), payload)
+	if (err == io.ErrUnexpectedEOF || err == io.EOF) && int64(n) == size {
+		err = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return payload[:n], nil
+}
+
+// CopyBody copies the body from s to the pooled buffer of the message and returns the copy, so s isn't referenced
+// by the message. The copy is valid until the message is released.
+func (r *Message) CopyBody(s io.ReadSeeker) ([]byte, error) {
+	r.Message.SetBody(s)
+	payload, err := r.readBody()
+	if err != nil {
+		return nil, err
+	}
+	r.rawBody.Reset(payload)
+	r.Message.SetBody(&r.rawBody)
+	return payload, nil
+}
+
+// Size returns length of the encoded message without encoding it.
+func (r *Message) Size() (int, error) {
+	payload, err := r.readBody()
+	if err != nil {
+		return -1, err
+	}
+	m := udp.Message{
+		Code:      r.Code(),
+		Token:     r.Message.TokenView(),
+		Options:   r.Message.Options(),
+		MessageID: r.MessageID(),
+		Type:      r.typ,
+		Payload:   payload,
+	}
+	return m.Size()
+}
+
+// Marshal encodes the message. Messages which fit into pooled buffers are encoded without allocations.
+// The returned data are valid only until the next call of Marshal or until the message is released.
 func (r *Message) Marshal() ([]byte, error) {
 	m := udp.Message{
 		Code:      r.Code(),
-		Token:     r.Message.Token(),
+		Token:     r.Message.TokenView(),
 		Options:   r.Message.Options(),
 		MessageID: r.MessageID(),
 		Type:      r.typ,
 	}
-	payload, err := r.ReadBody()
+	payload, err := r.readBody()
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +236,7 @@ func (r *Message) Marshal() ([]byte, error) {
 	}
 	if len(r.rawMarshalData) < size {
 		r.rawMarshalData = append(r.rawMarshalData, make([]byte, size-len(r.rawMarshalData))...)
+		r.pool().instrumentation.OnAllocation("data", cap(r.rawMarshalData))
 	}
 	n, err := m.MarshalTo(r.rawMarshalData)
 	if err != nil {
@@ -158,34 +260,51 @@ func (r *Message) String() string {
 // no longer needed. This allows Message recycling, reduces GC pressure
 // and usually improves performance.
 func AcquireMessage(ctx context.Context) *Message {
-	v := messagePool.Get()
-	if v == nil {
-		return &Message{
-			Message:        pool.NewMessage(),
-			rawData:        make([]byte, 256),
-			rawMarshalData: make([]byte, 256),
-			ctx:            ctx,
-		}
-	}
-	r := v.(*Message)
-	atomic.AddInt32(&currentMessagesInPool, -1)
-	r.ctx = ctx
-	return r
+	return defaultPool.AcquireMessage(ctx)
 }
 
-// ReleaseMessage returns req acquired via AcquireMessage to Message pool.
+// ReleaseMessage returns req acquired via AcquireMessage or Pool.AcquireMessage to the pool which acquired it.
 //
 // It is forbidden accessing req and/or its' members after returning
 // it to Message pool.
 func ReleaseMessage(req *Message) {
-	v := atomic.LoadInt32(&currentMessagesInPool)
-	if v >= maxMessagePool {
-		return
-	}
-	atomic.AddInt32(&currentMessagesInPool, 1)
-	req.Reset()
-	req.ctx = nil
-	messagePool.Put(req)
+	req.pool().release(req)
+}
+
+// Stats returns usage statistics of Message pool.
+func Stats() pool.Stats {
+	return defaultPool.Stats()
+}
+
+// SetOccupancyWatermark calls onCross when number of acquired and not yet released messages reaches watermark.
+//
+// It helps to detect messages which are acquired but never released.
+func SetOccupancyWatermark(watermark int64, onCross pool.WatermarkFunc) {
+	defaultPool.instrumentation.SetOccupancyWatermark(watermark, onCross)
+}
+
+// SetMissRateWatermark calls onCross when ratio of allocations to acquisitions over window of acquisitions
+// reaches watermark.
+func SetMissRateWatermark(watermark float64, window uint64, onCross pool.WatermarkFunc) {
+	defaultPool.instrumentation.SetMissRateWatermark(watermark, window, onCross)
+}
+
+// EnableLeakDetection records acquisition stacks of messages and every interval reports
+// messages which are held longer than threshold. It returns function which stops the detection.
+//
+// Recording stacks is expensive, use it only for debugging.
+func EnableLeakDetection(threshold, interval time.Duration, onLeak pool.LeakFunc) func() {
+	return defaultPool.instrumentation.EnableLeakDetection(threshold, interval, onLeak)
+}
+
+// SetAllocationAudit calls onAlloc for every allocation made by the pool or by pooled messages.
+// Messages are reused and their buffers are retained, so in the steady state marshaling
+// or unmarshaling of small messages doesn't allocate and each reported allocation points
+// to an unexpected one. Nil onAlloc disables the audit.
+//
+// Recording stacks is expensive, use it only for debugging.
+func SetAllocationAudit(onAlloc pool.AllocationFunc) {
+	defaultPool.instrumentation.SetAllocationAudit(onAlloc)
 }
 
 // ConvertFrom converts common message to pool message.
@@ -1,12 +1,17 @@
 package pool_test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
+	"runtime"
 	"sync"
 	"testing"
 
+	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,3 +37,202 @@ func Test_ConvertTo(t *testing.T) {
 	require.NoError(t, err)
 	wg.Wait()
 }
+
+var (
+	benchToken = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	// ACK with token, content format text/plain and payload "hello"
+	benchAck     = []byte{0x68, byte(codes.Content), 0x12, 0x34, 1, 2, 3, 4, 5, 6, 7, 8, 0xc0, 0xff, 'h', 'e', 'l', 'l', 'o'}
+	benchPayload = bytes.Repeat([]byte("a"), 256)
+)
+
+func marshalConfirmableRequest(ctx context.Context) error {
+	req := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(req)
+	req.SetCode(codes.GET)
+	req.SetToken(benchToken)
+	req.SetPath("/oic/res")
+	req.SetType(udpMessage.Confirmable)
+	req.SetMessageID(0x1234)
+	_, err := req.Marshal()
+	return err
+}
+
+func unmarshalAcknowledgement(ctx context.Context) error {
+	resp := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(resp)
+	_, err := resp.Unmarshal(benchAck)
+	if err != nil {
+		return err
+	}
+	if resp.Type() != udpMessage.Acknowledgement || resp.MessageID() != 0x1234 || resp.Code() != codes.Content {
+		return fmt.Errorf("unexpected message %v", resp)
+	}
+	return nil
+}
+
+func marshalResponse(ctx context.Context, body *bytes.Reader) error {
+	resp := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.Content)
+	resp.SetToken(benchToken)
+	resp.SetContentFormat(message.TextPlain)
+	resp.SetType(udpMessage.Acknowledgement)
+	resp.SetMessageID(0x1234)
+	body.Reset(benchPayload)
+	payload, err := resp.CopyBody(body)
+	if err != nil {
+		return err
+	}
+	var etag [8]byte
+	resp.SetOptionBytes(message.ETag, message.AppendETag(etag[:0], payload))
+	_, err = resp.Marshal()
+	return err
+}
+
+func BenchmarkMarshalResponse(b *testing.B) {
+	ctx := context.Background()
+	var body bytes.Reader
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := marshalResponse(ctx, &body)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalConfirmableRequest(b *testing.B) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := marshalConfirmableRequest(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalAcknowledgement(b *testing.B) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := unmarshalAcknowledgement(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// arena hands out messages whose buffers are slices of one preallocated array.
+type arena struct {
+	mutex sync.Mutex
+	buf   []byte
+	free  []*pool.Message
+	puts  int
+}
+
+func (a *arena) Get() *pool.Message {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if len(a.free) > 0 {
+		m := a.free[len(a.free)-1]
+		a.free = a.free[:len(a.free)-1]
+		return m
+	}
+	if len(a.buf) < 3*256 {
+		return nil
+	}
+	chunk := a.buf[: 3*256 : 3*256]
+	a.buf = a.buf[3*256:]
+	return pool.NewMessage(pool.Buffers{
+		Data:        chunk[:256:256],
+		MarshalData: chunk[256:512:512],
+		BodyData:    chunk[512:],
+	})
+}
+
+func (a *arena) Put(m *pool.Message) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.puts++
+	a.free = append(a.free, m)
+}
+
+func TestSetAllocator(t *testing.T) {
+	mem := make([]byte, 3*256)
+	a := &arena{buf: mem}
+	pool.SetAllocator(a)
+	defer pool.SetAllocator(nil)
+
+	ctx := context.Background()
+	req := pool.AcquireMessage(ctx)
+	req.SetCode(codes.GET)
+	req.SetMessageID(1)
+	req.SetPath("/a")
+	data, err := req.Marshal()
+	require.NoError(t, err)
+	// the message is marshaled to the arena
+	require.Same(t, &mem[256], &data[0])
+	resp := pool.AcquireMessage(ctx)
+	_, err = resp.Unmarshal(data)
+	require.NoError(t, err)
+	require.Equal(t, codes.GET, resp.Code())
+	pool.ReleaseMessage(resp)
+	pool.ReleaseMessage(req)
+	require.Equal(t, 2, a.puts)
+	require.Same(t, req, pool.AcquireMessage(ctx))
+}
+
+func TestPool(t *testing.T) {
+	p := pool.NewPool(1, 64)
+	ctx := context.Background()
+	defaultStats := pool.Stats()
+
+	big := p.AcquireMessage(ctx)
+	big.SetCode(codes.Content)
+	big.SetMessageID(1)
+	big.SetBody(bytes.NewReader(make([]byte, 128)))
+	_, err := big.Marshal()
+	require.NoError(t, err)
+	small := p.AcquireMessage(ctx)
+	require.Equal(t, uint64(2), p.Stats().Allocated)
+
+	// messages return to the pool which acquired them, buffers of the body and the marshaled big exceed its limit
+	pool.ReleaseMessage(big)
+	pool.ReleaseMessage(small)
+	stats := p.Stats()
+	require.Equal(t, uint64(2), stats.Acquired)
+	require.Equal(t, uint64(2), stats.Released)
+	require.Equal(t, int64(1), stats.Pooled)
+	require.Equal(t, uint64(1), stats.Discarded)
+	require.Equal(t, uint64(2), stats.Oversized)
+	require.Equal(t, defaultStats.Acquired, pool.Stats().Acquired)
+
+	// the pool of a nil Pool is the package-level one
+	var nilPool *pool.Pool
+	m := nilPool.AcquireMessage(ctx)
+	pool.ReleaseMessage(m)
+	require.Equal(t, defaultStats.Acquired+1, pool.Stats().Acquired)
+	require.Equal(t, uint64(2), p.Stats().Acquired)
+}
+
+func TestPool_KeepsMessagesAcrossGC(t *testing.T) {
+	p := pool.NewPool(4, 0)
+	ctx := context.Background()
+	for round := 0; round < 3; round++ {
+		msgs := make([]*pool.Message, 4)
+		for i := range msgs {
+			msgs[i] = p.AcquireMessage(ctx)
+		}
+		for _, m := range msgs {
+			pool.ReleaseMessage(m)
+		}
+		// released messages aren't dropped by the garbage collector, so the pool hits again
+		runtime.GC()
+		runtime.GC()
+	}
+	stats := p.Stats()
+	require.Equal(t, uint64(8), stats.Hits)
+	require.Equal(t, int64(4), stats.Pooled)
+	require.Equal(t, uint64(0), stats.Discarded)
+}
@@ -0,0 +1,163 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/plgd-dev/go-coap/v2/message/pool"
+)
+
+// Pool recycles messages of servers and clients which own it, e.g. to bound and observe memory of messages
+// per listener of a multi-tenant process. Set it by WithMessagePool of udp or dtls, otherwise the package-level
+// pool of AcquireMessage is used. ReleaseMessage returns a message to the pool which acquired it.
+//
+// A nil Pool is the package-level pool. Multiple goroutines may invoke methods on a Pool simultaneously.
+type Pool struct {
+	// These fields need to be the first in the struct to ensure proper word alignment on 32-bit platforms.
+	// See: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	discarded uint64
+	oversized uint64
+
+	maxMessages     int
+	maxBufferSize   int
+	bufferSize      int
+	instrumentation *pool.Instrumentation
+	// useAllocator keeps messages by the allocator of SetAllocator, it is set for the package-level pool.
+	useAllocator bool
+
+	// free keeps released messages, unlike sync.Pool the garbage collector doesn't drop them, so the limit
+	// and the statistics are exact.
+	mutex sync.Mutex
+	free  []*Message
+}
+
+var defaultPool = func() *Pool {
+	p := NewPool(0, 0)
+	p.useAllocator = true
+	return p
+}()
+
+// NewPool creates pool which keeps at most maxMessages released messages and drops buffers of released
+// messages bigger than maxBufferSize bytes. Zero values mean limits of the package-level pool.
+func NewPool(maxMessages, maxBufferSize int) *Pool {
+	if maxMessages <= 0 {
+		maxMessages = defaultMaxMessages
+	}
+	if maxBufferSize <= 0 {
+		maxBufferSize = defaultMaxBufferSize
+	}
+	bufferSize := initialBufferSize
+	if bufferSize > maxBufferSize {
+		bufferSize = maxBufferSize
+	}
+	return &Pool{
+		maxMessages:     maxMessages,
+		maxBufferSize:   maxBufferSize,
+		bufferSize:      bufferSize,
+		instrumentation: pool.NewInstrumentation(),
+	}
+}
+
+// AcquireMessage returns an empty Message instance from the pool, see AcquireMessage.
+func (p *Pool) AcquireMessage(ctx context.Context) *Message {
+	if p == nil {
+		p = defaultPool
+	}
+	r := p.get()
+	p.instrumentation.OnAcquire(r == nil)
+	if r == nil {
+		r = newMessage(Buffers{
+			Data:        make([]byte, p.bufferSize),
+			MarshalData: make([]byte, p.bufferSize),
+			BodyData:    make([]byte, p.bufferSize),
+		}, p.instrumentation)
+	}
+	r.owner = p
+	r.ctx = ctx
+	p.instrumentation.Track(r)
+	return r
+}
+
+func (p *Pool) release(r *Message) {
+	p.instrumentation.OnRelease()
+	p.instrumentation.Untrack(r)
+	r.Reset()
+	r.ctx = nil
+	p.put(r)
+}
+
+// Stats returns usage statistics of the pool.
+func (p *Pool) Stats() pool.Stats {
+	if p == nil {
+		p = defaultPool
+	}
+	s := p.instrumentation.Stats()
+	s.Pooled = int64(p.pooledMessages())
+	s.Discarded = atomic.LoadUint64(&p.discarded)
+	s.Oversized = atomic.LoadUint64(&p.oversized)
+	return s
+}
+
+// Instrumentation returns instrumentation of the pool, e.g. to set watermarks or to enable leak detection.
+func (p *Pool) Instrumentation() *pool.Instrumentation {
+	if p == nil {
+		p = defaultPool
+	}
+	return p.instrumentation
+}
+
+func (p *Pool) get() *Message {
+	if p.useAllocator {
+		return getAllocator().Get()
+	}
+	return p.take()
+}
+
+func (p *Pool) put(r *Message) {
+	if p.useAllocator {
+		getAllocator().Put(r)
+		return
+	}
+	p.keep(r)
+}
+
+// take returns a kept message or nil.
+func (p *Pool) take() *Message {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	n := len(p.free)
+	if n == 0 {
+		return nil
+	}
+	r := p.free[n-1]
+	p.free[n-1] = nil
+	p.free = p.free[:n-1]
+	return r
+}
+
+// keep keeps the message for reuse unless the pool is full.
+func (p *Pool) keep(r *Message) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.free) >= p.maxMessages {
+		atomic.AddUint64(&p.discarded, 1)
+		return
+	}
+	p.free = append(p.free, r)
+}
+
+func (p *Pool) pooledMessages() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.free)
+}
+
+// shrink returns buf, or a new buffer of the initial size when buf exceeds the buffer limit of the pool.
+func (p *Pool) shrink(buf []byte) []byte {
+	if cap(buf) <= p.maxBufferSize {
+		return buf
+	}
+	atomic.AddUint64(&p.oversized, 1)
+	return make([]byte, p.bufferSize)
+}
@@ -0,0 +1,7 @@
+//go:build !tinygo
+
+package pool
+
+const defaultMaxMessages = 10240
+const defaultMaxBufferSize = 2048
+const initialBufferSize = 256
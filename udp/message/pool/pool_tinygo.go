@@ -0,0 +1,8 @@
+//go:build tinygo
+
+package pool
+
+// TinyGo targets have little memory and a simple garbage collector, so fewer and smaller messages are kept.
+const defaultMaxMessages = 16
+const defaultMaxBufferSize = 1280
+const initialBufferSize = 128
@@ -0,0 +1,126 @@
+package udp
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// All CoAP Nodes multicast addresses (RFC 7252 section 12.8).
+const (
+	AllCoAPNodesIPv4          = "224.0.1.187"
+	AllCoAPNodesIPv6LinkLocal = "ff02::fd"
+	AllCoAPNodesIPv6SiteLocal = "ff05::fd"
+)
+
+// Multicast sends NON GET request with the path to multicast address, e.g. "224.0.1.187:5683", from an ephemeral port
+// and calls respHandler with the address of the responder for each response until the context is done.
+func Multicast(ctx context.Context, address, path string, respHandler func(from net.Addr, resp *pool.Message), opts ...MulticastOption) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return fmt.Errorf("cannot resolve address: %w", err)
+	}
+	network := "udp4"
+	if coapNet.IsIPv6(addr.IP) {
+		network = "udp6"
+	}
+	l, err := coapNet.NewListenUDP(network, "")
+	if err != nil {
+		return fmt.Errorf("cannot listen: %w", err)
+	}
+	defer l.Close()
+
+	var serveErr error
+	var wg sync.WaitGroup
+	s := NewServer(WithContext(ctx))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serveErr = s.Serve(l)
+	}()
+	err = s.Discover(ctx, address, path, func(cc *client.ClientConn, resp *pool.Message) {
+		respHandler(cc.RemoteAddr(), resp)
+	}, opts...)
+	s.Stop()
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return serveErr
+}
+
+func (s *Server) joinMulticastGroups(l *coapNet.UDPConn) []*net.UDPAddr {
+	groups := make([]*net.UDPAddr, 0, len(s.multicastGroups))
+	for _, g := range s.multicastGroups {
+		ip := net.ParseIP(g)
+		if ip == nil || !ip.IsMulticast() {
+			s.errors(fmt.Errorf("cannot join multicast group %v: invalid address", g))
+			continue
+		}
+		group := &net.UDPAddr{IP: ip}
+		if err := l.JoinGroupAll(group); err != nil {
+			s.errors(err)
+			continue
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func leaveMulticastGroups(l *coapNet.UDPConn, groups []*net.UDPAddr) {
+	for _, group := range groups {
+		_ = l.LeaveGroupAll(group)
+	}
+}
+
+func (s *Server) read(l *coapNet.UDPConn, buf []byte) (int, *net.UDPAddr, net.IP, error) {
+	if s.multicastLeisure <= 0 {
+		n, raddr, err := l.ReadWithContext(s.ctx, buf)
+		return n, raddr, nil, err
+	}
+	n, raddr, dst, err := l.ReadWithDestination(s.ctx, buf)
+	if err == nil && dst == nil {
+		// listener bound to the group receives only multicast
+		if laddr, ok := l.LocalAddr().(*net.UDPAddr); ok && laddr.IP.IsMulticast() {
+			dst = laddr.IP
+		}
+	}
+	return n, raddr, dst, err
+}
+
+func isMulticastRequest(dst net.IP, datagram []byte) bool {
+	if dst == nil || !dst.IsMulticast() || len(datagram) < 2 {
+		return false
+	}
+	// request codes have class 0
+	code := codes.Code(datagram[1])
+	return code != codes.Empty && code>>5 == 0
+}
+
+// processWithLeisure processes the request received via multicast after a random time within the leisure.
+func (s *Server) processWithLeisure(cc *client.ClientConn, datagram []byte) {
+	data := append([]byte(nil), datagram...)
+	delay := time.Duration(rand.Int63n(int64(s.multicastLeisure)))
+	time.AfterFunc(delay, func() {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-cc.Context().Done():
+			return
+		default:
+		}
+		err := cc.ProcessMulticast(data)
+		if err != nil {
+			cc.Close()
+			s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+		}
+	})
+}
@@ -5,9 +5,17 @@ import (
 	"net"
 	"time"
 
+	"github.com/plgd-dev/go-coap/v2/cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/metrics"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 )
 
 // HandlerFuncOpt handler function option.
@@ -82,6 +90,28 @@ func WithErrors(errors ErrorFunc) ErrorsOpt {
 	return ErrorsOpt{errors: errors}
 }
 
+// LoggerOpt logger option.
+type LoggerOpt struct {
+	logger coapNet.Logger
+}
+
+func (o LoggerOpt) apply(opts *serverOptions) {
+	opts.logger = o.logger
+	opts.errors = coapNet.LogErrors(o.logger)
+}
+
+func (o LoggerOpt) applyDial(opts *dialOptions) {
+	opts.logger = o.logger
+	opts.errors = coapNet.LogErrors(o.logger)
+}
+
+// WithLogger sets leveled logger of errors and of events of connections: opening and closing of sessions,
+// retransmissions, dropped duplicates, blockwise steps and registrations and deregistrations of observations.
+// It replaces the function set by WithErrors before it.
+func WithLogger(logger coapNet.Logger) LoggerOpt {
+	return LoggerOpt{logger: logger}
+}
+
 // GoPoolOpt gopool option.
 type GoPoolOpt struct {
 	goPool GoPoolFunc
@@ -104,34 +134,36 @@ func WithGoPool(goPool GoPoolFunc) GoPoolOpt {
 
 // KeepAliveOpt keepalive option.
 type KeepAliveOpt struct {
-	maxRetries uint32
-	timeout    time.Duration
+	params     *inactivity.KeepAliveParams
 	onInactive inactivity.OnInactiveFunc
 }
 
 func (o KeepAliveOpt) apply(opts *serverOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*client.ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
-	}
+	opts.createInactivityMonitor = o.createMonitor
 }
 
 func (o KeepAliveOpt) applyDial(opts *dialOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*client.ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
-	}
+	opts.createInactivityMonitor = o.createMonitor
+}
+
+func (o KeepAliveOpt) createMonitor() inactivity.Monitor {
+	return inactivity.NewKeepAliveWithParams(o.params, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
+		return cc.(*client.ClientConn).AsyncPing(receivePong)
+	})
+}
+
+// WithKeepAlive pings the connection idle for interval by an Empty confirmable message and calls onInactive when the peer
+// doesn't answer within timeout, e.g. to clean up state of a device which went silent. Round-trip time of the last
+// ping is reported by Snapshot of the connection. The interval is at least inactivity.MinKeepAliveInterval.
+func WithKeepAlive(interval, timeout time.Duration, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+	return WithKeepAliveParams(inactivity.NewKeepAliveParams(interval, timeout), onInactive)
 }
 
-// WithKeepAlive monitoring's client connection's.
-func WithKeepAlive(maxRetries uint32, timeout time.Duration, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+// WithKeepAliveParams is WithKeepAlive with the interval and timeout shared by all connections, which can be
+// changed without restarting the server.
+func WithKeepAliveParams(params *inactivity.KeepAliveParams, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
 	return KeepAliveOpt{
-		maxRetries: maxRetries,
-		timeout:    timeout,
+		params:     params,
 		onInactive: onInactive,
 	}
 }
@@ -218,6 +250,62 @@ func WithBlockwise(enable bool, szx blockwise.SZX, transferTimeout time.Duration
 	}
 }
 
+// BlockwiseLimitsOpt network option.
+type BlockwiseLimitsOpt struct {
+	limits blockwise.Limits
+}
+
+func (o BlockwiseLimitsOpt) apply(opts *serverOptions) {
+	opts.blockwiseLimits = o.limits
+}
+
+func (o BlockwiseLimitsOpt) applyDial(opts *dialOptions) {
+	opts.blockwiseLimits = o.limits
+}
+
+// WithBlockwiseLimits sets timeouts and memory caps of partial blockwise transfers per peer, and function
+// which is called when a stalled transfer is dropped.
+func WithBlockwiseLimits(limits blockwise.Limits) BlockwiseLimitsOpt {
+	return BlockwiseLimitsOpt{limits: limits}
+}
+
+// BlockwiseProgressOpt network option.
+type BlockwiseProgressOpt struct {
+	progress blockwise.ProgressFunc
+}
+
+func (o BlockwiseProgressOpt) apply(opts *serverOptions) {
+	opts.blockwiseProgress = o.progress
+}
+
+func (o BlockwiseProgressOpt) applyDial(opts *dialOptions) {
+	opts.blockwiseProgress = o.progress
+}
+
+// WithBlockwiseProgress sets function which is called after each block of bodies transferred in multiple blocks,
+// e.g. to show progress of a firmware update. A transfer of a request is aborted by cancellation of its context.
+func WithBlockwiseProgress(progress blockwise.ProgressFunc) BlockwiseProgressOpt {
+	return BlockwiseProgressOpt{progress: progress}
+}
+
+// BlockwiseOptionsOpt network option.
+type BlockwiseOptionsOpt struct {
+	opts []blockwise.Option
+}
+
+func (o BlockwiseOptionsOpt) apply(opts *serverOptions) {
+	opts.blockwiseOptions = o.opts
+}
+
+func (o BlockwiseOptionsOpt) applyDial(opts *dialOptions) {
+	opts.blockwiseOptions = o.opts
+}
+
+// WithBlockwiseOptions sets additional options of blockwise transfer, e.g. blockwise.WithQBlock().
+func WithBlockwiseOptions(opts ...blockwise.Option) BlockwiseOptionsOpt {
+	return BlockwiseOptionsOpt{opts: opts}
+}
+
 // OnNewClientConnOpt network option.
 type OnNewClientConnOpt struct {
 	onNewClientConn OnNewClientConnFunc
@@ -239,29 +327,88 @@ type TransmissionOpt struct {
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newTransmissionParams          client.NewTransmissionParamsFunc
 }
 
 func (o TransmissionOpt) apply(opts *serverOptions) {
+	opts.newTransmissionParams = o.newTransmissionParams
+	if o.newTransmissionParams != nil {
+		return
+	}
 	opts.transmissionNStart = o.transmissionNStart
 	opts.transmissionAcknowledgeTimeout = o.transmissionAcknowledgeTimeout
 	opts.transmissionMaxRetransmit = o.transmissionMaxRetransmit
 }
 
 func (o TransmissionOpt) applyDial(opts *dialOptions) {
+	opts.newTransmissionParams = o.newTransmissionParams
+	if o.newTransmissionParams != nil {
+		return
+	}
 	opts.transmissionNStart = o.transmissionNStart
 	opts.transmissionAcknowledgeTimeout = o.transmissionAcknowledgeTimeout
 	opts.transmissionMaxRetransmit = o.transmissionMaxRetransmit
 }
 
-// WithTransmission set options for (re)transmission for Confirmable message-s.
+// WithTransmission set options for (re)transmission for Confirmable message-s. When newTransmissionParams
+// is set, every connection gets adaptive parameters created by it, e.g. client.NewCoCoA, instead of the fixed ones.
 func WithTransmission(transmissionNStart time.Duration,
 	transmissionAcknowledgeTimeout time.Duration,
-	transmissionMaxRetransmit int) TransmissionOpt {
-	return TransmissionOpt{
+	transmissionMaxRetransmit int,
+	newTransmissionParams ...client.NewTransmissionParamsFunc) TransmissionOpt {
+	o := TransmissionOpt{
 		transmissionNStart:             transmissionNStart,
 		transmissionAcknowledgeTimeout: transmissionAcknowledgeTimeout,
 		transmissionMaxRetransmit:      transmissionMaxRetransmit,
 	}
+	for _, f := range newTransmissionParams {
+		if f != nil {
+			o.newTransmissionParams = f
+		}
+	}
+	return o
+}
+
+// WithTransmissionParams sets function which creates adaptive (re)transmission parameters for Confirmable
+// message-s of every connection, e.g. client.NewCoCoA. It replaces parameters set by WithTransmission.
+func WithTransmissionParams(newTransmissionParams client.NewTransmissionParamsFunc) TransmissionOpt {
+	return WithTransmission(0, 0, 0, newTransmissionParams)
+}
+
+// WithCoCoA sets CoCoA congestion control (draft-ietf-core-cocoa), which retransmits a message at most
+// maxRetransmit times by RTO adapted to every connection.
+func WithCoCoA(maxRetransmit int) TransmissionOpt {
+	return WithTransmissionParams(func() client.TransmissionParams {
+		return client.NewCoCoA(maxRetransmit)
+	})
+}
+
+// TransmissionConfigOpt transmission config option.
+type TransmissionConfigOpt struct {
+	config TransmissionConfig
+}
+
+func (o TransmissionConfigOpt) apply(opts *serverOptions) {
+	cfg := o.config.Normalize()
+	opts.newTransmissionParams = o.config.NewTransmissionParams
+	opts.nStart = cfg.NStart
+	opts.pacing.ProbingRate = cfg.ProbingRate
+	opts.multicastLeisure = cfg.DefaultLeisure
+}
+
+func (o TransmissionConfigOpt) applyDial(opts *dialOptions) {
+	cfg := o.config.Normalize()
+	opts.newTransmissionParams = o.config.NewTransmissionParams
+	opts.nStart = cfg.NStart
+	opts.pacing.ProbingRate = cfg.ProbingRate
+}
+
+// WithTransmissionConfig sets transmission parameters of RFC 7252 section 4.8: retransmissions of confirmable
+// messages by exponential back-off from randomized ACK_TIMEOUT, NSTART outstanding confirmable exchanges with
+// every peer, PROBING_RATE toward a peer which doesn't respond, DEFAULT_LEISURE of multicast requests. It replaces parameters set
+// by WithTransmission and WithTransmissionParams.
+func WithTransmissionConfig(config TransmissionConfig) TransmissionConfigOpt {
+	return TransmissionConfigOpt{config: config}
 }
 
 // CloseSocketOpt close socket option.
@@ -294,3 +441,680 @@ func WithDialer(dialer *net.Dialer) DialerOpt {
 		dialer: dialer,
 	}
 }
+
+// RawHandlerOpt raw handler option.
+type RawHandlerOpt struct {
+	h RawHandlerFunc
+}
+
+func (o RawHandlerOpt) apply(opts *serverOptions) {
+	opts.rawHandler = o.h
+}
+
+func (o RawHandlerOpt) applyDial(opts *dialOptions) {
+	opts.rawHandler = o.h
+}
+
+// WithRawHandler set handler which gets every incoming message before the message layer.
+// When the handler returns true, the message is neither deduplicated, acknowledged nor passed to the handler,
+// so it allows implementing own message exchanges over ClientConn.WriteRawMessage.
+func WithRawHandler(h RawHandlerFunc) RawHandlerOpt {
+	return RawHandlerOpt{h: h}
+}
+
+// ReliableTransportOpt reliable transport option.
+type ReliableTransportOpt struct {
+}
+
+func (o ReliableTransportOpt) apply(opts *serverOptions) {
+	opts.reliableTransport = true
+}
+
+func (o ReliableTransportOpt) applyDial(opts *dialOptions) {
+	opts.reliableTransport = true
+}
+
+// WithReliableTransport signals that the underlying transport guarantees delivery, so retransmissions
+// and deduplication of the message layer are disabled. Responses are still matched to requests by token.
+func WithReliableTransport() ReliableTransportOpt {
+	return ReliableTransportOpt{}
+}
+
+// ObservationStoreOpt observation store option.
+type ObservationStoreOpt struct {
+	store observation.Store
+}
+
+func (o ObservationStoreOpt) applyDial(opts *dialOptions) {
+	opts.observationStore = o.store
+}
+
+// WithObservationStore persists observations of the client to store, so they can be re-established
+// by ClientConn.RestoreObservations after restart.
+func WithObservationStore(store observation.Store) ObservationStoreOpt {
+	return ObservationStoreOpt{store: store}
+}
+
+// ObserveRecoveryOpt observe recovery option.
+type ObserveRecoveryOpt struct {
+	policy client.ObserveRecovery
+}
+
+func (o ObserveRecoveryOpt) apply(opts *serverOptions) {
+	opts.observeRecovery = o.policy
+}
+
+func (o ObserveRecoveryOpt) applyDial(opts *dialOptions) {
+	opts.observeRecovery = o.policy
+}
+
+// WithObserveRecovery sets policy by which ClientConn.Observe re-registers observations after Max-Age
+// expired or the remote endpoint became responsive again, and reports gaps in notifications.
+func WithObserveRecovery(policy client.ObserveRecovery) ObserveRecoveryOpt {
+	return ObserveRecoveryOpt{policy: policy}
+}
+
+// ControlLaneOpt control lane option.
+type ControlLaneOpt struct {
+	size int
+}
+
+func (o ControlLaneOpt) apply(opts *serverOptions) {
+	opts.controlLaneSize = o.size
+}
+
+func (o ControlLaneOpt) applyDial(opts *dialOptions) {
+	opts.controlLaneSize = o.size
+}
+
+// WithControlLane sets number of queued control messages, e.g. pings and acknowledgements, which are processed
+// by a dedicated go routine instead of goPool, so they aren't starved by handlers blocked in synchronous Do.
+// When the queue is full, control messages are processed by goPool. Zero disables the control lane.
+// Default is client.DefaultControlLaneSize.
+func WithControlLane(size int) ControlLaneOpt {
+	return ControlLaneOpt{size: size}
+}
+
+// OnRetransmitOpt on retransmit option.
+type OnRetransmitOpt struct {
+	onRetransmit client.RetransmitFunc
+}
+
+func (o OnRetransmitOpt) apply(opts *serverOptions) {
+	opts.onRetransmit = o.onRetransmit
+}
+
+func (o OnRetransmitOpt) applyDial(opts *dialOptions) {
+	opts.onRetransmit = o.onRetransmit
+}
+
+// WithOnRetransmit sets function which can update options of a confirmable request before it is retransmitted,
+// e.g. to refresh a short-lived authorization token instead of retransmitting stale credentials.
+func WithOnRetransmit(onRetransmit client.RetransmitFunc) OnRetransmitOpt {
+	return OnRetransmitOpt{onRetransmit: onRetransmit}
+}
+
+// OnExchangeOpt on exchange option.
+type OnExchangeOpt struct {
+	onExchange ExchangeFunc
+}
+
+func (o OnExchangeOpt) apply(opts *serverOptions) {
+	opts.onExchange = o.onExchange
+}
+
+func (o OnExchangeOpt) applyDial(opts *dialOptions) {
+	opts.onExchange = o.onExchange
+}
+
+// WithOnExchange set function which is called with the outcome of every confirmable exchange,
+// e.g. to export round trip times and retransmissions to metrics. It must not block.
+func WithOnExchange(onExchange ExchangeFunc) OnExchangeOpt {
+	return OnExchangeOpt{onExchange: onExchange}
+}
+
+// OnDuplicateOpt on duplicate option.
+type OnDuplicateOpt struct {
+	onDuplicate DuplicateFunc
+}
+
+func (o OnDuplicateOpt) apply(opts *serverOptions) {
+	opts.onDuplicate = o.onDuplicate
+}
+
+func (o OnDuplicateOpt) applyDial(opts *dialOptions) {
+	opts.onDuplicate = o.onDuplicate
+}
+
+// WithOnDuplicate set function which is called with every duplicate request, response or acknowledgement of
+// the peer which was suppressed, e.g. to find devices with broken retransmission timers. The counts are
+// available by ClientConn.DuplicateStats regardless of the option.
+func WithOnDuplicate(onDuplicate DuplicateFunc) OnDuplicateOpt {
+	return OnDuplicateOpt{onDuplicate: onDuplicate}
+}
+
+// BackpressureOpt backpressure option.
+type BackpressureOpt struct {
+	backpressure Backpressure
+}
+
+func (o BackpressureOpt) apply(opts *serverOptions) {
+	opts.backpressure = o.backpressure
+}
+
+func (o BackpressureOpt) applyDial(opts *dialOptions) {
+	opts.backpressure = o.backpressure
+}
+
+// WithBackpressure set function which is called when a notification is written to the observer with threshold
+// or more notifications being written, e.g. waiting for pacing or acknowledgements, so the application can
+// downsample notifications for the congested observer. The backlog is available by ClientConn.ObserverBacklog
+// regardless of the option.
+func WithBackpressure(threshold int, onSlow SlowObserverFunc) BackpressureOpt {
+	return BackpressureOpt{backpressure: Backpressure{Threshold: threshold, OnSlow: onSlow}}
+}
+
+// NonResponsePolicyOpt non response policy option.
+type NonResponsePolicyOpt struct {
+	policy NonResponsePolicy
+}
+
+func (o NonResponsePolicyOpt) apply(opts *serverOptions) {
+	opts.nonResponsePolicy = o.policy
+}
+
+func (o NonResponsePolicyOpt) applyDial(opts *dialOptions) {
+	opts.nonResponsePolicy = o.policy
+}
+
+// WithNonResponsePolicy set how responses to Non-confirmable requests are sent. By default
+// they are sent in Confirmable messages. Handlers can override it per request via
+// ResponseWriter.SetNonResponsePolicy.
+func WithNonResponsePolicy(policy NonResponsePolicy) NonResponsePolicyOpt {
+	return NonResponsePolicyOpt{policy: policy}
+}
+
+// PacingOpt pacing option.
+type PacingOpt struct {
+	rate  int
+	burst int
+}
+
+func (o PacingOpt) apply(opts *serverOptions) {
+	opts.pacing.Rate = o.rate
+	opts.pacing.Burst = o.burst
+}
+
+func (o PacingOpt) applyDial(opts *dialOptions) {
+	opts.pacing.Rate = o.rate
+	opts.pacing.Burst = o.burst
+}
+
+// WithPacing limits average rate of messages sent to every remote endpoint to rate bytes per second,
+// allowing bursts of burst bytes. It applies to requests, notifications and their retransmissions.
+func WithPacing(rate, burst int) PacingOpt {
+	return PacingOpt{rate: rate, burst: burst}
+}
+
+// ProbingRateOpt probing rate option.
+type ProbingRateOpt struct {
+	rate int
+}
+
+func (o ProbingRateOpt) apply(opts *serverOptions) {
+	opts.pacing.ProbingRate = o.rate
+}
+
+func (o ProbingRateOpt) applyDial(opts *dialOptions) {
+	opts.pacing.ProbingRate = o.rate
+}
+
+// WithProbingRate limits average rate of messages sent to remote endpoint which doesn't respond
+// to rate bytes per second, e.g. client.ProbingRate (RFC 7252 PROBING_RATE).
+func WithProbingRate(rate int) ProbingRateOpt {
+	return ProbingRateOpt{rate: rate}
+}
+
+// OSCOREOpt OSCORE option.
+type OSCOREOpt struct {
+	ctx *oscore.Context
+}
+
+func (o OSCOREOpt) apply(opts *serverOptions) {
+	opts.oscoreContext = o.ctx
+}
+
+func (o OSCOREOpt) applyDial(opts *dialOptions) {
+	opts.oscoreContext = o.ctx
+}
+
+// WithOSCORE protects requests, responses and notifications end-to-end by OSCORE (RFC 8613) security context.
+// Unprotected requests are rejected with 4.01 Unauthorized. A server shares the context by all connections.
+func WithOSCORE(ctx *oscore.Context) OSCOREOpt {
+	return OSCOREOpt{ctx: ctx}
+}
+
+// MulticastGroupsOpt multicast groups option.
+type MulticastGroupsOpt struct {
+	groups []string
+}
+
+func (o MulticastGroupsOpt) apply(opts *serverOptions) {
+	opts.multicastGroups = o.groups
+}
+
+// WithMulticastGroups joins the groups, e.g. AllCoAPNodesIPv4, on all multicast interfaces when the server
+// starts to serve and leaves them when serving ends.
+func WithMulticastGroups(groups ...string) MulticastGroupsOpt {
+	return MulticastGroupsOpt{groups: groups}
+}
+
+// MulticastLeisureOpt multicast leisure option.
+type MulticastLeisureOpt struct {
+	leisure time.Duration
+}
+
+func (o MulticastLeisureOpt) apply(opts *serverOptions) {
+	opts.multicastLeisure = o.leisure
+}
+
+// WithMulticastLeisure delays processing of each request received via multicast by a random time
+// within the leisure, so responses of group members don't collide (RFC 7252 section 8.2, DEFAULT_LEISURE is 5s).
+func WithMulticastLeisure(leisure time.Duration) MulticastLeisureOpt {
+	return MulticastLeisureOpt{leisure: leisure}
+}
+
+// TraceOpt trace option.
+type TraceOpt struct {
+	handler client.TraceHandler
+}
+
+func (o TraceOpt) apply(opts *serverOptions) {
+	opts.traceHandler = o.handler
+}
+
+func (o TraceOpt) applyDial(opts *dialOptions) {
+	opts.traceHandler = o.handler
+}
+
+// WithTrace calls handler with events of sent, received, retransmitted and deduplicated messages and blockwise
+// steps of each connection, e.g. to create OpenTelemetry spans.
+func WithTrace(handler client.TraceHandler) TraceOpt {
+	return TraceOpt{handler: handler}
+}
+
+// StatsOpt stats option.
+type StatsOpt struct {
+	stats metrics.Stats
+}
+
+func (o StatsOpt) apply(opts *serverOptions) {
+	opts.stats = o.stats
+}
+
+func (o StatsOpt) applyDial(opts *dialOptions) {
+	opts.stats = o.stats
+}
+
+// WithStats passes statistics of each connection to the collector: messages by code and type, retransmissions,
+// duplicates, blockwise transfers, sessions, observations and exchange latency. The collector of the package
+// metrics/prometheus exposes them to Prometheus.
+func WithStats(collector metrics.Stats) StatsOpt {
+	return StatsOpt{stats: collector}
+}
+
+// DeduplicationOpt deduplication option.
+type DeduplicationOpt struct {
+	newDedup client.NewDedupFunc
+}
+
+func (o DeduplicationOpt) apply(opts *serverOptions) {
+	opts.newDedup = o.newDedup
+}
+
+func (o DeduplicationOpt) applyDial(opts *dialOptions) {
+	opts.newDedup = o.newDedup
+}
+
+// WithDeduplication sets function which creates detection of duplicate requests of each connection,
+// e.g. client.NewDedupCache bounded by number of entries to limit memory of a high-throughput gateway.
+// By default responses are kept for client.ExchangeLifetime without limit of entries.
+func WithDeduplication(newDedup client.NewDedupFunc) DeduplicationOpt {
+	return DeduplicationOpt{newDedup: newDedup}
+}
+
+// PooledResponsesOpt pooled responses option.
+type PooledResponsesOpt struct {
+}
+
+func (o PooledResponsesOpt) apply(opts *serverOptions) {
+	opts.pooledResponses = true
+}
+
+func (o PooledResponsesOpt) applyDial(opts *dialOptions) {
+	opts.pooledResponses = true
+}
+
+// WithPooledResponses reuses response writers of handlers from a pool and copies bodies of responses to pooled
+// buffers of the messages, so handlers may reuse the readers they set and responses are created without
+// allocations, e.g. for servers where GC pressure matters. Bodies sent by blockwise transfer aren't copied.
+func WithPooledResponses() PooledResponsesOpt {
+	return PooledResponsesOpt{}
+}
+
+// EchoVerificationOpt echo verification option.
+type EchoVerificationOpt struct {
+	window time.Duration
+}
+
+func (o EchoVerificationOpt) apply(opts *serverOptions) {
+	opts.echoWindow = o.window
+}
+
+// WithEchoVerification verifies freshness of unsafe requests by Echo option (RFC 9175). A request without
+// an Echo value created by the server within window is challenged by 4.01 Unauthorized with a new Echo value,
+// which the client repeats in the request.
+func WithEchoVerification(window time.Duration) EchoVerificationOpt {
+	return EchoVerificationOpt{window: window}
+}
+
+// ShutdownMaxAgeOpt shutdown Max-Age option.
+type ShutdownMaxAgeOpt struct {
+	maxAge time.Duration
+}
+
+func (o ShutdownMaxAgeOpt) apply(opts *serverOptions) {
+	opts.shutdownMaxAge = o.maxAge
+}
+
+// WithShutdownMaxAge sets Max-Age of 5.03 Service Unavailable responses which cancel observations of the clients
+// by Shutdown, so the clients know when to register again. By default it is client.DefaultShutdownMaxAge.
+func WithShutdownMaxAge(maxAge time.Duration) ShutdownMaxAgeOpt {
+	return ShutdownMaxAgeOpt{maxAge: maxAge}
+}
+
+// LimitsOpt limits option.
+type LimitsOpt struct {
+	limits limits.Limits
+}
+
+func (o LimitsOpt) apply(opts *serverOptions) {
+	opts.limits = &o.limits
+}
+
+// WithLimits bounds sessions of the server, requests in progress and observations per peer and rate of messages
+// per source address. Requests over the limits are rejected by 4.29 Too Many Requests with Max-Age as the hint
+// when to retry.
+func WithLimits(l limits.Limits) LimitsOpt {
+	return LimitsOpt{limits: l}
+}
+
+// CacheOpt response cache option.
+type CacheOpt struct {
+	store cache.Store
+}
+
+func (o CacheOpt) applyDial(opts *dialOptions) {
+	opts.responseCache = o.store
+}
+
+// WithCache answers GET requests of the client by fresh responses cached in store by Max-Age, stale responses
+// are revalidated by their ETag. The store may be shared by clients, e.g. cache.NewMemoryStore.
+func WithCache(store cache.Store) CacheOpt {
+	return CacheOpt{store: store}
+}
+
+// URIAuthorityOpt Uri-Host and Uri-Port stamping option.
+type URIAuthorityOpt struct {
+	authority   string
+	proxyScheme string
+}
+
+func (o URIAuthorityOpt) applyDial(opts *dialOptions) {
+	opts.stampURIAuthority = true
+	opts.uriAuthority = client.NewAuthority(o.authority)
+	if opts.uriAuthority != nil {
+		opts.uriAuthority.ProxyScheme = o.proxyScheme
+	}
+}
+
+// WithURIAuthority stamps Uri-Host and Uri-Port options to requests of the client by the authority of the origin
+// server, "host" or "host:port", by the rules of RFC 7252: they are omitted when the host is IP literal of the server
+// and the port is its port. Empty authority means the target passed to Dial, e.g. name of the server. Set authority
+// of the origin server when requests are sent via a proxy.
+func WithURIAuthority(authority string) URIAuthorityOpt {
+	return URIAuthorityOpt{authority: authority}
+}
+
+// ProxyOpt forward-proxy option.
+type ProxyOpt struct {
+	proxyAddr string
+	scheme    string
+}
+
+func (o ProxyOpt) applyDial(opts *dialOptions) {
+	opts.proxyAddr = o.proxyAddr
+	opts.proxyScheme = o.scheme
+}
+
+// WithProxy sends requests of the client to the CoAP forward-proxy at proxyAddr instead of the target passed to Dial,
+// e.g. for a device which reaches only its border gateway. Requests carry Proxy-Scheme of the scheme, "coap" when
+// it is empty, and Uri-Host and Uri-Port of the target, so blocks of blockwise transfers and re-registrations
+// of observations are forwarded to the target as well. Requests with Proxy-Uri set by the caller are sent as they are.
+func WithProxy(proxyAddr, scheme string) ProxyOpt {
+	if scheme == "" {
+		scheme = "coap"
+	}
+	return ProxyOpt{proxyAddr: proxyAddr, scheme: scheme}
+}
+
+// NonConfirmableRetryOpt non-confirmable retry option.
+type NonConfirmableRetryOpt struct {
+	retry client.NonConfirmableRetry
+}
+
+func (o NonConfirmableRetryOpt) applyDial(opts *dialOptions) {
+	opts.nonConfirmableRetry = o.retry
+}
+
+// WithNonConfirmableRetry sends GET and FETCH requests of the client in Non-confirmable messages, which are sent
+// again with the same token when no response arrives within timeout, doubled with every retry, at most
+// maxRetries times. It reduces latency jitter of short queries compared to Confirmable messages. A request
+// overrides it by context of client.WithNonConfirmableRetry.
+func WithNonConfirmableRetry(timeout time.Duration, maxRetries int) NonConfirmableRetryOpt {
+	return NonConfirmableRetryOpt{retry: client.NonConfirmableRetry{Timeout: timeout, MaxRetries: maxRetries}}
+}
+
+// RetryAfterOpt retry after option.
+type RetryAfterOpt struct {
+	policy client.RetryAfterPolicy
+}
+
+func (o RetryAfterOpt) applyDial(opts *dialOptions) {
+	opts.retryAfter = o.policy
+}
+
+// WithRetryAfter repeats requests of the client which the server rejected by 4.29 (Too Many Requests, RFC 8516)
+// or 5.03 (Service Unavailable) after Max-Age of the rejection, see client.RetryAfter. By default the
+// rejection is returned to the caller.
+func WithRetryAfter(policy client.RetryAfterPolicy) RetryAfterOpt {
+	return RetryAfterOpt{policy: policy}
+}
+
+// FlowLabelOpt flow label option.
+type FlowLabelOpt struct {
+	flowLabel coapNet.FlowLabelFunc
+}
+
+func (o FlowLabelOpt) applyDial(opts *dialOptions) {
+	opts.flowLabel = o.flowLabel
+}
+
+// WithFlowLabel sets IPv6 flow labels of datagrams of the client, e.g. coapNet.FlowLabelPerExchange keeps blocks
+// of a blockwise transfer on the same path of ECMP networks. Servers set it by coapNet.WithFlowLabel of the listener.
+func WithFlowLabel(flowLabel coapNet.FlowLabelFunc) FlowLabelOpt {
+	return FlowLabelOpt{flowLabel: flowLabel}
+}
+
+// RebindOpt rebind option.
+type RebindOpt struct {
+	policy RebindPolicy
+}
+
+func (o RebindOpt) applyDial(opts *dialOptions) {
+	opts.rebindPolicy = &o.policy
+}
+
+// WithRebind keeps the client alive when its local address changes, e.g. when a mobile device switches
+// the network. A send or receive failure of the socket which the policy recognizes rebinds the socket to the same
+// peer, the failed send is repeated over the new one and the client keeps its exchanges and observations.
+// Then the policy calls OnMigration and optionally pings the peer and re-registers observations. Unlike
+// WithMigration of WatchResolution, the peer doesn't change.
+func WithRebind(policy RebindPolicy) RebindOpt {
+	return RebindOpt{policy: policy}
+}
+
+// TokenManagerOpt token manager option.
+type TokenManagerOpt struct {
+	tokenManager message.TokenManager
+}
+
+func (o TokenManagerOpt) applyDial(opts *dialOptions) {
+	opts.tokenManager = o.tokenManager
+}
+
+// WithTokenManager sets generator of tokens of requests of the client. By default tokens of
+// message.DefaultTokenLength bytes are generated by crypto/rand and they aren't reused while their exchanges
+// or observations are outstanding.
+func WithTokenManager(tokenManager message.TokenManager) TokenManagerOpt {
+	return TokenManagerOpt{tokenManager: tokenManager}
+}
+
+// MIDGeneratorOpt message ID generator option.
+type MIDGeneratorOpt struct {
+	newMIDGenerator client.NewMIDGeneratorFunc
+}
+
+func (o MIDGeneratorOpt) apply(opts *serverOptions) {
+	opts.newMIDGenerator = o.newMIDGenerator
+}
+
+func (o MIDGeneratorOpt) applyDial(opts *dialOptions) {
+	opts.newMIDGenerator = o.newMIDGenerator
+}
+
+// WithMIDGenerator sets strategy of message IDs, every connection gets own generator created for its remote
+// endpoint, e.g. client.NewRandomMIDGenerator against spoofing. By default client.NewSequentialMIDGenerator
+// allocates monotonic message IDs from a random start.
+func WithMIDGenerator(newMIDGenerator client.NewMIDGeneratorFunc) MIDGeneratorOpt {
+	if newMIDGenerator == nil {
+		newMIDGenerator = client.NewSequentialMIDGenerator
+	}
+	return MIDGeneratorOpt{newMIDGenerator: newMIDGenerator}
+}
+
+// DemuxOpt demultiplexer option.
+type DemuxOpt struct {
+	demux DemuxFunc
+}
+
+func (o DemuxOpt) apply(opts *serverOptions) {
+	opts.demux = o.demux
+}
+
+func (o DemuxOpt) applyDial(opts *dialOptions) {
+	opts.demux = o.demux
+}
+
+// WithDemux sets classifier of received datagrams, so a socket is shared with other protocols, e.g. STUN or
+// proprietary wake-up frames. Datagrams diverted by the classifier aren't parsed and rejected as CoAP, the
+// other protocol replies by the socket passed to Server.Serve or Client.
+func WithDemux(demux DemuxFunc) DemuxOpt {
+	return DemuxOpt{demux: demux}
+}
+
+// ParserLimitsOpt parser limits option.
+type ParserLimitsOpt struct {
+	limits message.ParserLimits
+}
+
+func (o ParserLimitsOpt) apply(opts *serverOptions) {
+	opts.parserLimits = o.limits
+}
+
+func (o ParserLimitsOpt) applyDial(opts *dialOptions) {
+	opts.parserLimits = o.limits
+}
+
+// WithParserLimits bounds received messages independently of the max message size: the number of options,
+// the length of an option value, the length of the token and the length of the payload. Zero disables a limit.
+// A request which exceeds them is answered by 4.13 (Request Entity Too Large), other messages are dropped,
+// and message.ParserLimitError is passed to the errors handler.
+func WithParserLimits(maxOptions, maxOptionLen, maxTokenLen, maxPayload int) ParserLimitsOpt {
+	return ParserLimitsOpt{limits: message.ParserLimits{
+		MaxOptions:   maxOptions,
+		MaxOptionLen: maxOptionLen,
+		MaxTokenLen:  maxTokenLen,
+		MaxPayload:   maxPayload,
+	}}
+}
+
+// WriteTimeoutOpt write timeout option.
+type WriteTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o WriteTimeoutOpt) apply(opts *serverOptions) {
+	opts.writeTimeout = o.timeout
+}
+
+func (o WriteTimeoutOpt) applyDial(opts *dialOptions) {
+	opts.writeTimeout = o.timeout
+}
+
+// WithWriteTimeout bounds each write of a message to the connection by the timeout, independently of context
+// of the message. A write which doesn't complete in time fails with coapNet.TimeoutError of
+// coapNet.TimeoutNetwork. Zero disables the timeout.
+func WithWriteTimeout(timeout time.Duration) WriteTimeoutOpt {
+	return WriteTimeoutOpt{timeout: timeout}
+}
+
+// ExchangeTimeoutOpt exchange timeout option.
+type ExchangeTimeoutOpt struct {
+	timeout time.Duration
+}
+
+func (o ExchangeTimeoutOpt) apply(opts *serverOptions) {
+	opts.exchangeTimeout = o.timeout
+}
+
+func (o ExchangeTimeoutOpt) applyDial(opts *dialOptions) {
+	opts.exchangeTimeout = o.timeout
+}
+
+// WithExchangeTimeout bounds each request whose context has no deadline by the timeout. A request without
+// the response in time fails with coapNet.TimeoutError of coapNet.TimeoutExchange, while exhausted
+// retransmissions fail with coapNet.TimeoutRetransmission. Zero disables the timeout.
+func WithExchangeTimeout(timeout time.Duration) ExchangeTimeoutOpt {
+	return ExchangeTimeoutOpt{timeout: timeout}
+}
+
+// MessagePoolOpt message pool option.
+type MessagePoolOpt struct {
+	pool *pool.Pool
+}
+
+func (o MessagePoolOpt) apply(opts *serverOptions) {
+	opts.messagePool = o.pool
+}
+
+func (o MessagePoolOpt) applyDial(opts *dialOptions) {
+	opts.messagePool = o.pool
+}
+
+// WithMessagePool sets pool of messages acquired by the connections, e.g. received messages and responses,
+// so memory of messages is bounded and observed per server or client by Stats of the pool. Nil, the default,
+// is the package-level pool of pool.AcquireMessage.
+func WithMessagePool(p *pool.Pool) MessagePoolOpt {
+	return MessagePoolOpt{pool: p}
+}
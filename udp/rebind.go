@@ -0,0 +1,264 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+)
+
+const (
+	defaultRebindRetryInterval = time.Second
+	rebindPingTimeout          = 10 * time.Second
+)
+
+// RebindPolicy configures rebinding of the socket of a client, see WithRebind.
+type RebindPolicy struct {
+	// Ping pings the peer after the socket was rebound, so middleboxes, e.g. NATs, learn the new address.
+	Ping bool
+	// ReregisterObservations re-registers observations created by Observe after the socket was rebound,
+	// so the server sends notifications to the new address.
+	ReregisterObservations bool
+	// RetryInterval is time after which failed rebinding is retried when the socket cannot receive anymore.
+	// Zero means 1s.
+	RetryInterval time.Duration
+	// ShouldRebind reports whether the error of the socket means that the local address is gone. Nil means
+	// IsRebindError.
+	ShouldRebind func(err error) bool
+	// OnMigration is called after the socket was rebound, with local addresses of the old and the new socket.
+	OnMigration func(cc *client.ClientConn, oldAddr, newAddr net.Addr)
+}
+
+func (p RebindPolicy) shouldRebind(err error) bool {
+	if p.ShouldRebind != nil {
+		return p.ShouldRebind(err)
+	}
+	return IsRebindError(err)
+}
+
+func (p RebindPolicy) retryInterval() time.Duration {
+	if p.RetryInterval <= 0 {
+		return defaultRebindRetryInterval
+	}
+	return p.RetryInterval
+}
+
+// IsRebindError reports whether the error of a socket means that its local address is gone, e.g. because
+// the device switched the network, or that the socket was closed beneath the client.
+func IsRebindError(err error) bool {
+	for _, e := range []error{
+		syscall.ENETUNREACH,
+		syscall.ENETDOWN,
+		syscall.EHOSTUNREACH,
+		syscall.EADDRNOTAVAIL,
+		syscall.ENOTCONN,
+		syscall.EPIPE,
+		net.ErrClosed,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// socket is one binding of the rebinding transport.
+type socket struct {
+	conn      *coapNet.UDPConn
+	transport coapNet.Transport
+	owned     bool
+	// ctx is canceled when the socket is replaced, so the reader moves to the new one.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *socket) close() error {
+	s.cancel()
+	if !s.owned {
+		return nil
+	}
+	return s.transport.Close()
+}
+
+// rebindingTransport is transport of a client which rebinds the socket when it fails, e.g. because the local
+// address changed. The peer is the same, so the client keeps its state.
+type rebindingTransport struct {
+	policy   RebindPolicy
+	ctx      context.Context
+	raddr    *net.UDPAddr
+	dial     func(ctx context.Context) (*coapNet.UDPConn, error)
+	errors   ErrorFunc
+	onRebind func(oldAddr, newAddr net.Addr)
+
+	mutex   sync.Mutex
+	current *socket
+	changed chan struct{}
+	closed  bool
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newRebindingTransport(ctx context.Context, policy RebindPolicy, conn *coapNet.UDPConn, raddr *net.UDPAddr, owned bool,
+	dial func(ctx context.Context) (*coapNet.UDPConn, error), errorFunc ErrorFunc, onRebind func(oldAddr, newAddr net.Addr),
+) *rebindingTransport {
+	t := &rebindingTransport{
+		policy:   policy,
+		ctx:      ctx,
+		raddr:    raddr,
+		dial:     dial,
+		errors:   errorFunc,
+		onRebind: onRebind,
+		changed:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	t.current = t.newSocket(conn, owned)
+	return t
+}
+
+func (t *rebindingTransport) newSocket(conn *coapNet.UDPConn, owned bool) *socket {
+	ctx, cancel := context.WithCancel(t.ctx)
+	return &socket{
+		conn:      conn,
+		transport: coapNet.NewUDPTransport(conn, t.raddr),
+		owned:     owned,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (t *rebindingTransport) socket() (*socket, <-chan struct{}) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.current, t.changed
+}
+
+func (t *rebindingTransport) replaced(s *socket) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.current != s
+}
+
+// rebind replaces the failed socket by a new one bound to the current local address. It returns the current
+// socket when the failed one was already replaced.
+func (t *rebindingTransport) rebind(failed *socket) (*socket, error) {
+	t.mutex.Lock()
+	if t.closed {
+		t.mutex.Unlock()
+		return nil, net.ErrClosed
+	}
+	if t.current != failed {
+		s := t.current
+		t.mutex.Unlock()
+		return s, nil
+	}
+	conn, err := t.dial(t.ctx)
+	if err != nil {
+		t.mutex.Unlock()
+		return nil, fmt.Errorf("cannot rebind socket: %w", err)
+	}
+	s := t.newSocket(conn, true)
+	t.current = s
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mutex.Unlock()
+
+	err = failed.close()
+	if err != nil {
+		t.errors(fmt.Errorf("cannot close socket %v: %w", failed.conn.LocalAddr(), err))
+	}
+	go t.onRebind(failed.conn.LocalAddr(), conn.LocalAddr())
+	return s, nil
+}
+
+func (t *rebindingTransport) ReadMessage(ctx context.Context, buffer []byte) (int, error) {
+	for {
+		s, changed := t.socket()
+		n, err := s.transport.ReadMessage(s.ctx, buffer)
+		if err == nil || ctx.Err() != nil {
+			return n, err
+		}
+		if s.ctx.Err() != nil {
+			if t.replaced(s) {
+				continue
+			}
+			return n, err
+		}
+		if !t.policy.shouldRebind(err) {
+			return n, err
+		}
+		_, errRebind := t.rebind(s)
+		if errRebind == nil {
+			continue
+		}
+		if errors.Is(errRebind, net.ErrClosed) {
+			return n, err
+		}
+		t.errors(errRebind)
+		select {
+		case <-time.After(t.policy.retryInterval()):
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (t *rebindingTransport) WriteMessage(ctx context.Context, data []byte) error {
+	s, _ := t.socket()
+	err := s.transport.WriteMessage(ctx, data)
+	if err == nil || ctx.Err() != nil || !t.policy.shouldRebind(err) {
+		return err
+	}
+	s, errRebind := t.rebind(s)
+	if errRebind != nil {
+		return fmt.Errorf("%w: %v", err, errRebind)
+	}
+	return s.transport.WriteMessage(ctx, data)
+}
+
+func (t *rebindingTransport) Close() error {
+	t.mutex.Lock()
+	t.closed = true
+	s := t.current
+	t.mutex.Unlock()
+	var err error
+	t.once.Do(func() {
+		defer close(t.done)
+		err = s.close()
+	})
+	return err
+}
+
+func (t *rebindingTransport) RemoteAddr() net.Addr {
+	return t.raddr
+}
+
+func (t *rebindingTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// onRebind calls OnMigration, pings the peer and re-registers observations by the policy after the socket
+// of the client was rebound.
+func (p RebindPolicy) onRebind(cc *client.ClientConn, errorFunc ErrorFunc, oldAddr, newAddr net.Addr) {
+	if p.OnMigration != nil {
+		p.OnMigration(cc, oldAddr, newAddr)
+	}
+	if p.Ping {
+		ctx, cancel := context.WithTimeout(cc.Context(), rebindPingTimeout)
+		err := cc.Ping(ctx)
+		cancel()
+		if err != nil {
+			errorFunc(fmt.Errorf("cannot ping after rebinding from %v to %v: %w", oldAddr, newAddr, err))
+		}
+	}
+	if p.ReregisterObservations {
+		cc.ReregisterObservations()
+	}
+}
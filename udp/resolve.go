@@ -0,0 +1,300 @@
+package udp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// LookupFunc resolves host to its addresses, e.g. net.DefaultResolver.LookupHost.
+type LookupFunc = func(ctx context.Context, host string) ([]string, error)
+
+// MigrateFunc dials the address which replaces the connection, e.g. by Dial with options of the replaced one.
+type MigrateFunc = func(ctx context.Context, addr string) (*client.ClientConn, error)
+
+// RestoreFunc creates observe function of the observation restored at the new connection.
+type RestoreFunc = func(cc *client.ClientConn, record observation.Record) func(req *pool.Message)
+
+// Resolution holds outcome of the re-resolution which changed addresses of the target.
+type Resolution struct {
+	// Addrs are the resolved addresses, sorted.
+	Addrs []string
+	// Old is the connection when the addresses changed.
+	Old *client.ClientConn
+	// New is the connection which replaces Old. It is nil when the connection isn't migrated.
+	New *client.ClientConn
+	// Observations are observations restored at New.
+	Observations []*client.Observation
+	Err          error
+}
+
+var defaultResolveOptions = resolveOptions{
+	interval:     time.Minute,
+	lookup:       net.DefaultResolver.LookupHost,
+	closeTimeout: time.Second * 5,
+}
+
+type resolveOptions struct {
+	interval     time.Duration
+	lookup       LookupFunc
+	migrate      MigrateFunc
+	restore      RestoreFunc
+	closeTimeout time.Duration
+	onResolved   func(r Resolution)
+}
+
+// A ResolveOption sets options such as interval of re-resolution, migration, etc.
+type ResolveOption interface {
+	applyResolve(*resolveOptions)
+}
+
+// ResolveIntervalOpt resolve interval option.
+type ResolveIntervalOpt struct {
+	interval time.Duration
+}
+
+func (o ResolveIntervalOpt) applyResolve(opts *resolveOptions) {
+	opts.interval = o.interval
+}
+
+// WithResolveInterval sets how often the target is re-resolved, by default every minute.
+func WithResolveInterval(interval time.Duration) ResolveIntervalOpt {
+	return ResolveIntervalOpt{interval: interval}
+}
+
+// LookupOpt lookup option.
+type LookupOpt struct {
+	lookup LookupFunc
+}
+
+func (o LookupOpt) applyResolve(opts *resolveOptions) {
+	opts.lookup = o.lookup
+}
+
+// WithLookup sets resolver of the host of the target, by default net.DefaultResolver.LookupHost.
+func WithLookup(lookup LookupFunc) LookupOpt {
+	return LookupOpt{lookup: lookup}
+}
+
+// MigrationOpt migration option.
+type MigrationOpt struct {
+	migrate      MigrateFunc
+	restore      RestoreFunc
+	closeTimeout time.Duration
+}
+
+func (o MigrationOpt) applyResolve(opts *resolveOptions) {
+	opts.migrate = o.migrate
+	opts.restore = o.restore
+	opts.closeTimeout = o.closeTimeout
+}
+
+// WithMigration migrates the connection when its address is not resolved anymore. The connection dialed by
+// migrate to the first resolved address replaces it, then the old connection is gracefully closed within
+// closeTimeout and when restore is set, observations are restored at the new connection via
+// ClientConn.RestoreObservations. Both connections must share the observation store.
+func WithMigration(migrate MigrateFunc, restore RestoreFunc, closeTimeout time.Duration) MigrationOpt {
+	return MigrationOpt{migrate: migrate, restore: restore, closeTimeout: closeTimeout}
+}
+
+// OnResolvedOpt on resolved option.
+type OnResolvedOpt struct {
+	onResolved func(r Resolution)
+}
+
+func (o OnResolvedOpt) applyResolve(opts *resolveOptions) {
+	opts.onResolved = o.onResolved
+}
+
+// WithOnResolved set function which is called when the addresses of the target change or their lookup fails,
+// e.g. to swap the migrated connection in the application.
+func WithOnResolved(onResolved func(r Resolution)) OnResolvedOpt {
+	return OnResolvedOpt{onResolved: onResolved}
+}
+
+// Resolver re-resolves the target of a long-lived connection dialed by hostname in the background,
+// e.g. for endpoints behind DNS-based failover.
+type Resolver struct {
+	host string
+	port string
+	cfg  resolveOptions
+
+	mutex sync.Mutex
+	cc    *client.ClientConn
+	addrs []string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// WatchResolution resolves host of the target, e.g. "coap.example.com:5683", and re-resolves it periodically
+// until Stop is called or the connection is closed. The connection cc is dialed to the target.
+func WatchResolution(cc *client.ClientConn, target string, opts ...ResolveOption) (*Resolver, error) {
+	cfg := defaultResolveOptions
+	for _, o := range opts {
+		o.applyResolve(&cfg)
+	}
+	if cfg.interval <= 0 {
+		return nil, fmt.Errorf("invalid resolve interval %v", cfg.interval)
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %v: %w", target, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Resolver{
+		host:   host,
+		port:   port,
+		cfg:    cfg,
+		cc:     cc,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r.addrs, err = r.lookup(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.run(ctx)
+	return r, nil
+}
+
+// Conn returns the current connection, which is the migrated one after migration.
+func (r *Resolver) Conn() *client.ClientConn {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cc
+}
+
+// Addrs returns the last resolved addresses of the target.
+func (r *Resolver) Addrs() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.addrs...)
+}
+
+// Stop stops re-resolution and waits until a running migration is done. The connection is left open.
+func (r *Resolver) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *Resolver) lookup(ctx context.Context) ([]string, error) {
+	addrs, err := r.cfg.lookup(ctx, r.host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %v: %w", r.host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("cannot resolve %v: no addresses", r.host)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func (r *Resolver) run(ctx context.Context) {
+	defer close(r.done)
+	t := time.NewTicker(r.cfg.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.Conn().Done():
+			return
+		case <-t.C:
+			r.resolve(ctx)
+		}
+	}
+}
+
+func (r *Resolver) resolve(ctx context.Context) {
+	cc := r.Conn()
+	addrs, err := r.lookup(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.report(Resolution{Old: cc, Err: err})
+		}
+		return
+	}
+	r.mutex.Lock()
+	changed := !equalAddrs(r.addrs, addrs)
+	r.addrs = addrs
+	r.mutex.Unlock()
+	if !changed {
+		return
+	}
+	res := Resolution{
+		Addrs: addrs,
+		Old:   cc,
+	}
+	if r.cfg.migrate != nil && !containsAddr(addrs, cc.RemoteAddr()) {
+		r.migrate(ctx, &res)
+	}
+	r.report(res)
+}
+
+func (r *Resolver) migrate(ctx context.Context, res *Resolution) {
+	newCC, err := r.cfg.migrate(ctx, net.JoinHostPort(res.Addrs[0], r.port))
+	if err != nil {
+		res.Err = fmt.Errorf("cannot migrate: %w", err)
+		return
+	}
+	res.New = newCC
+	r.mutex.Lock()
+	r.cc = newCC
+	r.mutex.Unlock()
+
+	closeCtx, cancel := context.WithTimeout(ctx, r.cfg.closeTimeout)
+	defer cancel()
+	// observation records are kept, so they can be restored at the new connection
+	_ = res.Old.CloseGracefully(closeCtx)
+
+	if r.cfg.restore == nil {
+		return
+	}
+	res.Observations, err = newCC.RestoreObservations(ctx, func(record observation.Record) func(req *pool.Message) {
+		return r.cfg.restore(newCC, record)
+	})
+	if err != nil {
+		res.Err = fmt.Errorf("cannot restore observations: %w", err)
+	}
+}
+
+func (r *Resolver) report(res Resolution) {
+	if r.cfg.onResolved != nil {
+		r.cfg.onResolved(res)
+	}
+}
+
+func equalAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAddr reports whether IP of addr is among the addresses.
+func containsAddr(addrs []string, addr net.Addr) bool {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	for _, a := range addrs {
+		if udpAddr.IP.Equal(net.ParseIP(a)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package udp_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchResolution(t *testing.T) {
+	la, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer la.Close()
+	_, port, err := net.SplitHostPort(la.LocalAddr().String())
+	require.NoError(t, err)
+	lb, err := coapNet.NewListenUDP("udp", net.JoinHostPort("127.0.0.2", port))
+	require.NoError(t, err)
+	defer lb.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, v := range []struct {
+		l    *coapNet.UDPConn
+		name string
+	}{{la, "a"}, {lb, "b"}} {
+		name := v.name
+		s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(name)))
+			require.NoError(t, err)
+		}))
+		defer s.Stop()
+		wg.Add(1)
+		go func(l *coapNet.UDPConn) {
+			defer wg.Done()
+			err := s.Serve(l)
+			require.NoError(t, err)
+		}(v.l)
+	}
+
+	// DNS-based failover moves the host from the first node to the second one
+	var lookupMutex sync.Mutex
+	addrs := []string{"127.0.0.1"}
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		lookupMutex.Lock()
+		defer lookupMutex.Unlock()
+		require.Equal(t, "coap.example.com", host)
+		return append([]string(nil), addrs...), nil
+	}
+
+	cc, err := udp.Dial(la.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	resolutions := make(chan udp.Resolution, 4)
+	r, err := udp.WatchResolution(cc, net.JoinHostPort("coap.example.com", port),
+		udp.WithLookup(lookup),
+		udp.WithResolveInterval(time.Millisecond*20),
+		udp.WithMigration(func(ctx context.Context, addr string) (*client.ClientConn, error) {
+			return udp.Dial(addr)
+		}, nil, time.Second),
+		udp.WithOnResolved(func(r udp.Resolution) {
+			resolutions <- r
+		}))
+	require.NoError(t, err)
+	defer r.Stop()
+	require.Equal(t, []string{"127.0.0.1"}, r.Addrs())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	get := func(cc *client.ClientConn) string {
+		resp, err := cc.Get(ctx, "/a")
+		require.NoError(t, err)
+		defer pool.ReleaseMessage(resp)
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		return string(body)
+	}
+	require.Equal(t, "a", get(r.Conn()))
+
+	// the connected address is still resolved, so the connection isn't migrated
+	lookupMutex.Lock()
+	addrs = []string{"127.0.0.2", "127.0.0.1"}
+	lookupMutex.Unlock()
+	var res udp.Resolution
+	select {
+	case res = <-resolutions:
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.NoError(t, res.Err)
+	require.Equal(t, []string{"127.0.0.1", "127.0.0.2"}, res.Addrs)
+	require.Nil(t, res.New)
+	require.Equal(t, cc, r.Conn())
+
+	lookupMutex.Lock()
+	addrs = []string{"127.0.0.2"}
+	lookupMutex.Unlock()
+	select {
+	case res = <-resolutions:
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.NoError(t, res.Err)
+	require.Equal(t, cc, res.Old)
+	require.NotNil(t, res.New)
+	defer res.New.Close()
+	require.Equal(t, res.New, r.Conn())
+	select {
+	case <-cc.Done():
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.Equal(t, "b", get(r.Conn()))
+}
@@ -0,0 +1,60 @@
+package udp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// ResponseRoute identifies a deferred request, so its response can be sent by another server.
+type ResponseRoute = client.ResponseRoute
+
+// RespondTo sends resp as the separate response of the request of the route by the connection of the server,
+// e.g. when the server took over the address of the node which deferred the request. The connection to the client
+// is created when it doesn't exist. The caller keeps ownership of resp.
+func (s *Server) RespondTo(route ResponseRoute, resp *pool.Message) error {
+	raddr, err := net.ResolveUDPAddr("udp", route.RemoteAddr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", client.ErrInvalidRoute, err)
+	}
+	if raddr.IP.IsMulticast() {
+		return fmt.Errorf("%w: response to multicast address %v", client.ErrInvalidRoute, raddr)
+	}
+	cc, err := s.connTo(raddr)
+	if err != nil {
+		return err
+	}
+	return cc.RespondTo(route, resp)
+}
+
+// ClientConnTo returns connection of the server to the peer at addr, it is created when it doesn't exist,
+// e.g. to notify observers which were registered before restart of the server.
+func (s *Server) ClientConnTo(addr string) (*client.ClientConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve address %v: %w", addr, err)
+	}
+	if raddr.IP.IsMulticast() {
+		return nil, fmt.Errorf("cannot get connection to multicast address %v", raddr)
+	}
+	return s.connTo(raddr)
+}
+
+func (s *Server) connTo(raddr *net.UDPAddr) (*client.ClientConn, error) {
+	s.listenMutex.Lock()
+	l := s.listen
+	s.listenMutex.Unlock()
+	if l == nil {
+		return nil, ErrServerNotAttached
+	}
+	cc, _, err := s.getOrCreateClientConn(l, raddr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get connection to %v: %w", raddr, err)
+	}
+	if cc == nil {
+		return nil, fmt.Errorf("cannot get connection to %v: server is shutting down", raddr)
+	}
+	return cc, nil
+}
@@ -6,13 +6,18 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/echo"
+	"github.com/plgd-dev/go-coap/v2/metrics"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/oscore"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
@@ -38,9 +43,30 @@ type OnNewClientConnFunc = func(cc *client.ClientConn)
 
 type GetMIDFunc = func() uint16
 
+type RawHandlerFunc = client.RawHandlerFunc
+
+type ExchangeFunc = client.ExchangeFunc
+
+type DuplicateFunc = client.DuplicateFunc
+
+type SlowObserverFunc = client.SlowObserverFunc
+
+type Backpressure = client.Backpressure
+
+type NonResponsePolicy = client.NonResponsePolicy
+
+type Pacing = client.Pacing
+
+type TransmissionConfig = client.TransmissionConfig
+
+// DemuxFunc classifies datagrams received by a socket which is shared with other protocols before they are
+// parsed as CoAP, e.g. STUN for NAT checks. When it returns true, the datagram was diverted to another handler
+// and it isn't processed as CoAP. The datagram is valid only during the call.
+type DemuxFunc = func(datagram []byte, raddr *net.UDPAddr) bool
+
 var defaultServerOptions = serverOptions{
 	ctx:            context.Background(),
-	maxMessageSize: 64 * 1024,
+	maxMessageSize: defaultMaxMessageSize,
 	handler: func(w *client.ResponseWriter, r *pool.Message) {
 		w.SetResponse(codes.NotFound, message.TextPlain, nil)
 	},
@@ -57,13 +83,16 @@ var defaultServerOptions = serverOptions{
 		return inactivity.NewNilMonitor()
 	},
 	blockwiseEnable:                true,
-	blockwiseSZX:                   blockwise.SZX1024,
+	blockwiseSZX:                   defaultBlockwiseSZX,
 	blockwiseTransferTimeout:       time.Second * 3,
 	onNewClientConn:                func(cc *client.ClientConn) {},
 	transmissionNStart:             time.Second,
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	newMIDGenerator:                client.NewSequentialMIDGenerator,
+	controlLaneSize:                client.DefaultControlLaneSize,
+	shutdownMaxAge:                 client.DefaultShutdownMaxAge,
 }
 
 type serverOptions struct {
@@ -71,16 +100,48 @@ type serverOptions struct {
 	maxMessageSize                 int
 	handler                        HandlerFunc
 	errors                         ErrorFunc
+	logger                         coapNet.Logger
 	goPool                         GoPoolFunc
 	createInactivityMonitor        func() inactivity.Monitor
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseLimits                blockwise.Limits
+	blockwiseProgress              blockwise.ProgressFunc
+	blockwiseOptions               []blockwise.Option
 	onNewClientConn                OnNewClientConnFunc
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
 	getMID                         GetMIDFunc
+	newMIDGenerator                client.NewMIDGeneratorFunc
+	rawHandler                     RawHandlerFunc
+	reliableTransport              bool
+	onExchange                     ExchangeFunc
+	onDuplicate                    DuplicateFunc
+	backpressure                   Backpressure
+	nStart                         int
+	parserLimits                   message.ParserLimits
+	writeTimeout                   time.Duration
+	exchangeTimeout                time.Duration
+	messagePool                    *pool.Pool
+	nonResponsePolicy              NonResponsePolicy
+	pacing                         Pacing
+	oscoreContext                  *oscore.Context
+	newTransmissionParams          client.NewTransmissionParamsFunc
+	observeRecovery                client.ObserveRecovery
+	controlLaneSize                int
+	onRetransmit                   client.RetransmitFunc
+	traceHandler                   client.TraceHandler
+	stats                          metrics.Stats
+	newDedup                       client.NewDedupFunc
+	pooledResponses                bool
+	echoWindow                     time.Duration
+	multicastGroups                []string
+	multicastLeisure               time.Duration
+	shutdownMaxAge                 time.Duration
+	limits                         *limits.Limits
+	demux                          DemuxFunc
 }
 
 type Server struct {
@@ -92,11 +153,41 @@ type Server struct {
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseLimits                blockwise.Limits
+	blockwiseProgress              blockwise.ProgressFunc
+	blockwiseOptions               []blockwise.Option
 	onNewClientConn                OnNewClientConnFunc
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
 	getMID                         GetMIDFunc
+	newMIDGenerator                client.NewMIDGeneratorFunc
+	rawHandler                     RawHandlerFunc
+	reliableTransport              bool
+	onExchange                     ExchangeFunc
+	onDuplicate                    DuplicateFunc
+	backpressure                   Backpressure
+	nStart                         int
+	parserLimits                   message.ParserLimits
+	writeTimeout                   time.Duration
+	exchangeTimeout                time.Duration
+	messagePool                    *pool.Pool
+	nonResponsePolicy              NonResponsePolicy
+	pacing                         Pacing
+	oscoreContext                  *oscore.Context
+	newTransmissionParams          client.NewTransmissionParamsFunc
+	observeRecovery                client.ObserveRecovery
+	controlLaneSize                int
+	onRetransmit                   client.RetransmitFunc
+	traceHandler                   client.TraceHandler
+	newDedup                       client.NewDedupFunc
+	pooledResponses                bool
+	multicastGroups                []string
+	multicastLeisure               time.Duration
+	shutdownMaxAge                 time.Duration
+	limiter                        *limits.Limiter
+	demux                          DemuxFunc
+	shuttingDown                   uint32
 
 	conns             map[string]*client.ClientConn
 	connsMutex        sync.Mutex
@@ -111,6 +202,9 @@ type Server struct {
 	listenMutex sync.Mutex
 	doneCtx     context.Context
 	doneCancel  context.CancelFunc
+
+	// multicast groups joined by Attach
+	attachedGroups []*net.UDPAddr
 }
 
 func NewServer(opt ...ServerOption) *Server {
@@ -126,6 +220,9 @@ func NewServer(opt ...ServerOption) *Server {
 	if opts.getMID == nil {
 		opts.getMID = udpMessage.GetMID
 	}
+	if opts.newMIDGenerator == nil {
+		opts.newMIDGenerator = client.NewSequentialMIDGenerator
+	}
 
 	if opts.createInactivityMonitor == nil {
 		opts.createInactivityMonitor = func() inactivity.Monitor {
@@ -133,6 +230,27 @@ func NewServer(opt ...ServerOption) *Server {
 		}
 	}
 
+	if opts.echoWindow > 0 {
+		verifier, err := echo.NewVerifier(opts.echoWindow)
+		if err != nil {
+			opts.errors(fmt.Errorf("udp: cannot create echo verifier: %w", err))
+		}
+		opts.handler = client.NewEchoVerificationHandler(verifier, opts.handler)
+	}
+
+	var limiter *limits.Limiter
+	if opts.limits != nil {
+		limiter = limits.NewLimiter(*opts.limits)
+		opts.handler = client.NewLimitsHandler(limiter, opts.handler)
+	}
+
+	if opts.logger != nil {
+		opts.traceHandler = coapNet.LogTraceHandler(opts.logger, opts.traceHandler)
+	}
+	if opts.stats != nil {
+		opts.traceHandler = metrics.TraceHandler(opts.stats, opts.traceHandler)
+	}
+
 	ctx, cancel := context.WithCancel(opts.ctx)
 	serverStartedChan := make(chan struct{})
 
@@ -155,6 +273,9 @@ func NewServer(opt ...ServerOption) *Server {
 		blockwiseSZX:                   opts.blockwiseSZX,
 		blockwiseEnable:                opts.blockwiseEnable,
 		blockwiseTransferTimeout:       opts.blockwiseTransferTimeout,
+		blockwiseLimits:                opts.blockwiseLimits,
+		blockwiseProgress:              opts.blockwiseProgress,
+		blockwiseOptions:               opts.blockwiseOptions,
 		multicastHandler:               client.NewHandlerContainer(),
 		multicastRequests:              kitSync.NewMap(),
 		serverStartedChan:              serverStartedChan,
@@ -163,6 +284,32 @@ func NewServer(opt ...ServerOption) *Server {
 		transmissionAcknowledgeTimeout: opts.transmissionAcknowledgeTimeout,
 		transmissionMaxRetransmit:      opts.transmissionMaxRetransmit,
 		getMID:                         opts.getMID,
+		newMIDGenerator:                opts.newMIDGenerator,
+		rawHandler:                     opts.rawHandler,
+		reliableTransport:              opts.reliableTransport,
+		onExchange:                     opts.onExchange,
+		onDuplicate:                    opts.onDuplicate,
+		backpressure:                   opts.backpressure,
+		nStart:                         opts.nStart,
+		parserLimits:                   opts.parserLimits,
+		writeTimeout:                   opts.writeTimeout,
+		exchangeTimeout:                opts.exchangeTimeout,
+		messagePool:                    opts.messagePool,
+		nonResponsePolicy:              opts.nonResponsePolicy,
+		pacing:                         opts.pacing,
+		oscoreContext:                  opts.oscoreContext,
+		newTransmissionParams:          opts.newTransmissionParams,
+		observeRecovery:                opts.observeRecovery,
+		controlLaneSize:                opts.controlLaneSize,
+		onRetransmit:                   opts.onRetransmit,
+		traceHandler:                   opts.traceHandler,
+		newDedup:                       opts.newDedup,
+		pooledResponses:                opts.pooledResponses,
+		multicastGroups:                opts.multicastGroups,
+		multicastLeisure:               opts.multicastLeisure,
+		shutdownMaxAge:                 opts.shutdownMaxAge,
+		limiter:                        limiter,
+		demux:                          opts.demux,
 		doneCtx:                        doneCtx,
 		doneCancel:                     doneCancel,
 
@@ -200,6 +347,11 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 		s.serverStartedChan = make(chan struct{}, 1)
 	}()
 
+	if len(s.multicastGroups) > 0 {
+		groups := s.joinMulticastGroups(l)
+		defer leaveMulticastGroups(l, groups)
+	}
+
 	m := make([]byte, s.maxMessageSize)
 	var wg sync.WaitGroup
 
@@ -211,7 +363,7 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 
 	for {
 		buf := m
-		n, raddr, err := l.ReadWithContext(s.ctx, buf)
+		n, raddr, dst, err := s.read(l, buf)
 		if err != nil {
 			wg.Wait()
 
@@ -222,19 +374,48 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 				return err
 			}
 		}
-		buf = buf[:n]
-		cc, created := s.getOrCreateClientConn(l, raddr)
-		if created {
-			if s.onNewClientConn != nil {
-				s.onNewClientConn(cc)
-			}
+		if s.demux != nil && s.demux(buf[:n], raddr) {
+			continue
 		}
-		err = cc.Process(buf)
-		if err != nil {
-			cc.Close()
-			s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+		s.processDatagram(l, buf[:n], raddr, dst)
+	}
+}
+
+// processDatagram processes the datagram received from raddr by the connection of its client.
+func (s *Server) processDatagram(l *coapNet.UDPConn, buf []byte, raddr *net.UDPAddr, dst net.IP) {
+	if s.limiter != nil {
+		if wait, ok := s.limiter.Allow(raddr); !ok {
+			s.rejectDatagram(l, buf, raddr, wait)
+			return
 		}
 	}
+	cc, created, err := s.getOrCreateClientConn(l, raddr)
+	if err != nil {
+		s.rejectDatagram(l, buf, raddr, s.limiter.Limits().RetryAfter)
+		return
+	}
+	if cc == nil {
+		// the server is shutting down
+		return
+	}
+	if created {
+		if s.onNewClientConn != nil {
+			s.onNewClientConn(cc)
+		}
+	}
+	if s.multicastLeisure > 0 && isMulticastRequest(dst, buf) {
+		s.processWithLeisure(cc, buf)
+		return
+	}
+	if dst != nil && dst.IsMulticast() {
+		err = cc.ProcessMulticast(buf)
+	} else {
+		err = cc.Process(buf)
+	}
+	if err != nil {
+		cc.Close()
+		s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+	}
 }
 
 // Stop stops server without wait of ends Serve function.
@@ -243,6 +424,35 @@ func (s *Server) Stop() {
 	s.closeSessions()
 }
 
+// Shutdown stops accepting new connections, waits until requests in progress, separate responses and blockwise
+// transfers of the connections are finished, cancels observations of the clients by 5.03 Service Unavailable
+// with Max-Age set by WithShutdownMaxAge and stops the server. When ctx is done before that, the server
+// is stopped immediately and ctx error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreUint32(&s.shuttingDown, 1)
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var err error
+	for _, cc := range s.getClientConns() {
+		wg.Add(1)
+		go func(cc *client.ClientConn) {
+			defer wg.Done()
+			errShutdown := cc.Shutdown(ctx, s.shutdownMaxAge)
+			errMutex.Lock()
+			defer errMutex.Unlock()
+			if err == nil && errShutdown != nil {
+				err = fmt.Errorf("%v: %w", cc.RemoteAddr(), errShutdown)
+			}
+		}(cc)
+	}
+	wg.Wait()
+	s.Stop()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 func (s *Server) closeSessions() {
 	s.connsMutex.Lock()
 	conns := s.conns
@@ -270,6 +480,9 @@ func (s *Server) conn() *coapNet.UDPConn {
 	return s.listen
 }
 
+// inactivityCheckInterval is period of checks of inactivity of the connections.
+const inactivityCheckInterval = time.Second
+
 const inactivityMonitorKey = "gocoapInactivityMonitor"
 const closeKey = "gocoapCloseConnection"
 
@@ -284,31 +497,36 @@ func (s *Server) getClientConns() []*client.ClientConn {
 }
 
 func (s *Server) handleInactivityMonitors() {
-	ticker := time.NewTicker(time.Second)
+	ticker := time.NewTicker(inactivityCheckInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			for _, cc := range s.getClientConns() {
-				select {
-				case <-cc.Context().Done():
-					close := getClose(cc)
-					if close != nil {
-						close()
-					}
-					continue
-				default:
-					monitor := getInactivityMonitor(cc)
-					monitor.CheckInactivity(cc)
-				}
-			}
+			s.checkInactivity()
 		case <-s.ctx.Done():
 			return
 		}
 	}
 }
 
+// checkInactivity releases closed connections and checks inactivity of the others.
+func (s *Server) checkInactivity() {
+	for _, cc := range s.getClientConns() {
+		select {
+		case <-cc.Context().Done():
+			close := getClose(cc)
+			if close != nil {
+				close()
+			}
+			continue
+		default:
+			monitor := getInactivityMonitor(cc)
+			monitor.CheckInactivity(cc)
+		}
+	}
+}
+
 func getInactivityMonitor(cc *client.ClientConn) inactivity.Monitor {
 	v := cc.Context().Value(inactivityMonitorKey)
 	if v == nil {
@@ -325,22 +543,29 @@ func getClose(cc *client.ClientConn) func() {
 	return v.(func())
 }
 
-func (s *Server) getOrCreateClientConn(UDPConn *coapNet.UDPConn, raddr *net.UDPAddr) (cc *client.ClientConn, created bool) {
+func (s *Server) getOrCreateClientConn(UDPConn *coapNet.UDPConn, raddr *net.UDPAddr) (cc *client.ClientConn, created bool, err error) {
 	s.connsMutex.Lock()
 	defer s.connsMutex.Unlock()
 	key := raddr.String()
 	cc = s.conns[key]
+	if cc == nil && atomic.LoadUint32(&s.shuttingDown) == 1 {
+		return nil, false, nil
+	}
+	if cc == nil && s.limiter != nil && !s.limiter.AcquireSession() {
+		return nil, false, errTooManySessions
+	}
 	if cc == nil {
 		created = true
 		var blockWise *blockwise.BlockWise
 		if s.blockwiseEnable {
 			blockWise = blockwise.NewBlockWise(
-				bwAcquireMessage,
+				bwAcquireMessage(s.messagePool),
 				bwReleaseMessage,
 				s.blockwiseTransferTimeout,
 				s.errors,
 				false,
-				bwCreateHandlerFunc(s.multicastRequests),
+				bwCreateHandlerFunc(s.messagePool, s.multicastRequests),
+				append([]blockwise.Option{blockwise.WithLimits(s.blockwiseLimits), blockwise.WithProgress(s.blockwiseProgress)}, s.blockwiseOptions...)...,
 			)
 		}
 		obsHandler := client.NewHandlerContainer()
@@ -357,24 +582,51 @@ func (s *Server) getOrCreateClientConn(UDPConn *coapNet.UDPConn, raddr *net.UDPA
 			session,
 			obsHandler,
 			s.multicastRequests,
-			s.transmissionNStart,
-			s.transmissionAcknowledgeTimeout,
-			s.transmissionMaxRetransmit,
-			client.NewObservationHandler(obsHandler, func(w *client.ResponseWriter, r *pool.Message) {
-				h, err := s.multicastHandler.Get(r.Token())
-				if err == nil {
-					h(w, r)
-					return
-				}
-				s.handler(w, r)
-			}),
-			s.blockwiseSZX,
-			blockWise,
-			s.goPool,
-			s.errors,
-			s.getMID,
-			monitor,
+			client.Config{
+				TransmissionNStart:             s.transmissionNStart,
+				TransmissionAcknowledgeTimeout: s.transmissionAcknowledgeTimeout,
+				TransmissionMaxRetransmit:      s.transmissionMaxRetransmit,
+				Handler: client.NewObservationHandler(obsHandler, func(w *client.ResponseWriter, r *pool.Message) {
+					h, err := s.multicastHandler.Get(r.Token())
+					if err == nil {
+						h(w, r)
+						return
+					}
+					s.handler(w, r)
+				}),
+				BlockwiseSZX:          s.blockwiseSZX,
+				BlockWise:             blockWise,
+				GoPool:                s.goPool,
+				Errors:                s.errors,
+				MIDGenerator:          s.newMIDGenerator(session.RemoteAddr()),
+				ActivityMonitor:       monitor,
+				RawHandler:            s.rawHandler,
+				ReliableTransport:     s.reliableTransport,
+				OnExchange:            s.onExchange,
+				NonResponsePolicy:     s.nonResponsePolicy,
+				Pacing:                s.pacing,
+				OSCOREContext:         s.oscoreContext,
+				NewTransmissionParams: s.newTransmissionParams,
+				ObserveRecovery:       s.observeRecovery,
+				ControlLaneSize:       s.controlLaneSize,
+				OnRetransmit:          s.onRetransmit,
+				TraceHandler:          s.traceHandler,
+				NewDedup:              s.newDedup,
+				PooledResponses:       s.pooledResponses,
+				OnDuplicate:           s.onDuplicate,
+				Backpressure:          s.backpressure,
+				NStart:                s.nStart,
+				ParserLimits:          s.parserLimits,
+				WriteTimeout:          s.writeTimeout,
+				ExchangeTimeout:       s.exchangeTimeout,
+				MessagePool:           s.messagePool,
+			},
 		)
+		cc.SetRequestInfo(coapNet.RequestInfo{
+			Network:    "udp",
+			LocalAddr:  UDPConn.LocalAddr(),
+			RemoteAddr: raddr,
+		})
 		cc.SetContextValue(inactivityMonitorKey, monitor)
 		cc.SetContextValue(closeKey, func() {
 			session.close()
@@ -384,7 +636,13 @@ func (s *Server) getOrCreateClientConn(UDPConn *coapNet.UDPConn, raddr *net.UDPA
 			defer s.connsMutex.Unlock()
 			delete(s.conns, key)
 		})
+		if s.limiter != nil {
+			cc.AddOnClose(func() {
+				s.limiter.RemovePeer(cc)
+				s.limiter.ReleaseSession()
+			})
+		}
 		s.conns[key] = cc
 	}
-	return cc, created
+	return cc, created, nil
 }
@@ -3,17 +3,24 @@ package udp_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/limits"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
 	"github.com/plgd-dev/go-coap/v2/udp"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -139,6 +146,59 @@ func TestServer_Discover(t *testing.T) {
 	assert.Equal(t, codes.BadRequest, got[0].Code())
 }
 
+func TestMulticast(t *testing.T) {
+	leisure := time.Millisecond * 200
+	l, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer l.Close()
+	port := l.LocalAddr().(*net.UDPAddr).Port
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var served uint32
+	s := udp.NewServer(udp.WithMulticastGroups(udp.AllCoAPNodesIPv4), udp.WithMulticastLeisure(leisure), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&served, 1)
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var m sync.Mutex
+	var from []net.Addr
+	multicast := func() int {
+		ctx, cancel := context.WithTimeout(context.Background(), leisure+time.Millisecond*500)
+		defer cancel()
+		err := udp.Multicast(ctx, fmt.Sprintf("%v:%v", udp.AllCoAPNodesIPv4, port), "/a", func(addr net.Addr, resp *pool.Message) {
+			require.Equal(t, codes.Content, resp.Code())
+			m.Lock()
+			defer m.Unlock()
+			from = append(from, addr)
+		}, udp.WithMulticastHopLimit(1))
+		require.NoError(t, err)
+		m.Lock()
+		defer m.Unlock()
+		return len(from)
+	}
+	// requests are lost until the server joins the group
+	for i := 0; i < 5; i++ {
+		if multicast() > 0 {
+			break
+		}
+	}
+	m.Lock()
+	defer m.Unlock()
+	require.NotEmpty(t, from)
+	require.Equal(t, port, from[0].(*net.UDPAddr).Port)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&served))
+}
+
 func TestServer_CleanUpConns(t *testing.T) {
 	ld, err := coapNet.NewListenUDP("udp4", "")
 	require.NoError(t, err)
@@ -178,6 +238,50 @@ func TestServer_CleanUpConns(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestServer_DebugDump(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	sd := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(make([]byte, 4096)))
+	}))
+	defer sd.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(ld.LocalAddr().String(), udp.WithBlockwise(true, blockwise.SZX1024, time.Second))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	var buf bytes.Buffer
+	err = sd.DebugDump(&buf)
+	require.NoError(t, err)
+	var snapshot udp.DebugSnapshot
+	err = json.Unmarshal(buf.Bytes(), &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, ld.LocalAddr().String(), snapshot.LocalAddr)
+	require.Len(t, snapshot.Sessions, 1)
+	require.NotEmpty(t, snapshot.Sessions[0].RemoteAddr)
+	require.Greater(t, snapshot.MessagePool.Acquired, uint64(0))
+}
+
 func TestServer_InactiveMonitor(t *testing.T) {
 	inactivityDetected := false
 
@@ -257,7 +361,7 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 				checkCloseWg.Done()
 			})
 		}),
-		udp.WithKeepAlive(3, 100*time.Millisecond, func(cc inactivity.ClientConn) {
+		udp.WithKeepAlive(50*time.Millisecond, 100*time.Millisecond, func(cc inactivity.ClientConn) {
 			require.False(t, inactivityDetected)
 			inactivityDetected = true
 			cc.Close()
@@ -297,3 +401,752 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestServer_Shutdown(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := udp.NewServer(udp.WithShutdownMaxAge(time.Second*10), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		path, err := r.Path()
+		require.NoError(t, err)
+		switch path {
+		case "slow":
+			time.Sleep(time.Millisecond * 300)
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		case "obs":
+			err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("0")), message.Option{ID: message.Observe, Value: []byte{2}})
+		}
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(ld.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	notifications := make(chan *pool.Message, 4)
+	_, err = cc.Observe(ctx, "/obs", func(n *pool.Message) {
+		n.Hijack()
+		notifications <- n
+	})
+	require.NoError(t, err)
+	<-notifications
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		resp, err := cc.Get(ctx, "/slow")
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+	}()
+	// the slow request is in progress
+	time.Sleep(time.Millisecond * 100)
+	err = sd.Shutdown(ctx)
+	require.NoError(t, err)
+	<-slowDone
+
+	select {
+	case n := <-notifications:
+		require.Equal(t, codes.ServiceUnavailable, n.Code())
+		require.False(t, n.HasOption(message.Observe))
+		maxAge, err := n.GetOptionUint32(message.MaxAge)
+		require.NoError(t, err)
+		require.Equal(t, uint32(10), maxAge)
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+}
+
+func TestServer_Attach(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	l := coapNet.NewUDPConn("udp", conn)
+	defer l.Close()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	require.ErrorIs(t, s.ProcessDatagram([]byte{0x40, 0x01, 0, 1}, &net.UDPAddr{}, nil), udp.ErrServerNotAttached)
+	require.NoError(t, s.Attach(l))
+	require.Error(t, s.Attach(l))
+
+	// event loop of the application reads the socket
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1500)
+		for {
+			n, raddr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if err := s.ProcessDatagram(buf[:n], raddr, nil); err != nil {
+				return
+			}
+		}
+	}()
+	require.Equal(t, time.Second, s.ProcessTimers())
+
+	cc, err := udp.Dial(conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	payload, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(payload))
+
+	s.Detach()
+	require.ErrorIs(t, s.ProcessDatagram([]byte{0x40, 0x01, 0, 1}, &net.UDPAddr{}, nil), udp.ErrServerNotAttached)
+	require.NoError(t, l.Close())
+}
+
+func TestServer_MIDGenerator(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var peers int32
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}), udp.WithMIDGenerator(func(raddr net.Addr) client.MIDGenerator {
+		atomic.AddInt32(&peers, 1)
+		return client.NewRandomMIDGenerator(raddr)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	// every peer gets own generator
+	for i := 0; i < 2; i++ {
+		cc, err := udp.Dial(l.LocalAddr().String(), udp.WithMIDGenerator(client.NewRandomMIDGenerator))
+		require.NoError(t, err)
+		resp, err := cc.Get(ctx, "/a")
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		pool.ReleaseMessage(resp)
+		require.NoError(t, cc.Close())
+		require.Equal(t, int32(i+1), atomic.LoadInt32(&peers))
+	}
+}
+
+func TestServer_DuplicateStats(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var handled int32
+	duplicates := make(chan client.DuplicateKind, 8)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddInt32(&handled, 1)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}), udp.WithOnDuplicate(func(cc *client.ClientConn, kind client.DuplicateKind, msg *pool.Message) {
+		duplicates <- kind
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(time.Second*5)))
+	buf := make([]byte, 1500)
+	// the request is acknowledged and answered by the separate response
+	req := []byte{0x41, byte(codes.GET), 0x12, 0x34, 0x07, 0xb1, 'a'}
+	_, err = conn.Write(req)
+	require.NoError(t, err)
+	var ack []byte
+	for ack == nil {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, n, 4)
+		if buf[1] == byte(codes.Content) {
+			ack = []byte{0x60, byte(codes.Empty), buf[2], buf[3]}
+		}
+	}
+	_, err = conn.Write(ack)
+	require.NoError(t, err)
+
+	// the retransmitted request isn't passed to the handler
+	_, err = conn.Write(req)
+	require.NoError(t, err)
+	require.Equal(t, client.DuplicateRequest, <-duplicates)
+	require.Equal(t, int32(1), atomic.LoadInt32(&handled))
+	// the retransmitted acknowledgement is dropped
+	_, err = conn.Write(ack)
+	require.NoError(t, err)
+	require.Equal(t, client.DuplicateAcknowledgement, <-duplicates)
+
+	snapshot := s.DebugSnapshot()
+	require.Len(t, snapshot.Sessions, 1)
+	require.Equal(t, uint64(1), snapshot.Sessions[0].DuplicateRequests)
+	require.Equal(t, uint64(0), snapshot.Sessions[0].DuplicateResponses)
+	require.Equal(t, uint64(1), snapshot.Sessions[0].DuplicateAcks)
+}
+
+func TestServer_Limits(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		var opts message.Options
+		if _, err := r.Observe(); err == nil {
+			opts = append(opts, message.Option{ID: message.Observe, Value: []byte{2}})
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")), opts...)
+		require.NoError(t, err)
+	}), udp.WithLimits(limits.Limits{
+		MaxSessions:     1,
+		MaxObservations: 1,
+		RetryAfter:      time.Second * 3,
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	observe := message.Option{ID: message.Observe, Value: []byte{}}
+	resp, err := cc.Get(ctx, "/a", observe)
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	pool.ReleaseMessage(resp)
+	// the second observation of the peer is rejected
+	resp, err = cc.Get(ctx, "/a", observe)
+	require.NoError(t, err)
+	require.Equal(t, codes.TooManyRequests, resp.Code())
+	maxAge, err := resp.GetOptionUint32(message.MaxAge)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), maxAge)
+	pool.ReleaseMessage(resp)
+
+	// the second peer is rejected without a session
+	cc2, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc2.Close()
+	resp, err = cc2.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.TooManyRequests, resp.Code())
+	pool.ReleaseMessage(resp)
+	require.Len(t, s.DebugSnapshot().Sessions, 1)
+}
+
+func TestServer_LimitsMessageRate(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var handled int32
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddInt32(&handled, 1)
+	}), udp.WithLimits(limits.Limits{
+		MessageRate:  0.01,
+		MessageBurst: 2,
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(time.Second*5)))
+	buf := make([]byte, 1500)
+	// non-confirmable requests without a response
+	for i := byte(0); i < 3; i++ {
+		_, err = conn.Write([]byte{0x51, byte(codes.GET), 0x12, i, i, 0xb1, 'a'})
+		require.NoError(t, err)
+	}
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, n, 5)
+	require.Equal(t, byte(codes.TooManyRequests), buf[1])
+	// token of the third request
+	require.Equal(t, byte(2), buf[4])
+	require.Equal(t, int32(2), atomic.LoadInt32(&handled))
+}
+
+func TestServer_Backpressure(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	type observer struct {
+		cc    *client.ClientConn
+		token message.Token
+	}
+	observers := make(chan observer, 1)
+	slow := make(chan int, 16)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("0")), message.Option{ID: message.Observe, Value: []byte{2}})
+		require.NoError(t, err)
+		observers <- observer{cc: w.ClientConn(), token: append(message.Token(nil), r.Token()...)}
+	}),
+		// notifications wait for pacing after the registration
+		udp.WithPacing(1, 64),
+		udp.WithBackpressure(2, func(cc *client.ClientConn, token message.Token, backlog int) {
+			slow <- backlog
+		}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err = cc.Observe(ctx, "/obs", func(*pool.Message) {})
+	require.NoError(t, err)
+	o := <-observers
+
+	const n = 8
+	var notifyWg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		notifyWg.Add(1)
+		go func(seq int) {
+			defer notifyWg.Done()
+			notifyCtx, notifyCancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+			defer notifyCancel()
+			m := pool.AcquireMessage(notifyCtx)
+			defer pool.ReleaseMessage(m)
+			m.SetCode(codes.Content)
+			m.SetToken(o.token)
+			m.SetObserve(uint32(seq + 3))
+			m.SetType(udpMessage.NonConfirmable)
+			m.SetContentFormat(message.TextPlain)
+			m.SetBody(bytes.NewReader([]byte("data")))
+			// notifications over the pacing rate are dropped when their context expires
+			_ = o.cc.WriteMessage(m)
+		}(i)
+	}
+	select {
+	case backlog := <-slow:
+		require.GreaterOrEqual(t, backlog, 2)
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+	require.Greater(t, o.cc.ObserverBacklog(o.token), 0)
+	notifyWg.Wait()
+	require.Equal(t, 0, o.cc.ObserverBacklog(o.token))
+}
+
+func TestServer_RespondTo(t *testing.T) {
+	la, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	addr := la.LocalAddr().String()
+
+	routes := make(chan udp.ResponseRoute, 1)
+	sa := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		sr := w.Defer(time.Second*5, codes.Empty)
+		// the standby node responds
+		routes <- sr.Route()
+		sr.Cancel()
+	}))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sa.Serve(la)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(addr)
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	type result struct {
+		resp *pool.Message
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := cc.Get(ctx, "/a")
+		done <- result{resp: resp, err: err}
+	}()
+	route := <-routes
+
+	// the standby node takes over the address
+	sa.Stop()
+	wg.Wait()
+	require.NoError(t, la.Close())
+	lb, err := coapNet.NewListenUDP("udp", addr)
+	require.NoError(t, err)
+	defer lb.Close()
+	defer wg.Wait()
+	sb := udp.NewServer()
+	defer sb.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sb.Serve(lb)
+		require.NoError(t, err)
+	}()
+
+	resp := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(resp)
+	resp.SetCode(codes.Content)
+	resp.SetContentFormat(message.TextPlain)
+	resp.SetBody(bytes.NewReader([]byte("standby")))
+	require.Eventually(t, func() bool {
+		return !errors.Is(sb.RespondTo(route, resp), udp.ErrServerNotAttached)
+	}, time.Second, time.Millisecond*10)
+	select {
+	case r := <-done:
+		require.NoError(t, r.err)
+		require.Equal(t, codes.Content, r.resp.Code())
+		body, err := r.resp.ReadBody()
+		require.NoError(t, err)
+		require.Equal(t, []byte("standby"), body)
+		pool.ReleaseMessage(r.resp)
+	case <-ctx.Done():
+		require.NoError(t, ctx.Err())
+	}
+
+	// safety checks of the route
+	invalid := route
+	invalid.Token = nil
+	require.ErrorIs(t, sb.RespondTo(invalid, resp), client.ErrInvalidRoute)
+	invalid = route
+	invalid.RemoteAddr = "224.0.1.187:5683"
+	require.ErrorIs(t, sb.RespondTo(invalid, resp), client.ErrInvalidRoute)
+	invalid = route
+	invalid.Expires = time.Now()
+	require.ErrorIs(t, sb.RespondTo(invalid, resp), client.ErrRouteExpired)
+}
+
+// progressRecorder records the last progress of transfers.
+type progressRecorder struct {
+	mutex       sync.Mutex
+	transferred int64
+	total       int64
+	onProgress  func(transferred, total int64)
+}
+
+func (p *progressRecorder) progress(_ message.Token, transferred, total int64) {
+	p.mutex.Lock()
+	p.transferred = transferred
+	p.total = total
+	onProgress := p.onProgress
+	p.mutex.Unlock()
+	if onProgress != nil {
+		onProgress(transferred, total)
+	}
+}
+
+func (p *progressRecorder) last() (int64, int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.transferred, p.total
+}
+
+func TestServer_BlockwiseProgress(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	body := bytes.Repeat([]byte{0xAB}, 8192)
+	var serverProgress progressRecorder
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if r.Code() == codes.POST {
+			err := w.SetResponse(codes.Changed, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		err := w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(body))
+		require.NoError(t, err)
+	}), udp.WithBlockwiseProgress(serverProgress.progress))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var clientProgress progressRecorder
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithBlockwise(true, blockwise.SZX16, time.Second*5),
+		udp.WithBlockwiseProgress(clientProgress.progress))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	// upload of the body is reported by both sides
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	_, err = cc.Post(ctx, "/fw", message.AppOctets, bytes.NewReader(body[:1000]))
+	require.NoError(t, err)
+	transferred, total := clientProgress.last()
+	require.Equal(t, int64(1000), transferred)
+	require.Equal(t, int64(1000), total)
+	transferred, total = serverProgress.last()
+	require.Equal(t, int64(1000), transferred)
+	require.Equal(t, int64(1000), total)
+
+	// download is aborted by cancellation of the request
+	getCtx, getCancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer getCancel()
+	clientProgress.mutex.Lock()
+	clientProgress.onProgress = func(transferred, total int64) {
+		if transferred >= 2048 {
+			getCancel()
+		}
+	}
+	clientProgress.mutex.Unlock()
+	_, err = cc.Get(getCtx, "/fw")
+	require.ErrorIs(t, err, context.Canceled)
+	time.Sleep(time.Millisecond * 500)
+	transferred, total = clientProgress.last()
+	require.Less(t, transferred, int64(len(body)))
+	require.Equal(t, int64(len(body)), total)
+	transferred, _ = serverProgress.last()
+	require.Less(t, transferred, int64(len(body)))
+}
+
+// isSTUN recognizes STUN messages, which have the two most significant bits zero unlike CoAP messages of version 1.
+func isSTUN(datagram []byte) bool {
+	return len(datagram) >= 20 && datagram[0]>>6 == 0
+}
+
+func TestServer_Demux(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stunRequest := append([]byte{0x00, 0x01, 0x00, 0x00}, bytes.Repeat([]byte{0x42}, 16)...)
+	stunResponse := append([]byte{0x01, 0x01, 0x00, 0x00}, bytes.Repeat([]byte{0x42}, 16)...)
+	serverSTUN := make(chan []byte, 1)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("coap")))
+		require.NoError(t, err)
+	}), udp.WithDemux(func(datagram []byte, raddr *net.UDPAddr) bool {
+		if !isSTUN(datagram) {
+			return false
+		}
+		serverSTUN <- append([]byte(nil), datagram...)
+		err := l.WriteWithContext(context.Background(), raddr, stunResponse)
+		require.NoError(t, err)
+		return true
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	raddr, err := net.ResolveUDPAddr("udp", l.LocalAddr().String())
+	require.NoError(t, err)
+	conn, err := net.DialUDP("udp", nil, raddr)
+	require.NoError(t, err)
+	clientSTUN := make(chan []byte, 1)
+	cc := udp.Client(conn, udp.WithDemux(func(datagram []byte, raddr *net.UDPAddr) bool {
+		if !isSTUN(datagram) {
+			return false
+		}
+		clientSTUN <- append([]byte(nil), datagram...)
+		return true
+	}))
+	defer cc.Close()
+
+	// the STUN exchange shares the socket with CoAP
+	_, err = conn.Write(stunRequest)
+	require.NoError(t, err)
+	select {
+	case got := <-serverSTUN:
+		require.Equal(t, stunRequest, got)
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "server didn't divert STUN request")
+	}
+	select {
+	case got := <-clientSTUN:
+		require.Equal(t, stunResponse, got)
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "client didn't divert STUN response")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("coap"), body)
+}
+
+func TestServer_RequestInfo(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	infos := make(chan coapNet.RequestInfo, 2)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		info, ok := coapNet.RequestInfoFromContext(r.Context())
+		require.True(t, ok)
+		infos <- info
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err = cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	info := <-infos
+	require.Equal(t, "udp", info.Network)
+	require.Equal(t, l.LocalAddr().String(), info.LocalAddr.String())
+	require.NotNil(t, info.RemoteAddr)
+	require.True(t, info.Confirmable)
+	require.False(t, info.Multicast)
+	require.Empty(t, info.CipherSuite)
+
+	req, err := client.NewGetRequest(ctx, "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(req)
+	req.SetType(udpMessage.NonConfirmable)
+	_, err = cc.Do(req)
+	require.NoError(t, err)
+	info = <-infos
+	require.False(t, info.Confirmable)
+}
+
+func TestServer_ParserLimits(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	errs := make(chan error, 4)
+	sd := udp.NewServer(udp.WithParserLimits(8, 16, 0, 4), udp.WithErrors(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Changed, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(ld.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("too large")))
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code())
+	size, err := resp.GetOptionUint32(message.Size1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), size)
+	var limitErr *message.ParserLimitError
+	require.ErrorAs(t, <-errs, &limitErr)
+	require.Equal(t, message.LimitPayload, limitErr.Limit)
+
+	resp, err = cc.Get(ctx, "/a", message.Option{ID: message.URIQuery, Value: bytes.Repeat([]byte("q"), 17)})
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code())
+	require.ErrorAs(t, <-errs, &limitErr)
+	require.Equal(t, message.LimitOptionLen, limitErr.Limit)
+
+	// the session is not closed by the rejected requests
+	resp, err = cc.Post(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("ok")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+}
@@ -15,10 +15,10 @@ import (
 type EventFunc = func()
 
 type Session struct {
-	connection     *coapNet.UDPConn
-	raddr          *net.UDPAddr
+	connection     coapNet.Transport
 	maxMessageSize int
 	closeSocket    bool
+	demux          DemuxFunc
 
 	mutex   sync.Mutex
 	onClose []EventFunc
@@ -43,8 +43,7 @@ func NewSession(
 	doneCtx, doneCancel := context.WithCancel(ctx)
 	s := &Session{
 		cancel:         cancel,
-		connection:     connection,
-		raddr:          raddr,
+		connection:     coapNet.NewUDPTransport(connection, raddr),
 		maxMessageSize: maxMessageSize,
 		closeSocket:    closeSocket,
 		doneCtx:        doneCtx,
@@ -106,7 +105,7 @@ func (s *Session) WriteMessage(req *pool.Message) error {
 	if err != nil {
 		return fmt.Errorf("cannot marshal: %w", err)
 	}
-	return s.connection.WriteWithContext(req.Context(), s.raddr, data)
+	return s.connection.WriteMessage(req.Context(), data)
 }
 
 func (s *Session) Run(cc *client.ClientConn) (err error) {
@@ -123,11 +122,14 @@ func (s *Session) Run(cc *client.ClientConn) (err error) {
 	m := make([]byte, s.maxMessageSize)
 	for {
 		buf := m
-		n, _, err := s.connection.ReadWithContext(s.Context(), buf)
+		n, err := s.connection.ReadMessage(s.Context(), buf)
 		if err != nil {
 			return err
 		}
 		buf = buf[:n]
+		if s.demux != nil && s.demux(buf, s.udpAddr()) {
+			continue
+		}
 		err = cc.Process(buf)
 		if err != nil {
 			return err
@@ -135,10 +137,15 @@ func (s *Session) Run(cc *client.ClientConn) (err error) {
 	}
 }
 
+func (s *Session) udpAddr() *net.UDPAddr {
+	raddr, _ := s.connection.RemoteAddr().(*net.UDPAddr)
+	return raddr
+}
+
 func (s *Session) MaxMessageSize() int {
 	return s.maxMessageSize
 }
 
 func (s *Session) RemoteAddr() net.Addr {
-	return s.raddr
+	return s.connection.RemoteAddr()
 }
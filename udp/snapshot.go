@@ -0,0 +1,45 @@
+package udp
+
+import (
+	"sort"
+	"time"
+
+	messagePool "github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// DebugSnapshot is state of the server, e.g. to attach to a bug report.
+type DebugSnapshot struct {
+	Time      time.Time `json:"time"`
+	LocalAddr string    `json:"localAddr,omitempty"`
+	// Sessions contains state of connections sorted by remote address.
+	Sessions []client.ConnSnapshot `json:"sessions"`
+	// Discoveries is number of multicast or discovery requests waiting for responses.
+	Discoveries int `json:"discoveries"`
+	// MessagePool contains usage statistics of the Message pool.
+	MessagePool messagePool.Stats `json:"messagePool"`
+}
+
+// DebugSnapshot returns state of the server and its connections.
+func (s *Server) DebugSnapshot() DebugSnapshot {
+	snapshot := DebugSnapshot{
+		Time:        time.Now(),
+		Discoveries: s.multicastHandler.Len(),
+		MessagePool: pool.Stats(),
+	}
+	s.listenMutex.Lock()
+	if s.listen != nil {
+		snapshot.LocalAddr = s.listen.LocalAddr().String()
+	}
+	s.listenMutex.Unlock()
+	conns := s.getClientConns()
+	snapshot.Sessions = make([]client.ConnSnapshot, 0, len(conns))
+	for _, cc := range conns {
+		snapshot.Sessions = append(snapshot.Sessions, cc.Snapshot())
+	}
+	sort.Slice(snapshot.Sessions, func(i, j int) bool {
+		return snapshot.Sessions[i].RemoteAddr < snapshot.Sessions[j].RemoteAddr
+	})
+	return snapshot
+}
@@ -0,0 +1,151 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"golang.org/x/net/websocket"
+)
+
+// A DialOption sets options such as credentials, keepalive parameters, etc.
+type DialOption interface {
+	applyDial(*dialOptions)
+}
+
+var defaultDialOptions = dialOptions{
+	ctx:            context.Background(),
+	maxMessageSize: 64 * 1024,
+	errors: func(err error) {
+		fmt.Println(err)
+	},
+	dialer: &net.Dialer{Timeout: time.Second * 3},
+}
+
+type dialOptions struct {
+	ctx            context.Context
+	maxMessageSize int
+	errors         ErrorFunc
+	logger         coapNet.Logger
+	dialer         *net.Dialer
+	tlsCfg         *tls.Config
+	origin         string
+	header         http.Header
+	keepAlive      *keepAlive
+	keepAliveMode  KeepAliveMode
+	tcp            []tcp.DialOption
+}
+
+// Dial creates a client connection to the given target. The target is WebSocket URL with ws or wss scheme,
+// or CoAP URI with coap+ws or coaps+ws scheme, whose WebSocket endpoint is at WellKnownPath.
+func Dial(target string, opts ...DialOption) (*ClientConn, error) {
+	cfg := defaultDialOptions
+	cfg.header = make(http.Header)
+	cfg.tcp = nil
+	for _, o := range opts {
+		o.applyDial(&cfg)
+	}
+
+	location, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	origin := cfg.origin
+	if origin == "" {
+		origin = "http://" + location.Host
+		if location.Scheme == "wss" {
+			origin = "https://" + location.Host
+		}
+	}
+	config, err := websocket.NewConfig(location.String(), origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %v: %w", target, err)
+	}
+	config.Protocol = []string{Subprotocol}
+	config.Header = cfg.header
+
+	addr := location.Host
+	if location.Port() == "" {
+		port := "80"
+		if location.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(location.Hostname(), port)
+	}
+	var conn net.Conn
+	if location.Scheme == "wss" {
+		tlsCfg := cfg.tlsCfg
+		if tlsCfg == nil {
+			tlsCfg = &tls.Config{}
+		}
+		conn, err = tls.DialWithDialer(cfg.dialer, "tcp", addr, tlsCfg)
+	} else {
+		conn, err = cfg.dialer.DialContext(cfg.ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := cfg.ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	p := newPinger()
+	ws, err := websocket.NewClient(config, p.conn(conn))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot upgrade connection: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+	ws.MaxPayloadBytes = cfg.maxMessageSize
+
+	errorsFunc := cfg.errors
+	tcpOpts := cfg.tcp
+	if cfg.logger != nil {
+		// the coap+tcp session logs its events by coapNet.LogTraceHandler
+		tcpOpts = append(tcpOpts, tcp.WithLogger(cfg.logger))
+	}
+	tcpOpts = append(tcpOpts,
+		tcp.WithContext(cfg.ctx),
+		tcp.WithMaxMessageSize(cfg.maxMessageSize),
+		tcp.WithErrors(func(err error) {
+			if errors.Is(err, context.Canceled) {
+				// this error was produced by cancellation context - don't report it.
+				return
+			}
+			errorsFunc(fmt.Errorf("ws: %w", err))
+		}),
+		tcp.WithCloseSocket(),
+	)
+	if cfg.keepAlive != nil {
+		tcpOpts = append(tcpOpts, keepAliveOption(cfg.keepAlive, cfg.keepAliveMode))
+	}
+	return tcp.Client(newConn(ws, conn.LocalAddr(), conn.RemoteAddr(), p), tcpOpts...), nil
+}
+
+func parseTarget(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %v: %w", target, err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "coap+ws":
+		u.Scheme = "ws"
+		u.Path = WellKnownPath
+	case "coaps+ws":
+		u.Scheme = "wss"
+		u.Path = WellKnownPath
+	default:
+		return nil, fmt.Errorf("invalid target %v: unsupported scheme %v", target, u.Scheme)
+	}
+	if u.Path == "" {
+		u.Path = WellKnownPath
+	}
+	return u, nil
+}
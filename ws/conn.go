@@ -0,0 +1,228 @@
+package ws
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
+	"golang.org/x/net/websocket"
+)
+
+var errClosed = errors.New("use of closed network connection")
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// conn adapts WebSocket connection to the stream of coap+tcp messages, so it can be served by tcp.Session.
+// Every WebSocket message carries exactly one CoAP message without the length (RFC 8323 section 4.2).
+type conn struct {
+	ws     *websocket.Conn
+	local  net.Addr
+	remote net.Addr
+	pinger *pinger
+
+	frames  chan []byte
+	readErr error
+	pending []byte
+
+	deadlineMutex sync.Mutex
+	readDeadline  time.Time
+
+	writeMutex sync.Mutex
+	writeBuf   []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(ws *websocket.Conn, local, remote net.Addr, p *pinger) *conn {
+	ws.PayloadType = websocket.BinaryFrame
+	c := &conn{
+		ws:     ws,
+		local:  local,
+		remote: remote,
+		pinger: p,
+		frames: make(chan []byte),
+		done:   make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// readLoop reads WebSocket messages in own goroutine, because a read deadline which expires in the middle
+// of a frame breaks the WebSocket framing.
+func (c *conn) readLoop() {
+	defer close(c.frames)
+	for {
+		var frame []byte
+		err := websocket.Message.Receive(c.ws, &frame)
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		data, err := wsToTCP(frame)
+		if err != nil {
+			c.readErr = err
+			return
+		}
+		select {
+		case c.frames <- data:
+		case <-c.done:
+			c.readErr = errClosed
+			return
+		}
+	}
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	if len(c.pending) == 0 {
+		c.deadlineMutex.Lock()
+		deadline := c.readDeadline
+		c.deadlineMutex.Unlock()
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, timeoutError{}
+			}
+			t := time.NewTimer(d)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case data, ok := <-c.frames:
+			if !ok {
+				return 0, c.readErr
+			}
+			c.pending = data
+		case <-timeout:
+			return 0, timeoutError{}
+		case <-c.done:
+			return 0, errClosed
+		}
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends every complete CoAP message in b as one WebSocket message. An incomplete message is kept
+// until the rest of it is written.
+func (c *conn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.writeBuf = append(c.writeBuf, b...)
+	for len(c.writeBuf) > 0 {
+		frame, n, err := tcpToWS(c.writeBuf)
+		if err == message.ErrShortRead {
+			break
+		}
+		if err != nil {
+			c.writeBuf = c.writeBuf[:0]
+			return 0, err
+		}
+		err = websocket.Message.Send(c.ws, frame)
+		if err != nil {
+			return 0, err
+		}
+		c.writeBuf = c.writeBuf[n:]
+	}
+	if len(c.writeBuf) == 0 {
+		c.writeBuf = c.writeBuf[:0]
+	}
+	return len(b), nil
+}
+
+func (c *conn) Close() error {
+	err := errClosed
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.ws.Close()
+	})
+	return err
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline is ignored, because a WebSocket message cannot be interrupted and written again.
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// tcpToWS converts the first coap+tcp message in data to WebSocket framing, which has zero Len and no Extended Length.
+// It returns the frame and number of bytes consumed from data.
+func tcpToWS(data []byte) ([]byte, int, error) {
+	var hdr coapTCP.MessageHeader
+	err := hdr.Unmarshal(data)
+	if err != nil {
+		return nil, -1, err
+	}
+	if len(data) < hdr.TotalLen {
+		return nil, -1, message.ErrShortRead
+	}
+	tkl := int(data[0] & 0x0f)
+	extLen := hdr.HeaderLen - 2 - tkl
+	frame := make([]byte, 0, hdr.TotalLen-extLen)
+	frame = append(frame, byte(tkl))
+	frame = append(frame, data[1+extLen:hdr.TotalLen]...)
+	return frame, hdr.TotalLen, nil
+}
+
+// wsToTCP converts WebSocket frame to coap+tcp message.
+func wsToTCP(frame []byte) ([]byte, error) {
+	if len(frame) < 2 {
+		return nil, fmt.Errorf("invalid message: too short")
+	}
+	if frame[0]>>4 != 0 {
+		return nil, fmt.Errorf("invalid message: length must be zero")
+	}
+	tkl := int(frame[0] & 0x0f)
+	if tkl > message.MaxTokenSize {
+		return nil, message.ErrInvalidTokenLen
+	}
+	if len(frame) < 2+tkl {
+		return nil, fmt.Errorf("invalid message: too short")
+	}
+	bodyLen := len(frame) - 2 - tkl
+	data := make([]byte, 0, len(frame)+4)
+	switch {
+	case bodyLen < coapTCP.MESSAGE_LEN13_BASE:
+		data = append(data, byte(bodyLen<<4|tkl))
+	case bodyLen < coapTCP.MESSAGE_LEN14_BASE:
+		data = append(data, byte(13<<4|tkl), byte(bodyLen-coapTCP.MESSAGE_LEN13_BASE))
+	case bodyLen < coapTCP.MESSAGE_LEN15_BASE:
+		data = append(data, byte(14<<4|tkl), 0, 0)
+		binary.BigEndian.PutUint16(data[1:], uint16(bodyLen-coapTCP.MESSAGE_LEN14_BASE))
+	case bodyLen < coapTCP.MESSAGE_MAX_LEN:
+		data = append(data, byte(15<<4|tkl), 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[1:], uint32(bodyLen-coapTCP.MESSAGE_LEN15_BASE))
+	default:
+		return nil, fmt.Errorf("invalid message: too long")
+	}
+	return append(data, frame[1:]...), nil
+}
@@ -0,0 +1,42 @@
+package ws
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFraming(t *testing.T) {
+	for _, size := range []int{0, 5, 12, 13, 268, 269, 65804, 65805, 70000} {
+		msg := coapTCP.Message{
+			Code:    codes.POST,
+			Token:   []byte{1, 2, 3},
+			Options: message.Options{{ID: message.URIPath, Value: []byte("a")}},
+			Payload: bytes.Repeat([]byte{'x'}, size),
+		}
+		data, err := msg.Marshal()
+		require.NoError(t, err)
+
+		frame, n, err := tcpToWS(append(data, 0xff))
+		require.NoError(t, err)
+		require.Equal(t, len(data), n)
+		require.Equal(t, byte(len(msg.Token)), frame[0])
+		require.Equal(t, byte(codes.POST), frame[1])
+		require.Equal(t, msg.Token, frame[2:5])
+
+		got, err := wsToTCP(frame)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+
+	_, _, err := tcpToWS([]byte{0x53})
+	require.Equal(t, message.ErrShortRead, err)
+	_, err = wsToTCP([]byte{0x10, byte(codes.GET)})
+	require.Error(t, err)
+	_, err = wsToTCP([]byte{0x02, byte(codes.GET), 1})
+	require.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package ws
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"golang.org/x/net/websocket"
+)
+
+// KeepAliveMode selects messages by which the keepalive pings the peer.
+type KeepAliveMode int
+
+const (
+	// KeepAliveCoAP pings by CoAP Ping signal (7.02), which is answered by CoAP layer of the peer.
+	KeepAliveCoAP KeepAliveMode = iota
+	// KeepAliveWebSocket pings by WebSocket Ping control frame, which is answered by WebSocket layer of the peer,
+	// e.g. a browser, and it keeps intermediaries such as load balancers from dropping the idle connection.
+	KeepAliveWebSocket
+)
+
+func (m KeepAliveMode) String() string {
+	switch m {
+	case KeepAliveCoAP:
+		return "CoAP"
+	case KeepAliveWebSocket:
+		return "WebSocket"
+	}
+	return fmt.Sprintf("KeepAliveMode(%d)", int(m))
+}
+
+// keepAlive is keepalive configuration of options.
+type keepAlive struct {
+	params     *inactivity.KeepAliveParams
+	onInactive inactivity.OnInactiveFunc
+}
+
+// keepAliveOption returns keepalive option of the tcp session which pings in the mode.
+func keepAliveOption(k *keepAlive, mode KeepAliveMode) tcp.KeepAliveOpt {
+	if mode == KeepAliveWebSocket {
+		return tcp.WithKeepAlivePing(k.params, k.onInactive, pingFrame)
+	}
+	return tcp.WithKeepAliveParams(k.params, k.onInactive)
+}
+
+// pingFrame pings the peer of the connection by WebSocket Ping frame.
+func pingFrame(cc *tcp.ClientConn, receivePong func()) (func(), error) {
+	c, ok := cc.NetConn().(*conn)
+	if !ok {
+		return nil, fmt.Errorf("connection %T isn't WebSocket", cc.NetConn())
+	}
+	return c.pinger.ping(c.ws, receivePong)
+}
+
+var pingCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		return v.([]byte), websocket.PingFrame, nil
+	},
+}
+
+// pinger pings the peer by WebSocket Ping frames. Pong frames are consumed by the websocket package, so
+// anything read from the connection after the ping answers it.
+type pinger struct {
+	mutex   sync.Mutex
+	pending func()
+}
+
+func newPinger() *pinger {
+	return &pinger{}
+}
+
+func (p *pinger) ping(ws *websocket.Conn, receivePong func()) (func(), error) {
+	p.mutex.Lock()
+	p.pending = receivePong
+	p.mutex.Unlock()
+	err := pingCodec.Send(ws, []byte{})
+	if err != nil {
+		p.cancel()
+		return nil, fmt.Errorf("cannot send ping: %w", err)
+	}
+	return p.cancel, nil
+}
+
+func (p *pinger) cancel() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pending = nil
+}
+
+// received answers the pending ping.
+func (p *pinger) received() {
+	p.mutex.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mutex.Unlock()
+	if pending != nil {
+		pending()
+	}
+}
+
+// reader returns r which reports data read from it to the pinger.
+func (p *pinger) reader(r io.Reader) io.Reader {
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := r.Read(b)
+		if n > 0 {
+			p.received()
+		}
+		return n, err
+	})
+}
+
+type readerFunc func(b []byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) {
+	return f(b)
+}
+
+// pingerConn is client connection whose reads are reported to the pinger.
+type pingerConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c pingerConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (p *pinger) conn(c net.Conn) net.Conn {
+	return pingerConn{Conn: c, r: p.reader(c)}
+}
+
+// pingerResponseWriter reports reads of the hijacked server connection to the pinger.
+type pingerResponseWriter struct {
+	http.ResponseWriter
+	pinger *pinger
+}
+
+func (w pingerResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T doesn't support hijacking", w.ResponseWriter)
+	}
+	c, buf, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, bufio.NewReadWriter(bufio.NewReader(w.pinger.reader(buf.Reader)), buf.Writer), nil
+}
@@ -0,0 +1,355 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/observation"
+	"github.com/plgd-dev/go-coap/v2/oscore"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// HandlerFuncOpt handler function option.
+type HandlerFuncOpt struct {
+	opt tcp.HandlerFuncOpt
+}
+
+func (o HandlerFuncOpt) apply(opts *serverOptions) {
+	opts.tcp = append(opts.tcp, o.opt)
+}
+
+func (o HandlerFuncOpt) applyDial(opts *dialOptions) {
+	opts.tcp = append(opts.tcp, o.opt)
+}
+
+// WithHandlerFunc set handle for handling request's.
+func WithHandlerFunc(h HandlerFunc) HandlerFuncOpt {
+	return HandlerFuncOpt{opt: tcp.WithHandlerFunc(h)}
+}
+
+// WithMux set's multiplexer for handle requests.
+func WithMux(m mux.Handler) HandlerFuncOpt {
+	return HandlerFuncOpt{opt: tcp.WithMux(m)}
+}
+
+// ContextOpt handler function option.
+type ContextOpt struct {
+	ctx context.Context
+}
+
+func (o ContextOpt) apply(opts *serverOptions) {
+	opts.ctx = o.ctx
+}
+
+func (o ContextOpt) applyDial(opts *dialOptions) {
+	opts.ctx = o.ctx
+}
+
+// WithContext set's parent context of server.
+func WithContext(ctx context.Context) ContextOpt {
+	return ContextOpt{ctx: ctx}
+}
+
+// MaxMessageSizeOpt handler function option.
+type MaxMessageSizeOpt struct {
+	maxMessageSize int
+}
+
+func (o MaxMessageSizeOpt) apply(opts *serverOptions) {
+	opts.maxMessageSize = o.maxMessageSize
+}
+
+func (o MaxMessageSizeOpt) applyDial(opts *dialOptions) {
+	opts.maxMessageSize = o.maxMessageSize
+}
+
+// WithMaxMessageSize limit size of processed message.
+func WithMaxMessageSize(maxMessageSize int) MaxMessageSizeOpt {
+	return MaxMessageSizeOpt{maxMessageSize: maxMessageSize}
+}
+
+// ErrorsOpt errors option.
+type ErrorsOpt struct {
+	errors ErrorFunc
+}
+
+func (o ErrorsOpt) apply(opts *serverOptions) {
+	opts.errors = o.errors
+}
+
+func (o ErrorsOpt) applyDial(opts *dialOptions) {
+	opts.errors = o.errors
+}
+
+// WithErrors set function for logging error.
+func WithErrors(errors ErrorFunc) ErrorsOpt {
+	return ErrorsOpt{errors: errors}
+}
+
+// LoggerOpt logger option.
+type LoggerOpt struct {
+	logger coapNet.Logger
+}
+
+func (o LoggerOpt) apply(opts *serverOptions) {
+	opts.logger = o.logger
+	opts.errors = coapNet.LogErrors(o.logger)
+}
+
+func (o LoggerOpt) applyDial(opts *dialOptions) {
+	opts.logger = o.logger
+	opts.errors = coapNet.LogErrors(o.logger)
+}
+
+// WithLogger sets leveled logger of errors and of events of connections: opening and closing of sessions,
+// blockwise steps and registrations and deregistrations of observations, see coapNet.LogTraceHandler.
+// It replaces the function set by WithErrors before it.
+func WithLogger(logger coapNet.Logger) LoggerOpt {
+	return LoggerOpt{logger: logger}
+}
+
+// TCPOpt forwards option to the coap+tcp session which serves the WebSocket connection.
+type TCPOpt struct {
+	server tcp.ServerOption
+	dial   tcp.DialOption
+}
+
+func (o TCPOpt) apply(opts *serverOptions) {
+	if o.server != nil {
+		opts.tcp = append(opts.tcp, o.server)
+	}
+}
+
+func (o TCPOpt) applyDial(opts *dialOptions) {
+	if o.dial != nil {
+		opts.tcp = append(opts.tcp, o.dial)
+	}
+}
+
+// WithGoPool sets function for managing spawning go routines
+// for handling incoming request's.
+// Eg: https://github.com/panjf2000/ants.
+func WithGoPool(goPool GoPoolFunc) TCPOpt {
+	o := tcp.WithGoPool(goPool)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithMessagePool sets pool of messages acquired by the coap+tcp sessions, see tcp.WithMessagePool.
+func WithMessagePool(p *pool.Pool) TCPOpt {
+	o := tcp.WithMessagePool(p)
+	return TCPOpt{server: o, dial: o}
+}
+
+// KeepAliveOpt keepalive option.
+type KeepAliveOpt struct {
+	keepAlive keepAlive
+}
+
+func (o KeepAliveOpt) apply(opts *serverOptions) {
+	opts.keepAlive = &o.keepAlive
+}
+
+func (o KeepAliveOpt) applyDial(opts *dialOptions) {
+	opts.keepAlive = &o.keepAlive
+}
+
+// WithKeepAlive pings the connection idle for interval and calls onInactive when the peer doesn't answer
+// within timeout. The peer is pinged by messages of WithKeepAliveMode, by default by a Ping signal. The interval
+// is at least inactivity.MinKeepAliveInterval.
+func WithKeepAlive(interval, timeout time.Duration, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+	return WithKeepAliveParams(inactivity.NewKeepAliveParams(interval, timeout), onInactive)
+}
+
+// WithKeepAliveParams is WithKeepAlive with the interval and timeout shared by all connections, which can be
+// changed without restarting the server.
+func WithKeepAliveParams(params *inactivity.KeepAliveParams, onInactive inactivity.OnInactiveFunc) KeepAliveOpt {
+	return KeepAliveOpt{keepAlive: keepAlive{
+		params:     params,
+		onInactive: onInactive,
+	}}
+}
+
+// KeepAliveModeOpt keepalive mode option.
+type KeepAliveModeOpt struct {
+	mode KeepAliveMode
+}
+
+func (o KeepAliveModeOpt) apply(opts *serverOptions) {
+	opts.keepAliveMode = o.mode
+}
+
+func (o KeepAliveModeOpt) applyDial(opts *dialOptions) {
+	opts.keepAliveMode = o.mode
+}
+
+// WithKeepAliveMode selects whether the keepalive pings by CoAP Ping signal or by WebSocket Ping frame.
+// Either way liveness of the peer is reported by Liveness of the connection. Default is KeepAliveCoAP.
+func WithKeepAliveMode(mode KeepAliveMode) KeepAliveModeOpt {
+	return KeepAliveModeOpt{mode: mode}
+}
+
+// WithInactivityMonitor set deadline's for read operations over client connection.
+func WithInactivityMonitor(duration time.Duration, onInactive inactivity.OnInactiveFunc) TCPOpt {
+	o := tcp.WithInactivityMonitor(duration, onInactive)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithHeartBeat set deadline's for read/write operations over client connection.
+func WithHeartBeat(heartbeat time.Duration) TCPOpt {
+	o := tcp.WithHeartBeat(heartbeat)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithBlockwise configure's blockwise transfer.
+func WithBlockwise(enable bool, szx blockwise.SZX, transferTimeout time.Duration) TCPOpt {
+	o := tcp.WithBlockwise(enable, szx, transferTimeout)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithBlockwiseLimits sets timeouts and memory caps of partial blockwise transfers per peer, and function
+// which is called when a stalled transfer is dropped.
+func WithBlockwiseLimits(limits blockwise.Limits) TCPOpt {
+	o := tcp.WithBlockwiseLimits(limits)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithControlLane sets number of queued signal messages, e.g. pings and pongs, which are processed by
+// a dedicated go routine instead of the reading go routine.
+func WithControlLane(size int) TCPOpt {
+	o := tcp.WithControlLane(size)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithDisablePeerTCPSignalMessageCSMs ignor peer's CSM message.
+func WithDisablePeerTCPSignalMessageCSMs() TCPOpt {
+	o := tcp.WithDisablePeerTCPSignalMessageCSMs()
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithDisableTCPSignalMessageCSM don't send CSM when client conn is created.
+func WithDisableTCPSignalMessageCSM() TCPOpt {
+	o := tcp.WithDisableTCPSignalMessageCSM()
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithObservationStore persists observations of the client to store, so they can be re-established
+// by RestoreObservations after restart.
+func WithObservationStore(store observation.Store) TCPOpt {
+	return TCPOpt{dial: tcp.WithObservationStore(store)}
+}
+
+// WithOSCORE protects requests, responses and notifications end-to-end by OSCORE (RFC 8613) security context.
+// Unprotected requests are rejected with 4.01 Unauthorized. A server shares the context by all connections.
+func WithOSCORE(ctx *oscore.Context) TCPOpt {
+	o := tcp.WithOSCORE(ctx)
+	return TCPOpt{server: o, dial: o}
+}
+
+// WithParserLimits bounds received messages independently of the max message size, see tcp.WithParserLimits.
+func WithParserLimits(maxOptions, maxOptionLen, maxTokenLen, maxPayload int) TCPOpt {
+	o := tcp.WithParserLimits(maxOptions, maxOptionLen, maxTokenLen, maxPayload)
+	return TCPOpt{server: o, dial: o}
+}
+
+// OnNewClientConnOpt network option.
+type OnNewClientConnOpt struct {
+	onNewClientConn OnNewClientConnFunc
+}
+
+func (o OnNewClientConnOpt) apply(opts *serverOptions) {
+	opts.onNewClientConn = o.onNewClientConn
+}
+
+// WithOnNewClientConn server's notify about new client connection. The request is the upgraded HTTP request,
+// e.g. to get the peer certificate of wss connection.
+func WithOnNewClientConn(onNewClientConn OnNewClientConnFunc) OnNewClientConnOpt {
+	return OnNewClientConnOpt{
+		onNewClientConn: onNewClientConn,
+	}
+}
+
+// CheckOriginOpt origin option.
+type CheckOriginOpt struct {
+	checkOrigin CheckOriginFunc
+}
+
+func (o CheckOriginOpt) apply(opts *serverOptions) {
+	opts.checkOrigin = o.checkOrigin
+}
+
+// WithCheckOrigin sets function which accepts or rejects WebSocket handshake by the request, e.g. by Origin
+// header of a browser. By default all requests are accepted.
+func WithCheckOrigin(checkOrigin CheckOriginFunc) CheckOriginOpt {
+	return CheckOriginOpt{checkOrigin: checkOrigin}
+}
+
+// TLSOpt tls configuration option.
+type TLSOpt struct {
+	tlsCfg *tls.Config
+}
+
+func (o TLSOpt) applyDial(opts *dialOptions) {
+	opts.tlsCfg = o.tlsCfg
+}
+
+// WithTLS configure's a client to use wss with given TLS config.
+func WithTLS(cfg *tls.Config) TLSOpt {
+	return TLSOpt{tlsCfg: cfg}
+}
+
+// DialerOpt dialer option.
+type DialerOpt struct {
+	dialer *net.Dialer
+}
+
+func (o DialerOpt) applyDial(opts *dialOptions) {
+	if o.dialer != nil {
+		opts.dialer = o.dialer
+	}
+}
+
+// WithDialer set dialer for dial.
+func WithDialer(dialer *net.Dialer) DialerOpt {
+	return DialerOpt{
+		dialer: dialer,
+	}
+}
+
+// HeaderOpt handshake header option.
+type HeaderOpt struct {
+	origin string
+	header http.Header
+}
+
+func (o HeaderOpt) applyDial(opts *dialOptions) {
+	if o.origin != "" {
+		opts.origin = o.origin
+	}
+	for k, v := range o.header {
+		opts.header[k] = v
+	}
+}
+
+// WithOrigin sets Origin header of the WebSocket handshake. By default it is derived from the target.
+func WithOrigin(origin string) HeaderOpt {
+	return HeaderOpt{origin: origin}
+}
+
+// WithHeader adds header to the WebSocket handshake, e.g. Authorization.
+func WithHeader(header http.Header) HeaderOpt {
+	return HeaderOpt{header: header}
+}
+
+// WithStrictSignaling enforces the signaling state machine of RFC 8323, see tcp.WithStrictSignaling.
+func WithStrictSignaling(csmTimeout time.Duration) TCPOpt {
+	o := tcp.WithStrictSignaling(csmTimeout)
+	return TCPOpt{server: o, dial: o}
+}
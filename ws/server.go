@@ -0,0 +1,282 @@
+// Package ws implements CoAP over WebSockets (RFC 8323 section 4), so browsers and clients behind
+// HTTP infrastructure can talk CoAP. Messages are processed by the coap+tcp session of the tcp package,
+// only the framing and the connection setup differ.
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// Subprotocol is the WebSocket subprotocol of CoAP.
+	Subprotocol = "coap"
+	// WellKnownPath is the path of the CoAP WebSocket endpoint.
+	WellKnownPath = "/.well-known/coap"
+)
+
+// A ServerOption sets options such as handler, errors parameters, etc.
+type ServerOption interface {
+	apply(*serverOptions)
+}
+
+type ClientConn = tcp.ClientConn
+
+type ResponseWriter = tcp.ResponseWriter
+
+// The HandlerFunc type is an adapter to allow the use of
+// ordinary functions as COAP handlers.
+type HandlerFunc = tcp.HandlerFunc
+
+type ErrorFunc = tcp.ErrorFunc
+
+type GoPoolFunc = tcp.GoPoolFunc
+
+// OnNewClientConnFunc is the callback for new connections. The request is the upgraded HTTP request
+// and it should be treated as "read-only" parameter.
+type OnNewClientConnFunc = func(cc *ClientConn, req *http.Request)
+
+// CheckOriginFunc accepts WebSocket handshake when it returns nil.
+type CheckOriginFunc = func(req *http.Request) error
+
+var defaultServerOptions = serverOptions{
+	ctx:            context.Background(),
+	maxMessageSize: 64 * 1024,
+	errors: func(err error) {
+		fmt.Println(err)
+	},
+	tcp: []tcp.ServerOption{
+		tcp.WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+			w.SetResponse(codes.NotFound, message.TextPlain, nil)
+		}),
+	},
+}
+
+type serverOptions struct {
+	ctx             context.Context
+	maxMessageSize  int
+	errors          ErrorFunc
+	logger          coapNet.Logger
+	onNewClientConn OnNewClientConnFunc
+	checkOrigin     CheckOriginFunc
+	keepAlive       *keepAlive
+	keepAliveMode   KeepAliveMode
+	tcp             []tcp.ServerOption
+}
+
+// Server accepts WebSocket connections and serves CoAP over them.
+type Server struct {
+	maxMessageSize int
+	errors         ErrorFunc
+	checkOrigin    CheckOriginFunc
+	tcp            *tcp.Server
+	listener       *listener
+	// requests are upgraded requests by remote address of their connections
+	requests sync.Map
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serveOnce sync.Once
+}
+
+func NewServer(opt ...ServerOption) *Server {
+	opts := defaultServerOptions
+	opts.tcp = append([]tcp.ServerOption{}, defaultServerOptions.tcp...)
+	for _, o := range opt {
+		o.apply(&opts)
+	}
+
+	ctx, cancel := context.WithCancel(opts.ctx)
+	errorsFunc := opts.errors
+	s := Server{
+		ctx:            ctx,
+		cancel:         cancel,
+		maxMessageSize: opts.maxMessageSize,
+		checkOrigin:    opts.checkOrigin,
+		errors: func(err error) {
+			if errors.Is(err, context.Canceled) {
+				// this error was produced by cancellation context - don't report it.
+				return
+			}
+			errorsFunc(fmt.Errorf("ws: %w", err))
+		},
+		listener: newListener(),
+	}
+	tcpOpts := opts.tcp
+	if opts.logger != nil {
+		// the coap+tcp sessions log their events by coapNet.LogTraceHandler
+		tcpOpts = append(tcpOpts, tcp.WithLogger(opts.logger))
+	}
+	tcpOpts = append(tcpOpts,
+		tcp.WithContext(ctx),
+		tcp.WithMaxMessageSize(opts.maxMessageSize),
+		tcp.WithErrors(errorsFunc),
+	)
+	if opts.keepAlive != nil {
+		tcpOpts = append(tcpOpts, keepAliveOption(opts.keepAlive, opts.keepAliveMode))
+	}
+	if opts.onNewClientConn != nil {
+		onNewClientConn := opts.onNewClientConn
+		tcpOpts = append(tcpOpts, tcp.WithOnNewClientConn(func(cc *ClientConn, _ *tls.Conn) {
+			var req *http.Request
+			if v, ok := s.requests.Load(cc.RemoteAddr()); ok {
+				req = v.(*http.Request)
+			}
+			onNewClientConn(cc, req)
+		}))
+	}
+	s.tcp = tcp.NewServer(tcpOpts...)
+	return &s
+}
+
+// serve starts processing of upgraded connections.
+func (s *Server) serve() {
+	s.serveOnce.Do(func() {
+		go func() {
+			err := s.tcp.Serve(s.listener)
+			if err != nil {
+				s.errors(err)
+			}
+		}()
+	})
+}
+
+// Serve serves WebSocket handshakes at WellKnownPath on the listener until Stop is called.
+func (s *Server) Serve(l net.Listener) error {
+	m := http.NewServeMux()
+	m.Handle(WellKnownPath, s)
+	srv := http.Server{
+		Handler: m,
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+	}
+	go func() {
+		<-s.ctx.Done()
+		srv.Close()
+	}()
+	err := srv.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP upgrades the request to WebSocket connection and serves CoAP over it. It allows to mount the server
+// to an existing HTTP server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	select {
+	case <-s.ctx.Done():
+		http.Error(w, "server is stopped", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	s.serve()
+	p := newPinger()
+	websocket.Server{
+		Handshake: s.handshake,
+		Handler: func(ws *websocket.Conn) {
+			s.handle(ws, req, p)
+		},
+	}.ServeHTTP(pingerResponseWriter{ResponseWriter: w, pinger: p}, req)
+}
+
+func (s *Server) handshake(config *websocket.Config, req *http.Request) error {
+	if s.checkOrigin != nil {
+		err := s.checkOrigin(req)
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range config.Protocol {
+		if p == Subprotocol {
+			config.Protocol = []string{Subprotocol}
+			return nil
+		}
+	}
+	return fmt.Errorf("subprotocol %v is not requested", Subprotocol)
+}
+
+func (s *Server) handle(ws *websocket.Conn, req *http.Request, p *pinger) {
+	ws.MaxPayloadBytes = s.maxMessageSize
+	var local net.Addr
+	if v, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		local = v
+	}
+	remote, err := net.ResolveTCPAddr("tcp", req.RemoteAddr)
+	if err != nil {
+		s.errors(fmt.Errorf("cannot resolve remote address %v: %w", req.RemoteAddr, err))
+		return
+	}
+	c := newConn(ws, local, remote, p)
+	s.requests.Store(c.RemoteAddr(), req)
+	defer s.requests.Delete(c.RemoteAddr())
+	err = s.listener.push(c)
+	if err != nil {
+		c.Close()
+		return
+	}
+	// the connection is closed when the handler returns
+	<-c.done
+}
+
+// Stop stops server without wait of ends Serve function.
+func (s *Server) Stop() {
+	s.cancel()
+	s.listener.Close()
+	s.tcp.Stop()
+}
+
+// listener passes upgraded connections to the tcp server.
+type listener struct {
+	conns     chan *conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newListener() *listener {
+	return &listener{
+		conns: make(chan *conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *listener) push(c *conn) error {
+	select {
+	case l.conns <- c:
+		return nil
+	case <-l.done:
+		return coapNet.ErrListenerIsClosed
+	}
+}
+
+func (l *listener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, coapNet.ErrListenerIsClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
@@ -0,0 +1,231 @@
+package ws_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+	"github.com/plgd-dev/go-coap/v2/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	big := bytes.Repeat([]byte("x"), 5000)
+	m := mux.NewRouter()
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(big))
+		require.NoError(t, err)
+	}))
+	m.Handle("/echo", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Changed, message.TextPlain, bytes.NewReader(body))
+		require.NoError(t, err)
+	}))
+
+	var newConnMutex sync.Mutex
+	var userAgent string
+	s := ws.NewServer(ws.WithMux(m), ws.WithOnNewClientConn(func(cc *ws.ClientConn, req *http.Request) {
+		newConnMutex.Lock()
+		defer newConnMutex.Unlock()
+		userAgent = req.Header.Get("User-Agent")
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := ws.Dial("coap+ws://"+l.Addr().String(), ws.WithHeader(http.Header{"User-Agent": []string{"test"}}))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, big, body)
+
+	resp, err = cc.Post(ctx, "/echo", message.TextPlain, bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	body, err = resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), body)
+
+	resp, err = cc.Get(ctx, "/unknown")
+	require.NoError(t, err)
+	require.Equal(t, codes.NotFound, resp.Code())
+
+	newConnMutex.Lock()
+	defer newConnMutex.Unlock()
+	require.Equal(t, "test", userAgent)
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	s := ws.NewServer(
+		ws.WithCheckOrigin(func(req *http.Request) error {
+			if req.Header.Get("Origin") != "http://allowed" {
+				return errors.New("origin is not allowed")
+			}
+			return nil
+		}),
+		ws.WithHandlerFunc(func(w *ws.ResponseWriter, r *pool.Message) {
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("b")))
+			require.NoError(t, err)
+		}),
+	)
+	defer s.Stop()
+	m := http.NewServeMux()
+	m.Handle("/coap", s)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	target := "ws" + strings.TrimPrefix(srv.URL, "http") + "/coap"
+
+	_, err := ws.Dial(target)
+	require.Error(t, err)
+
+	cc, err := ws.Dial(target, ws.WithOrigin("http://allowed"))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/b")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+}
+
+func TestServer_KeepAliveWebSocket(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	conns := make(chan *ws.ClientConn, 1)
+	s := ws.NewServer(ws.WithKeepAlive(time.Millisecond*100, time.Second*2, func(cc inactivity.ClientConn) {
+		require.Fail(t, "the client answers pings")
+	}), ws.WithKeepAliveMode(ws.KeepAliveWebSocket), ws.WithOnNewClientConn(func(cc *ws.ClientConn, req *http.Request) {
+		conns <- cc
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := ws.Dial("coap+ws://"+l.Addr().String(), ws.WithKeepAlive(time.Millisecond*100, time.Second*2, nil),
+		ws.WithKeepAliveMode(ws.KeepAliveWebSocket))
+	require.NoError(t, err)
+	defer func() {
+		cc.Close()
+		<-cc.Done()
+	}()
+	serverCC := <-conns
+
+	// the connections are idle, so the peers are pinged by WebSocket Ping frames
+	require.Eventually(t, func() bool {
+		return cc.Liveness().RTT > 0 && serverCC.Liveness().RTT > 0
+	}, time.Second*3, time.Millisecond*20)
+	require.False(t, cc.Liveness().Inactive)
+	require.False(t, serverCC.Liveness().Inactive)
+	require.False(t, serverCC.Liveness().LastActivity.IsZero())
+}
+
+type logRecorder struct {
+	sync.Mutex
+	entries []string
+}
+
+func (r *logRecorder) log(level, msg string) {
+	r.Lock()
+	defer r.Unlock()
+	r.entries = append(r.entries, level+" "+msg)
+}
+
+func (r *logRecorder) Debug(msg string, _ ...interface{}) { r.log("debug", msg) }
+func (r *logRecorder) Info(msg string, _ ...interface{})  { r.log("info", msg) }
+func (r *logRecorder) Warn(msg string, _ ...interface{})  { r.log("warn", msg) }
+func (r *logRecorder) Error(msg string, _ ...interface{}) { r.log("error", msg) }
+
+func (r *logRecorder) count(entry string) int {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, e := range r.entries {
+		if e == entry {
+			n++
+		}
+	}
+	return n
+}
+
+func TestServer_Logger(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var serverLog logRecorder
+	s := ws.NewServer(ws.WithLogger(&serverLog))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var clientLog logRecorder
+	cc, err := ws.Dial("coap+ws://"+l.Addr().String(), ws.WithLogger(&clientLog))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+
+	require.Equal(t, 1, clientLog.count("info session started"))
+	require.Eventually(t, func() bool { return serverLog.count("info session started") == 1 }, time.Second, time.Millisecond*10)
+	err = cc.Close()
+	require.NoError(t, err)
+	<-cc.Done()
+	require.Eventually(t, func() bool { return clientLog.count("info session closed") == 1 }, time.Second, time.Millisecond*10)
+}